@@ -11,9 +11,12 @@ import (
 	"syscall"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/cmd/workers"
 	"carbon-scribe/project-portal/project-portal-backend/internal/auth"
 	"carbon-scribe/project-portal/project-portal-backend/internal/collaboration"
 	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
 	"carbon-scribe/project-portal/project-portal-backend/internal/config"
 	"carbon-scribe/project-portal/project-portal-backend/internal/documents"
 	"carbon-scribe/project-portal/project-portal-backend/internal/geospatial"
@@ -23,10 +26,17 @@ import (
 	"carbon-scribe/project-portal/project-portal-backend/internal/reports"
 	"carbon-scribe/project-portal/project-portal-backend/internal/search"
 	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+	settingsintegrations "carbon-scribe/project-portal/project-portal-backend/internal/settings/integrations"
+	auditpkg "carbon-scribe/project-portal/project-portal-backend/pkg/audit"
+	pkgbilling "carbon-scribe/project-portal/project-portal-backend/pkg/billing"
 	"carbon-scribe/project-portal/project-portal-backend/pkg/elastic"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/email"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/encryption"
 	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -90,13 +100,7 @@ func main() {
 	integrationService := integration.NewService(integrationRepo)
 	integrationHandler := integration.NewHandler(integrationService)
 
-	reportsRepo := reports.NewRepository(db)
-	reportsService := reports.NewService(reportsRepo, nil) // Exporter can be added later
-	reportsHandler := reports.NewHandler(reportsService)
-
 	projectRepo := project.NewRepository(db)
-	projectService := project.NewService(projectRepo)
-	projectHandler := project.NewHandler(projectService)
 
 	// Initialize document management service
 	var docsHandler *documents.Handler
@@ -131,24 +135,166 @@ func main() {
 		docSvc := documents.NewServiceWithIPFS(docRepo, docStorageSvc, ipfsUploader)
 		docsHandler = documents.NewHandler(docSvc)
 	}
+
+	// Privacy requests reach the data of every module; stored files are
+	// removed on erasure when S3 is available
+	var privacyStore requests.ObjectStore
+	var privacyExportStore compliance.ExportStore
+	var retentionStore retention.ObjectStore
+	if s3Err == nil {
+		privacyStore = s3Client
+		privacyExportStore = s3Client
+		retentionStore = s3Client
+	}
+	var privacyNotifier compliance.RequestNotifier
+	if cfg.Email.SMTPHost != "" {
+		privacyNotifier = compliance.EmailRequestNotifier{
+			Sender:    email.NewSMTPSender(smtpConfig(cfg.Email)),
+			Recipient: userEmailByID(db),
+			Officers:  cfg.Compliance.OfficerEmails,
+		}
+	} else {
+		log.Println("⚠️  Compliance: SMTP_HOST not set — privacy requests cannot be verified by email")
+	}
+	if cfg.Compliance.AuditSigningKey == "" {
+		log.Println("⚠️  Compliance: COMPLIANCE_AUDIT_SIGNING_KEY not set — audit checkpoints will not be signed")
+	}
+	var indexPurgers []requests.IndexPurger
+	if esClient != nil {
+		indexPurgers = append(indexPurgers, searchService)
+	}
 	complianceRepo := compliance.NewRepository(db)
-	complianceService := compliance.NewService(complianceRepo)
+	// Retention policies reach the aged data of every module; files and
+	// archives are only handled when S3 is available
+	var retentionTargets []retention.Target
+	retentionTargets = append(retentionTargets, settings.RetentionTargets()...)
+	retentionTargets = append(retentionTargets, collaboration.RetentionTargets()...)
+	retentionTargets = append(retentionTargets, documents.RetentionTargets()...)
+	retentionTargets = append(retentionTargets, reports.RetentionTargets()...)
+	retentionTargets = append(retentionTargets, compliance.RetentionTargets()...)
+	retentionTargets = append(retentionTargets, integration.RetentionTargets()...)
+	retentionEnforcer := retention.NewEnforcer(db, retentionStore, complianceRepo, nil, retention.Config{
+		BatchSize:  cfg.Compliance.RetentionBatchSize,
+		BatchPause: cfg.Compliance.RetentionBatchPause,
+		ColdPrefix: cfg.Compliance.ColdStoragePrefix,
+	}, retentionTargets...)
+	complianceService := compliance.NewServiceWithConfig(complianceRepo, compliance.Config{
+		IndexPurgers:        indexPurgers,
+		ExportStore:         privacyExportStore,
+		Notifier:            privacyNotifier,
+		VerificationCodeTTL: cfg.Compliance.VerificationCodeTTL,
+		EscalateBefore:      cfg.Compliance.EscalateBefore,
+		ExportRetention:     cfg.Compliance.ExportRetention,
+		ExportURLExpiry:     cfg.Compliance.ExportURLExpiry,
+		Retention:           retentionEnforcer,
+		AuditSigningKey:     []byte(cfg.Compliance.AuditSigningKey),
+		IntegrityAlerter:    auditIntegrityAlerts(healthService),
+		Redactor:            auditpkg.NewSensitiveDataClassifier(),
+		DataProviders: []requests.Provider{
+			settings.NewPrivacyProvider(db, privacyStore),
+			collaboration.NewPrivacyProvider(db),
+			documents.NewPrivacyProvider(db, privacyStore),
+			reports.NewPrivacyProvider(db, privacyStore),
+			compliance.NewPrivacyProvider(db),
+			integration.NewPrivacyProvider(db),
+		},
+	})
 	complianceHandler := compliance.NewHandler(complianceService)
 
+	// Streamed report exports are uploaded to S3 when it is available
+	var reportStore reports.ResultStore
+	if s3Err == nil {
+		reportStore = s3Client
+	}
+	reportsRepo := reports.NewRepository(db)
+
 	geospatialRepo := geospatial.NewRepository(db)
 	geospatialService := geospatial.NewService(geospatialRepo)
 	geospatialHandler := geospatial.NewHandler(geospatialService)
 	settingsRepo := settings.NewRepository(db)
+	oauthProviders := make([]settingsintegrations.OAuthProvider, 0, len(cfg.Settings.OAuthProviders))
+	for _, p := range cfg.Settings.OAuthProviders {
+		oauthProviders = append(oauthProviders, settingsintegrations.OAuthProvider(p))
+	}
+	var settingsKMS encryption.KMS
+	if cfg.Settings.KeyringFile != "" {
+		localKMS, err := encryption.OpenLocalFileKMS(cfg.Settings.KeyringFile, cfg.Settings.KeyringKeyID)
+		if err != nil {
+			log.Fatalf("❌ Failed to open settings keyring: %v", err)
+		}
+		settingsKMS = localKMS
+	}
+	// Invoice PDFs, profile pictures and account exports are stored in S3
+	// when it is available
+	var invoiceStore settings.InvoiceStore
+	var pictureStore settings.PictureStore
+	var exportStore settings.ExportStore
+	if s3Err == nil {
+		invoiceStore = s3Client
+		pictureStore = s3Client
+		exportStore = s3Client
+	}
+	// Without Stripe, payments stay off unless the fake processor is asked
+	// for explicitly, so invoices are never marked paid by accident
+	var paymentProcessor pkgbilling.PaymentProcessor
+	switch {
+	case cfg.Settings.StripeSecretKey != "":
+		paymentProcessor = pkgbilling.NewStripeProcessor(cfg.Settings.StripeSecretKey, cfg.Settings.StripeWebhookSecret)
+	case cfg.Settings.BillingFakeProcessor:
+		log.Println("⚠️  Billing: SETTINGS_BILLING_FAKE_PROCESSOR set — payments use the in-memory fake processor and never move money")
+		paymentProcessor = pkgbilling.NewFakeProcessor(cfg.Settings.StripeWebhookSecret)
+	default:
+		log.Println("⚠️  Billing: STRIPE_SECRET_KEY not set — payment collection is disabled")
+	}
+	var billingNotifier settings.BillingNotifier
+	var exportNotifier settings.AccountExportNotifier
+	if cfg.Email.SMTPHost != "" {
+		sender := email.NewSMTPSender(smtpConfig(cfg.Email))
+		billingNotifier = settings.EmailBillingNotifier{Sender: sender, Recipient: userEmail(db)}
+		exportNotifier = settings.EmailAccountExportNotifier{Sender: sender, Recipient: userEmail(db)}
+	}
 	settingsService, err := settings.NewService(settingsRepo, settings.Config{
-		EncryptionKeyHex: cfg.Settings.EncryptionKeyHex,
-		APIKeyPrefix:     cfg.Settings.APIKeyPrefix,
-		ProfileCDNBase:   cfg.Settings.ProfileCDNBase,
+		EncryptionKeyHex:       cfg.Settings.EncryptionKeyHex,
+		APIKeyPrefix:           cfg.Settings.APIKeyPrefix,
+		ProfileCDNBase:         cfg.Settings.ProfileCDNBase,
+		OAuthProviders:         oauthProviders,
+		OAuthRefreshWindow:     cfg.Settings.OAuthRefreshWindow,
+		KMS:                    settingsKMS,
+		KeyRotationInterval:    cfg.Settings.KeyRotationInterval,
+		HealthHistoryRetention: cfg.Settings.HealthRetention,
+		APIKeyExpiryWarning:    cfg.Settings.APIKeyExpiryWarning,
+		UsageMeters:            usageMeters(db, projectRepo, reportsRepo),
+		InvoiceStore:           invoiceStore,
+		InvoiceURLExpiry:       cfg.Settings.InvoiceURLExpiry,
+		PaymentTermsDays:       cfg.Settings.PaymentTermsDays,
+		PaymentProcessor:       paymentProcessor,
+		BillingNotifier:        billingNotifier,
+		PictureStore:           pictureStore,
+		ProfilePictureMaxBytes: cfg.Settings.ProfilePictureMaxBytes,
+		ExportSources:          exportSources(db, collabRepo, reportsRepo),
+		ExportStore:            exportStore,
+		ExportNotifier:         exportNotifier,
+		ExportRetention:        cfg.Settings.ExportRetention,
+		ExportURLExpiry:        cfg.Settings.ExportURLExpiry,
 	})
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize settings service: %v", err)
 	}
 	settingsHandler := settings.NewHandler(settingsService)
 
+	// Projects and report schedules count against the owner's plan quotas,
+	// and credits issued to projects are metered
+	projectService := project.NewServiceWithBilling(projectRepo, settingsService)
+	projectHandler := project.NewHandler(projectService)
+	reportsService := reports.NewServiceWithConfig(reportsRepo, reports.NewExporter(), reports.Config{
+		PeerMinCohortSize: cfg.Reports.PeerMinCohortSize,
+		AuditLogger:       complianceService,
+		ResultStore:       reportStore,
+		DefaultCacheTTL:   cfg.Reports.ExecutionCacheTTL,
+		Quotas:            settingsService,
+	})
+	reportsHandler := reports.NewHandler(reportsService)
+
 	// Setup Gin
 	if !cfg.Debug {
 		gin.SetMode(gin.ReleaseMode)
@@ -159,6 +305,9 @@ func main() {
 	// Add CORS middleware
 	router.Use(corsMiddleware())
 
+	// Audit every mutating API call; handlers record what they changed
+	router.Use(auditpkg.Middleware(complianceService, "project-portal"))
+
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -241,6 +390,27 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Background workers run until shutdown
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	go workers.NewBenchmarkWorker(reportsService, cfg.Reports.PeerBenchmarkInterval).Run(workerCtx)
+	go workers.NewReportSnapshotWorker(reportsService, cfg.Reports.SnapshotPurgeInterval).Run(workerCtx)
+	go workers.NewOAuthRefreshWorker(settingsService, cfg.Settings.OAuthRefreshInterval).Run(workerCtx)
+	go workers.NewIntegrationProbeWorker(settingsService, cfg.Settings.ProbeInterval).Run(workerCtx)
+	go workers.NewAPIKeyUsageWorker(settingsService, cfg.Settings.APIKeyUsageFlushInterval).Run(workerCtx)
+	go workers.NewAPIKeyWebhookWorker(settingsService, cfg.Settings.APIKeyWebhookInterval).Run(workerCtx)
+	go workers.NewBillingWorker(settingsService, settingsService, cfg.Settings.BillingInterval).Run(workerCtx)
+	go workers.NewUsageMeterWorker(settingsService, cfg.Settings.UsageMeterInterval).Run(workerCtx)
+	go workers.NewInvoiceWorker(settingsService, cfg.Settings.InvoiceInterval).Run(workerCtx)
+	go workers.NewAccountExportWorker(settingsService, cfg.Settings.ExportInterval).Run(workerCtx)
+	go workers.NewComplianceRequestWorker(complianceService, cfg.Compliance.RequestInterval).Run(workerCtx)
+	go workers.NewComplianceRetentionWorker(complianceService, cfg.Compliance.RetentionInterval).Run(workerCtx)
+	go workers.NewComplianceAuditWorker(complianceService, cfg.Compliance.AuditInterval, cfg.Compliance.AuditVerifyWindow).Run(workerCtx)
+	if settingsKMS != nil {
+		go workers.NewKeyRotationWorker(settingsService, cfg.Settings.ReencryptInterval).Run(workerCtx)
+	}
+
 	// Channel to listen for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -270,6 +440,7 @@ func main() {
 	// Wait for interrupt signal
 	<-quit
 	fmt.Println("\n🛑 Shutdown signal received...")
+	stopWorkers()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -283,6 +454,98 @@ func main() {
 	fmt.Println("✅ Server exited gracefully")
 }
 
+// usageMeters measures billing usage from the modules that own it. Credits
+// minted are recorded by the project service through RecordUsage instead.
+func usageMeters(db *gorm.DB, projectRepo project.Repository, reportsRepo reports.Repository) []settings.UsageMeter {
+	documentRepo := documents.NewRepository(db)
+	return []settings.UsageMeter{
+		{Metric: settingsbilling.QuotaStorageMB, Measure: settings.CurrentUsage(func(ctx context.Context, userID uuid.UUID) (int64, error) {
+			bytes, err := documentRepo.StorageBytesByUploader(ctx, userID)
+			return settingsbilling.BytesToMB(bytes), err
+		})},
+		{Metric: settingsbilling.QuotaProjects, Measure: settings.CurrentUsage(projectRepo.CountActiveByOwner)},
+		{Metric: settingsbilling.QuotaReportSchedules, Measure: settings.CurrentUsage(reportsRepo.CountActiveSchedulesByOwner)},
+		{Metric: settingsbilling.MetricReportExecutions, Measure: reportsRepo.CountExecutionsByUser},
+	}
+}
+
+// exportSources adds the account data other modules hold to settings
+// account exports
+func exportSources(db *gorm.DB, collabRepo collaboration.Repository, reportsRepo reports.Repository) []settings.ExportSource {
+	documentRepo := documents.NewRepository(db)
+	return []settings.ExportSource{
+		{Category: "project_memberships", Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return collabRepo.ListMembershipsByUser(ctx, userID.String())
+		}},
+		{Category: "comments", Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return collabRepo.ListCommentsByUser(ctx, userID.String())
+		}},
+		{Category: "tasks", Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return collabRepo.ListTasksByUser(ctx, userID.String())
+		}},
+		{Category: "documents", Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return documentRepo.ListByUploader(ctx, userID)
+		}},
+		{Category: "report_definitions", Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return reportsRepo.ListReportDefinitionsByOwner(ctx, userID)
+		}},
+	}
+}
+
+func smtpConfig(cfg config.EmailConfig) email.SMTPConfig {
+	return email.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.From,
+	}
+}
+
+// userEmail looks up the address of an account in the users table
+func userEmail(db *gorm.DB) func(ctx context.Context, userID uuid.UUID) (string, error) {
+	return func(ctx context.Context, userID uuid.UUID) (string, error) {
+		var address string
+		err := db.WithContext(ctx).Table("users").Select("email").Where("id = ?", userID).Scan(&address).Error
+		return address, err
+	}
+}
+
+// userEmailByID looks up an account address by its ID in string form
+func userEmailByID(db *gorm.DB) func(ctx context.Context, userID string) (string, error) {
+	lookup := userEmail(db)
+	return func(ctx context.Context, userID string) (string, error) {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return "", fmt.Errorf("invalid user ID %q: %w", userID, err)
+		}
+		return lookup(ctx, id)
+	}
+}
+
+// auditIntegrityAlerts raises a critical system alert for each audit log
+// integrity failure; repeated checks of the same break do not alert again
+func auditIntegrityAlerts(healthService health.Service) compliance.IntegrityAlerter {
+	return compliance.IntegrityAlertFunc(func(ctx context.Context, v *compliance.AuditVerification) error {
+		first := v.Breaks[0]
+		_, err := healthService.RaiseAlert(ctx, health.RaiseAlertRequest{
+			AlertID:     fmt.Sprintf("audit-integrity-%s-%d", first.Kind, first.LogID),
+			AlertName:   "Audit log integrity failure",
+			Severity:    "critical",
+			Source:      "audit_verification",
+			ServiceName: "compliance",
+			ResourceID:  fmt.Sprintf("audit_log:%d", first.LogID),
+			Description: fmt.Sprintf("%d integrity breaks in audit logs %d to %d; first: %s", len(v.Breaks), v.FirstLogID, v.LastLogID, first.Detail),
+			Condition: map[string]interface{}{
+				"from":   v.From,
+				"to":     v.To,
+				"breaks": v.Breaks,
+			},
+		})
+		return err
+	})
+}
+
 // initDatabase initializes the GORM database connection
 func initDatabase(config *config.Config) (*gorm.DB, error) {
 	gormConfig := &gorm.Config{
@@ -353,6 +616,7 @@ func runAllMigrations(db *gorm.DB) error {
 		&reports.ReportExecution{},
 		&reports.BenchmarkDataset{},
 		&reports.DashboardWidget{},
+		&reports.ReportShareLink{},
 
 		// Compliance models
 		&compliance.RetentionPolicy{},
@@ -360,6 +624,7 @@ func runAllMigrations(db *gorm.DB) error {
 		&compliance.PrivacyPreference{},
 		&compliance.ConsentRecord{},
 		&compliance.AuditLog{},
+		&compliance.AuditCheckpoint{},
 		&compliance.RetentionSchedule{},
 		&compliance.LegalHold{},
 
@@ -367,9 +632,15 @@ func runAllMigrations(db *gorm.DB) error {
 		&settings.UserProfile{},
 		&settings.NotificationPreference{},
 		&settings.APIKey{},
+		&settings.APIKeyUsageBucket{},
+		&settings.APIKeyWebhookDelivery{},
 		&settings.IntegrationConfiguration{},
+		&settings.OAuthState{},
 		&settings.Subscription{},
 		&settings.Invoice{},
+		&settings.InvoiceSequence{},
+		&settings.PaymentWebhookEvent{},
+		&settings.AccountExport{},
 	)
 
 	if err != nil {
@@ -0,0 +1,62 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// AccountExporter builds queued account data exports
+type AccountExporter interface {
+	ProcessAccountExports(ctx context.Context) (*settings.AccountExportRunResult, error)
+}
+
+// AccountExportWorker periodically builds requested account exports and
+// deletes archives that have expired
+type AccountExportWorker struct {
+	exporter AccountExporter
+	interval time.Duration
+}
+
+// NewAccountExportWorker creates a worker that processes exports every
+// interval
+func NewAccountExportWorker(exporter AccountExporter, interval time.Duration) *AccountExportWorker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &AccountExportWorker{exporter: exporter, interval: interval}
+}
+
+// Run processes immediately and then on every tick until ctx is cancelled
+func (w *AccountExportWorker) Run(ctx context.Context) {
+	log.Printf("account export worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("account export worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *AccountExportWorker) run(ctx context.Context) {
+	result, err := w.exporter.ProcessAccountExports(ctx)
+	if err != nil {
+		log.Printf("account export worker: run failed: %v", err)
+		return
+	}
+	if result.Completed+result.Failed+result.Expired == 0 {
+		return
+	}
+	log.Printf("account export worker: %d exports completed, %d failed, %d expired",
+		result.Completed, result.Failed, result.Expired)
+}
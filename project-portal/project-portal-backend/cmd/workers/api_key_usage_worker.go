@@ -0,0 +1,54 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// APIKeyUsageFlusher writes buffered API key usage counters
+type APIKeyUsageFlusher interface {
+	FlushAPIKeyUsage(ctx context.Context) (int, error)
+}
+
+// APIKeyUsageWorker periodically persists API key usage so analytics survive
+// restarts. Counters still buffered at shutdown are written before it exits.
+type APIKeyUsageWorker struct {
+	flusher  APIKeyUsageFlusher
+	interval time.Duration
+}
+
+// NewAPIKeyUsageWorker creates a worker that flushes usage every interval
+func NewAPIKeyUsageWorker(flusher APIKeyUsageFlusher, interval time.Duration) *APIKeyUsageWorker {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &APIKeyUsageWorker{flusher: flusher, interval: interval}
+}
+
+// Run flushes on every tick until ctx is cancelled, then flushes once more
+func (w *APIKeyUsageWorker) Run(ctx context.Context) {
+	log.Printf("api key usage worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			w.flush(flushCtx)
+			cancel()
+			log.Println("api key usage worker stopped")
+			return
+		case <-ticker.C:
+			w.flush(ctx)
+		}
+	}
+}
+
+func (w *APIKeyUsageWorker) flush(ctx context.Context) {
+	if _, err := w.flusher.FlushAPIKeyUsage(ctx); err != nil {
+		log.Printf("api key usage worker: flush failed: %v", err)
+	}
+}
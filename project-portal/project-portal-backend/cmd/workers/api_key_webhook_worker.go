@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// APIKeyWebhookProcessor raises scheduled API key events and sends due webhooks
+type APIKeyWebhookProcessor interface {
+	ProcessAPIKeyWebhooks(ctx context.Context) (*settings.APIKeyWebhookRunResult, error)
+}
+
+// APIKeyWebhookWorker periodically delivers API key webhooks, including
+// retries, and checks for expiring keys and usage spikes
+type APIKeyWebhookWorker struct {
+	processor APIKeyWebhookProcessor
+	interval  time.Duration
+}
+
+// NewAPIKeyWebhookWorker creates a worker that processes webhooks every interval
+func NewAPIKeyWebhookWorker(processor APIKeyWebhookProcessor, interval time.Duration) *APIKeyWebhookWorker {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &APIKeyWebhookWorker{processor: processor, interval: interval}
+}
+
+// Run processes immediately and then on every tick until ctx is cancelled
+func (w *APIKeyWebhookWorker) Run(ctx context.Context) {
+	log.Printf("api key webhook worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("api key webhook worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *APIKeyWebhookWorker) run(ctx context.Context) {
+	result, err := w.processor.ProcessAPIKeyWebhooks(ctx)
+	if err != nil {
+		log.Printf("api key webhook worker: run failed: %v", err)
+		return
+	}
+	if result.Delivered+result.Retrying+result.Failed+result.ExpiringNotified+result.SpikesDetected == 0 {
+		return
+	}
+	log.Printf("api key webhook worker: %d delivered, %d retrying, %d failed, %d expiring, %d spikes",
+		result.Delivered, result.Retrying, result.Failed, result.ExpiringNotified, result.SpikesDetected)
+}
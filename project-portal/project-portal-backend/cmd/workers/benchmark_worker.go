@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports"
+)
+
+// PeerBenchmarkRefresher recomputes peer-derived benchmark datasets
+type PeerBenchmarkRefresher interface {
+	RefreshPeerBenchmarks(ctx context.Context) (*reports.PeerBenchmarkRefreshResult, error)
+}
+
+// BenchmarkWorker periodically recomputes peer benchmarks from portal projects
+type BenchmarkWorker struct {
+	refresher PeerBenchmarkRefresher
+	interval  time.Duration
+}
+
+// NewBenchmarkWorker creates a worker that refreshes peer benchmarks every interval
+func NewBenchmarkWorker(refresher PeerBenchmarkRefresher, interval time.Duration) *BenchmarkWorker {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &BenchmarkWorker{refresher: refresher, interval: interval}
+}
+
+// Run refreshes peer benchmarks immediately and then on every tick until ctx is cancelled
+func (w *BenchmarkWorker) Run(ctx context.Context) {
+	log.Printf("benchmark worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("benchmark worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *BenchmarkWorker) refresh(ctx context.Context) {
+	result, err := w.refresher.RefreshPeerBenchmarks(ctx)
+	if err != nil {
+		log.Printf("benchmark worker: refresh failed: %v", err)
+		return
+	}
+	log.Printf("benchmark worker: %d cohorts, %d published, %d suppressed, %d deactivated",
+		result.Cohorts, result.Published, result.Suppressed, result.Deactivated)
+}
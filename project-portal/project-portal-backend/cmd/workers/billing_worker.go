@@ -1,8 +1,75 @@
-//go:build future
-// +build future
-
 package workers
 
-// BillingWorker handles recurring billing and dunning operations for settings subscriptions.
-// Implementation pending integration with payment providers and settings service.
-type BillingWorker struct{}
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// SubscriptionRenewer closes subscription periods that have ended
+type SubscriptionRenewer interface {
+	RenewSubscriptions(ctx context.Context) (*settings.SubscriptionRenewalResult, error)
+}
+
+// PaymentCollector charges due invoices and works through dunning
+type PaymentCollector interface {
+	CollectPayments(ctx context.Context) (*settings.PaymentRunResult, error)
+}
+
+// BillingWorker periodically renews subscriptions, converts finished trials,
+// applies cancellations at period end and collects payment for open invoices
+type BillingWorker struct {
+	renewer   SubscriptionRenewer
+	collector PaymentCollector
+	interval  time.Duration
+}
+
+// NewBillingWorker creates a worker that runs the billing cycle every interval
+func NewBillingWorker(renewer SubscriptionRenewer, collector PaymentCollector, interval time.Duration) *BillingWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &BillingWorker{renewer: renewer, collector: collector, interval: interval}
+}
+
+// Run renews immediately and then on every tick until ctx is cancelled
+func (w *BillingWorker) Run(ctx context.Context) {
+	log.Printf("billing worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("billing worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *BillingWorker) run(ctx context.Context) {
+	result, err := w.renewer.RenewSubscriptions(ctx)
+	if err != nil {
+		log.Printf("billing worker: renewal failed: %v", err)
+	} else if result.Renewed+result.TrialsConverted+result.Canceled > 0 {
+		log.Printf("billing worker: %d renewed, %d trials converted, %d canceled, %d invoiced",
+			result.Renewed, result.TrialsConverted, result.Canceled, result.Invoiced)
+	}
+
+	payments, err := w.collector.CollectPayments(ctx)
+	if err != nil {
+		log.Printf("billing worker: payment collection failed: %v", err)
+		return
+	}
+	if payments.Attempted+payments.Canceled == 0 {
+		return
+	}
+	log.Printf("billing worker: %d charged, %d succeeded, %d pending, %d failed, %d errors, %d canceled for non-payment",
+		payments.Attempted, payments.Succeeded, payments.Pending, payments.Failed, payments.Errors, payments.Canceled)
+}
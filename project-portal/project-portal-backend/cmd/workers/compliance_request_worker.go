@@ -1,18 +1,62 @@
-//go:build future
-// +build future
-
 package workers
 
-// ComplianceRequestWorker processes pending privacy data subject requests.
-//
-// Responsibilities:
-// - Poll for requests in "received" status
-// - Verify requester identity
-// - For export requests: discover data, generate export package, update request
-// - For deletion requests: check legal holds, execute deletion, update request
-// - Send notifications on completion or failure
-// - Enforce jurisdiction-specific response deadlines (e.g., GDPR 30 days)
-//
-// This worker should run continuously or on a short interval (e.g., every 5 minutes).
-//
-// Implementation pending: requires database connection and compliance service setup.
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+)
+
+// PrivacyRequestProcessor works through verified privacy requests
+type PrivacyRequestProcessor interface {
+	ProcessPrivacyRequests(ctx context.Context) (*compliance.RequestRunResult, error)
+}
+
+// ComplianceRequestWorker periodically processes verified data subject
+// requests, escalates requests nearing their jurisdiction's response deadline
+// to compliance officers and deletes export packages that have expired
+type ComplianceRequestWorker struct {
+	processor PrivacyRequestProcessor
+	interval  time.Duration
+}
+
+// NewComplianceRequestWorker creates a worker that processes requests every
+// interval
+func NewComplianceRequestWorker(processor PrivacyRequestProcessor, interval time.Duration) *ComplianceRequestWorker {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &ComplianceRequestWorker{processor: processor, interval: interval}
+}
+
+// Run processes immediately and then on every tick until ctx is cancelled
+func (w *ComplianceRequestWorker) Run(ctx context.Context) {
+	log.Printf("compliance request worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("compliance request worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ComplianceRequestWorker) run(ctx context.Context) {
+	result, err := w.processor.ProcessPrivacyRequests(ctx)
+	if err != nil {
+		log.Printf("compliance request worker: run failed: %v", err)
+	}
+	if result == nil || result.Completed+result.Failed+result.Escalated+result.Expired == 0 {
+		return
+	}
+	log.Printf("compliance request worker: %d requests completed, %d failed, %d escalated, %d exports expired",
+		result.Completed, result.Failed, result.Escalated, result.Expired)
+}
@@ -1,17 +1,62 @@
-//go:build future
-// +build future
-
 package workers
 
-// ComplianceRetentionWorker runs on a schedule to enforce data retention policies.
-//
-// Responsibilities:
-// - Fetch due retention schedules from the database
-// - Check for legal holds before executing deletion/anonymization
-// - Execute the appropriate retention action (archive, anonymize, delete)
-// - Update schedule records with results
-// - Log all actions to the audit trail
-//
-// This worker should be run as a cron job (e.g., daily at 2 AM UTC).
-//
-// Implementation pending: requires database connection and compliance service setup.
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+)
+
+// RetentionRunner enforces the retention schedules that are due
+type RetentionRunner interface {
+	RunRetentionSchedules(ctx context.Context) (*retention.RunResult, error)
+}
+
+// ComplianceRetentionWorker periodically enforces due retention schedules:
+// it archives, anonymises or deletes expired data outside legal holds and
+// records every run on the schedule and in the audit trail
+type ComplianceRetentionWorker struct {
+	runner   RetentionRunner
+	interval time.Duration
+}
+
+// NewComplianceRetentionWorker creates a worker that enforces schedules every
+// interval
+func NewComplianceRetentionWorker(runner RetentionRunner, interval time.Duration) *ComplianceRetentionWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &ComplianceRetentionWorker{runner: runner, interval: interval}
+}
+
+// Run enforces immediately and then on every tick until ctx is cancelled
+func (w *ComplianceRetentionWorker) Run(ctx context.Context) {
+	log.Printf("compliance retention worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("compliance retention worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ComplianceRetentionWorker) run(ctx context.Context) {
+	result, err := w.runner.RunRetentionSchedules(ctx)
+	if err != nil {
+		log.Printf("compliance retention worker: run failed: %v", err)
+	}
+	if result == nil || result.Executed+result.Skipped+result.Failed == 0 {
+		return
+	}
+	log.Printf("compliance retention worker: %d schedules executed, %d skipped, %d failed",
+		result.Executed, result.Skipped, result.Failed)
+}
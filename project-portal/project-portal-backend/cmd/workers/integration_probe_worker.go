@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// IntegrationProber checks configured integrations against their providers
+type IntegrationProber interface {
+	ProbeIntegrations(ctx context.Context) (*settings.IntegrationProbeRunResult, error)
+}
+
+// IntegrationProbeWorker periodically probes every active integration so the
+// health history stays current between user requests
+type IntegrationProbeWorker struct {
+	prober   IntegrationProber
+	interval time.Duration
+}
+
+// NewIntegrationProbeWorker creates a worker that probes integrations every interval
+func NewIntegrationProbeWorker(prober IntegrationProber, interval time.Duration) *IntegrationProbeWorker {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &IntegrationProbeWorker{prober: prober, interval: interval}
+}
+
+// Run probes immediately and then on every tick until ctx is cancelled
+func (w *IntegrationProbeWorker) Run(ctx context.Context) {
+	log.Printf("integration probe worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("integration probe worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *IntegrationProbeWorker) run(ctx context.Context) {
+	result, err := w.prober.ProbeIntegrations(ctx)
+	if err != nil {
+		log.Printf("integration probe worker: run failed: %v", err)
+		return
+	}
+	log.Printf("integration probe worker: %d probed, %d healthy, %d degraded, %d down, %d history rows pruned",
+		result.Probed, result.Healthy, result.Degraded, result.Down, result.Pruned)
+}
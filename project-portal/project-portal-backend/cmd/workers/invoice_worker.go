@@ -1,8 +1,61 @@
-//go:build future
-// +build future
-
 package workers
 
-// InvoiceWorker generates and stores invoice PDFs for settings billing.
-// Implementation pending billing service integration.
-type InvoiceWorker struct{}
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// InvoiceIssuer finalises draft invoices and stores their PDFs
+type InvoiceIssuer interface {
+	IssueInvoices(ctx context.Context) (*settings.InvoiceRunResult, error)
+}
+
+// InvoiceWorker periodically numbers, taxes and renders the invoices left by
+// closed billing periods
+type InvoiceWorker struct {
+	issuer   InvoiceIssuer
+	interval time.Duration
+}
+
+// NewInvoiceWorker creates a worker that issues invoices every interval
+func NewInvoiceWorker(issuer InvoiceIssuer, interval time.Duration) *InvoiceWorker {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	return &InvoiceWorker{issuer: issuer, interval: interval}
+}
+
+// Run issues immediately and then on every tick until ctx is cancelled
+func (w *InvoiceWorker) Run(ctx context.Context) {
+	log.Printf("invoice worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("invoice worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *InvoiceWorker) run(ctx context.Context) {
+	result, err := w.issuer.IssueInvoices(ctx)
+	if err != nil {
+		log.Printf("invoice worker: run failed: %v", err)
+		return
+	}
+	if result.Finalized+result.Rendered+result.Failed == 0 {
+		return
+	}
+	log.Printf("invoice worker: %d invoices finalised, %d PDFs stored, %d skipped, %d failed",
+		result.Finalized, result.Rendered, result.Skipped, result.Failed)
+}
@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// KeyRotationRunner rotates master keys when due and re-encrypts vaulted data
+type KeyRotationRunner interface {
+	RunKeyRotation(ctx context.Context) (*settings.KeyRotationResult, error)
+}
+
+// KeyRotationWorker periodically rotates the settings master key and moves
+// ciphertexts to the newest key
+type KeyRotationWorker struct {
+	runner   KeyRotationRunner
+	interval time.Duration
+}
+
+// NewKeyRotationWorker creates a worker that runs key rotation every interval
+func NewKeyRotationWorker(runner KeyRotationRunner, interval time.Duration) *KeyRotationWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &KeyRotationWorker{runner: runner, interval: interval}
+}
+
+// Run rotates and re-encrypts immediately and then on every tick until ctx is cancelled
+func (w *KeyRotationWorker) Run(ctx context.Context) {
+	log.Printf("key rotation worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("key rotation worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *KeyRotationWorker) run(ctx context.Context) {
+	result, err := w.runner.RunKeyRotation(ctx)
+	if err != nil {
+		log.Printf("key rotation worker: run failed: %v", err)
+		return
+	}
+	log.Printf("key rotation worker: primary %s (rotated %t), %d scanned, %d re-encrypted, %d conflicts, %d failed",
+		result.PrimaryKey, result.Rotated, result.Scanned, result.Reencrypted, result.Conflicts, result.Failed)
+}
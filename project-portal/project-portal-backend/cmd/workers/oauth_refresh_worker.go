@@ -0,0 +1,60 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// OAuthTokenRefresher renews integration access tokens that are about to expire
+type OAuthTokenRefresher interface {
+	RefreshExpiringOAuthTokens(ctx context.Context) (*settings.OAuthRefreshResult, error)
+}
+
+// OAuthRefreshWorker periodically renews expiring integration OAuth tokens
+type OAuthRefreshWorker struct {
+	refresher OAuthTokenRefresher
+	interval  time.Duration
+}
+
+// NewOAuthRefreshWorker creates a worker that looks for expiring tokens every interval
+func NewOAuthRefreshWorker(refresher OAuthTokenRefresher, interval time.Duration) *OAuthRefreshWorker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &OAuthRefreshWorker{refresher: refresher, interval: interval}
+}
+
+// Run refreshes tokens immediately and then on every tick until ctx is cancelled
+func (w *OAuthRefreshWorker) Run(ctx context.Context) {
+	log.Printf("oauth refresh worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("oauth refresh worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *OAuthRefreshWorker) refresh(ctx context.Context) {
+	result, err := w.refresher.RefreshExpiringOAuthTokens(ctx)
+	if err != nil {
+		log.Printf("oauth refresh worker: refresh failed: %v", err)
+		return
+	}
+	if result.Checked == 0 {
+		return
+	}
+	log.Printf("oauth refresh worker: %d checked, %d refreshed, %d retrying, %d need re-consent, %d skipped",
+		result.Checked, result.Refreshed, result.Retrying, result.ReconsentRequired, result.Skipped)
+}
@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ShareSnapshotPurger drops stored execution rows no share link needs
+type ShareSnapshotPurger interface {
+	PurgeShareSnapshots(ctx context.Context) (int64, error)
+}
+
+// ReportSnapshotWorker periodically drops the result rows of shareable report
+// executions that have no live execution-scoped share link
+type ReportSnapshotWorker struct {
+	purger   ShareSnapshotPurger
+	interval time.Duration
+}
+
+// NewReportSnapshotWorker creates a worker that purges unshared snapshots every interval
+func NewReportSnapshotWorker(purger ShareSnapshotPurger, interval time.Duration) *ReportSnapshotWorker {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &ReportSnapshotWorker{purger: purger, interval: interval}
+}
+
+// Run purges immediately and then on every tick until ctx is cancelled
+func (w *ReportSnapshotWorker) Run(ctx context.Context) {
+	log.Printf("report snapshot worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("report snapshot worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ReportSnapshotWorker) run(ctx context.Context) {
+	purged, err := w.purger.PurgeShareSnapshots(ctx)
+	if err != nil {
+		log.Printf("report snapshot worker: purge failed: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("report snapshot worker: %d unshared snapshots dropped", purged)
+	}
+}
@@ -0,0 +1,61 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+)
+
+// UsageCollector measures billing usage for every subscription
+type UsageCollector interface {
+	CollectUsage(ctx context.Context) (*settings.UsageCollectionResult, error)
+}
+
+// UsageMeterWorker periodically refreshes subscription usage metrics and
+// raises quota warnings
+type UsageMeterWorker struct {
+	collector UsageCollector
+	interval  time.Duration
+}
+
+// NewUsageMeterWorker creates a worker that collects usage every interval
+func NewUsageMeterWorker(collector UsageCollector, interval time.Duration) *UsageMeterWorker {
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	return &UsageMeterWorker{collector: collector, interval: interval}
+}
+
+// Run collects immediately and then on every tick until ctx is cancelled
+func (w *UsageMeterWorker) Run(ctx context.Context) {
+	log.Printf("usage meter worker started (interval %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("usage meter worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *UsageMeterWorker) run(ctx context.Context) {
+	result, err := w.collector.CollectUsage(ctx)
+	if err != nil {
+		log.Printf("usage meter worker: collection failed: %v", err)
+		return
+	}
+	if result.Failed+result.Warnings == 0 {
+		return
+	}
+	log.Printf("usage meter worker: %d subscriptions metered, %d meter errors, %d quota warnings",
+		result.Subscriptions, result.Failed, result.Warnings)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -34,6 +36,10 @@ func (h *Handler) InviteUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "project_invitation", TargetID: invite.ID,
+		DataCategory: compliance.DataCategoryProjectData, After: invite,
+	})
 
 	c.JSON(http.StatusCreated, invite)
 }
@@ -64,6 +70,10 @@ func (h *Handler) CreateComment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "comment", TargetID: comment.ID, TargetOwnerID: comment.UserID,
+		DataCategory: compliance.DataCategoryProjectData, After: comment,
+	})
 
 	c.JSON(http.StatusCreated, comment)
 }
@@ -79,6 +89,10 @@ func (h *Handler) CreateTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "task", TargetID: task.ID, TargetOwnerID: task.CreatedBy,
+		DataCategory: compliance.DataCategoryProjectData, After: task,
+	})
 
 	c.JSON(http.StatusCreated, task)
 }
@@ -94,6 +108,10 @@ func (h *Handler) CreateResource(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "shared_resource", TargetID: resource.ID, TargetOwnerID: resource.UploadedBy,
+		DataCategory: compliance.DataCategoryProjectData, After: resource,
+	})
 
 	c.JSON(http.StatusCreated, resource)
 }
@@ -111,10 +129,23 @@ func (h *Handler) ListMembers(c *gin.Context) {
 func (h *Handler) RemoveMember(c *gin.Context) {
 	projectID := c.Param("id")
 	userID := c.Param("userId")
+	members, err := h.service.ListMembers(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.service.RemoveMember(c.Request.Context(), projectID, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range members {
+		if members[i].UserID == userID {
+			compliance.RecordChange(c, compliance.AuditChange{
+				TargetType: "project_member", TargetID: members[i].ID, TargetOwnerID: userID,
+				DataCategory: compliance.DataCategoryProjectData, Before: members[i],
+			})
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -155,6 +186,7 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		return
 	}
+	before := *existing
 	var patch Task
 	if err := c.ShouldBindJSON(&patch); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -183,6 +215,10 @@ func (h *Handler) UpdateTask(c *gin.Context) {
 		return
 	}
 	updated, _ := h.service.GetTask(c.Request.Context(), taskID)
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "task", TargetID: taskID, TargetOwnerID: before.CreatedBy,
+		DataCategory: compliance.DataCategoryProjectData, Before: before, After: existing,
+	})
 	c.JSON(http.StatusOK, updated)
 }
 
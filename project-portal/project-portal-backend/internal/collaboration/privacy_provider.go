@@ -0,0 +1,41 @@
+package collaboration
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the collaboration module keeps a user's
+// data for privacy requests. Rows the rest of a project depends on, such as
+// comment threads, tasks and activity, are anonymised instead of deleted.
+func NewPrivacyProvider(db *gorm.DB) requests.Provider {
+	erased := requests.ErasedUserID
+	return requests.NewTableProvider("collaboration", db, nil,
+		requests.Table{Name: "project_members", Category: requests.CategoryProjectData, Where: "user_id = @user"},
+		requests.Table{Name: "comments", Category: requests.CategoryProjectData, Where: "user_id = @user",
+			Anonymize: map[string]interface{}{"user_id": erased, "content": "[removed]", "attachments": gorm.Expr("'{}'"), "location": nil}},
+		requests.Table{Name: "tasks", Label: "tasks_created", Category: requests.CategoryProjectData, Where: "created_by = @user",
+			Anonymize: map[string]interface{}{"created_by": erased}},
+		requests.Table{Name: "tasks", Label: "tasks_assigned", Category: requests.CategoryProjectData, Where: "assigned_to = @user",
+			Anonymize: map[string]interface{}{"assigned_to": nil}},
+		requests.Table{Name: "shared_resources", Category: requests.CategoryProjectData, Where: "uploaded_by = @user",
+			Anonymize: map[string]interface{}{"uploaded_by": erased}},
+		requests.Table{Name: "resource_bookings", Category: requests.CategoryProjectData, Where: "booked_by = @user",
+			Anonymize: map[string]interface{}{"booked_by": erased}},
+		requests.Table{Name: "activity_logs", Category: requests.CategorySystemLogs, Where: "user_id = @user",
+			Anonymize: map[string]interface{}{"user_id": erased}},
+	)
+}
+
+// RetentionTargets lists the collaboration data that ages out under retention
+// policies. Activity stays part of the project history, so it is anonymised
+// the same way as on erasure.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategorySystemLogs, Table: "activity_logs", TimestampColumn: "created_at", UserColumn: "user_id",
+			Anonymize:  map[string]interface{}{"user_id": requests.ErasedUserID},
+			Anonymized: "user_id IS NULL OR user_id = '" + requests.ErasedUserID + "'"},
+	}
+}
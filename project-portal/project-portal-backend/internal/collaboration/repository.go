@@ -36,6 +36,11 @@ type Repository interface {
 	// Resource
 	CreateResource(ctx context.Context, resource *SharedResource) error
 	ListResources(ctx context.Context, projectID string) ([]SharedResource, error)
+
+	// Per-user data, for account exports
+	ListMembershipsByUser(ctx context.Context, userID string) ([]ProjectMember, error)
+	ListCommentsByUser(ctx context.Context, userID string) ([]Comment, error)
+	ListTasksByUser(ctx context.Context, userID string) ([]Task, error)
 }
 
 type repository struct {
@@ -165,3 +170,30 @@ func (r *repository) ListResources(ctx context.Context, projectID string) ([]Sha
 	}
 	return resources, nil
 }
+
+// Per-user data
+
+func (r *repository) ListMembershipsByUser(ctx context.Context, userID string) ([]ProjectMember, error) {
+	var members []ProjectMember
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("joined_at asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *repository) ListCommentsByUser(ctx context.Context, userID string) ([]Comment, error) {
+	var comments []Comment
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at asc").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// ListTasksByUser returns tasks the user created or is assigned to
+func (r *repository) ListTasksByUser(ctx context.Context, userID string) ([]Task, error) {
+	var tasks []Task
+	if err := r.db.WithContext(ctx).Where("created_by = ? OR assigned_to = ?", userID, userID).Order("created_at asc").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func buildChain(l *Logger, n int) []AuditLogEntry {
+	entries := make([]AuditLogEntry, 0, n)
+	prev := ""
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		entry := l.BuildEntry(AuditLogEntry{
+			EventTime:   start.Add(time.Duration(i) * time.Second),
+			EventType:   "data_access",
+			EventAction: "read",
+			ServiceName: "compliance",
+			ActorID:     "user-1",
+			NewValues:   map[string]interface{}{"n": i},
+		}, prev)
+		entries = append(entries, entry)
+		prev = entry.HashChain
+	}
+	return entries
+}
+
+func TestVerifyChainFindsBrokenLink(t *testing.T) {
+	il := NewImmutableLogWithKey([]byte("test-key"))
+	entries := buildChain(NewLoggerWithLog(il), 5)
+
+	if ok, _ := il.VerifyChain(entries); !ok {
+		t.Fatalf("expected an untouched chain to verify")
+	}
+	for _, entry := range entries {
+		if !il.VerifySignature(entry) {
+			t.Fatalf("expected every signature to verify")
+		}
+	}
+
+	entries[3].EventAction = "delete"
+	if ok, at := il.VerifyChain(entries); ok || at != 3 {
+		t.Fatalf("expected the edited entry to break the chain at 3, got %v %d", ok, at)
+	}
+	if il.VerifySignature(entries[3]) {
+		t.Fatalf("expected the edited entry's signature to fail")
+	}
+	if NewImmutableLog().VerifySignature(entries[0]) {
+		t.Fatalf("expected signatures to depend on the key")
+	}
+	if !il.HasSigningKey() || NewImmutableLogWithKey(nil).HasSigningKey() {
+		t.Fatalf("expected only a configured key to count as a signing key")
+	}
+}
+
+func TestMerkleCheckpoint(t *testing.T) {
+	il := NewImmutableLogWithKey([]byte("test-key"))
+	entries := buildChain(NewLoggerWithLog(il), 7)
+
+	leaves := make([][]byte, len(entries))
+	for i, entry := range entries {
+		leaves[i] = LeafHash(int64(i+1), entry)
+	}
+	root := MerkleRoot(leaves)
+	if root == "" || MerkleRoot(leaves) != root {
+		t.Fatalf("expected a stable root, got %q", root)
+	}
+	if MerkleRoot(nil) != "" {
+		t.Fatalf("expected no root without leaves")
+	}
+
+	// Fields outside the hash chain, such as values, are still covered
+	changed := entries[2]
+	changed.NewValues = map[string]interface{}{"n": 99}
+	if bytes.Equal(LeafHash(3, changed), leaves[2]) {
+		t.Fatalf("expected a value change to change the leaf")
+	}
+	if bytes.Equal(LeafHash(4, entries[2]), leaves[2]) {
+		t.Fatalf("expected the leaf to depend on the entry's position")
+	}
+	swapped := append([][]byte{leaves[1], leaves[0]}, leaves[2:]...)
+	if MerkleRoot(swapped) == root || MerkleRoot(leaves[:6]) == root {
+		t.Fatalf("expected reordering or dropping entries to change the root")
+	}
+
+	last := entries[len(entries)-1].HashChain
+	sig := il.SignCheckpoint(1, 7, 7, root, last)
+	if !il.VerifyCheckpoint(1, 7, 7, root, last, sig) {
+		t.Fatalf("expected the checkpoint signature to verify")
+	}
+	if il.VerifyCheckpoint(1, 7, 6, root, last, sig) || il.VerifyCheckpoint(1, 7, 7, MerkleRoot(swapped), last, sig) {
+		t.Fatalf("expected a changed checkpoint to fail verification")
+	}
+}
@@ -11,6 +11,7 @@ import (
 // using hash chains and signatures (WORM pattern).
 type ImmutableLog struct {
 	signingKey []byte
+	keyed      bool
 }
 
 // NewImmutableLog creates an immutable log handler.
@@ -20,6 +21,22 @@ func NewImmutableLog() *ImmutableLog {
 	}
 }
 
+// NewImmutableLogWithKey creates an immutable log handler signing with key.
+// An empty key falls back to the default key, which anyone can read from the
+// source, so HasSigningKey reports false and checkpoints must not be signed.
+func NewImmutableLogWithKey(key []byte) *ImmutableLog {
+	if len(key) == 0 {
+		return NewImmutableLog()
+	}
+	return &ImmutableLog{signingKey: key, keyed: true}
+}
+
+// HasSigningKey reports whether the log signs with a configured key rather
+// than the default one.
+func (il *ImmutableLog) HasSigningKey() bool {
+	return il.keyed
+}
+
 // ComputeHash generates the hash chain entry by hashing the current log
 // combined with the previous hash, creating tamper-evident linkage.
 func (il *ImmutableLog) ComputeHash(entry AuditLogEntry, previousHash string) string {
@@ -45,6 +45,11 @@ func NewLogger() *Logger {
 	}
 }
 
+// NewLoggerWithLog creates an audit logger that chains and signs with il.
+func NewLoggerWithLog(il *ImmutableLog) *Logger {
+	return &Logger{immutable: il}
+}
+
 // BuildEntry prepares an audit log entry with hash chain linkage and signature.
 func (l *Logger) BuildEntry(entry AuditLogEntry, previousHash string) AuditLogEntry {
 	if entry.EventTime.IsZero() {
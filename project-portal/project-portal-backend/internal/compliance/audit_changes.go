@@ -0,0 +1,72 @@
+package compliance
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditChangesKey = "compliance_audit_changes"
+
+// ValueRedactor masks or hashes sensitive fields in audit snapshots before
+// they are stored
+type ValueRedactor interface {
+	Redact(values map[string]any) map[string]any
+}
+
+// AuditChange is a record a request changed, captured by its handler for the
+// audit middleware
+type AuditChange struct {
+	TargetType    string
+	TargetID      string
+	TargetOwnerID string
+	DataCategory  string
+	// Action overrides the action derived from the snapshots, such as
+	// "rotate" for a change that is neither a creation nor a plain update
+	Action string
+	// Before and After are the record's state either side of the change;
+	// Before is nil for creations and After for deletions
+	Before any
+	After  any
+}
+
+// RecordChange attaches a change to the request so the audit middleware logs
+// it with its before and after snapshots
+func RecordChange(c *gin.Context, change AuditChange) {
+	c.Set(auditChangesKey, append(RecordedChanges(c), change))
+}
+
+// RecordedChanges returns the changes handlers recorded on the request
+func RecordedChanges(c *gin.Context) []AuditChange {
+	v, ok := c.Get(auditChangesKey)
+	if !ok {
+		return nil
+	}
+	changes, _ := v.([]AuditChange)
+	return changes
+}
+
+// SnapshotValues converts a snapshot to the field map stored on audit logs,
+// using the record's JSON form; values that are not objects are kept under
+// "value"
+func SnapshotValues(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	if values, ok := v.(map[string]any); ok {
+		return values
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		var value any
+		if json.Unmarshal(data, &value) != nil {
+			return nil
+		}
+		return map[string]any{"value": value}
+	}
+	return values
+}
@@ -0,0 +1,339 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	auditpkg "carbon-scribe/project-portal/project-portal-backend/internal/compliance/audit"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxCheckpointEntries caps the entries a single checkpoint covers
+	maxCheckpointEntries = 10000
+	auditVerifyPageSize  = 1000
+	// maxReportedBreaks caps the breaks listed in one verification
+	maxReportedBreaks = 100
+)
+
+// ErrAuditSigningKeyMissing is returned when checkpoints are requested but no
+// audit signing key is configured
+var ErrAuditSigningKeyMissing = errors.New("audit signing key is not configured, set COMPLIANCE_AUDIT_SIGNING_KEY")
+
+// IntegrityAlerter raises a critical alert when audit logs fail verification
+type IntegrityAlerter interface {
+	AlertIntegrityFailure(ctx context.Context, v *AuditVerification) error
+}
+
+// IntegrityAlertFunc adapts a function to IntegrityAlerter
+type IntegrityAlertFunc func(ctx context.Context, v *AuditVerification) error
+
+// AlertIntegrityFailure calls f(ctx, v)
+func (f IntegrityAlertFunc) AlertIntegrityFailure(ctx context.Context, v *AuditVerification) error {
+	return f(ctx, v)
+}
+
+// CheckpointAuditLog signs Merkle checkpoints over the audit logs appended
+// since the last checkpoint, returning how many were created. It refuses to
+// sign with the default key, which would let anyone forge checkpoints.
+func (s *Service) CheckpointAuditLog(ctx context.Context) (int, error) {
+	if !s.immutable.HasSigningKey() {
+		return 0, ErrAuditSigningKeyMissing
+	}
+	created := 0
+	for {
+		var after int64
+		last, err := s.repo.GetLastAuditCheckpoint(ctx)
+		switch {
+		case err == nil:
+			after = last.LastLogID
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return created, fmt.Errorf("fetching last checkpoint: %w", err)
+		}
+
+		// Appends commit in log ID order under the chain lock, so no earlier
+		// ID can appear once a later one is visible
+		logs, err := s.repo.ListAuditLogsByID(ctx, after, 1<<62, maxCheckpointEntries)
+		if err != nil {
+			return created, fmt.Errorf("listing audit logs: %w", err)
+		}
+		if len(logs) == 0 {
+			return created, nil
+		}
+
+		leaves := make([][]byte, len(logs))
+		for i := range logs {
+			leaves[i] = auditpkg.LeafHash(logs[i].LogID, auditEntryFromLog(&logs[i]))
+		}
+		first, end := logs[0], logs[len(logs)-1]
+		cp := &AuditCheckpoint{
+			FirstLogID:     first.LogID,
+			LastLogID:      end.LogID,
+			EntryCount:     int64(len(logs)),
+			FirstEventTime: first.EventTime,
+			LastEventTime:  end.EventTime,
+			MerkleRoot:     auditpkg.MerkleRoot(leaves),
+			LastHash:       end.HashChain,
+		}
+		cp.Signature = s.immutable.SignCheckpoint(cp.FirstLogID, cp.LastLogID, cp.EntryCount, cp.MerkleRoot, cp.LastHash)
+		if err := s.repo.CreateAuditCheckpoint(ctx, cp); err != nil {
+			return created, fmt.Errorf("creating checkpoint: %w", err)
+		}
+		created++
+		if len(logs) < maxCheckpointEntries {
+			return created, nil
+		}
+	}
+}
+
+// ListAuditCheckpoints returns the most recent checkpoints
+func (s *Service) ListAuditCheckpoints(ctx context.Context, limit int) ([]AuditCheckpoint, error) {
+	return s.repo.ListAuditCheckpoints(ctx, 0, 0, limit)
+}
+
+// VerifyAuditChain checks the audit logs of a period: that each entry links
+// to the one before it, that each signature is valid, and that every
+// checkpoint overlapping the period is signed and still matches its entries.
+// Any failure raises a critical alert; the verification itself is audited.
+func (s *Service) VerifyAuditChain(ctx context.Context, from, to time.Time) (*AuditVerification, error) {
+	v := &AuditVerification{From: from, To: to, Valid: true}
+	firstID, lastID, err := s.repo.GetAuditLogIDRange(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("finding audit logs: %w", err)
+	}
+
+	if firstID > 0 {
+		v.FirstLogID, v.LastLogID = firstID, lastID
+		if err := s.verifyEntries(ctx, v); err != nil {
+			return nil, err
+		}
+		if err := s.verifyCheckpoints(ctx, v); err != nil {
+			return nil, err
+		}
+	}
+	v.VerifiedAt = time.Now()
+
+	action := "verified"
+	if !v.Valid {
+		action = "broken"
+		log.Printf("CRITICAL: audit log integrity check failed for %s to %s: %d breaks, first at log %d (%s: %s)",
+			from.Format(time.RFC3339), to.Format(time.RFC3339), len(v.Breaks), v.Breaks[0].LogID, v.Breaks[0].Kind, v.Breaks[0].Detail)
+		if s.cfg.IntegrityAlerter != nil {
+			if err := s.cfg.IntegrityAlerter.AlertIntegrityFailure(ctx, v); err != nil {
+				log.Printf("compliance: raising audit integrity alert: %v", err)
+			}
+		}
+	}
+	if err := s.LogAuditEvent(ctx, AuditEntry{
+		EventType:        "audit_integrity",
+		EventAction:      action,
+		ActorType:        ActorTypeSystem,
+		TargetType:       "audit_log",
+		DataCategory:     "audit_logs",
+		SensitivityLevel: "high",
+		ServiceName:      "compliance",
+		NewValues: map[string]any{
+			"from":                from,
+			"to":                  to,
+			"first_log_id":        v.FirstLogID,
+			"last_log_id":         v.LastLogID,
+			"entries_checked":     v.EntriesChecked,
+			"checkpoints_checked": v.CheckpointsChecked,
+			"breaks":              len(v.Breaks),
+		},
+	}); err != nil {
+		log.Printf("compliance: audit of audit verification: %v", err)
+	}
+	return v, nil
+}
+
+// verifyEntries walks the period's entries in chain order, page by page
+func (s *Service) verifyEntries(ctx context.Context, v *AuditVerification) error {
+	prev, anchored, err := s.chainPredecessor(ctx, v.FirstLogID)
+	if err != nil {
+		return err
+	}
+
+	cursor := v.FirstLogID - 1
+	for {
+		logs, err := s.repo.ListAuditLogsByID(ctx, cursor, v.LastLogID, auditVerifyPageSize)
+		if err != nil {
+			return fmt.Errorf("listing audit logs: %w", err)
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+
+		entries := make([]auditpkg.AuditLogEntry, 0, len(logs)+1)
+		entries = append(entries, prev)
+		for i := range logs {
+			entry := auditEntryFromLog(&logs[i])
+			entries = append(entries, entry)
+			if !s.immutable.VerifySignature(entry) {
+				v.addBreak(AuditChainBreak{LogID: logs[i].LogID, Kind: "signature", Detail: "signature does not match the entry"})
+			}
+		}
+		// A broken link is reported and the walk carries on from the entry
+		// after it, so every break in the period is found
+		start := 0
+		if !anchored {
+			start, anchored = 1, true
+		}
+		for start < len(entries)-1 {
+			ok, at := s.immutable.VerifyChain(entries[start:])
+			if ok {
+				break
+			}
+			idx := start + at
+			v.addBreak(AuditChainBreak{LogID: logs[idx-1].LogID, Kind: "chain", Detail: "entry does not link to the entry before it"})
+			start = idx
+		}
+
+		v.EntriesChecked += int64(len(logs))
+		prev = entries[len(entries)-1]
+		cursor = logs[len(logs)-1].LogID
+		if len(logs) < auditVerifyPageSize {
+			return nil
+		}
+	}
+}
+
+// chainPredecessor returns what the entry with logID should link to: the
+// entry before it, the checkpoint before it when earlier entries were
+// archived, or an empty hash at the start of the log. When
+// archival cut into a checkpoint's range the link cannot be checked and the
+// entry is not anchored.
+func (s *Service) chainPredecessor(ctx context.Context, logID int64) (auditpkg.AuditLogEntry, bool, error) {
+	prev, err := s.repo.GetAuditLogBefore(ctx, logID)
+	if err == nil {
+		return auditEntryFromLog(prev), true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return auditpkg.AuditLogEntry{}, false, fmt.Errorf("fetching previous audit log: %w", err)
+	}
+	cp, err := s.repo.GetAuditCheckpointBefore(ctx, logID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return auditpkg.AuditLogEntry{}, true, nil
+	}
+	if err != nil {
+		return auditpkg.AuditLogEntry{}, false, fmt.Errorf("fetching previous checkpoint: %w", err)
+	}
+	covering, err := s.repo.ListAuditCheckpoints(ctx, logID, logID, 1)
+	if err != nil {
+		return auditpkg.AuditLogEntry{}, false, fmt.Errorf("listing checkpoints: %w", err)
+	}
+	if len(covering) > 0 && covering[0].FirstLogID < logID {
+		return auditpkg.AuditLogEntry{}, false, nil
+	}
+	return auditpkg.AuditLogEntry{HashChain: cp.LastHash}, true, nil
+}
+
+// verifyCheckpoints recomputes the Merkle root of every checkpoint the
+// period overlaps. Checkpoints whose entries were all archived can only have
+// their signature checked.
+func (s *Service) verifyCheckpoints(ctx context.Context, v *AuditVerification) error {
+	checkpoints, err := s.repo.ListAuditCheckpoints(ctx, v.FirstLogID, v.LastLogID, 0)
+	if err != nil {
+		return fmt.Errorf("listing checkpoints: %w", err)
+	}
+	for _, cp := range checkpoints {
+		v.CheckpointsChecked++
+		if !s.immutable.VerifyCheckpoint(cp.FirstLogID, cp.LastLogID, cp.EntryCount, cp.MerkleRoot, cp.LastHash, cp.Signature) {
+			v.addBreak(AuditChainBreak{LogID: cp.FirstLogID, CheckpointID: cp.ID, Kind: "checkpoint", Detail: "checkpoint signature is invalid"})
+			continue
+		}
+
+		var leaves [][]byte
+		var first, last *AuditLog
+		cursor := cp.FirstLogID - 1
+		for {
+			logs, err := s.repo.ListAuditLogsByID(ctx, cursor, cp.LastLogID, auditVerifyPageSize)
+			if err != nil {
+				return fmt.Errorf("listing checkpointed audit logs: %w", err)
+			}
+			for i := range logs {
+				leaves = append(leaves, auditpkg.LeafHash(logs[i].LogID, auditEntryFromLog(&logs[i])))
+			}
+			if len(logs) > 0 {
+				if first == nil {
+					first = &logs[0]
+				}
+				last = &logs[len(logs)-1]
+				cursor = last.LogID
+			}
+			if len(logs) < auditVerifyPageSize {
+				break
+			}
+		}
+
+		archived := false
+		if first != nil && first.LogID > cp.FirstLogID {
+			// Retention archives the oldest entries first, so a checkpoint may
+			// have lost its head; then only what follows can be checked
+			_, err := s.repo.GetAuditLogBefore(ctx, first.LogID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("fetching previous audit log: %w", err)
+			}
+			archived = err != nil
+		}
+
+		switch {
+		case len(leaves) == 0:
+			// Archived by retention; the signature still vouches for the range
+		case archived:
+			if last.HashChain != cp.LastHash {
+				v.addBreak(AuditChainBreak{LogID: last.LogID, CheckpointID: cp.ID, Kind: "checkpoint", Detail: "last entry does not match the checkpoint"})
+			}
+		case int64(len(leaves)) != cp.EntryCount:
+			v.addBreak(AuditChainBreak{LogID: cp.FirstLogID, CheckpointID: cp.ID, Kind: "checkpoint",
+				Detail: fmt.Sprintf("checkpoint covers %d entries but %d remain", cp.EntryCount, len(leaves))})
+		case auditpkg.MerkleRoot(leaves) != cp.MerkleRoot:
+			v.addBreak(AuditChainBreak{LogID: cp.FirstLogID, CheckpointID: cp.ID, Kind: "checkpoint", Detail: "entries no longer match the checkpoint's Merkle root"})
+		case last.HashChain != cp.LastHash:
+			v.addBreak(AuditChainBreak{LogID: last.LogID, CheckpointID: cp.ID, Kind: "checkpoint", Detail: "last entry does not match the checkpoint"})
+		}
+	}
+	return nil
+}
+
+func (v *AuditVerification) addBreak(b AuditChainBreak) {
+	v.Valid = false
+	if len(v.Breaks) < maxReportedBreaks {
+		v.Breaks = append(v.Breaks, b)
+	}
+}
+
+func auditEntryFromLog(l *AuditLog) auditpkg.AuditLogEntry {
+	entry := auditpkg.AuditLogEntry{
+		EventTime:        l.EventTime,
+		EventType:        l.EventType,
+		EventAction:      l.EventAction,
+		ActorType:        l.ActorType,
+		ActorIP:          l.ActorIP,
+		TargetType:       l.TargetType,
+		DataCategory:     l.DataCategory,
+		SensitivityLevel: l.SensitivityLevel,
+		ServiceName:      l.ServiceName,
+		Endpoint:         l.Endpoint,
+		HTTPMethod:       l.HTTPMethod,
+		OldValues:        l.OldValues,
+		NewValues:        l.NewValues,
+		PermissionUsed:   l.PermissionUsed,
+		HashChain:        l.HashChain,
+		Signature:        l.Signature,
+	}
+	if l.ActorID != nil {
+		entry.ActorID = *l.ActorID
+	}
+	if l.TargetID != nil {
+		entry.TargetID = *l.TargetID
+	}
+	if l.TargetOwnerID != nil {
+		entry.TargetOwnerID = *l.TargetOwnerID
+	}
+	return entry
+}
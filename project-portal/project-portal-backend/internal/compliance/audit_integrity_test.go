@@ -0,0 +1,16 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckpointAuditLogNeedsSigningKey(t *testing.T) {
+	// The embedded nil Repository panics if the service reaches the database
+	repo := &requestRepo{}
+
+	if created, err := NewService(repo).CheckpointAuditLog(context.Background()); !errors.Is(err, ErrAuditSigningKeyMissing) || created != 0 {
+		t.Fatalf("expected no checkpoints without a signing key, got %d %v", created, err)
+	}
+}
@@ -1,10 +1,16 @@
 package compliance
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Handler exposes compliance endpoints via Gin.
@@ -27,9 +33,18 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 			requests.POST("/export", h.CreateExportRequest)
 			requests.POST("/delete", h.CreateDeleteRequest)
 			requests.GET("/:id", h.GetRequestStatus)
+			requests.GET("/:id/certificate", h.GetDeletionCertificate)
+			requests.POST("/:id/verify", h.VerifyRequest)
+			requests.POST("/:id/verification-code", h.ResendVerificationCode)
+			requests.POST("/:id/reject", requireOfficer(), h.RejectRequest)
+			requests.POST("/:id/cancel", h.CancelRequest)
+			requests.GET("/:id/download", h.GetExportDownload)
 			requests.GET("", h.ListRequests)
 		}
 
+		// Where the user's data is held, per module and category
+		compliance.GET("/data-map", h.GetDataMap)
+
 		// Privacy preferences
 		preferences := compliance.Group("/preferences")
 		{
@@ -49,6 +64,8 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 		audit := compliance.Group("/audit")
 		{
 			audit.GET("/logs", h.QueryAuditLogs)
+			audit.GET("/verify", h.VerifyAuditChain)
+			audit.GET("/checkpoints", h.ListAuditCheckpoints)
 		}
 
 		// Retention policies
@@ -58,6 +75,7 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 			retention.GET("/policies", h.ListRetentionPolicies)
 			retention.GET("/policies/:id", h.GetRetentionPolicy)
 			retention.PUT("/policies/:id", h.UpdateRetentionPolicy)
+			retention.POST("/policies/:id/dry-run", h.PreviewRetentionPolicy)
 			retention.GET("/schedule", h.ListRetentionSchedules)
 		}
 
@@ -128,6 +146,150 @@ func (h *Handler) GetRequestStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+func (h *Handler) GetDeletionCertificate(c *gin.Context) {
+	result, err := h.service.GetRequestStatus(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "request not found"})
+		return
+	}
+	if result.DeletionCertificate == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deletion certificate has been issued for this request"})
+		return
+	}
+	c.JSON(http.StatusOK, result.DeletionCertificate)
+}
+
+func (h *Handler) VerifyRequest(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	var req VerifyRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.VerifyRequest(c.Request.Context(), c.Param("id"), userID, req.Code)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ResendVerificationCode(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	if err := h.service.SendVerificationCode(c.Request.Context(), c.Param("id"), userID); err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification code sent"})
+}
+
+func (h *Handler) RejectRequest(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	var req RejectRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	officer := RequestActor{UserID: userID, Permissions: permissions(c)}
+	result, err := h.service.RejectRequest(c.Request.Context(), c.Param("id"), officer, req.Reason)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) CancelRequest(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	result, err := h.service.CancelRequest(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) GetExportDownload(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	download, err := h.service.GetExportDownload(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, download)
+}
+
+// requireOfficer rejects callers the gateway has not made compliance
+// officers
+func requireOfficer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !(RequestActor{Permissions: permissions(c)}).IsOfficer() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// permissions returns the permissions the gateway granted the caller
+func permissions(c *gin.Context) []string {
+	var perms []string
+	for _, p := range strings.Split(c.GetHeader("X-Permissions"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// requestErrorStatus maps privacy request errors to HTTP status codes
+func requestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrExportNotAvailable):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRequestNotOwned), errors.Is(err, ErrNotComplianceOfficer):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, ErrExportStorageUnavailable), errors.Is(err, ErrNotifierUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, requests.ErrCodeMismatch), errors.Is(err, requests.ErrCodeExpired),
+		errors.Is(err, requests.ErrNoCodeOutstanding):
+		return http.StatusBadRequest
+	case errors.Is(err, requests.ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *Handler) ListRequests(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	status := c.Query("status")
@@ -147,6 +309,26 @@ func (h *Handler) ListRequests(c *gin.Context) {
 	})
 }
 
+func (h *Handler) GetDataMap(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+		return
+	}
+
+	var categories []string
+	if raw := c.Query("categories"); raw != "" {
+		categories = strings.Split(raw, ",")
+	}
+
+	result, err := h.service.DiscoverUserData(c.Request.Context(), userID, categories)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // --- Privacy Preference Handlers ---
 
 func (h *Handler) GetPreferences(c *gin.Context) {
@@ -177,11 +359,20 @@ func (h *Handler) UpdatePreferences(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	pref, err := h.service.UpdatePreferences(c.Request.Context(), userID, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{
+		TargetType: "privacy_preference", TargetID: pref.ID, TargetOwnerID: userID,
+		DataCategory: "privacy", Before: before, After: pref,
+	})
 	c.JSON(http.StatusOK, pref)
 }
 
@@ -208,6 +399,10 @@ func (h *Handler) RecordConsent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{
+		TargetType: "consent", TargetID: record.ID, TargetOwnerID: userID,
+		DataCategory: "privacy", After: record,
+	})
 	c.JSON(http.StatusCreated, record)
 }
 
@@ -238,6 +433,11 @@ func (h *Handler) WithdrawConsent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{
+		TargetType: "consent", TargetID: consentType, TargetOwnerID: userID, DataCategory: "privacy",
+		Before: map[string]any{"consent_type": consentType, "withdrawn": false},
+		After:  map[string]any{"consent_type": consentType, "withdrawn": true},
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "consent withdrawn successfully"})
 }
 
@@ -267,6 +467,53 @@ func (h *Handler) QueryAuditLogs(c *gin.Context) {
 	})
 }
 
+// VerifyAuditChain checks the chain, signatures and checkpoints of the audit
+// logs between start_time and end_time, by default the last 24 hours
+func (h *Handler) VerifyAuditChain(c *gin.Context) {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if v := c.Query("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be RFC 3339"})
+			return
+		}
+		to = t
+	}
+	if v := c.Query("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_time must be RFC 3339"})
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_time must be before end_time"})
+		return
+	}
+
+	result, err := h.service.VerifyAuditChain(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) ListAuditCheckpoints(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+	checkpoints, err := h.service.ListAuditCheckpoints(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, checkpoints)
+}
+
 // --- Retention Policy Handlers ---
 
 func (h *Handler) CreateRetentionPolicy(c *gin.Context) {
@@ -281,6 +528,7 @@ func (h *Handler) CreateRetentionPolicy(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{TargetType: "retention_policy", TargetID: policy.ID, After: policy})
 	c.JSON(http.StatusCreated, policy)
 }
 
@@ -315,14 +563,39 @@ func (h *Handler) UpdateRetentionPolicy(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetRetentionPolicy(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+		return
+	}
 	policy, err := h.service.UpdateRetentionPolicy(c.Request.Context(), id, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{TargetType: "retention_policy", TargetID: id, Before: before, After: policy})
 	c.JSON(http.StatusOK, policy)
 }
 
+// PreviewRetentionPolicy reports what each action of a policy would archive,
+// anonymise or delete if it ran now, without changing any data
+func (h *Handler) PreviewRetentionPolicy(c *gin.Context) {
+	id := c.Param("id")
+	results, err := h.service.PreviewRetentionPolicy(c.Request.Context(), id, c.GetHeader("X-User-ID"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrRetentionUnavailable):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy_id": id, "results": results})
+}
+
 func (h *Handler) ListRetentionSchedules(c *gin.Context) {
 	policyID := c.Query("policy_id")
 	schedules, err := h.service.ListRetentionSchedules(c.Request.Context(), policyID)
@@ -353,6 +626,7 @@ func (h *Handler) CreateLegalHold(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{TargetType: "legal_hold", TargetID: hold.ID, After: hold})
 	c.JSON(http.StatusCreated, hold)
 }
 
@@ -373,11 +647,17 @@ func (h *Handler) ReleaseLegalHold(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetLegalHold(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "legal hold not found"})
+		return
+	}
 	hold, err := h.service.ReleaseLegalHold(c.Request.Context(), id, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	RecordChange(c, AuditChange{TargetType: "legal_hold", TargetID: id, Before: before, After: hold})
 	c.JSON(http.StatusOK, hold)
 }
 
@@ -0,0 +1,88 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// requestRepo keeps privacy requests in memory and drops audit entries
+type requestRepo struct {
+	Repository
+
+	requests map[string]*PrivacyRequest
+}
+
+func (r *requestRepo) GetPrivacyRequest(_ context.Context, id string) (*PrivacyRequest, error) {
+	req, ok := r.requests[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *req
+	return &cp, nil
+}
+
+func (r *requestRepo) UpdatePrivacyRequest(_ context.Context, req *PrivacyRequest) error {
+	cp := *req
+	r.requests[req.ID] = &cp
+	return nil
+}
+
+func (r *requestRepo) AppendAuditLog(_ context.Context, build func(prevHash string) *AuditLog) error {
+	build("")
+	return nil
+}
+
+func TestRejectRequestNeedsComplianceOfficer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &requestRepo{requests: map[string]*PrivacyRequest{
+		"req-1": {ID: "req-1", UserID: "user-1", RequestType: RequestTypeDeletion, Status: RequestStatusReceived},
+		"req-2": {ID: "req-2", UserID: "user-1", RequestType: RequestTypeExport, Status: RequestStatusIdentityVerified},
+	}}
+	router := gin.New()
+	NewHandler(NewService(repo)).RegisterRoutes(router.Group("/api/v1"))
+	call := func(path, userID, permissions string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/compliance/requests/"+path, strings.NewReader(`{"reason":"unfounded"}`))
+		req.Header.Set("X-User-ID", userID)
+		if permissions != "" {
+			req.Header.Set("X-Permissions", permissions)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Neither the requester nor another user can reject a request
+	for _, userID := range []string{"user-1", "user-2"} {
+		if code := call("req-1/reject", userID, "settings:read"); code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403 rejecting without the officer permission, got %d", userID, code)
+		}
+	}
+	if repo.requests["req-1"].Status != RequestStatusReceived {
+		t.Fatalf("expected the request untouched, got %s", repo.requests["req-1"].Status)
+	}
+	if _, err := NewService(repo).RejectRequest(context.Background(), "req-1", RequestActor{UserID: "user-2"}, "unfounded"); !errors.Is(err, ErrNotComplianceOfficer) {
+		t.Fatalf("expected the service to check the role too, got %v", err)
+	}
+
+	if code := call("req-1/reject", "officer-1", PermissionComplianceOfficer); code != http.StatusOK {
+		t.Fatalf("expected an officer to reject the request, got %d", code)
+	}
+	if got := repo.requests["req-1"]; got.Status != RequestStatusRejected || got.RejectionReason != "unfounded" {
+		t.Fatalf("expected the request rejected, got %+v", got)
+	}
+
+	// Requesters may withdraw only their own requests
+	if code := call("req-2/cancel", "user-2", ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403 cancelling another user's request, got %d", code)
+	}
+	if code := call("req-2/cancel", "user-1", ""); code != http.StatusOK || repo.requests["req-2"].Status != RequestStatusCancelled {
+		t.Fatalf("expected the requester to cancel their request, got %d %s", code, repo.requests["req-2"].Status)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+
 	"github.com/lib/pq"
 )
 
@@ -31,13 +33,16 @@ const (
 	RequestTypeRestriction = "restriction"
 )
 
-// Privacy request status
+// Privacy request status. A request moves received -> identity_verified ->
+// processing -> completed, and may be rejected before processing starts.
 const (
-	RequestStatusReceived   = "received"
-	RequestStatusProcessing = "processing"
-	RequestStatusCompleted  = "completed"
-	RequestStatusFailed     = "failed"
-	RequestStatusCancelled  = "cancelled"
+	RequestStatusReceived         = "received"
+	RequestStatusIdentityVerified = "identity_verified"
+	RequestStatusProcessing       = "processing"
+	RequestStatusCompleted        = "completed"
+	RequestStatusRejected         = "rejected"
+	RequestStatusFailed           = "failed"
+	RequestStatusCancelled        = "cancelled"
 )
 
 // Sensitivity levels
@@ -63,6 +68,8 @@ const (
 	ActorTypeUser      = "user"
 	ActorTypeSystem    = "system"
 	ActorTypeAPIClient = "api_client"
+	ActorTypeShareLink = "share_link"
+	ActorTypeAnonymous = "anonymous"
 )
 
 // Legal hold status
@@ -93,27 +100,39 @@ type RetentionPolicy struct {
 
 // PrivacyRequest represents a GDPR data subject request.
 type PrivacyRequest struct {
-	ID                  string         `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	UserID              string         `gorm:"not null;index" json:"user_id"`
-	RequestType         string         `gorm:"not null" json:"request_type"`
-	RequestSubtype      string         `json:"request_subtype,omitempty"`
-	Status              string         `gorm:"default:'received'" json:"status"`
-	SubmittedAt         time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"submitted_at"`
-	CompletedAt         *time.Time     `json:"completed_at,omitempty"`
-	EstimatedCompletion *time.Time     `json:"estimated_completion,omitempty"`
-	DataCategories      pq.StringArray `gorm:"type:text[]" json:"data_categories,omitempty"`
-	DateRangeStart      *time.Time     `json:"date_range_start,omitempty"`
-	DateRangeEnd        *time.Time     `json:"date_range_end,omitempty"`
-	VerificationMethod  string         `json:"verification_method,omitempty"`
-	VerifiedBy          *string        `json:"verified_by,omitempty"`
-	VerifiedAt          *time.Time     `json:"verified_at,omitempty"`
-	ExportFileURL       string         `json:"export_file_url,omitempty"`
-	ExportFileHash      string         `json:"export_file_hash,omitempty"`
-	DeletionSummary     map[string]any `gorm:"serializer:json" json:"deletion_summary,omitempty"`
-	ErrorMessage        string         `json:"error_message,omitempty"`
-	LegalBasis          string         `json:"legal_basis,omitempty"`
-	CreatedAt           time.Time      `json:"created_at"`
-	UpdatedAt           time.Time      `json:"updated_at"`
+	ID                  string                        `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID              string                        `gorm:"not null;index" json:"user_id"`
+	RequestType         string                        `gorm:"not null" json:"request_type"`
+	RequestSubtype      string                        `json:"request_subtype,omitempty"`
+	Status              string                        `gorm:"default:'received'" json:"status"`
+	SubmittedAt         time.Time                     `gorm:"not null;default:CURRENT_TIMESTAMP" json:"submitted_at"`
+	CompletedAt         *time.Time                    `json:"completed_at,omitempty"`
+	EstimatedCompletion *time.Time                    `json:"estimated_completion,omitempty"`
+	DataCategories      pq.StringArray                `gorm:"type:text[]" json:"data_categories,omitempty"`
+	DateRangeStart      *time.Time                    `json:"date_range_start,omitempty"`
+	DateRangeEnd        *time.Time                    `json:"date_range_end,omitempty"`
+	Jurisdiction        string                        `gorm:"default:'global'" json:"jurisdiction"`
+	DueAt               *time.Time                    `gorm:"index" json:"due_at,omitempty"`
+	EscalatedAt         *time.Time                    `json:"escalated_at,omitempty"`
+	VerificationMethod  string                        `json:"verification_method,omitempty"`
+	VerificationCode    string                        `json:"-"`
+	VerificationExpires *time.Time                    `json:"-"`
+	VerificationTries   int                           `gorm:"default:0" json:"-"`
+	VerifiedBy          *string                       `json:"verified_by,omitempty"`
+	VerifiedAt          *time.Time                    `json:"verified_at,omitempty"`
+	RejectionReason     string                        `json:"rejection_reason,omitempty"`
+	ExportFileURL       string                        `json:"export_file_url,omitempty"`
+	ExportFileHash      string                        `json:"export_file_hash,omitempty"`
+	ExportObjectKey     string                        `json:"-"`
+	ExportExpiresAt     *time.Time                    `json:"export_expires_at,omitempty"`
+	DeletionSummary     map[string]any                `gorm:"serializer:json" json:"deletion_summary,omitempty"`
+	DeletionCertificate *requests.DeletionCertificate `gorm:"serializer:json" json:"deletion_certificate,omitempty"`
+	ErrorMessage        string                        `json:"error_message,omitempty"`
+	ProcessingStartedAt *time.Time                    `json:"processing_started_at,omitempty"`
+	ProcessingAttempts  int                           `gorm:"default:0" json:"processing_attempts"`
+	LegalBasis          string                        `json:"legal_basis,omitempty"`
+	CreatedAt           time.Time                     `json:"created_at"`
+	UpdatedAt           time.Time                     `json:"updated_at"`
 }
 
 // PrivacyPreference stores a user's privacy settings with version tracking.
@@ -177,15 +196,31 @@ type AuditLog struct {
 	CreatedAt        time.Time      `json:"created_at"`
 }
 
+// AuditCheckpoint is a signed Merkle root over a consecutive range of audit
+// logs. It keeps the range provable after rows are archived and detects any
+// change to the content of checkpointed entries.
+type AuditCheckpoint struct {
+	ID             string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	FirstLogID     int64     `gorm:"not null;uniqueIndex" json:"first_log_id"`
+	LastLogID      int64     `gorm:"not null;uniqueIndex" json:"last_log_id"`
+	EntryCount     int64     `gorm:"not null" json:"entry_count"`
+	FirstEventTime time.Time `gorm:"not null" json:"first_event_time"`
+	LastEventTime  time.Time `gorm:"not null;index" json:"last_event_time"`
+	MerkleRoot     string    `gorm:"not null" json:"merkle_root"`
+	LastHash       string    `gorm:"not null" json:"last_hash"` // hash chain of the last entry
+	Signature      string    `gorm:"not null" json:"signature"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 // RetentionSchedule tracks when retention actions should occur.
 type RetentionSchedule struct {
 	ID                  string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	PolicyID            string          `gorm:"not null;index" json:"policy_id"`
+	PolicyID            string          `gorm:"not null;index;uniqueIndex:idx_retention_schedules_policy_action,priority:1" json:"policy_id"`
 	Policy              RetentionPolicy `gorm:"foreignKey:PolicyID" json:"policy,omitempty"`
 	DataType            string          `gorm:"not null" json:"data_type"`
 	NextReviewDate      time.Time       `gorm:"type:date;not null" json:"next_review_date"`
 	NextActionDate      *time.Time      `gorm:"type:date" json:"next_action_date,omitempty"`
-	ActionType          string          `json:"action_type,omitempty"`
+	ActionType          string          `gorm:"uniqueIndex:idx_retention_schedules_policy_action,priority:2" json:"action_type,omitempty"`
 	LastActionDate      *time.Time      `gorm:"type:date" json:"last_action_date,omitempty"`
 	LastActionType      string          `json:"last_action_type,omitempty"`
 	LastActionResult    string          `json:"last_action_result,omitempty"`
@@ -239,6 +274,14 @@ type DeleteRequest struct {
 	LegalBasis     string   `json:"legal_basis"`
 }
 
+type VerifyRequestRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RejectRequestRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
 type UpdatePreferencesRequest struct {
 	MarketingEmails         *bool  `json:"marketing_emails"`
 	PromotionalEmails       *bool  `json:"promotional_emails"`
@@ -274,6 +317,29 @@ type AuditLogQuery struct {
 	Offset           int        `form:"offset"`
 }
 
+// AuditVerification reports the integrity of the audit logs of a period:
+// every hash chain link, every entry signature, and the checkpoints the
+// period overlaps.
+type AuditVerification struct {
+	From               time.Time         `json:"from"`
+	To                 time.Time         `json:"to"`
+	FirstLogID         int64             `json:"first_log_id,omitempty"`
+	LastLogID          int64             `json:"last_log_id,omitempty"`
+	EntriesChecked     int64             `json:"entries_checked"`
+	CheckpointsChecked int               `json:"checkpoints_checked"`
+	Valid              bool              `json:"valid"`
+	Breaks             []AuditChainBreak `json:"breaks,omitempty"`
+	VerifiedAt         time.Time         `json:"verified_at"`
+}
+
+// AuditChainBreak is one integrity failure found by verification.
+type AuditChainBreak struct {
+	LogID        int64  `json:"log_id"`
+	CheckpointID string `json:"checkpoint_id,omitempty"`
+	Kind         string `json:"kind"` // chain, signature, checkpoint
+	Detail       string `json:"detail"`
+}
+
 type CreateLegalHoldRequest struct {
 	Name            string     `json:"name" binding:"required"`
 	Description     string     `json:"description"`
@@ -303,6 +369,31 @@ type AuditEntry struct {
 	PermissionUsed   string
 }
 
+// DataMap lists where the registered modules hold data about a user.
+type DataMap struct {
+	UserID       string                  `json:"user_id"`
+	Providers    []string                `json:"providers"`
+	Categories   []string                `json:"categories"`
+	Locations    []requests.DataLocation `json:"locations"`
+	TotalRecords int64                   `json:"total_records"`
+	TotalObjects int64                   `json:"total_objects"`
+}
+
+// RequestRunResult summarises one pass of privacy request processing.
+type RequestRunResult struct {
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Escalated int `json:"escalated"`
+	Expired   int `json:"expired"`
+}
+
+// ExportDownload is a time-limited link to a completed export package.
+type ExportDownload struct {
+	URL       string    `json:"url"`
+	FileHash  string    `json:"file_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type PaginatedResponse struct {
 	Data   interface{} `json:"data"`
 	Total  int64       `json:"total"`
@@ -0,0 +1,33 @@
+package compliance
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the compliance module keeps a user's
+// data for privacy requests. Audit logs are hash chained and can be exported
+// but never erased.
+func NewPrivacyProvider(db *gorm.DB) requests.Provider {
+	return requests.NewTableProvider("compliance", db, nil,
+		requests.Table{Name: "privacy_preferences", Category: requests.CategoryUserProfile, Where: "user_id = @user"},
+		requests.Table{Name: "consent_records", Category: requests.CategoryComplianceRecords, Where: "user_id = @user"},
+		requests.Table{Name: "privacy_requests", Category: requests.CategoryComplianceRecords, Where: "user_id = @user"},
+		requests.Table{Name: "audit_logs", Category: requests.CategoryAuditLogs,
+			Where: "actor_id = @user OR target_owner_id = @user", Immutable: true},
+	)
+}
+
+// RetentionTargets lists the compliance data that ages out under retention
+// policies. Closed privacy requests expire; the audit log is only ever moved
+// to cold storage, and only once a checkpoint vouches for the moved entries.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategoryComplianceRecords, Table: "privacy_requests", TimestampColumn: "submitted_at", UserColumn: "user_id",
+			Where: "status IN ('completed', 'rejected', 'failed', 'cancelled')"},
+		{Category: requests.CategoryAuditLogs, Table: "audit_logs", TimestampColumn: "event_time", KeyColumn: "log_id", UserColumn: "actor_id",
+			Where: "log_id <= (SELECT COALESCE(MAX(last_log_id), 0) FROM audit_checkpoints)", ArchiveOnly: true},
+	}
+}
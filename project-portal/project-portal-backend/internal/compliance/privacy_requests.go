@@ -0,0 +1,646 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/email"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+)
+
+const (
+	defaultVerificationCodeTTL = 30 * time.Minute
+	defaultEscalateBefore      = 5 * 24 * time.Hour
+	defaultRequestExportTTL    = 7 * 24 * time.Hour
+	defaultRequestURLExpiry    = 15 * time.Minute
+	// presigned S3 links cannot outlive seven days
+	maxPresignedURLExpiry = 7 * 24 * time.Hour
+	requestBatchSize      = 20
+	// requestStaleAfter is how long a request may be processing before
+	// another worker takes it over
+	requestStaleAfter = 2 * time.Hour
+	// requestRetryAfter is how long a failed request waits before it is
+	// processed again, up to maxRequestAttempts times in all
+	requestRetryAfter  = time.Hour
+	maxRequestAttempts = 3
+
+	// PermissionComplianceOfficer lets a user act on other users' privacy
+	// requests
+	PermissionComplianceOfficer = "compliance:officer"
+)
+
+// requestTransitions lists the statuses a privacy request may move to from
+// each status. A failed request may be processed again.
+var requestTransitions = map[string][]string{
+	RequestStatusReceived:         {RequestStatusIdentityVerified, RequestStatusRejected, RequestStatusCancelled},
+	RequestStatusIdentityVerified: {RequestStatusProcessing, RequestStatusRejected, RequestStatusCancelled},
+	RequestStatusProcessing:       {RequestStatusCompleted, RequestStatusFailed},
+	RequestStatusFailed:           {RequestStatusProcessing, RequestStatusRejected},
+}
+
+var (
+	ErrInvalidTransition        = errors.New("privacy request cannot move to that status")
+	ErrRequestNotOwned          = errors.New("privacy request belongs to another user")
+	ErrNotComplianceOfficer     = errors.New("only compliance officers can reject privacy requests")
+	ErrRequestInProgress        = errors.New("privacy request is being processed or not due a retry")
+	ErrExportStorageUnavailable = errors.New("privacy export storage is not configured")
+	ErrNotifierUnavailable      = errors.New("privacy request notifications are not configured")
+	ErrExportNotAvailable       = errors.New("export package is not available")
+)
+
+// ExportStore keeps encrypted export packages; S3Client satisfies it
+type ExportStore interface {
+	UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error)
+	GeneratePresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// RequestNotifier tells requesters and compliance officers about privacy
+// requests.
+type RequestNotifier interface {
+	// SendVerificationCode sends the requester the one-time code that
+	// confirms their identity
+	SendVerificationCode(ctx context.Context, req *PrivacyRequest, code string) error
+	// NotifyExportReady sends the download link and, separately, the key that
+	// opens the encrypted package
+	NotifyExportReady(ctx context.Context, req *PrivacyRequest, downloadURL, packageKey string) error
+	// NotifyRequestClosed tells the requester their request was completed or
+	// rejected
+	NotifyRequestClosed(ctx context.Context, req *PrivacyRequest) error
+	// EscalateRequest alerts compliance officers to a request nearing its
+	// deadline or one that failed
+	EscalateRequest(ctx context.Context, req *PrivacyRequest) error
+}
+
+// --- Request Lifecycle ---
+
+// responseDeadline is when a request submitted at submitted must be answered
+// under the requester's jurisdiction.
+func (s *Service) responseDeadline(ctx context.Context, userID string, submitted time.Time) (string, time.Time) {
+	jurisdiction := "global"
+	if pref, err := s.GetPreferences(ctx, userID); err == nil && pref.Jurisdiction != "" {
+		jurisdiction = pref.Jurisdiction
+	}
+	days := s.jurisdictions.GetMaxResponseDays(jurisdiction)
+	return jurisdiction, submitted.AddDate(0, 0, days)
+}
+
+// RequestClaim says which requests a worker may take up: verified requests,
+// those whose processing started before StaleBefore and failed requests
+// that finished before RetryBefore with attempts left
+type RequestClaim struct {
+	Now         time.Time
+	StaleBefore time.Time
+	RetryBefore time.Time
+	MaxAttempts int
+}
+
+func newRequestClaim(now time.Time) RequestClaim {
+	return RequestClaim{
+		Now:         now,
+		StaleBefore: now.Add(-requestStaleAfter),
+		RetryBefore: now.Add(-requestRetryAfter),
+		MaxAttempts: maxRequestAttempts,
+	}
+}
+
+// claim takes a request up for processing so that only one worker handles
+// it, returning ErrRequestInProgress when it cannot be claimed.
+func (s *Service) claim(ctx context.Context, req *PrivacyRequest) error {
+	claim := newRequestClaim(time.Now())
+	claimed, err := s.repo.ClaimPrivacyRequest(ctx, req.ID, claim)
+	if err != nil {
+		return fmt.Errorf("claiming request: %w", err)
+	}
+	if !claimed {
+		return ErrRequestInProgress
+	}
+	from := req.Status
+	req.Status = RequestStatusProcessing
+	req.ProcessingStartedAt = &claim.Now
+	req.ProcessingAttempts++
+	s.auditTransition(ctx, req, from, "")
+	return nil
+}
+
+// transition moves a request to status, saves it and records the change in
+// the audit log.
+func (s *Service) transition(ctx context.Context, req *PrivacyRequest, status, actorID string) error {
+	from := req.Status
+	allowed := false
+	for _, next := range requestTransitions[from] {
+		if next == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, status)
+	}
+
+	req.Status = status
+	if err := s.repo.UpdatePrivacyRequest(ctx, req); err != nil {
+		req.Status = from
+		return fmt.Errorf("updating request: %w", err)
+	}
+	s.auditTransition(ctx, req, from, actorID)
+	return nil
+}
+
+// auditTransition records a request's move from one status to its current
+// one
+func (s *Service) auditTransition(ctx context.Context, req *PrivacyRequest, from, actorID string) {
+	status := req.Status
+	entry := AuditEntry{
+		EventType:     "privacy_request",
+		EventAction:   status,
+		ActorID:       actorID,
+		ActorType:     ActorTypeUser,
+		TargetType:    "privacy_request",
+		TargetID:      req.ID,
+		TargetOwnerID: req.UserID,
+		DataCategory:  requests.CategoryComplianceRecords,
+		ServiceName:   "compliance",
+		OldValues:     map[string]any{"status": from},
+		NewValues:     map[string]any{"status": status},
+	}
+	if actorID == "" {
+		entry.ActorType = ActorTypeSystem
+	}
+	if err := s.LogAuditEvent(ctx, entry); err != nil {
+		log.Printf("compliance: audit of request %s moving to %s: %v", req.ID, status, err)
+	}
+}
+
+// SendVerificationCode emails the requester a new one-time code for their
+// request, replacing any earlier code.
+func (s *Service) SendVerificationCode(ctx context.Context, id, userID string) error {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return fmt.Errorf("fetching request: %w", err)
+	}
+	if privReq.UserID != userID {
+		return ErrRequestNotOwned
+	}
+	return s.sendVerificationCode(ctx, privReq)
+}
+
+func (s *Service) sendVerificationCode(ctx context.Context, privReq *PrivacyRequest) error {
+	if privReq.Status != RequestStatusReceived {
+		return fmt.Errorf("%w: request is %s", ErrInvalidTransition, privReq.Status)
+	}
+	if s.cfg.Notifier == nil {
+		return ErrNotifierUnavailable
+	}
+
+	code, hash, err := s.verifier.IssueCode()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(s.cfg.VerificationCodeTTL)
+	privReq.VerificationCode = hash
+	privReq.VerificationExpires = &expires
+	privReq.VerificationTries = 0
+	if err := s.repo.UpdatePrivacyRequest(ctx, privReq); err != nil {
+		return fmt.Errorf("updating request: %w", err)
+	}
+	if err := s.cfg.Notifier.SendVerificationCode(ctx, privReq, code); err != nil {
+		return fmt.Errorf("sending verification code: %w", err)
+	}
+	return nil
+}
+
+// VerifyRequest confirms the requester's identity with the one-time code
+// they were emailed. Too many wrong codes reject the request.
+func (s *Service) VerifyRequest(ctx context.Context, id, userID, code string) (*PrivacyRequest, error) {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	if _, err := s.verifier.VerifyByEmail(privReq.UserID, userID); err != nil {
+		return nil, ErrRequestNotOwned
+	}
+	if privReq.Status != RequestStatusReceived {
+		return nil, fmt.Errorf("%w: request is %s", ErrInvalidTransition, privReq.Status)
+	}
+
+	// The attempt is counted before the code is compared, so guesses sent in
+	// parallel cannot all be checked against the same count
+	tries, ok, err := s.repo.ConsumeVerificationAttempt(ctx, id, requests.MaxCodeAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("counting verification attempt: %w", err)
+	}
+	var result *requests.VerificationResult
+	if !ok {
+		privReq.VerificationTries = requests.MaxCodeAttempts
+		err = requests.ErrTooManyAttempts
+	} else {
+		privReq.VerificationTries = tries
+		result, err = s.verifier.VerifyCode(userID, privReq.VerificationCode, code, privReq.VerificationExpires, tries-1)
+	}
+	if errors.Is(err, requests.ErrCodeMismatch) {
+		if tries < requests.MaxCodeAttempts {
+			return nil, err
+		}
+		err = requests.ErrTooManyAttempts
+	}
+	if errors.Is(err, requests.ErrTooManyAttempts) {
+		if _, rejectErr := s.reject(ctx, privReq, "", "identity could not be verified"); rejectErr != nil {
+			return nil, rejectErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privReq.VerificationMethod = result.Method
+	privReq.VerifiedBy = &result.VerifiedBy
+	privReq.VerifiedAt = &result.VerifiedAt
+	privReq.VerificationCode = ""
+	privReq.VerificationExpires = nil
+	if err := s.transition(ctx, privReq, RequestStatusIdentityVerified, userID); err != nil {
+		return nil, err
+	}
+	return privReq, nil
+}
+
+// RequestActor is a user acting on a privacy request with the permissions
+// the gateway granted them
+type RequestActor struct {
+	UserID      string
+	Permissions []string
+}
+
+// IsOfficer reports whether the actor is a compliance officer
+func (a RequestActor) IsOfficer() bool {
+	for _, p := range a.Permissions {
+		if p == PermissionComplianceOfficer || p == "*" || p == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// RejectRequest refuses a request that has not been processed, for example
+// because it is manifestly unfounded, and tells the requester why. Only
+// compliance officers may reject requests.
+func (s *Service) RejectRequest(ctx context.Context, id string, officer RequestActor, reason string) (*PrivacyRequest, error) {
+	if !officer.IsOfficer() {
+		return nil, ErrNotComplianceOfficer
+	}
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	return s.reject(ctx, privReq, officer.UserID, reason)
+}
+
+// CancelRequest withdraws the requester's own request before it is
+// processed.
+func (s *Service) CancelRequest(ctx context.Context, id, userID string) (*PrivacyRequest, error) {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	if privReq.UserID != userID {
+		return nil, ErrRequestNotOwned
+	}
+	now := time.Now()
+	privReq.VerificationCode = ""
+	privReq.VerificationExpires = nil
+	privReq.CompletedAt = &now
+	if err := s.transition(ctx, privReq, RequestStatusCancelled, userID); err != nil {
+		return nil, err
+	}
+	return privReq, nil
+}
+
+func (s *Service) reject(ctx context.Context, privReq *PrivacyRequest, actorID, reason string) (*PrivacyRequest, error) {
+	now := time.Now()
+	privReq.RejectionReason = reason
+	privReq.VerificationCode = ""
+	privReq.VerificationExpires = nil
+	privReq.CompletedAt = &now
+	if err := s.transition(ctx, privReq, RequestStatusRejected, actorID); err != nil {
+		return nil, err
+	}
+	s.notifyClosed(ctx, privReq)
+	return privReq, nil
+}
+
+// ProcessExportRequest collects the requester's data from every provider,
+// seals it in an encrypted package and uploads it. The requester is sent a
+// download link that expires with the package and the key to open it; the
+// key is not kept.
+func (s *Service) ProcessExportRequest(ctx context.Context, id string) (*PrivacyRequest, error) {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	if privReq.RequestType != RequestTypeExport {
+		return nil, fmt.Errorf("request %s is not an export request", id)
+	}
+	if privReq.Status == RequestStatusCompleted {
+		return privReq, nil
+	}
+	if s.cfg.ExportStore == nil {
+		return nil, ErrExportStorageUnavailable
+	}
+	if s.cfg.Notifier == nil {
+		return nil, ErrNotifierUnavailable
+	}
+
+	if err := s.claim(ctx, privReq); err != nil {
+		return nil, err
+	}
+
+	if err := s.buildExportPackage(ctx, privReq); err != nil {
+		privReq.ErrorMessage = err.Error()
+		now := time.Now()
+		privReq.CompletedAt = &now
+		if err := s.transition(ctx, privReq, RequestStatusFailed, ""); err != nil {
+			return nil, err
+		}
+		return privReq, nil
+	}
+
+	now := time.Now()
+	privReq.CompletedAt = &now
+	privReq.ErrorMessage = ""
+	if err := s.transition(ctx, privReq, RequestStatusCompleted, ""); err != nil {
+		return nil, err
+	}
+	return privReq, nil
+}
+
+func (s *Service) buildExportPackage(ctx context.Context, privReq *PrivacyRequest) error {
+	result, err := s.processor.ProcessExportRequest(ctx, privReq.UserID, privReq.DataCategories, privReq.DateRangeStart, privReq.DateRangeEnd)
+	if err != nil {
+		return err
+	}
+	sealed, packageKey, err := requests.SealPackage(result.Data)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("compliance/exports/%s/%s.json.enc", privReq.UserID, privReq.ID)
+	if _, err := s.cfg.ExportStore.UploadBytes(ctx, key, sealed, "application/octet-stream"); err != nil {
+		return fmt.Errorf("uploading export package: %w", err)
+	}
+	expires := time.Now().Add(s.cfg.ExportRetention)
+	privReq.ExportExpiresAt = &expires
+	url, err := s.cfg.ExportStore.GeneratePresignedURL(ctx, key, s.cfg.ExportRetention)
+	if err == nil {
+		// Without the emailed key the package cannot be opened, so it is
+		// only kept once the requester has been sent it
+		err = s.cfg.Notifier.NotifyExportReady(ctx, privReq, url, packageKey)
+	}
+	if err != nil {
+		privReq.ExportExpiresAt = nil
+		if deleteErr := s.cfg.ExportStore.Delete(ctx, key); deleteErr != nil {
+			log.Printf("compliance: delete undelivered export %s: %v", key, deleteErr)
+		}
+		return fmt.Errorf("delivering export package: %w", err)
+	}
+
+	privReq.ExportObjectKey = key
+	privReq.ExportFileHash = result.FileHash
+	privReq.ExportFileURL = fmt.Sprintf("/api/v1/compliance/requests/%s/download", privReq.ID)
+	return nil
+}
+
+// GetExportDownload returns a fresh, short-lived link to the requester's
+// export package while it has not expired.
+func (s *Service) GetExportDownload(ctx context.Context, id, userID string) (*ExportDownload, error) {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	if privReq.UserID != userID {
+		return nil, ErrRequestNotOwned
+	}
+	if s.cfg.ExportStore == nil {
+		return nil, ErrExportStorageUnavailable
+	}
+	if privReq.ExportObjectKey == "" || privReq.ExportExpiresAt == nil || !time.Now().Before(*privReq.ExportExpiresAt) {
+		return nil, ErrExportNotAvailable
+	}
+
+	expiry := s.cfg.ExportURLExpiry
+	if remaining := time.Until(*privReq.ExportExpiresAt); remaining < expiry {
+		expiry = remaining
+	}
+	url, err := s.cfg.ExportStore.GeneratePresignedURL(ctx, privReq.ExportObjectKey, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("creating download link: %w", err)
+	}
+	return &ExportDownload{URL: url, FileHash: privReq.ExportFileHash, ExpiresAt: time.Now().Add(expiry)}, nil
+}
+
+// ProcessPrivacyRequests processes verified requests, takes over requests
+// whose worker stalled, retries failed ones, escalates open requests
+// nearing their deadline and deletes expired export packages.
+// Correction and restriction requests are left to compliance officers.
+func (s *Service) ProcessPrivacyRequests(ctx context.Context) (*RequestRunResult, error) {
+	result := &RequestRunResult{}
+
+	pending, err := s.repo.GetPendingRequests(ctx, newRequestClaim(time.Now()), requestBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("listing pending requests: %w", err)
+	}
+	for _, req := range pending {
+		var processed *PrivacyRequest
+		switch req.RequestType {
+		case RequestTypeExport:
+			if s.cfg.ExportStore == nil || s.cfg.Notifier == nil {
+				continue
+			}
+			processed, err = s.ProcessExportRequest(ctx, req.ID)
+		case RequestTypeDeletion:
+			processed, err = s.ProcessDeletionRequest(ctx, req.ID)
+		default:
+			continue
+		}
+		if errors.Is(err, ErrRequestInProgress) {
+			continue
+		}
+		if err != nil {
+			log.Printf("compliance: processing request %s: %v", req.ID, err)
+			result.Failed++
+			continue
+		}
+		if processed.Status == RequestStatusFailed {
+			result.Failed++
+			if s.escalate(ctx, processed) {
+				result.Escalated++
+			}
+			continue
+		}
+		result.Completed++
+		s.notifyClosed(ctx, processed)
+	}
+
+	due, err := s.repo.ListRequestsDueBefore(ctx, time.Now().Add(s.cfg.EscalateBefore))
+	if err != nil {
+		return result, fmt.Errorf("listing requests nearing deadline: %w", err)
+	}
+	for i := range due {
+		if s.escalate(ctx, &due[i]) {
+			result.Escalated++
+		}
+	}
+
+	if s.cfg.ExportStore != nil {
+		expired, err := s.repo.ListExpiredExports(ctx, time.Now())
+		if err != nil {
+			return result, fmt.Errorf("listing expired exports: %w", err)
+		}
+		for i := range expired {
+			req := &expired[i]
+			if err := s.cfg.ExportStore.Delete(ctx, req.ExportObjectKey); err != nil {
+				log.Printf("compliance: delete expired export %s: %v", req.ExportObjectKey, err)
+				continue
+			}
+			req.ExportObjectKey = ""
+			req.ExportFileURL = ""
+			if err := s.repo.UpdatePrivacyRequest(ctx, req); err != nil {
+				log.Printf("compliance: update expired export %s: %v", req.ID, err)
+				continue
+			}
+			result.Expired++
+		}
+	}
+	return result, nil
+}
+
+// escalate alerts compliance officers to a request once, reporting whether
+// the alert was sent.
+func (s *Service) escalate(ctx context.Context, req *PrivacyRequest) bool {
+	if req.EscalatedAt != nil || s.cfg.Notifier == nil {
+		return false
+	}
+	if err := s.cfg.Notifier.EscalateRequest(ctx, req); err != nil {
+		log.Printf("compliance: escalate request %s: %v", req.ID, err)
+		return false
+	}
+	now := time.Now()
+	req.EscalatedAt = &now
+	if err := s.repo.UpdatePrivacyRequest(ctx, req); err != nil {
+		log.Printf("compliance: record escalation of request %s: %v", req.ID, err)
+	}
+	return true
+}
+
+func (s *Service) notifyClosed(ctx context.Context, req *PrivacyRequest) {
+	if s.cfg.Notifier == nil {
+		return
+	}
+	if err := s.cfg.Notifier.NotifyRequestClosed(ctx, req); err != nil {
+		log.Printf("compliance: notify requester of request %s: %v", req.ID, err)
+	}
+}
+
+// EmailRequestNotifier emails requesters and compliance officers
+type EmailRequestNotifier struct {
+	Sender    email.Sender
+	Recipient func(ctx context.Context, userID string) (string, error)
+	// Officers are the compliance officers escalations are sent to
+	Officers []string
+}
+
+func (n EmailRequestNotifier) requester(ctx context.Context, req *PrivacyRequest) (string, error) {
+	to, err := n.Recipient(ctx, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	if to == "" {
+		return "", fmt.Errorf("no email address for user %s", req.UserID)
+	}
+	return to, nil
+}
+
+func (n EmailRequestNotifier) SendVerificationCode(ctx context.Context, req *PrivacyRequest, code string) error {
+	to, err := n.requester(ctx, req)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("We received a %s request for your CarbonScribe data.\n\n"+
+		"To confirm it was you, enter this code: %s\n\n"+
+		"The code expires on %s. If you did not make this request, you can ignore this email and nothing will happen.",
+		req.RequestType, code, req.VerificationExpires.Format("2 January 2006 15:04 MST"))
+	return n.Sender.Send(ctx, to, "Confirm your CarbonScribe privacy request", body)
+}
+
+func (n EmailRequestNotifier) NotifyExportReady(ctx context.Context, req *PrivacyRequest, downloadURL, packageKey string) error {
+	to, err := n.requester(ctx, req)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("The export of your CarbonScribe data is ready.\n\n"+
+		"Download the encrypted package here:\n%s\n\n"+
+		"The link and the package expire on %s. We are sending the key that opens the package in a separate email.",
+		downloadURL, req.ExportExpiresAt.Format("2 January 2006 15:04 MST"))
+	if err := n.Sender.Send(ctx, to, "Your CarbonScribe data export is ready", body); err != nil {
+		return err
+	}
+	keyBody := fmt.Sprintf("This is the key for the data export you requested (request %s):\n\n%s\n\n"+
+		"The package is encrypted with AES-256-GCM. Keep this key safe: we do not store it and cannot send it again.",
+		req.ID, packageKey)
+	return n.Sender.Send(ctx, to, "The key to your CarbonScribe data export", keyBody)
+}
+
+func (n EmailRequestNotifier) NotifyRequestClosed(ctx context.Context, req *PrivacyRequest) error {
+	// Completed exports were announced with their download link
+	if req.RequestType == RequestTypeExport && req.Status == RequestStatusCompleted {
+		return nil
+	}
+	to, err := n.requester(ctx, req)
+	if err != nil {
+		return err
+	}
+	var subject, body string
+	switch req.Status {
+	case RequestStatusRejected:
+		subject = "Your CarbonScribe privacy request was declined"
+		body = fmt.Sprintf("We could not carry out your %s request.\n\nReason: %s\n\n"+
+			"If you believe this is a mistake, reply to this email or submit a new request.", req.RequestType, req.RejectionReason)
+	case RequestStatusCompleted:
+		subject = "Your CarbonScribe privacy request is complete"
+		body = fmt.Sprintf("Your %s request has been completed.", req.RequestType)
+		if req.DeletionCertificate != nil {
+			body += fmt.Sprintf("\n\nYour deletion certificate is %s.", req.DeletionCertificate.Token)
+		}
+	default:
+		return nil
+	}
+	return n.Sender.Send(ctx, to, subject, body)
+}
+
+func (n EmailRequestNotifier) EscalateRequest(ctx context.Context, req *PrivacyRequest) error {
+	if len(n.Officers) == 0 {
+		return errors.New("no compliance officers configured")
+	}
+	due := "no deadline"
+	if req.DueAt != nil {
+		due = req.DueAt.Format("2 January 2006 15:04 MST")
+	}
+	subject := fmt.Sprintf("Privacy request %s needs attention (due %s)", req.ID, due)
+	body := fmt.Sprintf("A %s privacy request needs attention.\n\n"+
+		"Request: %s\nUser: %s\nStatus: %s\nJurisdiction: %s\nSubmitted: %s\nDue: %s\n",
+		req.RequestType, req.ID, req.UserID, req.Status, req.Jurisdiction,
+		req.SubmittedAt.Format("2 January 2006 15:04 MST"), due)
+	if req.ErrorMessage != "" {
+		body += "Error: " + req.ErrorMessage + "\n"
+	}
+	for _, to := range n.Officers {
+		if err := n.Sender.Send(ctx, to, subject, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+)
+
+func (r *requestRepo) GetPendingRequests(_ context.Context, claim RequestClaim, _ int) ([]PrivacyRequest, error) {
+	var out []PrivacyRequest
+	for _, req := range r.requests {
+		if claimable(req, claim) {
+			out = append(out, *req)
+		}
+	}
+	return out, nil
+}
+
+func (r *requestRepo) ClaimPrivacyRequest(_ context.Context, id string, claim RequestClaim) (bool, error) {
+	req, ok := r.requests[id]
+	if !ok || !claimable(req, claim) {
+		return false, nil
+	}
+	req.Status = RequestStatusProcessing
+	req.ProcessingStartedAt = &claim.Now
+	req.ProcessingAttempts++
+	return true, nil
+}
+
+func (r *requestRepo) ConsumeVerificationAttempt(_ context.Context, id string, maxAttempts int) (int, bool, error) {
+	req, ok := r.requests[id]
+	if !ok || req.VerificationTries >= maxAttempts {
+		return 0, false, nil
+	}
+	req.VerificationTries++
+	return req.VerificationTries, true, nil
+}
+
+func (r *requestRepo) ListRequestsDueBefore(_ context.Context, _ time.Time) ([]PrivacyRequest, error) {
+	return nil, nil
+}
+
+func (r *requestRepo) IsDataUnderLegalHold(_ context.Context, _, _ string) (bool, error) {
+	return false, nil
+}
+
+func claimable(req *PrivacyRequest, claim RequestClaim) bool {
+	switch req.Status {
+	case RequestStatusIdentityVerified:
+		return true
+	case RequestStatusProcessing:
+		return req.ProcessingStartedAt != nil && req.ProcessingStartedAt.Before(claim.StaleBefore)
+	case RequestStatusFailed:
+		return req.ProcessingAttempts < claim.MaxAttempts && req.CompletedAt != nil && req.CompletedAt.Before(claim.RetryBefore)
+	}
+	return false
+}
+
+func TestProcessPrivacyRequestsClaimsEachRequestOnce(t *testing.T) {
+	recent, stale := time.Now().Add(-time.Minute), time.Now().Add(-3*time.Hour)
+	deletion := func(id, status string, started, completed *time.Time, attempts int) *PrivacyRequest {
+		return &PrivacyRequest{ID: id, UserID: "user-" + id, RequestType: RequestTypeDeletion, Status: status,
+			ProcessingStartedAt: started, CompletedAt: completed, ProcessingAttempts: attempts}
+	}
+	repo := &requestRepo{requests: map[string]*PrivacyRequest{
+		"verified":  deletion("verified", RequestStatusIdentityVerified, nil, nil, 0),
+		"running":   deletion("running", RequestStatusProcessing, &recent, nil, 1),
+		"stalled":   deletion("stalled", RequestStatusProcessing, &stale, nil, 1),
+		"retry":     deletion("retry", RequestStatusFailed, &stale, &stale, 1),
+		"exhausted": deletion("exhausted", RequestStatusFailed, &stale, &stale, maxRequestAttempts),
+		"too-soon":  deletion("too-soon", RequestStatusFailed, &recent, &recent, 1),
+	}}
+	svc := NewService(repo)
+
+	result, err := svc.ProcessPrivacyRequests(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessPrivacyRequests: %v", err)
+	}
+	if result.Completed != 3 {
+		t.Fatalf("expected the verified, stalled and retried requests processed, got %+v", result)
+	}
+	for id, want := range map[string]string{
+		"verified": RequestStatusCompleted, "stalled": RequestStatusCompleted, "retry": RequestStatusCompleted,
+		"running": RequestStatusProcessing, "exhausted": RequestStatusFailed, "too-soon": RequestStatusFailed,
+	} {
+		if got := repo.requests[id].Status; got != want {
+			t.Errorf("%s: status %s, want %s", id, got, want)
+		}
+	}
+	if got := repo.requests["retry"].ProcessingAttempts; got != 2 {
+		t.Fatalf("expected the retry counted as a second attempt, got %d", got)
+	}
+
+	// A request another worker holds is left alone
+	if _, err := svc.ProcessDeletionRequest(context.Background(), "running"); !errors.Is(err, ErrRequestInProgress) {
+		t.Fatalf("expected ErrRequestInProgress, got %v", err)
+	}
+}
+
+func TestVerifyRequestCountsAttemptsBeforeComparing(t *testing.T) {
+	code, hash, err := requests.NewVerifier().IssueCode()
+	if err != nil {
+		t.Fatalf("IssueCode: %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	pending := func(id string, tries int) *PrivacyRequest {
+		return &PrivacyRequest{ID: id, UserID: "user-1", RequestType: RequestTypeExport, Status: RequestStatusReceived,
+			VerificationCode: hash, VerificationExpires: &expires, VerificationTries: tries}
+	}
+	repo := &requestRepo{requests: map[string]*PrivacyRequest{
+		"guessing":  pending("guessing", 0),
+		"exhausted": pending("exhausted", requests.MaxCodeAttempts),
+	}}
+	svc := NewService(repo)
+
+	for i := 1; i < requests.MaxCodeAttempts; i++ {
+		if _, err := svc.VerifyRequest(context.Background(), "guessing", "user-1", "000000"); !errors.Is(err, requests.ErrCodeMismatch) {
+			t.Fatalf("guess %d: expected ErrCodeMismatch, got %v", i, err)
+		}
+	}
+	if _, err := svc.VerifyRequest(context.Background(), "guessing", "user-1", "000000"); !errors.Is(err, requests.ErrTooManyAttempts) {
+		t.Fatalf("expected the last guess to exhaust the attempts, got %v", err)
+	}
+	if got := repo.requests["guessing"].Status; got != RequestStatusRejected {
+		t.Fatalf("expected the request rejected, got %s", got)
+	}
+
+	// A guess racing one that used the last attempt is refused even with the
+	// right code, before the other guess has rejected the request
+	if _, err := svc.VerifyRequest(context.Background(), "exhausted", "user-1", code); !errors.Is(err, requests.ErrTooManyAttempts) {
+		t.Fatalf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if got := repo.requests["exhausted"].Status; got != RequestStatusRejected {
+		t.Fatalf("expected the request rejected, got %s", got)
+	}
+}
@@ -2,12 +2,17 @@ package compliance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// auditChainLockID is the advisory lock key serialising audit log appends
+const auditChainLockID = 7201504
+
 // Repository defines all data access operations for the compliance module.
 type Repository interface {
 	// Retention Policies
@@ -22,7 +27,11 @@ type Repository interface {
 	GetPrivacyRequest(ctx context.Context, id string) (*PrivacyRequest, error)
 	ListPrivacyRequests(ctx context.Context, userID string, status string, limit, offset int) ([]PrivacyRequest, int64, error)
 	UpdatePrivacyRequest(ctx context.Context, req *PrivacyRequest) error
-	GetPendingRequests(ctx context.Context, requestType string, limit int) ([]PrivacyRequest, error)
+	GetPendingRequests(ctx context.Context, claim RequestClaim, limit int) ([]PrivacyRequest, error)
+	ClaimPrivacyRequest(ctx context.Context, id string, claim RequestClaim) (bool, error)
+	ConsumeVerificationAttempt(ctx context.Context, id string, maxAttempts int) (int, bool, error)
+	ListRequestsDueBefore(ctx context.Context, before time.Time) ([]PrivacyRequest, error)
+	ListExpiredExports(ctx context.Context, now time.Time) ([]PrivacyRequest, error)
 
 	// Privacy Preferences
 	GetPrivacyPreference(ctx context.Context, userID string) (*PrivacyPreference, error)
@@ -38,6 +47,16 @@ type Repository interface {
 	CreateAuditLog(ctx context.Context, log *AuditLog) error
 	QueryAuditLogs(ctx context.Context, query AuditLogQuery) ([]AuditLog, int64, error)
 	GetLastAuditLog(ctx context.Context) (*AuditLog, error)
+	AppendAuditLog(ctx context.Context, build func(prevHash string) *AuditLog) error
+	GetAuditLogBefore(ctx context.Context, logID int64) (*AuditLog, error)
+	GetAuditLogIDRange(ctx context.Context, from, to time.Time) (int64, int64, error)
+	ListAuditLogsByID(ctx context.Context, afterID, lastID int64, limit int) ([]AuditLog, error)
+
+	// Audit Checkpoints
+	CreateAuditCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error
+	GetLastAuditCheckpoint(ctx context.Context) (*AuditCheckpoint, error)
+	GetAuditCheckpointBefore(ctx context.Context, logID int64) (*AuditCheckpoint, error)
+	ListAuditCheckpoints(ctx context.Context, firstLogID, lastLogID int64, limit int) ([]AuditCheckpoint, error)
 
 	// Retention Schedules
 	CreateRetentionSchedule(ctx context.Context, schedule *RetentionSchedule) error
@@ -51,6 +70,7 @@ type Repository interface {
 	ListActiveLegalHolds(ctx context.Context) ([]LegalHold, error)
 	UpdateLegalHold(ctx context.Context, hold *LegalHold) error
 	IsDataUnderLegalHold(ctx context.Context, userID, dataCategory string) (bool, error)
+	LegalHoldScope(ctx context.Context, dataCategory string) (bool, []string, error)
 
 	// Statistics
 	GetComplianceStats(ctx context.Context) (*ComplianceStats, error)
@@ -148,21 +168,78 @@ func (r *repository) UpdatePrivacyRequest(ctx context.Context, req *PrivacyReque
 	return r.db.WithContext(ctx).Save(req).Error
 }
 
-func (r *repository) GetPendingRequests(ctx context.Context, requestType string, limit int) ([]PrivacyRequest, error) {
-	var requests []PrivacyRequest
-	q := r.db.WithContext(ctx).Where("status = ?", RequestStatusReceived)
-	if requestType != "" {
-		q = q.Where("request_type = ?", requestType)
+// ConsumeVerificationAttempt counts a verification attempt against a request,
+// returning the attempts made including this one. It reports false once
+// maxAttempts have been used, so parallel guesses cannot share a count.
+func (r *repository) ConsumeVerificationAttempt(ctx context.Context, id string, maxAttempts int) (int, bool, error) {
+	var tries []int
+	err := r.db.WithContext(ctx).Raw(
+		`UPDATE privacy_requests SET verification_tries = verification_tries + 1
+		WHERE id = ? AND verification_tries < ? RETURNING verification_tries`, id, maxAttempts).
+		Scan(&tries).Error
+	if err != nil || len(tries) == 0 {
+		return 0, false, err
 	}
+	return tries[0], true, nil
+}
+
+// GetPendingRequests returns the requests a worker may claim, those due
+// soonest first.
+func (r *repository) GetPendingRequests(ctx context.Context, claim RequestClaim, limit int) ([]PrivacyRequest, error) {
+	var requests []PrivacyRequest
 	if limit <= 0 {
 		limit = 50
 	}
-	if err := q.Order("submitted_at ASC").Limit(limit).Find(&requests).Error; err != nil {
+	q := claimableRequests(r.db.WithContext(ctx), claim)
+	if err := q.Order("due_at ASC NULLS LAST, submitted_at ASC").Limit(limit).Find(&requests).Error; err != nil {
 		return nil, err
 	}
 	return requests, nil
 }
 
+// ClaimPrivacyRequest marks a request as being processed, reporting false
+// if another worker holds it or it is not ready to be retried
+func (r *repository) ClaimPrivacyRequest(ctx context.Context, id string, claim RequestClaim) (bool, error) {
+	res := claimableRequests(r.db.WithContext(ctx).Model(&PrivacyRequest{}).Where("id = ?", id), claim).
+		Updates(map[string]interface{}{
+			"status":                RequestStatusProcessing,
+			"processing_started_at": claim.Now,
+			"processing_attempts":   gorm.Expr("processing_attempts + 1"),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// claimableRequests limits q to verified requests, those whose processing
+// stalled and failed requests due a retry
+func claimableRequests(q *gorm.DB, claim RequestClaim) *gorm.DB {
+	return q.Where("status = ? OR (status = ? AND COALESCE(processing_started_at, updated_at) < ?) OR (status = ? AND processing_attempts < ? AND completed_at < ?)",
+		RequestStatusIdentityVerified,
+		RequestStatusProcessing, claim.StaleBefore,
+		RequestStatusFailed, claim.MaxAttempts, claim.RetryBefore)
+}
+
+// ListRequestsDueBefore returns open requests due by before that have not
+// been escalated yet.
+func (r *repository) ListRequestsDueBefore(ctx context.Context, before time.Time) ([]PrivacyRequest, error) {
+	var requests []PrivacyRequest
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", []string{RequestStatusReceived, RequestStatusIdentityVerified, RequestStatusProcessing}).
+		Where("due_at IS NOT NULL AND due_at <= ? AND escalated_at IS NULL", before).
+		Order("due_at ASC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ListExpiredExports returns completed exports whose package has outlived
+// its retention and is still stored.
+func (r *repository) ListExpiredExports(ctx context.Context, now time.Time) ([]PrivacyRequest, error) {
+	var requests []PrivacyRequest
+	err := r.db.WithContext(ctx).
+		Where("request_type = ? AND export_object_key <> '' AND export_expires_at <= ?", RequestTypeExport, now).
+		Find(&requests).Error
+	return requests, err
+}
+
 // --- Privacy Preferences ---
 
 func (r *repository) GetPrivacyPreference(ctx context.Context, userID string) (*PrivacyPreference, error) {
@@ -289,6 +366,119 @@ func (r *repository) GetLastAuditLog(ctx context.Context) (*AuditLog, error) {
 	return &log, nil
 }
 
+// AppendAuditLog adds an entry to the hash chain. Appends are serialised by
+// a transaction-scoped advisory lock, so each entry links to the one
+// committed before it and concurrent writers cannot fork the chain. When
+// every row has been archived the chain continues from the last checkpoint.
+func (r *repository) AppendAuditLog(ctx context.Context, build func(prevHash string) *AuditLog) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockID).Error; err != nil {
+			return fmt.Errorf("locking audit chain: %w", err)
+		}
+
+		prevHash := ""
+		var last AuditLog
+		err := tx.Order("log_id DESC").First(&last).Error
+		switch {
+		case err == nil:
+			prevHash = last.HashChain
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			var cp AuditCheckpoint
+			if err := tx.Order("last_log_id DESC").First(&cp).Error; err == nil {
+				prevHash = cp.LastHash
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("reading last checkpoint: %w", err)
+			}
+		default:
+			return fmt.Errorf("reading last audit log: %w", err)
+		}
+
+		return tx.Create(build(prevHash)).Error
+	})
+}
+
+func (r *repository) GetAuditLogBefore(ctx context.Context, logID int64) (*AuditLog, error) {
+	var log AuditLog
+	if err := r.db.WithContext(ctx).Where("log_id < ?", logID).Order("log_id DESC").First(&log).Error; err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// GetAuditLogIDRange returns the first and last log IDs of a period, or
+// zeros when it has no entries
+func (r *repository) GetAuditLogIDRange(ctx context.Context, from, to time.Time) (int64, int64, error) {
+	var bounds struct {
+		First *int64
+		Last  *int64
+	}
+	if err := r.db.WithContext(ctx).Model(&AuditLog{}).
+		Select("MIN(log_id) AS first, MAX(log_id) AS last").
+		Where("event_time >= ? AND event_time <= ?", from, to).
+		Scan(&bounds).Error; err != nil {
+		return 0, 0, err
+	}
+	if bounds.First == nil || bounds.Last == nil {
+		return 0, 0, nil
+	}
+	return *bounds.First, *bounds.Last, nil
+}
+
+func (r *repository) ListAuditLogsByID(ctx context.Context, afterID, lastID int64, limit int) ([]AuditLog, error) {
+	var logs []AuditLog
+	if err := r.db.WithContext(ctx).
+		Where("log_id > ? AND log_id <= ?", afterID, lastID).
+		Order("log_id ASC").
+		Limit(limit).
+		Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// --- Audit Checkpoints ---
+
+func (r *repository) CreateAuditCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error {
+	return r.db.WithContext(ctx).Create(checkpoint).Error
+}
+
+func (r *repository) GetLastAuditCheckpoint(ctx context.Context) (*AuditCheckpoint, error) {
+	var cp AuditCheckpoint
+	if err := r.db.WithContext(ctx).Order("last_log_id DESC").First(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// GetAuditCheckpointBefore returns the latest checkpoint ending before logID
+func (r *repository) GetAuditCheckpointBefore(ctx context.Context, logID int64) (*AuditCheckpoint, error) {
+	var cp AuditCheckpoint
+	if err := r.db.WithContext(ctx).Where("last_log_id < ?", logID).Order("last_log_id DESC").First(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// ListAuditCheckpoints returns checkpoints overlapping a range of log IDs,
+// most recent first; zero bounds list all of them
+func (r *repository) ListAuditCheckpoints(ctx context.Context, firstLogID, lastLogID int64, limit int) ([]AuditCheckpoint, error) {
+	var checkpoints []AuditCheckpoint
+	q := r.db.WithContext(ctx)
+	if firstLogID > 0 {
+		q = q.Where("last_log_id >= ?", firstLogID)
+	}
+	if lastLogID > 0 {
+		q = q.Where("first_log_id <= ?", lastLogID)
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Order("last_log_id DESC").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
 // --- Retention Schedules ---
 
 func (r *repository) CreateRetentionSchedule(ctx context.Context, schedule *RetentionSchedule) error {
@@ -308,7 +498,7 @@ func (r *repository) GetDueSchedules(ctx context.Context, before time.Time) ([]R
 }
 
 func (r *repository) UpdateRetentionSchedule(ctx context.Context, schedule *RetentionSchedule) error {
-	return r.db.WithContext(ctx).Save(schedule).Error
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(schedule).Error
 }
 
 func (r *repository) ListRetentionSchedules(ctx context.Context, policyID string) ([]RetentionSchedule, error) {
@@ -367,6 +557,30 @@ func (r *repository) IsDataUnderLegalHold(ctx context.Context, userID, dataCateg
 	return count > 0, nil
 }
 
+// LegalHoldScope reports whether an active hold covers a whole data category
+// and which users' data is held regardless of category, matching
+// IsDataUnderLegalHold for bulk retention enforcement.
+func (r *repository) LegalHoldScope(ctx context.Context, dataCategory string) (bool, []string, error) {
+	var holds []LegalHold
+	if err := r.db.WithContext(ctx).
+		Where("status = ?", LegalHoldActive).
+		Find(&holds).Error; err != nil {
+		return false, nil, fmt.Errorf("listing legal holds: %w", err)
+	}
+
+	categoryHeld := false
+	var userIDs []string
+	for _, hold := range holds {
+		for _, cat := range hold.DataCategories {
+			if cat == dataCategory {
+				categoryHeld = true
+			}
+		}
+		userIDs = append(userIDs, hold.AffectedUserIDs...)
+	}
+	return categoryHeld, userIDs, nil
+}
+
 // --- Statistics ---
 
 func (r *repository) GetComplianceStats(ctx context.Context) (*ComplianceStats, error) {
@@ -375,7 +589,7 @@ func (r *repository) GetComplianceStats(ctx context.Context) (*ComplianceStats,
 	}
 
 	r.db.WithContext(ctx).Model(&PrivacyRequest{}).Count(&stats.TotalRequests)
-	r.db.WithContext(ctx).Model(&PrivacyRequest{}).Where("status IN ?", []string{RequestStatusReceived, RequestStatusProcessing}).Count(&stats.PendingRequests)
+	r.db.WithContext(ctx).Model(&PrivacyRequest{}).Where("status IN ?", []string{RequestStatusReceived, RequestStatusIdentityVerified, RequestStatusProcessing}).Count(&stats.PendingRequests)
 	r.db.WithContext(ctx).Model(&PrivacyRequest{}).Where("status = ?", RequestStatusCompleted).Count(&stats.CompletedRequests)
 	r.db.WithContext(ctx).Model(&RetentionPolicy{}).Where("is_active = true").Count(&stats.ActivePolicies)
 	r.db.WithContext(ctx).Model(&LegalHold{}).Where("status = ?", LegalHoldActive).Count(&stats.ActiveLegalHolds)
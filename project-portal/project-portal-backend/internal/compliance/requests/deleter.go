@@ -2,21 +2,59 @@ package requests
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/pkg/cryptography"
 )
 
+// LegalHoldChecker reports whether a user's data in a category is under an
+// active legal hold; the compliance repository satisfies it.
+type LegalHoldChecker interface {
+	IsDataUnderLegalHold(ctx context.Context, userID, dataCategory string) (bool, error)
+}
+
+// IndexPurger removes a user from the search index entries referencing them.
+type IndexPurger interface {
+	PurgeUserEntries(ctx context.Context, userID string) (int64, error)
+}
+
+// retainedCategories are kept on erasure because the law requires them.
+var retainedCategories = map[string]string{
+	CategoryFinancialRecords:  "Required for tax/legal compliance",
+	CategoryAuditLogs:         "Required for regulatory compliance",
+	CategoryComplianceRecords: "Required to evidence the handling of privacy requests",
+}
+
 // Deleter handles secure data deletion across all stores.
 type Deleter struct {
 	discoverer *Discoverer
+	holds      LegalHoldChecker
+	purgers    []IndexPurger
+	certifier  *cryptography.SecureDeletion
 }
 
-// NewDeleter creates a new data deleter.
-func NewDeleter(discoverer *Discoverer) *Deleter {
-	return &Deleter{discoverer: discoverer}
+// NewDeleter creates a new data deleter. holds may be nil when legal holds
+// are enforced elsewhere.
+func NewDeleter(discoverer *Discoverer, holds LegalHoldChecker, purgers ...IndexPurger) *Deleter {
+	return &Deleter{
+		discoverer: discoverer,
+		holds:      holds,
+		purgers:    purgers,
+		certifier:  cryptography.NewSecureDeletion(),
+	}
 }
 
-// Delete removes user data from all discovered locations.
+// Delete erases user data from all discovered locations through their
+// providers, purges search index entries and then discovers again to verify
+// nothing erasable is left. A certificate is issued only when every category
+// was either erased and verified or retained for a stated reason.
 func (d *Deleter) Delete(ctx context.Context, userID string, locations []DataLocation) (*DeletionResult, error) {
 	log.Printf("deleting data for user %s across %d locations", userID, len(locations))
 
@@ -25,40 +63,157 @@ func (d *Deleter) Delete(ctx context.Context, userID string, locations []DataLoc
 		Summary: make(map[string]CategoryResult),
 	}
 
+	held := make(map[string]bool)
 	for _, loc := range locations {
-		catResult := d.deleteFromLocation(ctx, userID, loc)
-		result.Summary[loc.Category] = catResult
+		catResult := d.deleteFromLocation(ctx, userID, loc, held)
+		result.Summary[loc.Category] = mergeCategoryResults(result.Summary[loc.Category], catResult, loc.Source)
+	}
 
+	for _, purger := range d.purgers {
+		purged, err := purger.PurgeUserEntries(ctx, userID)
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("purging search index: %v", err))
+			continue
+		}
+		result.IndexEntriesPurged += purged
+	}
+
+	var erased []string
+	for category, catResult := range result.Summary {
 		if catResult.Status == "deleted" {
-			result.DeletedCategories = append(result.DeletedCategories, loc.Category)
-		} else {
-			result.RetainedCategories = append(result.RetainedCategories, loc.Category)
+			erased = append(erased, category)
+		}
+	}
+	if len(erased) > 0 {
+		remaining, err := d.discoverer.DiscoverUserData(ctx, userID, erased)
+		if err != nil {
+			return nil, fmt.Errorf("verifying deletion: %w", err)
+		}
+		for _, loc := range remaining {
+			catResult := result.Summary[loc.Category]
+			catResult.Status = "failed"
+			catResult.Reason = fmt.Sprintf("%d records and %d files remain in %s after erasure", loc.RecordCount, loc.ObjectCount, loc.Source)
+			result.Summary[loc.Category] = catResult
 		}
 	}
 
+	for category, catResult := range result.Summary {
+		switch catResult.Status {
+		case "deleted":
+			result.DeletedCategories = append(result.DeletedCategories, category)
+		case "failed":
+			result.Failures = append(result.Failures, fmt.Sprintf("%s: %s", category, catResult.Reason))
+		default:
+			result.RetainedCategories = append(result.RetainedCategories, category)
+		}
+	}
+	sort.Strings(result.DeletedCategories)
+	sort.Strings(result.RetainedCategories)
+	sort.Strings(result.Failures)
+
 	result.CompletedAt = time.Now()
+	result.Verified = len(result.Failures) == 0
+	if result.Verified {
+		certificate, err := d.certify(result)
+		if err != nil {
+			return nil, err
+		}
+		result.Certificate = certificate
+	}
 	return result, nil
 }
 
-func (d *Deleter) deleteFromLocation(ctx context.Context, userID string, loc DataLocation) CategoryResult {
-	// Financial records and legal compliance data are typically retained
-	retainedCategories := map[string]string{
-		"financial_records": "Required for tax/legal compliance",
-		"audit_logs":        "Required for regulatory compliance",
+func (d *Deleter) deleteFromLocation(ctx context.Context, userID string, loc DataLocation, held map[string]bool) CategoryResult {
+	if reason, retained := retainedCategories[loc.Category]; retained {
+		return CategoryResult{Status: "retained", Reason: reason}
 	}
 
-	if reason, retained := retainedCategories[loc.Category]; retained {
-		return CategoryResult{
-			RecordsDeleted: 0,
-			Status:         "retained",
-			Reason:         reason,
+	if d.holds != nil {
+		onHold, checked := held[loc.Category]
+		if !checked {
+			var err error
+			onHold, err = d.holds.IsDataUnderLegalHold(ctx, userID, loc.Category)
+			if err != nil {
+				return CategoryResult{Status: "failed", Reason: fmt.Sprintf("checking legal hold: %v", err)}
+			}
+			held[loc.Category] = onHold
+		}
+		if onHold {
+			return CategoryResult{Status: "held", Reason: "Under an active legal hold"}
 		}
 	}
 
+	provider, ok := d.discoverer.Provider(loc.Source)
+	if !ok {
+		return CategoryResult{Status: "failed", Reason: fmt.Sprintf("no provider registered for %s", loc.Source)}
+	}
+
 	log.Printf("deleting %s data for user %s from %s", loc.Category, userID, loc.Source)
+	erasure, err := provider.Erase(ctx, userID, loc.Category)
+	if errors.Is(err, ErrNotErasable) {
+		return CategoryResult{Status: "retained", Reason: err.Error()}
+	}
+	if err != nil {
+		return CategoryResult{Status: "failed", Reason: err.Error()}
+	}
+
+	catResult := CategoryResult{
+		RecordsDeleted:    erasure.RecordsDeleted,
+		RecordsAnonymized: erasure.RecordsAnonymized,
+		ObjectsDeleted:    erasure.ObjectsDeleted,
+		Status:            "deleted",
+	}
+	if len(erasure.ObjectKeys) > 0 {
+		catResult.Status = "failed"
+		catResult.Reason = fmt.Sprintf("%d stored files in %s could not be deleted", len(erasure.ObjectKeys), loc.Source)
+	}
+	return catResult
+}
 
-	return CategoryResult{
-		RecordsDeleted: loc.RecordCount,
-		Status:         "deleted",
+// mergeCategoryResults combines the results of the providers sharing a
+// category. A failure outranks a hold or retention, which outrank deletion.
+func mergeCategoryResults(current, next CategoryResult, source string) CategoryResult {
+	rank := map[string]int{"": 0, "deleted": 1, "retained": 2, "held": 3, "failed": 4}
+	merged := current
+	merged.RecordsDeleted += next.RecordsDeleted
+	merged.RecordsAnonymized += next.RecordsAnonymized
+	merged.ObjectsDeleted += next.ObjectsDeleted
+	merged.Sources = append(merged.Sources, source)
+	if rank[next.Status] > rank[current.Status] {
+		merged.Status = next.Status
+		merged.Reason = next.Reason
+	}
+	return merged
+}
+
+// certify issues the deletion certificate: a token proving erasure plus a
+// SHA-256 digest over what was erased and retained.
+func (d *Deleter) certify(result *DeletionResult) (*DeletionCertificate, error) {
+	token, err := d.certifier.CreateDeletionToken(result.UserID, "user")
+	if err != nil {
+		return nil, fmt.Errorf("issuing deletion certificate: %w", err)
+	}
+	certificate := &DeletionCertificate{
+		Token:              token,
+		UserID:             result.UserID,
+		IssuedAt:           result.CompletedAt.UTC(),
+		DeletedCategories:  result.DeletedCategories,
+		RetainedCategories: result.RetainedCategories,
+		IndexEntriesPurged: result.IndexEntriesPurged,
+	}
+	for _, catResult := range result.Summary {
+		certificate.RecordsDeleted += catResult.RecordsDeleted
+		certificate.RecordsAnonymized += catResult.RecordsAnonymized
+		certificate.ObjectsDeleted += catResult.ObjectsDeleted
+	}
+	payload, err := json.Marshal(struct {
+		Certificate *DeletionCertificate      `json:"certificate"`
+		Summary     map[string]CategoryResult `json:"summary"`
+	}{certificate, result.Summary})
+	if err != nil {
+		return nil, fmt.Errorf("issuing deletion certificate: %w", err)
 	}
+	sum := sha256.Sum256(payload)
+	certificate.Digest = hex.EncodeToString(sum[:])
+	return certificate, nil
 }
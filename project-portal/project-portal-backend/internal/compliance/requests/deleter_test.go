@@ -0,0 +1,89 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeHolds map[string]bool
+
+func (h fakeHolds) IsDataUnderLegalHold(ctx context.Context, userID, dataCategory string) (bool, error) {
+	return h[dataCategory], nil
+}
+
+type fakePurger struct {
+	purged int64
+	err    error
+}
+
+func (p *fakePurger) PurgeUserEntries(ctx context.Context, userID string) (int64, error) {
+	return p.purged, p.err
+}
+
+func TestDeleteErasesVerifiesAndCertifies(t *testing.T) {
+	settings := &fakeProvider{name: "settings", locations: []DataLocation{
+		{Source: "settings", Category: CategoryUserProfile, RecordCount: 3, ObjectCount: 2},
+		{Source: "settings", Category: CategoryFinancialRecords, RecordCount: 5},
+	}, removed: &ErasureResult{RecordsDeleted: 3, ObjectsDeleted: 2}}
+	collaboration := &fakeProvider{name: "collaboration", locations: []DataLocation{
+		{Source: "collaboration", Category: CategoryProjectData, RecordCount: 4},
+		{Source: "collaboration", Category: CategorySystemLogs, RecordCount: 1},
+	}, removed: &ErasureResult{RecordsAnonymized: 4}}
+	d := NewDiscoverer(settings, collaboration)
+	purger := &fakePurger{purged: 7}
+	deleter := NewDeleter(d, fakeHolds{CategorySystemLogs: true}, purger)
+
+	locations, err := d.DiscoverUserData(context.Background(), "user-0001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := deleter.Delete(context.Background(), "user-0001", locations)
+	if err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if !result.Verified || result.Certificate == nil {
+		t.Fatalf("expected a verified erasure with a certificate, got %+v", result)
+	}
+	if strings.Join(result.DeletedCategories, ",") != "project_data,user_profile" {
+		t.Fatalf("unexpected deleted categories %v", result.DeletedCategories)
+	}
+	if result.Summary[CategoryFinancialRecords].Status != "retained" || result.Summary[CategorySystemLogs].Status != "held" {
+		t.Fatalf("expected financial records retained and logs held, got %+v", result.Summary)
+	}
+	if settings.erased[CategoryFinancialRecords] || collaboration.erased[CategorySystemLogs] {
+		t.Fatalf("retained and held data must not reach the provider")
+	}
+	cert := result.Certificate
+	if !strings.HasPrefix(cert.Token, "del_user_user-000") || cert.RecordsDeleted != 3 || cert.RecordsAnonymized != 4 ||
+		cert.ObjectsDeleted != 2 || cert.IndexEntriesPurged != 7 || len(cert.Digest) != 64 {
+		t.Fatalf("unexpected certificate %+v", cert)
+	}
+}
+
+func TestDeleteFailsWhenDataRemains(t *testing.T) {
+	documents := &fakeProvider{name: "documents", locations: []DataLocation{
+		{Source: "documents", Category: CategoryProjectData, RecordCount: 2, ObjectCount: 2},
+	}, faulty: true}
+	reports := &fakeProvider{name: "reports", locations: []DataLocation{
+		{Source: "reports", Category: CategoryUserProfile, RecordCount: 1, ObjectCount: 1},
+	}, removed: &ErasureResult{RecordsDeleted: 1, ObjectKeys: []string{"reports/export.ndjson"}}}
+	d := NewDiscoverer(documents, reports)
+	deleter := NewDeleter(d, nil, &fakePurger{err: errors.New("index unavailable")})
+
+	locations, _ := d.DiscoverUserData(context.Background(), "user-0001", nil)
+	result, err := deleter.Delete(context.Background(), "user-0001", locations)
+	if err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if result.Verified || result.Certificate != nil {
+		t.Fatalf("expected no certificate when erasure is incomplete")
+	}
+	if result.Summary[CategoryProjectData].Status != "failed" || result.Summary[CategoryUserProfile].Status != "failed" {
+		t.Fatalf("expected remaining rows and undeleted files to fail, got %+v", result.Summary)
+	}
+	if len(result.Failures) != 3 {
+		t.Fatalf("expected the index failure to be reported too, got %v", result.Failures)
+	}
+}
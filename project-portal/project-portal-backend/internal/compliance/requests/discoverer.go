@@ -2,48 +2,40 @@ package requests
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 )
 
-// Discoverer locates all user data across distributed systems.
+// Discoverer locates all user data across the modules that registered a
+// data provider.
 type Discoverer struct {
-	dataSources []DataSource
-}
-
-// DataSource represents a system that may contain user data.
-type DataSource struct {
-	Name       string
-	Type       string // "database", "file_storage", "cache", "log"
-	Categories []string
+	mu        sync.RWMutex
+	providers []Provider
 }
 
 // DataLocation describes where user data was found.
 type DataLocation struct {
-	Source      string `json:"source"`
-	Category    string `json:"category"`
-	RecordCount int64  `json:"record_count"`
-	Description string `json:"description"`
-}
-
-// NewDiscoverer creates a new data discoverer with default data source registry.
-func NewDiscoverer() *Discoverer {
-	return &Discoverer{
-		dataSources: defaultDataSources(),
-	}
+	Source      string   `json:"source"`
+	Category    string   `json:"category"`
+	RecordCount int64    `json:"record_count"`
+	ObjectCount int64    `json:"object_count"`
+	Tables      []string `json:"tables,omitempty"`
+	Description string   `json:"description"`
 }
 
-func defaultDataSources() []DataSource {
-	return []DataSource{
-		{Name: "users_db", Type: "database", Categories: []string{"user_profile"}},
-		{Name: "projects_db", Type: "database", Categories: []string{"project_data"}},
-		{Name: "financial_db", Type: "database", Categories: []string{"financial_records"}},
-		{Name: "activity_logs", Type: "database", Categories: []string{"system_logs"}},
-		{Name: "file_storage", Type: "file_storage", Categories: []string{"user_profile", "project_data"}},
-		{Name: "cache", Type: "cache", Categories: []string{"user_profile"}},
+// NewDiscoverer creates a new data discoverer over the given providers.
+func NewDiscoverer(providers ...Provider) *Discoverer {
+	d := &Discoverer{}
+	for _, p := range providers {
+		d.RegisterProvider(p)
 	}
+	return d
 }
 
-// DiscoverUserData finds all data for a user, optionally filtered by categories.
+// DiscoverUserData finds all data for a user, optionally filtered by
+// categories. Every provider is asked; if any fails discovery fails, so a
+// result is never silently incomplete. Locations holding nothing are left out.
 func (d *Discoverer) DiscoverUserData(ctx context.Context, userID string, categories []string) ([]DataLocation, error) {
 	log.Printf("discovering data for user %s (categories: %v)", userID, categories)
 
@@ -53,29 +45,69 @@ func (d *Discoverer) DiscoverUserData(ctx context.Context, userID string, catego
 	}
 
 	var locations []DataLocation
-	for _, source := range d.dataSources {
-		for _, cat := range source.Categories {
-			if len(categoryFilter) > 0 && !categoryFilter[cat] {
+	for _, provider := range d.Providers() {
+		found, err := provider.Locate(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("locating data in %s: %w", provider.Name(), err)
+		}
+		for _, loc := range found {
+			if len(categoryFilter) > 0 && !categoryFilter[loc.Category] {
+				continue
+			}
+			if loc.RecordCount == 0 && loc.ObjectCount == 0 {
 				continue
 			}
-			locations = append(locations, DataLocation{
-				Source:      source.Name,
-				Category:    cat,
-				RecordCount: 0,
-				Description: source.Type + " records in " + source.Name,
-			})
+			locations = append(locations, loc)
 		}
 	}
 
 	return locations, nil
 }
 
-// RegisterDataSource adds a new data source to the discoverer.
-func (d *Discoverer) RegisterDataSource(source DataSource) {
-	d.dataSources = append(d.dataSources, source)
+// RegisterProvider adds a module's data provider. A provider registered
+// under an existing name replaces it.
+func (d *Discoverer) RegisterProvider(provider Provider) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, p := range d.providers {
+		if p.Name() == provider.Name() {
+			d.providers[i] = provider
+			return
+		}
+	}
+	d.providers = append(d.providers, provider)
 }
 
-// ListDataSources returns all registered data sources.
-func (d *Discoverer) ListDataSources() []DataSource {
-	return d.dataSources
+// Provider returns the provider registered under name.
+func (d *Discoverer) Provider(name string) (Provider, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.providers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Providers returns all registered providers in registration order.
+func (d *Discoverer) Providers() []Provider {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]Provider(nil), d.providers...)
+}
+
+// Categories returns every category some provider holds.
+func (d *Discoverer) Categories() []string {
+	var categories []string
+	seen := make(map[string]bool)
+	for _, p := range d.Providers() {
+		for _, c := range p.Categories() {
+			if !seen[c] {
+				seen[c] = true
+				categories = append(categories, c)
+			}
+		}
+	}
+	return categories
 }
@@ -0,0 +1,91 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeProvider struct {
+	name      string
+	locations []DataLocation
+	records   map[string]interface{}
+	err       error
+	// erased categories are no longer located unless the erasure is faulty
+	erased  map[string]bool
+	faulty  bool
+	removed *ErasureResult
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+func (p *fakeProvider) Categories() []string {
+	var categories []string
+	for _, loc := range p.locations {
+		categories = append(categories, loc.Category)
+	}
+	return categories
+}
+func (p *fakeProvider) Locate(ctx context.Context, userID string) ([]DataLocation, error) {
+	var locations []DataLocation
+	for _, loc := range p.locations {
+		if !p.erased[loc.Category] || p.faulty {
+			locations = append(locations, loc)
+		}
+	}
+	return locations, p.err
+}
+func (p *fakeProvider) Export(ctx context.Context, userID, category string) (interface{}, error) {
+	return p.records[category], nil
+}
+func (p *fakeProvider) Erase(ctx context.Context, userID, category string) (*ErasureResult, error) {
+	if p.erased == nil {
+		p.erased = make(map[string]bool)
+	}
+	p.erased[category] = true
+	if p.removed != nil {
+		return p.removed, nil
+	}
+	return &ErasureResult{}, nil
+}
+
+func TestDiscoverUserDataAcrossProviders(t *testing.T) {
+	settings := &fakeProvider{name: "settings", locations: []DataLocation{
+		{Source: "settings", Category: CategoryUserProfile, RecordCount: 3, ObjectCount: 4},
+		{Source: "settings", Category: CategoryFinancialRecords},
+	}, records: map[string]interface{}{CategoryUserProfile: []string{"profile"}}}
+	documents := &fakeProvider{name: "documents", locations: []DataLocation{
+		{Source: "documents", Category: CategoryProjectData, RecordCount: 2, ObjectCount: 2},
+	}}
+	d := NewDiscoverer(settings, documents)
+
+	locations, err := d.DiscoverUserData(context.Background(), "user-1", nil)
+	if err != nil {
+		t.Fatalf("DiscoverUserData error: %v", err)
+	}
+	if len(locations) != 2 || locations[0].Category != CategoryUserProfile || locations[1].Source != "documents" {
+		t.Fatalf("expected the two non-empty locations, got %+v", locations)
+	}
+	if got := d.Categories(); len(got) != 3 {
+		t.Fatalf("expected every provider category, got %v", got)
+	}
+
+	filtered, err := d.DiscoverUserData(context.Background(), "user-1", []string{CategoryProjectData})
+	if err != nil || len(filtered) != 1 || filtered[0].RecordCount != 2 {
+		t.Fatalf("expected only project data, got %+v %v", filtered, err)
+	}
+
+	result, err := NewExporter(d).Export(context.Background(), "user-1", locations, "json")
+	if err != nil || result.SizeBytes == 0 || result.FileHash == "" {
+		t.Fatalf("expected an export with content, got %+v %v", result, err)
+	}
+
+	// Registering under an existing name replaces the provider, and a failing
+	// provider fails discovery rather than leaving its data out
+	d.RegisterProvider(&fakeProvider{name: "documents", err: errors.New("database unavailable")})
+	if len(d.Providers()) != 2 {
+		t.Fatalf("expected the provider to be replaced, got %d", len(d.Providers()))
+	}
+	if _, err := d.DiscoverUserData(context.Background(), "user-1", nil); err == nil {
+		t.Fatalf("expected discovery to fail when a provider fails")
+	}
+}
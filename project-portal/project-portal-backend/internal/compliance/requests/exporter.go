@@ -26,18 +26,28 @@ func (e *Exporter) Export(ctx context.Context, userID string, locations []DataLo
 	exportData := make(map[string]interface{})
 	exportData["user_id"] = userID
 	exportData["export_date"] = time.Now().Format(time.RFC3339)
-	exportData["data_categories"] = make(map[string]interface{})
+	categoryData := make(map[string]interface{})
+	exportData["data_categories"] = categoryData
 
 	for _, loc := range locations {
-		categoryData, ok := exportData["data_categories"].(map[string]interface{})
+		sources, ok := categoryData[loc.Category].(map[string]interface{})
 		if !ok {
-			continue
+			sources = make(map[string]interface{})
+			categoryData[loc.Category] = sources
 		}
-		categoryData[loc.Category] = map[string]interface{}{
-			"source":       loc.Source,
+		entry := map[string]interface{}{
 			"record_count": loc.RecordCount,
+			"object_count": loc.ObjectCount,
 			"description":  loc.Description,
 		}
+		if provider, ok := e.discoverer.Provider(loc.Source); ok {
+			records, err := provider.Export(ctx, userID, loc.Category)
+			if err != nil {
+				return nil, fmt.Errorf("exporting %s from %s: %w", loc.Category, loc.Source, err)
+			}
+			entry["records"] = records
+		}
+		sources[loc.Source] = entry
 	}
 
 	data, err := json.MarshalIndent(exportData, "", "  ")
@@ -53,6 +63,7 @@ func (e *Exporter) Export(ctx context.Context, userID string, locations []DataLo
 		FileHash:    fmt.Sprintf("%x", hash),
 		Format:      format,
 		SizeBytes:   int64(len(data)),
+		Data:        data,
 		CompletedAt: time.Now(),
 	}, nil
 }
@@ -0,0 +1,67 @@
+package requests
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// packageMagic prefixes sealed export packages so a reader can recognise
+// the format and version
+const packageMagic = "CSPKG1"
+
+var ErrInvalidPackage = errors.New("export package is malformed or the key is wrong")
+
+// SealPackage encrypts an export with AES-256-GCM under a fresh random key.
+// The key is returned base64 encoded and is never stored: it is given to the
+// requester, who alone can open the package.
+func SealPackage(data []byte) (sealed []byte, key string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("generating package key: %w", err)
+	}
+	gcm, err := packageAEAD(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("generating package nonce: %w", err)
+	}
+
+	sealed = append([]byte(packageMagic), nonce...)
+	sealed = gcm.Seal(sealed, nonce, data, []byte(packageMagic))
+	return sealed, base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// OpenPackage decrypts a package sealed by SealPackage.
+func OpenPackage(sealed []byte, key string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, ErrInvalidPackage
+	}
+	gcm, err := packageAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	header := len(packageMagic) + gcm.NonceSize()
+	if len(sealed) < header || string(sealed[:len(packageMagic)]) != packageMagic {
+		return nil, ErrInvalidPackage
+	}
+	data, err := gcm.Open(nil, sealed[len(packageMagic):header], sealed[header:], []byte(packageMagic))
+	if err != nil {
+		return nil, ErrInvalidPackage
+	}
+	return data, nil
+}
+
+func packageAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating package cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -22,13 +22,14 @@ type Processor struct {
 	verifier   *Verifier
 }
 
-// NewProcessor creates a new request processor with all sub-components.
-func NewProcessor(repo interface{}) *Processor {
-	discoverer := NewDiscoverer()
+// NewProcessor creates a new request processor with all sub-components,
+// working on the data of the providers registered with discoverer. Erasure
+// honours holds and purges search entries through purgers.
+func NewProcessor(repo interface{}, discoverer *Discoverer, holds LegalHoldChecker, purgers ...IndexPurger) *Processor {
 	return &Processor{
 		repo:       repo,
 		exporter:   NewExporter(discoverer),
-		deleter:    NewDeleter(discoverer),
+		deleter:    NewDeleter(discoverer, holds, purgers...),
 		discoverer: discoverer,
 		verifier:   NewVerifier(),
 	}
@@ -70,11 +71,13 @@ func (p *Processor) ProcessDeletionRequest(ctx context.Context, userID string, c
 
 // ExportResult captures the outcome of a data export operation.
 type ExportResult struct {
-	UserID      string    `json:"user_id"`
-	FileURL     string    `json:"file_url"`
-	FileHash    string    `json:"file_hash"`
-	Format      string    `json:"format"`
-	SizeBytes   int64     `json:"size_bytes"`
+	UserID    string `json:"user_id"`
+	FileURL   string `json:"file_url"`
+	FileHash  string `json:"file_hash"`
+	Format    string `json:"format"`
+	SizeBytes int64  `json:"size_bytes"`
+	// Data is the export document itself, for packaging and upload
+	Data        []byte    `json:"-"`
 	CompletedAt time.Time `json:"completed_at"`
 }
 
@@ -84,12 +87,35 @@ type DeletionResult struct {
 	DeletedCategories  []string                  `json:"deleted_categories"`
 	RetainedCategories []string                  `json:"retained_categories"`
 	Summary            map[string]CategoryResult `json:"summary"`
+	IndexEntriesPurged int64                     `json:"index_entries_purged"`
+	Failures           []string                  `json:"failures,omitempty"`
+	Verified           bool                      `json:"verified"`
+	Certificate        *DeletionCertificate      `json:"certificate,omitempty"`
 	CompletedAt        time.Time                 `json:"completed_at"`
 }
 
 // CategoryResult holds the result for a single data category deletion.
+// Status is deleted, retained, held or failed.
 type CategoryResult struct {
-	RecordsDeleted int64  `json:"records_deleted"`
-	Status         string `json:"status"`
-	Reason         string `json:"reason,omitempty"`
+	RecordsDeleted    int64    `json:"records_deleted"`
+	RecordsAnonymized int64    `json:"records_anonymized"`
+	ObjectsDeleted    int64    `json:"objects_deleted"`
+	Sources           []string `json:"sources,omitempty"`
+	Status            string   `json:"status"`
+	Reason            string   `json:"reason,omitempty"`
+}
+
+// DeletionCertificate proves a verified erasure. Digest is the SHA-256 of
+// the certificate and per-category summary it was issued for.
+type DeletionCertificate struct {
+	Token              string    `json:"token"`
+	UserID             string    `json:"user_id"`
+	IssuedAt           time.Time `json:"issued_at"`
+	DeletedCategories  []string  `json:"deleted_categories"`
+	RetainedCategories []string  `json:"retained_categories"`
+	RecordsDeleted     int64     `json:"records_deleted"`
+	RecordsAnonymized  int64     `json:"records_anonymized"`
+	ObjectsDeleted     int64     `json:"objects_deleted"`
+	IndexEntriesPurged int64     `json:"index_entries_purged"`
+	Digest             string    `json:"digest,omitempty"`
 }
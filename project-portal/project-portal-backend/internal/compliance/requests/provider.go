@@ -0,0 +1,282 @@
+package requests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Data categories providers file user data under. Legal holds and retention
+// policies refer to the same names.
+const (
+	CategoryUserProfile       = "user_profile"
+	CategoryProjectData       = "project_data"
+	CategoryFinancialRecords  = "financial_records"
+	CategorySystemLogs        = "system_logs"
+	CategoryAuditLogs         = "audit_logs"
+	CategoryComplianceRecords = "compliance_records"
+)
+
+// ErasedUserID replaces user references in rows that are anonymised rather
+// than deleted
+const ErasedUserID = "00000000-0000-0000-0000-000000000000"
+
+var (
+	ErrUnknownCategory = errors.New("provider holds no data in this category")
+	ErrNotErasable     = errors.New("data in this category cannot be erased")
+)
+
+// Provider finds, exports and erases the data one module holds about a
+// user. Each module registers a provider with the Discoverer at startup.
+type Provider interface {
+	// Name identifies the provider, usually the module name
+	Name() string
+	// Categories lists the data categories the provider holds
+	Categories() []string
+	// Locate counts the user's rows and stored objects per category
+	Locate(ctx context.Context, userID string) ([]DataLocation, error)
+	// Export returns the user's data in a category, ready to marshal as JSON
+	Export(ctx context.Context, userID, category string) (interface{}, error)
+	// Erase deletes or anonymises the user's data in a category, including
+	// stored objects
+	Erase(ctx context.Context, userID, category string) (*ErasureResult, error)
+}
+
+// ErasureResult counts what a provider erased. ObjectKeys lists stored
+// objects whose rows were erased but which could not be deleted.
+type ErasureResult struct {
+	RecordsDeleted    int64    `json:"records_deleted"`
+	RecordsAnonymized int64    `json:"records_anonymized"`
+	ObjectsDeleted    int64    `json:"objects_deleted"`
+	ObjectKeys        []string `json:"object_keys,omitempty"`
+}
+
+// ObjectStore deletes stored files; S3Client satisfies it
+type ObjectStore interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// Table describes user data a provider keeps in one database table
+type Table struct {
+	Name     string
+	Category string
+	// Label names the rows in exports and locations when a table is listed
+	// more than once; it defaults to Name
+	Label string
+	// Where selects the user's rows, with @user bound to the user ID
+	Where string
+	// Exclude lists columns never exported, such as hashes and secrets
+	Exclude []string
+	// Anonymize, when set, erases by updating the user's rows with these
+	// values instead of deleting them. Used for rows other users depend on.
+	Anonymize map[string]interface{}
+	// ObjectKeys is an SQL expression selecting the storage keys of files
+	// belonging to a row, e.g. a key column or jsonb_array_elements_text()
+	ObjectKeys string
+	// Immutable tables are located and exported but never erased
+	Immutable bool
+}
+
+// TableProvider is a Provider over database tables, which is how every
+// module keeps its data. Tables of a category are erased in order, so list
+// dependent rows before the rows they reference.
+type TableProvider struct {
+	name   string
+	db     *gorm.DB
+	store  ObjectStore
+	tables []Table
+}
+
+// NewTableProvider creates a provider over tables. store may be nil, in which
+// case erased rows' objects are reported in ErasureResult.ObjectKeys.
+func NewTableProvider(name string, db *gorm.DB, store ObjectStore, tables ...Table) *TableProvider {
+	return &TableProvider{name: name, db: db, store: store, tables: tables}
+}
+
+func (p *TableProvider) Name() string {
+	return p.name
+}
+
+func (p *TableProvider) Categories() []string {
+	var categories []string
+	seen := make(map[string]bool)
+	for _, t := range p.tables {
+		if !seen[t.Category] {
+			seen[t.Category] = true
+			categories = append(categories, t.Category)
+		}
+	}
+	return categories
+}
+
+func (p *TableProvider) Locate(ctx context.Context, userID string) ([]DataLocation, error) {
+	var locations []DataLocation
+	index := make(map[string]int)
+	for _, t := range p.tables {
+		var count int64
+		if err := p.userRows(ctx, p.db, t, userID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("counting %s: %w", t.Name, err)
+		}
+		keys, err := p.objectKeys(ctx, p.db, t, userID)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[t.Category]
+		if !ok {
+			i = len(locations)
+			index[t.Category] = i
+			locations = append(locations, DataLocation{Source: p.name, Category: t.Category})
+		}
+		locations[i].RecordCount += count
+		locations[i].ObjectCount += int64(len(keys))
+		if count > 0 {
+			locations[i].Tables = append(locations[i].Tables, t.Name)
+		}
+	}
+	for i := range locations {
+		locations[i].Description = describeLocation(locations[i])
+	}
+	return locations, nil
+}
+
+// Export returns the user's rows in a category keyed by table
+func (p *TableProvider) Export(ctx context.Context, userID, category string) (interface{}, error) {
+	tables := p.categoryTables(category)
+	if len(tables) == 0 {
+		return nil, ErrUnknownCategory
+	}
+	data := make(map[string]interface{}, len(tables))
+	for _, t := range tables {
+		var rows []map[string]interface{}
+		if err := p.userRows(ctx, p.db, t, userID).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", t.Name, err)
+		}
+		for _, row := range rows {
+			for _, col := range t.Exclude {
+				delete(row, col)
+			}
+			for col, v := range row {
+				// jsonb and array columns scan as bytes
+				if b, ok := v.([]byte); ok {
+					row[col] = string(b)
+				}
+			}
+		}
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		data[t.label()] = rows
+	}
+	return data, nil
+}
+
+// Erase deletes or anonymises the category's rows in one transaction, then
+// deletes the objects that belonged to them
+func (p *TableProvider) Erase(ctx context.Context, userID, category string) (*ErasureResult, error) {
+	tables := p.categoryTables(category)
+	if len(tables) == 0 {
+		return nil, ErrUnknownCategory
+	}
+	for _, t := range tables {
+		if t.Immutable {
+			return nil, fmt.Errorf("%w: %s", ErrNotErasable, t.Name)
+		}
+	}
+
+	result := &ErasureResult{}
+	var keys []string
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range tables {
+			tableKeys, err := p.objectKeys(ctx, tx, t, userID)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, tableKeys...)
+			if len(t.Anonymize) > 0 {
+				res := p.userRows(ctx, tx, t, userID).Updates(t.Anonymize)
+				if res.Error != nil {
+					return fmt.Errorf("anonymising %s: %w", t.Name, res.Error)
+				}
+				result.RecordsAnonymized += res.RowsAffected
+				continue
+			}
+			res := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE (%s)", t.Name, t.Where), sql.Named("user", userID))
+			if res.Error != nil {
+				return fmt.Errorf("deleting %s: %w", t.Name, res.Error)
+			}
+			result.RecordsDeleted += res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if p.store == nil {
+			result.ObjectKeys = append(result.ObjectKeys, key)
+			continue
+		}
+		if err := p.store.Delete(ctx, key); err != nil {
+			log.Printf("%s: delete object %s: %v", p.name, key, err)
+			result.ObjectKeys = append(result.ObjectKeys, key)
+			continue
+		}
+		result.ObjectsDeleted++
+	}
+	return result, nil
+}
+
+func (t Table) label() string {
+	if t.Label != "" {
+		return t.Label
+	}
+	return t.Name
+}
+
+func (p *TableProvider) categoryTables(category string) []Table {
+	var tables []Table
+	for _, t := range p.tables {
+		if t.Category == category {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+func (p *TableProvider) userRows(ctx context.Context, db *gorm.DB, t Table, userID string) *gorm.DB {
+	return db.WithContext(ctx).Table(t.Name).Where(t.Where, sql.Named("user", userID))
+}
+
+func (p *TableProvider) objectKeys(ctx context.Context, db *gorm.DB, t Table, userID string) ([]string, error) {
+	if t.ObjectKeys == "" {
+		return nil, nil
+	}
+	var values []sql.NullString
+	if err := p.userRows(ctx, db, t, userID).Pluck(t.ObjectKeys, &values).Error; err != nil {
+		return nil, fmt.Errorf("listing objects in %s: %w", t.Name, err)
+	}
+	var keys []string
+	for _, v := range values {
+		if v.Valid && v.String != "" {
+			keys = append(keys, v.String)
+		}
+	}
+	return keys, nil
+}
+
+func describeLocation(loc DataLocation) string {
+	if len(loc.Tables) == 0 {
+		return "no records in " + loc.Source
+	}
+	desc := fmt.Sprintf("%d records in %s", loc.RecordCount, strings.Join(loc.Tables, ", "))
+	if loc.ObjectCount > 0 {
+		desc += fmt.Sprintf(" with %d stored files", loc.ObjectCount)
+	}
+	return desc
+}
@@ -1,7 +1,14 @@
 package requests
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 )
 
@@ -65,3 +72,55 @@ func (v *Verifier) ValidateRequestType(requestType string) error {
 	}
 	return nil
 }
+
+// MaxCodeAttempts is how many wrong one-time codes a request accepts before
+// its verification is refused.
+const MaxCodeAttempts = 5
+
+var (
+	ErrCodeExpired       = errors.New("verification code has expired")
+	ErrCodeMismatch      = errors.New("verification code does not match")
+	ErrTooManyAttempts   = errors.New("too many verification attempts")
+	ErrNoCodeOutstanding = errors.New("no verification code has been issued")
+)
+
+// IssueCode generates a six-digit one-time code for email verification. Only
+// the hash is stored; the code itself is sent to the requester.
+func (v *Verifier) IssueCode() (code, hash string, err error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", fmt.Errorf("generating verification code: %w", err)
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+	return code, hashCode(code), nil
+}
+
+// VerifyCode checks a one-time code against the stored hash. attempts is
+// the number of wrong codes already entered for the request.
+func (v *Verifier) VerifyCode(userID, hash, code string, expiresAt *time.Time, attempts int) (*VerificationResult, error) {
+	result := &VerificationResult{Method: "email_code"}
+	switch {
+	case hash == "" || expiresAt == nil:
+		result.Reason = ErrNoCodeOutstanding.Error()
+		return result, ErrNoCodeOutstanding
+	case attempts >= MaxCodeAttempts:
+		result.Reason = ErrTooManyAttempts.Error()
+		return result, ErrTooManyAttempts
+	case time.Now().After(*expiresAt):
+		result.Reason = ErrCodeExpired.Error()
+		return result, ErrCodeExpired
+	case subtle.ConstantTimeCompare([]byte(hashCode(strings.TrimSpace(code))), []byte(hash)) != 1:
+		result.Reason = ErrCodeMismatch.Error()
+		return result, ErrCodeMismatch
+	}
+
+	result.Verified = true
+	result.VerifiedAt = time.Now()
+	result.VerifiedBy = userID
+	return result, nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package requests
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyCode(t *testing.T) {
+	v := NewVerifier()
+	code, hash, err := v.IssueCode()
+	if err != nil || len(code) != 6 || hash == "" || hash == code {
+		t.Fatalf("expected a six-digit code and its hash, got %q %q %v", code, hash, err)
+	}
+	expires := time.Now().Add(time.Minute)
+
+	if _, err := v.VerifyCode("user-1", hash, "not-it", &expires, 0); !errors.Is(err, ErrCodeMismatch) {
+		t.Fatalf("expected a mismatch, got %v", err)
+	}
+	if _, err := v.VerifyCode("user-1", hash, code, &expires, MaxCodeAttempts); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected the right code to be refused after too many attempts, got %v", err)
+	}
+	past := time.Now().Add(-time.Second)
+	if _, err := v.VerifyCode("user-1", hash, code, &past, 0); !errors.Is(err, ErrCodeExpired) {
+		t.Fatalf("expected an expired code, got %v", err)
+	}
+	if _, err := v.VerifyCode("user-1", "", code, nil, 0); !errors.Is(err, ErrNoCodeOutstanding) {
+		t.Fatalf("expected no outstanding code, got %v", err)
+	}
+
+	result, err := v.VerifyCode("user-1", hash, " "+code+" ", &expires, MaxCodeAttempts-1)
+	if err != nil || !result.Verified || result.Method != "email_code" || result.VerifiedBy != "user-1" {
+		t.Fatalf("expected verification, got %+v %v", result, err)
+	}
+}
+
+func TestSealPackageRoundTrip(t *testing.T) {
+	data := []byte(`{"user_id":"user-1"}`)
+	sealed, key, err := SealPackage(data)
+	if err != nil {
+		t.Fatalf("SealPackage error: %v", err)
+	}
+	if bytes.Contains(sealed, data) {
+		t.Fatalf("expected the package to be encrypted")
+	}
+
+	opened, err := OpenPackage(sealed, key)
+	if err != nil || !bytes.Equal(opened, data) {
+		t.Fatalf("expected the original data, got %q %v", opened, err)
+	}
+
+	_, otherKey, _ := SealPackage(data)
+	if _, err := OpenPackage(sealed, otherKey); !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("expected another key to be refused, got %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := OpenPackage(sealed, key); !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("expected a tampered package to be refused, got %v", err)
+	}
+}
@@ -1,88 +1,637 @@
 package retention
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"path"
+	"strings"
+	"sync"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Retention actions
+const (
+	ActionDelete    = "delete"
+	ActionAnonymize = "anonymize"
+	ActionArchive   = "archive"
+	ActionReview    = "review"
+)
+
+const (
+	defaultBatchSize  = 500
+	defaultBatchPause = 250 * time.Millisecond
+	defaultMaxBatches = 200
+	defaultColdPrefix = "cold-storage"
+	defaultSampleSize = 100
 )
 
+// Config tunes how hard enforcement works the database and object storage.
+type Config struct {
+	// BatchSize is how many rows or objects are handled at a time
+	BatchSize int
+	// BatchPause is the pause between batches
+	BatchPause time.Duration
+	// MaxBatches limits the batches per target in one run; what is left is
+	// handled by the next run
+	MaxBatches int
+	// ColdPrefix is the storage prefix archives are moved under
+	ColdPrefix string
+	// SampleSize is how many IDs per target a dry run lists
+	SampleSize int
+}
+
+// Plan describes one retention action over a data category.
+type Plan struct {
+	PolicyID string
+	Category string
+	Action   string
+	// Method is the policy's deletion method. Deleting under the anonymize or
+	// pseudonymize methods anonymises instead.
+	Method    string
+	OlderThan time.Time
+	// Rules map columns to Anonymizer rules such as hash, email or redact
+	Rules map[string]string
+	// IgnoreHolds skips legal hold checks, for policies that opted out
+	IgnoreHolds bool
+	// ArchivedAfterDays is the policy's archival period. Deletion then also
+	// expires archives the policy moved to cold storage.
+	ArchivedAfterDays int
+	// DryRun reports what the action would affect without changing anything
+	DryRun bool
+}
+
 // Enforcer executes retention actions (archive, anonymize, delete) on data.
 type Enforcer struct {
+	db         *gorm.DB
+	store      ObjectStore
+	holds      HoldChecker
 	anonymizer *Anonymizer
+	cfg        Config
+
+	mu      sync.RWMutex
+	targets []Target
 }
 
-// NewEnforcer creates a new retention enforcer.
-func NewEnforcer(anonymizer *Anonymizer) *Enforcer {
-	return &Enforcer{anonymizer: anonymizer}
+// NewEnforcer creates a new retention enforcer over the given targets. store
+// may be nil, in which case targets with stored files and archival are
+// skipped; holds may be nil when legal holds are enforced elsewhere.
+func NewEnforcer(db *gorm.DB, store ObjectStore, holds HoldChecker, anonymizer *Anonymizer, cfg Config, targets ...Target) *Enforcer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.BatchPause < 0 {
+		cfg.BatchPause = 0
+	} else if cfg.BatchPause == 0 {
+		cfg.BatchPause = defaultBatchPause
+	}
+	if cfg.MaxBatches <= 0 {
+		cfg.MaxBatches = defaultMaxBatches
+	}
+	if cfg.ColdPrefix == "" {
+		cfg.ColdPrefix = defaultColdPrefix
+	}
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = defaultSampleSize
+	}
+	if anonymizer == nil {
+		anonymizer = NewAnonymizer()
+	}
+	return &Enforcer{db: db, store: store, holds: holds, anonymizer: anonymizer, cfg: cfg, targets: targets}
+}
+
+// RegisterTargets adds data that retention policies apply to.
+func (e *Enforcer) RegisterTargets(targets ...Target) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.targets = append(e.targets, targets...)
+}
+
+// Targets returns the registered targets of a category.
+func (e *Enforcer) Targets(category string) []Target {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var targets []Target
+	for _, t := range e.targets {
+		if t.Category == category {
+			targets = append(targets, t)
+		}
+	}
+	return targets
 }
 
 // EnforceAction executes the specified retention action on a data set.
 func (e *Enforcer) EnforceAction(ctx context.Context, action, dataType string, olderThan time.Time) (*EnforcementResult, error) {
-	switch action {
-	case "delete":
-		return e.executeDelete(ctx, dataType, olderThan)
-	case "anonymize":
-		return e.executeAnonymize(ctx, dataType, olderThan)
-	case "archive":
-		return e.executeArchive(ctx, dataType, olderThan)
-	case "review":
-		return e.executeReview(ctx, dataType, olderThan)
+	return e.EnforcePolicy(ctx, Plan{Category: dataType, Action: action, OlderThan: olderThan})
+}
+
+// EnforcePolicy carries out a plan on every target of its category. Rows and
+// objects older than the plan's cutoff are handled in throttled batches,
+// leaving out data under legal hold. A failing target does not stop the
+// others; its error is reported in the result.
+func (e *Enforcer) EnforcePolicy(ctx context.Context, plan Plan) (*EnforcementResult, error) {
+	switch plan.Action {
+	case ActionDelete:
+		if plan.Method == "anonymize" || plan.Method == "pseudonymize" {
+			plan.Action = ActionAnonymize
+		}
+	case ActionAnonymize, ActionArchive, ActionReview:
 	default:
-		return nil, fmt.Errorf("unknown action: %s", action)
-	}
-}
-
-func (e *Enforcer) executeDelete(ctx context.Context, dataType string, olderThan time.Time) (*EnforcementResult, error) {
-	log.Printf("enforcing deletion for %s older than %v", dataType, olderThan)
-	return &EnforcementResult{
-		Action:          "delete",
-		DataType:        dataType,
-		RecordsAffected: 0,
-		CompletedAt:     time.Now(),
-		Status:          "completed",
-	}, nil
-}
-
-func (e *Enforcer) executeAnonymize(ctx context.Context, dataType string, olderThan time.Time) (*EnforcementResult, error) {
-	log.Printf("enforcing anonymization for %s older than %v", dataType, olderThan)
-	return &EnforcementResult{
-		Action:          "anonymize",
-		DataType:        dataType,
-		RecordsAffected: 0,
-		CompletedAt:     time.Now(),
-		Status:          "completed",
-	}, nil
-}
-
-func (e *Enforcer) executeArchive(ctx context.Context, dataType string, olderThan time.Time) (*EnforcementResult, error) {
-	log.Printf("enforcing archival for %s older than %v", dataType, olderThan)
-	return &EnforcementResult{
-		Action:          "archive",
-		DataType:        dataType,
-		RecordsAffected: 0,
-		CompletedAt:     time.Now(),
-		Status:          "completed",
-	}, nil
-}
-
-func (e *Enforcer) executeReview(ctx context.Context, dataType string, olderThan time.Time) (*EnforcementResult, error) {
-	log.Printf("flagging %s for review (older than %v)", dataType, olderThan)
-	return &EnforcementResult{
-		Action:          "review",
-		DataType:        dataType,
-		RecordsAffected: 0,
-		CompletedAt:     time.Now(),
-		Status:          "pending_review",
-	}, nil
+		return nil, fmt.Errorf("unknown action: %s", plan.Action)
+	}
+
+	if plan.DryRun {
+		log.Printf("previewing %s for %s older than %v", plan.Action, plan.Category, plan.OlderThan)
+	} else {
+		log.Printf("enforcing %s for %s older than %v", plan.Action, plan.Category, plan.OlderThan)
+	}
+
+	result := &EnforcementResult{
+		PolicyID:  plan.PolicyID,
+		Action:    plan.Action,
+		DataType:  plan.Category,
+		OlderThan: plan.OlderThan,
+		DryRun:    plan.DryRun,
+		Status:    "completed",
+	}
+
+	targets := e.Targets(plan.Category)
+	cutoffs := make([]time.Time, len(targets))
+	for i := range targets {
+		cutoffs[i] = plan.OlderThan
+	}
+	if plan.Action == ActionDelete && plan.ArchivedAfterDays > 0 {
+		// Archives hold data that was already ArchivedAfterDays old when it
+		// was moved, so they expire that much sooner
+		targets = append(targets, Target{Category: plan.Category, Prefix: e.coldPrefix(plan.Category) + "/"})
+		cutoffs = append(cutoffs, plan.OlderThan.AddDate(0, 0, plan.ArchivedAfterDays))
+	}
+	if len(targets) == 0 {
+		result.Status = "skipped"
+		result.ErrorMessage = "no data is registered for this category"
+		result.CompletedAt = time.Now()
+		return result, nil
+	}
+
+	var categoryHeld bool
+	var heldUsers []string
+	if !plan.IgnoreHolds && e.holds != nil {
+		var err error
+		categoryHeld, heldUsers, err = e.holds.LegalHoldScope(ctx, plan.Category)
+		if err != nil {
+			return nil, fmt.Errorf("checking legal holds: %w", err)
+		}
+	}
+
+	var failures []string
+	for i, t := range targets {
+		var tr TargetResult
+		if t.Table != "" {
+			tr = e.enforceTable(ctx, plan, t, cutoffs[i], categoryHeld, heldUsers)
+		} else {
+			tr = e.enforcePrefix(ctx, plan, t, cutoffs[i], categoryHeld, heldUsers)
+		}
+		result.Targets = append(result.Targets, tr)
+		result.RecordsMatched += tr.Matched
+		result.RecordsAffected += tr.Affected
+		result.RecordsHeld += tr.Held
+		result.ObjectsAffected += tr.Objects
+		if tr.Remaining {
+			result.Remaining = true
+		}
+		if tr.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", tr.Target, tr.Error))
+		}
+	}
+
+	switch {
+	case len(failures) > 0:
+		result.Status = "failed"
+		result.ErrorMessage = strings.Join(failures, "; ")
+	case plan.Action == ActionReview:
+		result.Status = "pending_review"
+	case plan.DryRun:
+		result.Status = "dry_run"
+	case result.Remaining:
+		result.Status = "partial"
+	}
+	result.CompletedAt = time.Now()
+	return result, nil
+}
+
+func (e *Enforcer) enforceTable(ctx context.Context, plan Plan, t Target, cutoff time.Time, categoryHeld bool, heldUsers []string) TargetResult {
+	tr := TargetResult{Target: t.Name()}
+	if t.ArchiveOnly && (plan.Action == ActionDelete || plan.Action == ActionAnonymize) {
+		tr.Skipped = "can only be archived"
+		return tr
+	}
+	if plan.Action == ActionAnonymize && (len(t.Anonymize) == 0 || t.Anonymized == "") {
+		tr.Skipped = "cannot be anonymised"
+		return tr
+	}
+	softDelete := plan.Action == ActionDelete && plan.Method == "soft_delete" && t.SoftDeleteColumn != ""
+
+	expired := func() *gorm.DB {
+		q := e.db.WithContext(ctx).Table(t.Table).Where(fmt.Sprintf("%s < ?", t.TimestampColumn), cutoff)
+		if t.Where != "" {
+			q = q.Where(t.Where)
+		}
+		if softDelete {
+			q = q.Where(fmt.Sprintf("%s IS NULL", t.SoftDeleteColumn))
+		}
+		if plan.Action == ActionAnonymize && t.Anonymized != "" {
+			q = q.Where(fmt.Sprintf("NOT (%s)", t.Anonymized))
+		}
+		return q
+	}
+	userHeld := len(heldUsers) > 0 && t.UserColumn != ""
+	eligible := func() *gorm.DB {
+		q := expired()
+		if userHeld {
+			q = q.Where(fmt.Sprintf("(%[1]s IS NULL OR %[1]s::text NOT IN ?)", t.UserColumn), heldUsers)
+		}
+		return q
+	}
+
+	if categoryHeld {
+		if err := expired().Count(&tr.Held).Error; err != nil {
+			tr.Error = fmt.Sprintf("counting held rows: %v", err)
+		}
+		tr.Skipped = "category is under legal hold"
+		return tr
+	}
+	if userHeld {
+		if err := expired().Where(fmt.Sprintf("%s::text IN ?", t.UserColumn), heldUsers).Count(&tr.Held).Error; err != nil {
+			tr.Error = fmt.Sprintf("counting held rows: %v", err)
+			return tr
+		}
+	}
+	if err := eligible().Count(&tr.Matched).Error; err != nil {
+		tr.Error = fmt.Sprintf("counting expired rows: %v", err)
+		return tr
+	}
+	if t.ObjectKeyColumn != "" {
+		if err := eligible().Where(fmt.Sprintf("COALESCE(%s, '') <> ''", t.ObjectKeyColumn)).Count(&tr.Objects).Error; err != nil {
+			tr.Error = fmt.Sprintf("counting stored files: %v", err)
+			return tr
+		}
+	}
+
+	if plan.DryRun {
+		if err := eligible().Order(t.key()).Limit(e.cfg.SampleSize).Pluck(t.key()+"::text", &tr.SampleIDs).Error; err != nil {
+			tr.Error = fmt.Sprintf("listing expired rows: %v", err)
+		}
+		return tr
+	}
+	if plan.Action == ActionReview || tr.Matched == 0 {
+		return tr
+	}
+	if e.store == nil && (plan.Action == ActionArchive || (tr.Objects > 0 && !softDelete && plan.Action == ActionDelete)) {
+		tr.Skipped = "object storage is not configured"
+		return tr
+	}
+
+	// Handled rows drop out of the eligible set, so each batch starts over
+	for batch := 0; ; batch++ {
+		if batch == e.cfg.MaxBatches {
+			tr.Remaining = true
+			break
+		}
+		var ids []string
+		if err := eligible().Order(t.key()).Limit(e.cfg.BatchSize).Pluck(t.key()+"::text", &ids).Error; err != nil {
+			tr.Error = fmt.Sprintf("listing expired rows: %v", err)
+			break
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		before := tr.Affected
+		var err error
+		switch {
+		case plan.Action == ActionArchive:
+			err = e.archiveRows(ctx, t, ids, &tr)
+		case plan.Action == ActionAnonymize:
+			err = e.anonymizeRows(ctx, t, ids, plan.Rules, &tr)
+		case softDelete:
+			res := e.db.WithContext(ctx).Table(t.Table).Where(fmt.Sprintf("%s::text IN ?", t.key()), ids).Update(t.SoftDeleteColumn, time.Now())
+			err = res.Error
+			tr.Affected += res.RowsAffected
+		default:
+			err = e.deleteRows(ctx, t, ids, &tr)
+		}
+		if err != nil {
+			tr.Error = err.Error()
+			break
+		}
+		if tr.Affected == before {
+			tr.Error = "expired rows were left unchanged"
+			break
+		}
+		if len(ids) < e.cfg.BatchSize || !e.pause(ctx) {
+			break
+		}
+	}
+	return tr
+}
+
+// deleteRows removes a batch of rows and then the files that belonged to them
+func (e *Enforcer) deleteRows(ctx context.Context, t Target, ids []string, tr *TargetResult) error {
+	keys, err := e.rowObjectKeys(ctx, t, ids)
+	if err != nil {
+		return err
+	}
+	res := e.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE %s::text IN ?", t.Table, t.key()), ids)
+	if res.Error != nil {
+		return fmt.Errorf("deleting rows: %w", res.Error)
+	}
+	tr.Affected += res.RowsAffected
+
+	var failed int
+	for _, key := range keys {
+		if err := e.store.Delete(ctx, key); err != nil {
+			log.Printf("retention: delete object %s: %v", key, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d stored files could not be deleted", failed)
+	}
+	return nil
+}
+
+// anonymizeRows applies the policy's column rules and the target's
+// anonymised values to a batch of rows
+func (e *Enforcer) anonymizeRows(ctx context.Context, t Target, ids []string, rules map[string]string, tr *TargetResult) error {
+	return e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(rules) == 0 {
+			res := tx.Table(t.Table).Where(fmt.Sprintf("%s::text IN ?", t.key()), ids).Updates(t.Anonymize)
+			if res.Error != nil {
+				return fmt.Errorf("anonymising rows: %w", res.Error)
+			}
+			tr.Affected += res.RowsAffected
+			return nil
+		}
+
+		var rows []map[string]interface{}
+		if err := tx.Table(t.Table).Where(fmt.Sprintf("%s::text IN ?", t.key()), ids).Find(&rows).Error; err != nil {
+			return fmt.Errorf("reading rows: %w", err)
+		}
+		for _, row := range rows {
+			updates := make(map[string]interface{}, len(rules)+len(t.Anonymize))
+			for col, rule := range rules {
+				v, ok := row[col]
+				if !ok {
+					continue
+				}
+				if b, isBytes := v.([]byte); isBytes {
+					v = string(b)
+				}
+				anonymized := e.anonymizer.AnonymizeRecord(map[string]interface{}{col: v}, map[string]string{col: rule})
+				updates[col] = anonymized[col] // nil when the rule removes the value
+			}
+			for col, v := range t.Anonymize {
+				updates[col] = v
+			}
+			res := tx.Table(t.Table).Where(fmt.Sprintf("%s = ?", t.key()), row[t.key()]).Updates(updates)
+			if res.Error != nil {
+				return fmt.Errorf("anonymising rows: %w", res.Error)
+			}
+			tr.Affected += res.RowsAffected
+		}
+		return nil
+	})
+}
+
+// archiveRows moves a batch of rows to cold storage as gzipped NDJSON. Files
+// of the rows are copied under the cold prefix first and the archived rows
+// point at the copies; the live rows and files are only removed once the
+// archive is stored.
+func (e *Enforcer) archiveRows(ctx context.Context, t Target, ids []string, tr *TargetResult) error {
+	var rows []map[string]interface{}
+	if err := e.db.WithContext(ctx).Table(t.Table).Where(fmt.Sprintf("%s::text IN ?", t.key()), ids).Order(t.key()).Find(&rows).Error; err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+
+	var moved []string
+	for _, row := range rows {
+		key, _ := row[t.ObjectKeyColumn].(string)
+		if t.ObjectKeyColumn == "" || key == "" {
+			continue
+		}
+		coldKey, err := e.copyToCold(ctx, t.Category, key)
+		if err != nil {
+			return err
+		}
+		row[t.ObjectKeyColumn] = coldKey
+		moved = append(moved, key)
+	}
+
+	data, err := encodeArchive(rows)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	archiveKey := path.Join(e.coldPrefix(t.Category), t.Table, now.Format("2006/01/02"),
+		fmt.Sprintf("%s-%s.ndjson.gz", now.Format("150405"), ids[0]))
+	if _, err := e.store.UploadBytes(ctx, archiveKey, data, "application/gzip"); err != nil {
+		return fmt.Errorf("uploading archive: %w", err)
+	}
+	tr.Archives = append(tr.Archives, archiveKey)
+
+	res := e.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE %s::text IN ?", t.Table, t.key()), ids)
+	if res.Error != nil {
+		return fmt.Errorf("removing archived rows: %w", res.Error)
+	}
+	tr.Affected += res.RowsAffected
+	for _, key := range moved {
+		if err := e.store.Delete(ctx, key); err != nil {
+			log.Printf("retention: delete archived object %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (e *Enforcer) enforcePrefix(ctx context.Context, plan Plan, t Target, cutoff time.Time, categoryHeld bool, heldUsers []string) TargetResult {
+	tr := TargetResult{Target: t.Name()}
+	if plan.Action == ActionAnonymize {
+		tr.Skipped = "stored files cannot be anonymised"
+		return tr
+	}
+	if e.store == nil {
+		tr.Skipped = "object storage is not configured"
+		return tr
+	}
+
+	limit := e.cfg.BatchSize * e.cfg.MaxBatches
+	objects, err := e.store.ListObjects(ctx, t.Prefix, cutoff, limit+1)
+	if err != nil {
+		tr.Error = fmt.Sprintf("listing objects: %v", err)
+		return tr
+	}
+	if len(objects) > limit {
+		objects = objects[:limit]
+		tr.Remaining = true
+	}
+	if categoryHeld {
+		tr.Held = int64(len(objects))
+		tr.Skipped = "category is under legal hold"
+		return tr
+	}
+
+	held := make(map[string]bool, len(heldUsers))
+	for _, id := range heldUsers {
+		held[id] = true
+	}
+	var keys []string
+	for _, obj := range objects {
+		if t.KeyUserSegment > 0 {
+			segments := strings.Split(obj.Key, "/")
+			if t.KeyUserSegment < len(segments) && held[segments[t.KeyUserSegment]] {
+				tr.Held++
+				continue
+			}
+		}
+		keys = append(keys, obj.Key)
+	}
+	tr.Matched = int64(len(keys))
+	tr.Objects = tr.Matched
+
+	if plan.DryRun {
+		if len(keys) > e.cfg.SampleSize {
+			tr.SampleIDs = keys[:e.cfg.SampleSize]
+		} else {
+			tr.SampleIDs = keys
+		}
+		return tr
+	}
+	if plan.Action == ActionReview {
+		return tr
+	}
+
+	for i, key := range keys {
+		if i > 0 && i%e.cfg.BatchSize == 0 && !e.pause(ctx) {
+			tr.Remaining = true
+			break
+		}
+		if plan.Action == ActionArchive {
+			coldKey, err := e.copyToCold(ctx, t.Category, key)
+			if err != nil {
+				tr.Error = err.Error()
+				break
+			}
+			tr.Archives = append(tr.Archives, coldKey)
+		}
+		if err := e.store.Delete(ctx, key); err != nil {
+			tr.Error = fmt.Sprintf("deleting %s: %v", key, err)
+			break
+		}
+		tr.Affected++
+	}
+	return tr
+}
+
+// copyToCold copies a stored file under the cold prefix of its category
+func (e *Enforcer) copyToCold(ctx context.Context, category, key string) (string, error) {
+	data, err := e.store.Download(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("reading %s for archival: %w", key, err)
+	}
+	coldKey := path.Join(e.coldPrefix(category), "objects", key)
+	if _, err := e.store.UploadBytes(ctx, coldKey, data, "application/octet-stream"); err != nil {
+		return "", fmt.Errorf("archiving %s: %w", key, err)
+	}
+	return coldKey, nil
+}
+
+func (e *Enforcer) rowObjectKeys(ctx context.Context, t Target, ids []string) ([]string, error) {
+	if t.ObjectKeyColumn == "" {
+		return nil, nil
+	}
+	var keys []string
+	err := e.db.WithContext(ctx).Table(t.Table).
+		Where(fmt.Sprintf("%s::text IN ?", t.key()), ids).
+		Where(fmt.Sprintf("COALESCE(%s, '') <> ''", t.ObjectKeyColumn)).
+		Pluck(t.ObjectKeyColumn, &keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("listing stored files: %w", err)
+	}
+	return keys, nil
+}
+
+func (e *Enforcer) coldPrefix(category string) string {
+	return path.Join(e.cfg.ColdPrefix, category)
+}
+
+// pause waits between batches, reporting false when ctx is cancelled
+func (e *Enforcer) pause(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(e.cfg.BatchPause):
+		return true
+	}
+}
+
+// encodeArchive writes rows as gzip-compressed newline-delimited JSON
+func encodeArchive(rows []map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, row := range rows {
+		for col, v := range row {
+			// jsonb and array columns scan as bytes
+			if b, ok := v.([]byte); ok {
+				row[col] = string(b)
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return nil, fmt.Errorf("encoding archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compressing archive: %w", err)
+	}
+	return buf.Bytes(), nil
 }
 
 // EnforcementResult captures the outcome of a retention enforcement action.
 type EnforcementResult struct {
-	Action          string    `json:"action"`
-	DataType        string    `json:"data_type"`
-	RecordsAffected int64     `json:"records_affected"`
-	CompletedAt     time.Time `json:"completed_at"`
-	Status          string    `json:"status"`
-	ErrorMessage    string    `json:"error_message,omitempty"`
+	PolicyID        string         `json:"policy_id,omitempty"`
+	Action          string         `json:"action"`
+	DataType        string         `json:"data_type"`
+	OlderThan       time.Time      `json:"older_than"`
+	DryRun          bool           `json:"dry_run,omitempty"`
+	RecordsMatched  int64          `json:"records_matched"`
+	RecordsAffected int64          `json:"records_affected"`
+	RecordsHeld     int64          `json:"records_held"`
+	ObjectsAffected int64          `json:"objects_affected"`
+	Targets         []TargetResult `json:"targets,omitempty"`
+	// Remaining is set when the batch limit was reached before all expired
+	// data was handled
+	Remaining    bool      `json:"remaining,omitempty"`
+	CompletedAt  time.Time `json:"completed_at"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+}
+
+// TargetResult is the outcome for one table or storage prefix. In a dry run
+// Matched and Objects are what would be affected and SampleIDs lists the
+// first rows or keys.
+type TargetResult struct {
+	Target    string   `json:"target"`
+	Matched   int64    `json:"matched"`
+	Affected  int64    `json:"affected"`
+	Held      int64    `json:"held"`
+	Objects   int64    `json:"objects"`
+	Archives  []string `json:"archives,omitempty"`
+	SampleIDs []string `json:"sample_ids,omitempty"`
+	Remaining bool     `json:"remaining,omitempty"`
+	Skipped   string   `json:"skipped,omitempty"`
+	Error     string   `json:"error,omitempty"`
 }
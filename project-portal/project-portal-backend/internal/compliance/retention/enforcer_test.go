@@ -0,0 +1,187 @@
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+)
+
+type fakeStore struct {
+	objects  map[string][]byte
+	modified map[string]time.Time
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string][]byte), modified: make(map[string]time.Time)}
+}
+
+func (s *fakeStore) put(key string, data []byte, modified time.Time) {
+	s.objects[key] = data
+	s.modified[key] = modified
+}
+
+func (s *fakeStore) ListObjects(ctx context.Context, prefix string, olderThan time.Time, limit int) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	for key, data := range s.objects {
+		if strings.HasPrefix(key, prefix) && s.modified[key].Before(olderThan) && len(objects) < limit {
+			objects = append(objects, storage.ObjectInfo{Key: key, Size: int64(len(data)), LastModified: s.modified[key]})
+		}
+	}
+	return objects, nil
+}
+func (s *fakeStore) Download(ctx context.Context, key string) ([]byte, error) {
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+func (s *fakeStore) UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error) {
+	s.put(key, data, time.Now())
+	return &storage.UploadResult{Key: key}, nil
+}
+func (s *fakeStore) Delete(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	delete(s.modified, key)
+	return nil
+}
+
+type fakeHolds struct {
+	category bool
+	users    []string
+}
+
+func (h fakeHolds) LegalHoldScope(ctx context.Context, dataCategory string) (bool, []string, error) {
+	return h.category, h.users, nil
+}
+
+func TestEnforcePrefixTargets(t *testing.T) {
+	old := time.Now().AddDate(0, 0, -400)
+	store := newFakeStore()
+	store.put("exports/user-1/a.zip", []byte("a"), old)
+	store.put("exports/user-2/b.zip", []byte("b"), old)
+	store.put("exports/user-3/c.zip", []byte("c"), time.Now())
+
+	target := Target{Category: "user_profile", Prefix: "exports/", KeyUserSegment: 1}
+	e := NewEnforcer(nil, store, fakeHolds{users: []string{"user-2"}}, nil, Config{BatchPause: -1}, target)
+	cutoff := time.Now().AddDate(0, 0, -365)
+
+	preview, err := e.EnforcePolicy(context.Background(), Plan{Category: "user_profile", Action: ActionArchive, OlderThan: cutoff, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run error: %v", err)
+	}
+	if preview.Status != "dry_run" || preview.RecordsMatched != 1 || preview.RecordsHeld != 1 ||
+		len(preview.Targets[0].SampleIDs) != 1 || preview.Targets[0].SampleIDs[0] != "exports/user-1/a.zip" {
+		t.Fatalf("expected the unheld expired export in the preview, got %+v", preview)
+	}
+	if len(store.objects) != 3 {
+		t.Fatalf("a dry run must not change anything, got %d objects", len(store.objects))
+	}
+
+	result, err := e.EnforcePolicy(context.Background(), Plan{Category: "user_profile", Action: ActionArchive, OlderThan: cutoff})
+	if err != nil || result.Status != "completed" || result.RecordsAffected != 1 {
+		t.Fatalf("expected one export archived, got %+v %v", result, err)
+	}
+	if _, ok := store.objects["exports/user-1/a.zip"]; ok {
+		t.Fatalf("expected the archived export to leave its prefix")
+	}
+	if string(store.objects["cold-storage/user_profile/objects/exports/user-1/a.zip"]) != "a" {
+		t.Fatalf("expected the export under the cold prefix, got %v", store.objects)
+	}
+	if _, ok := store.objects["exports/user-2/b.zip"]; !ok {
+		t.Fatalf("expected the held user's export to stay")
+	}
+
+	// Anonymising files is not possible, and a category hold stops everything
+	skipped, _ := e.EnforcePolicy(context.Background(), Plan{Category: "user_profile", Action: ActionDelete, Method: "anonymize", OlderThan: cutoff})
+	if skipped.Targets[0].Skipped == "" || skipped.RecordsAffected != 0 {
+		t.Fatalf("expected anonymisation of files to be skipped, got %+v", skipped)
+	}
+	held := NewEnforcer(nil, store, fakeHolds{category: true}, nil, Config{BatchPause: -1}, target)
+	result, _ = held.EnforcePolicy(context.Background(), Plan{Category: "user_profile", Action: ActionDelete, OlderThan: cutoff})
+	if result.RecordsAffected != 0 || result.RecordsHeld != 1 {
+		t.Fatalf("expected a category hold to keep everything, got %+v", result)
+	}
+
+	none, _ := e.EnforcePolicy(context.Background(), Plan{Category: "system_logs", Action: ActionDelete, OlderThan: cutoff})
+	if none.Status != "skipped" {
+		t.Fatalf("expected a category without targets to be skipped, got %+v", none)
+	}
+	if _, err := e.EnforcePolicy(context.Background(), Plan{Category: "user_profile", Action: "shred"}); err == nil {
+		t.Fatalf("expected an unknown action to fail")
+	}
+}
+
+func TestEncodeArchive(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"id": "1", "payload": []byte(`{"a":1}`)},
+		{"id": "2", "payload": nil},
+	}
+	data, err := encodeArchive(rows)
+	if err != nil {
+		t.Fatalf("encodeArchive error: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("archive is not gzip: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	lines := strings.Split(strings.TrimSpace(string(plain)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per row, got %q", plain)
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first["payload"] != `{"a":1}` {
+		t.Fatalf("expected byte columns as text, got %v %v", first, err)
+	}
+}
+
+type fakeSchedules struct {
+	due      []ScheduledAction
+	recorded map[string]*EnforcementResult
+	errs     map[string]error
+}
+
+func (r *fakeSchedules) DueActions(ctx context.Context, before time.Time) ([]ScheduledAction, error) {
+	return r.due, nil
+}
+func (r *fakeSchedules) RecordOutcome(ctx context.Context, action ScheduledAction, result *EnforcementResult, err error) error {
+	r.recorded[action.ScheduleID] = result
+	r.errs[action.ScheduleID] = err
+	return nil
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	store := newFakeStore()
+	store.put("exports/user-1/a.zip", []byte("a"), time.Now().AddDate(-2, 0, 0))
+	e := NewEnforcer(nil, store, nil, nil, Config{BatchPause: -1},
+		Target{Category: "user_profile", Prefix: "exports/", KeyUserSegment: 1})
+	cutoff := time.Now().AddDate(-1, 0, 0)
+
+	repo := &fakeSchedules{recorded: make(map[string]*EnforcementResult), errs: make(map[string]error), due: []ScheduledAction{
+		{ScheduleID: "delete", Active: true, Plan: Plan{Category: "user_profile", Action: ActionDelete, OlderThan: cutoff}},
+		{ScheduleID: "inactive", Active: false, Plan: Plan{Category: "user_profile", Action: ActionDelete, OlderThan: cutoff}},
+		{ScheduleID: "unknown", Active: true, Plan: Plan{Category: "user_profile", Action: "shred", OlderThan: cutoff}},
+	}}
+	run, err := NewScheduler(repo, e).RunDue(context.Background())
+	if err != nil {
+		t.Fatalf("RunDue error: %v", err)
+	}
+	if run.Executed != 1 || run.Skipped != 1 || run.Failed != 1 {
+		t.Fatalf("expected one executed, skipped and failed schedule, got %+v", run)
+	}
+	if repo.recorded["delete"] == nil || repo.recorded["delete"].RecordsAffected != 1 || len(store.objects) != 0 {
+		t.Fatalf("expected the expired export deleted and recorded, got %+v", repo.recorded["delete"])
+	}
+	if repo.recorded["inactive"] != nil || repo.errs["unknown"] == nil {
+		t.Fatalf("expected every outcome recorded, got %+v %+v", repo.recorded, repo.errs)
+	}
+}
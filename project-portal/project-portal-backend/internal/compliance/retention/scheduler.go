@@ -2,25 +2,45 @@ package retention
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 )
 
 // ScheduleRepository defines the data access interface for schedule operations.
 type ScheduleRepository interface {
-	GetDueSchedules(ctx context.Context, before time.Time) (interface{}, error)
+	// DueActions returns the scheduled actions due before the given time
+	DueActions(ctx context.Context, before time.Time) ([]ScheduledAction, error)
+	// RecordOutcome stores the outcome of an action and moves its schedule on
+	RecordOutcome(ctx context.Context, action ScheduledAction, result *EnforcementResult, err error) error
+}
+
+// ScheduledAction is a due schedule turned into an enforcement plan.
+type ScheduledAction struct {
+	ScheduleID string
+	Plan       Plan
+	// Active is false for schedules of inactive policies, which are recorded
+	// as skipped without touching data
+	Active bool
+}
+
+// RunResult summarises one pass over the due schedules.
+type RunResult struct {
+	Executed int `json:"executed"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
 }
 
 // Scheduler manages the execution of retention schedules.
 type Scheduler struct {
-	repo     interface{}
+	repo     ScheduleRepository
 	enforcer *Enforcer
 	ticker   *time.Ticker
 	done     chan bool
 }
 
 // NewScheduler creates a retention scheduler.
-func NewScheduler(repo interface{}, enforcer *Enforcer) *Scheduler {
+func NewScheduler(repo ScheduleRepository, enforcer *Enforcer) *Scheduler {
 	return &Scheduler{
 		repo:     repo,
 		enforcer: enforcer,
@@ -56,10 +76,46 @@ func (s *Scheduler) Stop() {
 }
 
 func (s *Scheduler) checkSchedules() error {
-	log.Println("checking retention schedules...")
-	// Actual schedule fetching and enforcement would use the repository
-	// to get due schedules and delegate to the enforcer.
-	return nil
+	_, err := s.RunDue(context.Background())
+	return err
+}
+
+// RunDue enforces every schedule that is due. A failing action is recorded
+// against its schedule and does not stop the others.
+func (s *Scheduler) RunDue(ctx context.Context) (*RunResult, error) {
+	actions, err := s.repo.DueActions(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	run := &RunResult{}
+	for _, action := range actions {
+		if ctx.Err() != nil {
+			return run, ctx.Err()
+		}
+		if !action.Active {
+			run.Skipped++
+			if err := s.repo.RecordOutcome(ctx, action, nil, nil); err != nil {
+				log.Printf("retention: record schedule %s: %v", action.ScheduleID, err)
+			}
+			continue
+		}
+
+		result, err := s.enforcer.EnforcePolicy(ctx, action.Plan)
+		if err == nil && result.Status == "failed" {
+			err = errors.New(result.ErrorMessage)
+		}
+		if err != nil {
+			run.Failed++
+			log.Printf("retention: schedule %s (%s %s): %v", action.ScheduleID, action.Plan.Action, action.Plan.Category, err)
+		} else {
+			run.Executed++
+		}
+		if err := s.repo.RecordOutcome(ctx, action, result, err); err != nil {
+			log.Printf("retention: record schedule %s: %v", action.ScheduleID, err)
+		}
+	}
+	return run, nil
 }
 
 // ScheduleEntry represents a single scheduled retention action.
@@ -0,0 +1,75 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+)
+
+// Target is a place where data of one category ages out: either rows of a
+// database table or objects under a storage prefix. Each module declares the
+// targets it owns and registers them with the Enforcer at startup.
+type Target struct {
+	Category string
+
+	// Table is the table holding the data. TimestampColumn dates each row and
+	// KeyColumn, "id" by default, identifies it.
+	Table           string
+	TimestampColumn string
+	KeyColumn       string
+	// Where further limits which rows may expire, e.g. only settled invoices
+	Where string
+	// UserColumn names the row's owner, so rows of users under a legal hold
+	// are left alone
+	UserColumn string
+	// ObjectKeyColumn holds the storage key of a file belonging to the row;
+	// the file is deleted or archived with it
+	ObjectKeyColumn string
+	// SoftDeleteColumn, when set, is stamped by the soft_delete method instead
+	// of removing the row
+	SoftDeleteColumn string
+	// Anonymize holds the values that anonymise a row and Anonymized selects
+	// rows already anonymised, so they are not picked up again. Targets
+	// without them cannot be anonymised.
+	Anonymize  map[string]interface{}
+	Anonymized string
+	// ArchiveOnly targets are never deleted or anonymised, only archived
+	ArchiveOnly bool
+
+	// Prefix is a storage prefix whose objects expire by modification time.
+	// KeyUserSegment, when positive, is the index of the "/"-separated key
+	// segment holding the owner's user ID.
+	Prefix         string
+	KeyUserSegment int
+}
+
+// Name identifies the target in results
+func (t Target) Name() string {
+	if t.Table != "" {
+		return t.Table
+	}
+	return t.Prefix
+}
+
+func (t Target) key() string {
+	if t.KeyColumn != "" {
+		return t.KeyColumn
+	}
+	return "id"
+}
+
+// ObjectStore lists, reads, writes and deletes stored objects; S3Client
+// satisfies it
+type ObjectStore interface {
+	ListObjects(ctx context.Context, prefix string, olderThan time.Time, limit int) ([]storage.ObjectInfo, error)
+	Download(ctx context.Context, key string) ([]byte, error)
+	UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// HoldChecker reports which data of a category is under an active legal
+// hold: all of it, or that of the listed users.
+type HoldChecker interface {
+	LegalHoldScope(ctx context.Context, dataCategory string) (categoryHeld bool, userIDs []string, err error)
+}
@@ -0,0 +1,283 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+)
+
+// ErrRetentionUnavailable is returned when no retention enforcer is configured
+var ErrRetentionUnavailable = errors.New("retention enforcement is not configured")
+
+// RunRetentionSchedules enforces every retention schedule that is due.
+func (s *Service) RunRetentionSchedules(ctx context.Context) (*retention.RunResult, error) {
+	if s.retentionScheduler == nil {
+		return nil, ErrRetentionUnavailable
+	}
+	return s.retentionScheduler.RunDue(ctx)
+}
+
+// PreviewRetentionPolicy dry-runs every action of a policy as it would run
+// today, reporting the rows and files each would affect without changing
+// anything. The preview itself is audited.
+func (s *Service) PreviewRetentionPolicy(ctx context.Context, policyID, actorID string) ([]*retention.EnforcementResult, error) {
+	if s.cfg.Retention == nil {
+		return nil, ErrRetentionUnavailable
+	}
+	policy, err := s.repo.GetRetentionPolicy(ctx, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching policy: %w", err)
+	}
+
+	now := time.Now()
+	var results []*retention.EnforcementResult
+	for _, action := range policyActions(policy) {
+		plan := retentionPlan(policy, action, now)
+		plan.DryRun = true
+		result, err := s.cfg.Retention.EnforcePolicy(ctx, plan)
+		if err != nil {
+			return nil, fmt.Errorf("previewing %s: %w", action, err)
+		}
+		results = append(results, result)
+		s.auditRetention(ctx, policy, result, actorID)
+	}
+	return results, nil
+}
+
+// ensureRetentionSchedules creates the schedules a policy needs and brings
+// existing ones in line after the policy changed
+func (s *Service) ensureRetentionSchedules(ctx context.Context, policy *RetentionPolicy) error {
+	existing, err := s.repo.ListRetentionSchedules(ctx, policy.ID)
+	if err != nil {
+		return fmt.Errorf("listing schedules: %w", err)
+	}
+	byAction := make(map[string]*RetentionSchedule, len(existing))
+	for i := range existing {
+		byAction[existing[i].ActionType] = &existing[i]
+	}
+
+	wanted := policyActions(policy)
+	for _, action := range wanted {
+		if sched, ok := byAction[action]; ok {
+			if sched.DataType != policy.DataCategory {
+				sched.DataType = policy.DataCategory
+				if err := s.repo.UpdateRetentionSchedule(ctx, sched); err != nil {
+					return fmt.Errorf("updating %s schedule: %w", action, err)
+				}
+			}
+			continue
+		}
+
+		// Enforcement is due straight away, since the policy's periods decide
+		// what is old enough; reviews come after the review period
+		days := 0
+		if action == retention.ActionReview {
+			days = policy.ReviewPeriodDays
+		}
+		entry := retention.BuildSchedule(policy.ID, policy.DataCategory, action, days, policy.ReviewPeriodDays)
+		next := entry.NextActionDate
+		sched := &RetentionSchedule{
+			PolicyID:       entry.PolicyID,
+			DataType:       entry.DataType,
+			ActionType:     entry.ActionType,
+			NextActionDate: &next,
+			NextReviewDate: entry.ReviewDate,
+		}
+		if err := s.repo.CreateRetentionSchedule(ctx, sched); err != nil {
+			return fmt.Errorf("creating %s schedule: %w", action, err)
+		}
+	}
+
+	// Actions the policy no longer has stop being scheduled
+	for action, sched := range byAction {
+		if containsString(wanted, action) || sched.NextActionDate == nil {
+			continue
+		}
+		sched.NextActionDate = nil
+		if err := s.repo.UpdateRetentionSchedule(ctx, sched); err != nil {
+			return fmt.Errorf("pausing %s schedule: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// policyActions lists what a policy does with expiring data: archive after
+// the archival period, delete after the retention period unless it is
+// indefinite, and always a periodic review.
+func policyActions(policy *RetentionPolicy) []string {
+	var actions []string
+	if policy.ArchivalPeriodDays != nil && *policy.ArchivalPeriodDays >= 0 {
+		actions = append(actions, retention.ActionArchive)
+	}
+	if policy.RetentionPeriodDays >= 0 {
+		actions = append(actions, retention.ActionDelete)
+	}
+	return append(actions, retention.ActionReview)
+}
+
+func retentionPlan(policy *RetentionPolicy, action string, now time.Time) retention.Plan {
+	days := policy.RetentionPeriodDays
+	if action == retention.ActionArchive && policy.ArchivalPeriodDays != nil {
+		days = *policy.ArchivalPeriodDays
+	} else if days < 0 {
+		// Indefinitely kept data is reviewed by age against the review period
+		days = policy.ReviewPeriodDays
+	}
+
+	plan := retention.Plan{
+		PolicyID:    policy.ID,
+		Category:    policy.DataCategory,
+		Action:      action,
+		Method:      policy.DeletionMethod,
+		OlderThan:   now.AddDate(0, 0, -days),
+		IgnoreHolds: !policy.LegalHoldEnabled,
+	}
+	if action == retention.ActionDelete && policy.ArchivalPeriodDays != nil && *policy.ArchivalPeriodDays > 0 {
+		plan.ArchivedAfterDays = *policy.ArchivalPeriodDays
+	}
+	if len(policy.AnonymizationRules) > 0 {
+		plan.Rules = make(map[string]string, len(policy.AnonymizationRules))
+		for col, rule := range policy.AnonymizationRules {
+			if r, ok := rule.(string); ok {
+				plan.Rules[col] = r
+			}
+		}
+	}
+	return plan
+}
+
+func (s *Service) auditRetention(ctx context.Context, policy *RetentionPolicy, result *retention.EnforcementResult, actorID string) {
+	action := result.Action
+	if result.DryRun {
+		action = "dry_run_" + action
+	}
+	entry := AuditEntry{
+		EventType:    "retention",
+		EventAction:  action,
+		ActorID:      actorID,
+		ActorType:    ActorTypeUser,
+		TargetType:   "retention_policy",
+		TargetID:     policy.ID,
+		DataCategory: policy.DataCategory,
+		ServiceName:  "compliance",
+		NewValues: map[string]any{
+			"status":           result.Status,
+			"older_than":       result.OlderThan,
+			"records_matched":  result.RecordsMatched,
+			"records_affected": result.RecordsAffected,
+			"records_held":     result.RecordsHeld,
+			"objects_affected": result.ObjectsAffected,
+			"remaining":        result.Remaining,
+			"targets":          result.Targets,
+		},
+	}
+	if actorID == "" {
+		entry.ActorType = ActorTypeSystem
+	}
+	if result.ErrorMessage != "" {
+		entry.NewValues["error"] = result.ErrorMessage
+	}
+	if err := s.LogAuditEvent(ctx, entry); err != nil {
+		log.Printf("compliance: audit of retention %s for policy %s: %v", action, policy.ID, err)
+	}
+}
+
+// retentionSchedules adapts the schedule table to the retention scheduler
+type retentionSchedules struct {
+	s *Service
+}
+
+func (rs retentionSchedules) DueActions(ctx context.Context, before time.Time) ([]retention.ScheduledAction, error) {
+	schedules, err := rs.s.repo.GetDueSchedules(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]retention.ScheduledAction, 0, len(schedules))
+	for _, sched := range schedules {
+		policy := sched.Policy
+		actions = append(actions, retention.ScheduledAction{
+			ScheduleID: sched.ID,
+			Plan:       retentionPlan(&policy, sched.ActionType, before),
+			Active:     policy.IsActive && containsString(policyActions(&policy), sched.ActionType),
+		})
+	}
+	return actions, nil
+}
+
+// RecordOutcome stores the outcome on the schedule, audits it and sets the
+// next run: tomorrow, straight away when the batch limit left data behind,
+// or after the review period for reviews
+func (rs retentionSchedules) RecordOutcome(ctx context.Context, action retention.ScheduledAction, result *retention.EnforcementResult, runErr error) error {
+	policy, err := rs.s.repo.GetRetentionPolicy(ctx, action.Plan.PolicyID)
+	if err != nil {
+		return fmt.Errorf("fetching policy: %w", err)
+	}
+	schedules, err := rs.s.repo.ListRetentionSchedules(ctx, policy.ID)
+	if err != nil {
+		return fmt.Errorf("listing schedules: %w", err)
+	}
+	var sched *RetentionSchedule
+	for i := range schedules {
+		if schedules[i].ID == action.ScheduleID {
+			sched = &schedules[i]
+		}
+	}
+	if sched == nil {
+		return fmt.Errorf("schedule %s no longer exists", action.ScheduleID)
+	}
+
+	now := time.Now()
+	next := now.AddDate(0, 0, 1)
+	sched.LastActionDate = &now
+	sched.LastActionType = action.Plan.Action
+	switch {
+	case !action.Active:
+		sched.LastActionResult = "skipped: policy inactive"
+	case runErr != nil:
+		sched.LastActionResult = "failed: " + runErr.Error()
+	default:
+		sched.LastActionResult = result.Status
+		matched := result.RecordsMatched
+		sched.RecordCountEstimate = &matched
+		if result.Remaining {
+			next = now
+		}
+	}
+	if action.Plan.Action == retention.ActionReview {
+		next = now.AddDate(0, 0, policy.ReviewPeriodDays)
+		sched.NextReviewDate = next
+	}
+	sched.NextActionDate = &next
+	if err := rs.s.repo.UpdateRetentionSchedule(ctx, sched); err != nil {
+		return fmt.Errorf("updating schedule: %w", err)
+	}
+
+	if result == nil {
+		result = &retention.EnforcementResult{
+			PolicyID:  policy.ID,
+			Action:    action.Plan.Action,
+			DataType:  policy.DataCategory,
+			OlderThan: action.Plan.OlderThan,
+			Status:    "skipped",
+		}
+		if runErr != nil {
+			result.Status = "failed"
+			result.ErrorMessage = runErr.Error()
+		}
+	}
+	rs.s.auditRetention(ctx, policy, result, "")
+	return nil
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
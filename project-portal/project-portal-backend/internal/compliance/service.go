@@ -2,24 +2,98 @@ package compliance
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	auditpkg "carbon-scribe/project-portal/project-portal-backend/internal/compliance/audit"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/privacy"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
 )
 
+// Config holds optional compliance service dependencies.
+type Config struct {
+	// DataProviders locate, export and erase the user data each module holds
+	DataProviders []requests.Provider
+	// IndexPurgers remove search index entries about users on erasure
+	IndexPurgers []requests.IndexPurger
+	// ExportStore keeps encrypted export packages; exports wait without it
+	ExportStore ExportStore
+	// Notifier sends verification codes, results and escalations
+	Notifier RequestNotifier
+	// VerificationCodeTTL is how long an emailed one-time code is valid
+	VerificationCodeTTL time.Duration
+	// EscalateBefore is how long before its deadline an open request is
+	// escalated to compliance officers
+	EscalateBefore time.Duration
+	// ExportRetention is how long export packages can be downloaded
+	ExportRetention time.Duration
+	// ExportURLExpiry is the lifetime of download links handed out later
+	ExportURLExpiry time.Duration
+	// Retention carries out retention policies; schedules are not enforced
+	// without it
+	Retention *retention.Enforcer
+	// AuditSigningKey signs audit entries and checkpoints
+	AuditSigningKey []byte
+	// IntegrityAlerter raises a critical alert when audit verification fails
+	IntegrityAlerter IntegrityAlerter
+	// Redactor masks sensitive fields in audit old and new values; values are
+	// stored as given without it
+	Redactor ValueRedactor
+}
+
 // Service orchestrates all compliance operations.
 type Service struct {
-	repo        Repository
-	auditLogger *auditpkg.Logger
+	repo          Repository
+	cfg           Config
+	auditLogger   *auditpkg.Logger
+	immutable     *auditpkg.ImmutableLog
+	discoverer    *requests.Discoverer
+	processor     *requests.Processor
+	verifier      *requests.Verifier
+	jurisdictions *privacy.JurisdictionManager
+
+	retentionScheduler *retention.Scheduler
 }
 
 // NewService creates a new compliance service with all sub-components.
 func NewService(repo Repository) *Service {
-	return &Service{
-		repo:        repo,
-		auditLogger: auditpkg.NewLogger(),
+	return NewServiceWithConfig(repo, Config{})
+}
+
+// NewServiceWithConfig creates a new compliance service with explicit configuration.
+func NewServiceWithConfig(repo Repository, cfg Config) *Service {
+	if cfg.VerificationCodeTTL <= 0 {
+		cfg.VerificationCodeTTL = defaultVerificationCodeTTL
+	}
+	if cfg.EscalateBefore <= 0 {
+		cfg.EscalateBefore = defaultEscalateBefore
+	}
+	if cfg.ExportRetention <= 0 || cfg.ExportRetention > maxPresignedURLExpiry {
+		cfg.ExportRetention = defaultRequestExportTTL
+	}
+	if cfg.ExportURLExpiry <= 0 {
+		cfg.ExportURLExpiry = defaultRequestURLExpiry
 	}
+	discoverer := requests.NewDiscoverer(cfg.DataProviders...)
+	immutable := auditpkg.NewImmutableLogWithKey(cfg.AuditSigningKey)
+	s := &Service{
+		repo:          repo,
+		cfg:           cfg,
+		auditLogger:   auditpkg.NewLoggerWithLog(immutable),
+		immutable:     immutable,
+		discoverer:    discoverer,
+		processor:     requests.NewProcessor(repo, discoverer, repo, cfg.IndexPurgers...),
+		verifier:      requests.NewVerifier(),
+		jurisdictions: privacy.NewJurisdictionManager(),
+	}
+	if cfg.Retention != nil {
+		s.retentionScheduler = retention.NewScheduler(retentionSchedules{s}, cfg.Retention)
+	}
+	return s
 }
 
 // --- Retention Policy Operations ---
@@ -53,6 +127,9 @@ func (s *Service) CreateRetentionPolicy(ctx context.Context, req CreateRetention
 	if err := s.repo.CreateRetentionPolicy(ctx, policy); err != nil {
 		return nil, fmt.Errorf("creating retention policy: %w", err)
 	}
+	if err := s.ensureRetentionSchedules(ctx, policy); err != nil {
+		log.Printf("compliance: scheduling retention policy %s: %v", policy.ID, err)
+	}
 	return policy, nil
 }
 
@@ -89,20 +166,29 @@ func (s *Service) UpdateRetentionPolicy(ctx context.Context, id string, req Crea
 	if err := s.repo.UpdateRetentionPolicy(ctx, policy); err != nil {
 		return nil, fmt.Errorf("updating retention policy: %w", err)
 	}
+	if err := s.ensureRetentionSchedules(ctx, policy); err != nil {
+		log.Printf("compliance: scheduling retention policy %s: %v", policy.ID, err)
+	}
 	return policy, nil
 }
 
 // --- Privacy Request Operations ---
 
+// CreateExportRequest records an export request due within the response
+// time of the requester's jurisdiction and emails them a one-time code to
+// confirm their identity.
 func (s *Service) CreateExportRequest(ctx context.Context, userID string, req ExportRequest) (*PrivacyRequest, error) {
-	estimated := time.Now().Add(72 * time.Hour)
+	submitted := time.Now()
+	jurisdiction, due := s.responseDeadline(ctx, userID, submitted)
 	privReq := &PrivacyRequest{
 		UserID:              userID,
 		RequestType:         RequestTypeExport,
 		RequestSubtype:      "full_export",
 		Status:              RequestStatusReceived,
-		SubmittedAt:         time.Now(),
-		EstimatedCompletion: &estimated,
+		SubmittedAt:         submitted,
+		Jurisdiction:        jurisdiction,
+		DueAt:               &due,
+		EstimatedCompletion: &due,
 		DataCategories:      req.DataCategories,
 		DateRangeStart:      req.DateRangeStart,
 		DateRangeEnd:        req.DateRangeEnd,
@@ -116,9 +202,14 @@ func (s *Service) CreateExportRequest(ctx context.Context, userID string, req Ex
 	if err := s.repo.CreatePrivacyRequest(ctx, privReq); err != nil {
 		return nil, fmt.Errorf("creating export request: %w", err)
 	}
+	if err := s.sendVerificationCode(ctx, privReq); err != nil {
+		log.Printf("compliance: verification code for request %s: %v", privReq.ID, err)
+	}
 	return privReq, nil
 }
 
+// CreateDeleteRequest records a deletion request the same way, refusing
+// categories under legal hold up front.
 func (s *Service) CreateDeleteRequest(ctx context.Context, userID string, req DeleteRequest) (*PrivacyRequest, error) {
 	for _, cat := range req.DataCategories {
 		held, err := s.repo.IsDataUnderLegalHold(ctx, userID, cat)
@@ -130,14 +221,17 @@ func (s *Service) CreateDeleteRequest(ctx context.Context, userID string, req De
 		}
 	}
 
-	estimated := time.Now().Add(72 * time.Hour)
+	submitted := time.Now()
+	jurisdiction, due := s.responseDeadline(ctx, userID, submitted)
 	privReq := &PrivacyRequest{
 		UserID:              userID,
 		RequestType:         RequestTypeDeletion,
 		RequestSubtype:      "complete_deletion",
 		Status:              RequestStatusReceived,
-		SubmittedAt:         time.Now(),
-		EstimatedCompletion: &estimated,
+		SubmittedAt:         submitted,
+		Jurisdiction:        jurisdiction,
+		DueAt:               &due,
+		EstimatedCompletion: &due,
 		DataCategories:      req.DataCategories,
 		LegalBasis:          req.LegalBasis,
 	}
@@ -149,6 +243,9 @@ func (s *Service) CreateDeleteRequest(ctx context.Context, userID string, req De
 	if err := s.repo.CreatePrivacyRequest(ctx, privReq); err != nil {
 		return nil, fmt.Errorf("creating deletion request: %w", err)
 	}
+	if err := s.sendVerificationCode(ctx, privReq); err != nil {
+		log.Printf("compliance: verification code for request %s: %v", privReq.ID, err)
+	}
 	return privReq, nil
 }
 
@@ -160,6 +257,81 @@ func (s *Service) ListRequests(ctx context.Context, userID, status string, limit
 	return s.repo.ListPrivacyRequests(ctx, userID, status, limit, offset)
 }
 
+// ProcessDeletionRequest erases the data of a verified requester and records
+// the outcome on the request. The request completes with a deletion certificate
+// only when erasure was verified; otherwise it fails listing what remains.
+func (s *Service) ProcessDeletionRequest(ctx context.Context, id string) (*PrivacyRequest, error) {
+	privReq, err := s.repo.GetPrivacyRequest(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching request: %w", err)
+	}
+	if privReq.RequestType != RequestTypeDeletion {
+		return nil, fmt.Errorf("request %s is not a deletion request", id)
+	}
+	if privReq.Status == RequestStatusCompleted {
+		return privReq, nil
+	}
+
+	if err := s.claim(ctx, privReq); err != nil {
+		return nil, err
+	}
+
+	result, err := s.processor.ProcessDeletionRequest(ctx, privReq.UserID, privReq.DataCategories)
+	now := time.Now()
+	status := RequestStatusCompleted
+	if err != nil {
+		status = RequestStatusFailed
+		privReq.ErrorMessage = err.Error()
+	} else {
+		privReq.DeletionSummary = deletionSummary(result)
+		privReq.DeletionCertificate = result.Certificate
+		privReq.ErrorMessage = ""
+		if !result.Verified {
+			status = RequestStatusFailed
+			privReq.ErrorMessage = "erasure incomplete: " + strings.Join(result.Failures, "; ")
+		}
+	}
+	privReq.CompletedAt = &now
+	if err := s.transition(ctx, privReq, status, ""); err != nil {
+		return nil, err
+	}
+	return privReq, nil
+}
+
+// deletionSummary flattens a deletion result for storage on the request
+func deletionSummary(result *requests.DeletionResult) map[string]any {
+	summary := make(map[string]any)
+	data, err := json.Marshal(result)
+	if err == nil {
+		_ = json.Unmarshal(data, &summary)
+	}
+	delete(summary, "certificate")
+	return summary
+}
+
+// RegisterDataProvider adds a module's data to discovery, export and erasure.
+func (s *Service) RegisterDataProvider(provider requests.Provider) {
+	s.discoverer.RegisterProvider(provider)
+}
+
+// DiscoverUserData reports where each module holds data about a user,
+// optionally limited to categories.
+func (s *Service) DiscoverUserData(ctx context.Context, userID string, categories []string) (*DataMap, error) {
+	locations, err := s.discoverer.DiscoverUserData(ctx, userID, categories)
+	if err != nil {
+		return nil, fmt.Errorf("discovering user data: %w", err)
+	}
+	dataMap := &DataMap{UserID: userID, Locations: locations, Categories: s.discoverer.Categories()}
+	for _, p := range s.discoverer.Providers() {
+		dataMap.Providers = append(dataMap.Providers, p.Name())
+	}
+	for _, loc := range locations {
+		dataMap.TotalRecords += loc.RecordCount
+		dataMap.TotalObjects += loc.ObjectCount
+	}
+	return dataMap, nil
+}
+
 // --- Privacy Preferences ---
 
 func (s *Service) GetPreferences(ctx context.Context, userID string) (*PrivacyPreference, error) {
@@ -270,13 +442,9 @@ func (s *Service) QueryAuditLogs(ctx context.Context, query AuditLogQuery) ([]Au
 	return s.repo.QueryAuditLogs(ctx, query)
 }
 
+// LogAuditEvent appends an entry to the audit hash chain. The repository
+// serialises appends so the entry links to the one committed before it.
 func (s *Service) LogAuditEvent(ctx context.Context, entry AuditEntry) error {
-	prevHash := ""
-	lastLog, err := s.repo.GetLastAuditLog(ctx)
-	if err == nil && lastLog != nil {
-		prevHash = lastLog.HashChain
-	}
-
 	auditEntry := auditpkg.AuditLogEntry{
 		EventTime:        time.Now(),
 		EventType:        entry.EventType,
@@ -295,42 +463,50 @@ func (s *Service) LogAuditEvent(ctx context.Context, entry AuditEntry) error {
 		NewValues:        entry.NewValues,
 		PermissionUsed:   entry.PermissionUsed,
 	}
+	if s.cfg.Redactor != nil {
+		auditEntry.OldValues = s.cfg.Redactor.Redact(entry.OldValues)
+		auditEntry.NewValues = s.cfg.Redactor.Redact(entry.NewValues)
+	}
 	if entry.ActorIP != nil {
 		auditEntry.ActorIP = entry.ActorIP.String()
 	}
 
-	built := s.auditLogger.BuildEntry(auditEntry, prevHash)
-
-	log := &AuditLog{
-		EventTime:        built.EventTime,
-		EventType:        built.EventType,
-		EventAction:      built.EventAction,
-		ActorType:        built.ActorType,
-		ActorIP:          built.ActorIP,
-		TargetType:       built.TargetType,
-		DataCategory:     built.DataCategory,
-		SensitivityLevel: built.SensitivityLevel,
-		ServiceName:      built.ServiceName,
-		Endpoint:         built.Endpoint,
-		HTTPMethod:       built.HTTPMethod,
-		OldValues:        built.OldValues,
-		NewValues:        built.NewValues,
-		PermissionUsed:   built.PermissionUsed,
-		HashChain:        built.HashChain,
-		Signature:        built.Signature,
-	}
-
-	if built.ActorID != "" {
-		log.ActorID = &built.ActorID
-	}
-	if built.TargetID != "" {
-		log.TargetID = &built.TargetID
-	}
-	if built.TargetOwnerID != "" {
-		log.TargetOwnerID = &built.TargetOwnerID
-	}
+	return s.repo.AppendAuditLog(ctx, func(prevHash string) *AuditLog {
+		// The entry is dated once the chain is locked, keeping event times in
+		// chain order
+		auditEntry.EventTime = time.Now()
+		built := s.auditLogger.BuildEntry(auditEntry, prevHash)
+
+		log := &AuditLog{
+			EventTime:        built.EventTime,
+			EventType:        built.EventType,
+			EventAction:      built.EventAction,
+			ActorType:        built.ActorType,
+			ActorIP:          built.ActorIP,
+			TargetType:       built.TargetType,
+			DataCategory:     built.DataCategory,
+			SensitivityLevel: built.SensitivityLevel,
+			ServiceName:      built.ServiceName,
+			Endpoint:         built.Endpoint,
+			HTTPMethod:       built.HTTPMethod,
+			OldValues:        built.OldValues,
+			NewValues:        built.NewValues,
+			PermissionUsed:   built.PermissionUsed,
+			HashChain:        built.HashChain,
+			Signature:        built.Signature,
+		}
 
-	return s.repo.CreateAuditLog(ctx, log)
+		if built.ActorID != "" {
+			log.ActorID = &built.ActorID
+		}
+		if built.TargetID != "" {
+			log.TargetID = &built.TargetID
+		}
+		if built.TargetOwnerID != "" {
+			log.TargetOwnerID = &built.TargetOwnerID
+		}
+		return log
+	})
 }
 
 // --- Retention Schedules ---
@@ -360,6 +536,10 @@ func (s *Service) CreateLegalHold(ctx context.Context, req CreateLegalHoldReques
 	return hold, nil
 }
 
+func (s *Service) GetLegalHold(ctx context.Context, id string) (*LegalHold, error) {
+	return s.repo.GetLegalHold(ctx, id)
+}
+
 func (s *Service) ReleaseLegalHold(ctx context.Context, id, releasedBy string) (*LegalHold, error) {
 	hold, err := s.repo.GetLegalHold(ctx, id)
 	if err != nil {
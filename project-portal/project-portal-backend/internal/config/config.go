@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds application configuration
@@ -17,6 +18,9 @@ type Config struct {
 	Storage       StorageConfig
 	Geospatial    GeospatialConfig
 	Settings      SettingsConfig
+	Reports       ReportsConfig
+	Compliance    ComplianceConfig
+	Email         EmailConfig
 }
 
 // ElasticsearchConfig holds configuration for Elasticsearch
@@ -44,10 +48,83 @@ type StorageConfig struct {
 	IPFSNodeURL     string
 }
 
+// EmailConfig holds the SMTP relay used for transactional email. An empty
+// host disables sending.
+type EmailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
 type SettingsConfig struct {
-	EncryptionKeyHex string
-	APIKeyPrefix     string
-	ProfileCDNBase   string
+	EncryptionKeyHex     string
+	APIKeyPrefix         string
+	ProfileCDNBase       string
+	OAuthProviders       []OAuthProviderConfig
+	OAuthRefreshWindow   time.Duration // how long before expiry tokens are renewed
+	OAuthRefreshInterval time.Duration // how often expiring tokens are looked for
+	KeyringFile          string        // local KMS keyring; empty keeps single-key encryption
+	KeyringKeyID         string        // id of the first key when the keyring is created
+	KeyRotationInterval  time.Duration // master key age that triggers rotation; 0 disables
+	ReencryptInterval    time.Duration // how often old ciphertexts are moved to the newest key
+	ProbeInterval        time.Duration // how often integrations are probed
+	HealthRetention      time.Duration // how long probe history is kept
+	// how often buffered API key usage is written to the database
+	APIKeyUsageFlushInterval time.Duration
+	APIKeyWebhookInterval    time.Duration // how often API key webhooks are scheduled and sent
+	APIKeyExpiryWarning      time.Duration // how long before expiry api_key.expiring is sent
+	BillingInterval          time.Duration // how often ended subscription periods are renewed
+	UsageMeterInterval       time.Duration // how often billing usage is measured
+	InvoiceInterval          time.Duration // how often draft invoices are issued
+	InvoiceURLExpiry         time.Duration // lifetime of presigned invoice PDF links
+	PaymentTermsDays         int           // days from issue until an invoice is due
+	StripeSecretKey          string        // empty disables payments unless the fake processor is enabled
+	BillingFakeProcessor     bool          // use the in-memory fake processor, which never moves money
+	StripeWebhookSecret      string        // signing secret of the payment webhook endpoint
+	ProfilePictureMaxBytes   int64         // largest accepted profile picture upload
+	ExportInterval           time.Duration // how often queued account exports are built
+	ExportRetention          time.Duration // how long finished account exports are kept
+	ExportURLExpiry          time.Duration // lifetime of presigned export download links
+}
+
+// OAuthProviderConfig holds the endpoints and client registration of an
+// OAuth2 provider used by settings integrations.
+type OAuthProviderConfig struct {
+	Name         string
+	AuthorizeURL string
+	TokenURL     string
+	RevokeURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ReportsConfig holds reporting and benchmark settings.
+type ReportsConfig struct {
+	PeerMinCohortSize     int           // smallest peer group for which statistics are published
+	PeerBenchmarkInterval time.Duration // how often peer benchmarks are recomputed
+	ExecutionCacheTTL     time.Duration // how long completed executions are reused; negative disables
+	SnapshotPurgeInterval time.Duration // how often unshared execution snapshots are dropped
+}
+
+// ComplianceConfig holds privacy request processing and retention settings.
+type ComplianceConfig struct {
+	RequestInterval     time.Duration // how often verified privacy requests are processed
+	EscalateBefore      time.Duration // how long before its deadline a request is escalated
+	VerificationCodeTTL time.Duration // lifetime of emailed one-time codes
+	ExportRetention     time.Duration // how long encrypted export packages are kept
+	ExportURLExpiry     time.Duration // lifetime of presigned export download links
+	OfficerEmails       []string      // compliance officers escalations are sent to
+	RetentionInterval   time.Duration // how often due retention schedules are enforced
+	RetentionBatchSize  int           // rows or objects handled per retention batch
+	RetentionBatchPause time.Duration // pause between retention batches
+	ColdStoragePrefix   string        // storage prefix archived data is moved under
+	AuditSigningKey     string        // HMAC key for audit entries and checkpoints
+	AuditInterval       time.Duration // how often audit checkpoints are signed and verified
+	AuditVerifyWindow   time.Duration // how far back each scheduled verification reaches
 }
 
 type GeospatialConfig struct {
@@ -81,6 +158,183 @@ func Load() (*Config, error) {
 		maxUpload = 100
 	}
 
+	peerMinCohort, _ := strconv.Atoi(os.Getenv("REPORTS_PEER_MIN_COHORT"))
+	if peerMinCohort <= 0 {
+		peerMinCohort = 5
+	}
+
+	peerInterval, err := time.ParseDuration(getEnvOrDefault("REPORTS_PEER_BENCHMARK_INTERVAL", "24h"))
+	if err != nil || peerInterval <= 0 {
+		peerInterval = 24 * time.Hour
+	}
+
+	executionCacheTTL, err := time.ParseDuration(getEnvOrDefault("REPORTS_CACHE_TTL", "5m"))
+	if err != nil {
+		executionCacheTTL = 5 * time.Minute
+	} else if executionCacheTTL == 0 {
+		executionCacheTTL = -1 // an explicit 0 turns reuse off
+	}
+
+	snapshotPurgeInterval, err := time.ParseDuration(getEnvOrDefault("REPORTS_SNAPSHOT_PURGE_INTERVAL", "1h"))
+	if err != nil || snapshotPurgeInterval <= 0 {
+		snapshotPurgeInterval = time.Hour
+	}
+
+	oauthRefreshWindow, err := time.ParseDuration(getEnvOrDefault("SETTINGS_OAUTH_REFRESH_WINDOW", "5m"))
+	if err != nil || oauthRefreshWindow <= 0 {
+		oauthRefreshWindow = 5 * time.Minute
+	}
+
+	oauthRefreshInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_OAUTH_REFRESH_INTERVAL", "1m"))
+	if err != nil || oauthRefreshInterval <= 0 {
+		oauthRefreshInterval = time.Minute
+	}
+
+	keyRotationInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_KEY_ROTATION_INTERVAL", "0"))
+	if err != nil || keyRotationInterval < 0 {
+		keyRotationInterval = 0
+	}
+
+	reencryptInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_REENCRYPT_INTERVAL", "1h"))
+	if err != nil || reencryptInterval <= 0 {
+		reencryptInterval = time.Hour
+	}
+
+	probeInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_INTEGRATION_PROBE_INTERVAL", "5m"))
+	if err != nil || probeInterval <= 0 {
+		probeInterval = 5 * time.Minute
+	}
+
+	healthRetention, err := time.ParseDuration(getEnvOrDefault("SETTINGS_INTEGRATION_HEALTH_RETENTION", "720h"))
+	if err != nil || healthRetention <= 0 {
+		healthRetention = 30 * 24 * time.Hour
+	}
+
+	usageFlushInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_API_KEY_USAGE_FLUSH_INTERVAL", "15s"))
+	if err != nil || usageFlushInterval <= 0 {
+		usageFlushInterval = 15 * time.Second
+	}
+
+	webhookInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_API_KEY_WEBHOOK_INTERVAL", "30s"))
+	if err != nil || webhookInterval <= 0 {
+		webhookInterval = 30 * time.Second
+	}
+
+	expiryWarning, err := time.ParseDuration(getEnvOrDefault("SETTINGS_API_KEY_EXPIRY_WARNING", "168h"))
+	if err != nil || expiryWarning <= 0 {
+		expiryWarning = 7 * 24 * time.Hour
+	}
+
+	billingInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_BILLING_INTERVAL", "1h"))
+	if err != nil || billingInterval <= 0 {
+		billingInterval = time.Hour
+	}
+
+	usageMeterInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_USAGE_METER_INTERVAL", "15m"))
+	if err != nil || usageMeterInterval <= 0 {
+		usageMeterInterval = 15 * time.Minute
+	}
+
+	invoiceInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_INVOICE_INTERVAL", "10m"))
+	if err != nil || invoiceInterval <= 0 {
+		invoiceInterval = 10 * time.Minute
+	}
+
+	invoiceURLExpiry, err := time.ParseDuration(getEnvOrDefault("SETTINGS_INVOICE_URL_TTL", "15m"))
+	if err != nil || invoiceURLExpiry <= 0 {
+		invoiceURLExpiry = 15 * time.Minute
+	}
+
+	paymentTermsDays, _ := strconv.Atoi(os.Getenv("SETTINGS_INVOICE_PAYMENT_TERMS_DAYS"))
+	if paymentTermsDays <= 0 {
+		paymentTermsDays = 14
+	}
+
+	exportInterval, err := time.ParseDuration(getEnvOrDefault("SETTINGS_EXPORT_INTERVAL", "1m"))
+	if err != nil || exportInterval <= 0 {
+		exportInterval = time.Minute
+	}
+
+	// Presigned S3 links cannot outlive seven days, and the emailed link
+	// lasts as long as the archive
+	exportRetention, err := time.ParseDuration(getEnvOrDefault("SETTINGS_EXPORT_RETENTION", "168h"))
+	if err != nil || exportRetention <= 0 || exportRetention > 168*time.Hour {
+		exportRetention = 168 * time.Hour
+	}
+
+	exportURLExpiry, err := time.ParseDuration(getEnvOrDefault("SETTINGS_EXPORT_URL_TTL", "15m"))
+	if err != nil || exportURLExpiry <= 0 {
+		exportURLExpiry = 15 * time.Minute
+	}
+
+	pictureMaxMB, _ := strconv.ParseInt(getEnvOrDefault("SETTINGS_PROFILE_PICTURE_MAX_MB", "5"), 10, 64)
+	if pictureMaxMB <= 0 {
+		pictureMaxMB = 5
+	}
+
+	requestInterval, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_REQUEST_INTERVAL", "5m"))
+	if err != nil || requestInterval <= 0 {
+		requestInterval = 5 * time.Minute
+	}
+
+	escalateBefore, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_ESCALATE_BEFORE", "120h"))
+	if err != nil || escalateBefore <= 0 {
+		escalateBefore = 5 * 24 * time.Hour
+	}
+
+	verificationCodeTTL, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_VERIFICATION_CODE_TTL", "30m"))
+	if err != nil || verificationCodeTTL <= 0 {
+		verificationCodeTTL = 30 * time.Minute
+	}
+
+	// As with account exports, the emailed link lasts as long as the package
+	privacyExportRetention, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_EXPORT_RETENTION", "168h"))
+	if err != nil || privacyExportRetention <= 0 || privacyExportRetention > 168*time.Hour {
+		privacyExportRetention = 168 * time.Hour
+	}
+
+	privacyExportURLExpiry, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_EXPORT_URL_TTL", "15m"))
+	if err != nil || privacyExportURLExpiry <= 0 {
+		privacyExportURLExpiry = 15 * time.Minute
+	}
+
+	var officerEmails []string
+	for _, address := range strings.Split(os.Getenv("COMPLIANCE_OFFICER_EMAILS"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			officerEmails = append(officerEmails, address)
+		}
+	}
+
+	retentionInterval, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_RETENTION_INTERVAL", "1h"))
+	if err != nil || retentionInterval <= 0 {
+		retentionInterval = time.Hour
+	}
+
+	retentionBatchSize, _ := strconv.Atoi(os.Getenv("COMPLIANCE_RETENTION_BATCH_SIZE"))
+	if retentionBatchSize <= 0 {
+		retentionBatchSize = 500
+	}
+
+	retentionBatchPause, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_RETENTION_BATCH_PAUSE", "250ms"))
+	if err != nil || retentionBatchPause < 0 {
+		retentionBatchPause = 250 * time.Millisecond
+	}
+
+	auditInterval, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_AUDIT_INTERVAL", "1h"))
+	if err != nil || auditInterval <= 0 {
+		auditInterval = time.Hour
+	}
+
+	auditVerifyWindow, err := time.ParseDuration(getEnvOrDefault("COMPLIANCE_AUDIT_VERIFY_WINDOW", "24h"))
+	if err != nil || auditVerifyWindow <= 0 {
+		auditVerifyWindow = 24 * time.Hour
+	}
+
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if smtpPort <= 0 {
+		smtpPort = 587
+	}
+
 	return &Config{
 		Port:        port,
 		DatabaseURL: databaseURL,
@@ -111,13 +365,91 @@ func Load() (*Config, error) {
 			TileCacheTTL:      getEnvOrDefault("MAPS_TILE_CACHE_TTL", "24h"),
 		},
 		Settings: SettingsConfig{
-			EncryptionKeyHex: os.Getenv("SETTINGS_ENCRYPTION_KEY_HEX"),
-			APIKeyPrefix:     getEnvOrDefault("SETTINGS_API_KEY_PREFIX", "ppk_live"),
-			ProfileCDNBase:   getEnvOrDefault("SETTINGS_PROFILE_CDN_BASE", "https://cdn.carbonscribe.local"),
+			EncryptionKeyHex:         os.Getenv("SETTINGS_ENCRYPTION_KEY_HEX"),
+			APIKeyPrefix:             getEnvOrDefault("SETTINGS_API_KEY_PREFIX", "ppk_live"),
+			ProfileCDNBase:           getEnvOrDefault("SETTINGS_PROFILE_CDN_BASE", "https://cdn.carbonscribe.local"),
+			OAuthProviders:           loadOAuthProviders(),
+			OAuthRefreshWindow:       oauthRefreshWindow,
+			OAuthRefreshInterval:     oauthRefreshInterval,
+			KeyringFile:              os.Getenv("SETTINGS_KMS_KEYRING_FILE"),
+			KeyringKeyID:             getEnvOrDefault("SETTINGS_KMS_KEY_ID", "settings"),
+			KeyRotationInterval:      keyRotationInterval,
+			ReencryptInterval:        reencryptInterval,
+			ProbeInterval:            probeInterval,
+			HealthRetention:          healthRetention,
+			APIKeyUsageFlushInterval: usageFlushInterval,
+			APIKeyWebhookInterval:    webhookInterval,
+			APIKeyExpiryWarning:      expiryWarning,
+			BillingInterval:          billingInterval,
+			UsageMeterInterval:       usageMeterInterval,
+			InvoiceInterval:          invoiceInterval,
+			InvoiceURLExpiry:         invoiceURLExpiry,
+			PaymentTermsDays:         paymentTermsDays,
+			StripeSecretKey:          os.Getenv("STRIPE_SECRET_KEY"),
+			StripeWebhookSecret:      os.Getenv("STRIPE_WEBHOOK_SECRET"),
+			BillingFakeProcessor:     os.Getenv("SETTINGS_BILLING_FAKE_PROCESSOR") == "true",
+			ProfilePictureMaxBytes:   pictureMaxMB << 20,
+			ExportInterval:           exportInterval,
+			ExportRetention:          exportRetention,
+			ExportURLExpiry:          exportURLExpiry,
+		},
+		Reports: ReportsConfig{
+			PeerMinCohortSize:     peerMinCohort,
+			PeerBenchmarkInterval: peerInterval,
+			ExecutionCacheTTL:     executionCacheTTL,
+			SnapshotPurgeInterval: snapshotPurgeInterval,
+		},
+		Compliance: ComplianceConfig{
+			RequestInterval:     requestInterval,
+			EscalateBefore:      escalateBefore,
+			VerificationCodeTTL: verificationCodeTTL,
+			ExportRetention:     privacyExportRetention,
+			ExportURLExpiry:     privacyExportURLExpiry,
+			OfficerEmails:       officerEmails,
+			RetentionInterval:   retentionInterval,
+			RetentionBatchSize:  retentionBatchSize,
+			RetentionBatchPause: retentionBatchPause,
+			ColdStoragePrefix:   getEnvOrDefault("COMPLIANCE_COLD_STORAGE_PREFIX", "cold-storage"),
+			AuditSigningKey:     os.Getenv("COMPLIANCE_AUDIT_SIGNING_KEY"),
+			AuditInterval:       auditInterval,
+			AuditVerifyWindow:   auditVerifyWindow,
+		},
+		Email: EmailConfig{
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     smtpPort,
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			From:         getEnvOrDefault("EMAIL_FROM", "CarbonScribe <no-reply@carbonscribe.io>"),
 		},
 	}, nil
 }
 
+// loadOAuthProviders reads the providers named in SETTINGS_OAUTH_PROVIDERS.
+// Each provider is configured with SETTINGS_OAUTH_<NAME>_* variables, e.g.
+// SETTINGS_OAUTH_STRIPE_CLIENT_ID.
+func loadOAuthProviders() []OAuthProviderConfig {
+	redirectBase := strings.TrimRight(getEnvOrDefault("SETTINGS_OAUTH_REDIRECT_BASE", "http://localhost:3000"), "/")
+	var providers []OAuthProviderConfig
+	for _, name := range strings.Split(os.Getenv("SETTINGS_OAUTH_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "SETTINGS_OAUTH_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OAuthProviderConfig{
+			Name:         name,
+			AuthorizeURL: os.Getenv(prefix + "AUTHORIZE_URL"),
+			TokenURL:     os.Getenv(prefix + "TOKEN_URL"),
+			RevokeURL:    os.Getenv(prefix + "REVOKE_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getEnvOrDefault(prefix+"REDIRECT_URL", redirectBase+"/settings/integrations/oauth/"+name+"/callback"),
+			Scopes:       strings.FieldsFunc(os.Getenv(prefix+"SCOPES"), func(r rune) bool { return r == ',' || r == ' ' }),
+		})
+	}
+	return providers
+}
+
 func getEnvOrDefault(key, defaultVal string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -0,0 +1,33 @@
+-- Migration: 015_report_sharing
+-- Description: Public share links and embed tokens for reports
+-- Date: 2026-10-18
+
+-- Result rows retained so an execution can be shared
+ALTER TABLE report_executions ADD COLUMN IF NOT EXISTS result_snapshot JSONB;
+
+-- Share links and embed tokens
+CREATE TABLE IF NOT EXISTS report_share_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    report_definition_id UUID NOT NULL REFERENCES report_definitions(id) ON DELETE CASCADE,
+    execution_id UUID REFERENCES report_executions(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,  -- 'link', 'embed'
+    scope VARCHAR(20) NOT NULL, -- 'execution', 'live'
+
+    -- Only a SHA-256 hash of the token is stored
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(20) NOT NULL,
+    password_hash VARCHAR(255),
+    password_protected BOOLEAN DEFAULT FALSE,
+    allowed_origins TEXT[], -- frame-ancestors for embed tokens
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID,
+    created_by UUID NOT NULL,
+
+    access_count INTEGER DEFAULT 0,
+    last_accessed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_share_links_report ON report_share_links(report_definition_id);
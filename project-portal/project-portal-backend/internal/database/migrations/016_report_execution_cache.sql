@@ -0,0 +1,18 @@
+-- Migration: 016_report_execution_cache
+-- Description: Execution fingerprints for result reuse and merging identical runs
+-- Date: 2026-10-18
+
+-- Per-report freshness; NULL uses the service default, 0 disables reuse
+ALTER TABLE report_definitions ADD COLUMN IF NOT EXISTS cache_ttl_seconds INTEGER;
+
+-- SHA-256 of report version, format, parameters and data watermark
+ALTER TABLE report_executions ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(64);
+ALTER TABLE report_executions ADD COLUMN IF NOT EXISTS cache_hits INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_report_executions_fingerprint ON report_executions(fingerprint);
+
+-- At most one running execution per fingerprint, so identical requests on
+-- different instances join the same run
+CREATE UNIQUE INDEX IF NOT EXISTS idx_report_executions_inflight
+    ON report_executions(fingerprint)
+    WHERE fingerprint IS NOT NULL AND status IN ('pending', 'processing');
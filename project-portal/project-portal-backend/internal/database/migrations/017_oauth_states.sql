@@ -0,0 +1,20 @@
+-- Migration: 017_oauth_states
+-- Description: Pending OAuth2 authorization-code flows for settings integrations
+-- Date: 2026-10-18
+
+-- Only the SHA-256 of the state parameter is stored; the PKCE code verifier
+-- is encrypted with the settings vault. Rows are deleted when redeemed.
+CREATE TABLE IF NOT EXISTS oauth_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id UUID NOT NULL,
+    provider VARCHAR(100) NOT NULL,
+    code_verifier TEXT NOT NULL,
+    redirect_url TEXT NOT NULL,
+    scopes TEXT[] DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_states_user_id ON oauth_states(user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
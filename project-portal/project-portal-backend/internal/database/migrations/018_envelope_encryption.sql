@@ -0,0 +1,8 @@
+-- Migration: 018_envelope_encryption
+-- Description: Room for envelope ciphertexts in vaulted settings columns
+-- Date: 2026-10-18
+
+-- Envelope ciphertexts carry their key id and wrapped data key, so they are
+-- longer than values sealed with the single legacy key
+ALTER TABLE integration_configurations ALTER COLUMN webhook_secret TYPE TEXT;
+ALTER TABLE subscriptions ALTER COLUMN payment_method_id TYPE TEXT;
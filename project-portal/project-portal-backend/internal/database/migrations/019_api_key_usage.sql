@@ -0,0 +1,23 @@
+-- Migration: 019_api_key_usage
+-- Description: Hourly usage buckets for requests authenticated with settings API keys
+-- Date: 2026-10-18
+
+-- One row per key, hour, route template, method and status code. Replicas
+-- buffer counters in memory and add them with an upsert.
+CREATE TABLE IF NOT EXISTS api_key_usage_buckets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    status_code INTEGER NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    rate_limited BIGINT NOT NULL DEFAULT 0,
+    total_latency_ms BIGINT NOT NULL DEFAULT 0,
+    max_latency_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_key_usage_bucket
+    ON api_key_usage_buckets(key_id, bucket_start, endpoint, method, status_code);
+CREATE INDEX IF NOT EXISTS idx_api_key_usage_buckets_user_id ON api_key_usage_buckets(user_id);
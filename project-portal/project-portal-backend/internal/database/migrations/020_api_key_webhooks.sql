@@ -0,0 +1,34 @@
+-- Migration: 020_api_key_webhooks
+-- Description: Signing secrets and a delivery log for API key lifecycle webhooks
+-- Date: 2026-10-18
+
+-- Vault-encrypted; generated the first time a key gets a webhook subscription
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+
+-- One row per event and target URL. Payload is the exact body sent so
+-- replays are byte-identical; replays are new rows pointing at the original.
+CREATE TABLE IF NOT EXISTS api_key_webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    target_url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    last_attempt_at TIMESTAMPTZ,
+    response_status INTEGER,
+    response_body TEXT,
+    last_error TEXT,
+    replay_of UUID,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_key_id ON api_key_webhook_deliveries(key_id);
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_user_id ON api_key_webhook_deliveries(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_event_id ON api_key_webhook_deliveries(event_id);
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_status ON api_key_webhook_deliveries(status);
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_next_attempt_at ON api_key_webhook_deliveries(next_attempt_at);
@@ -0,0 +1,13 @@
+-- Migration: 021_subscription_plans
+-- Description: Trial, period-end cancellation and credit balance on subscriptions
+-- Date: 2026-10-18
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_ends_at TIMESTAMPTZ;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS trial_used BOOLEAN DEFAULT FALSE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN DEFAULT FALSE;
+
+-- Proration credit owed to the customer, drawn down by later invoices
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS credit_balance DECIMAL(10, 2) DEFAULT 0;
+
+-- The renewal job scans for ended periods
+CREATE INDEX IF NOT EXISTS idx_subscriptions_period_end ON subscriptions(current_period_end);
@@ -0,0 +1,10 @@
+-- Migration: 022_usage_metering
+-- Description: Quota warning state and collection time for metered subscription usage
+-- Date: 2026-10-18
+
+-- Quota name to the highest warning level sent this period; cleared on renewal
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS quota_warnings JSONB DEFAULT '{}';
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS usage_collected_at TIMESTAMPTZ;
+
+-- API calls are metered per user and billing period
+CREATE INDEX IF NOT EXISTS idx_api_key_usage_user_bucket ON api_key_usage_buckets(user_id, bucket_start);
@@ -0,0 +1,23 @@
+-- Migration: 023_invoicing
+-- Description: Sequential invoice numbers, tax per jurisdiction, stored invoice PDFs and credit notes
+-- Date: 2026-10-18
+
+-- Last number issued per series (INV-2026, CN-2026, ...). The row is locked
+-- while an invoice is numbered, so numbers are gap-free.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    series VARCHAR(20) PRIMARY KEY,
+    last_value INTEGER NOT NULL DEFAULT 0
+);
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS kind VARCHAR(20) DEFAULT 'invoice';
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS credited_invoice_id UUID REFERENCES invoices(id);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS amount_credited DECIMAL(10, 2) DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_jurisdiction VARCHAR(20);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_rate BIGINT DEFAULT 0; -- basis points
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS reason TEXT;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS finalized_at TIMESTAMPTZ;
+-- S3 object key of the rendered PDF; links are presigned on request
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS pdf_key TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_invoices_credited_invoice ON invoices(credited_invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_to_issue ON invoices(id) WHERE status = 'draft' OR (finalized_at IS NOT NULL AND COALESCE(pdf_key, '') = '');
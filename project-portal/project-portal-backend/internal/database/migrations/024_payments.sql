@@ -0,0 +1,24 @@
+-- Migration: 024_payments
+-- Description: Payment processor charges, automated dunning and deduplicated payment webhooks
+-- Date: 2026-10-18
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS processor_customer_id VARCHAR(255);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS payment_method_last4 VARCHAR(4);
+-- Set when retries are exhausted; the subscription is canceled after the grace period
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS unpaid_since TIMESTAMPTZ;
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS payment_attempts INTEGER DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS next_payment_attempt TIMESTAMPTZ;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS last_payment_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_invoices_next_payment_attempt ON invoices(next_payment_attempt);
+CREATE INDEX IF NOT EXISTS idx_invoices_transaction_id ON invoices(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_unpaid_since ON subscriptions(unpaid_since) WHERE status = 'unpaid';
+
+-- Processor events already applied, so redeliveries are acknowledged only
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    charge_id VARCHAR(255),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
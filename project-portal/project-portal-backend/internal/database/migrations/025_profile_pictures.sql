@@ -0,0 +1,8 @@
+-- Migration: 025_profile_pictures
+-- Description: Uploaded profile pictures stored as square thumbnails
+-- Date: 2026-10-18
+
+-- Thumbnail edge in pixels -> CDN URL; profile_picture_url is the largest
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS profile_picture_sizes JSONB DEFAULT '{}';
+-- Storage keys of the current picture, deleted when it is replaced
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS profile_picture_keys JSONB;
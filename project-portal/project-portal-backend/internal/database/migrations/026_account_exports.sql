@@ -0,0 +1,21 @@
+-- Migration: 026_account_exports
+-- Description: Requested archives of a user's data across all modules
+-- Date: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS account_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL, -- pending, processing, completed, failed, expired
+    object_key TEXT, -- ZIP in S3 while the export is completed
+    size_bytes BIGINT,
+    manifest JSONB,
+    error TEXT,
+    requested_at TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_exports_user_id ON account_exports(user_id);
+CREATE INDEX IF NOT EXISTS idx_account_exports_status ON account_exports(status);
+CREATE INDEX IF NOT EXISTS idx_account_exports_expires_at ON account_exports(expires_at);
@@ -0,0 +1,13 @@
+-- Migration: 027_privacy_data_providers
+-- Description: Indexes for locating a user's data across modules for privacy requests
+-- Date: 2026-10-18
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created_by ON tasks(created_by);
+CREATE INDEX IF NOT EXISTS idx_shared_resources_uploaded_by ON shared_resources(uploaded_by);
+CREATE INDEX IF NOT EXISTS idx_document_versions_uploaded_by ON document_versions(uploaded_by);
+CREATE INDEX IF NOT EXISTS idx_report_definitions_created_by ON report_definitions(created_by);
+CREATE INDEX IF NOT EXISTS idx_report_executions_triggered_by ON report_executions(triggered_by);
+CREATE INDEX IF NOT EXISTS idx_report_share_links_created_by ON report_share_links(created_by);
+CREATE INDEX IF NOT EXISTS idx_dashboard_widgets_user_id ON dashboard_widgets(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_target_owner_id ON audit_logs(target_owner_id);
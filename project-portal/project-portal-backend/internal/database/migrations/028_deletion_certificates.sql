@@ -0,0 +1,5 @@
+-- Migration: 028_deletion_certificates
+-- Description: Certificates of verified erasure stored with deletion requests
+-- Date: 2026-10-18
+
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS deletion_certificate TEXT; -- JSON: token, counts, digest
@@ -0,0 +1,19 @@
+-- Migration: 029_privacy_request_pipeline
+-- Description: Jurisdiction deadlines, emailed identity verification, escalation and expiring encrypted exports for privacy requests
+-- Date: 2026-10-18
+
+-- Status now moves received -> identity_verified -> processing -> completed | rejected
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS jurisdiction VARCHAR(20) DEFAULT 'global';
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS verification_code TEXT; -- SHA-256 of the emailed one-time code
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS verification_expires TIMESTAMPTZ;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS verification_tries INTEGER DEFAULT 0;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS rejection_reason TEXT;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS export_object_key TEXT; -- AES-256-GCM package; the key is only emailed
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS export_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_due ON privacy_requests(due_at)
+    WHERE status IN ('received', 'identity_verified', 'processing') AND escalated_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_export_expiry ON privacy_requests(export_expires_at)
+    WHERE export_object_key <> '';
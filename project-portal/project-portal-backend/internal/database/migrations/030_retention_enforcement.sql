@@ -0,0 +1,29 @@
+-- Migration: 030_retention_enforcement
+-- Description: One schedule per policy action, seeded for existing policies, and indexes for finding expired rows
+-- Date: 2026-10-18
+
+-- Each policy has at most one archive, delete and review schedule
+CREATE UNIQUE INDEX IF NOT EXISTS idx_retention_schedules_policy_action
+    ON retention_schedules(policy_id, action_type);
+
+-- Schedules for policies created before enforcement existed; enforcement is
+-- due immediately, reviews after the review period
+INSERT INTO retention_schedules (policy_id, data_type, action_type, next_action_date, next_review_date)
+SELECT p.id, p.data_category, a.action_type,
+       CASE WHEN a.action_type = 'review' THEN CURRENT_DATE + p.review_period_days ELSE CURRENT_DATE END,
+       CURRENT_DATE + p.review_period_days
+FROM retention_policies p
+CROSS JOIN (VALUES ('archive'), ('delete'), ('review')) AS a(action_type)
+WHERE p.is_active
+  AND (a.action_type <> 'archive' OR p.archival_period_days IS NOT NULL)
+  AND (a.action_type <> 'delete' OR p.retention_period_days >= 0)
+ON CONFLICT (policy_id, action_type) DO NOTHING;
+
+-- Expired rows are found by age
+CREATE INDEX IF NOT EXISTS idx_api_key_usage_buckets_start ON api_key_usage_buckets(bucket_start);
+CREATE INDEX IF NOT EXISTS idx_api_key_webhook_deliveries_created ON api_key_webhook_deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_invoices_created ON invoices(created_at);
+CREATE INDEX IF NOT EXISTS idx_account_exports_requested ON account_exports(requested_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created ON webhook_deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_report_executions_created ON report_executions(created_at);
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_submitted ON privacy_requests(submitted_at);
@@ -0,0 +1,21 @@
+-- Migration: 031_audit_checkpoints
+-- Description: Signed Merkle checkpoints over ranges of the audit hash chain
+-- Date: 2026-10-18
+
+-- Audit appends are serialised with pg_advisory_xact_lock(7201504), so each
+-- entry links to the one committed before it and log_id follows chain order.
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    first_log_id BIGINT NOT NULL UNIQUE,
+    last_log_id BIGINT NOT NULL UNIQUE,
+    entry_count BIGINT NOT NULL,
+    first_event_time TIMESTAMPTZ NOT NULL,
+    last_event_time TIMESTAMPTZ NOT NULL,
+    merkle_root TEXT NOT NULL,    -- over SHA-256 hashes of the full entries
+    last_hash TEXT NOT NULL,      -- hash_chain of the last entry
+    signature TEXT NOT NULL,      -- HMAC-SHA256 over the range, root and last hash
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_last_event_time ON audit_checkpoints(last_event_time);
@@ -0,0 +1,6 @@
+-- Migration: 032_privacy_request_claims
+-- Description: Claim privacy requests for processing so one worker handles each, take over stalled ones and retry failures
+-- Date: 2026-10-19
+
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS processing_started_at TIMESTAMPTZ;
+ALTER TABLE privacy_requests ADD COLUMN IF NOT EXISTS processing_attempts INTEGER DEFAULT 0;
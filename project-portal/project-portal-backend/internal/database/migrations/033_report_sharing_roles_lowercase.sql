@@ -0,0 +1,8 @@
+-- Migration: 033_report_sharing_roles_lowercase
+-- Description: Lowercase the roles reports are shared with, which are matched against the caller's lowercased role
+-- Date: 2026-10-19
+
+UPDATE report_definitions
+SET shared_with_roles = ARRAY(SELECT DISTINCT LOWER(role) FROM unnest(shared_with_roles) AS role)
+WHERE shared_with_roles IS NOT NULL
+  AND shared_with_roles::text <> LOWER(shared_with_roles::text);
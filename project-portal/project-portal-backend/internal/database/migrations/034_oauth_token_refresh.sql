@@ -0,0 +1,26 @@
+-- Migration: 034_oauth_token_refresh
+-- Description: OAuth tokens of integration connections, with the lease and backoff used to refresh them before expiry
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS o_auth_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    connection_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT,
+    token_type TEXT,
+    expires_at TIMESTAMPTZ,
+    scope TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Consecutive failed refreshes and the earliest next attempt. A worker leases
+-- a token by moving next_refresh_at forward; failures push it back further.
+ALTER TABLE o_auth_tokens ADD COLUMN IF NOT EXISTS refresh_failures BIGINT DEFAULT 0;
+ALTER TABLE o_auth_tokens ADD COLUMN IF NOT EXISTS next_refresh_at TIMESTAMPTZ;
+ALTER TABLE o_auth_tokens ADD COLUMN IF NOT EXISTS last_refresh_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_o_auth_tokens_connection_id ON o_auth_tokens(connection_id);
+CREATE INDEX IF NOT EXISTS idx_o_auth_tokens_expires_at ON o_auth_tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_o_auth_tokens_next_refresh_at ON o_auth_tokens(next_refresh_at);
@@ -0,0 +1,18 @@
+-- Migration: 035_integration_health_history
+-- Description: History of integration health probes, read for uptime and latency trends and pruned past retention
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS integration_healths (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    connection_id TEXT NOT NULL,
+    status TEXT NOT NULL, -- healthy, degraded, down
+    latency_ms BIGINT,
+    error_rate DECIMAL,
+    checked_at TIMESTAMPTZ,
+    message TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_integration_healths_connection_id ON integration_healths(connection_id);
+CREATE INDEX IF NOT EXISTS idx_integration_healths_checked_at ON integration_healths(checked_at);
+-- Trend queries read one connection's probes over a window
+CREATE INDEX IF NOT EXISTS idx_integration_healths_connection_checked ON integration_healths(connection_id, checked_at);
@@ -5,6 +5,8 @@ import (
 	"strconv"
 	"strings"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -39,6 +41,10 @@ func (h *Handler) Transition(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document", TargetID: id.String(), DataCategory: compliance.DataCategoryProjectData,
+		Action: "transition", Before: gin.H{"status": result.FromStatus}, After: gin.H{"status": result.ToStatus},
+	})
 	c.JSON(http.StatusOK, result)
 }
 
@@ -68,6 +74,9 @@ func (h *Handler) CreateWorkflowTemplate(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document_workflow", TargetID: wf.ID.String(), DataCategory: compliance.DataCategoryProjectData, After: wf,
+	})
 	c.JSON(http.StatusCreated, wf)
 }
 
@@ -99,6 +108,10 @@ func (h *Handler) VerifySignature(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document", TargetID: id.String(), DataCategory: compliance.DataCategoryProjectData,
+		Action: "verify_signature", After: result,
+	})
 	c.JSON(http.StatusOK, result)
 }
 
@@ -122,6 +135,7 @@ func (h *Handler) GeneratePDF(c *gin.Context) {
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	recordDocument(c, doc)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":  "PDF generated and stored successfully",
@@ -151,6 +165,7 @@ func (h *Handler) Upload(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordDocument(c, doc)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":  "document uploaded successfully",
@@ -222,10 +237,15 @@ func (h *Handler) Delete(c *gin.Context) {
 
 	ctx := c.Request.Context()
 	userID := extractUserID(c)
-	if err := h.svc.Delete(ctx, id, userID, c.ClientIP(), c.Request.UserAgent()); err != nil {
+	doc, err := h.svc.Delete(ctx, id, userID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document", TargetID: id.String(), TargetOwnerID: ownerID(doc.UploadedBy),
+		DataCategory: compliance.DataCategoryProjectData, Before: doc,
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "document deleted successfully"})
 }
 
@@ -256,6 +276,10 @@ func (h *Handler) UploadVersion(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document_version", TargetID: version.ID.String(), TargetOwnerID: ownerID(version.UploadedBy),
+		DataCategory: compliance.DataCategoryProjectData, After: version,
+	})
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "new version uploaded successfully",
@@ -304,6 +328,22 @@ func (h *Handler) GetVersion(c *gin.Context) {
 
 // --- helpers ---
 
+// recordDocument audits a newly stored document
+func recordDocument(c *gin.Context, doc *Document) {
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "document", TargetID: doc.ID.String(), TargetOwnerID: ownerID(doc.UploadedBy),
+		DataCategory: compliance.DataCategoryProjectData, After: doc,
+	})
+}
+
+// ownerID formats an optional uploader for audit entries
+func ownerID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
 // parseUUID extracts and validates a UUID path parameter.
 func parseUUID(c *gin.Context, param string) (uuid.UUID, error) {
 	id, err := uuid.Parse(c.Param(param))
@@ -0,0 +1,33 @@
+package documents
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the documents module keeps a user's data
+// for privacy requests: the documents they uploaded with every version and
+// signature, and their access history. store removes the stored files.
+func NewPrivacyProvider(db *gorm.DB, store requests.ObjectStore) requests.Provider {
+	const ownDocuments = "document_id IN (SELECT id FROM documents WHERE uploaded_by = @user)"
+	return requests.NewTableProvider("documents", db, store,
+		requests.Table{Name: "document_versions", Category: requests.CategoryProjectData,
+			Where: ownDocuments + " OR uploaded_by = @user", ObjectKeys: "s3_key"},
+		requests.Table{Name: "document_signatures", Category: requests.CategoryProjectData, Where: ownDocuments},
+		requests.Table{Name: "documents", Category: requests.CategoryProjectData, Where: "uploaded_by = @user", ObjectKeys: "s3_key"},
+		requests.Table{Name: "document_access_logs", Category: requests.CategorySystemLogs, Where: "user_id = @user",
+			Anonymize: map[string]interface{}{"user_id": nil, "ip_address": nil, "user_agent": ""}},
+	)
+}
+
+// RetentionTargets lists the documents data that ages out under retention
+// policies. Documents themselves are project records and are kept.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategorySystemLogs, Table: "document_access_logs", TimestampColumn: "performed_at", UserColumn: "user_id",
+			Anonymize:  map[string]interface{}{"user_id": nil, "ip_address": nil, "user_agent": ""},
+			Anonymized: "user_id IS NULL"},
+	}
+}
@@ -114,6 +114,45 @@ func (r *Repository) SoftDelete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// ListByUploader returns the live documents a user uploaded, with their
+// versions
+func (r *Repository) ListByUploader(ctx context.Context, userID uuid.UUID) ([]Document, error) {
+	var docs []Document
+	err := r.db.WithContext(ctx).
+		Preload("Versions").
+		Where("uploaded_by = ? AND deleted_at IS NULL", userID).
+		Order("uploaded_at ASC").
+		Find(&docs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return docs, nil
+}
+
+// StorageBytesByUploader totals the bytes a user has stored: the current
+// file of each live document they uploaded plus the superseded versions
+// they uploaded.
+func (r *Repository) StorageBytesByUploader(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var current, superseded int64
+	err := r.db.WithContext(ctx).Model(&Document{}).
+		Where("uploaded_by = ? AND deleted_at IS NULL", userID).
+		Select("COALESCE(SUM(file_size), 0)").
+		Scan(&current).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum document storage: %w", err)
+	}
+	err = r.db.WithContext(ctx).Model(&DocumentVersion{}).
+		Joins("JOIN documents ON documents.id = document_versions.document_id").
+		Where("document_versions.uploaded_by = ? AND documents.deleted_at IS NULL", userID).
+		Where("document_versions.version_number < documents.current_version").
+		Select("COALESCE(SUM(document_versions.file_size), 0)").
+		Scan(&superseded).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum document version storage: %w", err)
+	}
+	return current + superseded, nil
+}
+
 // LogAccess inserts a document access log entry.
 func (r *Repository) LogAccess(ctx context.Context, log *DocumentAccessLog) error {
 	if err := r.db.WithContext(ctx).Create(log).Error; err != nil {
@@ -192,14 +192,15 @@ func (s *Service) GetVersion(ctx context.Context, docID uuid.UUID, version int)
 	return s.repo.FindVersionByNumber(ctx, docID, version)
 }
 
-// Delete soft-deletes the DB record and removes the object from S3.
-func (s *Service) Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID, ipAddr, ua string) error {
+// Delete soft-deletes the DB record and removes the object from S3,
+// returning the document as it was before deletion.
+func (s *Service) Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID, ipAddr, ua string) (*Document, error) {
 	doc, err := s.repo.FindByID(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := s.repo.SoftDelete(ctx, id); err != nil {
-		return err
+		return nil, err
 	}
 	if err := s.storage.Delete(ctx, doc.S3Key); err != nil {
 		fmt.Printf("WARNING: S3 delete failed for key %q: %v\n", doc.S3Key, err)
@@ -212,7 +213,7 @@ func (s *Service) Delete(ctx context.Context, id uuid.UUID, userID *uuid.UUID, i
 		UserAgent:   ua,
 		PerformedAt: time.Now().UTC(),
 	})
-	return nil
+	return doc, nil
 }
 
 // ─── IPFS helpers ─────────────────────────────────────────────────────────────
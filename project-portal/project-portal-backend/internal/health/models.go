@@ -285,6 +285,18 @@ type AlertQuery struct {
 	Limit       int       `form:"limit,default=100"`
 }
 
+// RaiseAlertRequest represents an alert raised by another service
+type RaiseAlertRequest struct {
+	AlertID     string                 `json:"alert_id"` // deduplication key
+	AlertName   string                 `json:"alert_name"`
+	Severity    string                 `json:"severity"` // info, warning, critical
+	Source      string                 `json:"source"`
+	ServiceName string                 `json:"service_name"`
+	ResourceID  string                 `json:"resource_id,omitempty"`
+	Description string                 `json:"description"`
+	Condition   map[string]interface{} `json:"condition"`
+}
+
 // AcknowledgeAlertRequest represents the request to acknowledge an alert
 type AcknowledgeAlertRequest struct {
 	AcknowledgedBy string `json:"acknowledged_by" binding:"required"`
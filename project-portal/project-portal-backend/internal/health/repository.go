@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Repository defines the interface for health metrics data access
@@ -26,6 +27,7 @@ type Repository interface {
 	GetSystemAlertByID(ctx context.Context, id string) (*SystemAlert, error)
 	QuerySystemAlerts(ctx context.Context, query AlertQuery) ([]SystemAlert, error)
 	UpdateSystemAlert(ctx context.Context, alert *SystemAlert) error
+	CreateSystemAlert(ctx context.Context, alert *SystemAlert) (bool, error)
 
 	// Reports
 	GetLatestSnapshot(ctx context.Context, snapshotType string) (*SystemStatusSnapshot, error)
@@ -137,6 +139,13 @@ func (r *repository) UpdateSystemAlert(ctx context.Context, alert *SystemAlert)
 	return r.db.WithContext(ctx).Save(alert).Error
 }
 
+// CreateSystemAlert stores an alert unless one with the same alert ID exists,
+// reporting whether it was created
+func (r *repository) CreateSystemAlert(ctx context.Context, alert *SystemAlert) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "alert_id"}}, DoNothing: true}).Create(alert)
+	return res.RowsAffected > 0, res.Error
+}
+
 func (r *repository) GetSystemAlertByID(ctx context.Context, id string) (*SystemAlert, error) {
 	var alert SystemAlert
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&alert).Error
@@ -26,6 +26,7 @@ type Service interface {
 	// System Alerts
 	GetSystemAlerts(ctx context.Context, query AlertQuery) ([]SystemAlert, error)
 	AcknowledgeAlert(ctx context.Context, id string, userID string) (*SystemAlert, error)
+	RaiseAlert(ctx context.Context, req RaiseAlertRequest) (*SystemAlert, error)
 
 	// Reports
 	GetDailyReport(ctx context.Context) (*SystemStatusSnapshot, error)
@@ -240,6 +241,37 @@ func (s *service) AcknowledgeAlert(ctx context.Context, id string, userID string
 	return alert, nil
 }
 
+// RaiseAlert fires an alert from another part of the system. Alerts are
+// deduplicated on their alert ID, so raising the same alert again is a no-op.
+func (s *service) RaiseAlert(ctx context.Context, req RaiseAlertRequest) (*SystemAlert, error) {
+	condition, err := json.Marshal(req.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alert condition: %w", err)
+	}
+	now := time.Now()
+	alert := &SystemAlert{
+		AlertID:       req.AlertID,
+		AlertName:     req.AlertName,
+		AlertSeverity: req.Severity,
+		AlertSource:   req.Source,
+		ServiceName:   req.ServiceName,
+		ResourceID:    req.ResourceID,
+		Description:   req.Description,
+		Condition:     datatypes.JSON(condition),
+		Status:        "firing",
+		FiredAt:       now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if alert.AlertSeverity == "" {
+		alert.AlertSeverity = "critical"
+	}
+	if _, err := s.repo.CreateSystemAlert(ctx, alert); err != nil {
+		return nil, fmt.Errorf("failed to raise alert: %w", err)
+	}
+	return alert, nil
+}
+
 // ========== Reports ==========
 
 func (s *service) GetDailyReport(ctx context.Context) (*SystemStatusSnapshot, error) {
@@ -3,6 +3,8 @@ package integration
 import (
 	"net/http"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,6 +28,8 @@ func (h *Handler) RegisterConnection(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// Credentials are not serialised, so they never reach the audit log
+	recordChange(c, "integration_connection", conn.ID, "", conn)
 
 	c.JSON(http.StatusCreated, conn)
 }
@@ -42,6 +46,7 @@ func (h *Handler) ConfigureWebhook(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "webhook_config", webhook.ID, "", webhook)
 
 	c.JSON(http.StatusCreated, webhook)
 }
@@ -64,6 +69,7 @@ func (h *Handler) SubscribeToEvent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "event_subscription", sub.ID, "", sub)
 
 	c.JSON(http.StatusCreated, sub)
 }
@@ -94,6 +100,18 @@ func (h *Handler) OAuth2Callback(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "oauth_connection", "", "connect", gin.H{"provider": provider})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Authentication successful"})
 }
+
+// recordChange audits a created or connected integration record
+func recordChange(c *gin.Context, targetType, targetID, action string, after any) {
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType:   targetType,
+		TargetID:     targetID,
+		DataCategory: "integrations",
+		Action:       action,
+		After:        after,
+	})
+}
@@ -66,16 +66,19 @@ type EventSubscription struct {
 
 // OAuthToken represents stored OAuth2 tokens for integrations
 type OAuthToken struct {
-	ID           string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	ConnectionID string    `gorm:"index;not null" json:"connection_id"`
-	Provider     string    `gorm:"not null" json:"provider"`
-	AccessToken  string    `gorm:"not null" json:"-"`
-	RefreshToken string    `json:"-"`
-	TokenType    string    `json:"token_type"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	Scope        string    `json:"scope"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	ConnectionID     string     `gorm:"index;not null" json:"connection_id"`
+	Provider         string     `gorm:"not null" json:"provider"`
+	AccessToken      string     `gorm:"not null" json:"-"`
+	RefreshToken     string     `json:"-"`
+	TokenType        string     `json:"token_type"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expires_at"`
+	Scope            string     `json:"scope"`
+	RefreshFailures  int        `gorm:"default:0" json:"refresh_failures"`      // consecutive failed refresh attempts
+	NextRefreshAt    *time.Time `gorm:"index" json:"next_refresh_at,omitempty"` // earliest next attempt (backoff or lease)
+	LastRefreshError string     `json:"last_refresh_error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 // IntegrationHealth represents the health status of a connection
@@ -0,0 +1,31 @@
+package integration
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the integration module keeps a user's
+// data for privacy requests. Connections belong to the platform; only logged
+// webhook payloads about the user are personal, and they are blanked on
+// erasure so delivery history stays intact.
+func NewPrivacyProvider(db *gorm.DB) requests.Provider {
+	return requests.NewTableProvider("integration", db, nil,
+		requests.Table{Name: "webhook_deliveries", Category: requests.CategorySystemLogs,
+			Where:     "payload::jsonb->>'user_id' = @user OR payload::jsonb->>'actor_id' = @user",
+			Anonymize: map[string]interface{}{"payload": "{}"}},
+	)
+}
+
+// RetentionTargets lists the integration data that ages out under retention
+// policies. Deliveries still being retried are left alone.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategorySystemLogs, Table: "webhook_deliveries", TimestampColumn: "created_at",
+			Where:      "status <> 'pending'",
+			Anonymize:  map[string]interface{}{"payload": "{}"},
+			Anonymized: "payload::text = '{}'"},
+	}
+}
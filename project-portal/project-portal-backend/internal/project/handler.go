@@ -1,9 +1,13 @@
 package project
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -23,11 +27,22 @@ func (h *Handler) CreateProject(c *gin.Context) {
 		return
 	}
 
-	project, err := h.service.CreateProject(c.Request.Context(), &req)
+	// The creating user is optional unless plan quotas are enforced
+	userID, _ := uuid.Parse(c.GetHeader("X-User-ID"))
+	project, err := h.service.CreateProject(c.Request.Context(), userID, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var entErr *settings.EntitlementError
+		switch {
+		case errors.As(err, &entErr):
+			c.JSON(http.StatusPaymentRequired, entErr)
+		case errors.Is(err, ErrOwnerRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{TargetType: "project", TargetID: project.ID.String(), After: project})
 
 	c.JSON(http.StatusCreated, project)
 }
@@ -76,11 +91,17 @@ func (h *Handler) UpdateProject(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetProject(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
 	project, err := h.service.UpdateProject(c.Request.Context(), id, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{TargetType: "project", TargetID: idStr, Before: before, After: project})
 
 	c.JSON(http.StatusOK, project)
 }
@@ -93,11 +114,17 @@ func (h *Handler) DeleteProject(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetProject(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
 	err = h.service.DeleteProject(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{TargetType: "project", TargetID: idStr, Before: before})
 
 	c.JSON(http.StatusOK, gin.H{"message": "project deleted"})
 }
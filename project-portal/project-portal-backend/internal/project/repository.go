@@ -13,6 +13,8 @@ type Repository interface {
 	List(ctx context.Context, limit, offset int) ([]Project, error)
 	Update(ctx context.Context, project *Project) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	CountActiveByOwner(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetOwnerID(ctx context.Context, projectID uuid.UUID) (uuid.UUID, error)
 }
 
 type repository struct {
@@ -49,3 +51,29 @@ func (r *repository) Update(ctx context.Context, project *Project) error {
 func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	return r.db.WithContext(ctx).Delete(&Project{}, "id = ?", id).Error
 }
+
+// CountActiveByOwner counts the active and pending projects a user owns
+// through their project membership
+func (r *repository) CountActiveByOwner(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Project{}).
+		Joins("JOIN project_members ON project_members.project_id = projects.id::text").
+		Where("project_members.user_id = ? AND project_members.role = ? AND project_members.deleted_at IS NULL", userID.String(), "Owner").
+		Where("projects.status IN ?", []string{"active", "pending"}).
+		Count(&count).Error
+	return count, err
+}
+
+// GetOwnerID returns the user holding the project's Owner membership, or
+// uuid.Nil when it has none
+func (r *repository) GetOwnerID(ctx context.Context, projectID uuid.UUID) (uuid.UUID, error) {
+	var userIDs []string
+	err := r.db.WithContext(ctx).Table("project_members").
+		Where("project_id = ? AND role = ? AND deleted_at IS NULL", projectID.String(), "Owner").
+		Order("created_at").Limit(1).
+		Pluck("user_id", &userIDs).Error
+	if err != nil || len(userIDs) == 0 {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(userIDs[0])
+}
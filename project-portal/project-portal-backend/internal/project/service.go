@@ -3,13 +3,27 @@ package project
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
 	"github.com/google/uuid"
 )
 
+// ErrOwnerRequired is returned when a project is created without a user to
+// count it against
+var ErrOwnerRequired = errors.New("X-User-ID header is required to create a project")
+
+// PlanBilling enforces plan quotas on new projects and meters the credits
+// issued to them; settings.Service implements it
+type PlanBilling interface {
+	CheckQuota(ctx context.Context, userID uuid.UUID, quota string, increment int64) error
+	RecordUsage(ctx context.Context, userID uuid.UUID, metric string, quantity int64) error
+}
+
 type Service interface {
-	CreateProject(ctx context.Context, req *ProjectCreateRequest) (*Project, error)
+	CreateProject(ctx context.Context, userID uuid.UUID, req *ProjectCreateRequest) (*Project, error)
 	GetProject(ctx context.Context, id uuid.UUID) (*Project, error)
 	ListProjects(ctx context.Context, limit, offset int) ([]Project, error)
 	UpdateProject(ctx context.Context, id uuid.UUID, req *ProjectUpdateRequest) (*Project, error)
@@ -17,14 +31,30 @@ type Service interface {
 }
 
 type service struct {
-	repo Repository
+	repo    Repository
+	billing PlanBilling
 }
 
 func NewService(repo Repository) Service {
 	return &service{repo: repo}
 }
 
-func (s *service) CreateProject(ctx context.Context, req *ProjectCreateRequest) (*Project, error) {
+// NewServiceWithBilling creates a project service that counts new projects
+// against the creating user's plan quota and meters credits minted
+func NewServiceWithBilling(repo Repository, billing PlanBilling) Service {
+	return &service{repo: repo, billing: billing}
+}
+
+func (s *service) CreateProject(ctx context.Context, userID uuid.UUID, req *ProjectCreateRequest) (*Project, error) {
+	if s.billing != nil {
+		if userID == uuid.Nil {
+			return nil, ErrOwnerRequired
+		}
+		if err := s.billing.CheckQuota(ctx, userID, settingsbilling.QuotaProjects, 1); err != nil {
+			return nil, err
+		}
+	}
+
 	project := &Project{
 		Name:          req.Name,
 		Type:          req.Type,
@@ -55,6 +85,7 @@ func (s *service) CreateProject(ctx context.Context, req *ProjectCreateRequest)
 	if err != nil {
 		return nil, err
 	}
+	s.recordCreditsMinted(ctx, userID, project.ID, project.CarbonCredits)
 
 	return project, nil
 }
@@ -94,6 +125,7 @@ func (s *service) UpdateProject(ctx context.Context, id uuid.UUID, req *ProjectU
 	if req.Farmers != nil {
 		project.Farmers = *req.Farmers
 	}
+	previousCredits := project.CarbonCredits
 	if req.CarbonCredits != nil {
 		project.CarbonCredits = *req.CarbonCredits
 	}
@@ -120,6 +152,14 @@ func (s *service) UpdateProject(ctx context.Context, id uuid.UUID, req *ProjectU
 	if err != nil {
 		return nil, err
 	}
+	if minted := project.CarbonCredits - previousCredits; minted > 0 {
+		ownerID, err := s.repo.GetOwnerID(ctx, project.ID)
+		if err != nil {
+			log.Printf("project %s: failed to find owner to meter %d credits: %v", project.ID, minted, err)
+		} else {
+			s.recordCreditsMinted(ctx, ownerID, project.ID, minted)
+		}
+	}
 
 	return project, nil
 }
@@ -127,3 +167,18 @@ func (s *service) UpdateProject(ctx context.Context, id uuid.UUID, req *ProjectU
 func (s *service) DeleteProject(ctx context.Context, id uuid.UUID) error {
 	return s.repo.Delete(ctx, id)
 }
+
+// recordCreditsMinted meters credits issued to a project against the
+// owner's plan. A failure is logged rather than undoing the issuance.
+func (s *service) recordCreditsMinted(ctx context.Context, ownerID, projectID uuid.UUID, credits int) {
+	if s.billing == nil || credits <= 0 {
+		return
+	}
+	if ownerID == uuid.Nil {
+		log.Printf("project %s: no owner to meter %d credits against", projectID, credits)
+		return
+	}
+	if err := s.billing.RecordUsage(ctx, ownerID, settingsbilling.MetricCreditsMinted, int64(credits)); err != nil {
+		log.Printf("project %s: failed to meter %d credits: %v", projectID, credits, err)
+	}
+}
@@ -0,0 +1,67 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ImportBenchmark creates a benchmark dataset from a published CSV or XLSX
+// table. The whole file is rejected if any row fails validation, so a dataset
+// is never stored with silently dropped metrics.
+func (s *service) ImportBenchmark(ctx context.Context, req ImportBenchmarkRequest, filename string, r io.Reader) (*BenchmarkImportResponse, error) {
+	format, err := benchmarks.DetectImportFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ConfidenceScore < 0 || req.ConfidenceScore > 1 {
+		return nil, fmt.Errorf("confidence_score must be between 0 and 1")
+	}
+
+	parsed, err := benchmarks.ParseBenchmarkTable(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed.Errors) > 0 {
+		return &BenchmarkImportResponse{Errors: parsed.Errors}, nil
+	}
+	if len(parsed.Metrics) == 0 {
+		return nil, fmt.Errorf("benchmark table contains no metrics")
+	}
+
+	data, err := json.Marshal(parsed.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize benchmark data: %w", err)
+	}
+
+	dataset := &BenchmarkDataset{
+		ID:              uuid.New(),
+		Name:            req.Name,
+		Description:     req.Description,
+		Category:        req.Category,
+		Methodology:     req.Methodology,
+		Region:          req.Region,
+		Data:            datatypes.JSON(data),
+		Year:            req.Year,
+		Source:          req.Source,
+		ConfidenceScore: req.ConfidenceScore,
+		IsActive:        true,
+	}
+
+	if err := s.repo.CreateBenchmarkDataset(ctx, dataset); err != nil {
+		return nil, fmt.Errorf("failed to create benchmark: %w", err)
+	}
+
+	return &BenchmarkImportResponse{
+		Dataset:      dataset,
+		RowsImported: parsed.Rows,
+	}, nil
+}
@@ -12,8 +12,9 @@ import (
 
 // Comparator handles benchmark comparison logic
 type Comparator struct {
-	repository BenchmarkRepository
-	metrics    MetricsProvider
+	repository    BenchmarkRepository
+	metrics       MetricsProvider
+	minCohortSize int
 }
 
 // BenchmarkRepository defines the interface for benchmark data access
@@ -73,6 +74,7 @@ type ProjectMetrics struct {
 	Metrics     map[string]float64 `json:"metrics"`
 	Methodology string             `json:"methodology"`
 	Region      string             `json:"region"`
+	Year        int                `json:"year,omitempty"`
 }
 
 // ComparisonRequest represents a benchmark comparison request
@@ -124,11 +126,20 @@ type GapAnalysisItem struct {
 // NewComparator creates a new benchmark comparator
 func NewComparator(repository BenchmarkRepository, metrics MetricsProvider) *Comparator {
 	return &Comparator{
-		repository: repository,
-		metrics:    metrics,
+		repository:    repository,
+		metrics:       metrics,
+		minCohortSize: DefaultMinCohortSize,
 	}
 }
 
+// WithMinCohortSize sets the smallest peer group for which percentiles are reported
+func (c *Comparator) WithMinCohortSize(k int) *Comparator {
+	if k > 0 {
+		c.minCohortSize = k
+	}
+	return c
+}
+
 // Compare performs a benchmark comparison
 func (c *Comparator) Compare(ctx context.Context, req ComparisonRequest) (*ComparisonResult, error) {
 	// Get project metrics
@@ -423,6 +434,10 @@ func (c *Comparator) CalculatePercentileFromPeers(ctx context.Context, projectID
 		return 0, fmt.Errorf("project or metric not found")
 	}
 
+	if len(values) < c.minCohortSize {
+		return 0, ErrCohortTooSmall
+	}
+
 	// Sort values
 	sort.Float64s(values)
 
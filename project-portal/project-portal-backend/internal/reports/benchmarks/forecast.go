@@ -0,0 +1,454 @@
+package benchmarks
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ForecastModel defines the model used to project a series forward
+type ForecastModel string
+
+const (
+	ForecastLinear      ForecastModel = "linear"
+	ForecastHoltWinters ForecastModel = "holt_winters"
+)
+
+const (
+	// DefaultForecastHorizon is the number of periods projected when none is requested
+	DefaultForecastHorizon = 12
+	// MaxForecastHorizon limits how far ahead a forecast may extend
+	MaxForecastHorizon = 120
+	// DefaultForecastConfidence is the coverage of the prediction interval
+	DefaultForecastConfidence = 0.95
+
+	forecastDateFormat = "2006-01-02"
+)
+
+// smoothingGrid lists the candidate smoothing parameters tried when fitting Holt-Winters
+var smoothingGrid = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+
+// ForecastOptions controls how a series is projected
+type ForecastOptions struct {
+	Model        ForecastModel `json:"model,omitempty"`         // empty selects holt_winters when the series covers two seasons, otherwise linear
+	Horizon      int           `json:"horizon,omitempty"`       // periods to project
+	SeasonLength int           `json:"season_length,omitempty"` // periods per season, 0 or 1 for none
+	Confidence   float64       `json:"confidence,omitempty"`    // prediction interval coverage, e.g. 0.95
+	NonNegative  bool          `json:"non_negative,omitempty"`  // clamp projections at zero
+}
+
+// ForecastPoint is a projected value with its prediction interval
+type ForecastPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// SeasonalDecomposition splits a series into additive trend, seasonal and
+// residual components. Trend and residual are null at the edges of the series
+// where the centred moving average is undefined.
+type SeasonalDecomposition struct {
+	SeasonLength  int        `json:"season_length"`
+	SeasonalIndex []float64  `json:"seasonal_index"`
+	Trend         []*float64 `json:"trend"`
+	Seasonal      []float64  `json:"seasonal"`
+	Residual      []*float64 `json:"residual"`
+}
+
+// ForecastResult represents a fitted model and its projections
+type ForecastResult struct {
+	Model         ForecastModel          `json:"model"`
+	Horizon       int                    `json:"horizon"`
+	SeasonLength  int                    `json:"season_length,omitempty"`
+	Confidence    float64                `json:"confidence"`
+	Parameters    map[string]float64     `json:"parameters,omitempty"`
+	RMSE          float64                `json:"rmse"`
+	Points        []ForecastPoint        `json:"points"`
+	Decomposition *SeasonalDecomposition `json:"decomposition,omitempty"`
+}
+
+// Forecast fits the requested model to evenly spaced data points and projects
+// it forward. Dates of projected points continue the spacing of the input.
+func (t *TrendAnalyzer) Forecast(dataPoints []DataPoint, opts ForecastOptions) (*ForecastResult, error) {
+	if opts.Horizon <= 0 {
+		opts.Horizon = DefaultForecastHorizon
+	}
+	if opts.Horizon > MaxForecastHorizon {
+		return nil, fmt.Errorf("horizon must not exceed %d periods", MaxForecastHorizon)
+	}
+	if opts.Confidence == 0 {
+		opts.Confidence = DefaultForecastConfidence
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return nil, fmt.Errorf("confidence must be between 0 and 1")
+	}
+	if opts.SeasonLength < 0 {
+		return nil, fmt.Errorf("season_length must not be negative")
+	}
+
+	values := make([]float64, len(dataPoints))
+	for i, dp := range dataPoints {
+		values[i] = dp.Value
+	}
+
+	seasonal := opts.SeasonLength > 1 && len(values) >= 2*opts.SeasonLength
+	if opts.Model == "" {
+		opts.Model = ForecastLinear
+		if seasonal {
+			opts.Model = ForecastHoltWinters
+		}
+	}
+
+	var (
+		result *ForecastResult
+		err    error
+	)
+	switch opts.Model {
+	case ForecastLinear:
+		result, err = forecastLinear(values, opts, seasonal)
+	case ForecastHoltWinters:
+		result, err = forecastHoltWinters(values, opts, seasonal)
+	default:
+		return nil, fmt.Errorf("unsupported forecast model: %s", opts.Model)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if seasonal {
+		result.SeasonLength = opts.SeasonLength
+		result.Decomposition = DecomposeSeasonal(values, opts.SeasonLength)
+	}
+
+	dates := nextPeriodDates(dataPoints, opts.Horizon)
+	for i := range result.Points {
+		result.Points[i].Date = dates[i]
+		if opts.NonNegative {
+			result.Points[i].Value = math.Max(result.Points[i].Value, 0)
+			result.Points[i].Lower = math.Max(result.Points[i].Lower, 0)
+			result.Points[i].Upper = math.Max(result.Points[i].Upper, 0)
+		}
+	}
+
+	return result, nil
+}
+
+// forecastLinear fits an ordinary least squares trend, on the deseasonalised
+// series when seasonal is set, and uses the standard OLS prediction interval.
+func forecastLinear(values []float64, opts ForecastOptions, seasonal bool) (*ForecastResult, error) {
+	n := len(values)
+	if n < 3 {
+		return nil, fmt.Errorf("linear forecast requires at least 3 data points")
+	}
+
+	var index []float64
+	adjusted := values
+	if seasonal {
+		index = seasonalIndex(values, opts.SeasonLength)
+		adjusted = make([]float64, n)
+		for i, v := range values {
+			adjusted[i] = v - index[i%opts.SeasonLength]
+		}
+	}
+	season := func(i int) float64 {
+		if index == nil {
+			return 0
+		}
+		return index[i%opts.SeasonLength]
+	}
+
+	meanX := float64(n-1) / 2
+	meanY := mean(adjusted)
+	sxx, sxy := 0.0, 0.0
+	for i, y := range adjusted {
+		dx := float64(i) - meanX
+		sxx += dx * dx
+		sxy += dx * (y - meanY)
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+
+	sse := 0.0
+	for i, y := range adjusted {
+		r := y - (intercept + slope*float64(i))
+		sse += r * r
+	}
+	stdErr := math.Sqrt(sse / float64(n-2))
+	z := zScore(opts.Confidence)
+
+	points := make([]ForecastPoint, opts.Horizon)
+	for h := range points {
+		x := float64(n + h)
+		value := intercept + slope*x + season(n+h)
+		margin := z * stdErr * math.Sqrt(1+1/float64(n)+(x-meanX)*(x-meanX)/sxx)
+		points[h] = ForecastPoint{Value: value, Lower: value - margin, Upper: value + margin}
+	}
+
+	return &ForecastResult{
+		Model:      ForecastLinear,
+		Horizon:    opts.Horizon,
+		Confidence: opts.Confidence,
+		Parameters: map[string]float64{"intercept": intercept, "slope": slope},
+		RMSE:       math.Sqrt(sse / float64(n)),
+		Points:     points,
+	}, nil
+}
+
+// forecastHoltWinters fits additive Holt-Winters exponential smoothing, or
+// Holt's linear method when the series is too short to estimate seasonality.
+// Smoothing parameters are chosen by minimising the one-step-ahead error.
+func forecastHoltWinters(values []float64, opts ForecastOptions, seasonal bool) (*ForecastResult, error) {
+	m := 0
+	if seasonal {
+		m = opts.SeasonLength
+	} else if len(values) < 4 {
+		return nil, fmt.Errorf("holt_winters forecast requires at least 4 data points")
+	}
+
+	gammas := []float64{0}
+	if seasonal {
+		gammas = smoothingGrid
+	}
+
+	var best *holtWintersFit
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			for _, gamma := range gammas {
+				fit := fitHoltWinters(values, m, alpha, beta, gamma)
+				if best == nil || fit.sse < best.sse {
+					best = fit
+				}
+			}
+		}
+	}
+
+	sigma := math.Sqrt(best.sse / float64(best.fitted))
+	z := zScore(opts.Confidence)
+
+	points := make([]ForecastPoint, opts.Horizon)
+	variance := 1.0
+	for h := 1; h <= opts.Horizon; h++ {
+		value := best.level + float64(h)*best.trend
+		if m > 0 {
+			value += best.season[(h-1)%m]
+		}
+		if h > 1 {
+			j := h - 1
+			c := best.alpha * (1 + float64(j)*best.beta)
+			if m > 0 && j%m == 0 {
+				c += best.gamma
+			}
+			variance += c * c
+		}
+		margin := z * sigma * math.Sqrt(variance)
+		points[h-1] = ForecastPoint{Value: value, Lower: value - margin, Upper: value + margin}
+	}
+
+	params := map[string]float64{"alpha": best.alpha, "beta": best.beta}
+	if m > 0 {
+		params["gamma"] = best.gamma
+	}
+
+	return &ForecastResult{
+		Model:      ForecastHoltWinters,
+		Horizon:    opts.Horizon,
+		Confidence: opts.Confidence,
+		Parameters: params,
+		RMSE:       sigma,
+		Points:     points,
+	}, nil
+}
+
+// holtWintersFit holds the final state of a Holt-Winters run. season is
+// ordered so that season[0] applies to the first forecast period.
+type holtWintersFit struct {
+	alpha, beta, gamma float64
+	level, trend       float64
+	season             []float64
+	sse                float64
+	fitted             int
+}
+
+func fitHoltWinters(values []float64, m int, alpha, beta, gamma float64) *holtWintersFit {
+	fit := &holtWintersFit{alpha: alpha, beta: beta, gamma: gamma}
+
+	var season []float64
+	start := 1
+	if m > 0 {
+		// Level starts at the end of the first season, seasonals from the
+		// classical decomposition so the initial trend is not absorbed into them
+		first := mean(values[:m])
+		fit.trend = (mean(values[m:2*m]) - first) / float64(m)
+		fit.level = first + fit.trend*float64(m-1)/2
+		season = seasonalIndex(values, m)
+		start = m
+	} else {
+		fit.level = values[0]
+		fit.trend = values[1] - values[0]
+	}
+
+	for t := start; t < len(values); t++ {
+		s := 0.0
+		if m > 0 {
+			s = season[t%m]
+		}
+		predicted := fit.level + fit.trend + s
+		err := values[t] - predicted
+		fit.sse += err * err
+		fit.fitted++
+
+		prevLevel := fit.level
+		fit.level = alpha*(values[t]-s) + (1-alpha)*(fit.level+fit.trend)
+		fit.trend = beta*(fit.level-prevLevel) + (1-beta)*fit.trend
+		if m > 0 {
+			season[t%m] = gamma*(values[t]-fit.level) + (1-gamma)*s
+		}
+	}
+
+	if m > 0 {
+		fit.season = make([]float64, m)
+		for i := 0; i < m; i++ {
+			fit.season[i] = season[(len(values)+i)%m]
+		}
+	}
+	if fit.fitted == 0 {
+		fit.fitted = 1
+	}
+
+	return fit
+}
+
+// DecomposeSeasonal performs a classical additive decomposition using a
+// centred moving average of one season.
+func DecomposeSeasonal(values []float64, m int) *SeasonalDecomposition {
+	n := len(values)
+	trend := centredMovingAverage(values, m)
+	index := seasonalIndexFromTrend(values, trend, m)
+
+	decomposition := &SeasonalDecomposition{
+		SeasonLength:  m,
+		SeasonalIndex: index,
+		Trend:         make([]*float64, n),
+		Seasonal:      make([]float64, n),
+		Residual:      make([]*float64, n),
+	}
+	for i, v := range values {
+		decomposition.Seasonal[i] = index[i%m]
+		if math.IsNaN(trend[i]) {
+			continue
+		}
+		tr := trend[i]
+		residual := v - tr - index[i%m]
+		decomposition.Trend[i] = &tr
+		decomposition.Residual[i] = &residual
+	}
+	return decomposition
+}
+
+func seasonalIndex(values []float64, m int) []float64 {
+	return seasonalIndexFromTrend(values, centredMovingAverage(values, m), m)
+}
+
+// seasonalIndexFromTrend averages the detrended values for each phase of the
+// season and centres the result so the index sums to zero.
+func seasonalIndexFromTrend(values, trend []float64, m int) []float64 {
+	sums := make([]float64, m)
+	counts := make([]int, m)
+	for i, v := range values {
+		if math.IsNaN(trend[i]) {
+			continue
+		}
+		sums[i%m] += v - trend[i]
+		counts[i%m]++
+	}
+
+	index := make([]float64, m)
+	total := 0.0
+	for p := range index {
+		if counts[p] > 0 {
+			index[p] = sums[p] / float64(counts[p])
+		}
+		total += index[p]
+	}
+	for p := range index {
+		index[p] -= total / float64(m)
+	}
+	return index
+}
+
+// centredMovingAverage returns the m-period centred moving average, using a
+// 2×m average for even m. Undefined positions at the edges are NaN.
+func centredMovingAverage(values []float64, m int) []float64 {
+	n := len(values)
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+
+	half := m / 2
+	for i := half; i < n-half; i++ {
+		if m%2 == 1 {
+			out[i] = mean(values[i-half : i+half+1])
+			continue
+		}
+		if i+half >= n {
+			break
+		}
+		sum := 0.5*values[i-half] + 0.5*values[i+half]
+		for j := i - half + 1; j < i+half; j++ {
+			sum += values[j]
+		}
+		out[i] = sum / float64(m)
+	}
+	return out
+}
+
+// nextPeriodDates continues the spacing of the input dates. Month-aligned
+// series step by whole months; other series step by the last interval.
+func nextPeriodDates(points []DataPoint, horizon int) []string {
+	dates := make([]string, horizon)
+	if len(points) < 2 {
+		for i := range dates {
+			dates[i] = fmt.Sprintf("+%d", i+1)
+		}
+		return dates
+	}
+
+	last, err1 := time.Parse(forecastDateFormat, points[len(points)-1].Date)
+	prev, err2 := time.Parse(forecastDateFormat, points[len(points)-2].Date)
+	if err1 != nil || err2 != nil || !last.After(prev) {
+		for i := range dates {
+			dates[i] = fmt.Sprintf("+%d", i+1)
+		}
+		return dates
+	}
+
+	months := (last.Year()-prev.Year())*12 + int(last.Month()-prev.Month())
+	for i := range dates {
+		var next time.Time
+		if last.Day() == prev.Day() && months > 0 {
+			next = last.AddDate(0, months*(i+1), 0)
+		} else {
+			next = last.Add(last.Sub(prev) * time.Duration(i+1))
+		}
+		dates[i] = next.Format(forecastDateFormat)
+	}
+	return dates
+}
+
+// zScore returns the two-sided standard normal quantile for a coverage level
+func zScore(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
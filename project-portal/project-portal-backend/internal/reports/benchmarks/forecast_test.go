@@ -0,0 +1,81 @@
+package benchmarks
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func monthlySeries(n int, f func(i int) float64) []DataPoint {
+	start := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]DataPoint, n)
+	for i := range points {
+		points[i] = DataPoint{Date: start.AddDate(0, i, 0).Format("2006-01-02"), Value: f(i)}
+	}
+	return points
+}
+
+func TestForecastLinear(t *testing.T) {
+	points := monthlySeries(24, func(i int) float64 { return 100 + 5*float64(i) + float64(i%2) })
+
+	result, err := NewTrendAnalyzer(nil).Forecast(points, ForecastOptions{Model: ForecastLinear, Horizon: 6})
+	if err != nil {
+		t.Fatalf("Forecast error: %v", err)
+	}
+	if len(result.Points) != 6 {
+		t.Fatalf("expected 6 points, got %d", len(result.Points))
+	}
+	if result.Points[0].Date != "2023-01-01" || result.Points[5].Date != "2023-06-01" {
+		t.Fatalf("unexpected forecast dates: %s .. %s", result.Points[0].Date, result.Points[5].Date)
+	}
+	if math.Abs(result.Points[0].Value-220.5) > 1 {
+		t.Fatalf("expected first projection near 220.5, got %v", result.Points[0].Value)
+	}
+	for i, p := range result.Points {
+		if p.Lower > p.Value || p.Upper < p.Value {
+			t.Fatalf("point %d outside its interval: %+v", i, p)
+		}
+		if i > 0 && p.Upper-p.Lower < result.Points[i-1].Upper-result.Points[i-1].Lower {
+			t.Fatalf("prediction interval narrowed at point %d", i)
+		}
+	}
+}
+
+func TestForecastHoltWintersSeasonal(t *testing.T) {
+	seasonal := func(i int) float64 {
+		return 200 + 2*float64(i) + 40*math.Sin(2*math.Pi*float64(i)/12)
+	}
+	points := monthlySeries(48, seasonal)
+
+	result, err := NewTrendAnalyzer(nil).Forecast(points, ForecastOptions{Horizon: 12, SeasonLength: 12})
+	if err != nil {
+		t.Fatalf("Forecast error: %v", err)
+	}
+	if result.Model != ForecastHoltWinters {
+		t.Fatalf("expected holt_winters to be selected, got %s", result.Model)
+	}
+	if result.Decomposition == nil || len(result.Decomposition.SeasonalIndex) != 12 {
+		t.Fatalf("expected a 12-period seasonal decomposition")
+	}
+	for h, p := range result.Points {
+		want := seasonal(48 + h)
+		if math.Abs(p.Value-want) > 10 {
+			t.Fatalf("period %d: projected %v, want about %v", h+1, p.Value, want)
+		}
+	}
+}
+
+func TestForecastRejectsInvalidOptions(t *testing.T) {
+	points := monthlySeries(12, func(i int) float64 { return float64(i) })
+	analyzer := NewTrendAnalyzer(nil)
+
+	if _, err := analyzer.Forecast(points, ForecastOptions{Model: "arima"}); err == nil {
+		t.Fatal("expected error for unsupported model")
+	}
+	if _, err := analyzer.Forecast(points, ForecastOptions{Confidence: 1.5}); err == nil {
+		t.Fatal("expected error for invalid confidence")
+	}
+	if _, err := analyzer.Forecast(points[:2], ForecastOptions{Model: ForecastLinear}); err == nil {
+		t.Fatal("expected error for too few points")
+	}
+}
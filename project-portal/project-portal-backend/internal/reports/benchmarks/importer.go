@@ -0,0 +1,395 @@
+package benchmarks
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportFormat defines the file format of a benchmark table
+type ImportFormat string
+
+const (
+	ImportCSV  ImportFormat = "csv"
+	ImportXLSX ImportFormat = "xlsx"
+)
+
+// MaxImportRows limits the size of a single benchmark import
+const MaxImportRows = 10000
+
+var (
+	requiredImportColumns = []string{"metric", "value", "unit"}
+	optionalImportColumns = []string{"percentile", "sample_size", "lower_bound", "upper_bound", "description"}
+
+	// supportedPercentiles are the bands BenchmarkMetric stores; 0 and 100
+	// are the minimum and maximum
+	supportedPercentiles = map[float64]bool{0: true, 25: true, 50: true, 75: true, 90: true, 100: true}
+)
+
+// importedRow is a validated, unit-normalised benchmark row. A metric is
+// published as one row per percentile; a row without a percentile is the
+// median.
+type importedRow struct {
+	row           int
+	metric        string
+	value         float64
+	unit          string
+	percentile    float64
+	hasPercentile bool
+	sampleSize    int
+	lowerBound    float64
+	upperBound    float64
+	description   string
+}
+
+// ImportError describes a validation problem at a specific row and column
+type ImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ImportError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// ImportResult holds the parsed metrics, pivoted into the BenchmarkMetric
+// shape stored on BenchmarkDataset.Data, and any row-level validation errors
+type ImportResult struct {
+	Metrics []BenchmarkMetric `json:"metrics"`
+	Rows    int               `json:"rows"`
+	Errors  []ImportError     `json:"errors,omitempty"`
+}
+
+// DetectImportFormat determines the import format from a file name
+func DetectImportFormat(filename string) (ImportFormat, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ImportCSV, nil
+	case ".xlsx":
+		return ImportXLSX, nil
+	default:
+		return "", fmt.Errorf("unsupported file type %q (expected .csv or .xlsx)", filepath.Ext(filename))
+	}
+}
+
+// ParseBenchmarkTable reads a published benchmark table, validates it against
+// the import schema and normalises every value to its canonical unit.
+func ParseBenchmarkTable(r io.Reader, format ImportFormat) (*ImportResult, error) {
+	var rows [][]string
+	var err error
+
+	switch format {
+	case ImportCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err = reader.ReadAll()
+	case ImportXLSX:
+		rows, err = readFirstSheet(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read benchmark table: %w", err)
+	}
+
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("benchmark table must contain a header row and at least one data row")
+	}
+	if len(rows)-1 > MaxImportRows {
+		return nil, fmt.Errorf("benchmark table exceeds %d rows", MaxImportRows)
+	}
+
+	columns, err := mapImportHeader(rows[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	parsed := make([]importedRow, 0, len(rows)-1)
+	seen := make(map[string]int)
+
+	for i, row := range rows[1:] {
+		rowNum := i + 2 // 1-based, after the header
+		if isBlankRow(row) {
+			continue
+		}
+
+		metric, rowErrs := parseImportRow(rowNum, row, columns)
+		if len(rowErrs) > 0 {
+			result.Errors = append(result.Errors, rowErrs...)
+			continue
+		}
+
+		key := fmt.Sprintf("%s@%g", metric.metric, metric.percentile)
+		if first, dup := seen[key]; dup {
+			result.Errors = append(result.Errors, ImportError{
+				Row: rowNum, Column: "metric",
+				Message: fmt.Sprintf("duplicate metric %q at percentile %g (first seen on row %d)", metric.metric, metric.percentile, first),
+			})
+			continue
+		}
+		seen[key] = rowNum
+		parsed = append(parsed, metric)
+	}
+
+	result.Rows = len(parsed)
+	metrics, errs := pivotImportRows(parsed)
+	result.Metrics = metrics
+	result.Errors = append(result.Errors, errs...)
+	return result, nil
+}
+
+// pivotImportRows combines each metric's percentile rows into a single
+// BenchmarkMetric. Percentiles 0 and 100, or the rows' bounds, give the
+// minimum and maximum; bands the table does not publish are interpolated
+// from their neighbours so comparisons never see empty bands.
+func pivotImportRows(rows []importedRow) ([]BenchmarkMetric, []ImportError) {
+	var order []string
+	byMetric := make(map[string][]importedRow)
+	for _, r := range rows {
+		if _, ok := byMetric[r.metric]; !ok {
+			order = append(order, r.metric)
+		}
+		byMetric[r.metric] = append(byMetric[r.metric], r)
+	}
+
+	var metrics []BenchmarkMetric
+	var errs []ImportError
+	for _, name := range order {
+		group := byMetric[name]
+		first := group[0]
+		points := make(map[float64]float64)
+		lower, upper := math.Inf(1), math.Inf(-1)
+		m := BenchmarkMetric{Metric: name, Unit: first.unit}
+		failed := false
+
+		for _, r := range group {
+			if r.unit != first.unit {
+				errs = append(errs, ImportError{Row: r.row, Column: "unit",
+					Message: fmt.Sprintf("unit %s differs from %s on row %d", r.unit, first.unit, first.row)})
+				failed = true
+				continue
+			}
+			points[r.percentile] = r.value
+			if r.lowerBound != 0 {
+				lower = math.Min(lower, r.lowerBound)
+			}
+			if r.upperBound != 0 {
+				upper = math.Max(upper, r.upperBound)
+			}
+			if r.sampleSize > m.SampleSize {
+				m.SampleSize = r.sampleSize
+			}
+			if m.Description == "" {
+				m.Description = r.description
+			}
+		}
+		if failed {
+			continue
+		}
+
+		median, ok := points[50]
+		if !ok {
+			errs = append(errs, ImportError{Row: first.row, Column: "percentile",
+				Message: fmt.Sprintf("metric %q needs a median (percentile 50, or a row without a percentile)", name)})
+			continue
+		}
+
+		lowest, ok := points[0]
+		if !ok {
+			lowest = math.Min(lower, lowestPoint(points))
+		}
+		highest, ok := points[100]
+		if !ok {
+			highest = math.Max(upper, highestPoint(points))
+		}
+		aboveP75 := highest
+		if p90, ok := points[90]; ok {
+			aboveP75 = p90
+		}
+
+		m.Value = median
+		m.Percentile50 = median
+		m.Min, m.Max = lowest, highest
+		m.Percentile25 = bandOrMidpoint(points, 25, lowest, median)
+		m.Percentile75 = bandOrMidpoint(points, 75, median, aboveP75)
+		m.Percentile90 = bandOrMidpoint(points, 90, m.Percentile75, highest)
+
+		bands := []float64{m.Min, m.Percentile25, m.Percentile50, m.Percentile75, m.Percentile90, m.Max}
+		if !sort.Float64sAreSorted(bands) {
+			errs = append(errs, ImportError{Row: first.row, Column: "value",
+				Message: fmt.Sprintf("percentiles of %q must not decrease", name)})
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, errs
+}
+
+// bandOrMidpoint returns the published value at percentile p, or the midpoint
+// of its neighbouring bands
+func bandOrMidpoint(points map[float64]float64, p, below, above float64) float64 {
+	if v, ok := points[p]; ok {
+		return v
+	}
+	return below + (above-below)/2
+}
+
+func lowestPoint(points map[float64]float64) float64 {
+	lowest := math.Inf(1)
+	for _, v := range points {
+		lowest = math.Min(lowest, v)
+	}
+	return lowest
+}
+
+func highestPoint(points map[float64]float64) float64 {
+	highest := math.Inf(-1)
+	for _, v := range points {
+		highest = math.Max(highest, v)
+	}
+	return highest
+}
+
+func readFirstSheet(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+	return f.GetRows(sheets[0])
+}
+
+// mapImportHeader returns the column index of each recognised header
+func mapImportHeader(header []string) (map[string]int, error) {
+	allowed := make(map[string]bool)
+	for _, c := range requiredImportColumns {
+		allowed[c] = true
+	}
+	for _, c := range optionalImportColumns {
+		allowed[c] = true
+	}
+
+	columns := make(map[string]int)
+	for i, raw := range header {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		name = strings.ReplaceAll(name, " ", "_")
+		if name == "" {
+			continue
+		}
+		if !allowed[name] {
+			return nil, ImportError{Row: 1, Column: raw, Message: "unknown column"}
+		}
+		if _, dup := columns[name]; dup {
+			return nil, ImportError{Row: 1, Column: raw, Message: "duplicate column"}
+		}
+		columns[name] = i
+	}
+
+	for _, c := range requiredImportColumns {
+		if _, ok := columns[c]; !ok {
+			return nil, ImportError{Row: 1, Column: c, Message: "required column missing"}
+		}
+	}
+
+	return columns, nil
+}
+
+func parseImportRow(rowNum int, row []string, columns map[string]int) (importedRow, []ImportError) {
+	var errs []ImportError
+	cell := func(name string) string {
+		idx, ok := columns[name]
+		if !ok || idx >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[idx])
+	}
+	number := func(name string, required bool) float64 {
+		raw := strings.ReplaceAll(cell(name), ",", "")
+		if raw == "" {
+			if required {
+				errs = append(errs, ImportError{Row: rowNum, Column: name, Message: "value is required"})
+			}
+			return 0
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			errs = append(errs, ImportError{Row: rowNum, Column: name, Message: fmt.Sprintf("%q is not a number", raw)})
+		}
+		return v
+	}
+
+	metric := importedRow{
+		row:           rowNum,
+		metric:        strings.ToLower(strings.ReplaceAll(cell("metric"), " ", "_")),
+		value:         number("value", true),
+		percentile:    number("percentile", false),
+		hasPercentile: cell("percentile") != "",
+		lowerBound:    number("lower_bound", false),
+		upperBound:    number("upper_bound", false),
+		description:   cell("description"),
+	}
+	if metric.metric == "" {
+		errs = append(errs, ImportError{Row: rowNum, Column: "metric", Message: "value is required"})
+	}
+
+	sampleSize := number("sample_size", false)
+	if sampleSize < 0 || sampleSize != float64(int(sampleSize)) {
+		errs = append(errs, ImportError{Row: rowNum, Column: "sample_size", Message: "must be a non-negative integer"})
+	}
+	metric.sampleSize = int(sampleSize)
+
+	if !metric.hasPercentile {
+		metric.percentile = 50
+	}
+	if !supportedPercentiles[metric.percentile] {
+		errs = append(errs, ImportError{Row: rowNum, Column: "percentile", Message: "must be one of 0, 25, 50, 75, 90 or 100"})
+	}
+
+	unit, factor, err := NormalizeUnit(cell("unit"))
+	if err != nil {
+		errs = append(errs, ImportError{Row: rowNum, Column: "unit", Message: err.Error()})
+	}
+
+	if len(errs) > 0 {
+		return importedRow{}, errs
+	}
+
+	metric.unit = unit
+	metric.value *= factor
+	metric.lowerBound *= factor
+	metric.upperBound *= factor
+
+	if metric.lowerBound != 0 && metric.upperBound != 0 && metric.lowerBound > metric.upperBound {
+		errs = append(errs, ImportError{Row: rowNum, Column: "lower_bound", Message: "must not exceed upper_bound"})
+		return importedRow{}, errs
+	}
+
+	return metric, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
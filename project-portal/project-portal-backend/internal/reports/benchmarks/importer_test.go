@@ -0,0 +1,195 @@
+package benchmarks
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type importedBenchmarkRepo struct {
+	dataset *BenchmarkDataset
+}
+
+func (r importedBenchmarkRepo) GetBenchmarkByCategory(_ context.Context, _, _, _ string, _ int) (*BenchmarkDataset, error) {
+	return r.dataset, nil
+}
+
+func (r importedBenchmarkRepo) ListBenchmarks(_ context.Context, _ BenchmarkFilter) ([]BenchmarkDataset, error) {
+	return []BenchmarkDataset{*r.dataset}, nil
+}
+
+type fixedProjectMetrics map[string]float64
+
+func (m fixedProjectMetrics) GetProjectMetrics(_ context.Context, _ uuid.UUID) (map[string]float64, error) {
+	return m, nil
+}
+
+func (m fixedProjectMetrics) GetProjectsInPeerGroup(_ context.Context, _, _ string) ([]ProjectMetrics, error) {
+	return nil, nil
+}
+
+func TestNormalizeUnit(t *testing.T) {
+	cases := []struct {
+		in        string
+		canonical string
+		factor    float64
+	}{
+		{"tCO2e", "tCO2e", 1},
+		{"kgCO2e/acre/yr", "tCO2e/ha/yr", 0.001 / 0.40468564224},
+		{"tCO2e per ha", "tCO2e/ha", 1},
+		{"ratio", "%", 100},
+	}
+
+	for _, tc := range cases {
+		canonical, factor, err := NormalizeUnit(tc.in)
+		if err != nil {
+			t.Fatalf("NormalizeUnit(%q) error: %v", tc.in, err)
+		}
+		if canonical != tc.canonical || math.Abs(factor-tc.factor) > 1e-9 {
+			t.Fatalf("NormalizeUnit(%q) = %s, %v; want %s, %v", tc.in, canonical, factor, tc.canonical, tc.factor)
+		}
+	}
+
+	if _, _, err := NormalizeUnit("EUR"); err == nil {
+		t.Fatal("expected error for unsupported unit")
+	}
+}
+
+func TestParseBenchmarkTable(t *testing.T) {
+	csv := "Metric,Value,Unit,Sample Size\n" +
+		"sequestration_rate,5000,kgCO2e/ha/yr,42\n" +
+		"cost_per_credit,12.5,USD,\n"
+
+	result, err := ParseBenchmarkTable(strings.NewReader(csv), ImportCSV)
+	if err != nil {
+		t.Fatalf("ParseBenchmarkTable error: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	if len(result.Metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(result.Metrics))
+	}
+	if m := result.Metrics[0]; m.Unit != "tCO2e/ha/yr" || m.Value != 5 || m.SampleSize != 42 {
+		t.Fatalf("unexpected normalised metric: %+v", m)
+	}
+}
+
+func TestParseBenchmarkTableReportsRowErrors(t *testing.T) {
+	csv := "metric,value,unit\n" +
+		"a,abc,tCO2e\n" +
+		"b,1,furlongs\n" +
+		"c,1,ha\n" +
+		"c,2,ha\n"
+
+	result, err := ParseBenchmarkTable(strings.NewReader(csv), ImportCSV)
+	if err != nil {
+		t.Fatalf("ParseBenchmarkTable error: %v", err)
+	}
+	if len(result.Errors) != 3 {
+		t.Fatalf("expected 3 row errors, got %d: %v", len(result.Errors), result.Errors)
+	}
+	if result.Errors[0].Row != 2 || result.Errors[0].Column != "value" {
+		t.Fatalf("unexpected first error: %+v", result.Errors[0])
+	}
+
+	if _, err := ParseBenchmarkTable(strings.NewReader("metric,value\nx,1\n"), ImportCSV); err == nil {
+		t.Fatal("expected error for missing unit column")
+	}
+}
+
+func TestBuildPeerBenchmarksSuppressesSmallCohorts(t *testing.T) {
+	var projects []ProjectMetrics
+	for i := 0; i < 5; i++ {
+		projects = append(projects, ProjectMetrics{
+			Methodology: "REDD+", Region: "Kenya", Year: 2024,
+			Metrics: map[string]float64{"area_hectares": float64(100 * (i + 1))},
+		})
+	}
+	projects = append(projects, ProjectMetrics{
+		Methodology: "ARR", Region: "Kenya", Year: 2024,
+		Metrics: map[string]float64{"area_hectares": 50},
+	})
+
+	results := BuildPeerBenchmarks(projects, 5)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 cohorts, got %d", len(results))
+	}
+
+	arr, redd := results[0], results[1]
+	if !arr.Suppressed || len(arr.Metrics) != 0 {
+		t.Fatalf("expected ARR cohort to be suppressed: %+v", arr)
+	}
+	if redd.Suppressed || len(redd.Metrics) != 1 {
+		t.Fatalf("expected REDD+ cohort to be published: %+v", redd)
+	}
+	if m := redd.Metrics[0]; m.Percentile50 != 300 || m.Min != 120 || m.Max != 480 {
+		t.Fatalf("unexpected peer statistics: %+v", m)
+	}
+}
+
+func TestCompareAgainstImportedBenchmark(t *testing.T) {
+	csv := "metric,value,unit,percentile,sample_size\n" +
+		"sequestration_rate,2,tCO2e/ha/yr,0,30\n" +
+		"sequestration_rate,4,tCO2e/ha/yr,25,30\n" +
+		"sequestration_rate,6,tCO2e/ha/yr,50,30\n" +
+		"sequestration_rate,8,tCO2e/ha/yr,75,30\n" +
+		"sequestration_rate,10,tCO2e/ha/yr,90,30\n" +
+		"sequestration_rate,12,tCO2e/ha/yr,100,30\n" +
+		"cost_per_credit,12,USD,,\n"
+
+	result, err := ParseBenchmarkTable(strings.NewReader(csv), ImportCSV)
+	if err != nil || len(result.Errors) != 0 {
+		t.Fatalf("ParseBenchmarkTable: %v %v", err, result.Errors)
+	}
+	if result.Rows != 7 || len(result.Metrics) != 2 {
+		t.Fatalf("expected 7 rows pivoted into 2 metrics, got %d rows and %d metrics", result.Rows, len(result.Metrics))
+	}
+	if m := result.Metrics[0]; m.Percentile25 != 4 || m.Percentile50 != 6 || m.Percentile90 != 10 || m.Min != 2 || m.Max != 12 || m.SampleSize != 30 {
+		t.Fatalf("unexpected pivoted metric: %+v", m)
+	}
+
+	data, err := json.Marshal(result.Metrics)
+	if err != nil {
+		t.Fatalf("marshal metrics: %v", err)
+	}
+	comparator := NewComparator(
+		importedBenchmarkRepo{dataset: &BenchmarkDataset{Data: data}},
+		fixedProjectMetrics{"sequestration_rate": 5, "cost_per_credit": 12},
+	)
+	comparison, err := comparator.Compare(context.Background(), ComparisonRequest{ProjectID: uuid.New()})
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	levels := map[string]string{}
+	for _, c := range comparison.Comparisons {
+		levels[c.Metric] = c.PerformanceLevel
+	}
+	if levels["sequestration_rate"] != "at" || levels["cost_per_credit"] != "excellent" {
+		t.Fatalf("unexpected performance levels: %v", levels)
+	}
+	if rank := comparison.PercentileRanks["sequestration_rate"]; rank <= 25 || rank >= 50 {
+		t.Fatalf("expected a rank between the 25th and 50th percentiles, got %v", rank)
+	}
+}
+
+func TestParseBenchmarkTableValidatesPercentiles(t *testing.T) {
+	csv := "metric,value,unit,percentile\n" +
+		"a,5,ha,25\n" +
+		"b,5,ha,33\n" +
+		"c,5,ha,50\n" +
+		"c,4,ha,75\n"
+
+	result, err := ParseBenchmarkTable(strings.NewReader(csv), ImportCSV)
+	if err != nil {
+		t.Fatalf("ParseBenchmarkTable error: %v", err)
+	}
+	if len(result.Metrics) != 0 || len(result.Errors) != 3 {
+		t.Fatalf("expected a missing median, an unsupported percentile and decreasing bands, got %v", result.Errors)
+	}
+}
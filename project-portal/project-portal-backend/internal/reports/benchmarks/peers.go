@@ -0,0 +1,145 @@
+package benchmarks
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// DefaultMinCohortSize is the smallest peer group for which statistics are published
+const DefaultMinCohortSize = 5
+
+// ErrCohortTooSmall is returned when a peer statistic would expose individual projects
+var ErrCohortTooSmall = errors.New("peer group is below the anonymity threshold")
+
+// peerMetricUnits lists the canonical unit of each metric derived from portal projects
+var peerMetricUnits = map[string]string{
+	"total_credits_issued": "credits",
+	"area_hectares":        "ha",
+	"credits_per_hectare":  "credits/ha",
+}
+
+// PeerCohort identifies a group of comparable projects
+type PeerCohort struct {
+	Methodology string `json:"methodology"`
+	Region      string `json:"region"`
+	Year        int    `json:"year"`
+}
+
+// PeerBenchmark holds the statistics computed for one cohort
+type PeerBenchmark struct {
+	Cohort     PeerCohort        `json:"cohort"`
+	Size       int               `json:"size"`
+	Suppressed bool              `json:"suppressed"`
+	Metrics    []BenchmarkMetric `json:"metrics,omitempty"`
+}
+
+// BuildPeerBenchmarks groups projects by methodology, region and year and
+// computes percentile statistics for each cohort. Cohorts, and individual
+// metrics, with fewer than minCohort contributing projects are suppressed.
+func BuildPeerBenchmarks(projects []ProjectMetrics, minCohort int) []PeerBenchmark {
+	if minCohort < 1 {
+		minCohort = DefaultMinCohortSize
+	}
+
+	cohorts := make(map[PeerCohort][]ProjectMetrics)
+	for _, p := range projects {
+		key := PeerCohort{Methodology: p.Methodology, Region: p.Region, Year: p.Year}
+		cohorts[key] = append(cohorts[key], p)
+	}
+
+	results := make([]PeerBenchmark, 0, len(cohorts))
+	for cohort, members := range cohorts {
+		result := PeerBenchmark{Cohort: cohort, Size: len(members)}
+		if len(members) < minCohort {
+			result.Suppressed = true
+			results = append(results, result)
+			continue
+		}
+
+		for _, metric := range sortedMetricNames(members) {
+			values := make([]float64, 0, len(members))
+			for _, m := range members {
+				if v, ok := m.Metrics[metric]; ok {
+					values = append(values, v)
+				}
+			}
+			if len(values) < minCohort {
+				continue
+			}
+			result.Metrics = append(result.Metrics, summarizePeerMetric(metric, values))
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i].Cohort, results[j].Cohort
+		if a.Methodology != b.Methodology {
+			return a.Methodology < b.Methodology
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Year < b.Year
+	})
+
+	return results
+}
+
+// summarizePeerMetric computes distribution statistics for a metric. The
+// extremes are reported as the 5th and 95th percentiles so that no single
+// project's exact value is disclosed.
+func summarizePeerMetric(metric string, values []float64) BenchmarkMetric {
+	sort.Float64s(values)
+
+	return BenchmarkMetric{
+		Metric:       metric,
+		Value:        round2(percentile(values, 50)),
+		Unit:         peerMetricUnits[metric],
+		Percentile25: round2(percentile(values, 25)),
+		Percentile50: round2(percentile(values, 50)),
+		Percentile75: round2(percentile(values, 75)),
+		Percentile90: round2(percentile(values, 90)),
+		Min:          round2(percentile(values, 5)),
+		Max:          round2(percentile(values, 95)),
+		SampleSize:   len(values),
+		Description:  "Derived from portal projects in the same methodology, region and year",
+	}
+}
+
+// percentile returns the p-th percentile of sorted values using linear interpolation
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+func sortedMetricNames(members []ProjectMetrics) []string {
+	set := make(map[string]bool)
+	for _, m := range members {
+		for name := range m.Metrics {
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,91 @@
+package benchmarks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unitDefinition maps a unit alias to its canonical unit and conversion factor
+type unitDefinition struct {
+	canonical string
+	factor    float64
+}
+
+// knownUnits lists accepted unit spellings. All benchmark values are stored in
+// the canonical unit so datasets from different publishers are comparable.
+var knownUnits = map[string]unitDefinition{
+	// Carbon mass
+	"tco2e":       {"tCO2e", 1},
+	"tco2":        {"tCO2e", 1},
+	"tonnes co2e": {"tCO2e", 1},
+	"tons co2e":   {"tCO2e", 1},
+	"kgco2e":      {"tCO2e", 0.001},
+	"kg co2e":     {"tCO2e", 0.001},
+	"ktco2e":      {"tCO2e", 1000},
+	"tc":          {"tCO2e", 44.0 / 12.0}, // tonnes of carbon to CO2 equivalent
+
+	// Area
+	"ha":       {"ha", 1},
+	"hectare":  {"ha", 1},
+	"hectares": {"ha", 1},
+	"acre":     {"ha", 0.40468564224},
+	"acres":    {"ha", 0.40468564224},
+	"ac":       {"ha", 0.40468564224},
+	"km2":      {"ha", 100},
+	"km²":      {"ha", 100},
+	"m2":       {"ha", 0.0001},
+
+	// Time
+	"yr":     {"yr", 1},
+	"year":   {"yr", 1},
+	"years":  {"yr", 1},
+	"y":      {"yr", 1},
+	"month":  {"yr", 1.0 / 12.0},
+	"months": {"yr", 1.0 / 12.0},
+	"mo":     {"yr", 1.0 / 12.0},
+
+	// Currency (no FX conversion is applied, so only USD is accepted)
+	"usd": {"USD", 1},
+	"$":   {"USD", 1},
+
+	// Ratios
+	"%":        {"%", 1},
+	"percent":  {"%", 1},
+	"pct":      {"%", 1},
+	"ratio":    {"%", 100},
+	"fraction": {"%", 100},
+
+	// Counts
+	"credits": {"credits", 1},
+	"credit":  {"credits", 1},
+	"count":   {"count", 1},
+}
+
+// NormalizeUnit converts a unit such as "kgCO2e/acre/yr" into its canonical
+// form ("tCO2e/ha/yr") and returns the factor to multiply values by.
+func NormalizeUnit(unit string) (string, float64, error) {
+	cleaned := strings.ToLower(strings.TrimSpace(unit))
+	if cleaned == "" {
+		return "", 0, fmt.Errorf("unit is required")
+	}
+	cleaned = strings.ReplaceAll(cleaned, " per ", "/")
+
+	parts := strings.Split(cleaned, "/")
+	canonical := make([]string, 0, len(parts))
+	factor := 1.0
+
+	for i, part := range parts {
+		def, ok := knownUnits[strings.TrimSpace(part)]
+		if !ok {
+			return "", 0, fmt.Errorf("unsupported unit %q", unit)
+		}
+		canonical = append(canonical, def.canonical)
+		if i == 0 {
+			factor *= def.factor
+		} else {
+			factor /= def.factor
+		}
+	}
+
+	return strings.Join(canonical, "/"), factor, nil
+}
@@ -0,0 +1,61 @@
+package reports
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultExecutionCacheTTL = 5 * time.Minute
+	// executionInflightTimeout is how long a running execution can be joined
+	// before it is treated as abandoned
+	executionInflightTimeout = 30 * time.Minute
+	// executionStartTimeout bounds the lookups that start or join an
+	// execution, which run detached from the request that led them
+	executionStartTimeout = 30 * time.Second
+)
+
+// ========== Execution Caching ==========
+
+// executionFingerprint identifies executions that produce the same output:
+// the report and its config version, the format, the parameters and the
+// data watermark of the report's dataset.
+func (s *service) executionFingerprint(ctx context.Context, report *ReportDefinition, config ReportConfig, req ExecuteReportRequest) (string, error) {
+	watermark, err := s.repo.GetDatasetWatermark(ctx, config.Dataset)
+	if err != nil {
+		return "", fmt.Errorf("failed to read data watermark: %w", err)
+	}
+
+	// Map keys are marshalled in sorted order, so equal parameters hash equally
+	payload, err := json.Marshal(struct {
+		ReportID   uuid.UUID      `json:"report_id"`
+		Version    int            `json:"version"`
+		Format     ExportFormat   `json:"format"`
+		Parameters map[string]any `json:"parameters,omitempty"`
+		Watermark  string         `json:"watermark"`
+		Shareable  bool           `json:"shareable,omitempty"`
+	}{report.ID, report.Version, req.Format, req.Parameters, watermark, req.Shareable})
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint execution: %w", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheTTL returns how long a completed execution of the report stays fresh
+func (s *service) cacheTTL(report *ReportDefinition) time.Duration {
+	if report.CacheTTLSeconds != nil {
+		return time.Duration(*report.CacheTTLSeconds) * time.Second
+	}
+	if s.config.DefaultCacheTTL < 0 {
+		return 0
+	}
+	return s.config.DefaultCacheTTL
+}
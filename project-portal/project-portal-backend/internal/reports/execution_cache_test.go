@@ -0,0 +1,246 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// cacheRepo is an in-memory Repository covering report execution. Queries
+// block until release is closed so executions can be held in flight.
+type cacheRepo struct {
+	Repository
+
+	mu         sync.Mutex
+	report     *ReportDefinition
+	executions map[uuid.UUID]*ReportExecution
+	creates    int
+	watermark  string
+	release    chan struct{}
+}
+
+func newCacheRepo(owner uuid.UUID) *cacheRepo {
+	config, _ := json.Marshal(ReportConfig{Dataset: "carbon_credits", Fields: []FieldConfig{{Name: "quantity"}}})
+	return &cacheRepo{
+		report: &ReportDefinition{
+			ID:         uuid.New(),
+			Name:       "Credits",
+			Config:     datatypes.JSON(config),
+			CreatedBy:  &owner,
+			Visibility: VisibilityPrivate,
+			Version:    1,
+		},
+		executions: map[uuid.UUID]*ReportExecution{},
+		watermark:  "10:0:0",
+		release:    make(chan struct{}),
+	}
+}
+
+func (r *cacheRepo) GetReportDefinition(_ context.Context, _ uuid.UUID) (*ReportDefinition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *r.report
+	return &cp, nil
+}
+
+func (r *cacheRepo) GetDatasetWatermark(_ context.Context, _ string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.watermark, nil
+}
+
+func (r *cacheRepo) CreateExecution(ctx context.Context, execution *ReportExecution) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.creates++
+	cp := *execution
+	r.executions[execution.ID] = &cp
+	return nil
+}
+
+func (r *cacheRepo) UpdateExecution(_ context.Context, execution *ReportExecution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *execution
+	r.executions[execution.ID] = &cp
+	return nil
+}
+
+func (r *cacheRepo) FindExecutionByFingerprint(ctx context.Context, fingerprint string, statuses []ExecutionStatus, since time.Time) (*ReportExecution, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found *ReportExecution
+	for _, e := range r.executions {
+		if e.Fingerprint != fingerprint || e.TriggeredAt.Before(since) {
+			continue
+		}
+		for _, status := range statuses {
+			if e.Status == status && (found == nil || e.TriggeredAt.After(found.TriggeredAt)) {
+				found = e
+			}
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	cp := *found
+	return &cp, nil
+}
+
+func (r *cacheRepo) IncrementExecutionCacheHits(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executions[id].CacheHits++
+	return nil
+}
+
+func (r *cacheRepo) ExpireStaleExecutions(_ context.Context, _ string, _ time.Time) error {
+	return nil
+}
+
+func (r *cacheRepo) ExecuteDynamicQuery(_ context.Context, _ ReportConfig) ([]map[string]interface{}, int64, error) {
+	<-r.release
+	return []map[string]interface{}{{"quantity": 5.0}}, 1, nil
+}
+
+func (r *cacheRepo) status(id uuid.UUID) ExecutionStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.executions[id].Status
+}
+
+func (r *cacheRepo) createCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.creates
+}
+
+func waitForStatus(t *testing.T, repo *cacheRepo, id uuid.UUID, want ExecutionStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for repo.status(id) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("execution %s status = %s, want %s", id, repo.status(id), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExecuteReportMergesConcurrentIdenticalRequests(t *testing.T) {
+	owner := uuid.New()
+	repo := newCacheRepo(owner)
+	svc := NewService(repo, nil)
+	ctx := context.Background()
+	req := ExecuteReportRequest{Format: FormatJSON, Parameters: map[string]any{"year": 2026}}
+
+	var wg sync.WaitGroup
+	ids := make([]uuid.UUID, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			execution, err := svc.ExecuteReport(ctx, owner, repo.report.ID, req)
+			if err != nil {
+				t.Errorf("ExecuteReport: %v", err)
+				return
+			}
+			ids[i] = execution.ID
+		}(i)
+	}
+	wg.Wait()
+
+	if n := repo.createCount(); n != 1 {
+		t.Fatalf("created %d executions, want 1", n)
+	}
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Fatalf("concurrent requests got different executions: %v", ids)
+		}
+	}
+
+	close(repo.release)
+	waitForStatus(t, repo, ids[0], StatusCompleted)
+
+	cached, err := svc.ExecuteReport(ctx, owner, repo.report.ID, req)
+	if err != nil {
+		t.Fatalf("ExecuteReport: %v", err)
+	}
+	if cached.ID != ids[0] || cached.CacheHits != 1 {
+		t.Errorf("got execution %s with %d hits, want cached %s with 1 hit", cached.ID, cached.CacheHits, ids[0])
+	}
+}
+
+func TestExecuteReportFingerprintInvalidation(t *testing.T) {
+	owner := uuid.New()
+	repo := newCacheRepo(owner)
+	close(repo.release)
+	svc := NewService(repo, nil)
+	ctx := context.Background()
+	req := ExecuteReportRequest{Format: FormatJSON}
+
+	first, err := svc.ExecuteReport(ctx, owner, repo.report.ID, req)
+	if err != nil {
+		t.Fatalf("ExecuteReport: %v", err)
+	}
+	waitForStatus(t, repo, first.ID, StatusCompleted)
+
+	run := func(name string, req ExecuteReportRequest) {
+		t.Helper()
+		before := repo.createCount()
+		execution, err := svc.ExecuteReport(ctx, owner, repo.report.ID, req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if execution.ID == first.ID || repo.createCount() != before+1 {
+			t.Errorf("%s: expected a new execution", name)
+		}
+		waitForStatus(t, repo, execution.ID, StatusCompleted)
+	}
+
+	run("different parameters", ExecuteReportRequest{Format: FormatJSON, Parameters: map[string]any{"region": "EU"}})
+	run("force refresh", ExecuteReportRequest{Format: FormatJSON, ForceRefresh: true})
+
+	repo.mu.Lock()
+	repo.watermark = "11:0:0"
+	repo.mu.Unlock()
+	run("new data", req)
+
+	repo.mu.Lock()
+	repo.report.Version = 2
+	repo.mu.Unlock()
+	run("new config version", req)
+
+	disabled := 0
+	repo.mu.Lock()
+	repo.report.CacheTTLSeconds = &disabled
+	repo.mu.Unlock()
+	run("caching disabled", req)
+}
+
+func TestExecuteReportSurvivesLeaderCancellation(t *testing.T) {
+	owner := uuid.New()
+	repo := newCacheRepo(owner)
+	close(repo.release)
+	svc := NewService(repo, nil)
+
+	// The caller whose request runs the shared work has already gone away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	execution, err := svc.ExecuteReport(ctx, owner, repo.report.ID, ExecuteReportRequest{Format: FormatJSON})
+	if err != nil {
+		t.Fatalf("expected the shared work to run detached from the caller, got %v", err)
+	}
+	waitForStatus(t, repo, execution.ID, StatusCompleted)
+}
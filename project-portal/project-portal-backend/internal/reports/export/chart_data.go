@@ -0,0 +1,57 @@
+package export
+
+// Chart types supported in report sections
+const (
+	ChartLine    = "line"
+	ChartBar     = "bar"
+	ChartStacked = "stacked"
+	ChartPie     = "pie"
+)
+
+// ChartData holds the categories and series plotted in a report section
+type ChartData struct {
+	XAxis      string
+	Categories []string
+	Series     []ChartDataSeries
+}
+
+// ChartDataSeries is a named series with one value per category
+type ChartDataSeries struct {
+	Name   string
+	Values []float64
+}
+
+// KPI is a headline figure shown in a section's summary block
+type KPI struct {
+	Label string
+	Value string
+}
+
+// chartPalette follows the default Office theme so PDF and Excel charts match
+var chartPalette = [][3]int{
+	{68, 114, 196},
+	{237, 125, 49},
+	{165, 165, 165},
+	{255, 192, 0},
+	{91, 155, 213},
+	{112, 173, 71},
+	{38, 68, 120},
+	{158, 72, 14},
+}
+
+func paletteColor(i int) [3]int {
+	return chartPalette[i%len(chartPalette)]
+}
+
+// hasChart reports whether a section has something to plot
+func (s ReportSection) hasChart() bool {
+	return s.ChartData != nil && len(s.ChartData.Categories) > 0 && len(s.ChartData.Series) > 0
+}
+
+// valueAt returns the series value for a category, or zero when it is missing
+func (s ChartDataSeries) valueAt(i int) float64 {
+	if i < len(s.Values) {
+		return s.Values[i]
+	}
+	return 0
+}
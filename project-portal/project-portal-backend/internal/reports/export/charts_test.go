@@ -0,0 +1,111 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func chartSections() []ReportSection {
+	data := &ChartData{
+		XAxis:      "month",
+		Categories: []string{"2026-01-01", "2026-02-01", "2026-03-01"},
+		Series: []ChartDataSeries{
+			{Name: "issued", Values: []float64{120, 340, 95}},
+			{Name: "retired", Values: []float64{40, -10, 60}},
+		},
+	}
+	kpis := []KPI{{Label: "Credits issued", Value: "555"}, {Label: "Projects", Value: "12"}}
+
+	var sections []ReportSection
+	for _, chartType := range []string{ChartLine, ChartBar, ChartStacked, ChartPie} {
+		sections = append(sections, ReportSection{Title: "Credits " + chartType, ChartType: chartType, ChartData: data, KPIs: kpis})
+	}
+	return append(sections, ReportSection{
+		Title:   "Report Data",
+		Columns: []string{"month", "issued"},
+		Data:    []map[string]interface{}{{"month": "2026-01-01", "issued": 120.0}},
+	})
+}
+
+func TestPDFExportChartReport(t *testing.T) {
+	out, err := NewPDFExporter(DefaultPDFConfig()).ExportChartReport(context.Background(), chartSections())
+	if err != nil {
+		t.Fatalf("ExportChartReport: %v", err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF")
+	}
+}
+
+func TestExcelExportChartReport(t *testing.T) {
+	out, err := NewExcelExporter(DefaultExcelConfig()).ExportChartReport(context.Background(), chartSections())
+	if err != nil {
+		t.Fatalf("ExportChartReport: %v", err)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	want := []string{"Summary", "Charts", "Chart Data", "Report Data"}
+	if got := f.GetSheetList(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("sheets = %v, want %v", got, want)
+	}
+
+	if v, _ := f.GetCellValue("Summary", "C2"); v != "555" {
+		t.Errorf("Summary!C2 = %q, want 555", v)
+	}
+	if v, _ := f.GetCellValue("Chart Data", "C2"); v != "retired" {
+		t.Errorf("Chart Data!C2 = %q, want series header", v)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	var charts int
+	for _, entry := range zr.File {
+		if strings.HasPrefix(entry.Name, "xl/charts/chart") {
+			charts++
+		}
+	}
+	if charts != 4 {
+		t.Errorf("native charts = %d, want 4", charts)
+	}
+}
+
+func TestSheetNamerKeepsNamesUniqueAndValid(t *testing.T) {
+	f := excelize.NewFile()
+	namer := &sheetNamer{f: f, used: make(map[string]bool)}
+
+	first := namer.add("Q1/Q2: credits [draft]")
+	second := namer.add("q1 q2  credits  draft ")
+	long := namer.add(strings.Repeat("x", 40))
+
+	if strings.ContainsAny(first, `[]:*?/\`) {
+		t.Errorf("invalid characters kept in %q", first)
+	}
+	if len([]rune(long)) > maxSheetNameLength {
+		t.Errorf("%q longer than %d", long, maxSheetNameLength)
+	}
+	if dup := namer.add(strings.Repeat("x", 40)); dup == long || len([]rune(dup)) > maxSheetNameLength {
+		t.Errorf("duplicate name %q not made unique within the limit", dup)
+	}
+	if first == second {
+		t.Errorf("expected distinct names, got %q twice", first)
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	cases := map[float64]float64{0.7: 1, 13: 20, 42: 50, 80: 100, 0: 1}
+	for raw, want := range cases {
+		if got := niceStep(raw); got != want {
+			t.Errorf("niceStep(%v) = %v, want %v", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	excelSummarySheet   = "Summary"
+	excelChartsSheet    = "Charts"
+	excelChartDataSheet = "Chart Data"
+	excelDataSheet      = "Data"
+	maxSheetNameLength  = 31
+	excelChartWidth     = 800
+	excelChartHeight    = 400
+	excelChartRowSpan   = 22 // rows between charts on the Charts sheet
+)
+
+// excelChartTypes maps section chart types to AddChart types. Section bars
+// are vertical, which Excel calls columns.
+var excelChartTypes = map[string]string{
+	ChartLine:    "line",
+	ChartBar:     "column",
+	ChartStacked: "stacked",
+	ChartPie:     "pie",
+}
+
+// ExportChartReport exports report sections as a workbook. KPIs go on a
+// Summary sheet, charts are native Excel charts on a Charts sheet backed by
+// a Chart Data sheet, and each section's table gets its own sheet.
+func (e *ExcelExporter) ExportChartReport(ctx context.Context, sections []ReportSection) ([]byte, error) {
+	f := excelize.NewFile()
+	sheets := &sheetNamer{f: f, used: make(map[string]bool)}
+
+	headerStyleID, err := e.createHeaderStyle(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create header style: %w", err)
+	}
+	dataStyleID, err := e.createDataStyle(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data style: %w", err)
+	}
+
+	var withKPIs, withCharts []ReportSection
+	for _, section := range sections {
+		if len(section.KPIs) > 0 {
+			withKPIs = append(withKPIs, section)
+		}
+		if section.hasChart() {
+			withCharts = append(withCharts, section)
+		}
+	}
+
+	if len(withKPIs) > 0 {
+		name := sheets.add(excelSummarySheet)
+		e.writeKPISheet(f, name, withKPIs, headerStyleID)
+	}
+
+	if len(withCharts) > 0 {
+		chartsName := sheets.add(excelChartsSheet)
+		dataName := sheets.add(excelChartDataSheet)
+		if err := e.writeCharts(f, chartsName, dataName, withCharts, headerStyleID); err != nil {
+			return nil, fmt.Errorf("failed to add charts: %w", err)
+		}
+	}
+
+	for _, section := range sections {
+		if len(section.Data) == 0 {
+			continue
+		}
+		title := section.Title
+		if title == "" {
+			title = excelDataSheet
+		}
+		columns := section.Columns
+		if len(columns) == 0 {
+			columns = e.extractColumns(section.Data[0])
+		}
+		e.writeTable(f, sheets.add(title), columns, section.Data, headerStyleID, dataStyleID)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write Excel file: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (e *ExcelExporter) writeKPISheet(f *excelize.File, sheetName string, sections []ReportSection, headerStyleID int) {
+	for i, header := range []string{"Section", "Metric", "Value"} {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheetName, cell, header)
+		if headerStyleID != 0 {
+			f.SetCellStyle(sheetName, cell, cell, headerStyleID)
+		}
+	}
+
+	row := 2
+	for _, section := range sections {
+		for _, kpi := range section.KPIs {
+			f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), section.Title)
+			f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), kpi.Label)
+			f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), kpi.Value)
+			row++
+		}
+	}
+
+	f.SetColWidth(sheetName, "A", "B", 30)
+	f.SetColWidth(sheetName, "C", "C", 20)
+}
+
+// writeCharts writes each section's series as a block on the data sheet and
+// adds a chart referencing that block to the charts sheet.
+func (e *ExcelExporter) writeCharts(f *excelize.File, chartsSheet, dataSheet string, sections []ReportSection, headerStyleID int) error {
+	ref := quoteSheetName(dataSheet)
+	row := 1
+
+	for i, section := range sections {
+		data := section.ChartData
+		series := data.Series
+		if section.ChartType == ChartPie {
+			series = series[:1]
+		}
+
+		f.SetCellValue(dataSheet, fmt.Sprintf("A%d", row), section.Title)
+		row++
+
+		headerRow := row
+		xAxis := data.XAxis
+		if xAxis == "" {
+			xAxis = "Category"
+		}
+		headers := append([]string{xAxis}, make([]string, len(series))...)
+		for si, s := range series {
+			headers[si+1] = s.Name
+		}
+		for col, header := range headers {
+			cell, _ := excelize.CoordinatesToCellName(col+1, headerRow)
+			f.SetCellValue(dataSheet, cell, header)
+			if headerStyleID != 0 {
+				f.SetCellStyle(dataSheet, cell, cell, headerStyleID)
+			}
+		}
+
+		first := headerRow + 1
+		for ci, category := range data.Categories {
+			f.SetCellValue(dataSheet, fmt.Sprintf("A%d", first+ci), category)
+			for si, s := range series {
+				cell, _ := excelize.CoordinatesToCellName(si+2, first+ci)
+				f.SetCellValue(dataSheet, cell, s.valueAt(ci))
+			}
+		}
+		last := first + len(data.Categories) - 1
+
+		chartSeries := make([]ChartSeries, len(series))
+		for si := range series {
+			col, _ := excelize.ColumnNumberToName(si + 2)
+			chartSeries[si] = ChartSeries{
+				Name:       fmt.Sprintf("%s!$%s$%d", ref, col, headerRow),
+				Categories: fmt.Sprintf("%s!$A$%d:$A$%d", ref, first, last),
+				Values:     fmt.Sprintf("%s!$%s$%d:$%s$%d", ref, col, first, col, last),
+			}
+		}
+
+		chartType, ok := excelChartTypes[section.ChartType]
+		if !ok {
+			chartType = excelChartTypes[ChartLine]
+		}
+		if err := e.AddChart(f, chartsSheet, ChartConfig{
+			Type:   chartType,
+			Title:  section.Title,
+			Cell:   fmt.Sprintf("A%d", 1+i*excelChartRowSpan),
+			Width:  excelChartWidth,
+			Height: excelChartHeight,
+			Series: chartSeries,
+		}); err != nil {
+			return fmt.Errorf("section %q: %w", section.Title, err)
+		}
+
+		row = last + 2
+	}
+
+	f.SetColWidth(dataSheet, "A", "A", 25)
+	return nil
+}
+
+func (e *ExcelExporter) writeTable(f *excelize.File, sheetName string, columns []string, data []map[string]interface{}, headerStyleID, dataStyleID int) {
+	for i, col := range columns {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheetName, cell, col)
+		if headerStyleID != 0 {
+			f.SetCellStyle(sheetName, cell, cell, headerStyleID)
+		}
+	}
+
+	for rowIdx, row := range data {
+		for colIdx, col := range columns {
+			cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+2)
+			f.SetCellValue(sheetName, cell, e.formatValue(row[col]))
+			if dataStyleID != 0 {
+				f.SetCellStyle(sheetName, cell, cell, dataStyleID)
+			}
+		}
+	}
+
+	for i, col := range columns {
+		colLetter, _ := excelize.ColumnNumberToName(i + 1)
+		width := 15.0
+		if w, exists := e.config.ColumnWidths[col]; exists {
+			width = w
+		}
+		f.SetColWidth(sheetName, colLetter, colLetter, width)
+	}
+
+	if e.config.AutoFilter && len(columns) > 0 {
+		lastCol, _ := excelize.ColumnNumberToName(len(columns))
+		f.AutoFilter(sheetName, fmt.Sprintf("A1:%s%d", lastCol, len(data)+1), nil)
+	}
+	if e.config.FreezeHeader {
+		f.SetPanes(sheetName, &excelize.Panes{
+			Freeze:      true,
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+		})
+	}
+}
+
+// sheetNamer creates sheets with valid, unique names. The first sheet
+// replaces the default Sheet1.
+type sheetNamer struct {
+	f    *excelize.File
+	used map[string]bool
+}
+
+func (n *sheetNamer) add(title string) string {
+	base := sanitizeSheetName(title)
+	name := base
+	for i := 2; n.used[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		name = truncateSheetName(base, maxSheetNameLength-len(suffix)) + suffix
+	}
+
+	if len(n.used) == 0 {
+		n.f.SetSheetName("Sheet1", name)
+	} else {
+		n.f.NewSheet(name)
+	}
+	n.used[strings.ToLower(name)] = true
+	return name
+}
+
+// sanitizeSheetName removes characters Excel does not allow in sheet names
+func sanitizeSheetName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), "'")
+	name = truncateSheetName(name, maxSheetNameLength)
+	if name == "" {
+		return excelDataSheet
+	}
+	return name
+}
+
+func truncateSheetName(name string, max int) string {
+	runes := []rune(name)
+	if len(runes) > max {
+		return strings.TrimSpace(string(runes[:max]))
+	}
+	return name
+}
+
+// quoteSheetName quotes a sheet name for use in a cell reference
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
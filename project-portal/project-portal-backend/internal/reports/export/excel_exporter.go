@@ -324,6 +324,8 @@ func (e *ExcelExporter) AddChart(f *excelize.File, sheetName string, chartConfig
 		chartType = excelize.Bar
 	case "column":
 		chartType = excelize.Col
+	case "stacked":
+		chartType = excelize.ColStacked
 	case "pie":
 		chartType = excelize.Pie
 	case "area":
@@ -341,7 +343,7 @@ func (e *ExcelExporter) AddChart(f *excelize.File, sheetName string, chartConfig
 		}
 	}
 
-	return f.AddChart(sheetName, chartConfig.Cell, &excelize.Chart{
+	chart := &excelize.Chart{
 		Type:   chartType,
 		Series: series,
 		Title:  []excelize.RichTextRun{{Text: chartConfig.Title}},
@@ -353,12 +355,17 @@ func (e *ExcelExporter) AddChart(f *excelize.File, sheetName string, chartConfig
 			Position:      "right",
 			ShowLegendKey: true,
 		},
-	})
+	}
+	if chartType == excelize.Pie {
+		chart.PlotArea = excelize.ChartPlotArea{ShowPercent: true}
+	}
+
+	return f.AddChart(sheetName, chartConfig.Cell, chart)
 }
 
 // ChartConfig defines chart configuration
 type ChartConfig struct {
-	Type   string
+	Type   string // line, bar, column, stacked, pie, area, scatter
 	Title  string
 	Cell   string
 	Width  int
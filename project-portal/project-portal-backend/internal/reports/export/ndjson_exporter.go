@@ -0,0 +1,78 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// NDJSONWriter streams rows as newline-delimited JSON, one object per line
+type NDJSONWriter struct {
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	columns []Column
+}
+
+// NewNDJSONWriter creates a writer for the given columns. Values are encoded
+// with their column type; with no columns every row key is written as is.
+func NewNDJSONWriter(w io.Writer, columns []Column) *NDJSONWriter {
+	buf := bufio.NewWriter(w)
+	return &NDJSONWriter{buf: buf, enc: json.NewEncoder(buf), columns: columns}
+}
+
+// WriteRow writes a single row
+func (w *NDJSONWriter) WriteRow(row map[string]interface{}) error {
+	record := make(map[string]interface{}, len(row))
+	if len(w.columns) == 0 {
+		for key, value := range row {
+			record[key] = jsonValue(value, "")
+		}
+	} else {
+		for _, col := range w.columns {
+			record[col.Name] = jsonValue(row[col.Name], col.Type)
+		}
+	}
+
+	if err := w.enc.Encode(record); err != nil {
+		return fmt.Errorf("failed to write row: %w", err)
+	}
+	return nil
+}
+
+// Close flushes buffered output
+func (w *NDJSONWriter) Close() error {
+	return w.buf.Flush()
+}
+
+// jsonValue converts a scanned value so it encodes as its column type rather
+// than, for example, base64 for numeric columns scanned as bytes.
+func jsonValue(v interface{}, columnType string) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch normalizeColumnType(columnType) {
+	case ColumnNumber:
+		if f, ok := asFloat(v); ok {
+			return f
+		}
+	case ColumnInteger:
+		if i, ok := asInt(v); ok {
+			return i
+		}
+	case ColumnBoolean:
+		if b, ok := asBool(v); ok {
+			return b
+		}
+	case ColumnDate:
+		if t, ok := asTime(v); ok {
+			return t
+		}
+	}
+
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
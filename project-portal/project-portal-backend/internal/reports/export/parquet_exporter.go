@@ -0,0 +1,145 @@
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	parquetSchemaName   = "report"
+	parquetBatchSize    = 512
+	parquetRowGroupSize = 50000 // bounds the rows buffered before a row group is written
+)
+
+// ParquetWriter streams rows into a Parquet file. Every column is optional
+// so NULLs survive; types follow the column data types.
+type ParquetWriter struct {
+	writer  *parquet.Writer
+	columns []Column
+	index   []int // parquet column index of each column
+	batch   []parquet.Row
+}
+
+// NewParquetWriter creates a writer with a schema built from the columns
+func NewParquetWriter(w io.Writer, columns []Column) (*ParquetWriter, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("parquet export requires at least one column")
+	}
+
+	group := make(parquet.Group, len(columns))
+	for _, col := range columns {
+		if _, exists := group[col.Name]; exists {
+			return nil, fmt.Errorf("duplicate column %q", col.Name)
+		}
+		group[col.Name] = parquet.Optional(parquetNode(col.Type))
+	}
+	schema := parquet.NewSchema(parquetSchemaName, group)
+
+	// Group fields are ordered by name, which decides the column indexes
+	position := make(map[string]int, len(columns))
+	for i, field := range schema.Fields() {
+		position[field.Name()] = i
+	}
+	index := make([]int, len(columns))
+	for i, col := range columns {
+		index[i] = position[col.Name]
+	}
+
+	return &ParquetWriter{
+		writer: parquet.NewWriter(w, schema,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+		),
+		columns: columns,
+		index:   index,
+		batch:   make([]parquet.Row, 0, parquetBatchSize),
+	}, nil
+}
+
+// WriteRow buffers a single row, writing a batch once it is full
+func (w *ParquetWriter) WriteRow(row map[string]interface{}) error {
+	record := make(parquet.Row, len(w.columns))
+	for i, col := range w.columns {
+		value := parquetValue(row[col.Name], col.Type)
+		definition := 1
+		if value.IsNull() {
+			definition = 0
+		}
+		record[w.index[i]] = value.Level(0, definition, w.index[i])
+	}
+
+	w.batch = append(w.batch, record)
+	if len(w.batch) >= parquetBatchSize {
+		return w.flushBatch()
+	}
+	return nil
+}
+
+// Close writes remaining rows and the file footer
+func (w *ParquetWriter) Close() error {
+	if err := w.flushBatch(); err != nil {
+		return err
+	}
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet file: %w", err)
+	}
+	return nil
+}
+
+func (w *ParquetWriter) flushBatch() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	if _, err := w.writer.WriteRows(w.batch); err != nil {
+		return fmt.Errorf("failed to write rows: %w", err)
+	}
+	w.batch = w.batch[:0]
+	return nil
+}
+
+func parquetNode(columnType string) parquet.Node {
+	switch normalizeColumnType(columnType) {
+	case ColumnNumber:
+		return parquet.Leaf(parquet.DoubleType)
+	case ColumnInteger:
+		return parquet.Int(64)
+	case ColumnBoolean:
+		return parquet.Leaf(parquet.BooleanType)
+	case ColumnDate:
+		return parquet.Timestamp(parquet.Millisecond)
+	default:
+		return parquet.String()
+	}
+}
+
+// parquetValue converts a scanned value to the column's physical type. Values
+// that cannot be converted are written as NULL.
+func parquetValue(v interface{}, columnType string) parquet.Value {
+	if v == nil {
+		return parquet.NullValue()
+	}
+
+	switch normalizeColumnType(columnType) {
+	case ColumnNumber:
+		if f, ok := asFloat(v); ok {
+			return parquet.DoubleValue(f)
+		}
+	case ColumnInteger:
+		if i, ok := asInt(v); ok {
+			return parquet.Int64Value(i)
+		}
+	case ColumnBoolean:
+		if b, ok := asBool(v); ok {
+			return parquet.BooleanValue(b)
+		}
+	case ColumnDate:
+		if t, ok := asTime(v); ok {
+			return parquet.Int64Value(t.UnixMilli())
+		}
+	default:
+		return parquet.ByteArrayValue([]byte(asString(v)))
+	}
+	return parquet.NullValue()
+}
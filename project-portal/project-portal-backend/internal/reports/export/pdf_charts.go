@@ -0,0 +1,382 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	pdfChartHeight      = 85.0
+	pdfChartLegendWidth = 45.0
+	pdfChartAxisWidth   = 16.0
+	pdfChartLabelHeight = 8.0
+	pdfChartTicks       = 5
+	pdfChartLabelWidth  = 14.0 // minimum room for one category label
+	pdfKPIBoxHeight     = 20.0
+	pdfKPIGap           = 4.0
+	pdfKPIsPerRow       = 4
+	pdfLegendMaxRunes   = 26
+)
+
+// contentWidth returns the page width between the left and right margins
+func (e *PDFExporter) contentWidth(pdf *gofpdf.Fpdf) float64 {
+	width, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	return width - left - right
+}
+
+// ensureSpace starts a new page when the next block would not fit
+func (e *PDFExporter) ensureSpace(pdf *gofpdf.Fpdf, height float64) {
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+height > pageHeight-bottom {
+		pdf.AddPage()
+	}
+}
+
+// addKPIs draws a row of headline figures, wrapping after pdfKPIsPerRow boxes
+func (e *PDFExporter) addKPIs(pdf *gofpdf.Fpdf, kpis []KPI) {
+	left, _, _, _ := pdf.GetMargins()
+	perRow := len(kpis)
+	if perRow > pdfKPIsPerRow {
+		perRow = pdfKPIsPerRow
+	}
+	boxWidth := (e.contentWidth(pdf) - pdfKPIGap*float64(perRow-1)) / float64(perRow)
+
+	var y float64
+	for i, kpi := range kpis {
+		col := i % perRow
+		if col == 0 {
+			if i > 0 {
+				pdf.SetY(y + pdfKPIBoxHeight + pdfKPIGap)
+			}
+			e.ensureSpace(pdf, pdfKPIBoxHeight)
+			y = pdf.GetY()
+		}
+		x := left + float64(col)*(boxWidth+pdfKPIGap)
+
+		pdf.SetFillColor(242, 242, 242)
+		pdf.Rect(x, y, boxWidth, pdfKPIBoxHeight, "F")
+		pdf.SetFillColor(e.config.HeaderColor[0], e.config.HeaderColor[1], e.config.HeaderColor[2])
+		pdf.Rect(x, y, 1.5, pdfKPIBoxHeight, "F")
+
+		pdf.SetXY(x+4, y+3)
+		pdf.SetFont(e.config.FontFamily, "B", 14)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(boxWidth-6, 8, kpi.Value, "", 0, "L", false, 0, "")
+
+		pdf.SetXY(x+4, y+12)
+		pdf.SetFont(e.config.FontFamily, "", 8)
+		pdf.SetTextColor(100, 100, 100)
+		pdf.CellFormat(boxWidth-6, 5, kpi.Label, "", 0, "L", false, 0, "")
+	}
+
+	pdf.SetXY(left, y+pdfKPIBoxHeight+pdfKPIGap)
+}
+
+// addChart draws the section's chart at the current position
+func (e *PDFExporter) addChart(pdf *gofpdf.Fpdf, chartType string, data *ChartData) {
+	e.ensureSpace(pdf, pdfChartHeight)
+
+	left, _, _, _ := pdf.GetMargins()
+	y := pdf.GetY()
+	width := e.contentWidth(pdf)
+
+	if chartType == ChartPie {
+		e.drawPieChart(pdf, data, left, y, width, pdfChartHeight)
+	} else {
+		e.drawAxisChart(pdf, chartType, data, left, y, width, pdfChartHeight)
+	}
+
+	pdf.SetXY(left, y+pdfChartHeight+4)
+}
+
+// drawAxisChart draws line, bar and stacked bar charts with a value axis,
+// gridlines, category labels and a legend on the right.
+func (e *PDFExporter) drawAxisChart(pdf *gofpdf.Fpdf, chartType string, data *ChartData, x, y, w, h float64) {
+	plotX := x + pdfChartAxisWidth
+	plotY := y + 2
+	plotW := w - pdfChartAxisWidth - pdfChartLegendWidth
+	plotH := h - pdfChartLabelHeight - 2
+
+	lo, hi := chartRange(chartType, data)
+	step := niceStep((hi - lo) / pdfChartTicks)
+	lo = math.Floor(lo/step) * step
+	hi = math.Ceil(hi/step) * step
+	if hi == lo {
+		hi = lo + step
+	}
+	scaleY := func(v float64) float64 {
+		return plotY + plotH - (v-lo)/(hi-lo)*plotH
+	}
+
+	// Gridlines and value labels
+	pdf.SetFont(e.config.FontFamily, "", 7)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.SetDrawColor(217, 217, 217)
+	pdf.SetLineWidth(0.1)
+	ticks := int(math.Round((hi - lo) / step))
+	for i := 0; i <= ticks; i++ {
+		v := lo + float64(i)*step
+		gy := scaleY(v)
+		pdf.Line(plotX, gy, plotX+plotW, gy)
+		pdf.SetXY(x, gy-2)
+		pdf.CellFormat(pdfChartAxisWidth-2, 4, formatAxisValue(v), "", 0, "R", false, 0, "")
+	}
+
+	baseline := scaleY(math.Min(math.Max(0, lo), hi))
+	n := len(data.Categories)
+	slot := plotW / float64(n)
+
+	switch chartType {
+	case ChartBar:
+		barWidth := slot * 0.8 / float64(len(data.Series))
+		for si, series := range data.Series {
+			e.setFill(pdf, si)
+			for ci := 0; ci < n; ci++ {
+				bx := plotX + slot*float64(ci) + slot*0.1 + barWidth*float64(si)
+				fillBetween(pdf, bx, barWidth, scaleY(series.valueAt(ci)), baseline)
+			}
+		}
+	case ChartStacked:
+		barWidth := slot * 0.6
+		positive := make([]float64, n)
+		negative := make([]float64, n)
+		for si, series := range data.Series {
+			e.setFill(pdf, si)
+			for ci := 0; ci < n; ci++ {
+				v := series.valueAt(ci)
+				stack := positive
+				if v < 0 {
+					stack = negative
+				}
+				bx := plotX + slot*float64(ci) + slot*0.2
+				fillBetween(pdf, bx, barWidth, scaleY(stack[ci]), scaleY(stack[ci]+v))
+				stack[ci] += v
+			}
+		}
+	default:
+		pdf.SetLineWidth(0.6)
+		for si, series := range data.Series {
+			e.setFill(pdf, si)
+			e.setDraw(pdf, si)
+			var px, py float64
+			for ci := 0; ci < n && ci < len(series.Values); ci++ {
+				cx := plotX + slot*(float64(ci)+0.5)
+				cy := scaleY(series.Values[ci])
+				if ci > 0 {
+					pdf.Line(px, py, cx, cy)
+				}
+				pdf.Circle(cx, cy, 0.7, "F")
+				px, py = cx, cy
+			}
+		}
+	}
+
+	// Axes are drawn last so bars do not cover them
+	pdf.SetDrawColor(128, 128, 128)
+	pdf.SetLineWidth(0.3)
+	pdf.Line(plotX, plotY, plotX, plotY+plotH)
+	pdf.Line(plotX, baseline, plotX+plotW, baseline)
+
+	// Category labels, thinned out when they would overlap
+	every := int(math.Ceil(pdfChartLabelWidth / slot))
+	if every < 1 {
+		every = 1
+	}
+	labelWidth := math.Min(slot*float64(every), 30)
+	pdf.SetFont(e.config.FontFamily, "", 6.5)
+	pdf.SetTextColor(100, 100, 100)
+	for ci, category := range data.Categories {
+		if ci%every != 0 {
+			continue
+		}
+		cx := plotX + slot*(float64(ci)+0.5)
+		pdf.SetXY(cx-labelWidth/2, plotY+plotH+1)
+		pdf.CellFormat(labelWidth, 4, e.fitText(pdf, category, labelWidth), "", 0, "C", false, 0, "")
+	}
+
+	names := make([]string, len(data.Series))
+	for i, series := range data.Series {
+		names[i] = series.Name
+	}
+	e.drawLegend(pdf, names, x+w-pdfChartLegendWidth+4, plotY)
+}
+
+// drawPieChart draws the first series as wedges, one per category. Wedges are
+// polygons along the arc so the output stays vector.
+func (e *PDFExporter) drawPieChart(pdf *gofpdf.Fpdf, data *ChartData, x, y, w, h float64) {
+	series := data.Series[0]
+	total := 0.0
+	for ci := range data.Categories {
+		if v := series.valueAt(ci); v > 0 {
+			total += v
+		}
+	}
+	if total <= 0 {
+		return
+	}
+
+	plotW := w - pdfChartLegendWidth
+	radius := math.Min(plotW, h)/2 - 4
+	cx := x + plotW/2
+	cy := y + h/2
+
+	pdf.SetDrawColor(255, 255, 255)
+	pdf.SetLineWidth(0.4)
+
+	labels := make([]string, len(data.Categories))
+	angle := -math.Pi / 2
+	for ci, category := range data.Categories {
+		v := series.valueAt(ci)
+		if v < 0 {
+			v = 0
+		}
+		labels[ci] = fmt.Sprintf("%s (%.1f%%)", category, v/total*100)
+		if v == 0 {
+			continue
+		}
+
+		sweep := v / total * 2 * math.Pi
+		segments := int(math.Max(2, math.Ceil(sweep/(math.Pi/90))))
+		points := make([]gofpdf.PointType, 0, segments+2)
+		points = append(points, gofpdf.PointType{X: cx, Y: cy})
+		for k := 0; k <= segments; k++ {
+			a := angle + sweep*float64(k)/float64(segments)
+			points = append(points, gofpdf.PointType{X: cx + radius*math.Cos(a), Y: cy + radius*math.Sin(a)})
+		}
+
+		e.setFill(pdf, ci)
+		pdf.Polygon(points, "FD")
+		angle += sweep
+	}
+
+	e.drawLegend(pdf, labels, x+w-pdfChartLegendWidth+4, y+2)
+}
+
+func (e *PDFExporter) drawLegend(pdf *gofpdf.Fpdf, names []string, x, y float64) {
+	pdf.SetFont(e.config.FontFamily, "", 7)
+	pdf.SetTextColor(60, 60, 60)
+	for i, name := range names {
+		ly := y + float64(i)*5
+		if ly > y+pdfChartHeight-8 {
+			break
+		}
+		e.setFill(pdf, i)
+		pdf.Rect(x, ly+0.5, 3, 3, "F")
+		pdf.SetXY(x+4, ly)
+		pdf.CellFormat(pdfChartLegendWidth-8, 4, truncateRunes(name, pdfLegendMaxRunes), "", 0, "L", false, 0, "")
+	}
+}
+
+func (e *PDFExporter) setFill(pdf *gofpdf.Fpdf, i int) {
+	c := paletteColor(i)
+	pdf.SetFillColor(c[0], c[1], c[2])
+}
+
+func (e *PDFExporter) setDraw(pdf *gofpdf.Fpdf, i int) {
+	c := paletteColor(i)
+	pdf.SetDrawColor(c[0], c[1], c[2])
+}
+
+// fitText shortens text with an ellipsis until it fits the given width
+func (e *PDFExporter) fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 1 {
+		runes = runes[:len(runes)-1]
+		if candidate := string(runes) + "..."; pdf.GetStringWidth(candidate) <= width {
+			return candidate
+		}
+	}
+	return string(runes)
+}
+
+// fillBetween fills a bar spanning two y coordinates in either order
+func fillBetween(pdf *gofpdf.Fpdf, x, width, y1, y2 float64) {
+	top, height := y1, y2-y1
+	if height < 0 {
+		top, height = y2, -height
+	}
+	if height > 0 {
+		pdf.Rect(x, top, width, height, "F")
+	}
+}
+
+// chartRange returns the value range to plot, always including zero. Stacked
+// charts use the per-category totals of positive and negative values.
+func chartRange(chartType string, data *ChartData) (lo, hi float64) {
+	n := len(data.Categories)
+	if chartType == ChartStacked {
+		for ci := 0; ci < n; ci++ {
+			var pos, neg float64
+			for _, series := range data.Series {
+				if v := series.valueAt(ci); v >= 0 {
+					pos += v
+				} else {
+					neg += v
+				}
+			}
+			hi = math.Max(hi, pos)
+			lo = math.Min(lo, neg)
+		}
+		return lo, hi
+	}
+
+	for _, series := range data.Series {
+		for ci := 0; ci < n && ci < len(series.Values); ci++ {
+			hi = math.Max(hi, series.Values[ci])
+			lo = math.Min(lo, series.Values[ci])
+		}
+	}
+	return lo, hi
+}
+
+// niceStep rounds a raw tick interval up to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	if raw <= 0 || math.IsNaN(raw) || math.IsInf(raw, 0) {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch fraction := raw / magnitude; {
+	case fraction <= 1:
+		return magnitude
+	case fraction <= 2:
+		return 2 * magnitude
+	case fraction <= 5:
+		return 5 * magnitude
+	default:
+		return 10 * magnitude
+	}
+}
+
+// formatAxisValue renders tick labels compactly, e.g. 1.5k or 2M
+func formatAxisValue(v float64) string {
+	round := func(x float64) string {
+		return strconv.FormatFloat(math.Round(x*100)/100, 'f', -1, 64)
+	}
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e9:
+		return round(v/1e9) + "B"
+	case abs >= 1e6:
+		return round(v/1e6) + "M"
+	case abs >= 1e3:
+		return round(v/1e3) + "k"
+	default:
+		return round(v)
+	}
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
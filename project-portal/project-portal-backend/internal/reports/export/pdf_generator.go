@@ -351,7 +351,8 @@ func (e *PDFExporter) addSummary(pdf *gofpdf.Fpdf, summary map[string]interface{
 	pdf.Ln(5)
 }
 
-// ExportChartReport exports a report with charts
+// ExportChartReport exports a report with charts. Each section is drawn as
+// its KPI summary block, then its chart as vector graphics, then its table.
 func (e *PDFExporter) ExportChartReport(ctx context.Context, sections []ReportSection) ([]byte, error) {
 	orientation := "P"
 	if e.config.Orientation == "landscape" {
@@ -396,6 +397,14 @@ func (e *PDFExporter) ExportChartReport(ctx context.Context, sections []ReportSe
 			pdf.Ln(3)
 		}
 
+		if len(section.KPIs) > 0 {
+			e.addKPIs(pdf, section.KPIs)
+		}
+
+		if section.hasChart() {
+			e.addChart(pdf, section.ChartType, section.ChartData)
+		}
+
 		// Add table if data present
 		if len(section.Data) > 0 {
 			columns := section.Columns
@@ -421,6 +430,7 @@ type ReportSection struct {
 	Description string
 	Columns     []string
 	Data        []map[string]interface{}
-	ChartType   string
-	ChartData   interface{}
+	ChartType   string // line, bar, stacked, pie
+	ChartData   *ChartData
+	KPIs        []KPI
 }
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column data types, matching the report field metadata
+const (
+	ColumnString  = "string"
+	ColumnNumber  = "number"
+	ColumnInteger = "integer"
+	ColumnBoolean = "boolean"
+	ColumnDate    = "date"
+)
+
+// Column describes one output column of a streamed export
+type Column struct {
+	Name string
+	Type string // string, number, integer, boolean, date
+}
+
+// RowWriter writes rows to an output stream one at a time, so exports of
+// large result sets never hold the full result in memory. Close flushes any
+// buffered rows and writes trailing metadata; it does not close the output.
+type RowWriter interface {
+	WriteRow(row map[string]interface{}) error
+	Close() error
+}
+
+// normalizeColumnType maps data type aliases onto the column types
+func normalizeColumnType(dataType string) string {
+	switch strings.ToLower(dataType) {
+	case "number", "numeric", "decimal", "float", "double":
+		return ColumnNumber
+	case "integer", "int", "bigint":
+		return ColumnInteger
+	case "boolean", "bool":
+		return ColumnBoolean
+	case "date", "datetime", "timestamp":
+		return ColumnDate
+	default:
+		return ColumnString
+	}
+}
+
+// asFloat converts a scanned SQL value to a float64
+func asFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case []byte:
+		f, err := strconv.ParseFloat(string(val), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// asInt converts a scanned SQL value to an int64, rounding fractional values
+func asInt(v interface{}) (int64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return val, true
+	case int:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	default:
+		f, ok := asFloat(v)
+		return int64(math.Round(f)), ok
+	}
+}
+
+// asBool converts a scanned SQL value to a bool
+func asBool(v interface{}) (bool, bool) {
+	switch val := v.(type) {
+	case bool:
+		return val, true
+	case []byte:
+		b, err := strconv.ParseBool(string(val))
+		return b, err == nil
+	case string:
+		b, err := strconv.ParseBool(val)
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// asTime converts a scanned SQL value to a time
+func asTime(v interface{}) (time.Time, bool) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case []byte:
+		return parseTime(string(val))
+	case string:
+		return parseTime(val)
+	default:
+		return time.Time{}, false
+	}
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// asString renders a scanned SQL value as text
+func asString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
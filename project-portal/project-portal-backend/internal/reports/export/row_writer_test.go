@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var streamColumns = []Column{
+	{Name: "project", Type: "string"},
+	{Name: "credits", Type: "number"},
+	{Name: "transactions", Type: "integer"},
+	{Name: "verified", Type: "boolean"},
+	{Name: "issued_at", Type: "date"},
+}
+
+func streamRows() []map[string]interface{} {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []map[string]interface{}{
+		{"project": "Mangrove A", "credits": []byte("1250.5"), "transactions": int64(4), "verified": true, "issued_at": issued},
+		{"project": "Peatland B", "credits": nil, "transactions": 2.0, "verified": "false", "issued_at": "2026-04-01"},
+	}
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, streamColumns)
+	if err != nil {
+		t.Fatalf("NewParquetWriter: %v", err)
+	}
+	for _, row := range streamRows() {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	type record struct {
+		Project      *string  `parquet:"project,optional"`
+		Credits      *float64 `parquet:"credits,optional"`
+		Transactions *int64   `parquet:"transactions,optional"`
+		Verified     *bool    `parquet:"verified,optional"`
+		IssuedAt     *int64   `parquet:"issued_at,optional"` // milliseconds since the epoch
+	}
+	reader := parquet.NewGenericReader[record](bytes.NewReader(buf.Bytes()))
+	defer reader.Close()
+
+	got := make([]record, 2)
+	if n, err := reader.Read(got); n != 2 || (err != nil && err != io.EOF) {
+		t.Fatalf("Read = %d, %v", n, err)
+	}
+
+	if got[0].Project == nil || *got[0].Project != "Mangrove A" {
+		t.Errorf("project = %v", got[0].Project)
+	}
+	if got[0].Credits == nil || *got[0].Credits != 1250.5 {
+		t.Errorf("credits = %v, want 1250.5", got[0].Credits)
+	}
+	if got[1].Credits != nil {
+		t.Errorf("NULL credits read back as %v", *got[1].Credits)
+	}
+	if got[1].Transactions == nil || *got[1].Transactions != 2 {
+		t.Errorf("transactions = %v, want 2", got[1].Transactions)
+	}
+	if got[1].Verified == nil || *got[1].Verified {
+		t.Errorf("verified = %v, want false", got[1].Verified)
+	}
+	if want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC).UnixMilli(); got[1].IssuedAt == nil || *got[1].IssuedAt != want {
+		t.Errorf("issued_at = %v", got[1].IssuedAt)
+	}
+}
+
+func TestNDJSONWriterTypesValues(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf, streamColumns)
+	for _, row := range streamRows() {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %d is not JSON: %v", len(lines)+1, err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	if lines[0]["credits"] != 1250.5 {
+		t.Errorf("credits = %#v, want number 1250.5", lines[0]["credits"])
+	}
+	if lines[1]["credits"] != nil {
+		t.Errorf("credits = %#v, want null", lines[1]["credits"])
+	}
+	if lines[1]["verified"] != false {
+		t.Errorf("verified = %#v, want false", lines[1]["verified"])
+	}
+	if lines[0]["issued_at"] != "2026-03-01T12:00:00Z" {
+		t.Errorf("issued_at = %#v", lines[0]["issued_at"])
+	}
+}
@@ -0,0 +1,97 @@
+package reports
+
+import (
+	"context"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/export"
+)
+
+// reportDataSectionTitle heads the result table when a report has sections
+const reportDataSectionTitle = "Report Data"
+
+// fileExporter renders report results with the export package
+type fileExporter struct{}
+
+// NewExporter creates an Exporter that writes CSV, Excel and PDF files.
+// Reports with sections are exported with charts and KPI summaries.
+func NewExporter() Exporter {
+	return &fileExporter{}
+}
+
+func (x *fileExporter) ExportCSV(ctx context.Context, data []map[string]interface{}, config ExportConfig) ([]byte, error) {
+	csvConfig := export.DefaultCSVConfig()
+	csvConfig.IncludeHeader = config.IncludeHeader
+	return export.NewCSVExporter(csvConfig).Export(ctx, data, exportColumns(config.Fields))
+}
+
+func (x *fileExporter) ExportExcel(ctx context.Context, data []map[string]interface{}, config ExportConfig) ([]byte, error) {
+	exporter := export.NewExcelExporter(export.DefaultExcelConfig())
+	if len(config.Sections) > 0 {
+		return exporter.ExportChartReport(ctx, toReportSections(data, config))
+	}
+	return exporter.Export(ctx, data, exportColumns(config.Fields))
+}
+
+func (x *fileExporter) ExportPDF(ctx context.Context, data []map[string]interface{}, config ExportConfig) ([]byte, error) {
+	pdfConfig := export.DefaultPDFConfig()
+	if config.Title != "" {
+		pdfConfig.Title = config.Title
+	}
+	pdfConfig.Subtitle = config.Description
+	if config.PageSize != "" {
+		pdfConfig.PageSize = config.PageSize
+	}
+	if config.Orientation != "" {
+		pdfConfig.Orientation = config.Orientation
+	}
+
+	exporter := export.NewPDFExporter(pdfConfig)
+	if len(config.Sections) > 0 {
+		return exporter.ExportChartReport(ctx, toReportSections(data, config))
+	}
+	return exporter.Export(ctx, data, exportColumns(config.Fields), nil)
+}
+
+// exportColumns lists the visible result columns in field order
+func exportColumns(fields []FieldConfig) []string {
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !f.IsHidden {
+			columns = append(columns, columnKey(f))
+		}
+	}
+	return columns
+}
+
+// toReportSections converts resolved sections for the export package and
+// appends the result rows as a final table section.
+func toReportSections(data []map[string]interface{}, config ExportConfig) []export.ReportSection {
+	sections := make([]export.ReportSection, 0, len(config.Sections)+1)
+	for _, s := range config.Sections {
+		section := export.ReportSection{
+			Title:       s.Title,
+			Description: s.Description,
+			ChartType:   s.ChartType,
+		}
+		if s.Chart != nil {
+			chart := &export.ChartData{XAxis: s.Chart.XAxis, Categories: s.Chart.Categories}
+			for _, series := range s.Chart.Series {
+				chart.Series = append(chart.Series, export.ChartDataSeries{Name: series.Name, Values: series.Data})
+			}
+			section.ChartData = chart
+		}
+		for _, kpi := range s.KPIs {
+			section.KPIs = append(section.KPIs, export.KPI{Label: kpi.Label, Value: kpi.Formatted})
+		}
+		sections = append(sections, section)
+	}
+
+	if len(data) > 0 {
+		sections = append(sections, export.ReportSection{
+			Title:   reportDataSectionTitle,
+			Columns: exportColumns(config.Fields),
+			Data:    data,
+		})
+	}
+	return sections
+}
@@ -0,0 +1,179 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
+	"github.com/google/uuid"
+)
+
+const defaultForecastInterval = "month"
+
+// forecastMetricUnits lists the unit of each forecastable metric
+var forecastMetricUnits = map[ForecastMetric]string{
+	ForecastCreditsIssued: "credits",
+	ForecastSequestration: "tCO2e",
+}
+
+// defaultSeasonLengths is the number of periods in a yearly cycle for each interval
+var defaultSeasonLengths = map[string]int{
+	"week":    52,
+	"month":   12,
+	"quarter": 4,
+	"year":    0,
+}
+
+// ========== Forecasting ==========
+
+// GetForecast projects a project's credit issuance or sequestration forward.
+// History is bucketed by interval, with empty periods counted as zero, up to
+// the last complete period.
+func (s *service) GetForecast(ctx context.Context, req ForecastRequest) (*ForecastResponse, error) {
+	projectID, err := uuid.Parse(req.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project ID")
+	}
+
+	unit, ok := forecastMetricUnits[req.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unsupported forecast metric: %s", req.Metric)
+	}
+
+	interval := req.Interval
+	if interval == "" {
+		interval = defaultForecastInterval
+	}
+	seasonLength, ok := defaultSeasonLengths[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+	if req.SeasonLength != 0 {
+		seasonLength = req.SeasonLength
+	}
+
+	buckets, err := s.repo.GetProjectMetricHistory(ctx, projectID, req.Metric, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metric history: %w", err)
+	}
+
+	now := time.Now()
+	history := fillForecastHistory(buckets, interval, now)
+	if len(history) < 3 {
+		return nil, fmt.Errorf("at least 3 complete %s periods of history are required", interval)
+	}
+
+	forecast, err := s.trends.Forecast(history, benchmarks.ForecastOptions{
+		Model:        req.Model,
+		Horizon:      req.Horizon,
+		SeasonLength: seasonLength,
+		Confidence:   req.Confidence,
+		NonNegative:  req.Metric == ForecastCreditsIssued,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForecastResponse{
+		ProjectID:   projectID,
+		Metric:      req.Metric,
+		Unit:        unit,
+		Interval:    interval,
+		History:     history,
+		Forecast:    forecast,
+		GeneratedAt: now,
+	}, nil
+}
+
+// fillForecastHistory turns sparse buckets into an evenly spaced series from
+// the first bucket to the last complete period before now.
+func fillForecastHistory(buckets []TimeSeriesPoint, interval string, now time.Time) []benchmarks.DataPoint {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	values := make(map[string]float64, len(buckets))
+	for _, b := range buckets {
+		values[b.Time.UTC().Format(categoryDateFormat)] += b.Value
+	}
+
+	current := truncateToInterval(now.UTC(), interval)
+	start := truncateToInterval(buckets[0].Time.UTC(), interval)
+
+	var history []benchmarks.DataPoint
+	for t := start; t.Before(current); t = addInterval(t, interval) {
+		date := t.Format(categoryDateFormat)
+		history = append(history, benchmarks.DataPoint{Date: date, Value: values[date]})
+	}
+	return history
+}
+
+// truncateToInterval mirrors Postgres date_trunc for the supported intervals
+func truncateToInterval(t time.Time, interval string) time.Time {
+	year, month, day := t.Date()
+	switch interval {
+	case "week":
+		d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		offset := (int(d.Weekday()) + 6) % 7 // weeks start on Monday
+		return d.AddDate(0, 0, -offset)
+	case "quarter":
+		return time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func addInterval(t time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// resolveForecastChart plots a project's history followed by its projection
+// and prediction interval. Projected series start after the last actual value.
+func (s *service) resolveForecastChart(ctx context.Context, config WidgetConfig) (*ChartWidgetData, error) {
+	result, err := s.GetForecast(ctx, *config.Forecast)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(result.History)
+	chart := &ChartWidgetData{
+		ChartType:  config.ChartType,
+		XAxis:      "date",
+		Categories: make([]string, 0, n+len(result.Forecast.Points)),
+		Series: []ChartSeries{
+			{Name: string(result.Metric), Data: make([]float64, 0, n)},
+			{Name: "forecast", Offset: n},
+			{Name: "lower", Offset: n},
+			{Name: "upper", Offset: n},
+		},
+	}
+	if chart.ChartType == "" {
+		chart.ChartType = "line"
+	}
+
+	for _, dp := range result.History {
+		chart.Categories = append(chart.Categories, dp.Date)
+		chart.Series[0].Data = append(chart.Series[0].Data, dp.Value)
+	}
+	for _, p := range result.Forecast.Points {
+		chart.Categories = append(chart.Categories, p.Date)
+		chart.Series[1].Data = append(chart.Series[1].Data, p.Value)
+		chart.Series[2].Data = append(chart.Series[2].Data, p.Lower)
+		chart.Series[3].Data = append(chart.Series[3].Data, p.Upper)
+	}
+
+	return chart, nil
+}
@@ -1,10 +1,15 @@
 package reports
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -31,6 +36,12 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 		reports.DELETE("/:id", h.DeleteReport)
 		reports.POST("/:id/clone", h.CloneReport)
 
+		// Sharing
+		reports.PUT("/:id/sharing", h.UpdateSharing)
+		reports.POST("/:id/share-links", h.CreateShareLink)
+		reports.GET("/:id/share-links", h.ListShareLinks)
+		reports.DELETE("/:id/share-links/:linkId", h.RevokeShareLink)
+
 		// Report Execution
 		reports.POST("/:id/execute", h.ExecuteReport)
 		reports.GET("/:id/export", h.ExportReport)
@@ -53,6 +64,7 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 		reports.POST("/dashboard/widgets", h.CreateWidget)
 		reports.PUT("/dashboard/widgets/:widgetId", h.UpdateWidget)
 		reports.DELETE("/dashboard/widgets/:widgetId", h.DeleteWidget)
+		reports.GET("/widgets/:widgetId/data", h.GetWidgetData)
 
 		// Schedules
 		reports.POST("/schedules", h.CreateSchedule)
@@ -67,6 +79,19 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 		reports.GET("/benchmarks", h.ListBenchmarks)
 		reports.POST("/benchmarks", h.CreateBenchmark)
 		reports.PUT("/benchmarks/:benchmarkId", h.UpdateBenchmark)
+		reports.POST("/benchmarks/import", h.ImportBenchmark)
+		reports.POST("/benchmarks/peers/refresh", requireAdmin(), h.RefreshPeerBenchmarks)
+		reports.GET("/benchmarks/peers/percentile", h.GetPeerPercentile)
+
+		// Forecasts
+		reports.GET("/forecasts", h.GetForecast)
+	}
+
+	// Public share links, authorised by the token in the path
+	shared := router.Group("/shared/reports")
+	{
+		shared.GET("/:token", h.OpenShareLink)
+		shared.GET("/:token/embed", h.OpenEmbed)
 	}
 }
 
@@ -91,6 +116,36 @@ func getUserID(c *gin.Context) uuid.UUID {
 	return uuid.Nil
 }
 
+// requireAdmin refuses callers the gateway has not granted admin permissions.
+// The benchmark worker refreshes through the service and is not affected.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, p := range strings.Split(c.GetHeader("X-Permissions"), ",") {
+			if p = strings.TrimSpace(p); p == "admin" || p == "*" {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+	}
+}
+
+// recordChange audits a change to a reports record for the audit middleware
+func recordChange(c *gin.Context, targetType string, targetID uuid.UUID, owner *uuid.UUID, action string, before, after any) {
+	change := compliance.AuditChange{
+		TargetType:   targetType,
+		TargetID:     targetID.String(),
+		DataCategory: compliance.DataCategoryProjectData,
+		Action:       action,
+		Before:       before,
+		After:        after,
+	}
+	if owner != nil && *owner != uuid.Nil {
+		change.TargetOwnerID = owner.String()
+	}
+	compliance.RecordChange(c, change)
+}
+
 // ========== Report Definitions ==========
 
 // CreateReport creates a new report definition
@@ -117,6 +172,7 @@ func (h *Handler) CreateReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_definition", report.ID, report.CreatedBy, "", nil, report)
 
 	c.JSON(http.StatusCreated, report)
 }
@@ -216,11 +272,17 @@ func (h *Handler) UpdateReport(c *gin.Context) {
 	}
 
 	userID := getUserID(c)
+	before, err := h.service.GetReport(c.Request.Context(), userID, reportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	report, err := h.service.UpdateReport(c.Request.Context(), userID, reportID, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_definition", reportID, before.CreatedBy, "", before, report)
 
 	c.JSON(http.StatusOK, report)
 }
@@ -241,10 +303,16 @@ func (h *Handler) DeleteReport(c *gin.Context) {
 	}
 
 	userID := getUserID(c)
+	before, err := h.service.GetReport(c.Request.Context(), userID, reportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.service.DeleteReport(c.Request.Context(), userID, reportID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_definition", reportID, before.CreatedBy, "", before, nil)
 
 	c.Status(http.StatusNoContent)
 }
@@ -280,6 +348,7 @@ func (h *Handler) CloneReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_definition", report.ID, report.CreatedBy, "clone", nil, report)
 
 	c.JSON(http.StatusCreated, report)
 }
@@ -329,6 +398,7 @@ func (h *Handler) ExecuteReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_execution", execution.ID, execution.TriggeredBy, "execute", nil, execution)
 
 	c.JSON(http.StatusAccepted, execution)
 }
@@ -339,7 +409,7 @@ func (h *Handler) ExecuteReport(c *gin.Context) {
 // @Tags reports
 // @Produce application/octet-stream
 // @Param id path string true "Report ID"
-// @Param format query string false "Export format (csv, excel, pdf, json)" default(csv)
+// @Param format query string false "Export format (csv, excel, pdf, json, parquet, ndjson)" default(csv)
 // @Success 200 {file} file
 // @Router /api/v1/reports/{id}/export [get]
 func (h *Handler) ExportReport(c *gin.Context) {
@@ -451,10 +521,17 @@ func (h *Handler) CancelExecution(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetExecution(c.Request.Context(), executionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.service.CancelExecution(c.Request.Context(), executionID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	after, _ := h.service.GetExecution(c.Request.Context(), executionID)
+	recordChange(c, "report_execution", executionID, before.TriggeredBy, "cancel", before, after)
 
 	c.JSON(http.StatusOK, gin.H{"message": "execution cancelled"})
 }
@@ -590,6 +667,7 @@ func (h *Handler) CreateWidget(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "dashboard_widget", saved.ID, saved.UserID, "", nil, saved)
 
 	c.JSON(http.StatusCreated, saved)
 }
@@ -624,6 +702,7 @@ func (h *Handler) UpdateWidget(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "dashboard_widget", widgetID, saved.UserID, "update", nil, saved)
 
 	c.JSON(http.StatusOK, saved)
 }
@@ -646,10 +725,56 @@ func (h *Handler) DeleteWidget(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "dashboard_widget", widgetID, nil, "delete", nil, nil)
 
 	c.Status(http.StatusNoContent)
 }
 
+// GetWidgetData resolves the data for a dashboard widget
+// @Summary Get widget data
+// @Description Evaluate a widget's configuration and return chart series, metric, gauge or table data
+// @Tags reports
+// @Produce json
+// @Param widgetId path string true "Widget ID"
+// @Param page query int false "Page number (table widgets)" default(1)
+// @Param page_size query int false "Rows per page (table widgets)"
+// @Success 200 {object} WidgetDataResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/reports/widgets/{widgetId}/data [get]
+func (h *Handler) GetWidgetData(c *gin.Context) {
+	widgetID, err := uuid.Parse(c.Param("widgetId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid widget ID"})
+		return
+	}
+
+	req := WidgetDataRequest{}
+	if page, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil {
+		req.Page = page
+	}
+	if pageSize, err := strconv.Atoi(c.Query("page_size")); err == nil {
+		req.PageSize = pageSize
+	}
+
+	userID := getUserID(c)
+	data, err := h.service.GetWidgetData(c.Request.Context(), userID, widgetID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWidgetNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrWidgetAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
 // ========== Schedules ==========
 
 // CreateSchedule creates a new scheduled report
@@ -671,9 +796,18 @@ func (h *Handler) CreateSchedule(c *gin.Context) {
 	userID := getUserID(c)
 	schedule, err := h.service.CreateSchedule(c.Request.Context(), userID, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var entErr *settings.EntitlementError
+		switch {
+		case errors.As(err, &entErr):
+			c.JSON(http.StatusPaymentRequired, entErr)
+		case errors.Is(err, ErrUserRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
+	recordChange(c, "report_schedule", schedule.ID, &userID, "", nil, schedule)
 
 	c.JSON(http.StatusCreated, schedule)
 }
@@ -764,11 +898,17 @@ func (h *Handler) UpdateSchedule(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	schedule, err := h.service.UpdateSchedule(c.Request.Context(), scheduleID, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_schedule", scheduleID, nil, "", before, schedule)
 
 	c.JSON(http.StatusOK, schedule)
 }
@@ -787,10 +927,16 @@ func (h *Handler) DeleteSchedule(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.service.DeleteSchedule(c.Request.Context(), scheduleID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_schedule", scheduleID, nil, "", before, nil)
 
 	c.Status(http.StatusNoContent)
 }
@@ -820,10 +966,17 @@ func (h *Handler) ToggleSchedule(c *gin.Context) {
 		return
 	}
 
+	before, err := h.service.GetSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.service.ToggleSchedule(c.Request.Context(), scheduleID, req.Active); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "report_schedule", scheduleID, nil, "",
+		gin.H{"is_active": before.IsActive}, gin.H{"is_active": req.Active})
 
 	c.JSON(http.StatusOK, gin.H{"message": "schedule updated", "active": req.Active})
 }
@@ -912,6 +1065,7 @@ func (h *Handler) CreateBenchmark(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "benchmark_dataset", saved.ID, nil, "", nil, saved)
 
 	c.JSON(http.StatusCreated, saved)
 }
@@ -944,10 +1098,345 @@ func (h *Handler) UpdateBenchmark(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "benchmark_dataset", benchmarkID, nil, "update", nil, saved)
 
 	c.JSON(http.StatusOK, saved)
 }
 
+// ImportBenchmark imports a benchmark dataset from a CSV or XLSX table
+// @Summary Import benchmark
+// @Description Import a published benchmark table (admin only). Columns: metric, value, unit and optionally percentile, sample_size, lower_bound, upper_bound, description. Units are normalised on import.
+// @Tags reports
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV or XLSX benchmark table"
+// @Param name formData string true "Dataset name"
+// @Param category formData string true "Benchmark category"
+// @Param year formData int true "Benchmark year"
+// @Success 201 {object} BenchmarkImportResponse
+// @Failure 422 {object} BenchmarkImportResponse
+// @Router /api/v1/reports/benchmarks/import [post]
+func (h *Handler) ImportBenchmark(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBenchmarkUploadBytes)
+
+	var req ImportBenchmarkRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file field is required"})
+		return
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.service.ImportBenchmark(c.Request.Context(), req, fh.Filename, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	if result.Dataset != nil {
+		recordChange(c, "benchmark_dataset", result.Dataset.ID, nil, "import", nil, result.Dataset)
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// RefreshPeerBenchmarks recomputes peer benchmarks from portal projects
+// @Summary Refresh peer benchmarks
+// @Description Recompute benchmark datasets from portal projects grouped by methodology, region and year (admin only)
+// @Tags reports
+// @Produce json
+// @Success 200 {object} PeerBenchmarkRefreshResult
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/reports/benchmarks/peers/refresh [post]
+func (h *Handler) RefreshPeerBenchmarks(c *gin.Context) {
+	result, err := h.service.RefreshPeerBenchmarks(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "peer_benchmarks", DataCategory: compliance.DataCategoryProjectData, Action: "refresh", After: result,
+	})
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPeerPercentile ranks a project against its peer group
+// @Summary Get peer percentile
+// @Description Get a project's percentile rank for a metric among projects with the same methodology and region (project members only)
+// @Tags reports
+// @Produce json
+// @Param project_id query string true "Project ID"
+// @Param metric query string true "Metric name"
+// @Param methodology query string false "Peer methodology (defaults to the project's)"
+// @Param region query string false "Peer region (defaults to the project's)"
+// @Success 200 {object} PeerPercentileResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/reports/benchmarks/peers/percentile [get]
+func (h *Handler) GetPeerPercentile(c *gin.Context) {
+	var req PeerPercentileRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserID(c)
+	result, err := h.service.GetPeerPercentile(c.Request.Context(), userID, req)
+	if errors.Is(err, ErrProjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ========== Sharing ==========
+
+// UpdateSharing sets the users and roles a report is shared with
+// @Summary Update report sharing
+// @Description Replace the users and roles a report is shared with (owner only)
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param id path string true "Report ID"
+// @Param request body UpdateSharingRequest true "Sharing settings"
+// @Success 200 {object} ReportDefinition
+// @Router /api/v1/reports/{id}/sharing [put]
+func (h *Handler) UpdateSharing(c *gin.Context) {
+	reportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return
+	}
+
+	var req UpdateSharingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserID(c)
+	before, err := h.service.GetReport(c.Request.Context(), userID, reportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := h.service.UpdateSharing(c.Request.Context(), userID, reportID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "report_definition", reportID, before.CreatedBy, "share", before, report)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CreateShareLink creates a public link or embed token for a report
+// @Summary Create share link
+// @Description Create an expiring, read-only public link or embed token scoped to one execution or to live data (owner only). The token is only returned once.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param id path string true "Report ID"
+// @Param request body CreateShareLinkRequest true "Share link settings"
+// @Success 201 {object} CreateShareLinkResponse
+// @Router /api/v1/reports/{id}/share-links [post]
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	reportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserID(c)
+	result, err := h.service.CreateShareLink(c.Request.Context(), userID, reportID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Only the link is logged; the token is returned once and never stored
+	recordChange(c, "report_share_link", result.Link.ID, &userID, "", nil, result.Link)
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// ListShareLinks lists the share links of a report
+// @Summary List share links
+// @Description List public links and embed tokens issued for a report (owner only)
+// @Tags reports
+// @Produce json
+// @Param id path string true "Report ID"
+// @Success 200 {array} ReportShareLink
+// @Router /api/v1/reports/{id}/share-links [get]
+func (h *Handler) ListShareLinks(c *gin.Context) {
+	reportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return
+	}
+
+	userID := getUserID(c)
+	links, err := h.service.ListShareLinks(c.Request.Context(), userID, reportID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"share_links": links})
+}
+
+// RevokeShareLink revokes a share link
+// @Summary Revoke share link
+// @Description Immediately disable a public link or embed token (owner only)
+// @Tags reports
+// @Param id path string true "Report ID"
+// @Param linkId path string true "Share link ID"
+// @Success 204
+// @Router /api/v1/reports/{id}/share-links/{linkId} [delete]
+func (h *Handler) RevokeShareLink(c *gin.Context) {
+	reportID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report ID"})
+		return
+	}
+
+	linkID, err := uuid.Parse(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share link ID"})
+		return
+	}
+
+	userID := getUserID(c)
+	if err := h.service.RevokeShareLink(c.Request.Context(), userID, reportID, linkID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "report_share_link", linkID, &userID, "revoke", nil, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// OpenShareLink serves a report through a public share link
+// @Summary Open share link
+// @Description Read-only report data for a public share link. Protected links require the X-Share-Password header.
+// @Tags reports
+// @Produce json
+// @Param token path string true "Share token"
+// @Param X-Share-Password header string false "Link password"
+// @Success 200 {object} SharedReportView
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/shared/reports/{token} [get]
+func (h *Handler) OpenShareLink(c *gin.Context) {
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+
+	h.serveShareLink(c, ShareLinkPublic)
+}
+
+// OpenEmbed serves a report through an embed token for use in an iframe
+// @Summary Open embed
+// @Description Read-only report data for an embed token. Framing is limited to the token's allowed origins.
+// @Tags reports
+// @Produce json
+// @Param token path string true "Embed token"
+// @Success 200 {object} SharedReportView
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/shared/reports/{token}/embed [get]
+func (h *Handler) OpenEmbed(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+
+	h.serveShareLink(c, ShareLinkEmbed)
+}
+
+func (h *Handler) serveShareLink(c *gin.Context, kind ShareLinkKind) {
+	view, link, err := h.service.OpenShareLink(c.Request.Context(), c.Param("token"), ShareLinkAccess{
+		Kind:      kind,
+		Password:  c.GetHeader("X-Share-Password"),
+		ClientIP:  c.ClientIP(),
+		Endpoint:  c.FullPath(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, ErrSharePasswordRequired) {
+			status = http.StatusUnauthorized
+		} else if !errors.Is(err, ErrShareLinkNotFound) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if kind == ShareLinkEmbed {
+		c.Header("Content-Security-Policy", "frame-ancestors "+strings.Join(link.AllowedOrigins, " "))
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// ========== Forecasts ==========
+
+// GetForecast projects a project metric forward
+// @Summary Get forecast
+// @Description Forecast a project's credit issuance or sequestration with a linear or Holt-Winters model, including seasonal decomposition and prediction intervals
+// @Tags reports
+// @Produce json
+// @Param project_id query string true "Project ID"
+// @Param metric query string true "Metric (credits_issued, sequestration)"
+// @Param model query string false "Model (linear, holt_winters)"
+// @Param interval query string false "Bucket interval (week, month, quarter, year)" default(month)
+// @Param horizon query int false "Periods to project" default(12)
+// @Param season_length query int false "Periods per season (defaults from interval)"
+// @Param confidence query number false "Prediction interval coverage" default(0.95)
+// @Success 200 {object} ForecastResponse
+// @Router /api/v1/reports/forecasts [get]
+func (h *Handler) GetForecast(c *gin.Context) {
+	var req ForecastRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.GetForecast(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// maxBenchmarkUploadBytes limits the size of benchmark table uploads
+const maxBenchmarkUploadBytes = 10 << 20
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
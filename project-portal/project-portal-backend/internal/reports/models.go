@@ -3,7 +3,10 @@ package reports
 import (
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/datatypes"
 )
 
@@ -30,10 +33,12 @@ const (
 type ExportFormat string
 
 const (
-	FormatCSV   ExportFormat = "csv"
-	FormatExcel ExportFormat = "excel"
-	FormatPDF   ExportFormat = "pdf"
-	FormatJSON  ExportFormat = "json"
+	FormatCSV     ExportFormat = "csv"
+	FormatExcel   ExportFormat = "excel"
+	FormatPDF     ExportFormat = "pdf"
+	FormatJSON    ExportFormat = "json"
+	FormatParquet ExportFormat = "parquet"
+	FormatNDJSON  ExportFormat = "ndjson"
 )
 
 // DeliveryMethod defines how reports are delivered
@@ -55,6 +60,22 @@ const (
 	StatusFailed     ExecutionStatus = "failed"
 )
 
+// ShareLinkKind defines how a share link may be used
+type ShareLinkKind string
+
+const (
+	ShareLinkPublic ShareLinkKind = "link"  // opened directly, optionally password-protected
+	ShareLinkEmbed  ShareLinkKind = "embed" // framed by allowed partner origins
+)
+
+// ShareScope defines which data a share link exposes
+type ShareScope string
+
+const (
+	ShareScopeExecution ShareScope = "execution" // results of a single completed execution
+	ShareScopeLive      ShareScope = "live"      // the report re-run on every view
+)
+
 // WidgetType defines the type of dashboard widget
 type WidgetType string
 
@@ -95,11 +116,12 @@ type ReportDefinition struct {
 	Config            datatypes.JSON   `gorm:"type:jsonb;not null" json:"config"`
 	CreatedBy         *uuid.UUID       `gorm:"type:uuid" json:"created_by,omitempty"`
 	Visibility        ReportVisibility `gorm:"type:varchar(50);default:'private'" json:"visibility"`
-	SharedWithUsers   []uuid.UUID      `gorm:"type:uuid[]" json:"shared_with_users,omitempty"`
-	SharedWithRoles   []string         `gorm:"type:varchar(50)[]" json:"shared_with_roles,omitempty"`
+	SharedWithUsers   pq.StringArray   `gorm:"type:uuid[]" json:"shared_with_users,omitempty"`
+	SharedWithRoles   pq.StringArray   `gorm:"type:varchar(50)[]" json:"shared_with_roles,omitempty"`
 	Version           int              `gorm:"default:1" json:"version"`
 	IsTemplate        bool             `gorm:"default:false" json:"is_template"`
 	BasedOnTemplateID *uuid.UUID       `gorm:"type:uuid" json:"based_on_template_id,omitempty"`
+	CacheTTLSeconds   *int             `json:"cache_ttl_seconds,omitempty"` // nil uses the service default, 0 disables reuse
 	CreatedAt         time.Time        `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt         time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -118,6 +140,38 @@ type ReportConfig struct {
 	Sorts        []SortConfig        `json:"sorts,omitempty"`
 	Calculations []CalculationConfig `json:"calculations,omitempty"`
 	Limit        int                 `json:"limit,omitempty"`
+	Offset       int                 `json:"offset,omitempty"`
+	Sections     []SectionConfig     `json:"sections,omitempty"`
+}
+
+// Chart types supported in report sections
+const (
+	SectionChartLine    = "line"
+	SectionChartBar     = "bar"
+	SectionChartStacked = "stacked"
+	SectionChartPie     = "pie"
+)
+
+// SectionConfig describes a chart section and KPI summary block drawn in
+// PDF and Excel exports. Sections query the report's dataset and filters.
+type SectionConfig struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	ChartType   string         `json:"chart_type,omitempty"` // line, bar, stacked, pie
+	XAxis       string         `json:"x_axis,omitempty"`
+	YAxis       []string       `json:"y_axis,omitempty"` // pie charts take exactly one field
+	Filters     []FilterConfig `json:"filters,omitempty"`
+	KPIs        []KPIConfig    `json:"kpis,omitempty"`
+}
+
+// KPIConfig describes a headline figure in a section's summary block
+type KPIConfig struct {
+	Label     string            `json:"label"`
+	Field     string            `json:"field,omitempty"`
+	Aggregate AggregateFunction `json:"aggregate,omitempty"` // defaults to SUM
+	Format    string            `json:"format,omitempty"`    // number, integer, percent
+	Prefix    string            `json:"prefix,omitempty"`
+	Suffix    string            `json:"suffix,omitempty"`
 }
 
 // FieldConfig represents a field in the report
@@ -227,6 +281,9 @@ type ReportExecution struct {
 	DeliveryStatus     datatypes.JSON  `gorm:"type:jsonb" json:"delivery_status,omitempty"`
 	Parameters         datatypes.JSON  `gorm:"type:jsonb" json:"parameters,omitempty"`
 	ExecutionLog       string          `gorm:"type:text" json:"execution_log,omitempty"`
+	ResultSnapshot     datatypes.JSON  `gorm:"type:jsonb" json:"-"` // result rows, kept for execution-scoped share links
+	Fingerprint        string          `gorm:"type:varchar(64);index" json:"fingerprint,omitempty"`
+	CacheHits          int             `gorm:"default:0" json:"cache_hits"`
 	CreatedAt          time.Time       `gorm:"autoCreateTime" json:"created_at"`
 
 	// Associations
@@ -294,6 +351,33 @@ func (DashboardWidget) TableName() string {
 	return "dashboard_widgets"
 }
 
+// ReportShareLink represents a read-only public link or embed token for a report.
+// Only a hash of the token is stored; the token itself is returned once on creation.
+type ReportShareLink struct {
+	ID                 uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ReportDefinitionID uuid.UUID      `gorm:"type:uuid;not null;index" json:"report_definition_id"`
+	ExecutionID        *uuid.UUID     `gorm:"type:uuid" json:"execution_id,omitempty"`
+	Kind               ShareLinkKind  `gorm:"type:varchar(20);not null" json:"kind"`
+	Scope              ShareScope     `gorm:"type:varchar(20);not null" json:"scope"`
+	TokenHash          string         `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	TokenPrefix        string         `gorm:"type:varchar(20);not null" json:"token_prefix"`
+	PasswordHash       string         `gorm:"type:varchar(255)" json:"-"`
+	PasswordProtected  bool           `gorm:"default:false" json:"password_protected"`
+	AllowedOrigins     pq.StringArray `gorm:"type:text[]" json:"allowed_origins,omitempty"`
+	ExpiresAt          time.Time      `gorm:"not null" json:"expires_at"`
+	RevokedAt          *time.Time     `json:"revoked_at,omitempty"`
+	RevokedBy          *uuid.UUID     `gorm:"type:uuid" json:"revoked_by,omitempty"`
+	CreatedBy          uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
+	AccessCount        int            `gorm:"default:0" json:"access_count"`
+	LastAccessedAt     *time.Time     `json:"last_accessed_at,omitempty"`
+	CreatedAt          time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName specifies the table name for GORM
+func (ReportShareLink) TableName() string {
+	return "report_share_links"
+}
+
 // WidgetConfig represents widget-specific configuration
 type WidgetConfig struct {
 	// Common fields
@@ -311,22 +395,22 @@ type WidgetConfig struct {
 	Stacked        bool     `json:"stacked,omitempty"`
 	ShowDataLabels bool     `json:"show_data_labels,omitempty"`
 
+	// Forecast plots a project's history and projection instead of querying DataSource
+	Forecast *ForecastRequest `json:"forecast,omitempty"`
+
 	// Metric-specific
-	MetricField   string `json:"metric_field,omitempty"`
-	CompareField  string `json:"compare_field,omitempty"`
-	TrendPeriod   string `json:"trend_period,omitempty"` // 7d, 30d, 90d
-	DisplayFormat string `json:"display_format,omitempty"`
-	Prefix        string `json:"prefix,omitempty"`
-	Suffix        string `json:"suffix,omitempty"`
+	MetricField     string            `json:"metric_field,omitempty"`
+	MetricAggregate AggregateFunction `json:"metric_aggregate,omitempty"` // defaults to SUM
+	CompareField    string            `json:"compare_field,omitempty"`    // date field used to split trend periods
+	TrendPeriod     string            `json:"trend_period,omitempty"`     // 7d, 30d, 90d
+	DisplayFormat   string            `json:"display_format,omitempty"`
+	Prefix          string            `json:"prefix,omitempty"`
+	Suffix          string            `json:"suffix,omitempty"`
 
 	// Gauge-specific
-	MinValue   float64 `json:"min_value,omitempty"`
-	MaxValue   float64 `json:"max_value,omitempty"`
-	Thresholds []struct {
-		Value float64 `json:"value"`
-		Color string  `json:"color"`
-		Label string  `json:"label,omitempty"`
-	} `json:"thresholds,omitempty"`
+	MinValue   float64          `json:"min_value,omitempty"`
+	MaxValue   float64          `json:"max_value,omitempty"`
+	Thresholds []GaugeThreshold `json:"thresholds,omitempty"`
 
 	// Table-specific
 	Columns    []FieldConfig `json:"columns,omitempty"`
@@ -335,31 +419,45 @@ type WidgetConfig struct {
 	Searchable bool          `json:"searchable,omitempty"`
 }
 
+// GaugeThreshold represents a colored band on a gauge widget
+type GaugeThreshold struct {
+	Value float64 `json:"value"`
+	Color string  `json:"color"`
+	Label string  `json:"label,omitempty"`
+}
+
 // ========== Request/Response Types ==========
 
 // CreateReportRequest represents the request to create a report
 type CreateReportRequest struct {
-	Name        string           `json:"name" binding:"required"`
-	Description string           `json:"description,omitempty"`
-	Category    ReportCategory   `json:"category,omitempty"`
-	Config      ReportConfig     `json:"config" binding:"required"`
-	Visibility  ReportVisibility `json:"visibility,omitempty"`
-	IsTemplate  bool             `json:"is_template,omitempty"`
+	Name            string           `json:"name" binding:"required"`
+	Description     string           `json:"description,omitempty"`
+	Category        ReportCategory   `json:"category,omitempty"`
+	Config          ReportConfig     `json:"config" binding:"required"`
+	Visibility      ReportVisibility `json:"visibility,omitempty"`
+	IsTemplate      bool             `json:"is_template,omitempty"`
+	CacheTTLSeconds *int             `json:"cache_ttl_seconds,omitempty" binding:"omitempty,min=0"`
 }
 
 // UpdateReportRequest represents the request to update a report
 type UpdateReportRequest struct {
-	Name        string           `json:"name,omitempty"`
-	Description string           `json:"description,omitempty"`
-	Category    ReportCategory   `json:"category,omitempty"`
-	Config      *ReportConfig    `json:"config,omitempty"`
-	Visibility  ReportVisibility `json:"visibility,omitempty"`
+	Name            string           `json:"name,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	Category        ReportCategory   `json:"category,omitempty"`
+	Config          *ReportConfig    `json:"config,omitempty"`
+	Visibility      ReportVisibility `json:"visibility,omitempty"`
+	CacheTTLSeconds *int             `json:"cache_ttl_seconds,omitempty" binding:"omitempty,min=0"`
 }
 
 // ExecuteReportRequest represents the request to execute a report
 type ExecuteReportRequest struct {
-	Format     ExportFormat   `json:"format,omitempty"`
-	Parameters map[string]any `json:"parameters,omitempty"`
+	Format       ExportFormat   `json:"format,omitempty"`
+	Parameters   map[string]any `json:"parameters,omitempty"`
+	ForceRefresh bool           `json:"force_refresh,omitempty"` // skip reuse of a cached execution
+	// Shareable keeps the result rows so the execution can be shared with an
+	// execution-scoped link; they are dropped if no such link is created.
+	// Not available for the streamed parquet and ndjson formats.
+	Shareable bool `json:"shareable,omitempty"`
 }
 
 // CreateScheduleRequest represents the request to create a schedule
@@ -387,6 +485,119 @@ type BenchmarkComparisonRequest struct {
 	Year        int       `json:"year,omitempty"`
 }
 
+// ImportBenchmarkRequest represents the dataset metadata sent with a benchmark table upload
+type ImportBenchmarkRequest struct {
+	Name            string  `form:"name" binding:"required"`
+	Description     string  `form:"description"`
+	Category        string  `form:"category" binding:"required"`
+	Methodology     string  `form:"methodology"`
+	Region          string  `form:"region"`
+	Year            int     `form:"year" binding:"required"`
+	Source          string  `form:"source"`
+	ConfidenceScore float64 `form:"confidence_score"`
+}
+
+// BenchmarkImportResponse represents the result of a benchmark table import
+type BenchmarkImportResponse struct {
+	Dataset      *BenchmarkDataset        `json:"dataset,omitempty"`
+	RowsImported int                      `json:"rows_imported"`
+	Errors       []benchmarks.ImportError `json:"errors,omitempty"`
+}
+
+// PeerBenchmarkRefreshResult summarises a peer benchmark computation run
+type PeerBenchmarkRefreshResult struct {
+	Cohorts       int       `json:"cohorts"`
+	Published     int       `json:"published"`
+	Suppressed    int       `json:"suppressed"`
+	Deactivated   int       `json:"deactivated"`
+	MinCohortSize int       `json:"min_cohort_size"`
+	RefreshedAt   time.Time `json:"refreshed_at"`
+}
+
+// PeerPercentileRequest represents a request for a project's rank among its peers
+type PeerPercentileRequest struct {
+	ProjectID   string `form:"project_id" binding:"required,uuid"`
+	Metric      string `form:"metric" binding:"required"`
+	Methodology string `form:"methodology"`
+	Region      string `form:"region"`
+}
+
+// PeerPercentileResponse represents a project's percentile rank among its peers
+type PeerPercentileResponse struct {
+	ProjectID   uuid.UUID `json:"project_id"`
+	Metric      string    `json:"metric"`
+	Methodology string    `json:"methodology"`
+	Region      string    `json:"region"`
+	Percentile  float64   `json:"percentile"`
+}
+
+// UpdateSharingRequest replaces the users and roles a report is shared with
+type UpdateSharingRequest struct {
+	Visibility ReportVisibility `json:"visibility,omitempty"`
+	UserIDs    []uuid.UUID      `json:"user_ids"`
+	Roles      []string         `json:"roles"`
+}
+
+// CreateShareLinkRequest represents a request for a public link or embed token
+type CreateShareLinkRequest struct {
+	Kind           ShareLinkKind `json:"kind,omitempty"`         // link (default) or embed
+	ExecutionID    *uuid.UUID    `json:"execution_id,omitempty"` // scope the link to one execution; live data when omitted
+	ExpiresAt      *time.Time    `json:"expires_at,omitempty"`
+	Password       string        `json:"password,omitempty"`
+	AllowedOrigins []string      `json:"allowed_origins,omitempty"` // required for embed tokens
+}
+
+// CreateShareLinkResponse returns the new link with its token, which is not retrievable later
+type CreateShareLinkResponse struct {
+	Link  *ReportShareLink `json:"link"`
+	Token string           `json:"token"`
+	Path  string           `json:"path"`
+}
+
+// SharedReportView represents the read-only report data served through a share link
+type SharedReportView struct {
+	ReportID    uuid.UUID                `json:"report_id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Scope       ShareScope               `json:"scope"`
+	ExecutionID *uuid.UUID               `json:"execution_id,omitempty"`
+	Fields      []FieldConfig            `json:"fields"`
+	Data        []map[string]interface{} `json:"data"`
+	RecordCount int                      `json:"record_count"`
+	GeneratedAt time.Time                `json:"generated_at"`
+	ExpiresAt   time.Time                `json:"expires_at"`
+}
+
+// ForecastMetric identifies a project series that can be forecast
+type ForecastMetric string
+
+const (
+	ForecastCreditsIssued ForecastMetric = "credits_issued"
+	ForecastSequestration ForecastMetric = "sequestration"
+)
+
+// ForecastRequest represents a request to project a project metric forward
+type ForecastRequest struct {
+	ProjectID    string                   `form:"project_id" json:"project_id" binding:"required,uuid"`
+	Metric       ForecastMetric           `form:"metric" json:"metric" binding:"required"`
+	Model        benchmarks.ForecastModel `form:"model" json:"model,omitempty"`                 // linear, holt_winters
+	Interval     string                   `form:"interval" json:"interval,omitempty"`           // week, month, quarter, year
+	Horizon      int                      `form:"horizon" json:"horizon,omitempty"`             // periods to project
+	SeasonLength int                      `form:"season_length" json:"season_length,omitempty"` // defaults from interval
+	Confidence   float64                  `form:"confidence" json:"confidence,omitempty"`
+}
+
+// ForecastResponse represents a project's metric history and its projection
+type ForecastResponse struct {
+	ProjectID   uuid.UUID                  `json:"project_id"`
+	Metric      ForecastMetric             `json:"metric"`
+	Unit        string                     `json:"unit"`
+	Interval    string                     `json:"interval"`
+	History     []benchmarks.DataPoint     `json:"history"`
+	Forecast    *benchmarks.ForecastResult `json:"forecast"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+}
+
 // BenchmarkComparisonResponse represents the benchmark comparison result
 type BenchmarkComparisonResponse struct {
 	ProjectID      uuid.UUID           `json:"project_id"`
@@ -489,3 +700,70 @@ type ListExecutionsResponse struct {
 	PageSize   int               `json:"page_size"`
 	TotalPages int               `json:"total_pages"`
 }
+
+// WidgetDataRequest represents per-request options for resolving widget data
+type WidgetDataRequest struct {
+	Page     int
+	PageSize int
+}
+
+// WidgetDataResponse represents the resolved data for a dashboard widget.
+// Exactly one of Chart, Metric, Gauge or Table is set, depending on WidgetType.
+type WidgetDataResponse struct {
+	WidgetID    uuid.UUID         `json:"widget_id"`
+	WidgetType  WidgetType        `json:"widget_type"`
+	Title       string            `json:"title"`
+	Chart       *ChartWidgetData  `json:"chart,omitempty"`
+	Metric      *MetricWidgetData `json:"metric,omitempty"`
+	Gauge       *GaugeWidgetData  `json:"gauge,omitempty"`
+	Table       *TableWidgetData  `json:"table,omitempty"`
+	GeneratedAt time.Time         `json:"generated_at"`
+}
+
+// ChartWidgetData represents chart-ready series keyed by x-axis categories
+type ChartWidgetData struct {
+	ChartType  string        `json:"chart_type"`
+	XAxis      string        `json:"x_axis"`
+	Categories []string      `json:"categories"`
+	Series     []ChartSeries `json:"series"`
+	Stacked    bool          `json:"stacked,omitempty"`
+}
+
+// ChartSeries represents a single plotted series
+type ChartSeries struct {
+	Name   string    `json:"name"`
+	Data   []float64 `json:"data"`
+	Offset int       `json:"offset,omitempty"` // index of the category the first value belongs to
+}
+
+// MetricWidgetData represents a single metric value with its trend
+type MetricWidgetData struct {
+	Value         float64 `json:"value"`
+	PreviousValue float64 `json:"previous_value"`
+	Change        float64 `json:"change"`
+	ChangePercent float64 `json:"change_percent"`
+	Trend         string  `json:"trend"` // up, down, stable
+	Period        string  `json:"period"`
+	DisplayFormat string  `json:"display_format,omitempty"`
+	Prefix        string  `json:"prefix,omitempty"`
+	Suffix        string  `json:"suffix,omitempty"`
+}
+
+// GaugeWidgetData represents a gauge value and the threshold band it falls in
+type GaugeWidgetData struct {
+	Value    float64         `json:"value"`
+	MinValue float64         `json:"min_value"`
+	MaxValue float64         `json:"max_value"`
+	Percent  float64         `json:"percent"`
+	Band     *GaugeThreshold `json:"band,omitempty"`
+}
+
+// TableWidgetData represents a page of table rows
+type TableWidgetData struct {
+	Columns    []FieldConfig            `json:"columns"`
+	Rows       []map[string]interface{} `json:"rows"`
+	Total      int64                    `json:"total"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"page_size"`
+	TotalPages int                      `json:"total_pages"`
+}
@@ -0,0 +1,227 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	// PeerBenchmarkCategory is the category of benchmark datasets derived from portal projects
+	PeerBenchmarkCategory = "portal_peers"
+	// PeerBenchmarkSource is recorded as the source of peer-derived datasets
+	PeerBenchmarkSource = "CarbonScribe portal projects"
+)
+
+// ========== Peer Benchmarks ==========
+
+// RefreshPeerBenchmarks recomputes benchmark datasets from the portal's own
+// projects, grouped by methodology, region and year. Cohorts below the
+// configured anonymity threshold are not published, and any dataset
+// previously published for them is deactivated.
+func (s *service) RefreshPeerBenchmarks(ctx context.Context) (*PeerBenchmarkRefreshResult, error) {
+	projects, err := s.repo.ListProjectPeerMetrics(ctx, PeerMetricsFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project metrics: %w", err)
+	}
+
+	existing, err := s.repo.ListBenchmarkDatasets(ctx, BenchmarkFilter{Category: PeerBenchmarkCategory})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load peer benchmarks: %w", err)
+	}
+
+	published := make(map[benchmarks.PeerCohort]*BenchmarkDataset, len(existing))
+	for i := range existing {
+		cohort := benchmarks.PeerCohort{Methodology: existing[i].Methodology, Region: existing[i].Region, Year: existing[i].Year}
+		published[cohort] = &existing[i]
+	}
+
+	result := &PeerBenchmarkRefreshResult{
+		MinCohortSize: s.config.PeerMinCohortSize,
+		RefreshedAt:   time.Now(),
+	}
+
+	for _, peer := range benchmarks.BuildPeerBenchmarks(projects, s.config.PeerMinCohortSize) {
+		result.Cohorts++
+		dataset, exists := published[peer.Cohort]
+		delete(published, peer.Cohort)
+
+		if peer.Suppressed || len(peer.Metrics) == 0 {
+			result.Suppressed++
+			if exists && dataset.IsActive {
+				dataset.IsActive = false
+				if err := s.repo.UpdateBenchmarkDataset(ctx, dataset); err != nil {
+					return nil, fmt.Errorf("failed to deactivate peer benchmark: %w", err)
+				}
+				result.Deactivated++
+			}
+			continue
+		}
+
+		data, err := json.Marshal(peer.Metrics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize peer benchmark: %w", err)
+		}
+
+		if !exists {
+			dataset = &BenchmarkDataset{
+				ID:          uuid.New(),
+				Category:    PeerBenchmarkCategory,
+				Methodology: peer.Cohort.Methodology,
+				Region:      peer.Cohort.Region,
+				Year:        peer.Cohort.Year,
+				Source:      PeerBenchmarkSource,
+			}
+		}
+		dataset.Name = fmt.Sprintf("Peer benchmark: %s, %s, %d", peer.Cohort.Methodology, peer.Cohort.Region, peer.Cohort.Year)
+		dataset.Description = fmt.Sprintf("Computed from %d portal projects", peer.Size)
+		dataset.Data = datatypes.JSON(data)
+		dataset.IsActive = true
+
+		if exists {
+			err = s.repo.UpdateBenchmarkDataset(ctx, dataset)
+		} else {
+			err = s.repo.CreateBenchmarkDataset(ctx, dataset)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save peer benchmark: %w", err)
+		}
+		result.Published++
+	}
+
+	// Cohorts that no longer have any projects
+	for _, dataset := range published {
+		if !dataset.IsActive {
+			continue
+		}
+		dataset.IsActive = false
+		if err := s.repo.UpdateBenchmarkDataset(ctx, dataset); err != nil {
+			return nil, fmt.Errorf("failed to deactivate peer benchmark: %w", err)
+		}
+		result.Deactivated++
+	}
+
+	return result, nil
+}
+
+// GetPeerPercentile ranks a project the user owns or is a member of against
+// its peers. When methodology or region are omitted, the project's own values
+// are used.
+func (s *service) GetPeerPercentile(ctx context.Context, userID uuid.UUID, req PeerPercentileRequest) (*PeerPercentileResponse, error) {
+	projectID, err := uuid.Parse(req.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project ID")
+	}
+	if userID == uuid.Nil {
+		return nil, ErrProjectNotFound
+	}
+	member, err := s.repo.IsProjectMember(ctx, projectID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check project membership: %w", err)
+	}
+	if !member {
+		return nil, ErrProjectNotFound
+	}
+
+	if req.Methodology == "" || req.Region == "" {
+		projects, err := s.repo.ListProjectPeerMetrics(ctx, PeerMetricsFilter{ProjectID: &projectID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load project metrics: %w", err)
+		}
+		if len(projects) == 0 {
+			return nil, ErrProjectNotFound
+		}
+		if req.Methodology == "" {
+			req.Methodology = projects[0].Methodology
+		}
+		if req.Region == "" {
+			req.Region = projects[0].Region
+		}
+	}
+
+	percentile, err := s.comparator.CalculatePercentileFromPeers(ctx, projectID, req.Metric, req.Methodology, req.Region)
+	if err != nil {
+		if errors.Is(err, benchmarks.ErrCohortTooSmall) {
+			return nil, fmt.Errorf("%w (minimum %d projects)", err, s.config.PeerMinCohortSize)
+		}
+		return nil, err
+	}
+
+	return &PeerPercentileResponse{
+		ProjectID:   projectID,
+		Metric:      req.Metric,
+		Methodology: req.Methodology,
+		Region:      req.Region,
+		Percentile:  percentile,
+	}, nil
+}
+
+// benchmarkAdapter exposes the reports repository to the benchmarks package
+type benchmarkAdapter struct {
+	repo Repository
+}
+
+func (a *benchmarkAdapter) GetBenchmarkByCategory(ctx context.Context, category, methodology, region string, year int) (*benchmarks.BenchmarkDataset, error) {
+	dataset, err := a.repo.GetBenchmarkByCategory(ctx, category, methodology, region, year)
+	if err != nil {
+		return nil, err
+	}
+	converted := toComparatorDataset(*dataset)
+	return &converted, nil
+}
+
+func (a *benchmarkAdapter) ListBenchmarks(ctx context.Context, filter benchmarks.BenchmarkFilter) ([]benchmarks.BenchmarkDataset, error) {
+	datasets, err := a.repo.ListBenchmarkDatasets(ctx, BenchmarkFilter{
+		Category:    filter.Category,
+		Methodology: filter.Methodology,
+		Region:      filter.Region,
+		Year:        filter.Year,
+		IsActive:    filter.IsActive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	converted := make([]benchmarks.BenchmarkDataset, len(datasets))
+	for i, d := range datasets {
+		converted[i] = toComparatorDataset(d)
+	}
+	return converted, nil
+}
+
+func (a *benchmarkAdapter) GetProjectMetrics(ctx context.Context, projectID uuid.UUID) (map[string]float64, error) {
+	projects, err := a.repo.ListProjectPeerMetrics(ctx, PeerMetricsFilter{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("project not found")
+	}
+	return projects[0].Metrics, nil
+}
+
+func (a *benchmarkAdapter) GetProjectsInPeerGroup(ctx context.Context, methodology, region string) ([]benchmarks.ProjectMetrics, error) {
+	return a.repo.ListProjectPeerMetrics(ctx, PeerMetricsFilter{Methodology: methodology, Region: region})
+}
+
+func toComparatorDataset(d BenchmarkDataset) benchmarks.BenchmarkDataset {
+	return benchmarks.BenchmarkDataset{
+		ID:              d.ID,
+		Name:            d.Name,
+		Description:     d.Description,
+		Category:        d.Category,
+		Methodology:     d.Methodology,
+		Region:          d.Region,
+		Data:            json.RawMessage(d.Data),
+		Year:            d.Year,
+		Source:          d.Source,
+		ConfidenceScore: d.ConfidenceScore,
+		IsActive:        d.IsActive,
+	}
+}
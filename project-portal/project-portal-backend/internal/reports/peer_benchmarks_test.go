@@ -0,0 +1,78 @@
+package reports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// peerRepo serves one peer group and the members of each project in it
+type peerRepo struct {
+	Repository
+
+	projects []benchmarks.ProjectMetrics
+	members  map[uuid.UUID]uuid.UUID
+}
+
+func (r *peerRepo) ListProjectPeerMetrics(_ context.Context, filter PeerMetricsFilter) ([]benchmarks.ProjectMetrics, error) {
+	if filter.ProjectID == nil {
+		return r.projects, nil
+	}
+	for _, project := range r.projects {
+		if project.ProjectID == *filter.ProjectID {
+			return []benchmarks.ProjectMetrics{project}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *peerRepo) IsProjectMember(_ context.Context, projectID, userID uuid.UUID) (bool, error) {
+	return r.members[projectID] == userID, nil
+}
+
+func TestPeerBenchmarksNeedProjectMembership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &peerRepo{members: make(map[uuid.UUID]uuid.UUID)}
+	for i := 0; i < benchmarks.DefaultMinCohortSize; i++ {
+		id := uuid.New()
+		repo.projects = append(repo.projects, benchmarks.ProjectMetrics{
+			ProjectID: id, Methodology: "ARR", Region: "Kenya",
+			Metrics: map[string]float64{"area_hectares": float64(100 * (i + 1))},
+		})
+		repo.members[id] = uuid.New()
+	}
+	router := gin.New()
+	NewHandler(NewService(repo, nil)).RegisterRoutes(router.Group("/api/v1"))
+	call := func(method, path string, userID uuid.UUID, permissions string) int {
+		req := httptest.NewRequest(method, "/api/v1/reports/benchmarks/peers"+path, nil)
+		req.Header.Set("X-User-ID", userID.String())
+		if permissions != "" {
+			req.Header.Set("X-Permissions", permissions)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	project := repo.projects[0].ProjectID
+	percentile := "/percentile?metric=area_hectares&project_id=" + project.String()
+	if code := call(http.MethodGet, percentile, repo.members[project], ""); code != http.StatusOK {
+		t.Fatalf("expected a member to see their project's percentile, got %d", code)
+	}
+	if code := call(http.MethodGet, percentile, repo.members[repo.projects[1].ProjectID], ""); code != http.StatusNotFound {
+		t.Fatalf("expected another project's member refused, got %d", code)
+	}
+	if code := call(http.MethodGet, percentile, uuid.Nil, ""); code != http.StatusNotFound {
+		t.Fatalf("expected an anonymous caller refused, got %d", code)
+	}
+
+	if code := call(http.MethodPost, "/refresh", repo.members[project], "reports:read"); code != http.StatusForbidden {
+		t.Fatalf("expected a refresh without admin permissions refused, got %d", code)
+	}
+}
@@ -0,0 +1,33 @@
+package reports
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the reports module keeps a user's data
+// for privacy requests: their report definitions with everything hanging off
+// them, and their dashboard. store removes streamed export files.
+func NewPrivacyProvider(db *gorm.DB, store requests.ObjectStore) requests.Provider {
+	const ownReports = "report_definition_id IN (SELECT id FROM report_definitions WHERE created_by = @user)"
+	return requests.NewTableProvider("reports", db, store,
+		requests.Table{Name: "report_share_links", Category: requests.CategoryProjectData,
+			Where: ownReports + " OR created_by = @user", Exclude: []string{"token_hash", "password_hash"}},
+		requests.Table{Name: "report_executions", Category: requests.CategoryProjectData,
+			Where: ownReports + " OR triggered_by = @user", Exclude: []string{"result_snapshot"}, ObjectKeys: "file_key"},
+		requests.Table{Name: "report_schedules", Category: requests.CategoryProjectData, Where: ownReports},
+		requests.Table{Name: "report_definitions", Category: requests.CategoryProjectData, Where: "created_by = @user"},
+		requests.Table{Name: "dashboard_widgets", Category: requests.CategoryUserProfile, Where: "user_id = @user"},
+	)
+}
+
+// RetentionTargets lists the reports data that ages out under retention
+// policies: finished executions and their generated files.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategoryProjectData, Table: "report_executions", TimestampColumn: "created_at", UserColumn: "triggered_by",
+			ObjectKeyColumn: "file_key", Where: "status IN ('completed', 'failed')"},
+	}
+}
@@ -2,10 +2,14 @@ package reports
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/datatypes"
@@ -37,6 +41,10 @@ type Repository interface {
 	UpdateExecution(ctx context.Context, execution *ReportExecution) error
 	ListExecutions(ctx context.Context, filter ExecutionFilter) ([]ReportExecution, int64, error)
 	GetPendingExecutions(ctx context.Context) ([]ReportExecution, error)
+	FindExecutionByFingerprint(ctx context.Context, fingerprint string, statuses []ExecutionStatus, since time.Time) (*ReportExecution, error)
+	IncrementExecutionCacheHits(ctx context.Context, id uuid.UUID) error
+	ExpireStaleExecutions(ctx context.Context, fingerprint string, before time.Time) error
+	GetDatasetWatermark(ctx context.Context, dataset string) (string, error)
 
 	// Benchmark Datasets
 	CreateBenchmarkDataset(ctx context.Context, dataset *BenchmarkDataset) error
@@ -46,6 +54,11 @@ type Repository interface {
 	ListBenchmarkDatasets(ctx context.Context, filter BenchmarkFilter) ([]BenchmarkDataset, error)
 	GetBenchmarkByCategory(ctx context.Context, category, methodology, region string, year int) (*BenchmarkDataset, error)
 
+	// Peer Metrics
+	ListProjectPeerMetrics(ctx context.Context, filter PeerMetricsFilter) ([]benchmarks.ProjectMetrics, error)
+	IsProjectMember(ctx context.Context, projectID, userID uuid.UUID) (bool, error)
+	GetProjectMetricHistory(ctx context.Context, projectID uuid.UUID, metric ForecastMetric, interval string) ([]TimeSeriesPoint, error)
+
 	// Dashboard Widgets
 	CreateWidget(ctx context.Context, widget *DashboardWidget) error
 	GetWidget(ctx context.Context, id uuid.UUID) (*DashboardWidget, error)
@@ -61,11 +74,30 @@ type Repository interface {
 
 	// Dynamic Query Execution
 	ExecuteDynamicQuery(ctx context.Context, config ReportConfig) ([]map[string]interface{}, int64, error)
+	StreamDynamicQuery(ctx context.Context, config ReportConfig, fn func(row map[string]interface{}) error) (int64, error)
+
+	// Sharing
+	GetUserRole(ctx context.Context, userID uuid.UUID) (string, error)
+	CreateShareLink(ctx context.Context, link *ReportShareLink) error
+	GetShareLink(ctx context.Context, id uuid.UUID) (*ReportShareLink, error)
+	GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*ReportShareLink, error)
+	ListShareLinks(ctx context.Context, reportID uuid.UUID) ([]ReportShareLink, error)
+	UpdateShareLink(ctx context.Context, link *ReportShareLink) error
+	RecordShareLinkAccess(ctx context.Context, id uuid.UUID, at time.Time) error
+	ClearUnsharedSnapshots(ctx context.Context, completedBefore, now time.Time) (int64, error)
+
+	// Usage metering
+	CountExecutionsByUser(ctx context.Context, userID uuid.UUID, from, to time.Time) (int64, error)
+	CountActiveSchedulesByOwner(ctx context.Context, userID uuid.UUID) (int64, error)
+
+	// Account exports
+	ListReportDefinitionsByOwner(ctx context.Context, userID uuid.UUID) ([]ReportDefinition, error)
 }
 
 // ReportFilter defines filtering options for reports
 type ReportFilter struct {
 	UserID     *uuid.UUID
+	UserRole   string // role of UserID, for reports shared by role
 	Category   ReportCategory
 	Visibility ReportVisibility
 	IsTemplate *bool
@@ -104,6 +136,13 @@ type BenchmarkFilter struct {
 	IsActive    *bool
 }
 
+// PeerMetricsFilter defines filtering options for project peer metrics
+type PeerMetricsFilter struct {
+	ProjectID   *uuid.UUID
+	Methodology string
+	Region      string
+}
+
 // repository implements the Repository interface
 type repository struct {
 	db *gorm.DB
@@ -145,8 +184,8 @@ func (r *repository) ListReportDefinitions(ctx context.Context, filter ReportFil
 
 	// Apply filters
 	if filter.UserID != nil {
-		query = query.Where("created_by = ? OR visibility = 'public' OR ? = ANY(shared_with_users)",
-			filter.UserID, filter.UserID)
+		query = query.Where("created_by = ? OR visibility = 'public' OR (visibility = 'shared' AND (? = ANY(shared_with_users) OR ? = ANY(shared_with_roles)))",
+			filter.UserID, filter.UserID, filter.UserRole)
 	}
 	if filter.Category != "" {
 		query = query.Where("category = ?", filter.Category)
@@ -294,6 +333,65 @@ func (r *repository) UpdateExecution(ctx context.Context, execution *ReportExecu
 	return r.db.WithContext(ctx).Save(execution).Error
 }
 
+// FindExecutionByFingerprint returns the most recent execution with the given
+// fingerprint and status triggered at or after since, or nil if there is none
+func (r *repository) FindExecutionByFingerprint(ctx context.Context, fingerprint string, statuses []ExecutionStatus, since time.Time) (*ReportExecution, error) {
+	var executions []ReportExecution
+	err := r.db.WithContext(ctx).
+		Where("fingerprint = ? AND status IN ? AND triggered_at >= ?", fingerprint, statuses, since).
+		Order("triggered_at DESC").
+		Limit(1).
+		Find(&executions).Error
+	if err != nil || len(executions) == 0 {
+		return nil, err
+	}
+	return &executions[0], nil
+}
+
+func (r *repository) IncrementExecutionCacheHits(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&ReportExecution{}).
+		Where("id = ?", id).
+		UpdateColumn("cache_hits", gorm.Expr("cache_hits + 1")).Error
+}
+
+// ExpireStaleExecutions fails executions with the fingerprint that have been
+// pending or processing since before the cutoff, e.g. after a crash
+func (r *repository) ExpireStaleExecutions(ctx context.Context, fingerprint string, before time.Time) error {
+	return r.db.WithContext(ctx).Model(&ReportExecution{}).
+		Where("fingerprint = ? AND status IN ? AND triggered_at < ?", fingerprint, []ExecutionStatus{StatusPending, StatusProcessing}, before).
+		Updates(map[string]interface{}{
+			"status":        StatusFailed,
+			"error_message": "abandoned: execution did not finish",
+			"completed_at":  time.Now(),
+		}).Error
+}
+
+// GetDatasetWatermark returns a value that changes whenever rows in the
+// dataset's table are inserted, updated or deleted. It uses the Postgres
+// statistics counters, so it is cheap but may lag commits by a moment. An
+// empty watermark means the table is not tracked.
+func (r *repository) GetDatasetWatermark(ctx context.Context, dataset string) (string, error) {
+	schema, table := "public", dataset
+	if i := strings.LastIndex(dataset, "."); i >= 0 {
+		schema, table = dataset[:i], dataset[i+1:]
+	}
+
+	var stats []struct {
+		Inserted int64
+		Updated  int64
+		Deleted  int64
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT n_tup_ins AS inserted, n_tup_upd AS updated, n_tup_del AS deleted
+		FROM pg_stat_user_tables
+		WHERE schemaname = ? AND relname = ?`, schema, table).Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return "", err
+	}
+	st := stats[0]
+	return fmt.Sprintf("%d:%d:%d", st.Inserted, st.Updated, st.Deleted), nil
+}
+
 func (r *repository) ListExecutions(ctx context.Context, filter ExecutionFilter) ([]ReportExecution, int64, error) {
 	var executions []ReportExecution
 	var total int64
@@ -352,6 +450,37 @@ func (r *repository) GetPendingExecutions(ctx context.Context) ([]ReportExecutio
 	return executions, nil
 }
 
+// CountExecutionsByUser counts executions a user triggered in [from, to)
+// that did not fail. Results served from the execution cache are not new
+// executions and are not counted.
+func (r *repository) CountExecutionsByUser(ctx context.Context, userID uuid.UUID, from, to time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&ReportExecution{}).
+		Where("triggered_by = ? AND triggered_at >= ? AND triggered_at < ?", userID, from, to).
+		Where("status <> ?", StatusFailed).
+		Count(&count).Error
+	return count, err
+}
+
+// CountActiveSchedulesByOwner counts active schedules of reports the user
+// created
+func (r *repository) CountActiveSchedulesByOwner(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&ReportSchedule{}).
+		Joins("JOIN report_definitions ON report_definitions.id = report_schedules.report_definition_id").
+		Where("report_definitions.created_by = ? AND report_schedules.is_active = ?", userID, true).
+		Count(&count).Error
+	return count, err
+}
+
+// ListReportDefinitionsByOwner returns the reports a user created,
+// including templates
+func (r *repository) ListReportDefinitionsByOwner(ctx context.Context, userID uuid.UUID) ([]ReportDefinition, error) {
+	var reports []ReportDefinition
+	err := r.db.WithContext(ctx).Where("created_by = ?", userID).Order("created_at").Find(&reports).Error
+	return reports, err
+}
+
 // ========== Benchmark Datasets ==========
 
 func (r *repository) CreateBenchmarkDataset(ctx context.Context, dataset *BenchmarkDataset) error {
@@ -426,6 +555,185 @@ func (r *repository) GetBenchmarkByCategory(ctx context.Context, category, metho
 	return &dataset, nil
 }
 
+// ========== Peer Metrics ==========
+
+// ListProjectPeerMetrics derives comparable metrics for portal projects. The
+// project type is used as the methodology and the location as the region.
+func (r *repository) ListProjectPeerMetrics(ctx context.Context, filter PeerMetricsFilter) ([]benchmarks.ProjectMetrics, error) {
+	var rows []struct {
+		ID            uuid.UUID
+		Type          string
+		Location      string
+		Year          int
+		Area          float64
+		CarbonCredits float64
+	}
+
+	query := r.db.WithContext(ctx).Table("projects").
+		Select("id, type, location, CAST(EXTRACT(YEAR FROM COALESCE(start_date, created_at)) AS INTEGER) AS year, area, carbon_credits")
+
+	if filter.ProjectID != nil {
+		query = query.Where("id = ?", *filter.ProjectID)
+	}
+	if filter.Methodology != "" {
+		query = query.Where("type = ?", filter.Methodology)
+	}
+	if filter.Region != "" {
+		query = query.Where("location = ?", filter.Region)
+	}
+
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]benchmarks.ProjectMetrics, 0, len(rows))
+	for _, row := range rows {
+		metrics := map[string]float64{
+			"total_credits_issued": row.CarbonCredits,
+			"area_hectares":        row.Area,
+		}
+		if row.Area > 0 {
+			metrics["credits_per_hectare"] = row.CarbonCredits / row.Area
+		}
+		results = append(results, benchmarks.ProjectMetrics{
+			ProjectID:   row.ID,
+			Metrics:     metrics,
+			Methodology: row.Type,
+			Region:      row.Location,
+			Year:        row.Year,
+		})
+	}
+
+	return results, nil
+}
+
+// GetProjectMetricHistory returns a project's metric totals per interval
+// bucket, oldest first. Buckets without data are omitted.
+func (r *repository) GetProjectMetricHistory(ctx context.Context, projectID uuid.UUID, metric ForecastMetric, interval string) ([]TimeSeriesPoint, error) {
+	var table, field, timeField, condition string
+	switch metric {
+	case ForecastCreditsIssued:
+		table = "carbon_credits"
+		field = "quantity"
+		timeField = "issued_at"
+		condition = "status <> 'pending'"
+	case ForecastSequestration:
+		table = "monitoring_data"
+		field = "value"
+		timeField = "recorded_at"
+		condition = "metric_type = 'carbon_sequestration'"
+	default:
+		return nil, fmt.Errorf("unknown forecast metric: %s", metric)
+	}
+
+	switch interval {
+	case "week", "month", "quarter", "year":
+	default:
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			date_trunc('%s', %s) AS time_bucket,
+			COALESCE(SUM(%s), 0) AS value
+		FROM %s
+		WHERE project_id = ? AND %s IS NOT NULL AND %s
+		GROUP BY time_bucket
+		ORDER BY time_bucket ASC
+	`, interval, timeField, field, table, timeField, condition)
+
+	rows, err := r.db.WithContext(ctx).Raw(query, projectID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []TimeSeriesPoint
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(&point.Time, &point.Value); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+// IsProjectMember reports whether a user owns or is a member of a project
+func (r *repository) IsProjectMember(ctx context.Context, projectID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Table("project_members").
+		Where("project_id = ? AND user_id = ? AND deleted_at IS NULL", projectID.String(), userID.String()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ========== Sharing ==========
+
+func (r *repository) GetUserRole(ctx context.Context, userID uuid.UUID) (string, error) {
+	var role string
+	err := r.db.WithContext(ctx).Table("users").
+		Select("role").
+		Where("id = ?", userID).
+		Limit(1).
+		Scan(&role).Error
+	return role, err
+}
+
+func (r *repository) CreateShareLink(ctx context.Context, link *ReportShareLink) error {
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+func (r *repository) GetShareLink(ctx context.Context, id uuid.UUID) (*ReportShareLink, error) {
+	var link ReportShareLink
+	if err := r.db.WithContext(ctx).First(&link, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *repository) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (*ReportShareLink, error) {
+	var link ReportShareLink
+	if err := r.db.WithContext(ctx).First(&link, "token_hash = ?", tokenHash).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *repository) ListShareLinks(ctx context.Context, reportID uuid.UUID) ([]ReportShareLink, error) {
+	var links []ReportShareLink
+	err := r.db.WithContext(ctx).
+		Where("report_definition_id = ?", reportID).
+		Order("created_at DESC").
+		Find(&links).Error
+	return links, err
+}
+
+func (r *repository) UpdateShareLink(ctx context.Context, link *ReportShareLink) error {
+	return r.db.WithContext(ctx).Save(link).Error
+}
+
+func (r *repository) RecordShareLinkAccess(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&ReportShareLink{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"access_count":     gorm.Expr("access_count + 1"),
+			"last_accessed_at": at,
+		}).Error
+}
+
+// ClearUnsharedSnapshots drops the result rows of executions completed before
+// completedBefore that no unrevoked, unexpired execution-scoped link refers to
+func (r *repository) ClearUnsharedSnapshots(ctx context.Context, completedBefore, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&ReportExecution{}).
+		Where("result_snapshot IS NOT NULL AND completed_at < ?", completedBefore).
+		Where(`NOT EXISTS (SELECT 1 FROM report_share_links l
+			WHERE l.execution_id = report_executions.id AND l.revoked_at IS NULL AND l.expires_at > ?)`, now).
+		Update("result_snapshot", nil)
+	return result.RowsAffected, result.Error
+}
+
 // ========== Dashboard Widgets ==========
 
 func (r *repository) CreateWidget(ctx context.Context, widget *DashboardWidget) error {
@@ -630,22 +938,10 @@ func (r *repository) ExecuteDynamicQuery(ctx context.Context, config ReportConfi
 	var results []map[string]interface{}
 
 	for rows.Next() {
-		// Create a slice of interface{} to hold each column value
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if err := rows.Scan(valuePtrs...); err != nil {
+		row, err := scanDynamicRow(rows, columns)
+		if err != nil {
 			return nil, 0, err
 		}
-
-		// Create a map for this row
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			row[col] = values[i]
-		}
 		results = append(results, row)
 	}
 
@@ -657,6 +953,61 @@ func (r *repository) ExecuteDynamicQuery(ctx context.Context, config ReportConfi
 	return results, total, nil
 }
 
+// StreamDynamicQuery runs the same query as ExecuteDynamicQuery but hands
+// each row to fn as it is read instead of collecting the result. It returns
+// the number of rows streamed.
+func (r *repository) StreamDynamicQuery(ctx context.Context, config ReportConfig, fn func(row map[string]interface{}) error) (int64, error) {
+	query, args, err := buildDynamicQuery(config)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := r.db.WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for rows.Next() {
+		row, err := scanDynamicRow(rows, columns)
+		if err != nil {
+			return count, err
+		}
+		if err := fn(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+// scanDynamicRow reads the current row into a map keyed by column name
+func scanDynamicRow(rows *sql.Rows, columns []string) (map[string]interface{}, error) {
+	// Create a slice of interface{} to hold each column value
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		row[col] = values[i]
+	}
+	return row, nil
+}
+
 // buildDynamicQuery constructs a SQL query from ReportConfig
 func buildDynamicQuery(config ReportConfig) (string, []interface{}, error) {
 	var args []interface{}
@@ -731,6 +1082,10 @@ func buildDynamicQuery(config ReportConfig) (string, []interface{}, error) {
 		query += fmt.Sprintf(" LIMIT %d", config.Limit)
 	}
 
+	if config.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", config.Offset)
+	}
+
 	return query, args, nil
 }
 
@@ -753,6 +1108,20 @@ func buildCountQuery(config ReportConfig) (string, []interface{}, error) {
 		query += fmt.Sprintf(" WHERE %s", stringJoin(whereConditions, " AND "))
 	}
 
+	// Grouped reports return one row per group, so count the groups instead
+	if len(config.Groupings) > 0 {
+		groupByFields := make([]string, 0, len(config.Groupings))
+		for _, group := range config.Groupings {
+			if group.TimeGrain != "" {
+				groupByFields = append(groupByFields, fmt.Sprintf("date_trunc('%s', %s)", group.TimeGrain, group.Field))
+			} else {
+				groupByFields = append(groupByFields, group.Field)
+			}
+		}
+		query = strings.Replace(query, "SELECT COUNT(*)", "SELECT 1", 1)
+		query = fmt.Sprintf("SELECT COUNT(*) FROM (%s GROUP BY %s) AS grouped", query, stringJoin(groupByFields, ", "))
+	}
+
 	return query, args, nil
 }
 
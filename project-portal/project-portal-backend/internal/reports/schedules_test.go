@@ -0,0 +1,140 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	"carbon-scribe/project-portal/project-portal-backend/internal/settings"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// scheduleRepo serves one report and keeps the schedules created for it
+type scheduleRepo struct {
+	Repository
+
+	report    *ReportDefinition
+	schedules []*ReportSchedule
+}
+
+func (r *scheduleRepo) GetReportDefinition(_ context.Context, _ uuid.UUID) (*ReportDefinition, error) {
+	return r.report, nil
+}
+
+func (r *scheduleRepo) CreateSchedule(_ context.Context, schedule *ReportSchedule) error {
+	r.schedules = append(r.schedules, schedule)
+	return nil
+}
+
+func (r *scheduleRepo) GetSchedule(_ context.Context, id uuid.UUID) (*ReportSchedule, error) {
+	for _, schedule := range r.schedules {
+		if schedule.ID == id {
+			return schedule, nil
+		}
+	}
+	return nil, errors.New("schedule not found")
+}
+
+func (r *scheduleRepo) DeleteSchedule(_ context.Context, id uuid.UUID) error {
+	for i, schedule := range r.schedules {
+		if schedule.ID == id {
+			r.schedules = append(r.schedules[:i], r.schedules[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("schedule not found")
+}
+
+// scheduleQuota allows a fixed number of schedules per user
+type scheduleQuota struct {
+	limit  int64
+	used   map[uuid.UUID]int64
+	quotas []string
+}
+
+func (q *scheduleQuota) CheckQuota(_ context.Context, userID uuid.UUID, quota string, increment int64) error {
+	q.quotas = append(q.quotas, quota)
+	if q.used[userID]+increment > q.limit {
+		return &settings.EntitlementError{Code: "plan_quota_exceeded", Quota: quota, Limit: q.limit, Used: q.used[userID]}
+	}
+	q.used[userID] += increment
+	return nil
+}
+
+func TestCreateScheduleChecksQuota(t *testing.T) {
+	repo := &scheduleRepo{report: &ReportDefinition{ID: uuid.New(), Name: "Monthly"}}
+	quota := &scheduleQuota{limit: 1, used: map[uuid.UUID]int64{}}
+	config := DefaultConfig()
+	config.Quotas = quota
+	svc := NewServiceWithConfig(repo, nil, config)
+	owner := uuid.New()
+	req := CreateScheduleRequest{
+		ReportDefinitionID: repo.report.ID,
+		Name:               "Monthly",
+		CronExpression:     "0 6 1 * *",
+		Format:             FormatCSV,
+		DeliveryMethod:     DeliveryEmail,
+	}
+
+	if _, err := svc.CreateSchedule(context.Background(), owner, req); err != nil {
+		t.Fatalf("expected the first schedule within the plan, got %v", err)
+	}
+	var entErr *settings.EntitlementError
+	if _, err := svc.CreateSchedule(context.Background(), owner, req); !errors.As(err, &entErr) {
+		t.Fatalf("expected a quota error past the plan limit, got %v", err)
+	}
+	if _, err := svc.CreateSchedule(context.Background(), uuid.Nil, req); !errors.Is(err, ErrUserRequired) {
+		t.Fatalf("expected ErrUserRequired without a user, got %v", err)
+	}
+	if len(repo.schedules) != 1 || quota.quotas[0] != settingsbilling.QuotaReportSchedules {
+		t.Fatalf("expected one schedule counted against %s, got %d %v", settingsbilling.QuotaReportSchedules, len(repo.schedules), quota.quotas)
+	}
+}
+
+func TestScheduleRoutesRecordAuditChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &scheduleRepo{report: &ReportDefinition{ID: uuid.New(), Name: "Monthly"}}
+	owner := uuid.New()
+
+	var changes []compliance.AuditChange
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		changes = append(changes, compliance.RecordedChanges(c)...)
+	})
+	NewHandler(NewService(repo, nil)).RegisterRoutes(router.Group("/api/v1"))
+	call := func(method, path, body string) int {
+		req := httptest.NewRequest(method, "/api/v1/reports/schedules"+path, strings.NewReader(body))
+		req.Header.Set("X-User-ID", owner.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	body := `{"report_definition_id":"` + repo.report.ID.String() + `","name":"Monthly","cron_expression":"0 6 1 * *","format":"csv","delivery_method":"email","delivery_config":{}}`
+	if code := call(http.MethodPost, "", body); code != http.StatusCreated {
+		t.Fatalf("expected the schedule created, got %d", code)
+	}
+	id := repo.schedules[0].ID
+	if code := call(http.MethodDelete, "/"+id.String(), ""); code != http.StatusNoContent {
+		t.Fatalf("expected the schedule deleted, got %d", code)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("expected a change per mutation, got %+v", changes)
+	}
+	created, deleted := changes[0], changes[1]
+	if created.TargetType != "report_schedule" || created.TargetID != id.String() || created.TargetOwnerID != owner.String() || created.After == nil {
+		t.Fatalf("unexpected create change %+v", created)
+	}
+	if deleted.TargetID != id.String() || deleted.Before == nil || deleted.After != nil {
+		t.Fatalf("expected the deletion to snapshot the schedule, got %+v", deleted)
+	}
+}
@@ -0,0 +1,150 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ========== Report Sections ==========
+
+// resolveSections computes the chart series and KPIs for each section of a
+// report. Section filters are applied on top of the report's own filters.
+func (s *service) resolveSections(ctx context.Context, config ReportConfig) ([]ExportSection, error) {
+	if len(config.Sections) == 0 {
+		return nil, nil
+	}
+
+	dataset, err := s.lookupDataset(ctx, config.Dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]ExportSection, 0, len(config.Sections))
+	for _, sc := range config.Sections {
+		filters := make([]FilterConfig, 0, len(config.Filters)+len(sc.Filters))
+		filters = append(filters, config.Filters...)
+		filters = append(filters, sc.Filters...)
+
+		section := ExportSection{
+			Title:       sc.Title,
+			Description: sc.Description,
+			ChartType:   sc.ChartType,
+		}
+
+		if sc.ChartType != "" {
+			chartConfig := WidgetConfig{
+				DataSource: config.Dataset,
+				Filters:    filters,
+				ChartType:  sc.ChartType,
+				XAxis:      sc.XAxis,
+				YAxis:      sc.YAxis,
+				Stacked:    sc.ChartType == SectionChartStacked,
+			}
+			if err := validateWidgetConfig(WidgetChart, chartConfig, dataset); err != nil {
+				return nil, fmt.Errorf("section %q: %w", sc.Title, err)
+			}
+			section.Chart, err = s.resolveChartWidget(ctx, chartConfig)
+			if err != nil {
+				return nil, fmt.Errorf("section %q: %w", sc.Title, err)
+			}
+		}
+
+		for _, kpi := range sc.KPIs {
+			metricConfig := WidgetConfig{
+				DataSource:      config.Dataset,
+				Filters:         filters,
+				MetricField:     kpi.Field,
+				MetricAggregate: kpi.Aggregate,
+			}
+			if err := validateWidgetConfig(WidgetMetric, metricConfig, dataset); err != nil {
+				return nil, fmt.Errorf("section %q, KPI %q: %w", sc.Title, kpi.Label, err)
+			}
+			value, err := s.queryWidgetScalar(ctx, metricConfig, filters)
+			if err != nil {
+				return nil, fmt.Errorf("section %q, KPI %q: %w", sc.Title, kpi.Label, err)
+			}
+			section.KPIs = append(section.KPIs, KPIValue{
+				Label:     kpi.Label,
+				Value:     value,
+				Formatted: formatKPIValue(kpi, value),
+			})
+		}
+
+		sections = append(sections, section)
+	}
+
+	return sections, nil
+}
+
+// validateSectionConfig checks a section's shape. Field names are checked
+// against the dataset when the section is resolved.
+func validateSectionConfig(section SectionConfig) error {
+	switch section.ChartType {
+	case "":
+		if len(section.KPIs) == 0 {
+			return fmt.Errorf("a section needs a chart or at least one KPI")
+		}
+	case SectionChartLine, SectionChartBar, SectionChartStacked:
+		if section.XAxis == "" || len(section.YAxis) == 0 {
+			return fmt.Errorf("%s charts require x_axis and y_axis", section.ChartType)
+		}
+	case SectionChartPie:
+		if section.XAxis == "" || len(section.YAxis) != 1 {
+			return fmt.Errorf("pie charts require x_axis and exactly one y_axis field")
+		}
+	default:
+		return fmt.Errorf("unsupported chart type: %s", section.ChartType)
+	}
+
+	for _, kpi := range section.KPIs {
+		if kpi.Label == "" {
+			return fmt.Errorf("every KPI needs a label")
+		}
+		switch kpi.Format {
+		case "", "number", "integer", "percent":
+		default:
+			return fmt.Errorf("unsupported KPI format: %s", kpi.Format)
+		}
+	}
+
+	return nil
+}
+
+// formatKPIValue renders a KPI for display, e.g. "$1,250.50" or "98.0%"
+func formatKPIValue(kpi KPIConfig, value float64) string {
+	var formatted string
+	switch kpi.Format {
+	case "integer":
+		formatted = formatThousands(value, 0)
+	case "percent":
+		formatted = strconv.FormatFloat(value, 'f', 1, 64) + "%"
+	default:
+		formatted = formatThousands(value, 2)
+	}
+	return kpi.Prefix + formatted + kpi.Suffix
+}
+
+// formatThousands formats a number with comma thousands separators
+func formatThousands(value float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	if value < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(fracPart)
+	return b.String()
+}
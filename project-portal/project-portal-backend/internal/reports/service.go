@@ -3,10 +3,17 @@ package reports
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/benchmarks"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/datatypes"
 )
 
@@ -40,6 +47,12 @@ type Service interface {
 	ListBenchmarks(ctx context.Context, filter BenchmarkFilter) ([]BenchmarkDataset, error)
 	CreateBenchmark(ctx context.Context, dataset *BenchmarkDataset) (*BenchmarkDataset, error)
 	UpdateBenchmark(ctx context.Context, datasetID uuid.UUID, dataset *BenchmarkDataset) (*BenchmarkDataset, error)
+	ImportBenchmark(ctx context.Context, req ImportBenchmarkRequest, filename string, r io.Reader) (*BenchmarkImportResponse, error)
+	RefreshPeerBenchmarks(ctx context.Context) (*PeerBenchmarkRefreshResult, error)
+	GetPeerPercentile(ctx context.Context, userID uuid.UUID, req PeerPercentileRequest) (*PeerPercentileResponse, error)
+
+	// Forecasting
+	GetForecast(ctx context.Context, req ForecastRequest) (*ForecastResponse, error)
 
 	// Dashboard
 	GetDashboardSummary(ctx context.Context, userID *uuid.UUID) (*DashboardSummary, error)
@@ -47,6 +60,15 @@ type Service interface {
 	GetWidgets(ctx context.Context, userID uuid.UUID, section string) ([]DashboardWidget, error)
 	SaveWidget(ctx context.Context, widget *DashboardWidget) (*DashboardWidget, error)
 	DeleteWidget(ctx context.Context, widgetID uuid.UUID) error
+	GetWidgetData(ctx context.Context, userID uuid.UUID, widgetID uuid.UUID, req WidgetDataRequest) (*WidgetDataResponse, error)
+
+	// Sharing
+	UpdateSharing(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, req UpdateSharingRequest) (*ReportDefinition, error)
+	CreateShareLink(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, req CreateShareLinkRequest) (*CreateShareLinkResponse, error)
+	ListShareLinks(ctx context.Context, userID uuid.UUID, reportID uuid.UUID) ([]ReportShareLink, error)
+	RevokeShareLink(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, linkID uuid.UUID) error
+	OpenShareLink(ctx context.Context, token string, access ShareLinkAccess) (*SharedReportView, *ReportShareLink, error)
+	PurgeShareSnapshots(ctx context.Context) (int64, error)
 
 	// Datasets
 	GetAvailableDatasets(ctx context.Context) ([]DatasetMetadata, error)
@@ -54,8 +76,49 @@ type Service interface {
 
 // service implements the Service interface
 type service struct {
-	repo     Repository
-	exporter Exporter
+	repo       Repository
+	exporter   Exporter
+	config     Config
+	comparator *benchmarks.Comparator
+	trends     *benchmarks.TrendAnalyzer
+	executions singleflight.Group
+}
+
+// Config holds reports service configuration
+type Config struct {
+	// PeerMinCohortSize is the smallest peer group for which statistics are published
+	PeerMinCohortSize int
+	// AuditLogger records access through share links; optional
+	AuditLogger AuditLogger
+	// ResultStore receives streamed Parquet and NDJSON exports; optional
+	ResultStore ResultStore
+	// DefaultCacheTTL is how long a completed execution is reused for reports
+	// without their own setting; negative disables reuse
+	DefaultCacheTTL time.Duration
+	// Quotas refuses schedules beyond the owner's plan limit; optional
+	Quotas QuotaChecker
+}
+
+// ErrUserRequired is returned when a schedule is created without a user to
+// count it against
+var ErrUserRequired = errors.New("a user is required to create a schedule")
+
+// ErrProjectNotFound is returned for projects that do not exist or that the
+// user neither owns nor is a member of
+var ErrProjectNotFound = errors.New("project not found")
+
+// QuotaChecker refuses creations that would take a user over their plan
+// limits; settings.Service implements it
+type QuotaChecker interface {
+	CheckQuota(ctx context.Context, userID uuid.UUID, quota string, increment int64) error
+}
+
+// DefaultConfig returns the default reports service configuration
+func DefaultConfig() Config {
+	return Config{
+		PeerMinCohortSize: benchmarks.DefaultMinCohortSize,
+		DefaultCacheTTL:   defaultExecutionCacheTTL,
+	}
 }
 
 // Exporter defines the interface for report export functionality
@@ -75,13 +138,46 @@ type ExportConfig struct {
 	IncludeHeader bool
 	PageSize      string // A4, Letter, etc.
 	Orientation   string // portrait, landscape
+	Sections      []ExportSection
+}
+
+// ExportSection is a report section resolved for export
+type ExportSection struct {
+	Title       string
+	Description string
+	ChartType   string
+	Chart       *ChartWidgetData
+	KPIs        []KPIValue
+}
+
+// KPIValue is a computed headline figure
+type KPIValue struct {
+	Label     string
+	Value     float64
+	Formatted string
 }
 
 // NewService creates a new reports service
 func NewService(repo Repository, exporter Exporter) Service {
+	return NewServiceWithConfig(repo, exporter, DefaultConfig())
+}
+
+// NewServiceWithConfig creates a new reports service with explicit configuration
+func NewServiceWithConfig(repo Repository, exporter Exporter, config Config) Service {
+	if config.PeerMinCohortSize <= 0 {
+		config.PeerMinCohortSize = benchmarks.DefaultMinCohortSize
+	}
+	if config.DefaultCacheTTL == 0 {
+		config.DefaultCacheTTL = defaultExecutionCacheTTL
+	}
+
+	adapter := &benchmarkAdapter{repo: repo}
 	return &service{
-		repo:     repo,
-		exporter: exporter,
+		repo:       repo,
+		exporter:   exporter,
+		config:     config,
+		comparator: benchmarks.NewComparator(adapter, adapter).WithMinCohortSize(config.PeerMinCohortSize),
+		trends:     benchmarks.NewTrendAnalyzer(adapter),
 	}
 }
 
@@ -100,15 +196,16 @@ func (s *service) CreateReport(ctx context.Context, userID uuid.UUID, req Create
 	}
 
 	report := &ReportDefinition{
-		ID:          uuid.New(),
-		Name:        req.Name,
-		Description: req.Description,
-		Category:    req.Category,
-		Config:      datatypes.JSON(configJSON),
-		CreatedBy:   &userID,
-		Visibility:  req.Visibility,
-		IsTemplate:  req.IsTemplate,
-		Version:     1,
+		ID:              uuid.New(),
+		Name:            req.Name,
+		Description:     req.Description,
+		Category:        req.Category,
+		Config:          datatypes.JSON(configJSON),
+		CreatedBy:       &userID,
+		Visibility:      req.Visibility,
+		IsTemplate:      req.IsTemplate,
+		Version:         1,
+		CacheTTLSeconds: req.CacheTTLSeconds,
 	}
 
 	if report.Visibility == "" {
@@ -129,7 +226,7 @@ func (s *service) GetReport(ctx context.Context, userID uuid.UUID, reportID uuid
 	}
 
 	// Check access permission
-	if !s.canAccessReport(report, userID) {
+	if !s.canAccessReport(ctx, report, userID) {
 		return nil, fmt.Errorf("access denied to report")
 	}
 
@@ -169,6 +266,11 @@ func (s *service) UpdateReport(ctx context.Context, userID uuid.UUID, reportID u
 			return nil, fmt.Errorf("failed to serialize config: %w", err)
 		}
 		report.Config = datatypes.JSON(configJSON)
+		// A new version invalidates cached executions of the old config
+		report.Version++
+	}
+	if req.CacheTTLSeconds != nil {
+		report.CacheTTLSeconds = req.CacheTTLSeconds
 	}
 
 	if err := s.repo.UpdateReportDefinition(ctx, report); err != nil {
@@ -193,6 +295,7 @@ func (s *service) DeleteReport(ctx context.Context, userID uuid.UUID, reportID u
 
 func (s *service) ListReports(ctx context.Context, userID uuid.UUID, filter ReportFilter) (*ListReportsResponse, error) {
 	filter.UserID = &userID
+	filter.UserRole = s.userRole(ctx, userID)
 
 	if filter.PageSize == 0 {
 		filter.PageSize = 20
@@ -227,7 +330,7 @@ func (s *service) CloneReport(ctx context.Context, userID uuid.UUID, reportID uu
 		return nil, fmt.Errorf("report not found: %w", err)
 	}
 
-	if !s.canAccessReport(original, userID) {
+	if !s.canAccessReport(ctx, original, userID) {
 		return nil, fmt.Errorf("access denied")
 	}
 
@@ -259,24 +362,91 @@ func (s *service) ExecuteReport(ctx context.Context, userID uuid.UUID, reportID
 		return nil, fmt.Errorf("report not found: %w", err)
 	}
 
-	if !s.canAccessReport(report, userID) {
+	if !s.canAccessReport(ctx, report, userID) {
 		return nil, fmt.Errorf("access denied")
 	}
 
+	if err := s.validateExportFormat(req.Format); err != nil {
+		return nil, err
+	}
+	// Streamed formats are written straight to the result store, so no rows
+	// are kept to share
+	if _, streamed := streamedFormats[req.Format]; streamed && req.Shareable {
+		return nil, fmt.Errorf("%s exports cannot be shared; use json or csv", req.Format)
+	}
+
 	// Parse report config
 	var config ReportConfig
 	if err := json.Unmarshal(report.Config, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse report config: %w", err)
 	}
 
-	// Create execution record
+	if req.Format == "" {
+		req.Format = FormatJSON // Default
+	}
+
+	fingerprint, err := s.executionFingerprint(ctx, report, config, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Identical requests arriving together share one lookup and one query.
+	// The shared work is detached from the leading request, so joined
+	// callers are not failed when it is cancelled.
+	key := fingerprint
+	if req.ForceRefresh {
+		key += ":refresh"
+	}
+	result, err, _ := s.executions.Do(key, func() (interface{}, error) {
+		startCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), executionStartTimeout)
+		defer cancel()
+		return s.startExecution(startCtx, userID, report, config, req, fingerprint)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*ReportExecution), nil
+}
+
+// startExecution reuses a fresh completed execution or joins a running one
+// with the same fingerprint, and otherwise starts a new execution.
+func (s *service) startExecution(ctx context.Context, userID uuid.UUID, report *ReportDefinition, config ReportConfig, req ExecuteReportRequest, fingerprint string) (*ReportExecution, error) {
 	now := time.Now()
+
+	if ttl := s.cacheTTL(report); ttl > 0 && !req.ForceRefresh {
+		cached, err := s.repo.FindExecutionByFingerprint(ctx, fingerprint, []ExecutionStatus{StatusCompleted}, now.Add(-ttl))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up cached execution: %w", err)
+		}
+		if cached != nil {
+			if err := s.repo.IncrementExecutionCacheHits(ctx, cached.ID); err == nil {
+				cached.CacheHits++
+			}
+			return cached, nil
+		}
+	}
+
+	inflight := []ExecutionStatus{StatusPending, StatusProcessing}
+	cutoff := now.Add(-executionInflightTimeout)
+	if err := s.repo.ExpireStaleExecutions(ctx, fingerprint, cutoff); err != nil {
+		return nil, fmt.Errorf("failed to expire stale executions: %w", err)
+	}
+	running, err := s.repo.FindExecutionByFingerprint(ctx, fingerprint, inflight, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up running execution: %w", err)
+	}
+	if running != nil {
+		return running, nil
+	}
+
+	// Create execution record
 	execution := &ReportExecution{
 		ID:                 uuid.New(),
-		ReportDefinitionID: &reportID,
+		ReportDefinitionID: &report.ID,
 		TriggeredBy:        &userID,
 		TriggeredAt:        now,
 		Status:             StatusProcessing,
+		Fingerprint:        fingerprint,
 	}
 
 	if req.Parameters != nil {
@@ -285,16 +455,27 @@ func (s *service) ExecuteReport(ctx context.Context, userID uuid.UUID, reportID
 	}
 
 	if err := s.repo.CreateExecution(ctx, execution); err != nil {
+		// Another instance may have started the same execution first
+		if running, _ := s.repo.FindExecutionByFingerprint(ctx, fingerprint, inflight, cutoff); running != nil {
+			return running, nil
+		}
 		return nil, fmt.Errorf("failed to create execution: %w", err)
 	}
 
-	// Execute the report
-	go s.processReportExecution(context.Background(), execution, config, req.Format)
+	// Execute the report on a copy, since the result is shared between callers
+	processing := *execution
+	go s.processReportExecution(context.Background(), &processing, report, config, req.Format, req.Shareable)
 
 	return execution, nil
 }
 
-func (s *service) processReportExecution(ctx context.Context, execution *ReportExecution, config ReportConfig, format ExportFormat) {
+func (s *service) processReportExecution(ctx context.Context, execution *ReportExecution, report *ReportDefinition, config ReportConfig, format ExportFormat, shareable bool) {
+	// Streamed formats read the query row by row instead of loading it
+	if format == FormatParquet || format == FormatNDJSON {
+		s.streamReportExecution(ctx, execution, config, format)
+		return
+	}
+
 	// Execute the dynamic query
 	data, recordCount, err := s.repo.ExecuteDynamicQuery(ctx, config)
 	if err != nil {
@@ -306,18 +487,25 @@ func (s *service) processReportExecution(ctx context.Context, execution *ReportE
 
 	execution.RecordCount = int(recordCount)
 
-	// Export to requested format
-	if format == "" {
-		format = FormatJSON // Default
-	}
-
 	var exportData []byte
 	exportConfig := ExportConfig{
-		Title:         "",
+		Title:         report.Name,
+		Description:   report.Description,
 		Fields:        config.Fields,
 		IncludeHeader: true,
 	}
 
+	// Chart sections are only drawn in document formats
+	if format == FormatExcel || format == FormatPDF {
+		exportConfig.Sections, err = s.resolveSections(ctx, config)
+		if err != nil {
+			execution.Status = StatusFailed
+			execution.ErrorMessage = fmt.Sprintf("failed to resolve report sections: %v", err)
+			s.repo.UpdateExecution(ctx, execution)
+			return
+		}
+	}
+
 	switch format {
 	case FormatCSV:
 		if s.exporter != nil {
@@ -348,6 +536,13 @@ func (s *service) processReportExecution(ctx context.Context, execution *ReportE
 	execution.Status = StatusCompleted
 	execution.FileSizeBytes = int64(len(exportData))
 
+	// Keep the result rows only when the execution is meant to be shared
+	if shareable && len(data) <= maxSnapshotRows {
+		if snapshot, err := json.Marshal(data); err == nil {
+			execution.ResultSnapshot = datatypes.JSON(snapshot)
+		}
+	}
+
 	// In production, you'd store the file in S3 and set FileKey/DownloadURL
 	// For now, we'll just mark it complete
 
@@ -403,6 +598,15 @@ func (s *service) CancelExecution(ctx context.Context, executionID uuid.UUID) er
 // ========== Scheduled Reports ==========
 
 func (s *service) CreateSchedule(ctx context.Context, userID uuid.UUID, req CreateScheduleRequest) (*ReportSchedule, error) {
+	if s.config.Quotas != nil {
+		if userID == uuid.Nil {
+			return nil, ErrUserRequired
+		}
+		if err := s.config.Quotas.CheckQuota(ctx, userID, settingsbilling.QuotaReportSchedules, 1); err != nil {
+			return nil, err
+		}
+	}
+
 	// Verify report exists
 	_, err := s.repo.GetReportDefinition(ctx, req.ReportDefinitionID)
 	if err != nil {
@@ -414,6 +618,10 @@ func (s *service) CreateSchedule(ctx context.Context, userID uuid.UUID, req Crea
 		return nil, fmt.Errorf("invalid cron expression: %w", err)
 	}
 
+	if err := s.validateExportFormat(req.Format); err != nil {
+		return nil, err
+	}
+
 	deliveryConfigJSON, err := json.Marshal(req.DeliveryConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize delivery config: %w", err)
@@ -461,6 +669,10 @@ func (s *service) UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, req
 		return nil, fmt.Errorf("invalid cron expression: %w", err)
 	}
 
+	if err := s.validateExportFormat(req.Format); err != nil {
+		return nil, err
+	}
+
 	deliveryConfigJSON, err := json.Marshal(req.DeliveryConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize delivery config: %w", err)
@@ -726,7 +938,7 @@ func (s *service) GetAvailableDatasets(ctx context.Context) ([]DatasetMetadata,
 
 // ========== Helper Functions ==========
 
-func (s *service) canAccessReport(report *ReportDefinition, userID uuid.UUID) bool {
+func (s *service) canAccessReport(ctx context.Context, report *ReportDefinition, userID uuid.UUID) bool {
 	// Public reports are accessible to everyone
 	if report.Visibility == VisibilityPublic {
 		return true
@@ -737,13 +949,28 @@ func (s *service) canAccessReport(report *ReportDefinition, userID uuid.UUID) bo
 		return true
 	}
 
+	// Share lists only apply while the report is shared
+	if report.Visibility != VisibilityShared {
+		return false
+	}
+
 	// Check if user is in shared list
 	for _, sharedUserID := range report.SharedWithUsers {
-		if sharedUserID == userID {
+		if sharedUserID == userID.String() {
 			return true
 		}
 	}
 
+	// Check if the user's role is in shared list
+	if len(report.SharedWithRoles) > 0 {
+		role := s.userRole(ctx, userID)
+		for _, sharedRole := range report.SharedWithRoles {
+			if role != "" && strings.EqualFold(sharedRole, role) {
+				return true
+			}
+		}
+	}
+
 	return false
 }
 
@@ -771,9 +998,29 @@ func validateReportConfig(config ReportConfig) error {
 	if len(config.Fields) == 0 {
 		return fmt.Errorf("at least one field is required")
 	}
+	for _, section := range config.Sections {
+		if err := validateSectionConfig(section); err != nil {
+			return fmt.Errorf("invalid section %q: %w", section.Title, err)
+		}
+	}
 	return nil
 }
 
+// validateExportFormat rejects unknown formats, and the streamed formats when
+// there is no result store to write them to
+func (s *service) validateExportFormat(format ExportFormat) error {
+	switch format {
+	case "", FormatCSV, FormatExcel, FormatPDF, FormatJSON:
+		return nil
+	case FormatParquet, FormatNDJSON:
+		if s.config.ResultStore == nil {
+			return fmt.Errorf("%s exports need result storage, which is not configured", format)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
 func validateCronExpression(expr string) error {
 	// Basic validation - in production, use a proper cron parser
 	if expr == "" {
@@ -0,0 +1,454 @@
+package reports
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	shareTokenPrefix        = "rsl_"
+	shareTokenBytes         = 32
+	shareTokenDisplayLength = 12
+	defaultShareLinkTTL     = 7 * 24 * time.Hour
+	maxShareLinkTTL         = 90 * 24 * time.Hour
+	minSharePasswordLength  = 8
+	maxSharedRows           = 1000
+	maxSnapshotRows         = 10000
+	// shareSnapshotGracePeriod is how long a shareable execution keeps its
+	// rows while waiting for an execution-scoped link
+	shareSnapshotGracePeriod = 24 * time.Hour
+)
+
+var (
+	// ErrShareLinkNotFound is returned for unknown, expired and revoked share links alike
+	ErrShareLinkNotFound = errors.New("share link not found or no longer valid")
+	// ErrSharePasswordRequired is returned when a protected link is opened without the right password
+	ErrSharePasswordRequired = errors.New("a valid password is required for this share link")
+)
+
+// AuditLogger records share link access in the compliance audit log
+type AuditLogger interface {
+	LogAuditEvent(ctx context.Context, entry compliance.AuditEntry) error
+}
+
+// ShareLinkAccess describes an anonymous request made through a share link
+type ShareLinkAccess struct {
+	Kind      ShareLinkKind
+	Password  string
+	ClientIP  string
+	Endpoint  string
+	UserAgent string
+}
+
+// ========== Sharing ==========
+
+// UpdateSharing replaces the users and roles a report is shared with. Only the
+// owner may change sharing.
+func (s *service) UpdateSharing(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, req UpdateSharingRequest) (*ReportDefinition, error) {
+	report, err := s.repo.GetReportDefinition(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("report not found: %w", err)
+	}
+
+	if !s.canModifyReport(report, userID) {
+		return nil, fmt.Errorf("access denied to share report")
+	}
+
+	users := make(pq.StringArray, 0, len(req.UserIDs))
+	seenUsers := make(map[uuid.UUID]bool)
+	for _, id := range req.UserIDs {
+		if id == uuid.Nil || seenUsers[id] {
+			continue
+		}
+		seenUsers[id] = true
+		users = append(users, id.String())
+	}
+
+	roles := make(pq.StringArray, 0, len(req.Roles))
+	seenRoles := make(map[string]bool)
+	for _, role := range req.Roles {
+		// Roles are matched case-insensitively, so they are stored lowercased
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role == "" || seenRoles[role] {
+			continue
+		}
+		seenRoles[role] = true
+		roles = append(roles, role)
+	}
+
+	switch req.Visibility {
+	case "":
+		if len(users) > 0 || len(roles) > 0 {
+			report.Visibility = VisibilityShared
+		} else if report.Visibility == VisibilityShared {
+			report.Visibility = VisibilityPrivate
+		}
+	case VisibilityPrivate, VisibilityShared, VisibilityPublic:
+		report.Visibility = req.Visibility
+	default:
+		return nil, fmt.Errorf("invalid visibility: %s", req.Visibility)
+	}
+
+	report.SharedWithUsers = users
+	report.SharedWithRoles = roles
+
+	if err := s.repo.UpdateReportDefinition(ctx, report); err != nil {
+		return nil, fmt.Errorf("failed to update sharing: %w", err)
+	}
+
+	return report, nil
+}
+
+// CreateShareLink issues a read-only public link or embed token for a report.
+// The token is only returned here; the database keeps its hash.
+func (s *service) CreateShareLink(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, req CreateShareLinkRequest) (*CreateShareLinkResponse, error) {
+	report, err := s.repo.GetReportDefinition(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("report not found: %w", err)
+	}
+
+	if !s.canModifyReport(report, userID) {
+		return nil, fmt.Errorf("access denied to share report")
+	}
+
+	now := time.Now()
+	link := &ReportShareLink{
+		ID:                 uuid.New(),
+		ReportDefinitionID: reportID,
+		Kind:               req.Kind,
+		Scope:              ShareScopeLive,
+		ExpiresAt:          now.Add(defaultShareLinkTTL),
+		CreatedBy:          userID,
+	}
+	if link.Kind == "" {
+		link.Kind = ShareLinkPublic
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		if req.ExpiresAt.Sub(now) > maxShareLinkTTL {
+			return nil, fmt.Errorf("share links may not be valid for more than %d days", int(maxShareLinkTTL.Hours()/24))
+		}
+		link.ExpiresAt = *req.ExpiresAt
+	}
+
+	if req.ExecutionID != nil {
+		execution, err := s.repo.GetExecution(ctx, *req.ExecutionID)
+		if err != nil {
+			return nil, fmt.Errorf("execution not found: %w", err)
+		}
+		if execution.ReportDefinitionID == nil || *execution.ReportDefinitionID != reportID {
+			return nil, fmt.Errorf("execution does not belong to this report")
+		}
+		if execution.Status != StatusCompleted || len(execution.ResultSnapshot) == 0 {
+			return nil, fmt.Errorf("only completed executions run as shareable can be shared")
+		}
+		link.Scope = ShareScopeExecution
+		link.ExecutionID = req.ExecutionID
+	}
+
+	switch link.Kind {
+	case ShareLinkPublic:
+		if len(req.AllowedOrigins) > 0 {
+			return nil, fmt.Errorf("allowed_origins only apply to embed tokens")
+		}
+		if req.Password != "" {
+			if len(req.Password) < minSharePasswordLength {
+				return nil, fmt.Errorf("password must be at least %d characters", minSharePasswordLength)
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash password: %w", err)
+			}
+			link.PasswordHash = string(hash)
+			link.PasswordProtected = true
+		}
+	case ShareLinkEmbed:
+		if req.Password != "" {
+			return nil, fmt.Errorf("embed tokens cannot be password-protected")
+		}
+		origins, err := normalizeEmbedOrigins(req.AllowedOrigins)
+		if err != nil {
+			return nil, err
+		}
+		link.AllowedOrigins = origins
+	default:
+		return nil, fmt.Errorf("invalid share link kind: %s", link.Kind)
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		return nil, err
+	}
+	link.TokenHash = hashShareToken(token)
+	link.TokenPrefix = token[:shareTokenDisplayLength]
+
+	if err := s.repo.CreateShareLink(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	path := "/api/v1/shared/reports/" + token
+	if link.Kind == ShareLinkEmbed {
+		path += "/embed"
+	}
+
+	return &CreateShareLinkResponse{Link: link, Token: token, Path: path}, nil
+}
+
+// ListShareLinks lists the share links issued for a report
+func (s *service) ListShareLinks(ctx context.Context, userID uuid.UUID, reportID uuid.UUID) ([]ReportShareLink, error) {
+	report, err := s.repo.GetReportDefinition(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("report not found: %w", err)
+	}
+
+	if !s.canModifyReport(report, userID) {
+		return nil, fmt.Errorf("access denied to report share links")
+	}
+
+	return s.repo.ListShareLinks(ctx, reportID)
+}
+
+// RevokeShareLink disables a share link immediately
+func (s *service) RevokeShareLink(ctx context.Context, userID uuid.UUID, reportID uuid.UUID, linkID uuid.UUID) error {
+	report, err := s.repo.GetReportDefinition(ctx, reportID)
+	if err != nil {
+		return fmt.Errorf("report not found: %w", err)
+	}
+
+	if !s.canModifyReport(report, userID) {
+		return fmt.Errorf("access denied to revoke share link")
+	}
+
+	link, err := s.repo.GetShareLink(ctx, linkID)
+	if err != nil || link.ReportDefinitionID != reportID {
+		return fmt.Errorf("share link not found")
+	}
+	if link.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	link.RevokedAt = &now
+	link.RevokedBy = &userID
+
+	if err := s.repo.UpdateShareLink(ctx, link); err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	return nil
+}
+
+// PurgeShareSnapshots drops the stored rows of executions that no live
+// execution-scoped link refers to, once the grace period for creating one
+// has passed
+func (s *service) PurgeShareSnapshots(ctx context.Context) (int64, error) {
+	now := time.Now()
+	return s.repo.ClearUnsharedSnapshots(ctx, now.Add(-shareSnapshotGracePeriod), now)
+}
+
+// OpenShareLink resolves a share token to read-only report data. Every
+// attempt, successful or not, is recorded in the audit log.
+func (s *service) OpenShareLink(ctx context.Context, token string, access ShareLinkAccess) (*SharedReportView, *ReportShareLink, error) {
+	link, err := s.repo.GetShareLinkByTokenHash(ctx, hashShareToken(token))
+	if err != nil {
+		return nil, nil, ErrShareLinkNotFound
+	}
+
+	now := time.Now()
+	if link.RevokedAt != nil || !now.Before(link.ExpiresAt) || link.Kind != access.Kind {
+		s.recordShareAccess(ctx, link, access, "denied", "link expired, revoked or used with the wrong kind")
+		return nil, nil, ErrShareLinkNotFound
+	}
+
+	if link.PasswordProtected {
+		if access.Password == "" || bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(access.Password)) != nil {
+			s.recordShareAccess(ctx, link, access, "denied", "missing or incorrect password")
+			return nil, nil, ErrSharePasswordRequired
+		}
+	}
+
+	report, err := s.repo.GetReportDefinition(ctx, link.ReportDefinitionID)
+	if err != nil {
+		return nil, nil, ErrShareLinkNotFound
+	}
+
+	var config ReportConfig
+	if err := json.Unmarshal(report.Config, &config); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse report config: %w", err)
+	}
+
+	view := &SharedReportView{
+		ReportID:    report.ID,
+		Name:        report.Name,
+		Description: report.Description,
+		Scope:       link.Scope,
+		ExecutionID: link.ExecutionID,
+		Fields:      visibleFields(config.Fields),
+		ExpiresAt:   link.ExpiresAt,
+	}
+
+	switch link.Scope {
+	case ShareScopeExecution:
+		execution, err := s.repo.GetExecution(ctx, *link.ExecutionID)
+		if err != nil || len(execution.ResultSnapshot) == 0 {
+			return nil, nil, ErrShareLinkNotFound
+		}
+		if err := json.Unmarshal(execution.ResultSnapshot, &view.Data); err != nil {
+			return nil, nil, fmt.Errorf("failed to read execution results: %w", err)
+		}
+		view.GeneratedAt = execution.TriggeredAt
+		if execution.CompletedAt != nil {
+			view.GeneratedAt = *execution.CompletedAt
+		}
+	default:
+		if config.Limit <= 0 || config.Limit > maxSharedRows {
+			config.Limit = maxSharedRows
+		}
+		data, _, err := s.repo.ExecuteDynamicQuery(ctx, config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to run report: %w", err)
+		}
+		view.Data = data
+		view.GeneratedAt = now
+	}
+	view.Data = stripHiddenFields(view.Data, config.Fields)
+	view.RecordCount = len(view.Data)
+
+	if err := s.repo.RecordShareLinkAccess(ctx, link.ID, now); err != nil {
+		return nil, nil, fmt.Errorf("failed to record share link access: %w", err)
+	}
+	s.recordShareAccess(ctx, link, access, "read", "")
+
+	return view, link, nil
+}
+
+// recordShareAccess writes an audit entry for a share link request. Audit
+// failures do not block the viewer.
+func (s *service) recordShareAccess(ctx context.Context, link *ReportShareLink, access ShareLinkAccess, action, reason string) {
+	if s.config.AuditLogger == nil {
+		return
+	}
+
+	ownerID := ""
+	if report, err := s.repo.GetReportDefinition(ctx, link.ReportDefinitionID); err == nil && report.CreatedBy != nil {
+		ownerID = report.CreatedBy.String()
+	}
+
+	details := map[string]any{
+		"share_link_id": link.ID.String(),
+		"kind":          string(link.Kind),
+		"scope":         string(link.Scope),
+	}
+	if link.ExecutionID != nil {
+		details["execution_id"] = link.ExecutionID.String()
+	}
+	if access.UserAgent != "" {
+		details["user_agent"] = access.UserAgent
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+
+	_ = s.config.AuditLogger.LogAuditEvent(ctx, compliance.AuditEntry{
+		EventType:        "data_access",
+		EventAction:      action,
+		ActorID:          "share_link:" + link.TokenPrefix,
+		ActorType:        compliance.ActorTypeShareLink,
+		ActorIP:          net.ParseIP(access.ClientIP),
+		TargetType:       "report",
+		TargetID:         link.ReportDefinitionID.String(),
+		TargetOwnerID:    ownerID,
+		SensitivityLevel: compliance.SensitivityNormal,
+		ServiceName:      "reports",
+		Endpoint:         access.Endpoint,
+		HTTPMethod:       "GET",
+		NewValues:        details,
+		PermissionUsed:   "share_link",
+	})
+}
+
+// userRole resolves a user's role for role-based report sharing, lowercased
+// to match the roles reports are shared with
+func (s *service) userRole(ctx context.Context, userID uuid.UUID) string {
+	role, err := s.repo.GetUserRole(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(role))
+}
+
+func normalizeEmbedOrigins(origins []string) (pq.StringArray, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("embed tokens require at least one allowed origin")
+	}
+
+	normalized := make(pq.StringArray, 0, len(origins))
+	for _, origin := range origins {
+		u, err := url.Parse(strings.TrimSpace(origin))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid embed origin %q: expected scheme://host[:port]", origin)
+		}
+		normalized = append(normalized, u.Scheme+"://"+u.Host)
+	}
+	return normalized, nil
+}
+
+func generateShareToken() (string, error) {
+	buf := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return shareTokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func visibleFields(fields []FieldConfig) []FieldConfig {
+	visible := make([]FieldConfig, 0, len(fields))
+	for _, f := range fields {
+		if !f.IsHidden {
+			visible = append(visible, f)
+		}
+	}
+	return visible
+}
+
+// stripHiddenFields removes columns marked hidden in the report configuration
+func stripHiddenFields(rows []map[string]interface{}, fields []FieldConfig) []map[string]interface{} {
+	var hidden []string
+	for _, f := range fields {
+		if f.IsHidden {
+			hidden = append(hidden, columnKey(f))
+		}
+	}
+	if len(hidden) == 0 {
+		return rows
+	}
+	for _, row := range rows {
+		for _, key := range hidden {
+			delete(row, key)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,275 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/datatypes"
+)
+
+// shareRepo serves one report, its share links and executions in memory
+type shareRepo struct {
+	Repository
+
+	report     *ReportDefinition
+	links      map[string]*ReportShareLink
+	executions map[uuid.UUID]*ReportExecution
+	rows       []map[string]interface{}
+	accesses   int
+}
+
+func newShareRepo(t *testing.T) *shareRepo {
+	t.Helper()
+	owner := uuid.New()
+	config, err := json.Marshal(ReportConfig{
+		Dataset: "projects",
+		Fields:  []FieldConfig{{Name: "name"}, {Name: "region"}, {Name: "owner_email", IsHidden: true}},
+	})
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	return &shareRepo{
+		report: &ReportDefinition{
+			ID:        uuid.New(),
+			Name:      "Projects",
+			Config:    datatypes.JSON(config),
+			CreatedBy: &owner,
+		},
+		links:      map[string]*ReportShareLink{},
+		executions: map[uuid.UUID]*ReportExecution{},
+		rows:       []map[string]interface{}{{"name": "Kasigau", "region": "Kenya", "owner_email": "a@example.com"}},
+	}
+}
+
+func (r *shareRepo) UpdateReportDefinition(_ context.Context, report *ReportDefinition) error {
+	r.report = report
+	return nil
+}
+
+func (r *shareRepo) GetUserRole(_ context.Context, _ uuid.UUID) (string, error) {
+	return "Verifier", nil
+}
+
+func (r *shareRepo) ListReportDefinitions(_ context.Context, filter ReportFilter) ([]ReportDefinition, int64, error) {
+	if filter.UserRole != "verifier" {
+		return nil, 0, nil
+	}
+	return []ReportDefinition{*r.report}, 1, nil
+}
+
+// addLink stores a link for the report and returns its token
+func (r *shareRepo) addLink(link ReportShareLink) string {
+	token := "rsl_" + uuid.NewString()
+	link.ID = uuid.New()
+	link.ReportDefinitionID = r.report.ID
+	link.TokenHash = hashShareToken(token)
+	link.TokenPrefix = token[:shareTokenDisplayLength]
+	if link.Kind == "" {
+		link.Kind = ShareLinkPublic
+	}
+	if link.Scope == "" {
+		link.Scope = ShareScopeLive
+	}
+	if link.ExpiresAt.IsZero() {
+		link.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	r.links[link.TokenHash] = &link
+	return token
+}
+
+func (r *shareRepo) GetShareLinkByTokenHash(_ context.Context, tokenHash string) (*ReportShareLink, error) {
+	link, ok := r.links[tokenHash]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	cp := *link
+	return &cp, nil
+}
+
+func (r *shareRepo) GetReportDefinition(_ context.Context, _ uuid.UUID) (*ReportDefinition, error) {
+	cp := *r.report
+	return &cp, nil
+}
+
+func (r *shareRepo) GetExecution(_ context.Context, id uuid.UUID) (*ReportExecution, error) {
+	execution, ok := r.executions[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	cp := *execution
+	return &cp, nil
+}
+
+func (r *shareRepo) UpdateExecution(_ context.Context, execution *ReportExecution) error {
+	cp := *execution
+	r.executions[execution.ID] = &cp
+	return nil
+}
+
+func (r *shareRepo) ExecuteDynamicQuery(_ context.Context, _ ReportConfig) ([]map[string]interface{}, int64, error) {
+	rows := make([]map[string]interface{}, len(r.rows))
+	for i, row := range r.rows {
+		cp := map[string]interface{}{}
+		for k, v := range row {
+			cp[k] = v
+		}
+		rows[i] = cp
+	}
+	return rows, int64(len(rows)), nil
+}
+
+func (r *shareRepo) RecordShareLinkAccess(_ context.Context, _ uuid.UUID, _ time.Time) error {
+	r.accesses++
+	return nil
+}
+
+type shareAudit struct {
+	actions []string
+}
+
+func (a *shareAudit) LogAuditEvent(_ context.Context, entry compliance.AuditEntry) error {
+	a.actions = append(a.actions, entry.EventAction)
+	return nil
+}
+
+func newShareService(repo *shareRepo) (*service, *shareAudit) {
+	audit := &shareAudit{}
+	config := DefaultConfig()
+	config.AuditLogger = audit
+	return NewServiceWithConfig(repo, nil, config).(*service), audit
+}
+
+func TestOpenShareLinkLive(t *testing.T) {
+	repo := newShareRepo(t)
+	svc, audit := newShareService(repo)
+	token := repo.addLink(ReportShareLink{})
+
+	view, link, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic})
+	if err != nil {
+		t.Fatalf("OpenShareLink: %v", err)
+	}
+	if link.Scope != ShareScopeLive || view.RecordCount != 1 || view.Data[0]["name"] != "Kasigau" {
+		t.Fatalf("unexpected view %+v", view)
+	}
+	if _, leaked := view.Data[0]["owner_email"]; leaked || len(view.Fields) != 2 {
+		t.Fatalf("expected hidden fields to be stripped, got %+v", view)
+	}
+	if repo.accesses != 1 || len(audit.actions) != 1 || audit.actions[0] != "read" {
+		t.Fatalf("expected the access to be counted and audited, got %d %v", repo.accesses, audit.actions)
+	}
+}
+
+func TestOpenShareLinkRefusesInvalidLinks(t *testing.T) {
+	repo := newShareRepo(t)
+	svc, audit := newShareService(repo)
+	revokedAt := time.Now().Add(-time.Minute)
+
+	tokens := map[string]string{
+		"revoked":    repo.addLink(ReportShareLink{RevokedAt: &revokedAt}),
+		"expired":    repo.addLink(ReportShareLink{ExpiresAt: time.Now().Add(-time.Minute)}),
+		"wrong kind": repo.addLink(ReportShareLink{Kind: ShareLinkEmbed}),
+		"unknown":    "rsl_unknown",
+	}
+	for name, token := range tokens {
+		if _, _, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic}); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("%s: expected ErrShareLinkNotFound, got %v", name, err)
+		}
+	}
+	if len(audit.actions) != 3 || repo.accesses != 0 {
+		t.Fatalf("expected three denied attempts to be audited and none counted, got %v %d", audit.actions, repo.accesses)
+	}
+}
+
+func TestOpenShareLinkPassword(t *testing.T) {
+	repo := newShareRepo(t)
+	svc, _ := newShareService(repo)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	token := repo.addLink(ReportShareLink{PasswordHash: string(hash), PasswordProtected: true})
+
+	for _, password := range []string{"", "wrong password"} {
+		_, _, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic, Password: password})
+		if !errors.Is(err, ErrSharePasswordRequired) {
+			t.Fatalf("password %q: expected ErrSharePasswordRequired, got %v", password, err)
+		}
+	}
+	if _, _, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic, Password: "correct horse"}); err != nil {
+		t.Fatalf("expected the right password to open the link, got %v", err)
+	}
+}
+
+func TestOpenShareLinkExecutionSnapshot(t *testing.T) {
+	repo := newShareRepo(t)
+	svc, _ := newShareService(repo)
+	var config ReportConfig
+	if err := json.Unmarshal(repo.report.Config, &config); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+
+	// Only executions run as shareable keep their rows
+	plain := &ReportExecution{ID: uuid.New(), ReportDefinitionID: &repo.report.ID, Status: StatusProcessing}
+	shared := &ReportExecution{ID: uuid.New(), ReportDefinitionID: &repo.report.ID, Status: StatusProcessing}
+	svc.processReportExecution(context.Background(), plain, repo.report, config, FormatJSON, false)
+	svc.processReportExecution(context.Background(), shared, repo.report, config, FormatJSON, true)
+	if len(repo.executions[plain.ID].ResultSnapshot) != 0 {
+		t.Fatalf("expected no snapshot for an execution that is not shared")
+	}
+	if len(repo.executions[shared.ID].ResultSnapshot) == 0 {
+		t.Fatalf("expected a snapshot for a shareable execution")
+	}
+
+	// Later data changes do not reach an execution-scoped link
+	repo.rows = []map[string]interface{}{{"name": "Changed", "region": "Peru"}}
+	token := repo.addLink(ReportShareLink{Scope: ShareScopeExecution, ExecutionID: &shared.ID})
+	view, _, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic})
+	if err != nil {
+		t.Fatalf("OpenShareLink: %v", err)
+	}
+	if view.Data[0]["name"] != "Kasigau" || view.ExecutionID == nil || *view.ExecutionID != shared.ID {
+		t.Fatalf("expected the execution's stored rows, got %+v", view)
+	}
+	if _, leaked := view.Data[0]["owner_email"]; leaked {
+		t.Fatalf("expected hidden fields to be stripped from snapshots")
+	}
+
+	// A purged snapshot closes the link
+	repo.executions[shared.ID].ResultSnapshot = nil
+	if _, _, err := svc.OpenShareLink(context.Background(), token, ShareLinkAccess{Kind: ShareLinkPublic}); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Fatalf("expected ErrShareLinkNotFound once the snapshot is gone, got %v", err)
+	}
+}
+
+func TestSharedRolesMatchAnyCase(t *testing.T) {
+	repo := newShareRepo(t)
+	svc, _ := newShareService(repo)
+
+	report, err := svc.UpdateSharing(context.Background(), *repo.report.CreatedBy, repo.report.ID,
+		UpdateSharingRequest{Roles: []string{"VERIFIER", " verifier", "Auditor"}})
+	if err != nil {
+		t.Fatalf("UpdateSharing: %v", err)
+	}
+	if len(report.SharedWithRoles) != 2 || report.SharedWithRoles[0] != "verifier" || report.SharedWithRoles[1] != "auditor" {
+		t.Fatalf("expected the roles stored lowercased once each, got %v", report.SharedWithRoles)
+	}
+
+	// The caller's role is held as "Verifier"
+	listed, err := svc.ListReports(context.Background(), uuid.New(), ReportFilter{})
+	if err != nil {
+		t.Fatalf("ListReports: %v", err)
+	}
+	if listed.Total != 1 {
+		t.Fatalf("expected the report listed for the verifier role, got %d", listed.Total)
+	}
+	if !svc.canAccessReport(context.Background(), repo.report, uuid.New()) {
+		t.Fatalf("expected the verifier role to open the report")
+	}
+}
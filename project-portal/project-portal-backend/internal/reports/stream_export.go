@@ -0,0 +1,145 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/reports/export"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+)
+
+// ResultStore stores execution output files. It is satisfied by
+// storage.S3Client, whose uploads stream without buffering the whole file.
+type ResultStore interface {
+	Upload(ctx context.Context, key string, body io.Reader, contentType string) (*storage.UploadResult, error)
+}
+
+// streamedFormats holds the file extension and content type of formats that
+// are written while the query is read
+var streamedFormats = map[ExportFormat]struct {
+	extension   string
+	contentType string
+}{
+	FormatParquet: {"parquet", "application/vnd.apache.parquet"},
+	FormatNDJSON:  {"ndjson", "application/x-ndjson"},
+}
+
+// ========== Streamed Exports ==========
+
+// streamReportExecution pipes query rows through a Parquet or NDJSON writer
+// into the result store, so the result set is never held in memory.
+// Executions fail without a result store, since the output would be lost.
+func (s *service) streamReportExecution(ctx context.Context, execution *ReportExecution, config ReportConfig, format ExportFormat) {
+	fail := func(err error) {
+		execution.Status = StatusFailed
+		execution.ErrorMessage = fmt.Sprintf("export failed: %v", err)
+		s.repo.UpdateExecution(ctx, execution)
+	}
+
+	if s.config.ResultStore == nil {
+		fail(fmt.Errorf("no result store is configured for %s exports", format))
+		return
+	}
+
+	columns, err := s.exportColumnTypes(ctx, config)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	pr, pw := io.Pipe()
+	output := &countingWriter{w: pw}
+
+	var recordCount int64
+	done := make(chan error, 1)
+	go func() {
+		var rw export.RowWriter
+		var err error
+		if format == FormatParquet {
+			rw, err = export.NewParquetWriter(output, columns)
+		} else {
+			rw = export.NewNDJSONWriter(output, columns)
+		}
+		if err == nil {
+			recordCount, err = s.repo.StreamDynamicQuery(ctx, config, rw.WriteRow)
+		}
+		if err == nil {
+			err = rw.Close()
+		}
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	spec := streamedFormats[format]
+	key := fmt.Sprintf("reports/executions/%s.%s", execution.ID, spec.extension)
+	_, uploadErr := s.config.ResultStore.Upload(ctx, key, pr, spec.contentType)
+	// Unblock the writer if the upload stopped reading early
+	pr.CloseWithError(uploadErr)
+
+	if err := <-done; err != nil {
+		fail(err)
+		return
+	}
+	if uploadErr != nil {
+		fail(uploadErr)
+		return
+	}
+
+	now := time.Now()
+	execution.CompletedAt = &now
+	execution.Status = StatusCompleted
+	execution.RecordCount = int(recordCount)
+	execution.FileSizeBytes = output.n
+	execution.FileKey = key
+
+	s.repo.UpdateExecution(ctx, execution)
+}
+
+// exportColumnTypes lists the visible result columns with their data types.
+// Types come from FieldConfig.DataType, falling back to the dataset metadata;
+// counts are integers and other aggregates of numeric fields are numbers.
+func (s *service) exportColumnTypes(ctx context.Context, config ReportConfig) ([]export.Column, error) {
+	known := make(map[string]string)
+	if dataset, err := s.lookupDataset(ctx, config.Dataset); err == nil {
+		for _, f := range dataset.Fields {
+			known[f.Name] = f.DataType
+		}
+	}
+
+	columns := make([]export.Column, 0, len(config.Fields))
+	for _, f := range config.Fields {
+		if f.IsHidden {
+			continue
+		}
+		dataType := f.DataType
+		if dataType == "" {
+			// MIN and MAX keep the field's own type
+			dataType = known[f.Name]
+			switch f.Aggregate {
+			case AggregateCount:
+				dataType = export.ColumnInteger
+			case AggregateSum, AggregateAvg:
+				dataType = export.ColumnNumber
+			}
+		}
+		columns = append(columns, export.Column{Name: columnKey(f), Type: dataType})
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("report has no visible fields")
+	}
+	return columns, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package reports
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// discardStore accepts streamed exports and throws them away
+type discardStore struct{}
+
+func (discardStore) Upload(_ context.Context, key string, body io.Reader, _ string) (*storage.UploadResult, error) {
+	_, err := io.Copy(io.Discard, body)
+	return &storage.UploadResult{Key: key}, err
+}
+
+func TestStreamedExportsNeedResultStore(t *testing.T) {
+	owner := uuid.New()
+	repo := newCacheRepo(owner)
+	svc := NewService(repo, nil)
+
+	for _, format := range []ExportFormat{FormatParquet, FormatNDJSON} {
+		_, err := svc.ExecuteReport(context.Background(), owner, repo.report.ID, ExecuteReportRequest{Format: format})
+		if err == nil || !strings.Contains(err.Error(), "result storage") {
+			t.Fatalf("%s: expected the format to be rejected, got %v", format, err)
+		}
+	}
+	if repo.createCount() != 0 {
+		t.Fatalf("expected no execution to be created")
+	}
+
+	// Executions that reach the streamer anyway fail rather than complete
+	execution := &ReportExecution{ID: uuid.New(), Status: StatusProcessing}
+	svc.(*service).streamReportExecution(context.Background(), execution, ReportConfig{Dataset: "carbon_credits"}, FormatNDJSON)
+	if got := repo.status(execution.ID); got != StatusFailed {
+		t.Fatalf("expected the execution to fail without a result store, got %s", got)
+	}
+}
+
+func TestStreamedExportsCannotBeShared(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	owner := uuid.New()
+	repo := newCacheRepo(owner)
+	config := DefaultConfig()
+	config.ResultStore = discardStore{}
+	router := gin.New()
+	NewHandler(NewServiceWithConfig(repo, nil, config)).RegisterRoutes(router.Group("/api/v1"))
+
+	for _, format := range []ExportFormat{FormatParquet, FormatNDJSON} {
+		body := `{"format":"` + string(format) + `","shareable":true}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reports/"+repo.report.ID.String()+"/execute", strings.NewReader(body))
+		req.Header.Set("X-User-ID", owner.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "cannot be shared") {
+			t.Fatalf("%s: expected a shareable streamed export refused, got %d %s", format, w.Code, w.Body.String())
+		}
+	}
+	if repo.createCount() != 0 {
+		t.Fatalf("expected no execution to be created")
+	}
+}
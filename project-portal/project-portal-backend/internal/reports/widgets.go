@@ -0,0 +1,534 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTrendPeriod    = "30d"
+	defaultWidgetPageSize = 20
+	maxWidgetPageSize     = 500
+	widgetValueAlias      = "value"
+	trendThresholdPercent = 5.0
+	categoryDateFormat    = "2006-01-02"
+)
+
+// columnAliasPattern limits table column aliases to plain identifiers, since
+// they are interpolated into the generated SQL
+var columnAliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+var (
+	// ErrWidgetNotFound is returned for widgets that do not exist
+	ErrWidgetNotFound = errors.New("widget not found")
+	// ErrWidgetAccessDenied is returned for another user's widget
+	ErrWidgetAccessDenied = errors.New("access denied to widget")
+)
+
+// ========== Widget Data Resolution ==========
+
+// GetWidgetData evaluates a widget's configuration through the report query
+// engine and returns data shaped for the widget type.
+func (s *service) GetWidgetData(ctx context.Context, userID uuid.UUID, widgetID uuid.UUID, req WidgetDataRequest) (*WidgetDataResponse, error) {
+	widget, err := s.repo.GetWidget(ctx, widgetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWidgetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get widget: %w", err)
+	}
+
+	// Widgets without an owner are shared dashboard defaults
+	if widget.UserID != nil && *widget.UserID != userID {
+		return nil, ErrWidgetAccessDenied
+	}
+
+	var config WidgetConfig
+	if err := json.Unmarshal(widget.Config, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse widget config: %w", err)
+	}
+
+	response := &WidgetDataResponse{
+		WidgetID:    widget.ID,
+		WidgetType:  widget.WidgetType,
+		Title:       widget.Title,
+		GeneratedAt: time.Now(),
+	}
+
+	// Forecast charts read project history directly rather than a dataset
+	if widget.WidgetType == WidgetChart && config.Forecast != nil {
+		response.Chart, err = s.resolveForecastChart(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve widget data: %w", err)
+		}
+		return response, nil
+	}
+
+	dataset, err := s.lookupDataset(ctx, config.DataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateWidgetConfig(widget.WidgetType, config, dataset); err != nil {
+		return nil, fmt.Errorf("invalid widget configuration: %w", err)
+	}
+
+	switch widget.WidgetType {
+	case WidgetChart:
+		response.Chart, err = s.resolveChartWidget(ctx, config)
+	case WidgetMetric:
+		response.Metric, err = s.resolveMetricWidget(ctx, config, dataset, response.GeneratedAt)
+	case WidgetGauge:
+		response.Gauge, err = s.resolveGaugeWidget(ctx, config)
+	case WidgetTable:
+		response.Table, err = s.resolveTableWidget(ctx, config, dataset, req)
+	default:
+		return nil, fmt.Errorf("unsupported widget type: %s", widget.WidgetType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve widget data: %w", err)
+	}
+
+	return response, nil
+}
+
+func (s *service) resolveChartWidget(ctx context.Context, config WidgetConfig) (*ChartWidgetData, error) {
+	fields := make([]FieldConfig, 0, len(config.YAxis)+1)
+	fields = append(fields, FieldConfig{Name: config.XAxis})
+	for _, y := range config.YAxis {
+		fields = append(fields, FieldConfig{Name: y, Aggregate: AggregateSum, Alias: y})
+	}
+
+	rows, _, err := s.repo.ExecuteDynamicQuery(ctx, ReportConfig{
+		Dataset:   config.DataSource,
+		Fields:    fields,
+		Filters:   config.Filters,
+		Groupings: []GroupConfig{{Field: config.XAxis}},
+		Sorts:     []SortConfig{{Field: config.XAxis, Direction: "asc"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &ChartWidgetData{
+		ChartType:  config.ChartType,
+		XAxis:      config.XAxis,
+		Categories: make([]string, 0, len(rows)),
+		Series:     make([]ChartSeries, len(config.YAxis)),
+		Stacked:    config.Stacked,
+	}
+	if chart.ChartType == "" {
+		chart.ChartType = "line"
+	}
+
+	for i, y := range config.YAxis {
+		chart.Series[i] = ChartSeries{Name: y, Data: make([]float64, 0, len(rows))}
+	}
+
+	for _, row := range rows {
+		chart.Categories = append(chart.Categories, formatCategory(row[config.XAxis]))
+		for i, y := range config.YAxis {
+			chart.Series[i].Data = append(chart.Series[i].Data, toFloat64(row[y]))
+		}
+	}
+
+	return chart, nil
+}
+
+func (s *service) resolveMetricWidget(ctx context.Context, config WidgetConfig, dataset *DatasetMetadata, now time.Time) (*MetricWidgetData, error) {
+	period := config.TrendPeriod
+	if period == "" {
+		period = defaultTrendPeriod
+	}
+	window, err := parseTrendPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := &MetricWidgetData{
+		Period:        period,
+		DisplayFormat: config.DisplayFormat,
+		Prefix:        config.Prefix,
+		Suffix:        config.Suffix,
+		Trend:         "stable",
+	}
+
+	timeField := config.CompareField
+	if timeField == "" {
+		timeField = defaultDateField(dataset)
+	}
+
+	// Without a date field there is nothing to split periods on
+	if timeField == "" {
+		metric.Value, err = s.queryWidgetScalar(ctx, config, config.Filters)
+		return metric, err
+	}
+
+	currentStart := now.Add(-window)
+	previousStart := currentStart.Add(-window)
+
+	metric.Value, err = s.queryWidgetScalar(ctx, config, withTimeWindow(config.Filters, timeField, currentStart, now))
+	if err != nil {
+		return nil, err
+	}
+	metric.PreviousValue, err = s.queryWidgetScalar(ctx, config, withTimeWindow(config.Filters, timeField, previousStart, currentStart))
+	if err != nil {
+		return nil, err
+	}
+
+	metric.Change = metric.Value - metric.PreviousValue
+	if metric.PreviousValue != 0 {
+		metric.ChangePercent = (metric.Change / metric.PreviousValue) * 100
+		if metric.ChangePercent > trendThresholdPercent {
+			metric.Trend = "up"
+		} else if metric.ChangePercent < -trendThresholdPercent {
+			metric.Trend = "down"
+		}
+	} else if metric.Change > 0 {
+		metric.Trend = "up"
+	} else if metric.Change < 0 {
+		metric.Trend = "down"
+	}
+
+	return metric, nil
+}
+
+func (s *service) resolveGaugeWidget(ctx context.Context, config WidgetConfig) (*GaugeWidgetData, error) {
+	value, err := s.queryWidgetScalar(ctx, config, config.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	gauge := &GaugeWidgetData{
+		Value:    value,
+		MinValue: config.MinValue,
+		MaxValue: config.MaxValue,
+		Band:     thresholdBand(value, config.Thresholds),
+	}
+
+	if config.MaxValue > config.MinValue {
+		gauge.Percent = (value - config.MinValue) / (config.MaxValue - config.MinValue) * 100
+		if gauge.Percent < 0 {
+			gauge.Percent = 0
+		}
+		if gauge.Percent > 100 {
+			gauge.Percent = 100
+		}
+	}
+
+	return gauge, nil
+}
+
+func (s *service) resolveTableWidget(ctx context.Context, config WidgetConfig, dataset *DatasetMetadata, req WidgetDataRequest) (*TableWidgetData, error) {
+	columns := make([]FieldConfig, 0, len(config.Columns))
+	for _, col := range config.Columns {
+		if col.IsHidden {
+			continue
+		}
+		// Aggregated columns need an alias so rows and sorts can refer to them
+		if col.Aggregate != "" && col.Alias == "" {
+			col.Alias = col.Name
+		}
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		for _, f := range dataset.Fields {
+			columns = append(columns, FieldConfig{Name: f.Name, Alias: f.Name, DataType: f.DataType})
+		}
+	}
+
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = config.PageSize
+	}
+	if pageSize <= 0 {
+		pageSize = defaultWidgetPageSize
+	}
+	if pageSize > maxWidgetPageSize {
+		pageSize = maxWidgetPageSize
+	}
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	// Non-aggregated columns become the grouping keys when any column aggregates
+	var groupings []GroupConfig
+	hasAggregate := false
+	for _, col := range columns {
+		if col.Aggregate != "" {
+			hasAggregate = true
+			break
+		}
+	}
+	if hasAggregate {
+		for i, col := range columns {
+			if col.Aggregate == "" {
+				groupings = append(groupings, GroupConfig{Field: col.Name, Order: i})
+			}
+		}
+	}
+
+	// Order by the first column so pages are stable
+	sortField := columnKey(columns[0])
+
+	rows, total, err := s.repo.ExecuteDynamicQuery(ctx, ReportConfig{
+		Dataset:   config.DataSource,
+		Fields:    columns,
+		Filters:   config.Filters,
+		Groupings: groupings,
+		Sorts:     []SortConfig{{Field: sortField, Direction: "asc"}},
+		Limit:     pageSize,
+		Offset:    (page - 1) * pageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	// Fully aggregated tables collapse to a single row
+	if hasAggregate && len(groupings) == 0 {
+		total = int64(len(rows))
+	}
+
+	return &TableWidgetData{
+		Columns:    columns,
+		Rows:       rows,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}, nil
+}
+
+// queryWidgetScalar runs the widget's metric aggregate and returns the single resulting value
+func (s *service) queryWidgetScalar(ctx context.Context, config WidgetConfig, filters []FilterConfig) (float64, error) {
+	aggregate := config.MetricAggregate
+	if aggregate == "" {
+		aggregate = AggregateSum
+	}
+	field := config.MetricField
+	if field == "" {
+		field = "*"
+	}
+
+	rows, _, err := s.repo.ExecuteDynamicQuery(ctx, ReportConfig{
+		Dataset: config.DataSource,
+		Fields:  []FieldConfig{{Name: field, Aggregate: aggregate, Alias: widgetValueAlias}},
+		Filters: filters,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return toFloat64(rows[0][widgetValueAlias]), nil
+}
+
+func (s *service) lookupDataset(ctx context.Context, name string) (*DatasetMetadata, error) {
+	datasets, err := s.GetAvailableDatasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range datasets {
+		if datasets[i].Name == name {
+			return &datasets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown data source: %s", name)
+}
+
+// validateWidgetConfig checks that every field referenced by the widget exists
+// in its dataset and that column aliases are identifiers, since both are
+// interpolated into the generated SQL.
+func validateWidgetConfig(widgetType WidgetType, config WidgetConfig, dataset *DatasetMetadata) error {
+	known := make(map[string]FieldMetadata, len(dataset.Fields))
+	for _, f := range dataset.Fields {
+		known[f.Name] = f
+	}
+	check := func(name string) error {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("unknown field %q in data source %s", name, dataset.Name)
+		}
+		return nil
+	}
+
+	for _, filter := range config.Filters {
+		if err := check(filter.Field); err != nil {
+			return err
+		}
+	}
+
+	switch widgetType {
+	case WidgetChart:
+		if config.XAxis == "" || len(config.YAxis) == 0 {
+			return fmt.Errorf("chart widgets require x_axis and y_axis")
+		}
+		if err := check(config.XAxis); err != nil {
+			return err
+		}
+		for _, y := range config.YAxis {
+			if err := check(y); err != nil {
+				return err
+			}
+		}
+	case WidgetMetric, WidgetGauge:
+		switch config.MetricAggregate {
+		case "", AggregateSum, AggregateAvg, AggregateCount, AggregateMin, AggregateMax:
+		default:
+			return fmt.Errorf("unsupported metric aggregate: %s", config.MetricAggregate)
+		}
+		if config.MetricField == "" && config.MetricAggregate != AggregateCount {
+			return fmt.Errorf("metric_field is required unless metric_aggregate is COUNT")
+		}
+		if config.MetricField != "" {
+			if err := check(config.MetricField); err != nil {
+				return err
+			}
+		}
+		if config.CompareField != "" {
+			if err := check(config.CompareField); err != nil {
+				return err
+			}
+			if known[config.CompareField].DataType != "date" {
+				return fmt.Errorf("compare_field must be a date field")
+			}
+		}
+	case WidgetTable:
+		for _, col := range config.Columns {
+			if err := check(col.Name); err != nil {
+				return err
+			}
+			if col.Alias != "" && !columnAliasPattern.MatchString(col.Alias) {
+				return fmt.Errorf("invalid alias for column %s: %q", col.Name, col.Alias)
+			}
+			switch col.Aggregate {
+			case "", AggregateSum, AggregateAvg, AggregateCount, AggregateMin, AggregateMax:
+			default:
+				return fmt.Errorf("unsupported aggregate for column %s: %s", col.Name, col.Aggregate)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseTrendPeriod parses periods such as 7d, 4w, 3m or 1y
+func parseTrendPeriod(period string) (time.Duration, error) {
+	if len(period) < 2 {
+		return 0, fmt.Errorf("invalid trend period: %q", period)
+	}
+
+	n, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid trend period: %q", period)
+	}
+
+	day := 24 * time.Hour
+	switch strings.ToLower(period[len(period)-1:]) {
+	case "d":
+		return time.Duration(n) * day, nil
+	case "w":
+		return time.Duration(n) * 7 * day, nil
+	case "m":
+		return time.Duration(n) * 30 * day, nil
+	case "y":
+		return time.Duration(n) * 365 * day, nil
+	default:
+		return 0, fmt.Errorf("invalid trend period: %q", period)
+	}
+}
+
+func withTimeWindow(filters []FilterConfig, field string, start, end time.Time) []FilterConfig {
+	windowed := make([]FilterConfig, 0, len(filters)+2)
+	windowed = append(windowed, filters...)
+	windowed = append(windowed,
+		FilterConfig{Field: field, Operator: "gte", Value: start},
+		FilterConfig{Field: field, Operator: "lt", Value: end},
+	)
+	return windowed
+}
+
+func defaultDateField(dataset *DatasetMetadata) string {
+	for _, f := range dataset.Fields {
+		if f.DataType == "date" {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// thresholdBand returns the highest threshold at or below value
+func thresholdBand(value float64, thresholds []GaugeThreshold) *GaugeThreshold {
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	sorted := make([]GaugeThreshold, len(thresholds))
+	copy(sorted, thresholds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+
+	var band *GaugeThreshold
+	for i := range sorted {
+		if value >= sorted[i].Value {
+			band = &sorted[i]
+		}
+	}
+	return band
+}
+
+func columnKey(field FieldConfig) string {
+	if field.Alias != "" {
+		return field.Alias
+	}
+	return field.Name
+}
+
+func formatCategory(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.Format(categoryDateFormat)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// toFloat64 converts a scanned SQL value into a float64
+func toFloat64(v interface{}) float64 {
+	switch val := v.(type) {
+	case float64:
+		return val
+	case float32:
+		return float64(val)
+	case int:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case []byte:
+		f, _ := strconv.ParseFloat(string(val), 64)
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(val, 64)
+		return f
+	default:
+		return 0
+	}
+}
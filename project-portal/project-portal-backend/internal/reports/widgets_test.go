@@ -0,0 +1,137 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// widgetRepo serves one widget and records the queries it generates
+type widgetRepo struct {
+	Repository
+
+	widget  *DashboardWidget
+	rows    []map[string]interface{}
+	queries []ReportConfig
+}
+
+func newWidgetRepo(t *testing.T, owner uuid.UUID, widgetType WidgetType, config WidgetConfig) *widgetRepo {
+	t.Helper()
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	return &widgetRepo{widget: &DashboardWidget{
+		ID:         uuid.New(),
+		UserID:     &owner,
+		WidgetType: widgetType,
+		Title:      "Widget",
+		Config:     datatypes.JSON(raw),
+	}}
+}
+
+func (r *widgetRepo) GetWidget(_ context.Context, id uuid.UUID) (*DashboardWidget, error) {
+	if id != r.widget.ID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.widget, nil
+}
+
+func (r *widgetRepo) ExecuteDynamicQuery(_ context.Context, config ReportConfig) ([]map[string]interface{}, int64, error) {
+	r.queries = append(r.queries, config)
+	return r.rows, int64(len(r.rows)), nil
+}
+
+func TestGetWidgetDataTable(t *testing.T) {
+	owner := uuid.New()
+	repo := newWidgetRepo(t, owner, WidgetTable, WidgetConfig{
+		DataSource: "projects",
+		Columns: []FieldConfig{
+			{Name: "status"},
+			{Name: "estimated_credits", Aggregate: AggregateSum, Alias: "total_credits"},
+		},
+		PageSize: 10,
+	})
+	repo.rows = []map[string]interface{}{{"status": "active", "total_credits": 40.0}}
+	svc := NewService(repo, nil)
+
+	data, err := svc.GetWidgetData(context.Background(), owner, repo.widget.ID, WidgetDataRequest{Page: 2})
+	if err != nil {
+		t.Fatalf("GetWidgetData: %v", err)
+	}
+	if data.Table == nil || len(data.Table.Rows) != 1 || data.Table.Page != 2 || data.Table.PageSize != 10 {
+		t.Fatalf("unexpected table %+v", data.Table)
+	}
+	if len(repo.queries) != 1 {
+		t.Fatalf("expected one query, got %d", len(repo.queries))
+	}
+	query := repo.queries[0]
+	if query.Offset != 10 || len(query.Groupings) != 1 || query.Groupings[0].Field != "status" {
+		t.Fatalf("expected the plain column grouped on page 2, got %+v", query)
+	}
+
+	if _, err := svc.GetWidgetData(context.Background(), uuid.New(), repo.widget.ID, WidgetDataRequest{}); !errors.Is(err, ErrWidgetAccessDenied) {
+		t.Fatalf("expected another user's widget to be refused, got %v", err)
+	}
+}
+
+func TestGetWidgetDataStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	owner := uuid.New()
+	repo := newWidgetRepo(t, owner, WidgetTable, WidgetConfig{DataSource: "projects", Columns: []FieldConfig{{Name: "status"}}})
+	router := gin.New()
+	NewHandler(NewService(repo, nil)).RegisterRoutes(router.Group("/api/v1"))
+	call := func(widgetID, userID uuid.UUID) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/reports/widgets/"+widgetID.String()+"/data", nil)
+		req.Header.Set("X-User-ID", userID.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call(repo.widget.ID, owner); code != http.StatusOK {
+		t.Fatalf("expected the owner served, got %d", code)
+	}
+	if code := call(repo.widget.ID, uuid.New()); code != http.StatusForbidden {
+		t.Fatalf("expected another user refused, got %d", code)
+	}
+	if code := call(uuid.New(), owner); code != http.StatusNotFound {
+		t.Fatalf("expected a missing widget not found, got %d", code)
+	}
+}
+
+func TestGetWidgetDataRejectsUnsafeColumns(t *testing.T) {
+	cases := map[string]FieldConfig{
+		"unknown field": {Name: "password_hash"},
+		"alias injection": {
+			Name:      "estimated_credits",
+			Aggregate: AggregateSum,
+			Alias:     "x FROM users; DROP TABLE projects; --",
+		},
+		"quoted alias": {Name: "status", Alias: `"status"`},
+	}
+	for name, col := range cases {
+		t.Run(name, func(t *testing.T) {
+			owner := uuid.New()
+			repo := newWidgetRepo(t, owner, WidgetTable, WidgetConfig{DataSource: "projects", Columns: []FieldConfig{col}})
+			svc := NewService(repo, nil)
+
+			_, err := svc.GetWidgetData(context.Background(), owner, repo.widget.ID, WidgetDataRequest{})
+			if err == nil || !strings.Contains(err.Error(), "invalid widget configuration") {
+				t.Fatalf("expected the configuration to be rejected, got %v", err)
+			}
+			if len(repo.queries) != 0 {
+				t.Fatalf("expected no query to run, got %+v", repo.queries)
+			}
+		})
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"testing"
 )
 
-type mockRepo struct{}
+type mockRepo struct {
+	updates []map[string]interface{}
+}
 
 func (m *mockRepo) IndexProject(ctx context.Context, project *ProjectDocument) error {
 	return nil
@@ -16,6 +18,10 @@ func (m *mockRepo) Search(ctx context.Context, index string, query map[string]in
 func (m *mockRepo) SetupIndexes(ctx context.Context) error {
 	return nil
 }
+func (m *mockRepo) UpdateByQuery(ctx context.Context, index string, body map[string]interface{}) (int64, error) {
+	m.updates = append(m.updates, body)
+	return 1, nil
+}
 
 func TestIndexer_IndexProject(t *testing.T) {
 	indexer := NewIndexer(&mockRepo{})
@@ -25,3 +31,23 @@ func TestIndexer_IndexProject(t *testing.T) {
 		t.Errorf("IndexProject failed: %v", err)
 	}
 }
+
+func TestPurgeUserEntriesAnonymisesSharedProjects(t *testing.T) {
+	repo := &mockRepo{}
+	svc := NewService(repo)
+
+	if _, err := svc.PurgeUserEntries(context.Background(), "user-1"); err != nil {
+		t.Fatalf("PurgeUserEntries failed: %v", err)
+	}
+	if len(repo.updates) != 1 {
+		t.Fatalf("expected one update by query, got %d", len(repo.updates))
+	}
+	script, ok := repo.updates[0]["script"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected the entries to be rewritten by a script, got %v", repo.updates[0])
+	}
+	params := script["params"].(map[string]interface{})
+	if params["user_id"] != "user-1" || len(params["fields"].([]string)) != len(userFields) {
+		t.Fatalf("expected every user field cleared for the user, got %v", params)
+	}
+}
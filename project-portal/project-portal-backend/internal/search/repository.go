@@ -13,6 +13,7 @@ type Repository interface {
 	IndexProject(ctx context.Context, project *ProjectDocument) error
 	Search(ctx context.Context, index string, query map[string]interface{}) (*SearchResponse, error)
 	SetupIndexes(ctx context.Context) error
+	UpdateByQuery(ctx context.Context, index string, body map[string]interface{}) (int64, error)
 }
 
 // ElasticRepository implements Repository using Elasticsearch
@@ -42,6 +43,11 @@ func (r *ElasticRepository) Search(ctx context.Context, index string, query map[
 	return parseSearchResponse(resp)
 }
 
+// UpdateByQuery applies a script to every document matching a query
+func (r *ElasticRepository) UpdateByQuery(ctx context.Context, index string, body map[string]interface{}) (int64, error) {
+	return r.client.UpdateByQuery(ctx, index, body)
+}
+
 // SetupIndexes creates necessary indices if they don't exist
 func (r *ElasticRepository) SetupIndexes(ctx context.Context) error {
 	exists, err := r.client.IndexExists(ctx, ProjectIndexName)
@@ -14,6 +14,7 @@ type Service interface {
 	SearchNearby(ctx context.Context, req SearchRequest, lat, lon float64, dist string) (*SearchResponse, error)
 	IndexProject(ctx context.Context, project ProjectDocument) error
 	SyncIndex(ctx context.Context) error
+	PurgeUserEntries(ctx context.Context, userID string) (int64, error)
 }
 
 // ServiceImpl implements Service
@@ -179,3 +180,29 @@ func (s *ServiceImpl) IndexProject(ctx context.Context, project ProjectDocument)
 func (s *ServiceImpl) SyncIndex(ctx context.Context) error {
 	return s.repo.SetupIndexes(ctx)
 }
+
+// userFields are the document fields that can reference a user
+var userFields = []string{"owner_id", "user_id", "created_by", "uploaded_by"}
+
+// anonymiseUserScript removes the fields that still name the erased user
+const anonymiseUserScript = `for (f in params.fields) { if (ctx._source[f] == params.user_id) { ctx._source.remove(f) } }`
+
+// PurgeUserEntries removes a user from the index entries referencing them,
+// for erasure requests. Projects are shared with their other members, so
+// the entries are anonymised rather than deleted.
+func (s *ServiceImpl) PurgeUserEntries(ctx context.Context, userID string) (int64, error) {
+	should := make([]interface{}, 0, len(userFields))
+	for _, field := range userFields {
+		should = append(should, map[string]interface{}{"term": map[string]interface{}{field: userID}})
+	}
+	return s.repo.UpdateByQuery(ctx, ProjectIndexName, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+		},
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": anonymiseUserScript,
+			"params": map[string]interface{}{"fields": userFields, "user_id": userID},
+		},
+	})
+}
@@ -0,0 +1,302 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	settingsprofile "carbon-scribe/project-portal/project-portal-backend/internal/settings/profile"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/email"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultExportRetention = 7 * 24 * time.Hour
+	defaultExportURLExpiry = 15 * time.Minute
+	// exportStaleAfter is how long an export may stay processing before
+	// another worker picks it up again
+	exportStaleAfter = 30 * time.Minute
+	exportBatchSize  = 10
+)
+
+// ExportSource collects one category of a user's data held by another
+// module. Collect returns anything that marshals to a JSON object or a list
+// of objects.
+type ExportSource struct {
+	Category string
+	Collect  func(ctx context.Context, userID uuid.UUID) (interface{}, error)
+}
+
+// ExportStore keeps export archives; S3Client satisfies it
+type ExportStore interface {
+	UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error)
+	GeneratePresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// AccountExportNotifier tells users their export is ready to download
+type AccountExportNotifier interface {
+	NotifyAccountExport(ctx context.Context, export *AccountExport, downloadURL string) error
+}
+
+var ErrExportStorageUnavailable = errors.New("account export storage is not configured")
+
+// RequestAccountExport queues an export of all the user's data. A user has
+// at most one export in progress; asking again returns it.
+func (s *service) RequestAccountExport(ctx context.Context, userID uuid.UUID) (*AccountExport, error) {
+	if s.cfg.ExportStore == nil {
+		return nil, ErrExportStorageUnavailable
+	}
+	active, err := s.repo.FindActiveAccountExport(ctx, userID)
+	if err == nil {
+		return active, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	export := &AccountExport{ID: uuid.New(), UserID: userID, Status: "pending", RequestedAt: time.Now().UTC()}
+	if err := s.repo.CreateAccountExport(ctx, export); err != nil {
+		return nil, err
+	}
+	s.audit("profile.export.requested", userID, map[string]interface{}{"export_id": export.ID})
+	return export, nil
+}
+
+func (s *service) ListAccountExports(ctx context.Context, userID uuid.UUID) ([]AccountExport, error) {
+	return s.repo.ListAccountExports(ctx, userID, 20)
+}
+
+// GetAccountExport returns an export with a short-lived download link once
+// it is complete
+func (s *service) GetAccountExport(ctx context.Context, userID, exportID uuid.UUID) (*AccountExport, error) {
+	export, err := s.repo.GetAccountExport(ctx, userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != "completed" {
+		return export, nil
+	}
+	if s.cfg.ExportStore == nil {
+		return nil, ErrExportStorageUnavailable
+	}
+	expiry := s.cfg.ExportURLExpiry
+	if remaining := time.Until(*export.ExpiresAt); remaining < expiry {
+		expiry = remaining
+	}
+	url, err := s.cfg.ExportStore.GeneratePresignedURL(ctx, export.ObjectKey, expiry)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().UTC().Add(expiry)
+	export.DownloadURL = url
+	export.DownloadExpiresAt = &expiresAt
+	s.audit("profile.export.download", userID, map[string]interface{}{"export_id": export.ID})
+	return export, nil
+}
+
+// ProcessAccountExports builds queued exports and deletes archives past
+// their retention
+func (s *service) ProcessAccountExports(ctx context.Context) (*AccountExportRunResult, error) {
+	result := &AccountExportRunResult{}
+	if s.cfg.ExportStore == nil {
+		return result, nil
+	}
+	now := time.Now().UTC()
+	exports, err := s.repo.ListAccountExportsToProcess(ctx, now.Add(-exportStaleAfter), exportBatchSize)
+	if err != nil {
+		return result, err
+	}
+	for i := range exports {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		export := &exports[i]
+		startedAt := time.Now().UTC()
+		claimed, err := s.repo.ClaimAccountExport(ctx, export.ID, startedAt, startedAt.Add(-exportStaleAfter))
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			continue
+		}
+		// Later saves write the whole row, so keep it in step with the claim
+		export.Status = "processing"
+		export.StartedAt = &startedAt
+		if err := s.buildAccountExport(ctx, export); err != nil {
+			log.Printf("settings: account export %s: %v", export.ID, err)
+			export.Status = "failed"
+			export.Error = err.Error()
+			completed := time.Now().UTC()
+			export.CompletedAt = &completed
+			if err := s.repo.SaveAccountExport(ctx, export); err != nil {
+				return result, err
+			}
+			s.audit("profile.export.failed", export.UserID, map[string]interface{}{"export_id": export.ID, "error": export.Error})
+			result.Failed++
+			continue
+		}
+		result.Completed++
+	}
+
+	expired, err := s.repo.ListExpiredAccountExports(ctx, now, exportBatchSize)
+	if err != nil {
+		return result, err
+	}
+	for i := range expired {
+		export := &expired[i]
+		if err := s.cfg.ExportStore.Delete(ctx, export.ObjectKey); err != nil {
+			log.Printf("settings: delete account export %s: %v", export.ID, err)
+			continue
+		}
+		export.Status = "expired"
+		export.ObjectKey = ""
+		if err := s.repo.SaveAccountExport(ctx, export); err != nil {
+			return result, err
+		}
+		result.Expired++
+	}
+	return result, nil
+}
+
+// buildAccountExport collects every category, stores the archive and marks
+// the export completed. Any category failing fails the export, so users
+// never receive a partial copy presented as complete.
+func (s *service) buildAccountExport(ctx context.Context, export *AccountExport) error {
+	sections, summary, err := s.collectExportSections(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	summary.ExportID = export.ID.String()
+	summary.GeneratedAt = now
+	archive, manifest, err := settingsprofile.BuildExportArchive(settingsprofile.ExportManifest{
+		ExportID:    export.ID.String(),
+		UserID:      export.UserID.String(),
+		GeneratedAt: now,
+	}, sections, summary)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("exports/%s/%s.zip", export.UserID, export.ID)
+	if _, err := s.cfg.ExportStore.UploadBytes(ctx, key, archive, "application/zip"); err != nil {
+		return fmt.Errorf("store archive: %w", err)
+	}
+	manifestJSON, _ := json.Marshal(manifest)
+	expiresAt := now.Add(s.cfg.ExportRetention)
+	export.Status = "completed"
+	export.ObjectKey = key
+	export.SizeBytes = int64(len(archive))
+	export.Manifest = manifestJSON
+	export.Error = ""
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	if err := s.repo.SaveAccountExport(ctx, export); err != nil {
+		return err
+	}
+	s.audit("profile.export.completed", export.UserID, map[string]interface{}{"export_id": export.ID, "bytes": len(archive), "categories": len(sections)})
+
+	if s.cfg.ExportNotifier != nil {
+		// The emailed link lasts as long as the archive is kept
+		url, err := s.cfg.ExportStore.GeneratePresignedURL(ctx, key, s.cfg.ExportRetention)
+		if err == nil {
+			err = s.cfg.ExportNotifier.NotifyAccountExport(ctx, export, url)
+		}
+		if err != nil {
+			log.Printf("settings: notify account export %s: %v", export.ID, err)
+		}
+	}
+	return nil
+}
+
+// collectExportSections gathers the settings module's own data followed by
+// the categories registered by other modules
+func (s *service) collectExportSections(ctx context.Context, userID uuid.UUID) ([]settingsprofile.ExportSection, settingsprofile.ExportSummary, error) {
+	var summary settingsprofile.ExportSummary
+	profile, err := s.repo.GetOrCreateProfile(ctx, userID)
+	if err != nil {
+		return nil, summary, err
+	}
+	prefs, err := s.repo.GetOrCreateNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, summary, err
+	}
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, summary, err
+	}
+	integrations, err := s.repo.ListIntegrations(ctx, userID)
+	if err != nil {
+		return nil, summary, err
+	}
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, summary, err
+	}
+	// The payment method reference is an encrypted processor token
+	sub.PaymentMethodID = ""
+	invoices, err := s.repo.ListInvoices(ctx, userID, 0)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	sections := []settingsprofile.ExportSection{
+		{Category: "profile", Data: profile},
+		{Category: "notification_preferences", Data: prefs},
+		{Category: "api_keys", Data: keys}, // key hashes and secrets are never serialised
+		{Category: "integrations", Data: integrations},
+		{Category: "subscription", Data: sub},
+		{Category: "invoices", Data: invoices},
+	}
+	for _, source := range s.cfg.ExportSources {
+		data, err := source.Collect(ctx, userID)
+		if err != nil {
+			return nil, summary, fmt.Errorf("collect %s: %w", source.Category, err)
+		}
+		sections = append(sections, settingsprofile.ExportSection{Category: source.Category, Data: data})
+	}
+
+	summary = settingsprofile.ExportSummary{
+		Name:   profile.FullName,
+		UserID: userID.String(),
+		Details: [][2]string{
+			{"Display name", profile.DisplayName},
+			{"Organization", profile.Organization},
+			{"Job title", profile.JobTitle},
+			{"Secondary email", profile.SecondaryEmail},
+			{"Phone", profile.PhoneNumber},
+			{"Language", profile.Language},
+			{"Timezone", profile.Timezone},
+			{"Plan", sub.PlanName},
+			{"Member since", profile.CreatedAt.Format("2006-01-02")},
+		},
+	}
+	return sections, summary, nil
+}
+
+// EmailAccountExportNotifier emails the download link of a finished export
+type EmailAccountExportNotifier struct {
+	Sender    email.Sender
+	Recipient func(ctx context.Context, userID uuid.UUID) (string, error)
+}
+
+func (n EmailAccountExportNotifier) NotifyAccountExport(ctx context.Context, export *AccountExport, downloadURL string) error {
+	to, err := n.Recipient(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("no email address for user %s", export.UserID)
+	}
+	body := fmt.Sprintf("The export of your CarbonScribe account data is ready.\n\n"+
+		"Download it here:\n%s\n\n"+
+		"The link and the archive expire on %s. After that you can request a new export from your profile settings.\n\n"+
+		"If you did not ask for this export, please contact us straight away.",
+		downloadURL, export.ExpiresAt.Format("2 January 2006 15:04 MST"))
+	return n.Sender.Send(ctx, to, "Your CarbonScribe data export is ready", body)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageBucketSize is the resolution of persisted API key usage
+const UsageBucketSize = time.Hour
+
+// RequestRecord describes one request authenticated with an API key
+type RequestRecord struct {
+	KeyID       uuid.UUID
+	UserID      uuid.UUID
+	Endpoint    string // route template, not the raw path
+	Method      string
+	StatusCode  int
+	Latency     time.Duration
+	RateLimited bool
+	At          time.Time
+}
+
+// UsageBucketKey identifies one row of the usage table
+type UsageBucketKey struct {
+	KeyID       uuid.UUID
+	BucketStart time.Time
+	Endpoint    string
+	Method      string
+	StatusCode  int
+}
+
+// UsageCounts are the counters accumulated for a bucket
+type UsageCounts struct {
+	UserID         uuid.UUID
+	Requests       int64
+	RateLimited    int64
+	TotalLatencyMs int64
+	MaxLatencyMs   int
+}
+
+// UsageBuffer aggregates requests in memory between flushes, so recording a
+// request does not cost a database write
+type UsageBuffer struct {
+	mu      sync.Mutex
+	pending map[UsageBucketKey]*UsageCounts
+}
+
+func NewUsageBuffer() *UsageBuffer {
+	return &UsageBuffer{pending: map[UsageBucketKey]*UsageCounts{}}
+}
+
+func (b *UsageBuffer) Add(r RequestRecord) {
+	latencyMs := int(r.Latency / time.Millisecond)
+	key := UsageBucketKey{
+		KeyID:       r.KeyID,
+		BucketStart: r.At.UTC().Truncate(UsageBucketSize),
+		Endpoint:    r.Endpoint,
+		Method:      r.Method,
+		StatusCode:  r.StatusCode,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := b.pending[key]
+	if counts == nil {
+		counts = &UsageCounts{UserID: r.UserID}
+		b.pending[key] = counts
+	}
+	counts.Requests++
+	if r.RateLimited {
+		counts.RateLimited++
+	}
+	counts.TotalLatencyMs += int64(latencyMs)
+	if latencyMs > counts.MaxLatencyMs {
+		counts.MaxLatencyMs = latencyMs
+	}
+}
+
+// Drain returns and clears everything buffered
+func (b *UsageBuffer) Drain() map[UsageBucketKey]UsageCounts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[UsageBucketKey]UsageCounts, len(b.pending))
+	for key, counts := range b.pending {
+		out[key] = *counts
+	}
+	b.pending = map[UsageBucketKey]*UsageCounts{}
+	return out
+}
+
+// Restore merges drained counters back, after a failed flush
+func (b *UsageBuffer) Restore(drained map[UsageBucketKey]UsageCounts) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, c := range drained {
+		counts := b.pending[key]
+		if counts == nil {
+			counts = &UsageCounts{UserID: c.UserID}
+			b.pending[key] = counts
+		}
+		counts.Requests += c.Requests
+		counts.RateLimited += c.RateLimited
+		counts.TotalLatencyMs += c.TotalLatencyMs
+		if c.MaxLatencyMs > counts.MaxLatencyMs {
+			counts.MaxLatencyMs = c.MaxLatencyMs
+		}
+	}
+}
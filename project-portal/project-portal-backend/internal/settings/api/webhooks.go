@@ -0,0 +1,86 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API key lifecycle events that webhooks can subscribe to
+const (
+	EventKeyCreated           = "api_key.created"
+	EventKeyRotated           = "api_key.rotated"
+	EventKeyRevoked           = "api_key.revoked"
+	EventKeyExpiring          = "api_key.expiring"
+	EventRateLimitThreshold   = "api_key.rate_limit_threshold"
+	EventUsageSpike           = "api_key.usage_spike"
+	EventAll                  = "*"
+	SignatureHeader           = "X-CarbonScribe-Signature"
+	defaultSignatureTolerance = 5 * time.Minute
+)
+
+var webhookEvents = map[string]struct{}{
+	EventKeyCreated:         {},
+	EventKeyRotated:         {},
+	EventKeyRevoked:         {},
+	EventKeyExpiring:        {},
+	EventRateLimitThreshold: {},
+	EventUsageSpike:         {},
+	EventAll:                {},
+}
+
+func ValidateWebhookEvent(event string) error {
+	if _, ok := webhookEvents[event]; !ok {
+		return fmt.Errorf("unsupported webhook event: %s", event)
+	}
+	return nil
+}
+
+// SignWebhook returns the signature header value for a payload. The
+// timestamp is signed with the body so a captured request cannot be
+// replayed later: "t=<unix seconds>,v1=<hex hmac-sha256>".
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, body)
+}
+
+// VerifyWebhookSignature checks a signature header produced by SignWebhook.
+// A zero tolerance uses five minutes.
+func VerifyWebhookSignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		tolerance = defaultSignatureTolerance
+	}
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("malformed webhook signature")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("webhook signature timestamp outside tolerance")
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookMAC(secret, ts, body))) {
+		return fmt.Errorf("webhook signature mismatch")
+	}
+	return nil
+}
+
+func webhookMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookSignatureRoundTrip(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"type":"api_key.created"}`)
+	header := SignWebhook("whsec_test", now, body)
+
+	if err := VerifyWebhookSignature("whsec_test", header, body, now.Add(time.Minute), 0); err != nil {
+		t.Fatalf("expected signature to verify: %v", err)
+	}
+	if err := VerifyWebhookSignature("whsec_other", header, body, now, 0); err == nil {
+		t.Fatalf("expected wrong secret rejected")
+	}
+	if err := VerifyWebhookSignature("whsec_test", header, []byte(`{"type":"api_key.revoked"}`), now, 0); err == nil {
+		t.Fatalf("expected tampered body rejected")
+	}
+	if err := VerifyWebhookSignature("whsec_test", header, body, now.Add(time.Hour), 0); err == nil {
+		t.Fatalf("expected stale timestamp rejected")
+	}
+}
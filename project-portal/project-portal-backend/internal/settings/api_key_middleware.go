@@ -0,0 +1,57 @@
+package settings
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	settingsapi "carbon-scribe/project-portal/project-portal-backend/internal/settings/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyAuth authenticates requests by their X-API-Key header, enforces the
+// key's rate limits and records every authenticated request, including rate
+// limit rejections, in the usage table. Handlers find the key owner under
+// the same context key as authRequired sets, and requirePermission checks the
+// key's scopes. The settings routes mount it through authenticate.
+func APIKeyAuth(service Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		result, err := service.ValidateAPIKeySecret(c.Request.Context(), ValidateAPIKeyRequest{Secret: c.GetHeader("X-API-Key")})
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to validate api key"})
+			return
+		}
+		if result.Key == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": result.Error})
+			return
+		}
+		record := settingsapi.RequestRecord{
+			KeyID:    result.Key.ID,
+			UserID:   result.Key.UserID,
+			Endpoint: c.FullPath(),
+			Method:   c.Request.Method,
+		}
+		if result.RateLimited {
+			c.Header("Retry-After", strconv.Itoa(result.RetryAfterSec))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": result.Error})
+			record.StatusCode = http.StatusTooManyRequests
+			record.RateLimited = true
+			record.Latency = time.Since(started)
+			service.RecordAPIKeyRequest(c.Request.Context(), record)
+			return
+		}
+		if !result.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": result.Error})
+			return
+		}
+		c.Set("settings_user_id", result.Key.UserID)
+		c.Set("api_key_id", result.Key.ID)
+		c.Set("api_key_scopes", result.Key.Scopes)
+		c.Next()
+		record.StatusCode = c.Writer.Status()
+		record.Latency = time.Since(started)
+		service.RecordAPIKeyRequest(c.Request.Context(), record)
+	}
+}
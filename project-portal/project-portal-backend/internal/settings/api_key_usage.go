@@ -0,0 +1,235 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	settingsapi "carbon-scribe/project-portal/project-portal-backend/internal/settings/api"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultUsageRange  = 7 * 24 * time.Hour
+	maxUsageRange      = 366 * 24 * time.Hour
+	maxHourlyUsageSpan = 31 * 24 * time.Hour
+	hourlyUsageCutoff  = 72 * time.Hour // longer ranges default to daily points
+	topEndpointsLimit  = 10
+)
+
+// RecordAPIKeyRequest buffers one API key request for the usage table. The
+// buffer is written by FlushAPIKeyUsage.
+func (s *service) RecordAPIKeyRequest(_ context.Context, record settingsapi.RequestRecord) {
+	if record.At.IsZero() {
+		record.At = time.Now().UTC()
+	}
+	if record.Endpoint == "" {
+		record.Endpoint = "unmatched"
+	}
+	s.usageBuffer.Add(record)
+}
+
+// FlushAPIKeyUsage writes buffered request counters to the usage table and
+// returns the number of buckets written. Counters are kept for the next
+// flush when the write fails.
+func (s *service) FlushAPIKeyUsage(ctx context.Context) (int, error) {
+	drained := s.usageBuffer.Drain()
+	if len(drained) == 0 {
+		return 0, nil
+	}
+	buckets := make([]APIKeyUsageBucket, 0, len(drained))
+	for key, counts := range drained {
+		buckets = append(buckets, APIKeyUsageBucket{
+			ID:             uuid.New(),
+			KeyID:          key.KeyID,
+			UserID:         counts.UserID,
+			BucketStart:    key.BucketStart,
+			Endpoint:       key.Endpoint,
+			Method:         key.Method,
+			StatusCode:     key.StatusCode,
+			RequestCount:   counts.Requests,
+			RateLimited:    counts.RateLimited,
+			TotalLatencyMs: counts.TotalLatencyMs,
+			MaxLatencyMs:   counts.MaxLatencyMs,
+		})
+	}
+	if err := s.repo.IncrementAPIKeyUsage(ctx, buckets); err != nil {
+		s.usageBuffer.Restore(drained)
+		return 0, err
+	}
+	return len(buckets), nil
+}
+
+func (s *service) GetAPIKeyUsage(ctx context.Context, userID, keyID uuid.UUID, rng APIKeyUsageRange) (*APIKeyUsageAnalytics, error) {
+	key, err := s.repo.GetAPIKey(ctx, userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	rng, err = normalizeUsageRange(rng, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	// Include what this replica has not written yet
+	if _, err := s.FlushAPIKeyUsage(ctx); err != nil {
+		return nil, err
+	}
+	buckets, err := s.repo.ListAPIKeyUsage(ctx, key.ID, rng.From, rng.To)
+	if err != nil {
+		return nil, err
+	}
+	analytics := s.apiKeyUsageSummary(key)
+	summarizeAPIKeyUsage(analytics, buckets, rng)
+	return analytics, nil
+}
+
+// apiKeyUsageSummary returns the lifetime counters kept on the key itself
+func (s *service) apiKeyUsageSummary(key *APIKey) *APIKeyUsageAnalytics {
+	analytics := &APIKeyUsageAnalytics{
+		KeyID:              key.ID,
+		LastUsedAt:         key.LastUsedAt,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		RateLimitPerDay:    key.RateLimitPerDay,
+	}
+	if key.Metadata != nil {
+		analytics.RequestCountTotal = int64(jsonNumberToInt(key.Metadata["usage_total"]))
+		usageDay := stringValue(key.Metadata["usage_day"])
+		if usageDay == time.Now().UTC().Format("2006-01-02") {
+			analytics.RequestCountToday = int64(jsonNumberToInt(key.Metadata["usage_today"]))
+		}
+		if ts, ok := parseMetadataTime(key.Metadata["last_rate_limit_exceeded_at"]); ok {
+			analytics.LastRateLimitExceeded = &ts
+		}
+	}
+	if _, dayCount, ok := s.usageTracker.Snapshot(key.ID); ok {
+		analytics.RequestCountToday = int64(dayCount)
+	}
+	return analytics
+}
+
+func normalizeUsageRange(rng APIKeyUsageRange, now time.Time) (APIKeyUsageRange, error) {
+	if rng.To.IsZero() {
+		rng.To = now
+	}
+	if rng.From.IsZero() {
+		rng.From = rng.To.Add(-defaultUsageRange)
+	}
+	rng.From, rng.To = rng.From.UTC(), rng.To.UTC()
+	span := rng.To.Sub(rng.From)
+	if span <= 0 {
+		return rng, fmt.Errorf("from must be before to")
+	}
+	if span > maxUsageRange {
+		return rng, fmt.Errorf("range must not exceed 366 days")
+	}
+	switch rng.Granularity {
+	case "":
+		rng.Granularity = "day"
+		if span <= hourlyUsageCutoff {
+			rng.Granularity = "hour"
+		}
+	case "hour":
+		if span > maxHourlyUsageSpan {
+			return rng, fmt.Errorf("hourly granularity is limited to 31 days")
+		}
+	case "day":
+	default:
+		return rng, fmt.Errorf("granularity must be hour or day")
+	}
+	// Buckets are hourly, so the range snaps to whole hours
+	rng.From = rng.From.Truncate(time.Hour)
+	if !rng.To.Equal(rng.To.Truncate(time.Hour)) {
+		rng.To = rng.To.Truncate(time.Hour).Add(time.Hour)
+	}
+	return rng, nil
+}
+
+func summarizeAPIKeyUsage(analytics *APIKeyUsageAnalytics, buckets []APIKeyUsageBucket, rng APIKeyUsageRange) {
+	analytics.From, analytics.To, analytics.Granularity = rng.From, rng.To, rng.Granularity
+	analytics.StatusClasses = map[string]int64{}
+
+	step := time.Hour
+	if rng.Granularity == "day" {
+		step = 24 * time.Hour
+	}
+	start := rng.From.Truncate(step)
+	points := []APIKeyUsagePoint{}
+	for t := start; t.Before(rng.To); t = t.Add(step) {
+		points = append(points, APIKeyUsagePoint{BucketStart: t})
+	}
+	pointLatency := make([]int64, len(points))
+
+	type endpointKey struct{ method, endpoint string }
+	endpoints := map[endpointKey]*APIKeyEndpointUsage{}
+	endpointLatency := map[endpointKey]int64{}
+	var latencySum int64
+
+	for _, b := range buckets {
+		isError := b.StatusCode >= 400
+		analytics.Requests += b.RequestCount
+		analytics.RateLimitRejections += b.RateLimited
+		analytics.StatusClasses[fmt.Sprintf("%dxx", b.StatusCode/100)] += b.RequestCount
+		latencySum += b.TotalLatencyMs
+		if isError {
+			analytics.Errors += b.RequestCount
+		}
+
+		if i := int(b.BucketStart.Sub(start) / step); i >= 0 && i < len(points) {
+			points[i].Requests += b.RequestCount
+			points[i].RateLimited += b.RateLimited
+			pointLatency[i] += b.TotalLatencyMs
+			if isError {
+				points[i].Errors += b.RequestCount
+			}
+		}
+
+		ek := endpointKey{b.Method, b.Endpoint}
+		e := endpoints[ek]
+		if e == nil {
+			e = &APIKeyEndpointUsage{Method: b.Method, Endpoint: b.Endpoint}
+			endpoints[ek] = e
+		}
+		e.Requests += b.RequestCount
+		endpointLatency[ek] += b.TotalLatencyMs
+		if isError {
+			e.Errors += b.RequestCount
+		}
+		if b.MaxLatencyMs > e.MaxLatencyMs {
+			e.MaxLatencyMs = b.MaxLatencyMs
+		}
+	}
+
+	for i := range points {
+		if points[i].Requests > 0 {
+			points[i].AvgLatencyMs = float64(pointLatency[i]) / float64(points[i].Requests)
+		}
+	}
+	analytics.TimeSeries = points
+	if analytics.Requests > 0 {
+		analytics.ErrorRate = float64(analytics.Errors) / float64(analytics.Requests)
+		analytics.AvgLatencyMs = float64(latencySum) / float64(analytics.Requests)
+	}
+
+	top := make([]APIKeyEndpointUsage, 0, len(endpoints))
+	for ek, e := range endpoints {
+		if e.Requests > 0 {
+			e.ErrorRate = float64(e.Errors) / float64(e.Requests)
+			e.AvgLatencyMs = float64(endpointLatency[ek]) / float64(e.Requests)
+		}
+		top = append(top, *e)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Requests != top[j].Requests {
+			return top[i].Requests > top[j].Requests
+		}
+		if top[i].Endpoint != top[j].Endpoint {
+			return top[i].Endpoint < top[j].Endpoint
+		}
+		return top[i].Method < top[j].Method
+	})
+	if len(top) > topEndpointsLimit {
+		top = top[:topEndpointsLimit]
+	}
+	analytics.TopEndpoints = top
+}
@@ -0,0 +1,383 @@
+package settings
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	settingsapi "carbon-scribe/project-portal/project-portal-backend/internal/settings/api"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	webhookBatchSize        = 100
+	webhookLease            = 2 * time.Minute
+	webhookResponseLimit    = 1024
+	webhookDeliveryLogLimit = 100
+	rateLimitWarningPct     = 80
+	usageSpikeFactor        = 3
+	usageSpikeMinRequests   = 100
+	usageSpikeBaselineHours = 24
+	defaultKeyExpiryWarning = 7 * 24 * time.Hour
+)
+
+// webhookRetrySchedule is the wait before each retry; a delivery fails for
+// good once it is exhausted
+var webhookRetrySchedule = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+
+// ensureWebhookSecret generates the key's signing secret on first use and
+// returns it in plain text only then
+func (s *service) ensureWebhookSecret(key *APIKey) (string, error) {
+	if key.WebhookSecret != "" {
+		return "", nil
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := "whsec_" + hex.EncodeToString(raw)
+	encrypted, err := s.vault.EncryptString(secret)
+	if err != nil {
+		return "", err
+	}
+	key.WebhookSecret = encrypted
+	return secret, nil
+}
+
+func apiKeyWebhookSubscriptions(metadata datatypes.JSONMap) []APIKeyWebhookSubscription {
+	raw, ok := metadata["webhooks"]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var subs []APIKeyWebhookSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil
+	}
+	return subs
+}
+
+// emitAPIKeyEvent queues a delivery for every active subscription of the
+// key that matches the event. Failures are logged; they never fail the
+// operation that raised the event.
+func (s *service) emitAPIKeyEvent(ctx context.Context, key *APIKey, event string, data map[string]interface{}) {
+	var targets []string
+	for _, sub := range apiKeyWebhookSubscriptions(key.Metadata) {
+		if sub.IsActive && (sub.Event == event || sub.Event == settingsapi.EventAll) {
+			targets = append(targets, sub.TargetURL)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	eventID := uuid.New()
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["api_key"] = map[string]interface{}{
+		"id":            key.ID,
+		"name":          key.Name,
+		"key_prefix":    key.KeyPrefix,
+		"key_last_four": key.KeyLastFour,
+		"scopes":        []string(key.Scopes),
+		"expires_at":    key.ExpiresAt,
+		"is_active":     key.IsActive,
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         eventID,
+		"type":       event,
+		"created_at": now,
+		"data":       data,
+	})
+	if err != nil {
+		log.Printf("settings: webhook %s for key %s: %v", event, key.ID, err)
+		return
+	}
+	for _, target := range targets {
+		delivery := &APIKeyWebhookDelivery{
+			ID:            uuid.New(),
+			KeyID:         key.ID,
+			UserID:        key.UserID,
+			EventID:       eventID,
+			EventType:     event,
+			TargetURL:     target,
+			Payload:       datatypes.JSON(body),
+			Status:        "pending",
+			NextAttemptAt: &now,
+		}
+		if err := s.repo.CreateAPIKeyWebhookDelivery(ctx, delivery); err != nil {
+			log.Printf("settings: webhook %s for key %s: failed to queue: %v", event, key.ID, err)
+		}
+	}
+}
+
+// ProcessAPIKeyWebhooks raises the scheduled events, expiring keys and usage
+// spikes, and then sends every delivery that is due
+func (s *service) ProcessAPIKeyWebhooks(ctx context.Context) (*APIKeyWebhookRunResult, error) {
+	result := &APIKeyWebhookRunResult{}
+	now := time.Now().UTC()
+	if err := s.notifyExpiringAPIKeys(ctx, now, result); err != nil {
+		return result, err
+	}
+	if err := s.detectAPIKeyUsageSpikes(ctx, now, result); err != nil {
+		return result, err
+	}
+	for {
+		due, err := s.repo.ListDueAPIKeyWebhookDeliveries(ctx, now, webhookBatchSize)
+		if err != nil {
+			return result, err
+		}
+		sent := 0
+		for i := range due {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			delivery := &due[i]
+			claimed, err := s.repo.ClaimAPIKeyWebhookDelivery(ctx, delivery.ID, now, now.Add(webhookLease))
+			if err != nil {
+				return result, err
+			}
+			if !claimed {
+				continue
+			}
+			sent++
+			s.deliverAPIKeyWebhook(ctx, delivery, result)
+		}
+		if len(due) < webhookBatchSize || sent == 0 {
+			return result, nil
+		}
+	}
+}
+
+func (s *service) notifyExpiringAPIKeys(ctx context.Context, now time.Time, result *APIKeyWebhookRunResult) error {
+	window := s.cfg.APIKeyExpiryWarning
+	if window <= 0 {
+		window = defaultKeyExpiryWarning
+	}
+	keys, err := s.repo.ListAPIKeysExpiringBetween(ctx, now, now.Add(window))
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		key := &keys[i]
+		expiresAt := key.ExpiresAt.UTC().Format(time.RFC3339)
+		if stringValue(key.Metadata["expiry_warning_for"]) == expiresAt {
+			continue
+		}
+		key.Metadata = ensureJSONMap(key.Metadata)
+		key.Metadata["expiry_warning_for"] = expiresAt
+		if err := s.repo.SaveAPIKey(ctx, key); err != nil {
+			return err
+		}
+		s.emitAPIKeyEvent(ctx, key, settingsapi.EventKeyExpiring, map[string]interface{}{
+			"expires_at":     key.ExpiresAt,
+			"days_remaining": int(key.ExpiresAt.Sub(now).Hours() / 24),
+		})
+		result.ExpiringNotified++
+	}
+	return nil
+}
+
+// detectAPIKeyUsageSpikes compares each key's last complete hour with its
+// hourly average over the day before
+func (s *service) detectAPIKeyUsageSpikes(ctx context.Context, now time.Time, result *APIKeyWebhookRunResult) error {
+	lastHour := now.Truncate(time.Hour).Add(-time.Hour)
+	from := lastHour.Add(-usageSpikeBaselineHours * time.Hour)
+	rows, err := s.repo.ListAPIKeyHourlyUsage(ctx, from, lastHour.Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	type keyUsage struct {
+		userID   uuid.UUID
+		last     int64
+		baseline int64
+	}
+	usage := map[uuid.UUID]*keyUsage{}
+	for _, row := range rows {
+		u := usage[row.KeyID]
+		if u == nil {
+			u = &keyUsage{userID: row.UserID}
+			usage[row.KeyID] = u
+		}
+		if row.BucketStart.Equal(lastHour) {
+			u.last += row.Requests
+		} else {
+			u.baseline += row.Requests
+		}
+	}
+	for keyID, u := range usage {
+		average := float64(u.baseline) / usageSpikeBaselineHours
+		if u.last < usageSpikeMinRequests || float64(u.last) < usageSpikeFactor*average {
+			continue
+		}
+		key, err := s.repo.GetAPIKey(ctx, u.userID, keyID)
+		if err != nil {
+			log.Printf("settings: usage spike for key %s: %v", keyID, err)
+			continue
+		}
+		hour := lastHour.Format(time.RFC3339)
+		if stringValue(key.Metadata["usage_spike_hour"]) == hour {
+			continue
+		}
+		key.Metadata = ensureJSONMap(key.Metadata)
+		key.Metadata["usage_spike_hour"] = hour
+		if err := s.repo.SaveAPIKey(ctx, key); err != nil {
+			return err
+		}
+		s.emitAPIKeyEvent(ctx, key, settingsapi.EventUsageSpike, map[string]interface{}{
+			"hour_start":              lastHour,
+			"requests":                u.last,
+			"baseline_hourly_average": average,
+		})
+		result.SpikesDetected++
+	}
+	return nil
+}
+
+// checkRateLimitThreshold raises a rate limit event the first time in a UTC
+// day that a key passes the warning share of its daily limit, and the first
+// time it is rejected. Markers are set in key metadata for the caller to save.
+func (s *service) checkRateLimitThreshold(ctx context.Context, key *APIKey, decision settingsapi.RateLimitDecision, now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	level, marker := "", ""
+	switch {
+	case !decision.Allowed:
+		level, marker = "exceeded", "rate_limit_exceeded_day"
+	case key.RateLimitPerDay > 0 && decision.DayCount*100 >= key.RateLimitPerDay*rateLimitWarningPct:
+		level, marker = "warning", "rate_limit_warning_day"
+	default:
+		return
+	}
+	key.Metadata = ensureJSONMap(key.Metadata)
+	if stringValue(key.Metadata[marker]) == day {
+		return
+	}
+	key.Metadata[marker] = day
+	s.emitAPIKeyEvent(ctx, key, settingsapi.EventRateLimitThreshold, map[string]interface{}{
+		"level":                 level,
+		"threshold_pct":         rateLimitWarningPct,
+		"day_count":             decision.DayCount,
+		"minute_count":          decision.MinuteCount,
+		"rate_limit_per_day":    key.RateLimitPerDay,
+		"rate_limit_per_minute": key.RateLimitPerMinute,
+	})
+}
+
+func (s *service) deliverAPIKeyWebhook(ctx context.Context, delivery *APIKeyWebhookDelivery, result *APIKeyWebhookRunResult) {
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	status, body, err := s.postAPIKeyWebhook(ctx, delivery, now)
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = "succeeded"
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+		result.Delivered++
+	default:
+		if err != nil {
+			delivery.LastError = err.Error()
+		} else {
+			delivery.LastError = fmt.Sprintf("unexpected status %d", status)
+		}
+		if delivery.Attempts > len(webhookRetrySchedule) {
+			delivery.Status = "failed"
+			delivery.NextAttemptAt = nil
+			result.Failed++
+		} else {
+			next := now.Add(webhookRetrySchedule[delivery.Attempts-1])
+			delivery.NextAttemptAt = &next
+			result.Retrying++
+		}
+	}
+	if err := s.repo.SaveAPIKeyWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("settings: webhook delivery %s: failed to save: %v", delivery.ID, err)
+	}
+}
+
+func (s *service) postAPIKeyWebhook(ctx context.Context, delivery *APIKeyWebhookDelivery, now time.Time) (int, string, error) {
+	key, err := s.repo.GetAPIKey(ctx, delivery.UserID, delivery.KeyID)
+	if err != nil {
+		return 0, "", fmt.Errorf("api key not found")
+	}
+	if key.WebhookSecret == "" {
+		return 0, "", fmt.Errorf("api key has no webhook signing secret")
+	}
+	secret, err := s.vault.DecryptString(key.WebhookSecret)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to decrypt webhook signing secret")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.TargetURL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CarbonScribe-Webhooks/1.0")
+	req.Header.Set("X-CarbonScribe-Event", delivery.EventType)
+	req.Header.Set("X-CarbonScribe-Delivery", delivery.ID.String())
+	req.Header.Set(settingsapi.SignatureHeader, settingsapi.SignWebhook(secret, now, delivery.Payload))
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	return resp.StatusCode, strings.ToValidUTF8(string(body), ""), nil
+}
+
+func (s *service) ListAPIKeyWebhookDeliveries(ctx context.Context, userID, keyID uuid.UUID) ([]APIKeyWebhookDelivery, error) {
+	if _, err := s.repo.GetAPIKey(ctx, userID, keyID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAPIKeyWebhookDeliveries(ctx, keyID, webhookDeliveryLogLimit)
+}
+
+// ReplayAPIKeyWebhookDelivery queues the payload of an earlier delivery
+// again, whatever its outcome was. The event id is kept so receivers can
+// deduplicate.
+func (s *service) ReplayAPIKeyWebhookDelivery(ctx context.Context, userID, keyID, deliveryID uuid.UUID) (*APIKeyWebhookDelivery, error) {
+	if _, err := s.repo.GetAPIKey(ctx, userID, keyID); err != nil {
+		return nil, err
+	}
+	original, err := s.repo.GetAPIKeyWebhookDelivery(ctx, keyID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.Status == "pending" {
+		return nil, fmt.Errorf("delivery is still pending")
+	}
+	now := time.Now().UTC()
+	replay := &APIKeyWebhookDelivery{
+		ID:            uuid.New(),
+		KeyID:         original.KeyID,
+		UserID:        original.UserID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		TargetURL:     original.TargetURL,
+		Payload:       original.Payload,
+		Status:        "pending",
+		NextAttemptAt: &now,
+		ReplayOf:      &original.ID,
+	}
+	if err := s.repo.CreateAPIKeyWebhookDelivery(ctx, replay); err != nil {
+		return nil, err
+	}
+	s.audit("api_key.webhooks.replay", userID, map[string]interface{}{"key_id": keyID, "delivery_id": deliveryID, "replay_id": replay.ID})
+	return replay, nil
+}
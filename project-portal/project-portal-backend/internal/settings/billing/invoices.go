@@ -1,7 +1,30 @@
 package billing
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
+
+// Invoice kinds
+const (
+	KindInvoice    = "invoice"
+	KindCreditNote = "credit_note"
+)
+
+// DefaultPaymentTermsDays is how long customers have to pay an invoice
+const DefaultPaymentTermsDays = 14
 
 func InvoiceNumber(prefix string, seq int) string {
 	return fmt.Sprintf("%s-%04d", prefix, seq)
 }
+
+// NumberSeries names the sequence an invoice number is drawn from. Invoices
+// and credit notes are numbered separately and restart every year, giving
+// numbers like INV-2026-0001 and CN-2026-0001.
+func NumberSeries(kind string, issuedAt time.Time) string {
+	prefix := "INV"
+	if kind == KindCreditNote {
+		prefix = "CN"
+	}
+	return fmt.Sprintf("%s-%d", prefix, issuedAt.UTC().Year())
+}
@@ -0,0 +1,180 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Features a plan can grant
+const (
+	FeatureAPIAccess        = "api_access"
+	FeatureWebhooks         = "webhooks"
+	FeatureIntegrations     = "integrations"
+	FeatureScheduledReports = "scheduled_reports"
+	FeatureCustomReports    = "custom_reports"
+	FeatureAuditExport      = "audit_export"
+	FeaturePrioritySupport  = "priority_support"
+	FeatureSSO              = "sso"
+)
+
+// Quotas a plan limits. Usage for each is kept under the same name in the
+// subscription usage metrics.
+const (
+	QuotaProjects        = "projects"
+	QuotaStorageMB       = "storage_used_mb"
+	QuotaAPICalls        = "api_calls"
+	QuotaReportSchedules = "report_schedules"
+)
+
+// Unlimited is the quota value of a limit that does not apply
+const Unlimited int64 = -1
+
+// MeteredPrice bills usage of a metric beyond the plan quota. Quotas with a
+// metered price are soft limits.
+type MeteredPrice struct {
+	UnitSize  int64  `json:"unit_size"`  // usage per billed unit
+	UnitPrice int64  `json:"unit_price"` // cents per unit
+	Unit      string `json:"unit"`       // label on invoices
+}
+
+type Plan struct {
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	Rank      int                     `json:"rank"` // higher ranks are upgrades
+	Currency  string                  `json:"currency"`
+	Prices    map[string]int64        `json:"prices"` // cents per billing cycle
+	Features  []string                `json:"features"`
+	Quotas    map[string]int64        `json:"quotas"`
+	TrialDays int                     `json:"trial_days"`
+	Metered   map[string]MeteredPrice `json:"metered,omitempty"`
+}
+
+func (p Plan) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Quota returns the limit for a quota; plans without an entry are unlimited
+func (p Plan) Quota(name string) int64 {
+	limit, ok := p.Quotas[name]
+	if !ok {
+		return Unlimited
+	}
+	return limit
+}
+
+func (p Plan) Price(cycle string) (int64, error) {
+	price, ok := p.Prices[cycle]
+	if !ok {
+		return 0, fmt.Errorf("plan %s has no %s price", p.ID, cycle)
+	}
+	return price, nil
+}
+
+// SoftLimit reports whether usage may go over the quota and is billed instead
+func (p Plan) SoftLimit(quota string) bool {
+	_, ok := p.Metered[quota]
+	return ok
+}
+
+func (p Plan) IsFree() bool {
+	for _, price := range p.Prices {
+		if price > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalog is the set of plans customers can subscribe to
+type Catalog struct {
+	plans map[string]Plan
+}
+
+func NewCatalog(plans ...Plan) (*Catalog, error) {
+	c := &Catalog{plans: map[string]Plan{}}
+	for _, p := range plans {
+		if p.ID == "" || len(p.Prices) == 0 {
+			return nil, fmt.Errorf("plan %q needs an id and prices", p.ID)
+		}
+		for cycle := range p.Prices {
+			if err := ValidateBillingCycle(cycle); err != nil {
+				return nil, fmt.Errorf("plan %s: %w", p.ID, err)
+			}
+		}
+		if _, dup := c.plans[p.ID]; dup {
+			return nil, fmt.Errorf("duplicate plan %s", p.ID)
+		}
+		c.plans[p.ID] = p
+	}
+	return c, nil
+}
+
+func (c *Catalog) Get(id string) (Plan, bool) {
+	p, ok := c.plans[id]
+	return p, ok
+}
+
+// List returns the plans ordered by rank
+func (c *Catalog) List() []Plan {
+	out := make([]Plan, 0, len(c.plans))
+	for _, p := range c.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rank < out[j].Rank })
+	return out
+}
+
+// DefaultCatalog is the standard plan line-up
+func DefaultCatalog() *Catalog {
+	c, err := NewCatalog(DefaultPlans()...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func DefaultPlans() []Plan {
+	return []Plan{
+		{
+			ID: "free", Name: "Free", Rank: 0, Currency: "USD",
+			Prices:   map[string]int64{CycleMonthly: 0, CycleYearly: 0},
+			Features: []string{FeatureAPIAccess},
+			Quotas:   map[string]int64{QuotaProjects: 3, QuotaStorageMB: 1024, QuotaAPICalls: 10000, QuotaReportSchedules: 1},
+		},
+		{
+			ID: "basic", Name: "Basic", Rank: 1, Currency: "USD", TrialDays: 14,
+			Prices:   map[string]int64{CycleMonthly: 2900, CycleYearly: 29000},
+			Features: []string{FeatureAPIAccess, FeatureWebhooks, FeatureIntegrations, FeatureScheduledReports},
+			Quotas:   map[string]int64{QuotaProjects: 10, QuotaStorageMB: 10240, QuotaAPICalls: 100000, QuotaReportSchedules: 5},
+			Metered:  defaultMeteredPrices(),
+		},
+		{
+			ID: "pro", Name: "Pro", Rank: 2, Currency: "USD", TrialDays: 14,
+			Prices: map[string]int64{CycleMonthly: 9900, CycleYearly: 99000},
+			Features: []string{FeatureAPIAccess, FeatureWebhooks, FeatureIntegrations, FeatureScheduledReports,
+				FeatureCustomReports, FeatureAuditExport, FeaturePrioritySupport},
+			Quotas:  map[string]int64{QuotaProjects: 50, QuotaStorageMB: 102400, QuotaAPICalls: 1000000, QuotaReportSchedules: 25},
+			Metered: defaultMeteredPrices(),
+		},
+		{
+			ID: "enterprise", Name: "Enterprise", Rank: 3, Currency: "USD",
+			Prices: map[string]int64{CycleMonthly: 49900, CycleYearly: 499000},
+			Features: []string{FeatureAPIAccess, FeatureWebhooks, FeatureIntegrations, FeatureScheduledReports,
+				FeatureCustomReports, FeatureAuditExport, FeaturePrioritySupport, FeatureSSO},
+			Quotas: map[string]int64{QuotaProjects: Unlimited, QuotaStorageMB: Unlimited, QuotaAPICalls: Unlimited, QuotaReportSchedules: Unlimited},
+		},
+	}
+}
+
+// defaultMeteredPrices bills API calls and storage over quota on paid plans
+func defaultMeteredPrices() map[string]MeteredPrice {
+	return map[string]MeteredPrice{
+		QuotaAPICalls:  {UnitSize: 10000, UnitPrice: 100, Unit: "10k API calls"},
+		QuotaStorageMB: {UnitSize: 1024, UnitPrice: 50, Unit: "GB of storage"},
+	}
+}
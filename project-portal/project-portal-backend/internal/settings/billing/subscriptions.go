@@ -1,20 +1,87 @@
 package billing
 
-type Plan struct {
-	ID       string   `json:"id"`
-	Name     string   `json:"name"`
-	Features []string `json:"features"`
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	CycleMonthly = "monthly"
+	CycleYearly  = "yearly"
+)
+
+// ValidateBillingCycle accepts the cycles plans are priced for
+func ValidateBillingCycle(cycle string) error {
+	switch cycle {
+	case CycleMonthly, CycleYearly:
+		return nil
+	default:
+		return fmt.Errorf("billing_cycle must be monthly or yearly")
+	}
 }
 
-func DefaultPlans() []Plan {
-	return []Plan{
-		{ID: "free", Name: "Free"},
-		{ID: "basic", Name: "Basic"},
-		{ID: "pro", Name: "Pro"},
-		{ID: "enterprise", Name: "Enterprise"},
+// PeriodEnd returns the end of a billing period starting at start
+func PeriodEnd(start time.Time, cycle string) time.Time {
+	if cycle == CycleYearly {
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// Proration is the settlement of a plan change part way through a period.
+// Amounts are in cents; a negative Net is owed to the customer.
+type Proration struct {
+	UnusedFraction float64   `json:"unused_fraction"`
+	Credit         int64     `json:"credit"`
+	Charge         int64     `json:"charge"`
+	Net            int64     `json:"net"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+}
+
+// Prorate credits the unused part of the current period at the old price.
+// When the billing cycle is unchanged the new plan is charged for the same
+// remainder and the period is kept; a cycle change starts a new full period
+// at now. paid is false for periods that were not charged, such as trials.
+func Prorate(from Plan, fromCycle string, to Plan, toCycle string, periodStart, periodEnd, now time.Time, paid bool) (Proration, error) {
+	fromPrice, err := from.Price(fromCycle)
+	if err != nil {
+		return Proration{}, err
+	}
+	toPrice, err := to.Price(toCycle)
+	if err != nil {
+		return Proration{}, err
+	}
+	p := Proration{PeriodStart: periodStart, PeriodEnd: periodEnd}
+	if total := periodEnd.Sub(periodStart); total > 0 && now.Before(periodEnd) {
+		remaining := periodEnd.Sub(now)
+		if remaining > total {
+			remaining = total
+		}
+		p.UnusedFraction = float64(remaining) / float64(total)
 	}
+	if paid {
+		p.Credit = roundCents(float64(fromPrice) * p.UnusedFraction)
+	}
+	if fromCycle == toCycle && p.UnusedFraction > 0 {
+		p.Charge = roundCents(float64(toPrice) * p.UnusedFraction)
+	} else {
+		p.Charge = toPrice
+		p.PeriodStart = now
+		p.PeriodEnd = PeriodEnd(now, toCycle)
+	}
+	p.Net = p.Charge - p.Credit
+	return p, nil
+}
+
+func roundCents(v float64) int64 {
+	return int64(math.Round(v))
 }
 
+// NextDunningStatus moves a subscription one step through dunning:
+// active, past_due, unpaid, canceled. A successful payment or a new
+// payment method returns a subscription in dunning to active.
 func NextDunningStatus(current string, paymentMethodUpdated bool) string {
 	if paymentMethodUpdated && (current == "past_due" || current == "unpaid") {
 		return "active"
@@ -24,7 +91,32 @@ func NextDunningStatus(current string, paymentMethodUpdated bool) string {
 		return "past_due"
 	case "past_due":
 		return "unpaid"
+	case "unpaid":
+		return "canceled"
 	default:
 		return current
 	}
 }
+
+// DunningPolicy schedules charge retries for invoices that failed to
+// collect
+type DunningPolicy struct {
+	RetryDelays []time.Duration // wait before each retry, counted from the failure before it
+	CancelAfter time.Duration   // how long a subscription stays unpaid before it is canceled
+}
+
+// DefaultDunningPolicy retries after 3, 5 and 7 days and cancels two weeks
+// after the last retry fails
+func DefaultDunningPolicy() DunningPolicy {
+	day := 24 * time.Hour
+	return DunningPolicy{RetryDelays: []time.Duration{3 * day, 5 * day, 7 * day}, CancelAfter: 14 * day}
+}
+
+// NextRetry returns when to retry a charge that has failed failedAttempts
+// times, the last at failedAt. It returns false once retries are exhausted.
+func (p DunningPolicy) NextRetry(failedAttempts int, failedAt time.Time) (time.Time, bool) {
+	if failedAttempts < 1 || failedAttempts > len(p.RetryDelays) {
+		return time.Time{}, false
+	}
+	return failedAt.Add(p.RetryDelays[failedAttempts-1]), true
+}
@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProrate(t *testing.T) {
+	catalog := DefaultCatalog()
+	basic, _ := catalog.Get("basic")
+	pro, _ := catalog.Get("pro")
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := PeriodEnd(start, CycleMonthly)
+	mid := start.Add(end.Sub(start) / 2)
+
+	up, err := Prorate(basic, CycleMonthly, pro, CycleMonthly, start, end, mid, true)
+	if err != nil {
+		t.Fatalf("Prorate error: %v", err)
+	}
+	if up.Credit != 1450 || up.Charge != 4950 || up.Net != 3500 || !up.PeriodEnd.Equal(end) {
+		t.Fatalf("unexpected upgrade proration %+v", up)
+	}
+
+	down, _ := Prorate(pro, CycleMonthly, basic, CycleMonthly, start, end, mid, true)
+	if down.Net != -3500 {
+		t.Fatalf("expected downgrade credit of 3500, got %+v", down)
+	}
+
+	// An unpaid period earns no credit, and a cycle change starts over
+	yearly, _ := Prorate(basic, CycleMonthly, basic, CycleYearly, start, end, mid, false)
+	if yearly.Credit != 0 || yearly.Charge != 29000 || !yearly.PeriodStart.Equal(mid) || !yearly.PeriodEnd.Equal(mid.AddDate(1, 0, 0)) {
+		t.Fatalf("unexpected cycle change proration %+v", yearly)
+	}
+}
+
+func TestUsageChargeAndQuotaLevel(t *testing.T) {
+	basic, _ := DefaultCatalog().Get("basic")
+	if units, cents := basic.UsageCharge(QuotaAPICalls, 100000); units != 0 || cents != 0 {
+		t.Fatalf("expected usage within quota to be free, got %d %d", units, cents)
+	}
+	if units, cents := basic.UsageCharge(QuotaAPICalls, 100001); units != 1 || cents != 100 {
+		t.Fatalf("expected one started unit billed, got %d %d", units, cents)
+	}
+	if units, _ := basic.UsageCharge(QuotaProjects, 50); units != 0 {
+		t.Fatalf("expected unmetered quota not to bill")
+	}
+	if QuotaLevel(79, 100) != "" || QuotaLevel(80, 100) != WarningApproaching || QuotaLevel(100, 100) != WarningExceeded || QuotaLevel(5, Unlimited) != "" {
+		t.Fatalf("unexpected quota levels")
+	}
+}
+
+func TestTaxTableLookup(t *testing.T) {
+	rates := DefaultTaxRates()
+	if r := rates.Lookup("ca", "on"); r.Jurisdiction != "CA-ON" || r.Tax(10000) != 1300 || r.Label() != "HST 13% (CA-ON)" {
+		t.Fatalf("expected provincial rate, got %+v", r)
+	}
+	if r := rates.Lookup("CA", "BC"); r.Jurisdiction != "CA" || r.BasisPoints != 500 {
+		t.Fatalf("expected national rate fallback, got %+v", r)
+	}
+	if r := rates.Lookup("US", "TX"); r.BasisPoints != 0 || r.Tax(10000) != 0 || r.Label() != "" {
+		t.Fatalf("expected untaxed jurisdiction, got %+v", r)
+	}
+	if r := rates.Lookup("NG", ""); r.Tax(1999) != 150 {
+		t.Fatalf("expected 7.5%% of 19.99 rounded to 1.50, got %d", r.Tax(1999))
+	}
+}
+
+func TestDunningPolicyRetries(t *testing.T) {
+	policy := DefaultDunningPolicy()
+	failed := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	for attempts, days := range map[int]int{1: 3, 2: 5, 3: 7} {
+		next, ok := policy.NextRetry(attempts, failed)
+		if !ok || !next.Equal(failed.AddDate(0, 0, days)) {
+			t.Fatalf("attempt %d: expected retry after %d days, got %s %v", attempts, days, next, ok)
+		}
+	}
+	if _, ok := policy.NextRetry(4, failed); ok {
+		t.Fatalf("expected retries to be exhausted")
+	}
+	if NextDunningStatus("past_due", false) != "unpaid" || NextDunningStatus("unpaid", false) != "canceled" || NextDunningStatus("unpaid", true) != "active" {
+		t.Fatalf("unexpected dunning transitions")
+	}
+}
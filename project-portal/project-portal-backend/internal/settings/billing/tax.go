@@ -0,0 +1,87 @@
+package billing
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TaxRate is the tax charged in one jurisdiction. Jurisdictions are ISO
+// country codes, optionally followed by a subdivision, e.g. "DE" or "CA-ON".
+type TaxRate struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Name         string `json:"name"`
+	BasisPoints  int64  `json:"basis_points"` // 1900 = 19%
+}
+
+// Tax returns the tax on an amount in cents, rounded half away from zero
+func (r TaxRate) Tax(cents int64) int64 {
+	if r.BasisPoints == 0 {
+		return 0
+	}
+	tax := cents * r.BasisPoints
+	if tax < 0 {
+		return -((-tax + 5000) / 10000)
+	}
+	return (tax + 5000) / 10000
+}
+
+// Label is the tax line caption printed on invoices
+func (r TaxRate) Label() string {
+	if r.BasisPoints == 0 {
+		return ""
+	}
+	pct := strconv.FormatFloat(float64(r.BasisPoints)/100, 'f', -1, 64)
+	return strings.TrimSpace(r.Name + " " + pct + "% (" + r.Jurisdiction + ")")
+}
+
+// TaxTable resolves the rate for a customer's address
+type TaxTable struct {
+	rates map[string]TaxRate
+}
+
+func NewTaxTable(rates ...TaxRate) *TaxTable {
+	t := &TaxTable{rates: map[string]TaxRate{}}
+	for _, r := range rates {
+		r.Jurisdiction = strings.ToUpper(strings.TrimSpace(r.Jurisdiction))
+		t.rates[r.Jurisdiction] = r
+	}
+	return t
+}
+
+// Lookup prefers a rate for the country subdivision over the national rate.
+// Unknown jurisdictions are not taxed.
+func (t *TaxTable) Lookup(country, region string) TaxRate {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if country == "" {
+		return TaxRate{}
+	}
+	if region != "" {
+		if r, ok := t.rates[country+"-"+region]; ok {
+			return r
+		}
+	}
+	if r, ok := t.rates[country]; ok {
+		return r
+	}
+	return TaxRate{Jurisdiction: country}
+}
+
+// DefaultTaxRates holds the standard rates on digital services where the
+// platform is registered to collect tax
+func DefaultTaxRates() *TaxTable {
+	return NewTaxTable(
+		TaxRate{Jurisdiction: "GB", Name: "VAT", BasisPoints: 2000},
+		TaxRate{Jurisdiction: "DE", Name: "VAT", BasisPoints: 1900},
+		TaxRate{Jurisdiction: "FR", Name: "VAT", BasisPoints: 2000},
+		TaxRate{Jurisdiction: "NL", Name: "VAT", BasisPoints: 2100},
+		TaxRate{Jurisdiction: "IE", Name: "VAT", BasisPoints: 2300},
+		TaxRate{Jurisdiction: "AU", Name: "GST", BasisPoints: 1000},
+		TaxRate{Jurisdiction: "NZ", Name: "GST", BasisPoints: 1500},
+		TaxRate{Jurisdiction: "CA", Name: "GST", BasisPoints: 500},
+		TaxRate{Jurisdiction: "CA-ON", Name: "HST", BasisPoints: 1300},
+		TaxRate{Jurisdiction: "CA-QC", Name: "GST/QST", BasisPoints: 1498},
+		TaxRate{Jurisdiction: "KE", Name: "VAT", BasisPoints: 1600},
+		TaxRate{Jurisdiction: "NG", Name: "VAT", BasisPoints: 750},
+	)
+}
@@ -1,8 +1,74 @@
 package billing
 
+// Metrics metered for billing besides the plan quotas
+const (
+	MetricCreditsMinted    = "credits_minted"
+	MetricReportExecutions = "report_executions"
+)
+
+// Quota warning levels, raised once per billing period each
+const (
+	WarningApproaching = "approaching"
+	WarningExceeded    = "exceeded"
+)
+
+// ApproachingThreshold is the share of a quota at which users are warned
+const ApproachingThreshold = 0.8
+
 func DefaultUsageMetrics() map[string]interface{} {
 	return map[string]interface{}{
-		"credits_minted":  0,
-		"storage_used_mb": 0,
+		MetricCreditsMinted:    0,
+		MetricReportExecutions: 0,
+		QuotaStorageMB:         0,
+		QuotaProjects:          0,
+		QuotaAPICalls:          0,
+		QuotaReportSchedules:   0,
+	}
+}
+
+// IsPeriodMetric reports whether a metric counts usage within a billing
+// period and restarts at zero on renewal. Other metrics measure what the
+// user currently holds, such as storage.
+func IsPeriodMetric(name string) bool {
+	switch name {
+	case QuotaAPICalls, MetricReportExecutions, MetricCreditsMinted:
+		return true
+	default:
+		return false
+	}
+}
+
+// BytesToMB rounds a byte count up to whole mebibytes
+func BytesToMB(bytes int64) int64 {
+	const mb = 1 << 20
+	if bytes <= 0 {
+		return 0
+	}
+	return (bytes + mb - 1) / mb
+}
+
+// QuotaLevel returns the warning level for usage against a limit, or ""
+func QuotaLevel(used, limit int64) string {
+	switch {
+	case limit == Unlimited:
+		return ""
+	case used >= limit:
+		return WarningExceeded
+	case float64(used) >= float64(limit)*ApproachingThreshold:
+		return WarningApproaching
+	default:
+		return ""
+	}
+}
+
+// UsageCharge prices usage beyond the plan quota for a metric with a metered
+// price. It returns the billed units and their total in cents.
+func (p Plan) UsageCharge(metric string, used int64) (int64, int64) {
+	price, ok := p.Metered[metric]
+	limit := p.Quota(metric)
+	if !ok || price.UnitSize <= 0 || limit == Unlimited || used <= limit {
+		return 0, 0
 	}
+	units := (used - limit + price.UnitSize - 1) / price.UnitSize
+	return units, units * price.UnitPrice
 }
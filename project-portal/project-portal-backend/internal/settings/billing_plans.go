@@ -0,0 +1,468 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// defaultPlanID is the plan subscriptions start on and fall back to
+const defaultPlanID = "free"
+
+const subscriptionRenewalBatchSize = 100
+
+// EntitlementError rejects an action the caller's plan does not allow.
+// Handlers answer it with 402 Payment Required.
+type EntitlementError struct {
+	Code    string `json:"code"` // plan_feature_required or plan_quota_exceeded
+	Message string `json:"error"`
+	PlanID  string `json:"plan_id"`
+	Feature string `json:"feature,omitempty"`
+	Quota   string `json:"quota,omitempty"`
+	Limit   int64  `json:"limit,omitempty"`
+	Used    int64  `json:"used,omitempty"`
+}
+
+func (e *EntitlementError) Error() string { return e.Message }
+
+func (s *service) ListPlans(_ context.Context) []settingsbilling.Plan {
+	return s.cfg.Plans.List()
+}
+
+// planFor returns the catalogue plan a subscription is on. Unknown plans,
+// such as retired ones, fall back to the default plan.
+func (s *service) planFor(sub *Subscription) settingsbilling.Plan {
+	if plan, ok := s.cfg.Plans.Get(sub.PlanID); ok {
+		return plan
+	}
+	log.Printf("settings: subscription %s is on unknown plan %q", sub.ID, sub.PlanID)
+	plan, _ := s.cfg.Plans.Get(defaultPlanID)
+	return plan
+}
+
+// entitledPlan is the plan whose limits apply; unpaid subscriptions only
+// keep what the default plan allows
+func (s *service) entitledPlan(sub *Subscription) settingsbilling.Plan {
+	if sub.Status == "unpaid" {
+		if plan, ok := s.cfg.Plans.Get(defaultPlanID); ok {
+			return plan
+		}
+	}
+	return s.planFor(sub)
+}
+
+func (s *service) GetEntitlements(ctx context.Context, userID uuid.UUID) (*Entitlements, error) {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	plan := s.entitledPlan(sub)
+	return &Entitlements{
+		PlanID:   plan.ID,
+		PlanName: plan.Name,
+		Status:   sub.Status,
+		Features: append([]string{}, plan.Features...),
+		Quotas:   quotaStatuses(plan, sub),
+	}, nil
+}
+
+// CheckFeature returns an *EntitlementError unless the user's plan grants
+// the feature
+func (s *service) CheckFeature(ctx context.Context, userID uuid.UUID, feature string) error {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return err
+	}
+	plan := s.entitledPlan(sub)
+	if plan.HasFeature(feature) {
+		return nil
+	}
+	return &EntitlementError{
+		Code:    "plan_feature_required",
+		Message: fmt.Sprintf("the %s plan does not include %s", plan.Name, feature),
+		PlanID:  plan.ID,
+		Feature: feature,
+	}
+}
+
+// CheckQuota returns an *EntitlementError when adding increment to the
+// current usage would go over the plan limit. Quotas with a metered price
+// are billed for overage instead.
+func (s *service) CheckQuota(ctx context.Context, userID uuid.UUID, quota string, increment int64) error {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return err
+	}
+	plan := s.entitledPlan(sub)
+	limit := plan.Quota(quota)
+	used := usageMetric(sub.UsageMetrics, quota)
+	if limit == settingsbilling.Unlimited || used+increment <= limit || plan.SoftLimit(quota) {
+		return nil
+	}
+	return &EntitlementError{
+		Code:    "plan_quota_exceeded",
+		Message: fmt.Sprintf("the %s plan allows %d %s", plan.Name, limit, quota),
+		PlanID:  plan.ID,
+		Quota:   quota,
+		Limit:   limit,
+		Used:    used,
+	}
+}
+
+// ChangePlan moves a subscription to another plan or billing cycle. Paid
+// time left on the old plan is credited and the new plan charged for the
+// rest of the period; a net charge becomes a draft invoice, a net credit is
+// kept on the subscription for later invoices. StartTrial begins the
+// target plan's trial instead, once per customer and only from a free plan.
+func (s *service) ChangePlan(ctx context.Context, userID uuid.UUID, req ChangePlanRequest) (*ChangePlanResponse, error) {
+	target, ok := s.cfg.Plans.Get(strings.TrimSpace(req.PlanID))
+	if !ok {
+		return nil, fmt.Errorf("unknown plan %q", req.PlanID)
+	}
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	current := s.planFor(sub)
+	cycle := strings.TrimSpace(req.BillingCycle)
+	if cycle == "" {
+		cycle = sub.BillingCycle
+	}
+	if err := settingsbilling.ValidateBillingCycle(cycle); err != nil {
+		return nil, err
+	}
+	if _, err := target.Price(cycle); err != nil {
+		return nil, err
+	}
+	if target.ID == current.ID && cycle == sub.BillingCycle && !req.StartTrial {
+		return nil, fmt.Errorf("subscription is already on the %s plan billed %s", target.Name, cycle)
+	}
+	for quota, limit := range target.Quotas {
+		if used := usageMetric(sub.UsageMetrics, quota); limit != settingsbilling.Unlimited && used > limit {
+			return nil, fmt.Errorf("current %s usage (%d) is over the %s plan limit of %d", quota, used, target.Name, limit)
+		}
+	}
+
+	before := *sub
+	now := time.Now().UTC()
+	resp := &ChangePlanResponse{}
+	if req.StartTrial {
+		switch {
+		case !current.IsFree():
+			return nil, fmt.Errorf("trials can only be started from a free plan")
+		case target.TrialDays <= 0:
+			return nil, fmt.Errorf("the %s plan has no trial", target.Name)
+		case sub.TrialUsed:
+			return nil, fmt.Errorf("the trial has already been used")
+		}
+		trialEnd := now.AddDate(0, 0, target.TrialDays)
+		sub.Status = "trialing"
+		sub.TrialEndsAt = &trialEnd
+		sub.TrialUsed = true
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = trialEnd
+	} else {
+		var proration settingsbilling.Proration
+		if sub.Status == "trialing" {
+			// Leaving a trial ends it: nothing was paid, so the new plan
+			// starts a full period now
+			proration, err = settingsbilling.Prorate(current, sub.BillingCycle, target, cycle, sub.CurrentPeriodStart, now, now, false)
+		} else {
+			proration, err = settingsbilling.Prorate(current, sub.BillingCycle, target, cycle, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, now, !current.IsFree())
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Proration = &proration
+		if proration.Net > 0 {
+			resp.Invoice = s.draftInvoice(sub, target, prorationLineItems(current, sub.BillingCycle, target, cycle, proration), now)
+		} else if proration.Net < 0 {
+			sub.CreditBalance = roundAmount(sub.CreditBalance + centsToAmount(-proration.Net))
+		}
+		if sub.Status == "trialing" || sub.Status == "canceled" {
+			sub.Status = "active"
+		}
+		sub.TrialEndsAt = nil
+		sub.CurrentPeriodStart = proration.PeriodStart
+		sub.CurrentPeriodEnd = proration.PeriodEnd
+	}
+	sub.PlanID = target.ID
+	sub.PlanName = target.Name
+	sub.BillingCycle = cycle
+	sub.CancelAtPeriodEnd = false
+	sub.CanceledAt = nil
+	if sub.UsageMetrics == nil {
+		sub.UsageMetrics = datatypes.JSONMap(settingsbilling.DefaultUsageMetrics())
+	}
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	if resp.Invoice != nil {
+		if err := s.repo.SaveInvoice(ctx, resp.Invoice); err != nil {
+			return nil, err
+		}
+	}
+	resp.Subscription = sub
+	s.audit("billing.subscription.change", userID, map[string]interface{}{"before": before, "after": sub, "trial": req.StartTrial})
+	return resp, nil
+}
+
+// CancelSubscription keeps the plan until the end of the paid period, after
+// which the renewal job moves the subscription to the default plan
+func (s *service) CancelSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.planFor(sub).IsFree() {
+		return nil, fmt.Errorf("the free plan cannot be canceled")
+	}
+	if sub.CancelAtPeriodEnd {
+		return sub, nil
+	}
+	now := time.Now().UTC()
+	sub.CancelAtPeriodEnd = true
+	sub.CanceledAt = &now
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.audit("billing.subscription.cancel", userID, map[string]interface{}{"plan_id": sub.PlanID, "ends_at": sub.CurrentPeriodEnd})
+	return sub, nil
+}
+
+// ResumeSubscription withdraws a pending cancellation
+func (s *service) ResumeSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.CancelAtPeriodEnd {
+		return nil, fmt.Errorf("subscription is not set to cancel")
+	}
+	sub.CancelAtPeriodEnd = false
+	sub.CanceledAt = nil
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	s.audit("billing.subscription.resume", userID, map[string]interface{}{"plan_id": sub.PlanID})
+	return sub, nil
+}
+
+// RenewSubscriptions closes every period that has ended: pending
+// cancellations drop to the default plan, finished trials convert to paid
+// and paid plans roll over, each with a draft invoice for the new period
+// and any usage over quota in the old one. Past due subscriptions are left
+// to dunning.
+func (s *service) RenewSubscriptions(ctx context.Context) (*SubscriptionRenewalResult, error) {
+	result := &SubscriptionRenewalResult{}
+	now := time.Now().UTC()
+	after := uuid.Nil
+	for {
+		subs, err := s.repo.ListSubscriptionsDue(ctx, now, after, subscriptionRenewalBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range subs {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			if err := s.renewSubscription(ctx, &subs[i], now, result); err != nil {
+				log.Printf("settings: renew subscription %s: %v", subs[i].ID, err)
+			}
+		}
+		if len(subs) < subscriptionRenewalBatchSize {
+			return result, nil
+		}
+		after = subs[len(subs)-1].ID
+	}
+}
+
+func (s *service) renewSubscription(ctx context.Context, sub *Subscription, now time.Time, result *SubscriptionRenewalResult) error {
+	before := *sub
+	plan := s.planFor(sub)
+	var invoice *Invoice
+	event := "billing.subscription.renew"
+	switch {
+	case sub.CancelAtPeriodEnd:
+		free, ok := s.cfg.Plans.Get(defaultPlanID)
+		if !ok {
+			return fmt.Errorf("plan catalogue has no %s plan", defaultPlanID)
+		}
+		usage := s.closeUsagePeriod(ctx, sub, plan)
+		sub.PlanID = free.ID
+		sub.PlanName = free.Name
+		sub.Status = "canceled"
+		sub.CancelAtPeriodEnd = false
+		sub.TrialEndsAt = nil
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = settingsbilling.PeriodEnd(now, sub.BillingCycle)
+		if len(usage) > 0 {
+			invoice = s.draftInvoice(sub, plan, usage, now)
+		}
+		event = "billing.subscription.canceled"
+		result.Canceled++
+	case sub.Status == "trialing":
+		// Without a payment method the first invoice cannot be collected,
+		// so the subscription goes straight to dunning
+		sub.Status = "active"
+		if strings.TrimSpace(sub.PaymentMethodID) == "" {
+			sub.Status = "past_due"
+		}
+		sub.CurrentPeriodStart = now
+		sub.CurrentPeriodEnd = settingsbilling.PeriodEnd(now, sub.BillingCycle)
+		invoice = s.draftInvoice(sub, plan, []InvoiceLineItem{subscriptionLineItem(plan, sub)}, now)
+		event = "billing.subscription.trial_converted"
+		result.TrialsConverted++
+	default:
+		// The plan is charged in advance and usage over quota in arrears
+		usage := s.closeUsagePeriod(ctx, sub, plan)
+		sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+		sub.CurrentPeriodEnd = settingsbilling.PeriodEnd(sub.CurrentPeriodStart, sub.BillingCycle)
+		if !plan.IsFree() || len(usage) > 0 {
+			invoice = s.draftInvoice(sub, plan, append([]InvoiceLineItem{subscriptionLineItem(plan, sub)}, usage...), now)
+		}
+		result.Renewed++
+	}
+	startUsagePeriod(sub)
+	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+		return err
+	}
+	if invoice != nil {
+		if err := s.repo.SaveInvoice(ctx, invoice); err != nil {
+			return err
+		}
+		result.Invoiced++
+	}
+	s.audit(event, sub.UserID, map[string]interface{}{"before": before, "after": sub})
+	return nil
+}
+
+// draftInvoice bills the line items for the subscription's current period,
+// drawing down any credit balance first. It returns nil when the credit
+// covers everything.
+func (s *service) draftInvoice(sub *Subscription, plan settingsbilling.Plan, items []InvoiceLineItem, now time.Time) *Invoice {
+	amount := 0.0
+	for _, item := range items {
+		amount += item.Amount
+	}
+	if applied := math.Min(sub.CreditBalance, amount); applied > 0 {
+		items = append(items, InvoiceLineItem{
+			Kind:        "credit_balance",
+			Description: "Account credit applied",
+			Quantity:    1,
+			UnitAmount:  -applied,
+			Amount:      -applied,
+			PeriodStart: sub.CurrentPeriodStart,
+			PeriodEnd:   sub.CurrentPeriodEnd,
+		})
+		sub.CreditBalance = roundAmount(sub.CreditBalance - applied)
+		amount -= applied
+	}
+	amount = roundAmount(amount)
+	if amount <= 0 {
+		return nil
+	}
+	lineItems, _ := json.Marshal(items)
+	id := uuid.New()
+	subID := sub.ID
+	invoice := &Invoice{
+		ID:             id,
+		SubscriptionID: &subID,
+		UserID:         sub.UserID,
+		// Draft numbers are replaced by sequential ones when invoices are
+		// finalised
+		InvoiceNumber:      "DRAFT-" + strings.ToUpper(id.String()[:8]),
+		Amount:             amount,
+		Currency:           plan.Currency,
+		TotalAmount:        amount,
+		BillingPeriodStart: sub.CurrentPeriodStart,
+		BillingPeriodEnd:   sub.CurrentPeriodEnd,
+		Status:             "draft",
+		Kind:               settingsbilling.KindInvoice,
+		LineItems:          datatypes.JSON(lineItems),
+		CreatedAt:          now,
+	}
+	if invoice.Currency == "" {
+		invoice.Currency = "USD"
+	}
+	return invoice
+}
+
+func subscriptionLineItem(plan settingsbilling.Plan, sub *Subscription) InvoiceLineItem {
+	price, _ := plan.Price(sub.BillingCycle)
+	amount := centsToAmount(price)
+	return InvoiceLineItem{
+		Kind:        "subscription",
+		Description: fmt.Sprintf("%s plan (%s)", plan.Name, sub.BillingCycle),
+		Quantity:    1,
+		UnitAmount:  amount,
+		Amount:      amount,
+		PeriodStart: sub.CurrentPeriodStart,
+		PeriodEnd:   sub.CurrentPeriodEnd,
+	}
+}
+
+func prorationLineItems(from settingsbilling.Plan, fromCycle string, to settingsbilling.Plan, toCycle string, p settingsbilling.Proration) []InvoiceLineItem {
+	var items []InvoiceLineItem
+	if p.Credit > 0 {
+		credit := centsToAmount(p.Credit)
+		items = append(items, InvoiceLineItem{
+			Kind:        "proration_credit",
+			Description: fmt.Sprintf("Unused time on %s plan (%s)", from.Name, fromCycle),
+			Quantity:    1,
+			UnitAmount:  -credit,
+			Amount:      -credit,
+			PeriodStart: p.PeriodStart,
+			PeriodEnd:   p.PeriodEnd,
+		})
+	}
+	kind, description := "subscription", fmt.Sprintf("%s plan (%s)", to.Name, toCycle)
+	if p.UnusedFraction > 0 && fromCycle == toCycle {
+		kind, description = "proration_charge", fmt.Sprintf("Remaining time on %s plan (%s)", to.Name, toCycle)
+	}
+	charge := centsToAmount(p.Charge)
+	return append(items, InvoiceLineItem{
+		Kind:        kind,
+		Description: description,
+		Quantity:    1,
+		UnitAmount:  charge,
+		Amount:      charge,
+		PeriodStart: p.PeriodStart,
+		PeriodEnd:   p.PeriodEnd,
+	})
+}
+
+// usageMetric reads a counter from subscription usage metrics, which hold
+// float64 once they have been through JSON
+func usageMetric(metrics datatypes.JSONMap, name string) int64 {
+	switch v := metrics[name].(type) {
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	default:
+		return 0
+	}
+}
+
+func centsToAmount(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+func roundAmount(v float64) float64 {
+	return math.Round(v*100) / 100
+}
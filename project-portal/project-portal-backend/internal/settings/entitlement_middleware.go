@@ -0,0 +1,64 @@
+package settings
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature rejects requests from users whose plan does not include
+// the feature with 402 Payment Required. It must run after authRequired or
+// APIKeyAuth.
+func RequireFeature(service Service, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := currentUserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+			return
+		}
+		if err := service.CheckFeature(c.Request.Context(), uid, feature); err != nil {
+			abortWithEntitlementError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireQuota rejects requests that would create one more unit of quota
+// than the user's plan allows. Usage itself is counted where the unit is
+// created.
+func RequireQuota(service Service, quota string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid, ok := currentUserID(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing user"})
+			return
+		}
+		if err := service.CheckQuota(c.Request.Context(), uid, quota, 1); err != nil {
+			abortWithEntitlementError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWithEntitlementError(c *gin.Context, err error) {
+	var entErr *EntitlementError
+	if errors.As(err, &entErr) {
+		c.AbortWithStatusJSON(http.StatusPaymentRequired, entErr)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// writeServiceError answers plan errors with 402 and anything else with the
+// fallback status
+func writeServiceError(c *gin.Context, err error, fallback int) {
+	var entErr *EntitlementError
+	if errors.As(err, &entErr) {
+		c.JSON(http.StatusPaymentRequired, entErr)
+		return
+	}
+	c.JSON(fallback, gin.H{"error": err.Error()})
+}
@@ -1,13 +1,25 @@
 package settings
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strings"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+	settingsprofile "carbon-scribe/project-portal/project-portal-backend/internal/settings/profile"
+	pkgbilling "carbon-scribe/project-portal/project-portal-backend/pkg/billing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// maxProfilePictureRequestBytes caps the whole multipart request; the
+// service enforces the configured image size limit
+const maxProfilePictureRequestBytes = 32 << 20
+
 type Handler struct {
 	service Service
 }
@@ -16,36 +28,78 @@ func NewHandler(service Service) *Handler { return &Handler{service: service} }
 
 func (h *Handler) RegisterRoutes(v1 *gin.RouterGroup) {
 	settings := v1.Group("/settings")
-	settings.Use(authRequired())
+	settings.Use(authenticate(h.service))
 	{
 		settings.GET("/profile", requirePermission("settings:read"), h.getProfile)
 		settings.PUT("/profile", requirePermission("settings:write"), h.updateProfile)
 		settings.DELETE("/profile", requirePermission("settings:write"), h.deleteProfile)
 		settings.POST("/profile/picture", requirePermission("settings:write"), h.uploadProfilePicture)
 		settings.GET("/profile/export", requirePermission("settings:read"), h.exportProfile)
+		settings.POST("/profile/exports", requirePermission("settings:read"), h.requestAccountExport)
+		settings.GET("/profile/exports", requirePermission("settings:read"), h.listAccountExports)
+		settings.GET("/profile/exports/:id", requirePermission("settings:read"), h.getAccountExport)
 
 		settings.GET("/notifications", requirePermission("settings:read"), h.getNotifications)
 		settings.PUT("/notifications", requirePermission("settings:write"), h.updateNotifications)
 
 		settings.GET("/api-keys", requirePermission("settings:api_keys"), h.listAPIKeys)
-		settings.POST("/api-keys", requirePermission("settings:api_keys"), h.createAPIKey)
+		settings.POST("/api-keys", requirePermission("settings:api_keys"), requireSession(), h.createAPIKey)
 		settings.POST("/api-keys/validate", requirePermission("settings:api_keys"), h.validateAPIKey)
-		settings.DELETE("/api-keys/:id", requirePermission("settings:api_keys"), h.revokeAPIKey)
-		settings.POST("/api-keys/:id/rotate", requirePermission("settings:api_keys"), h.rotateAPIKey)
+		settings.DELETE("/api-keys/:id", requirePermission("settings:api_keys"), requireSession(), h.revokeAPIKey)
+		settings.POST("/api-keys/:id/rotate", requirePermission("settings:api_keys"), requireSession(), h.rotateAPIKey)
 		settings.GET("/api-keys/:id/usage", requirePermission("settings:api_keys"), h.getAPIKeyUsage)
-		settings.POST("/api-keys/:id/webhooks", requirePermission("settings:api_keys"), h.configureAPIKeyWebhooks)
+		settings.POST("/api-keys/:id/webhooks", requirePermission("settings:api_keys"), requireSession(), h.configureAPIKeyWebhooks)
+		settings.GET("/api-keys/:id/webhooks/deliveries", requirePermission("settings:api_keys"), h.listAPIKeyWebhookDeliveries)
+		settings.POST("/api-keys/:id/webhooks/deliveries/:delivery_id/replay", requirePermission("settings:api_keys"), requireSession(), h.replayAPIKeyWebhookDelivery)
 
 		settings.GET("/integrations", requirePermission("settings:read"), h.listIntegrations)
-		settings.POST("/integrations", requirePermission("settings:integrations"), h.configureIntegration)
-		settings.POST("/integrations/batch", requirePermission("settings:integrations"), h.batchConfigureIntegrations)
+		settings.POST("/integrations", requirePermission("settings:integrations"), RequireFeature(h.service, settingsbilling.FeatureIntegrations), h.configureIntegration)
+		settings.POST("/integrations/batch", requirePermission("settings:integrations"), RequireFeature(h.service, settingsbilling.FeatureIntegrations), h.batchConfigureIntegrations)
 		settings.GET("/integrations/:id/health", requirePermission("settings:integrations"), h.getIntegrationHealth)
-		settings.GET("/integrations/oauth/:provider/start", requirePermission("settings:integrations"), h.oauthStart)
+		settings.GET("/integrations/oauth/:provider/start", requirePermission("settings:integrations"), RequireFeature(h.service, settingsbilling.FeatureIntegrations), h.oauthStart)
 		settings.POST("/integrations/oauth/:provider/callback", requirePermission("settings:integrations"), h.oauthCallback)
+		settings.POST("/integrations/:id/oauth/revoke", requirePermission("settings:integrations"), h.oauthRevoke)
 
 		settings.GET("/billing", requirePermission("settings:billing"), h.getBilling)
 		settings.GET("/billing/invoices", requirePermission("settings:billing"), h.listInvoices)
 		settings.GET("/billing/invoices/:id/pdf", requirePermission("settings:billing"), h.getInvoicePDF)
+		settings.POST("/billing/invoices/:id/credit-notes", requirePermission("settings:billing:refunds"), h.issueCreditNote)
 		settings.POST("/billing/payment-method", requirePermission("settings:billing"), h.addPaymentMethod)
+		settings.GET("/billing/plans", requirePermission("settings:billing"), h.listPlans)
+		settings.GET("/billing/entitlements", requirePermission("settings:read"), h.getEntitlements)
+		settings.GET("/billing/usage", requirePermission("settings:billing"), h.getUsage)
+		settings.POST("/billing/subscription/change", requirePermission("settings:billing"), h.changePlan)
+		settings.POST("/billing/subscription/cancel", requirePermission("settings:billing"), h.cancelSubscription)
+		settings.POST("/billing/subscription/resume", requirePermission("settings:billing"), h.resumeSubscription)
+	}
+
+	// Payment processor webhooks, authorised by their signature
+	v1.POST("/settings/billing/webhooks", h.paymentWebhook)
+}
+
+// authenticate accepts an API key in X-API-Key, rate limited and metered by
+// APIKeyAuth, and otherwise the gateway's session headers
+func authenticate(service Service) gin.HandlerFunc {
+	apiKeyAuth := APIKeyAuth(service)
+	sessionAuth := authRequired()
+	return func(c *gin.Context) {
+		if strings.TrimSpace(c.GetHeader("X-API-Key")) != "" {
+			apiKeyAuth(c)
+			return
+		}
+		sessionAuth(c)
+	}
+}
+
+// requireSession refuses requests made with an API key, so a key cannot
+// mint, rotate or revoke keys and widen its own access
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, viaKey := c.Get("api_key_id"); viaKey {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage API keys"})
+			return
+		}
+		c.Next()
 	}
 }
 
@@ -73,9 +127,15 @@ func authRequired() gin.HandlerFunc {
 
 func requirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		perms := splitPermissions(c.GetHeader("X-Permissions"))
-		if len(perms) == 0 {
-			perms = splitPermissions(c.GetHeader("X-Scopes"))
+		// Requests made with an API key are limited to the key's scopes
+		var perms []string
+		if scopes, ok := c.Get("api_key_scopes"); ok {
+			perms, _ = scopes.([]string)
+		} else {
+			perms = splitPermissions(c.GetHeader("X-Permissions"))
+			if len(perms) == 0 {
+				perms = splitPermissions(c.GetHeader("X-Scopes"))
+			}
 		}
 		if len(perms) == 0 {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permissions"})
@@ -110,6 +170,18 @@ func hasPermission(perms []string, permission string) bool {
 	return false
 }
 
+// parseQueryTime accepts an RFC 3339 timestamp or a date; empty is zero
+func parseQueryTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
 func currentUserID(c *gin.Context) (uuid.UUID, bool) {
 	v, ok := c.Get("settings_user_id")
 	if !ok {
@@ -174,45 +246,93 @@ func (h *Handler) updateProfile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	before, err := h.service.GetProfile(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	profile, err := h.service.UpdateProfile(c.Request.Context(), uid, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "user_profile", TargetID: profile.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "profile", Before: before, After: profile,
+	})
 	c.JSON(http.StatusOK, profile)
 }
 
 func (h *Handler) deleteProfile(c *gin.Context) {
 	uid, _ := currentUserID(c)
+	before, err := h.service.GetProfile(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	resp, err := h.service.DeleteProfile(c.Request.Context(), uid)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "user_profile", TargetID: before.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "profile", Before: before,
+	})
 	c.JSON(http.StatusOK, resp)
 }
 
+// uploadProfilePicture accepts a multipart upload in the "file" field
 func (h *Handler) uploadProfilePicture(c *gin.Context) {
 	uid, _ := currentUserID(c)
-	filename := c.PostForm("filename")
-	if filename == "" {
-		file, err := c.FormFile("file")
-		if err == nil && file != nil {
-			filename = file.Filename
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProfilePictureRequestBytes)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrPictureTooLarge.Error()})
+			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart field \"file\" is required"})
+		return
 	}
-	if filename == "" {
-		var body struct {
-			Filename string `json:"filename"`
-		}
-		_ = c.ShouldBindJSON(&body)
-		filename = body.Filename
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	resp, err := h.service.UploadProfilePicture(c.Request.Context(), uid, filename)
+	defer file.Close()
+	data, err := io.ReadAll(file)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	before, err := h.service.GetProfile(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := h.service.UploadProfilePicture(c.Request.Context(), uid, data)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrPictureTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, settingsprofile.ErrUnsupportedPicture):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, settingsprofile.ErrInvalidPicture):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrPictureStorageUnavailable):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "user_profile", TargetID: before.ID.String(), TargetOwnerID: uid.String(), DataCategory: "profile",
+		Before: gin.H{"profile_picture_url": before.ProfilePictureURL, "profile_picture_sizes": before.ProfilePictureSizes},
+		After:  gin.H{"profile_picture_url": resp.ProfilePictureURL, "profile_picture_sizes": resp.Sizes},
+	})
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -227,6 +347,54 @@ func (h *Handler) exportProfile(c *gin.Context) {
 	c.Data(http.StatusOK, contentType, payload)
 }
 
+// requestAccountExport queues an archive of all the user's data; poll
+// getAccountExport for the download link
+func (h *Handler) requestAccountExport(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	export, err := h.service.RequestAccountExport(c.Request.Context(), uid)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrExportStorageUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "account_export", TargetID: export.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "profile", After: export,
+	})
+	c.JSON(http.StatusAccepted, export)
+}
+
+func (h *Handler) listAccountExports(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	exports, err := h.service.ListAccountExports(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+func (h *Handler) getAccountExport(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	exportID, ok := parseUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	export, err := h.service.GetAccountExport(c.Request.Context(), uid, exportID)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, ErrExportStorageUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
 func (h *Handler) getNotifications(c *gin.Context) {
 	uid, _ := currentUserID(c)
 	prefs, err := h.service.GetNotifications(c.Request.Context(), uid)
@@ -244,11 +412,20 @@ func (h *Handler) updateNotifications(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	before, err := h.service.GetNotifications(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	prefs, err := h.service.UpdateNotifications(c.Request.Context(), uid, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "notification_preference", TargetID: prefs.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "preferences", Before: before, After: prefs,
+	})
 	c.JSON(http.StatusOK, prefs)
 }
 
@@ -271,9 +448,13 @@ func (h *Handler) createAPIKey(c *gin.Context) {
 	}
 	resp, err := h.service.CreateAPIKey(c.Request.Context(), uid, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeServiceError(c, err, http.StatusBadRequest)
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "api_key", TargetID: resp.APIKey.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "credentials", After: resp.APIKey,
+	})
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -308,6 +489,9 @@ func (h *Handler) revokeAPIKey(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "api_key", TargetID: keyID.String(), TargetOwnerID: uid.String(), DataCategory: "credentials",
+	})
 	c.Status(http.StatusNoContent)
 }
 
@@ -322,6 +506,10 @@ func (h *Handler) rotateAPIKey(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "api_key", TargetID: keyID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "credentials", Action: "rotate", After: resp.APIKey,
+	})
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -331,7 +519,17 @@ func (h *Handler) getAPIKeyUsage(c *gin.Context) {
 	if !ok {
 		return
 	}
-	usage, err := h.service.GetAPIKeyUsage(c.Request.Context(), uid, keyID)
+	rng := APIKeyUsageRange{Granularity: c.Query("granularity")}
+	var err error
+	if rng.From, err = parseQueryTime(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if rng.To, err = parseQueryTime(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	usage, err := h.service.GetAPIKeyUsage(c.Request.Context(), uid, keyID, rng)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -352,12 +550,52 @@ func (h *Handler) configureAPIKeyWebhooks(c *gin.Context) {
 	}
 	key, err := h.service.ConfigureAPIKeyWebhooks(c.Request.Context(), uid, keyID, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeServiceError(c, err, http.StatusBadRequest)
 		return
 	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "api_key", TargetID: keyID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "credentials", Action: "configure_webhooks", After: key,
+	})
 	c.JSON(http.StatusOK, key)
 }
 
+func (h *Handler) listAPIKeyWebhookDeliveries(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	keyID, ok := parseUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	deliveries, err := h.service.ListAPIKeyWebhookDeliveries(c.Request.Context(), uid, keyID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func (h *Handler) replayAPIKeyWebhookDelivery(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	keyID, ok := parseUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseUUIDParam(c, "delivery_id")
+	if !ok {
+		return
+	}
+	delivery, err := h.service.ReplayAPIKeyWebhookDelivery(c.Request.Context(), uid, keyID, deliveryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "api_key_webhook_delivery", TargetID: delivery.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "credentials", Action: "replay", After: delivery,
+	})
+	c.JSON(http.StatusAccepted, delivery)
+}
+
 func (h *Handler) listIntegrations(c *gin.Context) {
 	uid, _ := currentUserID(c)
 	items, err := h.service.ListIntegrations(c.Request.Context(), uid)
@@ -380,6 +618,7 @@ func (h *Handler) configureIntegration(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordIntegration(c, uid, "", item)
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -395,6 +634,9 @@ func (h *Handler) batchConfigureIntegrations(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	for i := range items {
+		recordIntegration(c, uid, "", &items[i])
+	}
 	c.JSON(http.StatusCreated, gin.H{"items": items})
 }
 
@@ -422,16 +664,48 @@ func (h *Handler) oauthCallback(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if resp.Integration != nil {
+		recordIntegration(c, uid, "connect", resp.Integration)
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+func (h *Handler) oauthRevoke(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	id, ok := parseUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	item, err := h.service.RevokeOAuthIntegration(c.Request.Context(), uid, id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordIntegration(c, uid, "revoke", item)
+	c.JSON(http.StatusOK, item)
+}
+
+// recordIntegration audits a change to an integration; its configuration is
+// only exposed through the public view, so secrets never reach the log
+func recordIntegration(c *gin.Context, uid uuid.UUID, action string, item *IntegrationConfigurationPublic) {
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "integration_configuration", TargetID: item.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "integrations", Action: action, After: item,
+	})
+}
+
 func (h *Handler) getIntegrationHealth(c *gin.Context) {
 	uid, _ := currentUserID(c)
 	id, ok := parseUUIDParam(c, "id")
 	if !ok {
 		return
 	}
-	resp, err := h.service.GetIntegrationHealth(c.Request.Context(), uid, id)
+	window, err := ParseHealthWindow(c.Query("window"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := h.service.GetIntegrationHealth(c.Request.Context(), uid, id, window)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -467,12 +741,64 @@ func (h *Handler) getInvoicePDF(c *gin.Context) {
 	}
 	resp, err := h.service.GetInvoicePDF(c.Request.Context(), uid, invoiceID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		status := http.StatusNotFound
+		if errors.Is(err, ErrInvoiceStorageUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// paymentWebhook applies a payment processor event. Failures other than a
+// bad signature answer 500 so the processor redelivers.
+func (h *Handler) paymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read body"})
+		return
+	}
+	if err := h.service.HandlePaymentWebhook(c.Request.Context(), payload, c.GetHeader("Stripe-Signature")); err != nil {
+		if errors.Is(err, pkgbilling.ErrInvalidSignature) || errors.Is(err, pkgbilling.ErrInvalidWebhookPayload) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, ErrPaymentsUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// issueCreditNote refunds an invoice of any user, so it needs the refunds
+// permission rather than settings:billing
+func (h *Handler) issueCreditNote(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	invoiceID, ok := parseUUIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req CreditNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	note, err := h.service.IssueCreditNote(c.Request.Context(), uid, invoiceID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "invoice", TargetID: note.ID.String(), TargetOwnerID: note.UserID.String(),
+		DataCategory: "billing", Action: "credit", After: note,
+	})
+	c.JSON(http.StatusCreated, note)
+}
+
 func (h *Handler) addPaymentMethod(c *gin.Context) {
 	uid, _ := currentUserID(c)
 	var req AddPaymentMethodRequest
@@ -481,9 +807,102 @@ func (h *Handler) addPaymentMethod(c *gin.Context) {
 		return
 	}
 	sub, err := h.service.AddPaymentMethod(c.Request.Context(), uid, req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrPaymentsUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "subscription", TargetID: sub.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "billing", After: sub,
+	})
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *Handler) listPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.ListPlans(c.Request.Context()))
+}
+
+func (h *Handler) getEntitlements(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	entitlements, err := h.service.GetEntitlements(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entitlements)
+}
+
+func (h *Handler) getUsage(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	usage, err := h.service.GetUsage(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+func (h *Handler) changePlan(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before := h.currentSubscription(c, uid)
+	resp, err := h.service.ChangePlan(c.Request.Context(), uid, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	recordSubscription(c, uid, "change_plan", before, resp.Subscription)
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) cancelSubscription(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	before := h.currentSubscription(c, uid)
+	sub, err := h.service.CancelSubscription(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordSubscription(c, uid, "cancel", before, sub)
 	c.JSON(http.StatusOK, sub)
 }
+
+func (h *Handler) resumeSubscription(c *gin.Context) {
+	uid, _ := currentUserID(c)
+	before := h.currentSubscription(c, uid)
+	sub, err := h.service.ResumeSubscription(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordSubscription(c, uid, "resume", before, sub)
+	c.JSON(http.StatusOK, sub)
+}
+
+// currentSubscription returns the user's subscription ahead of a change so it
+// can be audited, or nil when they have none yet
+func (h *Handler) currentSubscription(c *gin.Context, uid uuid.UUID) *Subscription {
+	summary, err := h.service.GetBilling(c.Request.Context(), uid)
+	if err != nil {
+		return nil
+	}
+	return summary.Subscription
+}
+
+func recordSubscription(c *gin.Context, uid uuid.UUID, action string, before, after *Subscription) {
+	if after == nil {
+		return
+	}
+	compliance.RecordChange(c, compliance.AuditChange{
+		TargetType: "subscription", TargetID: after.ID.String(), TargetOwnerID: uid.String(),
+		DataCategory: "billing", Action: action, Before: before, After: after,
+	})
+}
@@ -0,0 +1,227 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/integration"
+	settingsintegrations "carbon-scribe/project-portal/project-portal-backend/internal/settings/integrations"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	probeBatchSize                = 100
+	probeSlowThreshold            = 2 * time.Second
+	defaultHealthHistoryRetention = 30 * 24 * time.Hour
+	healthTrendPoints             = 24
+)
+
+// healthWindows are the history windows the health endpoint accepts
+var healthWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// ParseHealthWindow maps a window name to its duration, defaulting to 24h
+func ParseHealthWindow(name string) (time.Duration, error) {
+	if name == "" {
+		return healthWindows["24h"], nil
+	}
+	window, ok := healthWindows[name]
+	if !ok {
+		return 0, fmt.Errorf("window must be one of 24h, 7d or 30d")
+	}
+	return window, nil
+}
+
+// ProbeIntegrations checks every active integration against its provider and
+// records the outcome, then prunes history past the retention period
+func (s *service) ProbeIntegrations(ctx context.Context) (*IntegrationProbeRunResult, error) {
+	result := &IntegrationProbeRunResult{}
+	after := uuid.Nil
+	for {
+		items, err := s.repo.ListActiveIntegrations(ctx, after, probeBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range items {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			item := &items[i]
+			_, health, probed := s.probeIntegration(ctx, item, time.Now().UTC())
+			if !probed {
+				continue
+			}
+			result.Probed++
+			switch health {
+			case "healthy":
+				result.Healthy++
+			case "degraded":
+				result.Degraded++
+			default:
+				result.Down++
+			}
+			if err := s.repo.UpsertIntegration(ctx, item); err != nil {
+				log.Printf("settings: probe: failed to save integration %s: %v", item.ID, err)
+			}
+		}
+		if len(items) < probeBatchSize {
+			break
+		}
+		after = items[len(items)-1].ID
+	}
+
+	retention := s.cfg.HealthHistoryRetention
+	if retention <= 0 {
+		retention = defaultHealthHistoryRetention
+	}
+	pruned, err := s.repo.DeleteIntegrationHealthBefore(ctx, time.Now().UTC().Add(-retention))
+	if err != nil {
+		return result, err
+	}
+	result.Pruned = pruned
+	return result, nil
+}
+
+// probeIntegration runs the live probe for the integration's type, records
+// it in the health history and updates the item in memory. It reports false
+// when the integration is inactive or its type has no probe.
+func (s *service) probeIntegration(ctx context.Context, item *IntegrationConfiguration, now time.Time) (settingsintegrations.ProbeResult, string, bool) {
+	if !item.IsActive || s.probes == nil {
+		return settingsintegrations.ProbeResult{}, settingsintegrations.ComputeHealth(item.IsActive, item.IsValid), false
+	}
+	probe, ok := s.probes.Get(item.IntegrationType)
+	if !ok {
+		return settingsintegrations.ProbeResult{}, settingsintegrations.ComputeHealth(item.IsActive, item.IsValid), false
+	}
+
+	var result settingsintegrations.ProbeResult
+	target, err := s.probeTarget(ctx, item)
+	if err != nil {
+		result = settingsintegrations.ProbeResult{Message: err.Error()}
+	} else {
+		result = probe.Probe(ctx, target)
+	}
+
+	reconsent, _ := item.Metadata["oauth_reconsent_required"].(bool)
+	switch {
+	case result.OK:
+		item.LastSuccessfulConnection = &now
+		if !reconsent {
+			item.IsValid = true
+			item.ConnectionError = ""
+		}
+	case result.AuthFailed:
+		item.IsValid = false
+		item.ConnectionError = result.Message
+	default:
+		item.ConnectionError = result.Message
+	}
+
+	health := settingsintegrations.ProbeHealth(item.IsActive, item.IsValid, result, probeSlowThreshold)
+	item.Metadata = ensureJSONMap(item.Metadata)
+	item.Metadata["health"] = health
+	item.Metadata["health_checked_at"] = now.Format(time.RFC3339)
+
+	record := &integration.IntegrationHealth{
+		ID:           uuid.New().String(),
+		ConnectionID: item.ID.String(),
+		Status:       health,
+		LatencyMs:    int(result.Latency / time.Millisecond),
+		CheckedAt:    now,
+		Message:      result.Message,
+	}
+	if !result.OK {
+		record.ErrorRate = 1
+	}
+	if err := s.repo.RecordIntegrationHealth(ctx, record); err != nil {
+		log.Printf("settings: probe: failed to record health for %s: %v", item.ID, err)
+	}
+	return result, health, true
+}
+
+// probeTarget decrypts what a probe needs to authenticate
+func (s *service) probeTarget(ctx context.Context, item *IntegrationConfiguration) (settingsintegrations.ProbeTarget, error) {
+	target := settingsintegrations.ProbeTarget{WebhookURL: item.WebhookURL, Config: map[string]interface{}{}}
+	if item.ConfigData != "" {
+		plain, err := settingsintegrations.DecryptConfig(s.vault, item.ConfigData)
+		if err != nil {
+			return target, fmt.Errorf("failed to decrypt integration config")
+		}
+		if err := json.Unmarshal([]byte(plain), &target.Config); err != nil {
+			return target, fmt.Errorf("invalid integration config")
+		}
+	}
+	token, err := s.repo.GetOAuthToken(ctx, item.ID.String())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return target, err
+	}
+	if token != nil {
+		accessToken, _, err := s.oauthTokenSecrets(token)
+		if err != nil {
+			return target, err
+		}
+		target.AccessToken = accessToken
+	}
+	return target, nil
+}
+
+// healthTrend splits the window into equal buckets and aggregates the probe
+// history into each, oldest first. Empty buckets are kept so charts line up.
+func healthTrend(history []integration.IntegrationHealth, since time.Time, window time.Duration) []IntegrationHealthTrendPoint {
+	bucket := window / healthTrendPoints
+	points := make([]IntegrationHealthTrendPoint, healthTrendPoints)
+	latencySums := make([]int, healthTrendPoints)
+	for i := range points {
+		points[i].BucketStart = since.Add(time.Duration(i) * bucket)
+	}
+	for _, h := range history {
+		i := int(h.CheckedAt.Sub(since) / bucket)
+		if i == healthTrendPoints && !h.CheckedAt.After(since.Add(window)) {
+			i-- // a check at the end of the window belongs to the last bucket
+		}
+		if i < 0 || i >= healthTrendPoints {
+			continue
+		}
+		points[i].Checks++
+		if h.ErrorRate > 0 {
+			points[i].Failures++
+		}
+		latencySums[i] += h.LatencyMs
+		if h.LatencyMs > points[i].MaxLatencyMs {
+			points[i].MaxLatencyMs = h.LatencyMs
+		}
+	}
+	for i := range points {
+		if points[i].Checks == 0 {
+			continue
+		}
+		points[i].UptimePct = uptimePct(points[i].Checks, points[i].Failures)
+		points[i].AvgLatencyMs = float64(latencySums[i]) / float64(points[i].Checks)
+	}
+	return points
+}
+
+func formatHealthWindow(window time.Duration) string {
+	for name, d := range healthWindows {
+		if d == window {
+			return name
+		}
+	}
+	return window.String()
+}
+
+func uptimePct(checks, failures int) float64 {
+	if checks == 0 {
+		return 0
+	}
+	return float64(checks-failures) * 100 / float64(checks)
+}
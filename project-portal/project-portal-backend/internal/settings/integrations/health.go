@@ -1,5 +1,7 @@
 package integrations
 
+import "time"
+
 func ComputeHealth(isActive, isValid bool) string {
 	if !isActive {
 		return "disabled"
@@ -9,3 +11,18 @@ func ComputeHealth(isActive, isValid bool) string {
 	}
 	return "healthy"
 }
+
+// ProbeHealth combines the configuration flags with a probe outcome: a failed
+// probe means down, a slow one or an invalid configuration degraded
+func ProbeHealth(isActive, isValid bool, result ProbeResult, slow time.Duration) string {
+	if !isActive {
+		return "disabled"
+	}
+	if !result.OK {
+		return "down"
+	}
+	if !isValid || (slow > 0 && result.Latency > slow) {
+		return "degraded"
+	}
+	return "healthy"
+}
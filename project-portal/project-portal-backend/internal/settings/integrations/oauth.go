@@ -1,7 +1,267 @@
 package integrations
 
-import "fmt"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
 
 func BuildOAuthStartURL(provider string) string {
 	return fmt.Sprintf("/api/v1/settings/integrations/oauth/%s/start", provider)
 }
+
+// OAuthProvider describes an OAuth2 authorization server and the client
+// registered with it.
+type OAuthProvider struct {
+	Name         string
+	AuthorizeURL string
+	TokenURL     string
+	RevokeURL    string // optional; tokens are only dropped locally without it
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+func (p OAuthProvider) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("oauth provider name is required")
+	}
+	if p.AuthorizeURL == "" || p.TokenURL == "" {
+		return fmt.Errorf("oauth provider %s requires authorize and token urls", p.Name)
+	}
+	if p.ClientID == "" {
+		return fmt.Errorf("oauth provider %s requires a client id", p.Name)
+	}
+	if p.RedirectURL == "" {
+		return fmt.Errorf("oauth provider %s requires a redirect url", p.Name)
+	}
+	return nil
+}
+
+// ProviderRegistry holds the configured OAuth providers by name
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]OAuthProvider
+}
+
+func NewProviderRegistry(providers ...OAuthProvider) (*ProviderRegistry, error) {
+	r := &ProviderRegistry{providers: map[string]OAuthProvider{}}
+	for _, p := range providers {
+		if err := r.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *ProviderRegistry) Register(p OAuthProvider) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name] = p
+	return nil
+}
+
+func (r *ProviderRegistry) Get(name string) (OAuthProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// NewPKCEVerifier returns a random code verifier and its S256 challenge
+// (RFC 7636).
+func NewPKCEVerifier() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL builds the provider's consent URL for an S256 PKCE flow
+func AuthorizationURL(p OAuthProvider, state, challenge string) (string, error) {
+	u, err := url.Parse(p.AuthorizeURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorize url for %s: %w", p.Name, err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("state", state)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	if len(p.Scopes) > 0 {
+		q.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// OAuthToken is a token endpoint response
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// ExpiresAt returns when the access token expires, or nil if the provider
+// did not say.
+func (t OAuthToken) ExpiresAt(issuedAt time.Time) *time.Time {
+	if t.ExpiresIn <= 0 {
+		return nil
+	}
+	at := issuedAt.Add(time.Duration(t.ExpiresIn) * time.Second)
+	return &at
+}
+
+// OAuthError is an error response from a provider endpoint (RFC 6749 5.2)
+type OAuthError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth error %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("oauth error %s (status %d)", e.Code, e.StatusCode)
+}
+
+// IsInvalidGrant reports whether the provider rejected a code or refresh
+// token, which only new user consent can fix
+func IsInvalidGrant(err error) bool {
+	var oauthErr *OAuthError
+	return errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant"
+}
+
+// IsTransient reports whether a failed call may succeed when retried:
+// transport errors, rate limiting and server errors.
+func IsTransient(err error) bool {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return err != nil
+	}
+	return oauthErr.Code == "temporarily_unavailable" ||
+		oauthErr.StatusCode == http.StatusTooManyRequests ||
+		oauthErr.StatusCode >= 500
+}
+
+// OAuthClient calls provider token and revocation endpoints
+type OAuthClient struct {
+	HTTPClient *http.Client
+}
+
+func NewOAuthClient(httpClient *http.Client) *OAuthClient {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &OAuthClient{HTTPClient: httpClient}
+}
+
+// ExchangeCode redeems an authorization code with its PKCE verifier
+func (c *OAuthClient) ExchangeCode(ctx context.Context, p OAuthProvider, code, verifier string) (*OAuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	return c.requestToken(ctx, p, form)
+}
+
+// RefreshToken obtains a new access token. The response may carry a new
+// refresh token, which replaces the old one.
+func (c *OAuthClient) RefreshToken(ctx context.Context, p OAuthProvider, refreshToken string) (*OAuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return c.requestToken(ctx, p, form)
+}
+
+func (c *OAuthClient) requestToken(ctx context.Context, p OAuthProvider, form url.Values) (*OAuthToken, error) {
+	body, err := c.post(ctx, p, p.TokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	var token OAuthToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response from %s: %w", p.Name, err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response from %s has no access_token", p.Name)
+	}
+	return &token, nil
+}
+
+// RevokeToken revokes a token at the provider (RFC 7009). Providers without a
+// revocation endpoint are a no-op.
+func (c *OAuthClient) RevokeToken(ctx context.Context, p OAuthProvider, token, tokenTypeHint string) error {
+	if p.RevokeURL == "" || token == "" {
+		return nil
+	}
+	form := url.Values{}
+	form.Set("token", token)
+	if tokenTypeHint != "" {
+		form.Set("token_type_hint", tokenTypeHint)
+	}
+	_, err := c.post(ctx, p, p.RevokeURL, form)
+	return err
+}
+
+// post sends a form with client_secret_basic authentication and returns the
+// body of a 2xx response
+func (c *OAuthClient) post(ctx context.Context, p OAuthProvider, endpoint string, form url.Values) ([]byte, error) {
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth request to %s failed: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		oauthErr := &OAuthError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, oauthErr) != nil || oauthErr.Code == "" {
+			oauthErr.Code = "server_error"
+		}
+		return nil, oauthErr
+	}
+	return body, nil
+}
@@ -0,0 +1,237 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ProbeTarget is the decrypted configuration of an integration being probed
+type ProbeTarget struct {
+	Config      map[string]interface{}
+	AccessToken string // OAuth access token, when the integration has one
+	WebhookURL  string
+}
+
+// ProbeResult is the outcome of one connectivity check
+type ProbeResult struct {
+	OK         bool
+	AuthFailed bool // the provider rejected the credentials
+	StatusCode int
+	Latency    time.Duration
+	Message    string
+}
+
+// Probe performs a lightweight authenticated call against a provider
+type Probe interface {
+	Probe(ctx context.Context, target ProbeTarget) ProbeResult
+}
+
+// ProbeRegistry maps integration types to their probes
+type ProbeRegistry struct {
+	probes map[string]Probe
+}
+
+func NewProbeRegistry() *ProbeRegistry {
+	return &ProbeRegistry{probes: map[string]Probe{}}
+}
+
+func (r *ProbeRegistry) Register(integrationType string, probe Probe) {
+	r.probes[integrationType] = probe
+}
+
+func (r *ProbeRegistry) Get(integrationType string) (Probe, bool) {
+	p, ok := r.probes[integrationType]
+	return p, ok
+}
+
+// DefaultProbes registers a probe for every supported integration type
+func DefaultProbes(client *http.Client) *ProbeRegistry {
+	r := NewProbeRegistry()
+	r.Register("stripe", StripeProbe{Client: client})
+	r.Register("stellar_wallet", StellarProbe{Client: client})
+	r.Register("satellite_api", HTTPProbe{Client: client})
+	r.Register("weather_service", HTTPProbe{Client: client})
+	r.Register("webhook", WebhookProbe{Client: client})
+	return r
+}
+
+// NewProbeHTTPClient returns a client for probes. Unless allowPrivate is set
+// it refuses loopback, private and link-local addresses, so a configured URL
+// cannot be used to reach internal services.
+func NewProbeHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return fmt.Errorf("probe target %s is not a public address", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// StripeProbe reads the account balance, which any valid secret key or
+// connected account token may do
+type StripeProbe struct {
+	Client *http.Client
+}
+
+func (p StripeProbe) Probe(ctx context.Context, target ProbeTarget) ProbeResult {
+	token := target.AccessToken
+	if token == "" {
+		token = configString(target.Config, "secret_key", "api_key")
+	}
+	if token == "" {
+		return ProbeResult{AuthFailed: true, Message: "no stripe api key or oauth token configured"}
+	}
+	base := configString(target.Config, "base_url")
+	if base == "" {
+		base = "https://api.stripe.com"
+	}
+	return doProbe(ctx, p.Client, http.MethodGet, joinURL(base, "/v1/balance"), "Bearer "+token, nil)
+}
+
+// StellarProbe loads the configured account from Horizon
+type StellarProbe struct {
+	Client *http.Client
+}
+
+func (p StellarProbe) Probe(ctx context.Context, target ProbeTarget) ProbeResult {
+	account := configString(target.Config, "account_id", "public_key", "address")
+	if account == "" {
+		return ProbeResult{Message: "no stellar account configured"}
+	}
+	horizon := configString(target.Config, "horizon_url")
+	if horizon == "" {
+		horizon = "https://horizon.stellar.org"
+		if configString(target.Config, "network") == "testnet" {
+			horizon = "https://horizon-testnet.stellar.org"
+		}
+	}
+	result := doProbe(ctx, p.Client, http.MethodGet, joinURL(horizon, "/accounts/"+url.PathEscape(account)), "", nil)
+	if result.StatusCode == http.StatusNotFound {
+		result.Message = "stellar account not found"
+	}
+	return result
+}
+
+// HTTPProbe calls the configured base_url plus an optional health_path,
+// sending api_key as a bearer token
+type HTTPProbe struct {
+	Client *http.Client
+}
+
+func (p HTTPProbe) Probe(ctx context.Context, target ProbeTarget) ProbeResult {
+	base := configString(target.Config, "base_url", "endpoint", "url")
+	if base == "" {
+		return ProbeResult{Message: "no base_url configured"}
+	}
+	auth := ""
+	if token := target.AccessToken; token != "" {
+		auth = "Bearer " + token
+	} else if key := configString(target.Config, "api_key", "token"); key != "" {
+		auth = "Bearer " + key
+	}
+	return doProbe(ctx, p.Client, http.MethodGet, joinURL(base, configString(target.Config, "health_path")), auth, nil)
+}
+
+// WebhookProbe checks the endpoint answers without delivering an event. Any
+// response short of a server error counts as reachable.
+type WebhookProbe struct {
+	Client *http.Client
+}
+
+func (p WebhookProbe) Probe(ctx context.Context, target ProbeTarget) ProbeResult {
+	endpoint := target.WebhookURL
+	if endpoint == "" {
+		endpoint = configString(target.Config, "url", "webhook_url")
+	}
+	if endpoint == "" {
+		return ProbeResult{Message: "no webhook url configured"}
+	}
+	return doProbe(ctx, p.Client, http.MethodHead, endpoint, "", func(status int) bool { return status < 500 })
+}
+
+func doProbe(ctx context.Context, client *http.Client, method, endpoint, auth string, accept func(int) bool) ProbeResult {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return ProbeResult{Message: fmt.Sprintf("invalid probe url: %v", err)}
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(started)
+	if err != nil {
+		msg := err.Error()
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && urlErr.Timeout() {
+			msg = "probe timed out"
+		}
+		return ProbeResult{Latency: latency, Message: msg}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result := ProbeResult{StatusCode: resp.StatusCode, Latency: latency}
+	if accept == nil {
+		accept = func(status int) bool { return status >= 200 && status < 300 }
+	}
+	switch {
+	case accept(resp.StatusCode):
+		result.OK = true
+		result.Message = "ok"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.AuthFailed = true
+		result.Message = fmt.Sprintf("credentials rejected (status %d)", resp.StatusCode)
+	default:
+		result.Message = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return result
+}
+
+func configString(config map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := config[key].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func joinURL(base, path string) string {
+	if path == "" {
+		return base
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,341 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+	pkgbilling "carbon-scribe/project-portal/project-portal-backend/pkg/billing"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	invoiceBatchSize        = 100
+	defaultInvoiceURLExpiry = 15 * time.Minute
+)
+
+// ErrInvoiceStorageUnavailable is returned for invoice PDFs when no store
+// is configured
+var ErrInvoiceStorageUnavailable = errors.New("invoice storage is not configured")
+
+// InvoiceStore keeps rendered invoice PDFs and hands out time-limited links
+// to them. It is satisfied by storage.S3Client.
+type InvoiceStore interface {
+	UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error)
+	GeneratePresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// IssueInvoices finalises the draft invoices left by closed billing periods:
+// each gets tax for the customer's jurisdiction, the next number in its
+// series and a due date, then a stored PDF. PDFs that failed to render or
+// upload on an earlier run are retried.
+func (s *service) IssueInvoices(ctx context.Context) (*InvoiceRunResult, error) {
+	result := &InvoiceRunResult{}
+	after := uuid.Nil
+	for {
+		invoices, err := s.repo.ListInvoicesToIssue(ctx, s.cfg.InvoiceStore != nil, after, invoiceBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range invoices {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			inv := &invoices[i]
+			if inv.Status == "draft" {
+				finalized, err := s.finalizeInvoice(ctx, inv, time.Now().UTC())
+				if err != nil {
+					result.Failed++
+					log.Printf("settings: finalize invoice %s: %v", inv.ID, err)
+					continue
+				}
+				if !finalized {
+					result.Skipped++
+					continue
+				}
+				result.Finalized++
+			}
+			if s.cfg.InvoiceStore == nil {
+				continue
+			}
+			if err := s.storeInvoicePDF(ctx, inv); err != nil {
+				result.Failed++
+				log.Printf("settings: render invoice %s: %v", inv.InvoiceNumber, err)
+				continue
+			}
+			result.Rendered++
+		}
+		if len(invoices) < invoiceBatchSize {
+			return result, nil
+		}
+		after = invoices[len(invoices)-1].ID
+	}
+}
+
+func (s *service) finalizeInvoice(ctx context.Context, inv *Invoice, now time.Time) (bool, error) {
+	profile, err := s.repo.GetOrCreateProfile(ctx, inv.UserID)
+	if err != nil {
+		return false, err
+	}
+	rate := s.cfg.TaxRates.Lookup(addressField(profile.Address, "country", "country_code"), addressField(profile.Address, "region", "state", "province"))
+	subtotal := amountToCents(inv.Amount)
+	tax := rate.Tax(subtotal)
+	due := now.AddDate(0, 0, s.cfg.PaymentTermsDays)
+
+	inv.Kind = settingsbilling.KindInvoice
+	inv.TaxJurisdiction = rate.Jurisdiction
+	inv.TaxRate = rate.BasisPoints
+	inv.TaxAmount = centsToAmount(tax)
+	inv.TotalAmount = centsToAmount(subtotal + tax)
+	inv.Status = "open"
+	inv.FinalizedAt = &now
+	inv.DueDate = &due
+	finalized, err := s.repo.FinalizeInvoice(ctx, inv, settingsbilling.NumberSeries(inv.Kind, now))
+	if err != nil || !finalized {
+		return finalized, err
+	}
+	s.audit("billing.invoice.finalized", inv.UserID, map[string]interface{}{
+		"invoice_id": inv.ID, "invoice_number": inv.InvoiceNumber, "total": inv.TotalAmount, "tax_jurisdiction": inv.TaxJurisdiction,
+	})
+	return true, nil
+}
+
+// storeInvoicePDF renders an issued invoice or credit note and uploads it
+func (s *service) storeInvoicePDF(ctx context.Context, inv *Invoice) error {
+	if s.cfg.InvoiceStore == nil {
+		return ErrInvoiceStorageUnavailable
+	}
+	doc, err := s.invoiceDocument(ctx, inv)
+	if err != nil {
+		return err
+	}
+	data, err := s.invoiceGenerator.GeneratePDF(doc)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("invoices/%s/%s.pdf", inv.UserID, inv.InvoiceNumber)
+	if _, err := s.cfg.InvoiceStore.UploadBytes(ctx, key, data, "application/pdf"); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if err := s.repo.SetInvoicePDF(ctx, inv.ID, key, now); err != nil {
+		return err
+	}
+	inv.PDFKey = key
+	inv.PDFGeneratedAt = &now
+	return nil
+}
+
+// refundCredit returns a credit on a paid invoice to the card it was paid
+// with, or to the account's credit balance when the invoice was not paid
+// through the processor or the refund is refused
+func (s *service) refundCredit(ctx context.Context, inv, note *Invoice, gross int64, reason string) error {
+	if inv.TransactionID != "" && s.cfg.PaymentProcessor != nil {
+		refund, err := s.cfg.PaymentProcessor.Refund(ctx, pkgbilling.RefundRequest{
+			ChargeID:       inv.TransactionID,
+			Amount:         gross,
+			Reason:         reason,
+			IdempotencyKey: "credit-note-" + note.ID.String(),
+		})
+		if err == nil {
+			note.TransactionID = refund.ID
+			note.PaymentMethod = inv.PaymentMethod
+			return s.repo.UpdateInvoicePayment(ctx, note)
+		}
+		log.Printf("settings: refund %s for credit note %s, crediting the account instead: %v", inv.TransactionID, note.InvoiceNumber, err)
+	}
+	sub, err := s.repo.GetSubscription(ctx, inv.UserID)
+	if err != nil {
+		return err
+	}
+	sub.CreditBalance = roundAmount(sub.CreditBalance + centsToAmount(gross))
+	return s.repo.SaveSubscription(ctx, sub)
+}
+
+func (s *service) invoiceDocument(ctx context.Context, inv *Invoice) (pkgbilling.InvoiceDocument, error) {
+	profile, err := s.repo.GetOrCreateProfile(ctx, inv.UserID)
+	if err != nil {
+		return pkgbilling.InvoiceDocument{}, err
+	}
+	var items []InvoiceLineItem
+	if len(inv.LineItems) > 0 {
+		if err := json.Unmarshal(inv.LineItems, &items); err != nil {
+			return pkgbilling.InvoiceDocument{}, fmt.Errorf("invoice line items: %w", err)
+		}
+	}
+	doc := pkgbilling.InvoiceDocument{
+		Title:       "Invoice",
+		Number:      inv.InvoiceNumber,
+		IssuedAt:    inv.CreatedAt,
+		DueDate:     inv.DueDate,
+		PeriodStart: inv.BillingPeriodStart,
+		PeriodEnd:   inv.BillingPeriodEnd,
+		Currency:    inv.Currency,
+		BillTo:      billToLines(profile),
+		Subtotal:    inv.Amount,
+		TaxLabel:    s.invoiceTaxLabel(inv),
+		TaxAmount:   inv.TaxAmount,
+		Total:       inv.TotalAmount,
+	}
+	if inv.FinalizedAt != nil {
+		doc.IssuedAt = *inv.FinalizedAt
+	}
+	if inv.Kind == settingsbilling.KindCreditNote {
+		doc.Title = "Credit note"
+		doc.DueDate = nil
+		doc.Notes = inv.Reason
+		if inv.CreditedInvoiceID != nil {
+			if credited, err := s.repo.GetInvoiceByID(ctx, *inv.CreditedInvoiceID); err == nil {
+				doc.Reference = "Credits invoice " + credited.InvoiceNumber
+			}
+		}
+	} else if inv.DueDate != nil {
+		doc.Notes = fmt.Sprintf("Payment is due by %s. Thank you for using CarbonScribe.", inv.DueDate.Format("2 January 2006"))
+	}
+	for _, item := range items {
+		doc.Lines = append(doc.Lines, pkgbilling.InvoiceLine{
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitAmount:  item.UnitAmount,
+			Amount:      item.Amount,
+		})
+	}
+	return doc, nil
+}
+
+// IssueCreditNote credits part or all of an issued invoice. Crediting an
+// unpaid invoice lowers what is due, voiding it once fully credited; a
+// refund on a paid invoice goes to the customer's account credit.
+func (s *service) IssueCreditNote(ctx context.Context, issuedBy, invoiceID uuid.UUID, req CreditNoteRequest) (*Invoice, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	inv, err := s.repo.GetInvoiceByID(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Kind == settingsbilling.KindCreditNote {
+		return nil, fmt.Errorf("a credit note cannot be credited")
+	}
+	if inv.Status != "open" && inv.Status != "paid" {
+		return nil, fmt.Errorf("only issued invoices can be credited, invoice is %s", inv.Status)
+	}
+	remaining := amountToCents(inv.TotalAmount) - amountToCents(inv.AmountCredited)
+	if remaining <= 0 {
+		return nil, fmt.Errorf("invoice %s has been fully credited", inv.InvoiceNumber)
+	}
+	gross := remaining
+	if req.Amount != 0 {
+		gross = amountToCents(req.Amount)
+	}
+	if gross <= 0 || gross > remaining {
+		return nil, fmt.Errorf("credit must be between 0.01 and %.2f", centsToAmount(remaining))
+	}
+	// The credit includes tax at the invoice's rate
+	net := int64(math.Round(float64(gross) * 10000 / float64(10000+inv.TaxRate)))
+	tax := gross - net
+
+	now := time.Now().UTC()
+	lineItems, _ := json.Marshal([]InvoiceLineItem{{
+		Kind:        "credit",
+		Description: fmt.Sprintf("Credit for invoice %s", inv.InvoiceNumber),
+		Quantity:    1,
+		UnitAmount:  -centsToAmount(net),
+		Amount:      -centsToAmount(net),
+		PeriodStart: inv.BillingPeriodStart,
+		PeriodEnd:   inv.BillingPeriodEnd,
+	}})
+	creditedID := inv.ID
+	note := &Invoice{
+		ID:                 uuid.New(),
+		SubscriptionID:     inv.SubscriptionID,
+		UserID:             inv.UserID,
+		Kind:               settingsbilling.KindCreditNote,
+		CreditedInvoiceID:  &creditedID,
+		Amount:             -centsToAmount(net),
+		Currency:           inv.Currency,
+		TaxAmount:          -centsToAmount(tax),
+		TotalAmount:        -centsToAmount(gross),
+		TaxJurisdiction:    inv.TaxJurisdiction,
+		TaxRate:            inv.TaxRate,
+		BillingPeriodStart: inv.BillingPeriodStart,
+		BillingPeriodEnd:   inv.BillingPeriodEnd,
+		Status:             "issued",
+		Reason:             reason,
+		FinalizedAt:        &now,
+		LineItems:          datatypes.JSON(lineItems),
+		CreatedAt:          now,
+	}
+	created, err := s.repo.CreateCreditNote(ctx, note, settingsbilling.NumberSeries(note.Kind, now))
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, fmt.Errorf("invoice %s was credited concurrently, retry with the remaining amount", inv.InvoiceNumber)
+	}
+	if inv.Status == "paid" {
+		if err := s.refundCredit(ctx, inv, note, gross, reason); err != nil {
+			return nil, err
+		}
+	}
+	// A failed render is retried by the invoicing job
+	if s.cfg.InvoiceStore != nil {
+		if err := s.storeInvoicePDF(ctx, note); err != nil {
+			log.Printf("settings: render credit note %s: %v", note.InvoiceNumber, err)
+		}
+	}
+	s.audit("billing.credit_note.issued", inv.UserID, map[string]interface{}{
+		"credit_note": note.InvoiceNumber, "invoice": inv.InvoiceNumber, "amount": centsToAmount(gross), "issued_by": issuedBy, "reason": reason,
+	})
+	return note, nil
+}
+
+func billToLines(profile *UserProfile) []string {
+	var lines []string
+	for _, v := range []string{profile.FullName, profile.Organization} {
+		if strings.TrimSpace(v) != "" {
+			lines = append(lines, strings.TrimSpace(v))
+		}
+	}
+	for _, keys := range [][]string{{"line1", "street"}, {"line2"}, {"city"}, {"region", "state", "province"}, {"postal_code", "zip"}, {"country", "country_code"}} {
+		if v := addressField(profile.Address, keys...); v != "" {
+			lines = append(lines, v)
+		}
+	}
+	return lines
+}
+
+func addressField(address datatypes.JSONMap, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := address[key].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// invoiceTaxLabel names the tax with the rate charged on the invoice, which
+// may differ from today's rate
+func (s *service) invoiceTaxLabel(inv *Invoice) string {
+	country, region, _ := strings.Cut(inv.TaxJurisdiction, "-")
+	rate := s.cfg.TaxRates.Lookup(country, region)
+	if rate.Name == "" {
+		rate.Name = "Tax"
+	}
+	rate.BasisPoints = inv.TaxRate
+	return rate.Label()
+}
+
+func amountToCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -3,33 +3,38 @@ package settings
 import (
 	"time"
 
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/datatypes"
 )
 
 type UserProfile struct {
-	ID                uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID            uuid.UUID         `gorm:"type:uuid;uniqueIndex;not null" json:"user_id"`
-	FullName          string            `gorm:"type:varchar(255)" json:"full_name,omitempty"`
-	DisplayName       string            `gorm:"type:varchar(100)" json:"display_name,omitempty"`
-	ProfilePictureURL string            `gorm:"type:text" json:"profile_picture_url,omitempty"`
-	Bio               string            `gorm:"type:text" json:"bio,omitempty"`
-	PhoneNumber       string            `gorm:"type:varchar(50)" json:"phone_number,omitempty"`
-	PhoneVerified     bool              `gorm:"default:false" json:"phone_verified"`
-	SecondaryEmail    string            `gorm:"type:varchar(255)" json:"secondary_email,omitempty"`
-	Address           datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"address,omitempty"`
-	Organization      string            `gorm:"type:varchar(255)" json:"organization,omitempty"`
-	JobTitle          string            `gorm:"type:varchar(100)" json:"job_title,omitempty"`
-	Website           string            `gorm:"type:varchar(500)" json:"website,omitempty"`
-	Language          string            `gorm:"type:varchar(10);default:'en'" json:"language"`
-	Timezone          string            `gorm:"type:varchar(50);default:'UTC'" json:"timezone"`
-	Currency          string            `gorm:"type:varchar(3);default:'USD'" json:"currency"`
-	DateFormat        string            `gorm:"type:varchar(20);default:'YYYY-MM-DD'" json:"date_format"`
-	VerificationLevel string            `gorm:"type:varchar(50);default:'basic'" json:"verification_level"`
-	VerificationData  datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"verification_data,omitempty"`
-	CreatedAt         time.Time         `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt         time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID            uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"user_id"`
+	FullName          string    `gorm:"type:varchar(255)" json:"full_name,omitempty"`
+	DisplayName       string    `gorm:"type:varchar(100)" json:"display_name,omitempty"`
+	ProfilePictureURL string    `gorm:"type:text" json:"profile_picture_url,omitempty"`
+	// ProfilePictureSizes maps thumbnail edge in pixels to its URL
+	ProfilePictureSizes datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"profile_picture_sizes,omitempty"`
+	ProfilePictureKeys  datatypes.JSON    `gorm:"type:jsonb" json:"-"` // stored files, deleted on replacement
+	Bio                 string            `gorm:"type:text" json:"bio,omitempty"`
+	PhoneNumber         string            `gorm:"type:varchar(50)" json:"phone_number,omitempty"`
+	PhoneVerified       bool              `gorm:"default:false" json:"phone_verified"`
+	SecondaryEmail      string            `gorm:"type:varchar(255)" json:"secondary_email,omitempty"`
+	Address             datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"address,omitempty"`
+	Organization        string            `gorm:"type:varchar(255)" json:"organization,omitempty"`
+	JobTitle            string            `gorm:"type:varchar(100)" json:"job_title,omitempty"`
+	Website             string            `gorm:"type:varchar(500)" json:"website,omitempty"`
+	Language            string            `gorm:"type:varchar(10);default:'en'" json:"language"`
+	Timezone            string            `gorm:"type:varchar(50);default:'UTC'" json:"timezone"`
+	Currency            string            `gorm:"type:varchar(3);default:'USD'" json:"currency"`
+	DateFormat          string            `gorm:"type:varchar(20);default:'YYYY-MM-DD'" json:"date_format"`
+	VerificationLevel   string            `gorm:"type:varchar(50);default:'basic'" json:"verification_level"`
+	VerificationData    datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"verification_data,omitempty"`
+	CreatedAt           time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 func (UserProfile) TableName() string { return "user_profiles" }
@@ -68,11 +73,63 @@ type APIKey struct {
 	IsActive           bool              `gorm:"default:true" json:"is_active"`
 	LastUsedAt         *time.Time        `json:"last_used_at,omitempty"`
 	Metadata           datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"metadata,omitempty"`
+	WebhookSecret      string            `gorm:"type:text" json:"-"` // vault-encrypted webhook signing secret
 	CreatedAt          time.Time         `gorm:"autoCreateTime" json:"created_at"`
 }
 
 func (APIKey) TableName() string { return "api_keys" }
 
+// APIKeyWebhookDelivery is one attempt series to deliver an API key event to
+// a subscribed URL. Payload holds the exact body sent, so replays match.
+type APIKeyWebhookDelivery struct {
+	ID             uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	KeyID          uuid.UUID      `gorm:"type:uuid;index;not null" json:"key_id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"`
+	EventID        uuid.UUID      `gorm:"type:uuid;index;not null" json:"event_id"`
+	EventType      string         `gorm:"type:varchar(100);not null" json:"event_type"`
+	TargetURL      string         `gorm:"type:text;not null" json:"target_url"`
+	Payload        datatypes.JSON `gorm:"type:jsonb;not null" json:"payload"`
+	Status         string         `gorm:"type:varchar(20);index;not null" json:"status"` // pending, succeeded, failed
+	Attempts       int            `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time     `gorm:"index" json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time     `json:"last_attempt_at,omitempty"`
+	ResponseStatus int            `json:"response_status,omitempty"`
+	ResponseBody   string         `gorm:"type:text" json:"response_body,omitempty"`
+	LastError      string         `gorm:"type:text" json:"last_error,omitempty"`
+	ReplayOf       *uuid.UUID     `gorm:"type:uuid" json:"replay_of,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (APIKeyWebhookDelivery) TableName() string { return "api_key_webhook_deliveries" }
+
+// APIKeyHourlyUsage is the request count of one key in one hour, across
+// endpoints and status codes
+type APIKeyHourlyUsage struct {
+	KeyID       uuid.UUID
+	UserID      uuid.UUID
+	BucketStart time.Time
+	Requests    int64
+}
+
+// APIKeyUsageBucket counts the requests one key made to one endpoint with
+// one status code during an hour
+type APIKeyUsageBucket struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	KeyID          uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_api_key_usage_bucket,priority:1" json:"key_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+	BucketStart    time.Time `gorm:"not null;uniqueIndex:idx_api_key_usage_bucket,priority:2" json:"bucket_start"`
+	Endpoint       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_api_key_usage_bucket,priority:3" json:"endpoint"`
+	Method         string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_api_key_usage_bucket,priority:4" json:"method"`
+	StatusCode     int       `gorm:"not null;uniqueIndex:idx_api_key_usage_bucket,priority:5" json:"status_code"`
+	RequestCount   int64     `gorm:"not null;default:0" json:"request_count"`
+	RateLimited    int64     `gorm:"not null;default:0" json:"rate_limited"`
+	TotalLatencyMs int64     `gorm:"not null;default:0" json:"total_latency_ms"`
+	MaxLatencyMs   int       `gorm:"not null;default:0" json:"max_latency_ms"`
+}
+
+func (APIKeyUsageBucket) TableName() string { return "api_key_usage_buckets" }
+
 type IntegrationConfiguration struct {
 	ID                       uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	UserID                   uuid.UUID         `gorm:"type:uuid;index;not null" json:"user_id"`
@@ -85,7 +142,7 @@ type IntegrationConfiguration struct {
 	LastSuccessfulConnection *time.Time        `json:"last_successful_connection,omitempty"`
 	ConnectionError          string            `gorm:"type:text" json:"connection_error,omitempty"`
 	WebhookURL               string            `gorm:"type:text" json:"webhook_url,omitempty"`
-	WebhookSecret            string            `gorm:"type:varchar(255)" json:"-"`
+	WebhookSecret            string            `gorm:"type:text" json:"-"`
 	WebhookLastDelivered     *time.Time        `json:"webhook_last_delivered,omitempty"`
 	Metadata                 datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"metadata,omitempty"`
 	CreatedAt                time.Time         `gorm:"autoCreateTime" json:"created_at"`
@@ -94,25 +151,62 @@ type IntegrationConfiguration struct {
 
 func (IntegrationConfiguration) TableName() string { return "integration_configurations" }
 
+// OAuthState is a pending authorization-code flow. Only the SHA-256 of the
+// state is stored, and the PKCE verifier is encrypted.
+type OAuthState struct {
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	StateHash    string         `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	UserID       uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"`
+	Provider     string         `gorm:"type:varchar(100);not null" json:"provider"`
+	CodeVerifier string         `gorm:"type:text;not null" json:"-"`
+	RedirectURL  string         `gorm:"type:text;not null" json:"redirect_url"`
+	Scopes       pq.StringArray `gorm:"type:text[];default:'{}'" json:"scopes"`
+	ExpiresAt    time.Time      `gorm:"index;not null" json:"expires_at"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (OAuthState) TableName() string { return "oauth_states" }
+
 type Subscription struct {
-	ID                 uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID             uuid.UUID         `gorm:"type:uuid;index;not null" json:"user_id"`
-	PlanID             string            `gorm:"type:varchar(100);not null" json:"plan_id"`
-	PlanName           string            `gorm:"type:varchar(255);not null" json:"plan_name"`
-	BillingCycle       string            `gorm:"type:varchar(20);not null" json:"billing_cycle"`
-	Status             string            `gorm:"type:varchar(50);default:'active'" json:"status"`
-	CurrentPeriodStart time.Time         `json:"current_period_start"`
-	CurrentPeriodEnd   time.Time         `json:"current_period_end"`
-	CanceledAt         *time.Time        `json:"canceled_at,omitempty"`
-	PaymentMethodID    string            `gorm:"type:varchar(255)" json:"payment_method_id,omitempty"`
-	PaymentMethodType  string            `gorm:"type:varchar(50)" json:"payment_method_type,omitempty"`
-	UsageMetrics       datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"usage_metrics,omitempty"`
-	CreatedAt          time.Time         `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt          time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                  uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID              uuid.UUID         `gorm:"type:uuid;index;not null" json:"user_id"`
+	PlanID              string            `gorm:"type:varchar(100);not null" json:"plan_id"`
+	PlanName            string            `gorm:"type:varchar(255);not null" json:"plan_name"`
+	BillingCycle        string            `gorm:"type:varchar(20);not null" json:"billing_cycle"`
+	Status              string            `gorm:"type:varchar(50);default:'active'" json:"status"`
+	CurrentPeriodStart  time.Time         `json:"current_period_start"`
+	CurrentPeriodEnd    time.Time         `json:"current_period_end"`
+	CanceledAt          *time.Time        `json:"canceled_at,omitempty"`
+	PaymentMethodID     string            `gorm:"type:text" json:"payment_method_id,omitempty"`
+	PaymentMethodType   string            `gorm:"type:varchar(50)" json:"payment_method_type,omitempty"`
+	UsageMetrics        datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"usage_metrics,omitempty"`
+	TrialEndsAt         *time.Time        `json:"trial_ends_at,omitempty"`
+	TrialUsed           bool              `gorm:"default:false" json:"trial_used"`
+	CancelAtPeriodEnd   bool              `gorm:"default:false" json:"cancel_at_period_end"`
+	CreditBalance       float64           `gorm:"type:numeric(10,2);default:0" json:"credit_balance"`      // owed to the customer
+	QuotaWarnings       datatypes.JSONMap `gorm:"type:jsonb;default:'{}'" json:"quota_warnings,omitempty"` // quota -> level warned this period
+	UsageCollectedAt    *time.Time        `json:"usage_collected_at,omitempty"`
+	ProcessorCustomerID string            `gorm:"type:varchar(255)" json:"-"`
+	PaymentMethodLast4  string            `gorm:"type:varchar(4)" json:"payment_method_last4,omitempty"`
+	UnpaidSince         *time.Time        `json:"unpaid_since,omitempty"` // retries exhausted; canceled after the dunning grace period
+	CreatedAt           time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 func (Subscription) TableName() string { return "subscriptions" }
 
+// InvoiceLineItem is one entry of Invoice.LineItems. Amounts are in the
+// invoice currency; credits are negative.
+type InvoiceLineItem struct {
+	Kind        string    `json:"kind"` // subscription, proration_credit, proration_charge
+	Description string    `json:"description"`
+	Quantity    float64   `json:"quantity"`
+	UnitAmount  float64   `json:"unit_amount"`
+	Amount      float64   `json:"amount"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
 type Invoice struct {
 	ID                 uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	SubscriptionID     *uuid.UUID     `gorm:"type:uuid" json:"subscription_id,omitempty"`
@@ -125,20 +219,80 @@ type Invoice struct {
 	BillingPeriodStart time.Time      `json:"billing_period_start"`
 	BillingPeriodEnd   time.Time      `json:"billing_period_end"`
 	Status             string         `gorm:"type:varchar(50);default:'draft'" json:"status"`
+	Kind               string         `gorm:"type:varchar(20);default:'invoice'" json:"kind"`       // invoice or credit_note
+	CreditedInvoiceID  *uuid.UUID     `gorm:"type:uuid;index" json:"credited_invoice_id,omitempty"` // invoice a credit note applies to
+	AmountCredited     float64        `gorm:"type:numeric(10,2);default:0" json:"amount_credited"`  // total of credit notes against this invoice
+	TaxJurisdiction    string         `gorm:"type:varchar(20)" json:"tax_jurisdiction,omitempty"`
+	TaxRate            int64          `gorm:"default:0" json:"tax_rate_basis_points"`
+	Reason             string         `gorm:"type:text" json:"reason,omitempty"`
+	FinalizedAt        *time.Time     `json:"finalized_at,omitempty"`
 	DueDate            *time.Time     `json:"due_date,omitempty"`
 	PaidAt             *time.Time     `json:"paid_at,omitempty"`
 	PaymentMethod      string         `gorm:"type:varchar(50)" json:"payment_method,omitempty"`
-	TransactionID      string         `gorm:"type:varchar(255)" json:"transaction_id,omitempty"`
+	TransactionID      string         `gorm:"type:varchar(255);index" json:"transaction_id,omitempty"` // processor charge id
+	PaymentAttempts    int            `gorm:"default:0" json:"payment_attempts"`
+	NextPaymentAttempt *time.Time     `gorm:"index" json:"next_payment_attempt,omitempty"`
+	LastPaymentError   string         `gorm:"type:text" json:"last_payment_error,omitempty"`
 	LineItems          datatypes.JSON `gorm:"type:jsonb;default:'[]'" json:"line_items"`
-	PDFURL             string         `gorm:"type:text" json:"pdf_url,omitempty"`
+	PDFURL             string         `gorm:"type:text" json:"pdf_url,omitempty"` // legacy; PDFs are now served through presigned URLs
+	PDFKey             string         `gorm:"type:text" json:"-"`                 // object key of the stored PDF
 	PDFGeneratedAt     *time.Time     `json:"pdf_generated_at,omitempty"`
 	CreatedAt          time.Time      `gorm:"autoCreateTime" json:"created_at"`
 }
 
 func (Invoice) TableName() string { return "invoices" }
 
+// PaymentWebhookEvent records a processed payment processor webhook, so
+// redeliveries are ignored
+type PaymentWebhookEvent struct {
+	ID         string    `gorm:"type:varchar(255);primary_key" json:"id"`
+	Type       string    `gorm:"type:varchar(50);not null" json:"type"`
+	ChargeID   string    `gorm:"type:varchar(255)" json:"charge_id"`
+	ReceivedAt time.Time `gorm:"not null" json:"received_at"`
+}
+
+func (PaymentWebhookEvent) TableName() string { return "payment_webhook_events" }
+
+// AccountExport is a requested archive of everything a user's account
+// holds across modules. The archive is stored until ExpiresAt.
+type AccountExport struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"`
+	Status      string         `gorm:"type:varchar(20);index;not null" json:"status"` // pending, processing, completed, failed, expired
+	ObjectKey   string         `gorm:"type:text" json:"-"`
+	SizeBytes   int64          `json:"size_bytes,omitempty"`
+	Manifest    datatypes.JSON `gorm:"type:jsonb" json:"manifest,omitempty"`
+	Error       string         `gorm:"type:text" json:"error,omitempty"`
+	RequestedAt time.Time      `gorm:"not null" json:"requested_at"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time     `gorm:"index" json:"expires_at,omitempty"`
+	// DownloadURL is a presigned link, filled in when a completed export is
+	// fetched
+	DownloadURL       string     `gorm:"-" json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `gorm:"-" json:"download_expires_at,omitempty"`
+}
+
+func (AccountExport) TableName() string { return "account_exports" }
+
+// AccountExportRunResult summarises an export worker pass
+type AccountExportRunResult struct {
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Expired   int `json:"expired"`
+}
+
+// InvoiceSequence holds the last number issued in an invoice number series
+type InvoiceSequence struct {
+	Series    string `gorm:"type:varchar(20);primary_key" json:"series"`
+	LastValue int    `gorm:"not null;default:0" json:"last_value"`
+}
+
+func (InvoiceSequence) TableName() string { return "invoice_sequences" }
+
 type APIKeyPublic struct {
 	ID                 uuid.UUID         `json:"id"`
+	UserID             uuid.UUID         `json:"user_id"`
 	Name               string            `json:"name"`
 	KeyPrefix          string            `json:"key_prefix"`
 	KeyLastFour        string            `json:"key_last_four"`
@@ -150,6 +304,17 @@ type APIKeyPublic struct {
 	LastUsedAt         *time.Time        `json:"last_used_at,omitempty"`
 	Metadata           datatypes.JSONMap `json:"metadata,omitempty"`
 	CreatedAt          time.Time         `json:"created_at"`
+	// Set only in the response that created the webhook signing secret
+	WebhookSigningSecret string `json:"webhook_signing_secret,omitempty"`
+}
+
+// APIKeyWebhookRunResult summarises a webhook scheduling and delivery pass
+type APIKeyWebhookRunResult struct {
+	ExpiringNotified int `json:"expiring_notified"`
+	SpikesDetected   int `json:"spikes_detected"`
+	Delivered        int `json:"delivered"`
+	Retrying         int `json:"retrying"`
+	Failed           int `json:"failed"`
 }
 
 type IntegrationConfigurationPublic struct {
@@ -204,12 +369,13 @@ type UpdateNotificationPreferencesRequest struct {
 }
 
 type CreateAPIKeyRequest struct {
-	Name               string                 `json:"name"`
-	Scopes             []string               `json:"scopes"`
-	RateLimitPerMinute int                    `json:"rate_limit_per_minute"`
-	RateLimitPerDay    int                    `json:"rate_limit_per_day"`
-	ExpiresAt          *time.Time             `json:"expires_at"`
-	Metadata           map[string]interface{} `json:"metadata"`
+	Name               string                      `json:"name"`
+	Scopes             []string                    `json:"scopes"`
+	RateLimitPerMinute int                         `json:"rate_limit_per_minute"`
+	RateLimitPerDay    int                         `json:"rate_limit_per_day"`
+	ExpiresAt          *time.Time                  `json:"expires_at"`
+	Metadata           map[string]interface{}      `json:"metadata"`
+	Webhooks           []APIKeyWebhookSubscription `json:"webhooks"`
 }
 
 type CreateAPIKeyResponse struct {
@@ -228,6 +394,73 @@ type ConfigureIntegrationRequest struct {
 	Metadata        map[string]interface{} `json:"metadata"`
 }
 
+type ChangePlanRequest struct {
+	PlanID       string `json:"plan_id"`
+	BillingCycle string `json:"billing_cycle"` // defaults to the current cycle
+	StartTrial   bool   `json:"start_trial"`
+}
+
+type ChangePlanResponse struct {
+	Subscription *Subscription              `json:"subscription"`
+	Proration    *settingsbilling.Proration `json:"proration,omitempty"`
+	Invoice      *Invoice                   `json:"invoice,omitempty"`
+}
+
+// Entitlements is what the caller's plan allows and how much is used
+type Entitlements struct {
+	PlanID   string                 `json:"plan_id"`
+	PlanName string                 `json:"plan_name"`
+	Status   string                 `json:"status"`
+	Features []string               `json:"features"`
+	Quotas   map[string]QuotaStatus `json:"quotas"`
+}
+
+type QuotaStatus struct {
+	Limit     int64  `json:"limit"` // -1 when unlimited
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`         // -1 when unlimited
+	Warning   string `json:"warning,omitempty"` // approaching or exceeded
+	Metered   bool   `json:"metered"`           // usage over the limit is billed, not refused
+}
+
+// QuotaWarning tells a user their usage is close to or over a plan quota
+type QuotaWarning struct {
+	UserID    uuid.UUID `json:"user_id"`
+	PlanID    string    `json:"plan_id"`
+	Quota     string    `json:"quota"`
+	Level     string    `json:"level"`
+	Used      int64     `json:"used"`
+	Limit     int64     `json:"limit"`
+	PeriodEnd time.Time `json:"period_end"`
+}
+
+// UsageSummary is the metered usage of the current billing period and
+// what it would add to the next invoice
+type UsageSummary struct {
+	PeriodStart      time.Time              `json:"period_start"`
+	PeriodEnd        time.Time              `json:"period_end"`
+	CollectedAt      *time.Time             `json:"collected_at,omitempty"`
+	Metrics          map[string]int64       `json:"metrics"`
+	Quotas           map[string]QuotaStatus `json:"quotas"`
+	EstimatedCharges []InvoiceLineItem      `json:"estimated_charges"`
+}
+
+// UsageCollectionResult summarises a metering pass over all subscriptions
+type UsageCollectionResult struct {
+	Subscriptions int `json:"subscriptions"`
+	Failed        int `json:"failed"` // meter errors; other metrics were still stored
+	Warnings      int `json:"warnings"`
+}
+
+// SubscriptionRenewalResult summarises a pass over subscriptions whose
+// period has ended
+type SubscriptionRenewalResult struct {
+	Renewed         int `json:"renewed"`
+	TrialsConverted int `json:"trials_converted"`
+	Canceled        int `json:"canceled"`
+	Invoiced        int `json:"invoiced"`
+}
+
 type AddPaymentMethodRequest struct {
 	PaymentMethodID   string `json:"payment_method_id"`
 	PaymentMethodType string `json:"payment_method_type"`
@@ -252,6 +485,43 @@ type APIKeyUsageAnalytics struct {
 	LastRateLimitExceeded *time.Time `json:"last_rate_limit_exceeded,omitempty"`
 	RateLimitPerMinute    int        `json:"rate_limit_per_minute"`
 	RateLimitPerDay       int        `json:"rate_limit_per_day"`
+	// Persisted history for the requested range
+	From                time.Time             `json:"from"`
+	To                  time.Time             `json:"to"`
+	Granularity         string                `json:"granularity"`
+	Requests            int64                 `json:"requests"`
+	Errors              int64                 `json:"errors"`
+	ErrorRate           float64               `json:"error_rate"`
+	RateLimitRejections int64                 `json:"rate_limit_rejections"`
+	AvgLatencyMs        float64               `json:"avg_latency_ms"`
+	StatusClasses       map[string]int64      `json:"status_classes"`
+	TimeSeries          []APIKeyUsagePoint    `json:"time_series"`
+	TopEndpoints        []APIKeyEndpointUsage `json:"top_endpoints"`
+}
+
+// APIKeyUsageRange selects the history returned with usage analytics
+type APIKeyUsageRange struct {
+	From        time.Time
+	To          time.Time
+	Granularity string // hour or day; empty picks one from the range length
+}
+
+type APIKeyUsagePoint struct {
+	BucketStart  time.Time `json:"bucket_start"`
+	Requests     int64     `json:"requests"`
+	Errors       int64     `json:"errors"`
+	RateLimited  int64     `json:"rate_limited"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+}
+
+type APIKeyEndpointUsage struct {
+	Method       string  `json:"method"`
+	Endpoint     string  `json:"endpoint"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs int     `json:"max_latency_ms"`
 }
 
 type ValidateAPIKeyRequest struct {
@@ -277,6 +547,7 @@ type OAuthStartResponse struct {
 	RedirectURL  string    `json:"redirect_url"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	CallbackPath string    `json:"callback_path"`
+	Scopes       []string  `json:"scopes,omitempty"`
 }
 
 type OAuthCallbackRequest struct {
@@ -305,6 +576,36 @@ type IntegrationHealthResponse struct {
 	LastCheckedAt    time.Time  `json:"last_checked_at"`
 	LastSuccessfulAt *time.Time `json:"last_successful_at,omitempty"`
 	ConnectionError  string     `json:"connection_error,omitempty"`
+	// OAuth integrations only
+	ReconsentRequired bool       `json:"reconsent_required,omitempty"`
+	TokenExpiresAt    *time.Time `json:"token_expires_at,omitempty"`
+	// Result of the live probe and history over the requested window
+	LatencyMs    int                           `json:"latency_ms"`
+	StatusCode   int                           `json:"status_code,omitempty"`
+	Window       string                        `json:"window"`
+	Checks       int                           `json:"checks"`
+	UptimePct    float64                       `json:"uptime_pct"`
+	AvgLatencyMs float64                       `json:"avg_latency_ms"`
+	Trend        []IntegrationHealthTrendPoint `json:"trend"`
+}
+
+// IntegrationHealthTrendPoint aggregates the probes of one time bucket
+type IntegrationHealthTrendPoint struct {
+	BucketStart  time.Time `json:"bucket_start"`
+	Checks       int       `json:"checks"`
+	Failures     int       `json:"failures"`
+	UptimePct    float64   `json:"uptime_pct"`
+	AvgLatencyMs float64   `json:"avg_latency_ms"`
+	MaxLatencyMs int       `json:"max_latency_ms"`
+}
+
+// IntegrationProbeRunResult summarises a scheduled probe pass
+type IntegrationProbeRunResult struct {
+	Probed   int   `json:"probed"`
+	Healthy  int   `json:"healthy"`
+	Degraded int   `json:"degraded"`
+	Down     int   `json:"down"`
+	Pruned   int64 `json:"pruned"`
 }
 
 type InvoicePDFResponse struct {
@@ -312,11 +613,50 @@ type InvoicePDFResponse struct {
 	InvoiceNumber string     `json:"invoice_number"`
 	PDFURL        string     `json:"pdf_url"`
 	GeneratedAt   *time.Time `json:"generated_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // when the presigned URL stops working
+}
+
+// CreditNoteRequest refunds part or all of a finalised invoice. Amount
+// includes tax; zero credits whatever has not been credited yet.
+type CreditNoteRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// PaymentRunResult summarises a payment collection and dunning pass
+type PaymentRunResult struct {
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	Pending   int `json:"pending"` // settling asynchronously
+	Failed    int `json:"failed"`
+	Errors    int `json:"errors"` // processor unreachable, retried next run
+	Canceled  int `json:"canceled"`
+}
+
+// BillingNotice is a billing event the customer is told about
+type BillingNotice struct {
+	Kind          string     `json:"kind"` // payment_succeeded, payment_failed, payment_disputed, subscription_canceled
+	UserID        uuid.UUID  `json:"user_id"`
+	InvoiceNumber string     `json:"invoice_number,omitempty"`
+	Amount        float64    `json:"amount,omitempty"`
+	Currency      string     `json:"currency,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	NextAttempt   *time.Time `json:"next_attempt,omitempty"` // when a failed payment is retried
+	Status        string     `json:"status,omitempty"`       // subscription status after the event
+}
+
+// InvoiceRunResult summarises an invoicing pass
+type InvoiceRunResult struct {
+	Finalized int `json:"finalized"`
+	Rendered  int `json:"rendered"`
+	Skipped   int `json:"skipped"` // finalised concurrently
+	Failed    int `json:"failed"`
 }
 
 type ProfilePictureUploadResponse struct {
-	ProfilePictureURL string `json:"profile_picture_url"`
-	Message           string `json:"message"`
+	ProfilePictureURL string            `json:"profile_picture_url"`
+	Sizes             datatypes.JSONMap `json:"sizes"`
+	Message           string            `json:"message"`
 }
 
 func defaultNotificationCategories() datatypes.JSONMap {
@@ -0,0 +1,240 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/integration"
+	settingsintegrations "carbon-scribe/project-portal/project-portal-backend/internal/settings/integrations"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOAuthRefreshWindow = 5 * time.Minute
+	oauthRefreshBatchSize     = 100
+	oauthRefreshLease         = 2 * time.Minute // holds a token while one replica refreshes it
+	oauthRefreshBackoffBase   = 30 * time.Second
+	oauthRefreshBackoffMax    = 30 * time.Minute
+)
+
+// OAuthRefreshResult summarises one refresh pass
+type OAuthRefreshResult struct {
+	Checked           int `json:"checked"`
+	Refreshed         int `json:"refreshed"`
+	Retrying          int `json:"retrying"`
+	ReconsentRequired int `json:"reconsent_required"`
+	Skipped           int `json:"skipped"`
+}
+
+// RefreshExpiringOAuthTokens renews access tokens that expire within the
+// refresh window. Rejected refresh tokens mark the integration as needing
+// re-consent; other failures are retried with exponential backoff.
+func (s *service) RefreshExpiringOAuthTokens(ctx context.Context) (*OAuthRefreshResult, error) {
+	now := time.Now().UTC()
+	tokens, err := s.repo.ListRefreshableOAuthTokens(ctx, now.Add(s.cfg.OAuthRefreshWindow), now, oauthRefreshBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	result := &OAuthRefreshResult{}
+	for i := range tokens {
+		if ctx.Err() != nil {
+			break
+		}
+		result.Checked++
+		claimed, err := s.repo.ClaimOAuthTokenRefresh(ctx, tokens[i].ID, now, now.Add(oauthRefreshLease))
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			result.Skipped++
+			continue
+		}
+		switch outcome := s.refreshOAuthToken(ctx, &tokens[i]); outcome {
+		case refreshSucceeded:
+			result.Refreshed++
+		case refreshRetrying:
+			result.Retrying++
+		case refreshNeedsConsent:
+			result.ReconsentRequired++
+		default:
+			result.Skipped++
+		}
+	}
+	return result, nil
+}
+
+type refreshOutcome int
+
+const (
+	refreshSkipped refreshOutcome = iota
+	refreshSucceeded
+	refreshRetrying
+	refreshNeedsConsent
+)
+
+func (s *service) refreshOAuthToken(ctx context.Context, token *integration.OAuthToken) refreshOutcome {
+	integrationID, err := uuid.Parse(token.ConnectionID)
+	if err != nil {
+		return refreshSkipped
+	}
+	item, err := s.repo.GetIntegrationByID(ctx, integrationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The integration is gone, so is any reason to keep its token
+		_ = s.repo.DeleteOAuthToken(ctx, token.ConnectionID)
+		return refreshSkipped
+	}
+	if err != nil {
+		log.Printf("settings: oauth refresh: failed to load integration %s: %v", token.ConnectionID, err)
+		return refreshSkipped
+	}
+	p, ok := s.oauthProviders.Get(token.Provider)
+	if !ok {
+		s.recordRefreshFailure(ctx, item, token, fmt.Errorf("oauth is not configured for %s", token.Provider), false)
+		return refreshRetrying
+	}
+	_, refreshToken, err := s.oauthTokenSecrets(token)
+	if err != nil {
+		s.recordRefreshFailure(ctx, item, token, err, false)
+		return refreshRetrying
+	}
+
+	started := time.Now().UTC()
+	refreshed, err := s.oauthClient.RefreshToken(ctx, p, refreshToken)
+	latency := time.Since(started)
+	if err != nil {
+		if settingsintegrations.IsInvalidGrant(err) {
+			s.requireReconsent(ctx, item, token, err)
+			return refreshNeedsConsent
+		}
+		s.recordRefreshFailure(ctx, item, token, err, settingsintegrations.IsTransient(err))
+		return refreshRetrying
+	}
+
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = refreshToken
+	}
+	if err := s.setOAuthTokenSecrets(token, refreshed.AccessToken, refreshed.RefreshToken); err != nil {
+		s.recordRefreshFailure(ctx, item, token, err, false)
+		return refreshRetrying
+	}
+	token.ExpiresAt = time.Time{}
+	if expiresAt := refreshed.ExpiresAt(started); expiresAt != nil {
+		token.ExpiresAt = *expiresAt
+	}
+	if refreshed.TokenType != "" {
+		token.TokenType = refreshed.TokenType
+	}
+	if refreshed.Scope != "" {
+		token.Scope = refreshed.Scope
+	}
+	token.RefreshFailures = 0
+	token.NextRefreshAt = nil
+	token.LastRefreshError = ""
+	if err := s.repo.SaveOAuthToken(ctx, token); err != nil {
+		log.Printf("settings: oauth refresh: failed to save token for %s: %v", item.ID, err)
+		return refreshRetrying
+	}
+
+	now := time.Now().UTC()
+	item.IsValid = true
+	item.ConnectionError = ""
+	item.LastSuccessfulConnection = &now
+	item.Metadata = ensureJSONMap(item.Metadata)
+	item.Metadata["oauth_refreshed_at"] = now.Format(time.RFC3339)
+	if token.ExpiresAt.IsZero() {
+		delete(item.Metadata, "oauth_token_expires_at")
+	} else {
+		item.Metadata["oauth_token_expires_at"] = token.ExpiresAt.Format(time.RFC3339)
+	}
+	s.saveRefreshedIntegration(ctx, item)
+	s.recordOAuthHealth(ctx, item, "healthy", latency, "oauth token refreshed")
+	return refreshSucceeded
+}
+
+// requireReconsent drops a refresh token the provider no longer accepts and
+// flags the integration until the user authorizes it again
+func (s *service) requireReconsent(ctx context.Context, item *IntegrationConfiguration, token *integration.OAuthToken, cause error) {
+	token.RefreshToken = ""
+	token.NextRefreshAt = nil
+	token.LastRefreshError = cause.Error()
+	if err := s.repo.SaveOAuthToken(ctx, token); err != nil {
+		log.Printf("settings: oauth refresh: failed to save token for %s: %v", item.ID, err)
+	}
+
+	item.IsValid = false
+	item.ConnectionError = "oauth authorization expired or was revoked; reconnect the integration"
+	item.Metadata = ensureJSONMap(item.Metadata)
+	item.Metadata["oauth_reconsent_required"] = true
+	s.saveRefreshedIntegration(ctx, item)
+	s.recordOAuthHealth(ctx, item, "down", 0, cause.Error())
+	s.audit("integration.oauth.reconsent_required", item.UserID, map[string]interface{}{"provider": token.Provider, "integration_id": item.ID})
+}
+
+// recordRefreshFailure schedules the next attempt. Transient failures back
+// off exponentially; anything else waits the maximum delay. The integration
+// is only marked invalid once its access token has actually expired or the
+// failure is not transient.
+func (s *service) recordRefreshFailure(ctx context.Context, item *IntegrationConfiguration, token *integration.OAuthToken, cause error, transient bool) {
+	now := time.Now().UTC()
+	token.RefreshFailures++
+	delay := oauthRefreshBackoffMax
+	if transient {
+		delay = refreshBackoff(token.RefreshFailures)
+	}
+	next := now.Add(delay)
+	token.NextRefreshAt = &next
+	token.LastRefreshError = cause.Error()
+	if err := s.repo.SaveOAuthToken(ctx, token); err != nil {
+		log.Printf("settings: oauth refresh: failed to save token for %s: %v", item.ID, err)
+	}
+
+	status := "degraded"
+	if !transient || !token.ExpiresAt.After(now) {
+		status = "down"
+		item.IsValid = false
+		item.ConnectionError = fmt.Sprintf("oauth token refresh failing: %v", cause)
+		s.saveRefreshedIntegration(ctx, item)
+	}
+	s.recordOAuthHealth(ctx, item, status, 0, fmt.Sprintf("oauth token refresh failed (attempt %d, next at %s): %v",
+		token.RefreshFailures, next.Format(time.RFC3339), cause))
+}
+
+func (s *service) saveRefreshedIntegration(ctx context.Context, item *IntegrationConfiguration) {
+	if err := s.repo.UpsertIntegration(ctx, item); err != nil {
+		log.Printf("settings: oauth refresh: failed to update integration %s: %v", item.ID, err)
+	}
+}
+
+func (s *service) recordOAuthHealth(ctx context.Context, item *IntegrationConfiguration, status string, latency time.Duration, message string) {
+	health := &integration.IntegrationHealth{
+		ID:           uuid.New().String(),
+		ConnectionID: item.ID.String(),
+		Status:       status,
+		LatencyMs:    int(latency / time.Millisecond),
+		CheckedAt:    time.Now().UTC(),
+		Message:      message,
+	}
+	if status != "healthy" {
+		health.ErrorRate = 1
+	}
+	if err := s.repo.RecordIntegrationHealth(ctx, health); err != nil {
+		log.Printf("settings: oauth refresh: failed to record health for %s: %v", item.ID, err)
+	}
+}
+
+// refreshBackoff doubles the delay with every consecutive failure
+func refreshBackoff(failures int) time.Duration {
+	delay := oauthRefreshBackoffBase
+	for i := 1; i < failures && delay < oauthRefreshBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > oauthRefreshBackoffMax {
+		delay = oauthRefreshBackoffMax
+	}
+	return delay
+}
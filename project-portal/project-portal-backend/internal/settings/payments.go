@@ -0,0 +1,399 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+	pkgbilling "carbon-scribe/project-portal/project-portal-backend/pkg/billing"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/email"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const paymentBatchSize = 100
+
+// ErrPaymentsUnavailable is returned when no payment processor is configured
+var ErrPaymentsUnavailable = errors.New("payment processing is not configured")
+
+// BillingNotifier tells customers about payments and dunning
+type BillingNotifier interface {
+	NotifyBilling(ctx context.Context, notice BillingNotice) error
+}
+
+// CollectPayments charges open invoices that are due, retrying failed
+// charges on the dunning schedule, then cancels subscriptions that stayed
+// unpaid past the grace period. Without a payment processor nothing is
+// charged or cancelled.
+func (s *service) CollectPayments(ctx context.Context) (*PaymentRunResult, error) {
+	result := &PaymentRunResult{}
+	if s.cfg.PaymentProcessor == nil {
+		return result, nil
+	}
+	now := time.Now().UTC()
+	after := uuid.Nil
+	for {
+		invoices, err := s.repo.ListInvoicesDueForPayment(ctx, now, after, paymentBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range invoices {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			result.Attempted++
+			status, err := s.chargeInvoice(ctx, &invoices[i], now)
+			if err != nil {
+				result.Errors++
+				log.Printf("settings: charge invoice %s: %v", invoices[i].InvoiceNumber, err)
+				continue
+			}
+			switch status {
+			case pkgbilling.ChargeSucceeded:
+				result.Succeeded++
+			case pkgbilling.ChargeProcessing:
+				result.Pending++
+			default:
+				result.Failed++
+			}
+		}
+		if len(invoices) < paymentBatchSize {
+			break
+		}
+		after = invoices[len(invoices)-1].ID
+	}
+	canceled, err := s.cancelUnpaidSubscriptions(ctx, now)
+	result.Canceled = canceled
+	return result, err
+}
+
+// chargeInvoice takes one payment attempt on an invoice. Only processor
+// errors are returned; declines are recorded on the invoice.
+func (s *service) chargeInvoice(ctx context.Context, inv *Invoice, now time.Time) (string, error) {
+	sub, err := s.repo.GetSubscription(ctx, inv.UserID)
+	if err != nil {
+		return "", err
+	}
+	due := amountToCents(inv.TotalAmount) - amountToCents(inv.AmountCredited)
+	if due <= 0 {
+		return "", fmt.Errorf("nothing left to collect")
+	}
+	if strings.TrimSpace(sub.PaymentMethodID) == "" {
+		inv.PaymentAttempts++
+		return pkgbilling.ChargeFailed, s.paymentFailed(ctx, inv, sub, "no payment method on file", now)
+	}
+	paymentMethodID, err := s.vault.DecryptString(sub.PaymentMethodID)
+	if err != nil {
+		return "", err
+	}
+	attempt := inv.PaymentAttempts + 1
+	res, err := s.cfg.PaymentProcessor.Charge(ctx, pkgbilling.ChargeRequest{
+		CustomerID:      sub.ProcessorCustomerID,
+		PaymentMethodID: paymentMethodID,
+		Amount:          due,
+		Currency:        inv.Currency,
+		Description:     "CarbonScribe invoice " + inv.InvoiceNumber,
+		IdempotencyKey:  fmt.Sprintf("invoice-%s-attempt-%d", inv.ID, attempt),
+		Metadata:        map[string]string{"invoice_id": inv.ID.String(), "invoice_number": inv.InvoiceNumber},
+	})
+	if err != nil {
+		// Not counted as an attempt; the same idempotency key is reused
+		// next run so the customer is never charged twice
+		return "", err
+	}
+	inv.PaymentAttempts = attempt
+	inv.TransactionID = res.ID
+	switch res.Status {
+	case pkgbilling.ChargeSucceeded:
+		return res.Status, s.paymentSucceeded(ctx, inv, sub, now)
+	case pkgbilling.ChargeProcessing:
+		inv.Status = "processing"
+		inv.NextPaymentAttempt = nil
+		return res.Status, s.repo.UpdateInvoicePayment(ctx, inv)
+	default:
+		reason := res.FailureMessage
+		if reason == "" {
+			reason = "payment declined"
+		}
+		return pkgbilling.ChargeFailed, s.paymentFailed(ctx, inv, sub, reason, now)
+	}
+}
+
+// paymentSucceeded marks the invoice paid and brings a subscription in
+// dunning back to active
+func (s *service) paymentSucceeded(ctx context.Context, inv *Invoice, sub *Subscription, now time.Time) error {
+	inv.Status = "paid"
+	inv.PaidAt = &now
+	inv.PaymentMethod = sub.PaymentMethodType
+	inv.NextPaymentAttempt = nil
+	inv.LastPaymentError = ""
+	if err := s.repo.UpdateInvoicePayment(ctx, inv); err != nil {
+		return err
+	}
+	if sub.Status == "past_due" || sub.Status == "unpaid" {
+		before := sub.Status
+		sub.Status = settingsbilling.NextDunningStatus(sub.Status, true)
+		sub.UnpaidSince = nil
+		if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+			return err
+		}
+		s.audit("billing.subscription.recovered", sub.UserID, map[string]interface{}{"from": before, "invoice": inv.InvoiceNumber})
+	}
+	s.audit("billing.payment.succeeded", inv.UserID, map[string]interface{}{"invoice": inv.InvoiceNumber, "charge_id": inv.TransactionID})
+	s.notifyBilling(ctx, BillingNotice{
+		Kind:          "payment_succeeded",
+		UserID:        inv.UserID,
+		InvoiceNumber: inv.InvoiceNumber,
+		Amount:        roundAmount(inv.TotalAmount - inv.AmountCredited),
+		Currency:      inv.Currency,
+		Status:        sub.Status,
+	})
+	return nil
+}
+
+// paymentFailed schedules the next retry and moves the subscription a step
+// down the dunning path: past_due on the first failure, unpaid once the
+// retries are exhausted
+func (s *service) paymentFailed(ctx context.Context, inv *Invoice, sub *Subscription, reason string, now time.Time) error {
+	inv.Status = "open"
+	inv.LastPaymentError = reason
+	inv.NextPaymentAttempt = nil
+	if next, ok := s.cfg.Dunning.NextRetry(inv.PaymentAttempts, now); ok {
+		inv.NextPaymentAttempt = &next
+	}
+	if err := s.repo.UpdateInvoicePayment(ctx, inv); err != nil {
+		return err
+	}
+	before := sub.Status
+	if sub.Status == "active" || sub.Status == "trialing" {
+		sub.Status = "past_due"
+	}
+	if inv.NextPaymentAttempt == nil && sub.Status == "past_due" {
+		sub.Status = settingsbilling.NextDunningStatus(sub.Status, false)
+		sub.UnpaidSince = &now
+	}
+	if sub.Status != before {
+		if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+			return err
+		}
+	}
+	s.audit("billing.payment.failed", inv.UserID, map[string]interface{}{
+		"invoice": inv.InvoiceNumber, "attempt": inv.PaymentAttempts, "reason": reason, "from": before, "to": sub.Status,
+	})
+	s.notifyBilling(ctx, BillingNotice{
+		Kind:          "payment_failed",
+		UserID:        inv.UserID,
+		InvoiceNumber: inv.InvoiceNumber,
+		Amount:        roundAmount(inv.TotalAmount - inv.AmountCredited),
+		Currency:      inv.Currency,
+		Reason:        reason,
+		NextAttempt:   inv.NextPaymentAttempt,
+		Status:        sub.Status,
+	})
+	return nil
+}
+
+// cancelUnpaidSubscriptions ends subscriptions that stayed unpaid for the
+// dunning grace period, moving them to the free plan
+func (s *service) cancelUnpaidSubscriptions(ctx context.Context, now time.Time) (int, error) {
+	canceled := 0
+	free, ok := s.cfg.Plans.Get(defaultPlanID)
+	if !ok {
+		return 0, fmt.Errorf("plan catalogue has no %s plan", defaultPlanID)
+	}
+	after := uuid.Nil
+	for {
+		subs, err := s.repo.ListSubscriptionsUnpaidSince(ctx, now.Add(-s.cfg.Dunning.CancelAfter), after, paymentBatchSize)
+		if err != nil {
+			return canceled, err
+		}
+		for i := range subs {
+			sub := &subs[i]
+			before := *sub
+			sub.Status = settingsbilling.NextDunningStatus(sub.Status, false)
+			sub.PlanID = free.ID
+			sub.PlanName = free.Name
+			sub.CanceledAt = &now
+			sub.CancelAtPeriodEnd = false
+			sub.UnpaidSince = nil
+			if err := s.repo.SaveSubscription(ctx, sub); err != nil {
+				return canceled, err
+			}
+			canceled++
+			s.audit("billing.subscription.canceled", sub.UserID, map[string]interface{}{"before": before, "after": sub, "reason": "unpaid"})
+			s.notifyBilling(ctx, BillingNotice{Kind: "subscription_canceled", UserID: sub.UserID, Reason: "unpaid invoices", Status: sub.Status})
+		}
+		if len(subs) < paymentBatchSize {
+			return canceled, nil
+		}
+		after = subs[len(subs)-1].ID
+	}
+}
+
+// retryOutstandingInvoices charges invoices that failed to collect, after
+// the customer changed payment method
+func (s *service) retryOutstandingInvoices(ctx context.Context, userID uuid.UUID) {
+	invoices, err := s.repo.ListInvoices(ctx, userID, 100)
+	if err != nil {
+		log.Printf("settings: list invoices to retry for user %s: %v", userID, err)
+		return
+	}
+	now := time.Now().UTC()
+	for i := range invoices {
+		inv := &invoices[i]
+		if inv.Kind == settingsbilling.KindCreditNote || inv.Status != "open" || inv.PaymentAttempts == 0 {
+			continue
+		}
+		if _, err := s.chargeInvoice(ctx, inv, now); err != nil {
+			log.Printf("settings: retry invoice %s: %v", inv.InvoiceNumber, err)
+		}
+	}
+}
+
+// HandlePaymentWebhook applies a signed processor event. Redelivered events
+// are acknowledged without being applied again.
+func (s *service) HandlePaymentWebhook(ctx context.Context, payload []byte, signature string) error {
+	if s.cfg.PaymentProcessor == nil {
+		return ErrPaymentsUnavailable
+	}
+	event, err := s.cfg.PaymentProcessor.ParseWebhook(payload, signature, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if event.Type == "" || event.ID == "" {
+		return nil
+	}
+	fresh, err := s.repo.RecordPaymentEvent(ctx, &PaymentWebhookEvent{ID: event.ID, Type: event.Type, ChargeID: event.ChargeID, ReceivedAt: time.Now().UTC()})
+	if err != nil || !fresh {
+		return err
+	}
+	if err := s.applyPaymentEvent(ctx, event); err != nil {
+		// Forget the event so the processor's redelivery is applied
+		if delErr := s.repo.DeletePaymentEvent(ctx, event.ID); delErr != nil {
+			log.Printf("settings: forget payment event %s: %v", event.ID, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *service) applyPaymentEvent(ctx context.Context, event *pkgbilling.PaymentEvent) error {
+	inv, err := s.invoiceForEvent(ctx, event)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("settings: payment event %s for unknown charge %s", event.ID, event.ChargeID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sub, err := s.repo.GetSubscription(ctx, inv.UserID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	switch event.Type {
+	case pkgbilling.EventPaymentSucceeded:
+		if inv.Status != "open" && inv.Status != "processing" {
+			return nil
+		}
+		inv.TransactionID = event.ChargeID
+		return s.paymentSucceeded(ctx, inv, sub, now)
+	case pkgbilling.EventPaymentFailed:
+		// Synchronous declines were recorded when the charge was made
+		if inv.Status != "processing" || inv.TransactionID != event.ChargeID {
+			return nil
+		}
+		reason := event.FailureMessage
+		if reason == "" {
+			reason = "payment failed"
+		}
+		return s.paymentFailed(ctx, inv, sub, reason, now)
+	case pkgbilling.EventPaymentDisputed:
+		if inv.Status != "paid" {
+			return nil
+		}
+		inv.Status = "disputed"
+		if err := s.repo.UpdateInvoicePayment(ctx, inv); err != nil {
+			return err
+		}
+		s.audit("billing.payment.disputed", inv.UserID, map[string]interface{}{"invoice": inv.InvoiceNumber, "charge_id": event.ChargeID, "reason": event.FailureMessage})
+		s.notifyBilling(ctx, BillingNotice{
+			Kind:          "payment_disputed",
+			UserID:        inv.UserID,
+			InvoiceNumber: inv.InvoiceNumber,
+			Amount:        centsToAmount(event.Amount),
+			Currency:      inv.Currency,
+			Reason:        event.FailureMessage,
+			Status:        sub.Status,
+		})
+	}
+	return nil
+}
+
+func (s *service) invoiceForEvent(ctx context.Context, event *pkgbilling.PaymentEvent) (*Invoice, error) {
+	if id, err := uuid.Parse(event.Metadata["invoice_id"]); err == nil {
+		return s.repo.GetInvoiceByID(ctx, id)
+	}
+	if event.ChargeID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.repo.GetInvoiceByTransaction(ctx, event.ChargeID)
+}
+
+func (s *service) notifyBilling(ctx context.Context, notice BillingNotice) {
+	if s.cfg.BillingNotifier == nil {
+		return
+	}
+	if err := s.cfg.BillingNotifier.NotifyBilling(ctx, notice); err != nil {
+		log.Printf("settings: billing notice %s for user %s: %v", notice.Kind, notice.UserID, err)
+	}
+}
+
+// EmailBillingNotifier emails billing notices to the customer
+type EmailBillingNotifier struct {
+	Sender    email.Sender
+	Recipient func(ctx context.Context, userID uuid.UUID) (string, error)
+}
+
+func (n EmailBillingNotifier) NotifyBilling(ctx context.Context, notice BillingNotice) error {
+	to, err := n.Recipient(ctx, notice.UserID)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("no email address for user %s", notice.UserID)
+	}
+	subject, body := billingEmail(notice)
+	return n.Sender.Send(ctx, to, subject, body)
+}
+
+func billingEmail(n BillingNotice) (string, string) {
+	amount := fmt.Sprintf("%.2f %s", n.Amount, n.Currency)
+	switch n.Kind {
+	case "payment_succeeded":
+		return "Payment received for invoice " + n.InvoiceNumber,
+			fmt.Sprintf("We received your payment of %s for invoice %s. Thank you.", amount, n.InvoiceNumber)
+	case "payment_failed":
+		body := fmt.Sprintf("We could not collect %s for invoice %s: %s.\n\n", amount, n.InvoiceNumber, n.Reason)
+		if n.NextAttempt != nil {
+			body += fmt.Sprintf("We will try again on %s. ", n.NextAttempt.Format("2 January 2006"))
+		} else {
+			body += "We will not retry automatically and your subscription is now unpaid. "
+		}
+		body += "You can update your payment method in billing settings at any time, and we will retry straight away."
+		return "Action required: payment failed for invoice " + n.InvoiceNumber, body
+	case "payment_disputed":
+		return "Payment for invoice " + n.InvoiceNumber + " was disputed",
+			fmt.Sprintf("Your bank reported a dispute of %s on invoice %s (%s). Please contact us if this was not intended.", amount, n.InvoiceNumber, n.Reason)
+	case "subscription_canceled":
+		return "Your subscription has been canceled",
+			"Your subscription was canceled because of " + n.Reason + " and your account has moved to the free plan. You can subscribe again from billing settings."
+	default:
+		return "Billing update", "There has been an update to your billing: " + n.Kind
+	}
+}
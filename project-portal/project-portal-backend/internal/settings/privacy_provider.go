@@ -0,0 +1,56 @@
+package settings
+
+import (
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/requests"
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance/retention"
+
+	"gorm.io/gorm"
+)
+
+// NewPrivacyProvider describes where the settings module keeps a user's data
+// for privacy requests. Credentials, key hashes and processor references are
+// never exported. store removes profile pictures, exports and invoice PDFs.
+func NewPrivacyProvider(db *gorm.DB, store requests.ObjectStore) requests.Provider {
+	const byUser = "user_id = @user"
+	return requests.NewTableProvider("settings", db, store,
+		requests.Table{Name: "user_profiles", Category: requests.CategoryUserProfile, Where: byUser,
+			Exclude:    []string{"profile_picture_keys"},
+			ObjectKeys: "jsonb_array_elements_text(CASE WHEN jsonb_typeof(profile_picture_keys) = 'array' THEN profile_picture_keys ELSE '[]'::jsonb END)"},
+		requests.Table{Name: "notification_preferences", Category: requests.CategoryUserProfile, Where: byUser},
+		requests.Table{Name: "api_keys", Category: requests.CategoryUserProfile, Where: byUser,
+			Exclude: []string{"key_hash", "webhook_secret"}},
+		requests.Table{Name: "integration_configurations", Category: requests.CategoryUserProfile, Where: byUser,
+			Exclude: []string{"config_data", "webhook_secret"}},
+		requests.Table{Name: "oauth_states", Category: requests.CategoryUserProfile, Where: byUser,
+			Exclude: []string{"state_hash", "code_verifier"}},
+		requests.Table{Name: "account_exports", Category: requests.CategoryUserProfile, Where: byUser,
+			Exclude: []string{"object_key"}, ObjectKeys: "object_key"},
+		requests.Table{Name: "api_key_usage_buckets", Category: requests.CategorySystemLogs, Where: byUser},
+		requests.Table{Name: "api_key_webhook_deliveries", Category: requests.CategorySystemLogs, Where: byUser},
+		requests.Table{Name: "invoices", Category: requests.CategoryFinancialRecords, Where: byUser,
+			Exclude: []string{"pdf_key"}, ObjectKeys: "pdf_key"},
+		requests.Table{Name: "subscriptions", Category: requests.CategoryFinancialRecords, Where: byUser,
+			Exclude: []string{"payment_method_id", "processor_customer_id"}},
+	)
+}
+
+// settledInvoices matches paid and void invoices no credit note refers to.
+// Credit notes point at the invoice they credit through credited_invoice_id,
+// which has no ON DELETE action, and stay issued so never expire themselves.
+const settledInvoices = "status IN ('paid', 'void') AND NOT EXISTS " +
+	"(SELECT 1 FROM invoices notes WHERE notes.credited_invoice_id = invoices.id)"
+
+// RetentionTargets lists the settings data that ages out under retention
+// policies. Only settled invoices and finished exports and deliveries expire;
+// an invoice stays while a credit note still references it.
+func RetentionTargets() []retention.Target {
+	return []retention.Target{
+		{Category: requests.CategorySystemLogs, Table: "api_key_usage_buckets", TimestampColumn: "bucket_start", UserColumn: "user_id"},
+		{Category: requests.CategorySystemLogs, Table: "api_key_webhook_deliveries", TimestampColumn: "created_at", UserColumn: "user_id",
+			Where: "status <> 'pending'"},
+		{Category: requests.CategoryFinancialRecords, Table: "invoices", TimestampColumn: "created_at", UserColumn: "user_id",
+			ObjectKeyColumn: "pdf_key", Where: settledInvoices},
+		{Category: requests.CategoryUserProfile, Table: "account_exports", TimestampColumn: "requested_at", UserColumn: "user_id",
+			ObjectKeyColumn: "object_key", Where: "status IN ('completed', 'failed', 'expired')"},
+	}
+}
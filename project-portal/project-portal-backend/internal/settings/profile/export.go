@@ -1,13 +1,292 @@
 package profile
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
 )
 
+// ExportFormatVersion is bumped when the layout of account exports changes
+const ExportFormatVersion = 1
+
 func ExportJSON(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
 }
 
-func ExportPDFPlaceholder() []byte {
-	return []byte("PDF export generation is not implemented in this build")
+// ExportSection is one category of an account export. Data is anything that
+// marshals to a JSON object or array of objects.
+type ExportSection struct {
+	Category string
+	Data     interface{}
+}
+
+// ExportManifest describes the contents of an export archive
+type ExportManifest struct {
+	ExportID      string                   `json:"export_id"`
+	UserID        string                   `json:"user_id"`
+	GeneratedAt   time.Time                `json:"generated_at"`
+	FormatVersion int                      `json:"format_version"`
+	Categories    []ExportManifestCategory `json:"categories"`
+	Files         []ExportManifestFile     `json:"files"`
+}
+
+type ExportManifestCategory struct {
+	Category string   `json:"category"`
+	Records  int      `json:"records"`
+	Files    []string `json:"files"`
+}
+
+type ExportManifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportSummary is printed in the PDF included with every export
+type ExportSummary struct {
+	Name        string
+	UserID      string
+	ExportID    string
+	GeneratedAt time.Time
+	Details     [][2]string // label and value, e.g. profile fields
+}
+
+// BuildExportArchive writes a ZIP holding a JSON and CSV file per section,
+// a PDF summary and manifest.json, which lists every other file with its
+// SHA-256
+func BuildExportArchive(manifest ExportManifest, sections []ExportSection, summary ExportSummary) ([]byte, *ExportManifest, error) {
+	manifest.FormatVersion = ExportFormatVersion
+	manifest.Categories = nil
+	manifest.Files = nil
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(path string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: manifest.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ExportManifestFile{Path: path, Bytes: len(data), SHA256: hex.EncodeToString(sum[:])})
+		return nil
+	}
+
+	for _, section := range sections {
+		rows, err := exportRows(section.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("export %s: %w", section.Category, err)
+		}
+		jsonData, err := ExportJSON(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("export %s: %w", section.Category, err)
+		}
+		csvData, err := exportCSV(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("export %s: %w", section.Category, err)
+		}
+		category := ExportManifestCategory{Category: section.Category, Records: len(rows)}
+		for _, file := range []struct {
+			path string
+			data []byte
+		}{
+			{section.Category + "/" + section.Category + ".json", jsonData},
+			{section.Category + "/" + section.Category + ".csv", csvData},
+		} {
+			if err := add(file.path, file.data); err != nil {
+				return nil, nil, err
+			}
+			category.Files = append(category.Files, file.path)
+		}
+		manifest.Categories = append(manifest.Categories, category)
+	}
+
+	pdf, err := RenderExportSummaryPDF(summary, manifest.Categories)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := add("summary.pdf", pdf); err != nil {
+		return nil, nil, err
+	}
+	manifestData, err := ExportJSON(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(manifestData); err != nil {
+		return nil, nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), &manifest, nil
+}
+
+// ExportRecords returns how many records section data holds
+func ExportRecords(data interface{}) int {
+	rows, err := exportRows(data)
+	if err != nil {
+		return 0
+	}
+	return len(rows)
+}
+
+// exportRows normalises section data to a list of JSON objects: a single
+// object becomes one row and nil becomes none
+func exportRows(data interface{}) ([]map[string]interface{}, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if bytes.Equal(raw, []byte("null")) {
+		return []map[string]interface{}{}, nil
+	}
+	if len(raw) > 0 && raw[0] == '{' {
+		var row map[string]interface{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{row}, nil
+	}
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal(raw, &rows); err != nil {
+		return nil, fmt.Errorf("data must be an object or a list of objects: %w", err)
+	}
+	return rows, nil
+}
+
+// exportCSV writes rows with one column per top-level field, sorted by name.
+// Nested values are written as JSON.
+func exportCSV(rows []map[string]interface{}) ([]byte, error) {
+	columnSet := map[string]bool{}
+	for _, row := range rows {
+		for k := range row {
+			columnSet[k] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for k := range columnSet {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			record[i] = csvValue(row[col])
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+// RenderExportSummaryPDF renders a readable overview of an export: who it
+// is for, the profile details and how many records each category holds
+func RenderExportSummaryPDF(summary ExportSummary, categories []ExportManifestCategory) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(150, 150, 150)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Account data export %s  |  Page %d", summary.ExportID, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFillColor(34, 85, 56)
+	pdf.Rect(0, 0, 210, 18, "F")
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetXY(20, 4)
+	pdf.CellFormat(170, 10, "CarbonScribe  |  Your account data", "", 0, "L", false, 0, "")
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetXY(20, 26)
+
+	pdf.SetFont("Helvetica", "", 10)
+	intro := "This archive contains the personal data CarbonScribe holds about your account. " +
+		"Each category has a JSON file with the complete records and a CSV file for spreadsheets. " +
+		"manifest.json lists every file with its SHA-256 checksum."
+	pdf.MultiCell(170, 5, intro, "", "L", false)
+	pdf.Ln(4)
+
+	details := [][2]string{
+		{"Name", summary.Name},
+		{"User ID", summary.UserID},
+		{"Export ID", summary.ExportID},
+		{"Generated", summary.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")},
+	}
+	details = append(details, summary.Details...)
+	for _, d := range details {
+		if d[1] == "" {
+			continue
+		}
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(45, 6, tr(d[0])+":", "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(125, 6, tr(d[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 245, 238)
+	pdf.SetTextColor(34, 85, 56)
+	pdf.CellFormat(70, 8, "  Category", "", 0, "L", true, 0, "")
+	pdf.CellFormat(25, 8, "Records", "", 0, "R", true, 0, "")
+	pdf.CellFormat(75, 8, "  Files", "", 1, "L", true, 0, "")
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, c := range categories {
+		pdf.CellFormat(70, 7, "  "+tr(c.Category), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(25, 7, fmt.Sprintf("%d", c.Records), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(75, 7, "  "+c.Category+"/", "B", 1, "L", false, 0, "")
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("pdf rendering error: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("pdf output error: %w", err)
+	}
+	return buf.Bytes(), nil
 }
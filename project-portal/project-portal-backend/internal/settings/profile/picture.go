@@ -1,11 +1,19 @@
 package profile
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
 )
 
 func BuildProfilePictureURL(cdnBase string, userID uuid.UUID, filename string) string {
@@ -13,5 +21,246 @@ func BuildProfilePictureURL(cdnBase string, userID uuid.UUID, filename string) s
 	if name == "" {
 		name = "profile.jpg"
 	}
-	return fmt.Sprintf("%s/settings/profiles/%s/%s", strings.TrimRight(cdnBase, "/"), userID.String(), filepath.Base(name))
+	return fmt.Sprintf("%s/%s", strings.TrimRight(cdnBase, "/"), ProfilePictureKey(userID, name))
+}
+
+// ProfilePictureKey is the storage key of a profile picture file, mirrored
+// by its CDN path
+func ProfilePictureKey(userID uuid.UUID, filename string) string {
+	return fmt.Sprintf("settings/profiles/%s/%s", userID.String(), filepath.Base(filename))
+}
+
+// Picture types accepted for profile pictures, detected by magic bytes
+const (
+	PictureJPEG = "image/jpeg"
+	PicturePNG  = "image/png"
+	PictureWebP = "image/webp"
+)
+
+// MaxPicturePixels bounds the decoded size of an upload, so a small file
+// cannot expand into gigabytes of pixels
+const MaxPicturePixels = 40_000_000
+
+// DefaultPictureSizes are the square thumbnail edges generated per upload,
+// largest first
+var DefaultPictureSizes = []int{512, 256, 128, 64}
+
+// ValidatePictureSizes checks configured thumbnail edges are positive and
+// listed largest first, since the first is used as the profile picture
+func ValidatePictureSizes(sizes []int) error {
+	if len(sizes) == 0 {
+		return errors.New("no profile picture sizes configured")
+	}
+	for i, size := range sizes {
+		if size <= 0 {
+			return fmt.Errorf("profile picture size %d is not positive", size)
+		}
+		if i > 0 && size >= sizes[i-1] {
+			return fmt.Errorf("profile picture sizes must be listed largest first, got %v", sizes)
+		}
+	}
+	return nil
+}
+
+var (
+	ErrUnsupportedPicture = errors.New("unsupported image type, use JPEG, PNG or WebP")
+	ErrInvalidPicture     = errors.New("invalid image")
+)
+
+// Thumbnail is one rendered size of a profile picture
+type Thumbnail struct {
+	Size        int
+	ContentType string
+	Ext         string
+	Data        []byte
+}
+
+// DetectPictureType returns the image type from the file signature, or ""
+// when it is not an accepted type
+func DetectPictureType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return PictureJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PicturePNG
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return PictureWebP
+	}
+	return ""
+}
+
+// ProcessPicture decodes an upload, applies its EXIF orientation and renders
+// centred square thumbnails in each size. Thumbnails are re-encoded from
+// pixels, so EXIF, GPS and any other metadata in the upload is dropped.
+// Images are never scaled up; a size larger than the source is rendered at
+// the source size.
+func ProcessPicture(data []byte, sizes []int) ([]Thumbnail, error) {
+	contentType := DetectPictureType(data)
+	if contentType == "" {
+		return nil, ErrUnsupportedPicture
+	}
+	if len(sizes) == 0 {
+		sizes = DefaultPictureSizes
+	}
+	cfg, err := decodeConfig(contentType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPicture, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPicturePixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d megapixels", ErrInvalidPicture, cfg.Width, cfg.Height, MaxPicturePixels/1_000_000)
+	}
+	src, err := decode(contentType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPicture, err)
+	}
+
+	// The centred square is the same region whichever way the image is
+	// oriented, so orientation is applied to the small thumbnails only
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	orientation := 1
+	if contentType == PictureJPEG {
+		orientation = jpegOrientation(data)
+	}
+
+	// JPEG stays JPEG; PNG and WebP may be transparent and become PNG
+	outType, ext := PictureJPEG, ".jpg"
+	if contentType != PictureJPEG {
+		outType, ext = PicturePNG, ".png"
+	}
+	thumbs := make([]Thumbnail, 0, len(sizes))
+	for _, size := range sizes {
+		if size <= 0 {
+			continue
+		}
+		if size > side {
+			size = side
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+		img := orient(dst, orientation)
+		var buf bytes.Buffer
+		if outType == PictureJPEG {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode %dpx thumbnail: %w", size, err)
+		}
+		thumbs = append(thumbs, Thumbnail{Size: size, ContentType: outType, Ext: ext, Data: buf.Bytes()})
+	}
+	return thumbs, nil
+}
+
+func decodeConfig(contentType string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch contentType {
+	case PictureJPEG:
+		return jpeg.DecodeConfig(r)
+	case PicturePNG:
+		return png.DecodeConfig(r)
+	default:
+		return webp.DecodeConfig(r)
+	}
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch contentType {
+	case PictureJPEG:
+		return jpeg.Decode(r)
+	case PicturePNG:
+		return png.Decode(r)
+	default:
+		return webp.Decode(r)
+	}
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG's APP1
+// segment, returning 1 when there is none
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			return 1 // start of scan: no more metadata
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns a square image upright according to an EXIF orientation
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	n := img.Bounds().Dx()
+	out := image.NewNRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sx, sy := x, y
+			switch orientation {
+			case 2: // mirrored
+				sx = n - 1 - x
+			case 3: // rotated 180
+				sx, sy = n-1-x, n-1-y
+			case 4: // mirrored vertically
+				sy = n - 1 - y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 clockwise
+				sx, sy = y, n-1-x
+			case 7: // transversed
+				sx, sy = n-1-y, n-1-x
+			case 8: // rotated 90 counter-clockwise
+				sx, sy = n-1-y, x
+			}
+			out.SetNRGBA(x, y, img.NRGBAAt(sx, sy))
+		}
+	}
+	return out
 }
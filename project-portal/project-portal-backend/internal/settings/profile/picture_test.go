@@ -0,0 +1,142 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// quadrantImage is red in the top-left quadrant and blue elsewhere
+func quadrantImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{B: 255, A: 255}
+			if x < w/2 && y < h/2 {
+				c = color.NRGBA{R: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withExif inserts an APP1 segment carrying an orientation tag and a GPS
+// marker after the JPEG's SOI
+func withExif(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ifd := make([]byte, 2+12)
+	binary.BigEndian.PutUint16(ifd[0:], 1)
+	binary.BigEndian.PutUint16(ifd[2:], 0x0112)
+	binary.BigEndian.PutUint16(ifd[4:], 3)
+	binary.BigEndian.PutUint32(ifd[6:], 1)
+	binary.BigEndian.PutUint16(ifd[10:], orientation)
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), ifd...)
+	payload = append(payload, []byte("GPS 51.5072N 0.1276W")...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestDetectPictureType(t *testing.T) {
+	var jpg, pngData bytes.Buffer
+	_ = jpeg.Encode(&jpg, quadrantImage(8, 8), nil)
+	_ = png.Encode(&pngData, quadrantImage(8, 8))
+	cases := map[string][]byte{
+		PictureJPEG: jpg.Bytes(),
+		PicturePNG:  pngData.Bytes(),
+		PictureWebP: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "),
+		"":          []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"),
+	}
+	for want, data := range cases {
+		if got := DetectPictureType(data); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+	if _, err := ProcessPicture([]byte("GIF89a......"), nil); !errors.Is(err, ErrUnsupportedPicture) {
+		t.Fatalf("expected unsupported type, got %v", err)
+	}
+	if _, err := ProcessPicture(jpg.Bytes()[:20], nil); !errors.Is(err, ErrInvalidPicture) {
+		t.Fatalf("expected truncated image to be invalid, got %v", err)
+	}
+}
+
+func TestProcessPictureCropsOrientsAndStripsMetadata(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, quadrantImage(256, 256), &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	upload := withExif(jpg.Bytes(), 6)
+	if jpegOrientation(upload) != 6 {
+		t.Fatalf("expected orientation to be read")
+	}
+
+	thumbs, err := ProcessPicture(upload, []int{512, 128, 64})
+	if err != nil {
+		t.Fatalf("ProcessPicture error: %v", err)
+	}
+	if len(thumbs) != 3 || thumbs[0].Size != 256 || thumbs[1].Size != 128 || thumbs[2].Size != 64 {
+		t.Fatalf("expected sizes capped at the source, got %+v", thumbs)
+	}
+	for _, thumb := range thumbs {
+		if thumb.ContentType != PictureJPEG || bytes.Contains(thumb.Data, []byte("Exif")) || bytes.Contains(thumb.Data, []byte("GPS")) {
+			t.Fatalf("expected a JPEG without metadata for %dpx", thumb.Size)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(thumb.Data))
+		if err != nil {
+			t.Fatalf("decode thumbnail: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != thumb.Size || b.Dy() != thumb.Size {
+			t.Fatalf("expected a %dpx square, got %v", thumb.Size, b)
+		}
+		// Rotated 90 degrees clockwise, the red quadrant is now top-right
+		n := thumb.Size
+		if !isRed(img.At(n*3/4, n/4)) || isRed(img.At(n/4, n/4)) {
+			t.Fatalf("expected orientation applied to the %dpx thumbnail", n)
+		}
+	}
+}
+
+func TestProcessPictureCentresNonSquareImages(t *testing.T) {
+	var data bytes.Buffer
+	if err := png.Encode(&data, quadrantImage(400, 200)); err != nil {
+		t.Fatal(err)
+	}
+	thumbs, err := ProcessPicture(data.Bytes(), []int{100})
+	if err != nil {
+		t.Fatalf("ProcessPicture error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(thumbs[0].Data))
+	if err != nil || thumbs[0].ContentType != PicturePNG {
+		t.Fatalf("expected a PNG thumbnail, got %s %v", thumbs[0].ContentType, err)
+	}
+	// The centre square spans x 100-300, so its left half is the end of
+	// the red quadrant
+	if !isRed(img.At(25, 25)) || isRed(img.At(75, 25)) || isRed(img.At(25, 75)) {
+		t.Fatalf("expected the centred square")
+	}
+}
+
+func TestValidatePictureSizes(t *testing.T) {
+	if err := ValidatePictureSizes(DefaultPictureSizes); err != nil {
+		t.Fatalf("expected the default sizes accepted, got %v", err)
+	}
+	for _, sizes := range [][]int{nil, {256, 0}, {-64}, {128, 256}, {128, 128}} {
+		if err := ValidatePictureSizes(sizes); err == nil {
+			t.Fatalf("expected %v refused", sizes)
+		}
+	}
+}
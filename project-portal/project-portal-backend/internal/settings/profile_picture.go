@@ -0,0 +1,105 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	settingsprofile "carbon-scribe/project-portal/project-portal-backend/internal/settings/profile"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const defaultProfilePictureMaxBytes = 5 << 20
+
+// PictureStore keeps profile pictures; S3Client satisfies it. Stored keys
+// are served from Config.ProfileCDNBase.
+type PictureStore interface {
+	UploadBytes(ctx context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	ErrPictureStorageUnavailable = errors.New("profile picture storage is not configured")
+	ErrPictureTooLarge           = errors.New("profile picture is too large")
+)
+
+// UploadProfilePicture validates an uploaded image, stores square
+// thumbnails of it without metadata and points the profile at them. The
+// previous picture's files are deleted once the profile is updated.
+func (s *service) UploadProfilePicture(ctx context.Context, userID uuid.UUID, data []byte) (*ProfilePictureUploadResponse, error) {
+	if s.cfg.PictureStore == nil {
+		return nil, ErrPictureStorageUnavailable
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", settingsprofile.ErrInvalidPicture)
+	}
+	if int64(len(data)) > s.cfg.ProfilePictureMaxBytes {
+		return nil, fmt.Errorf("%w: limit is %d MB", ErrPictureTooLarge, s.cfg.ProfilePictureMaxBytes>>20)
+	}
+	thumbs, err := settingsprofile.ProcessPicture(data, s.cfg.ProfilePictureSizes)
+	if err != nil {
+		return nil, err
+	}
+	if len(thumbs) == 0 {
+		return nil, errors.New("no profile picture thumbnails were generated")
+	}
+	profile, err := s.repo.GetOrCreateProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every upload gets fresh names, so CDN caches never serve the old image
+	version := uuid.NewString()[:8]
+	keys := make([]string, 0, len(thumbs))
+	sizes := datatypes.JSONMap{}
+	for _, thumb := range thumbs {
+		name := fmt.Sprintf("%s-%d%s", version, thumb.Size, thumb.Ext)
+		key := settingsprofile.ProfilePictureKey(userID, name)
+		if _, err := s.cfg.PictureStore.UploadBytes(ctx, key, thumb.Data, thumb.ContentType); err != nil {
+			s.deletePictureFiles(ctx, keys)
+			return nil, fmt.Errorf("store profile picture: %w", err)
+		}
+		keys = append(keys, key)
+		sizes[strconv.Itoa(thumb.Size)] = settingsprofile.BuildProfilePictureURL(s.cfg.ProfileCDNBase, userID, name)
+	}
+
+	previous := profilePictureKeys(profile)
+	keysJSON, _ := json.Marshal(keys)
+	profile.ProfilePictureURL = sizes[strconv.Itoa(thumbs[0].Size)].(string)
+	profile.ProfilePictureSizes = sizes
+	profile.ProfilePictureKeys = datatypes.JSON(keysJSON)
+	if err := s.repo.SaveProfile(ctx, profile); err != nil {
+		s.deletePictureFiles(ctx, keys)
+		return nil, err
+	}
+	s.deletePictureFiles(ctx, previous)
+	s.audit("profile.picture.upload", userID, map[string]interface{}{"bytes": len(data), "sizes": len(thumbs), "replaced": len(previous)})
+	return &ProfilePictureUploadResponse{ProfilePictureURL: profile.ProfilePictureURL, Sizes: sizes, Message: "profile picture updated"}, nil
+}
+
+func profilePictureKeys(profile *UserProfile) []string {
+	var keys []string
+	if len(profile.ProfilePictureKeys) > 0 {
+		_ = json.Unmarshal(profile.ProfilePictureKeys, &keys)
+	}
+	return keys
+}
+
+// deletePictureFiles removes stored pictures. Failures leave orphaned files
+// behind but never fail the request.
+func (s *service) deletePictureFiles(ctx context.Context, keys []string) {
+	if s.cfg.PictureStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := s.cfg.PictureStore.Delete(ctx, key); err != nil {
+			log.Printf("settings: delete profile picture %s: %v", key, err)
+		}
+	}
+}
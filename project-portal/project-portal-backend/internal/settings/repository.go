@@ -2,11 +2,18 @@ package settings
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/integration"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
 	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
@@ -23,11 +30,75 @@ type Repository interface {
 	ListIntegrations(ctx context.Context, userID uuid.UUID) ([]IntegrationConfiguration, error)
 	GetIntegration(ctx context.Context, userID, integrationID uuid.UUID) (*IntegrationConfiguration, error)
 	UpsertIntegration(ctx context.Context, integration *IntegrationConfiguration) error
+	CreateOAuthState(ctx context.Context, state *OAuthState) error
+	ConsumeOAuthState(ctx context.Context, stateHash string) (*OAuthState, error)
+	DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error)
+	GetIntegrationByID(ctx context.Context, integrationID uuid.UUID) (*IntegrationConfiguration, error)
+	SaveOAuthToken(ctx context.Context, token *integration.OAuthToken) error
+	GetOAuthToken(ctx context.Context, connectionID string) (*integration.OAuthToken, error)
+	DeleteOAuthToken(ctx context.Context, connectionID string) error
+	ListRefreshableOAuthTokens(ctx context.Context, expiringBefore, now time.Time, limit int) ([]integration.OAuthToken, error)
+	ClaimOAuthTokenRefresh(ctx context.Context, tokenID string, now, leaseUntil time.Time) (bool, error)
+	RecordIntegrationHealth(ctx context.Context, health *integration.IntegrationHealth) error
+	IncrementAPIKeyUsage(ctx context.Context, buckets []APIKeyUsageBucket) error
+	ListAPIKeyUsage(ctx context.Context, keyID uuid.UUID, from, to time.Time) ([]APIKeyUsageBucket, error)
+	ListAPIKeysExpiringBetween(ctx context.Context, from, to time.Time) ([]APIKey, error)
+	ListAPIKeyHourlyUsage(ctx context.Context, from, to time.Time) ([]APIKeyHourlyUsage, error)
+	CreateAPIKeyWebhookDelivery(ctx context.Context, delivery *APIKeyWebhookDelivery) error
+	SaveAPIKeyWebhookDelivery(ctx context.Context, delivery *APIKeyWebhookDelivery) error
+	GetAPIKeyWebhookDelivery(ctx context.Context, keyID, deliveryID uuid.UUID) (*APIKeyWebhookDelivery, error)
+	ListAPIKeyWebhookDeliveries(ctx context.Context, keyID uuid.UUID, limit int) ([]APIKeyWebhookDelivery, error)
+	ListDueAPIKeyWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]APIKeyWebhookDelivery, error)
+	ClaimAPIKeyWebhookDelivery(ctx context.Context, deliveryID uuid.UUID, now, leaseUntil time.Time) (bool, error)
+	ListActiveIntegrations(ctx context.Context, afterID uuid.UUID, limit int) ([]IntegrationConfiguration, error)
+	ListIntegrationHealth(ctx context.Context, connectionID string, since time.Time) ([]integration.IntegrationHealth, error)
+	DeleteIntegrationHealthBefore(ctx context.Context, before time.Time) (int64, error)
+	ListVaultedValues(ctx context.Context, column VaultedColumn, afterID string, limit int) ([]VaultedValue, error)
+	SwapVaultedValue(ctx context.Context, column VaultedColumn, id, old, new string) (bool, error)
 	GetSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error)
 	SaveSubscription(ctx context.Context, sub *Subscription) error
+	ListSubscriptionsDue(ctx context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Subscription, error)
+	ListSubscriptions(ctx context.Context, afterID uuid.UUID, limit int) ([]Subscription, error)
+	UpdateSubscriptionUsage(ctx context.Context, subID uuid.UUID, metrics map[string]interface{}, warnings datatypes.JSONMap, collectedAt time.Time) error
+	IncrementSubscriptionUsage(ctx context.Context, subID uuid.UUID, metric string, delta int64) error
+	SumAPIKeyRequests(ctx context.Context, userID uuid.UUID, from, to time.Time) (int64, error)
 	ListInvoices(ctx context.Context, userID uuid.UUID, limit int) ([]Invoice, error)
 	GetInvoice(ctx context.Context, userID, invoiceID uuid.UUID) (*Invoice, error)
 	SaveInvoice(ctx context.Context, invoice *Invoice) error
+	GetInvoiceByID(ctx context.Context, invoiceID uuid.UUID) (*Invoice, error)
+	ListInvoicesToIssue(ctx context.Context, includeUnrendered bool, afterID uuid.UUID, limit int) ([]Invoice, error)
+	FinalizeInvoice(ctx context.Context, invoice *Invoice, series string) (bool, error)
+	CreateCreditNote(ctx context.Context, note *Invoice, series string) (bool, error)
+	SetInvoicePDF(ctx context.Context, invoiceID uuid.UUID, key string, generatedAt time.Time) error
+	ListInvoicesDueForPayment(ctx context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Invoice, error)
+	GetInvoiceByTransaction(ctx context.Context, transactionID string) (*Invoice, error)
+	UpdateInvoicePayment(ctx context.Context, invoice *Invoice) error
+	ListSubscriptionsUnpaidSince(ctx context.Context, before time.Time, afterID uuid.UUID, limit int) ([]Subscription, error)
+	RecordPaymentEvent(ctx context.Context, event *PaymentWebhookEvent) (bool, error)
+	DeletePaymentEvent(ctx context.Context, eventID string) error
+	CreateAccountExport(ctx context.Context, export *AccountExport) error
+	SaveAccountExport(ctx context.Context, export *AccountExport) error
+	GetAccountExport(ctx context.Context, userID, exportID uuid.UUID) (*AccountExport, error)
+	ListAccountExports(ctx context.Context, userID uuid.UUID, limit int) ([]AccountExport, error)
+	FindActiveAccountExport(ctx context.Context, userID uuid.UUID) (*AccountExport, error)
+	ListAccountExportsToProcess(ctx context.Context, staleBefore time.Time, limit int) ([]AccountExport, error)
+	ClaimAccountExport(ctx context.Context, exportID uuid.UUID, now, staleBefore time.Time) (bool, error)
+	ListExpiredAccountExports(ctx context.Context, now time.Time, limit int) ([]AccountExport, error)
+}
+
+// VaultedColumn names a text column holding vault ciphertext, keyed by a
+// uuid id column
+type VaultedColumn struct {
+	Table  string
+	Column string
+}
+
+func (c VaultedColumn) String() string { return c.Table + "." + c.Column }
+
+// VaultedValue is one stored ciphertext
+type VaultedValue struct {
+	ID    string
+	Value string
 }
 
 type repository struct{ db *gorm.DB }
@@ -70,9 +141,22 @@ func (r *repository) DeleteProfileData(ctx context.Context, userID uuid.UUID) er
 		if err := tx.Where("user_id = ?", userID).Delete(&Subscription{}).Error; err != nil {
 			return err
 		}
+		integrationIDs := tx.Model(&IntegrationConfiguration{}).Select("id::text").Where("user_id = ?", userID)
+		if err := tx.Where("connection_id IN (?)", integrationIDs).Delete(&integration.OAuthToken{}).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("user_id = ?", userID).Delete(&IntegrationConfiguration{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("user_id = ?", userID).Delete(&OAuthState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&APIKeyWebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&APIKeyUsageBucket{}).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("user_id = ?", userID).Delete(&APIKey{}).Error; err != nil {
 			return err
 		}
@@ -188,6 +272,236 @@ func (r *repository) UpsertIntegration(ctx context.Context, integration *Integra
 	return r.db.WithContext(ctx).Save(integration).Error
 }
 
+func (r *repository) CreateOAuthState(ctx context.Context, state *OAuthState) error {
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+// ConsumeOAuthState deletes and returns a pending state in one statement, so
+// a state can only be redeemed once across all replicas.
+func (r *repository) ConsumeOAuthState(ctx context.Context, stateHash string) (*OAuthState, error) {
+	var states []OAuthState
+	res := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("state_hash = ?", stateHash).
+		Delete(&states)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(states) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &states[0], nil
+}
+
+func (r *repository) DeleteExpiredOAuthStates(ctx context.Context, before time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&OAuthState{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *repository) GetIntegrationByID(ctx context.Context, integrationID uuid.UUID) (*IntegrationConfiguration, error) {
+	var item IntegrationConfiguration
+	if err := r.db.WithContext(ctx).Where("id = ?", integrationID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SaveOAuthToken stores the token of a connection, replacing any earlier one
+func (r *repository) SaveOAuthToken(ctx context.Context, token *integration.OAuthToken) error {
+	var existing integration.OAuthToken
+	err := r.db.WithContext(ctx).Where("connection_id = ?", token.ConnectionID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.db.WithContext(ctx).Create(token).Error
+	}
+	if err != nil {
+		return err
+	}
+	token.ID = existing.ID
+	token.CreatedAt = existing.CreatedAt
+	return r.db.WithContext(ctx).Save(token).Error
+}
+
+func (r *repository) GetOAuthToken(ctx context.Context, connectionID string) (*integration.OAuthToken, error) {
+	var token integration.OAuthToken
+	if err := r.db.WithContext(ctx).Where("connection_id = ?", connectionID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *repository) DeleteOAuthToken(ctx context.Context, connectionID string) error {
+	return r.db.WithContext(ctx).Where("connection_id = ?", connectionID).Delete(&integration.OAuthToken{}).Error
+}
+
+// ListRefreshableOAuthTokens returns tokens with a refresh token that expire
+// before expiringBefore and are not backing off, soonest first
+func (r *repository) ListRefreshableOAuthTokens(ctx context.Context, expiringBefore, now time.Time, limit int) ([]integration.OAuthToken, error) {
+	var tokens []integration.OAuthToken
+	err := r.db.WithContext(ctx).
+		Where("refresh_token <> '' AND expires_at > ? AND expires_at < ?", time.Unix(0, 0), expiringBefore).
+		Where("next_refresh_at IS NULL OR next_refresh_at <= ?", now).
+		Order("expires_at asc").
+		Limit(limit).
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// ClaimOAuthTokenRefresh leases a token to the caller until leaseUntil. It
+// returns false if another replica holds the lease, so a rotating refresh
+// token is never redeemed twice.
+func (r *repository) ClaimOAuthTokenRefresh(ctx context.Context, tokenID string, now, leaseUntil time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Model(&integration.OAuthToken{}).
+		Where("id = ? AND (next_refresh_at IS NULL OR next_refresh_at <= ?)", tokenID, now).
+		Update("next_refresh_at", leaseUntil)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *repository) RecordIntegrationHealth(ctx context.Context, health *integration.IntegrationHealth) error {
+	return r.db.WithContext(ctx).Create(health).Error
+}
+
+// IncrementAPIKeyUsage adds the counters to their buckets, creating buckets
+// that do not exist yet
+func (r *repository) IncrementAPIKeyUsage(ctx context.Context, buckets []APIKeyUsageBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key_id"}, {Name: "bucket_start"}, {Name: "endpoint"}, {Name: "method"}, {Name: "status_code"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"request_count":    gorm.Expr("api_key_usage_buckets.request_count + excluded.request_count"),
+			"rate_limited":     gorm.Expr("api_key_usage_buckets.rate_limited + excluded.rate_limited"),
+			"total_latency_ms": gorm.Expr("api_key_usage_buckets.total_latency_ms + excluded.total_latency_ms"),
+			"max_latency_ms":   gorm.Expr("GREATEST(api_key_usage_buckets.max_latency_ms, excluded.max_latency_ms)"),
+		}),
+	}).Create(&buckets).Error
+}
+
+func (r *repository) ListAPIKeyUsage(ctx context.Context, keyID uuid.UUID, from, to time.Time) ([]APIKeyUsageBucket, error) {
+	var buckets []APIKeyUsageBucket
+	err := r.db.WithContext(ctx).
+		Where("key_id = ? AND bucket_start >= ? AND bucket_start < ?", keyID, from, to).
+		Order("bucket_start asc").
+		Find(&buckets).Error
+	return buckets, err
+}
+
+func (r *repository) ListAPIKeysExpiringBetween(ctx context.Context, from, to time.Time) ([]APIKey, error) {
+	var keys []APIKey
+	err := r.db.WithContext(ctx).
+		Where("is_active = ? AND expires_at > ? AND expires_at <= ?", true, from, to).
+		Order("expires_at asc").
+		Find(&keys).Error
+	return keys, err
+}
+
+// ListAPIKeyHourlyUsage totals the usage buckets of every key per hour
+func (r *repository) ListAPIKeyHourlyUsage(ctx context.Context, from, to time.Time) ([]APIKeyHourlyUsage, error) {
+	var rows []APIKeyHourlyUsage
+	err := r.db.WithContext(ctx).Model(&APIKeyUsageBucket{}).
+		Select("key_id, user_id, bucket_start, SUM(request_count) AS requests").
+		Where("bucket_start >= ? AND bucket_start < ?", from, to).
+		Group("key_id, user_id, bucket_start").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *repository) CreateAPIKeyWebhookDelivery(ctx context.Context, delivery *APIKeyWebhookDelivery) error {
+	return r.db.WithContext(ctx).Create(delivery).Error
+}
+
+func (r *repository) SaveAPIKeyWebhookDelivery(ctx context.Context, delivery *APIKeyWebhookDelivery) error {
+	return r.db.WithContext(ctx).Save(delivery).Error
+}
+
+func (r *repository) GetAPIKeyWebhookDelivery(ctx context.Context, keyID, deliveryID uuid.UUID) (*APIKeyWebhookDelivery, error) {
+	var delivery APIKeyWebhookDelivery
+	if err := r.db.WithContext(ctx).Where("id = ? AND key_id = ?", deliveryID, keyID).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *repository) ListAPIKeyWebhookDeliveries(ctx context.Context, keyID uuid.UUID, limit int) ([]APIKeyWebhookDelivery, error) {
+	var deliveries []APIKeyWebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("key_id = ?", keyID).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *repository) ListDueAPIKeyWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]APIKeyWebhookDelivery, error) {
+	var deliveries []APIKeyWebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", "pending", now).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimAPIKeyWebhookDelivery leases a due delivery to this replica so it is
+// not sent twice. It reports false when another replica holds the lease.
+func (r *repository) ClaimAPIKeyWebhookDelivery(ctx context.Context, deliveryID uuid.UUID, now, leaseUntil time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&APIKeyWebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", deliveryID, "pending", now).
+		Update("next_attempt_at", leaseUntil)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ListActiveIntegrations pages through active integrations of all users in
+// id order
+func (r *repository) ListActiveIntegrations(ctx context.Context, afterID uuid.UUID, limit int) ([]IntegrationConfiguration, error) {
+	var items []IntegrationConfiguration
+	err := r.db.WithContext(ctx).
+		Where("is_active = ? AND id > ?", true, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+func (r *repository) ListIntegrationHealth(ctx context.Context, connectionID string, since time.Time) ([]integration.IntegrationHealth, error) {
+	var history []integration.IntegrationHealth
+	err := r.db.WithContext(ctx).
+		Where("connection_id = ? AND checked_at >= ?", connectionID, since).
+		Order("checked_at asc").
+		Find(&history).Error
+	return history, err
+}
+
+func (r *repository) DeleteIntegrationHealthBefore(ctx context.Context, before time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("checked_at < ?", before).Delete(&integration.IntegrationHealth{})
+	return res.RowsAffected, res.Error
+}
+
+// ListVaultedValues pages through the non-empty values of a column in id
+// order. Table and column come from a fixed list, never from input.
+func (r *repository) ListVaultedValues(ctx context.Context, column VaultedColumn, afterID string, limit int) ([]VaultedValue, error) {
+	var values []VaultedValue
+	err := r.db.WithContext(ctx).
+		Table(column.Table).
+		Select(fmt.Sprintf("id::text AS id, %s AS value", column.Column)).
+		Where(fmt.Sprintf("id::text > ? AND %s IS NOT NULL AND %s <> ''", column.Column, column.Column), afterID).
+		Order("id::text").
+		Limit(limit).
+		Scan(&values).Error
+	return values, err
+}
+
+// SwapVaultedValue replaces a value only if it still holds old, so a
+// concurrent write is never overwritten
+func (r *repository) SwapVaultedValue(ctx context.Context, column VaultedColumn, id, old, new string) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Table(column.Table).
+		Where(fmt.Sprintf("id::text = ? AND %s = ?", column.Column), id, old).
+		Update(column.Column, new)
+	return res.RowsAffected == 1, res.Error
+}
+
 func (r *repository) GetSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error) {
 	var sub Subscription
 	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&sub).Error
@@ -218,6 +532,57 @@ func (r *repository) SaveSubscription(ctx context.Context, sub *Subscription) er
 	return r.db.WithContext(ctx).Save(sub).Error
 }
 
+// ListSubscriptionsDue pages, in id order, through subscriptions whose
+// period has ended and that renew on schedule rather than through dunning
+func (r *repository) ListSubscriptionsDue(ctx context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	var subs []Subscription
+	err := r.db.WithContext(ctx).
+		Where("current_period_end <= ? AND status IN ? AND id > ?", now, []string{"active", "trialing", "canceled"}, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&subs).Error
+	return subs, err
+}
+
+func (r *repository) ListSubscriptions(ctx context.Context, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	var subs []Subscription
+	err := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&subs).Error
+	return subs, err
+}
+
+// UpdateSubscriptionUsage merges measured metrics into the stored ones, so
+// counters recorded by RecordUsage are kept, and replaces the warnings
+func (r *repository) UpdateSubscriptionUsage(ctx context.Context, subID uuid.UUID, metrics map[string]interface{}, warnings datatypes.JSONMap, collectedAt time.Time) error {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&Subscription{}).Where("id = ?", subID).Updates(map[string]interface{}{
+		"usage_metrics":      gorm.Expr("COALESCE(usage_metrics, '{}'::jsonb) || ?::jsonb", string(data)),
+		"quota_warnings":     warnings,
+		"usage_collected_at": collectedAt,
+	}).Error
+}
+
+func (r *repository) IncrementSubscriptionUsage(ctx context.Context, subID uuid.UUID, metric string, delta int64) error {
+	return r.db.WithContext(ctx).Model(&Subscription{}).Where("id = ?", subID).
+		Update("usage_metrics", gorm.Expr(
+			"jsonb_set(COALESCE(usage_metrics, '{}'::jsonb), ARRAY[?]::text[], to_jsonb(COALESCE((usage_metrics->>?)::numeric, 0) + ?))",
+			metric, metric, delta,
+		)).Error
+}
+
+// SumAPIKeyRequests counts a user's API requests in [from, to), leaving out
+// those rejected by rate limits
+func (r *repository) SumAPIKeyRequests(ctx context.Context, userID uuid.UUID, from, to time.Time) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&APIKeyUsageBucket{}).
+		Where("user_id = ? AND bucket_start >= ? AND bucket_start < ?", userID, from, to).
+		Select("COALESCE(SUM(request_count - rate_limited), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
 func (r *repository) ListInvoices(ctx context.Context, userID uuid.UUID, limit int) ([]Invoice, error) {
 	var invoices []Invoice
 	q := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc")
@@ -241,3 +606,220 @@ func (r *repository) GetInvoice(ctx context.Context, userID, invoiceID uuid.UUID
 func (r *repository) SaveInvoice(ctx context.Context, invoice *Invoice) error {
 	return r.db.WithContext(ctx).Save(invoice).Error
 }
+
+func (r *repository) GetInvoiceByID(ctx context.Context, invoiceID uuid.UUID) (*Invoice, error) {
+	var invoice Invoice
+	if err := r.db.WithContext(ctx).Where("id = ?", invoiceID).First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// ListInvoicesToIssue pages through draft invoices and, when
+// includeUnrendered is set, issued invoices whose PDF is not stored yet
+func (r *repository) ListInvoicesToIssue(ctx context.Context, includeUnrendered bool, afterID uuid.UUID, limit int) ([]Invoice, error) {
+	var invoices []Invoice
+	q := r.db.WithContext(ctx).Where("id > ?", afterID)
+	if includeUnrendered {
+		q = q.Where("status = ? OR (finalized_at IS NOT NULL AND COALESCE(pdf_key, '') = '')", "draft")
+	} else {
+		q = q.Where("status = ?", "draft")
+	}
+	err := q.Order("id").Limit(limit).Find(&invoices).Error
+	return invoices, err
+}
+
+// FinalizeInvoice numbers a draft invoice from the series and saves it. The
+// sequence row stays locked until the invoice is written, so numbers are
+// gap-free. It reports false if the invoice was no longer a draft.
+func (r *repository) FinalizeInvoice(ctx context.Context, invoice *Invoice, series string) (bool, error) {
+	finalized := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		number, err := nextInvoiceNumber(tx, series)
+		if err != nil {
+			return err
+		}
+		invoice.InvoiceNumber = number
+		res := tx.Model(&Invoice{}).Where("id = ? AND status = ?", invoice.ID, "draft").Select("*").Updates(invoice)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Roll back so the number is not used up
+			return errInvoiceNotDraft
+		}
+		finalized = true
+		return nil
+	})
+	if errors.Is(err, errInvoiceNotDraft) {
+		return false, nil
+	}
+	return finalized, err
+}
+
+var errInvoiceNotDraft = errors.New("invoice is no longer a draft")
+
+// CreateCreditNote numbers and stores a credit note and adds it to the
+// credited invoice, voiding an unpaid invoice once it is fully credited. It
+// reports false when the credit exceeds what is left on the invoice.
+func (r *repository) CreateCreditNote(ctx context.Context, note *Invoice, series string) (bool, error) {
+	if note.CreditedInvoiceID == nil {
+		return false, fmt.Errorf("credit note has no invoice")
+	}
+	credit := -note.TotalAmount
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Invoice{}).
+			Where("id = ? AND amount_credited + ? <= total_amount", *note.CreditedInvoiceID, credit).
+			Updates(map[string]interface{}{
+				"amount_credited": gorm.Expr("amount_credited + ?", credit),
+				"status":          gorm.Expr("CASE WHEN status = 'open' AND amount_credited + ? >= total_amount THEN 'void' ELSE status END", credit),
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		number, err := nextInvoiceNumber(tx, series)
+		if err != nil {
+			return err
+		}
+		note.InvoiceNumber = number
+		if err := tx.Create(note).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func (r *repository) SetInvoicePDF(ctx context.Context, invoiceID uuid.UUID, key string, generatedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&Invoice{}).Where("id = ?", invoiceID).
+		Updates(map[string]interface{}{"pdf_key": key, "pdf_generated_at": generatedAt}).Error
+}
+
+// nextInvoiceNumber takes the next number of a series, locking the series
+// row for the rest of the transaction
+func nextInvoiceNumber(tx *gorm.DB, series string) (string, error) {
+	var seq int
+	err := tx.Raw(`INSERT INTO invoice_sequences (series, last_value) VALUES (?, 1)
+		ON CONFLICT (series) DO UPDATE SET last_value = invoice_sequences.last_value + 1
+		RETURNING last_value`, series).Scan(&seq).Error
+	if err != nil {
+		return "", err
+	}
+	return settingsbilling.InvoiceNumber(series, seq), nil
+}
+
+// ListInvoicesDueForPayment pages through open invoices that have never
+// been charged or whose retry is due. Invoices whose retries are exhausted
+// wait for a new payment method.
+func (r *repository) ListInvoicesDueForPayment(ctx context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Invoice, error) {
+	var invoices []Invoice
+	err := r.db.WithContext(ctx).
+		Where("id > ? AND kind = ? AND status = ? AND total_amount > amount_credited", afterID, settingsbilling.KindInvoice, "open").
+		Where("(payment_attempts = 0 AND next_payment_attempt IS NULL) OR next_payment_attempt <= ?", now).
+		Order("id").Limit(limit).Find(&invoices).Error
+	return invoices, err
+}
+
+func (r *repository) GetInvoiceByTransaction(ctx context.Context, transactionID string) (*Invoice, error) {
+	var invoice Invoice
+	if err := r.db.WithContext(ctx).Where("transaction_id = ?", transactionID).First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// UpdateInvoicePayment writes only the payment columns, leaving credits
+// recorded concurrently intact
+func (r *repository) UpdateInvoicePayment(ctx context.Context, invoice *Invoice) error {
+	return r.db.WithContext(ctx).Model(&Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+		"status":               invoice.Status,
+		"paid_at":              invoice.PaidAt,
+		"payment_method":       invoice.PaymentMethod,
+		"transaction_id":       invoice.TransactionID,
+		"payment_attempts":     invoice.PaymentAttempts,
+		"next_payment_attempt": invoice.NextPaymentAttempt,
+		"last_payment_error":   invoice.LastPaymentError,
+	}).Error
+}
+
+func (r *repository) ListSubscriptionsUnpaidSince(ctx context.Context, before time.Time, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	var subs []Subscription
+	err := r.db.WithContext(ctx).
+		Where("id > ? AND status = ? AND unpaid_since <= ?", afterID, "unpaid", before).
+		Order("id").Limit(limit).Find(&subs).Error
+	return subs, err
+}
+
+// RecordPaymentEvent stores a webhook event id, reporting false if it was
+// already recorded
+func (r *repository) RecordPaymentEvent(ctx context.Context, event *PaymentWebhookEvent) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *repository) DeletePaymentEvent(ctx context.Context, eventID string) error {
+	return r.db.WithContext(ctx).Where("id = ?", eventID).Delete(&PaymentWebhookEvent{}).Error
+}
+
+func (r *repository) CreateAccountExport(ctx context.Context, export *AccountExport) error {
+	return r.db.WithContext(ctx).Create(export).Error
+}
+
+func (r *repository) SaveAccountExport(ctx context.Context, export *AccountExport) error {
+	return r.db.WithContext(ctx).Save(export).Error
+}
+
+func (r *repository) GetAccountExport(ctx context.Context, userID, exportID uuid.UUID) (*AccountExport, error) {
+	var export AccountExport
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *repository) ListAccountExports(ctx context.Context, userID uuid.UUID, limit int) ([]AccountExport, error) {
+	var exports []AccountExport
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("requested_at desc").Limit(limit).Find(&exports).Error
+	return exports, err
+}
+
+// FindActiveAccountExport returns the user's pending or processing export
+func (r *repository) FindActiveAccountExport(ctx context.Context, userID uuid.UUID) (*AccountExport, error) {
+	var export AccountExport
+	err := r.db.WithContext(ctx).Where("user_id = ? AND status IN ?", userID, []string{"pending", "processing"}).
+		Order("requested_at").First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ListAccountExportsToProcess returns pending exports and those whose
+// worker stopped before finishing
+func (r *repository) ListAccountExportsToProcess(ctx context.Context, staleBefore time.Time, limit int) ([]AccountExport, error) {
+	var exports []AccountExport
+	err := r.db.WithContext(ctx).
+		Where("status = ? OR (status = ? AND started_at < ?)", "pending", "processing", staleBefore).
+		Order("requested_at").Limit(limit).Find(&exports).Error
+	return exports, err
+}
+
+// ClaimAccountExport marks an export as being processed, reporting false if
+// another worker holds it
+func (r *repository) ClaimAccountExport(ctx context.Context, exportID uuid.UUID, now, staleBefore time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&AccountExport{}).
+		Where("id = ? AND (status = ? OR (status = ? AND started_at < ?))", exportID, "pending", "processing", staleBefore).
+		Updates(map[string]interface{}{"status": "processing", "started_at": now})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *repository) ListExpiredAccountExports(ctx context.Context, now time.Time, limit int) ([]AccountExport, error) {
+	var exports []AccountExport
+	err := r.db.WithContext(ctx).Where("status = ? AND expires_at <= ?", "completed", now).Order("expires_at").Limit(limit).Find(&exports).Error
+	return exports, err
+}
@@ -5,12 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
-	"sync"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/integration"
 	settingsapi "carbon-scribe/project-portal/project-portal-backend/internal/settings/api"
 	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
 	settingsintegrations "carbon-scribe/project-portal/project-portal-backend/internal/settings/integrations"
@@ -24,19 +26,64 @@ import (
 	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type Config struct {
-	EncryptionKeyHex string
-	APIKeyPrefix     string
-	ProfileCDNBase   string
+	EncryptionKeyHex   string
+	APIKeyPrefix       string
+	ProfileCDNBase     string
+	OAuthProviders     []settingsintegrations.OAuthProvider
+	OAuthHTTPClient    *http.Client  // nil uses a client with a 15s timeout
+	OAuthRefreshWindow time.Duration // how long before expiry tokens are renewed
+	// KMS enables envelope encryption; EncryptionKeyHex then only reads
+	// values written before it was configured
+	KMS                 encryption.KMS
+	KeyRotationInterval time.Duration // age at which the master key is rotated; 0 disables
+	// Probes checks integrations against their providers; nil uses the
+	// defaults with a client that refuses private addresses
+	Probes                 *settingsintegrations.ProbeRegistry
+	HealthHistoryRetention time.Duration
+	// WebhookHTTPClient sends API key webhooks; nil uses a client that
+	// refuses private addresses
+	WebhookHTTPClient   *http.Client
+	APIKeyExpiryWarning time.Duration            // how long before expiry api_key.expiring is sent
+	Plans               *settingsbilling.Catalog // nil uses the default plans
+	// UsageMeters measure billing metrics from other modules; API calls
+	// are always metered
+	UsageMeters   []UsageMeter
+	UsageNotifier UsageNotifier // nil only logs quota warnings
+	// InvoiceStore keeps invoice PDFs; nil leaves invoices without PDFs
+	InvoiceStore     InvoiceStore
+	InvoiceURLExpiry time.Duration             // lifetime of presigned invoice PDF links
+	TaxRates         *settingsbilling.TaxTable // nil uses the default rates
+	PaymentTermsDays int                       // days from issue until an invoice is due
+	// PaymentProcessor charges invoices; nil disables payments, leaving
+	// invoices open and refunds credited to the account
+	PaymentProcessor pkgbilling.PaymentProcessor
+	Dunning          settingsbilling.DunningPolicy // zero uses the default schedule
+	BillingNotifier  BillingNotifier               // nil only audits billing notices
+	// PictureStore keeps profile pictures; nil disables uploads
+	PictureStore           PictureStore
+	ProfilePictureMaxBytes int64 // largest accepted upload
+	ProfilePictureSizes    []int // thumbnail edges in pixels, largest first
+	// ExportSources add other modules' data to account exports
+	ExportSources   []ExportSource
+	ExportStore     ExportStore           // nil disables account exports
+	ExportNotifier  AccountExportNotifier // nil leaves users to fetch the link
+	ExportRetention time.Duration         // how long finished archives are kept
+	ExportURLExpiry time.Duration         // lifetime of presigned download links
 }
 
 type Service interface {
 	GetProfile(ctx context.Context, userID uuid.UUID) (*UserProfile, error)
 	UpdateProfile(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*UserProfile, error)
-	UploadProfilePicture(ctx context.Context, userID uuid.UUID, filename string) (*ProfilePictureUploadResponse, error)
+	UploadProfilePicture(ctx context.Context, userID uuid.UUID, data []byte) (*ProfilePictureUploadResponse, error)
 	ExportProfile(ctx context.Context, userID uuid.UUID, format string) ([]byte, string, error)
+	RequestAccountExport(ctx context.Context, userID uuid.UUID) (*AccountExport, error)
+	ListAccountExports(ctx context.Context, userID uuid.UUID) ([]AccountExport, error)
+	GetAccountExport(ctx context.Context, userID, exportID uuid.UUID) (*AccountExport, error)
+	ProcessAccountExports(ctx context.Context) (*AccountExportRunResult, error)
 	DeleteProfile(ctx context.Context, userID uuid.UUID) (*DeleteProfileResponse, error)
 	GetNotifications(ctx context.Context, userID uuid.UUID) (*NotificationPreference, error)
 	UpdateNotifications(ctx context.Context, userID uuid.UUID, req UpdateNotificationPreferencesRequest) (*NotificationPreference, error)
@@ -44,19 +91,43 @@ type Service interface {
 	CreateAPIKey(ctx context.Context, userID uuid.UUID, req CreateAPIKeyRequest) (*CreateAPIKeyResponse, error)
 	RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error
 	RotateAPIKey(ctx context.Context, userID, keyID uuid.UUID) (*CreateAPIKeyResponse, error)
-	GetAPIKeyUsage(ctx context.Context, userID, keyID uuid.UUID) (*APIKeyUsageAnalytics, error)
+	GetAPIKeyUsage(ctx context.Context, userID, keyID uuid.UUID, rng APIKeyUsageRange) (*APIKeyUsageAnalytics, error)
+	RecordAPIKeyRequest(ctx context.Context, record settingsapi.RequestRecord)
+	FlushAPIKeyUsage(ctx context.Context) (int, error)
 	ConfigureAPIKeyWebhooks(ctx context.Context, userID, keyID uuid.UUID, req ConfigureAPIKeyWebhooksRequest) (*APIKeyPublic, error)
+	ListAPIKeyWebhookDeliveries(ctx context.Context, userID, keyID uuid.UUID) ([]APIKeyWebhookDelivery, error)
+	ReplayAPIKeyWebhookDelivery(ctx context.Context, userID, keyID, deliveryID uuid.UUID) (*APIKeyWebhookDelivery, error)
+	ProcessAPIKeyWebhooks(ctx context.Context) (*APIKeyWebhookRunResult, error)
 	ValidateAPIKeySecret(ctx context.Context, req ValidateAPIKeyRequest) (*ValidateAPIKeyResponse, error)
 	ListIntegrations(ctx context.Context, userID uuid.UUID) ([]IntegrationConfigurationPublic, error)
 	ConfigureIntegration(ctx context.Context, userID uuid.UUID, req ConfigureIntegrationRequest) (*IntegrationConfigurationPublic, error)
 	BatchConfigureIntegrations(ctx context.Context, userID uuid.UUID, req BatchConfigureIntegrationsRequest) ([]IntegrationConfigurationPublic, error)
 	StartOAuthFlow(ctx context.Context, userID uuid.UUID, provider string) (*OAuthStartResponse, error)
 	CompleteOAuthFlow(ctx context.Context, userID uuid.UUID, provider string, req OAuthCallbackRequest) (*OAuthCallbackResponse, error)
-	GetIntegrationHealth(ctx context.Context, userID, integrationID uuid.UUID) (*IntegrationHealthResponse, error)
+	RevokeOAuthIntegration(ctx context.Context, userID, integrationID uuid.UUID) (*IntegrationConfigurationPublic, error)
+	RefreshExpiringOAuthTokens(ctx context.Context) (*OAuthRefreshResult, error)
+	RunKeyRotation(ctx context.Context) (*KeyRotationResult, error)
+	GetIntegrationHealth(ctx context.Context, userID, integrationID uuid.UUID, window time.Duration) (*IntegrationHealthResponse, error)
+	ProbeIntegrations(ctx context.Context) (*IntegrationProbeRunResult, error)
 	GetBilling(ctx context.Context, userID uuid.UUID) (*BillingSummary, error)
 	ListInvoices(ctx context.Context, userID uuid.UUID) ([]Invoice, error)
 	GetInvoicePDF(ctx context.Context, userID, invoiceID uuid.UUID) (*InvoicePDFResponse, error)
 	AddPaymentMethod(ctx context.Context, userID uuid.UUID, req AddPaymentMethodRequest) (*Subscription, error)
+	ListPlans(ctx context.Context) []settingsbilling.Plan
+	GetEntitlements(ctx context.Context, userID uuid.UUID) (*Entitlements, error)
+	CheckFeature(ctx context.Context, userID uuid.UUID, feature string) error
+	CheckQuota(ctx context.Context, userID uuid.UUID, quota string, increment int64) error
+	ChangePlan(ctx context.Context, userID uuid.UUID, req ChangePlanRequest) (*ChangePlanResponse, error)
+	CancelSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error)
+	ResumeSubscription(ctx context.Context, userID uuid.UUID) (*Subscription, error)
+	RenewSubscriptions(ctx context.Context) (*SubscriptionRenewalResult, error)
+	GetUsage(ctx context.Context, userID uuid.UUID) (*UsageSummary, error)
+	RecordUsage(ctx context.Context, userID uuid.UUID, metric string, quantity int64) error
+	CollectUsage(ctx context.Context) (*UsageCollectionResult, error)
+	IssueInvoices(ctx context.Context) (*InvoiceRunResult, error)
+	IssueCreditNote(ctx context.Context, issuedBy, invoiceID uuid.UUID, req CreditNoteRequest) (*Invoice, error)
+	CollectPayments(ctx context.Context) (*PaymentRunResult, error)
+	HandlePaymentWebhook(ctx context.Context, payload []byte, signature string) error
 }
 
 type service struct {
@@ -65,15 +136,19 @@ type service struct {
 	invoiceGenerator pkgbilling.InvoiceGenerator
 	cfg              Config
 	usageTracker     *settingsapi.KeyUsageTracker
-	oauthMu          sync.Mutex
-	oauthStates      map[string]oauthState
+	usageBuffer      *settingsapi.UsageBuffer
+	oauthProviders   *settingsintegrations.ProviderRegistry
+	oauthClient      *settingsintegrations.OAuthClient
+	probes           *settingsintegrations.ProbeRegistry
+	webhookClient    *http.Client
 }
 
-type oauthState struct {
-	UserID    uuid.UUID
-	Provider  string
-	ExpiresAt time.Time
-	CreatedAt time.Time
+// oauthStateTTL bounds how long a user has to complete provider consent
+const oauthStateTTL = 10 * time.Minute
+
+func hashOAuthState(state string) string {
+	h := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(h[:])
 }
 
 func NewService(repo Repository, cfg Config) (Service, error) {
@@ -81,23 +156,75 @@ func NewService(repo Repository, cfg Config) (Service, error) {
 	if err != nil {
 		return nil, err
 	}
-	vault, err := encryption.NewVault(key)
+	var vault *encryption.Vault
+	if cfg.KMS != nil {
+		vault, err = encryption.NewEnvelopeVault(cfg.KMS, key)
+	} else {
+		vault, err = encryption.NewVault(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	providers, err := settingsintegrations.NewProviderRegistry(cfg.OAuthProviders...)
 	if err != nil {
 		return nil, err
 	}
 	if strings.TrimSpace(cfg.APIKeyPrefix) == "" {
 		cfg.APIKeyPrefix = "ppk_live"
 	}
+	if cfg.OAuthRefreshWindow <= 0 {
+		cfg.OAuthRefreshWindow = defaultOAuthRefreshWindow
+	}
+	if cfg.Probes == nil {
+		cfg.Probes = settingsintegrations.DefaultProbes(settingsintegrations.NewProbeHTTPClient(10*time.Second, false))
+	}
+	if cfg.WebhookHTTPClient == nil {
+		cfg.WebhookHTTPClient = settingsintegrations.NewProbeHTTPClient(10*time.Second, false)
+	}
+	if cfg.Plans == nil {
+		cfg.Plans = settingsbilling.DefaultCatalog()
+	}
+	if cfg.TaxRates == nil {
+		cfg.TaxRates = settingsbilling.DefaultTaxRates()
+	}
+	if cfg.PaymentTermsDays <= 0 {
+		cfg.PaymentTermsDays = settingsbilling.DefaultPaymentTermsDays
+	}
+	if cfg.InvoiceURLExpiry <= 0 {
+		cfg.InvoiceURLExpiry = defaultInvoiceURLExpiry
+	}
+	if len(cfg.Dunning.RetryDelays) == 0 && cfg.Dunning.CancelAfter == 0 {
+		cfg.Dunning = settingsbilling.DefaultDunningPolicy()
+	}
+	if cfg.ProfilePictureMaxBytes <= 0 {
+		cfg.ProfilePictureMaxBytes = defaultProfilePictureMaxBytes
+	}
+	if len(cfg.ProfilePictureSizes) == 0 {
+		cfg.ProfilePictureSizes = settingsprofile.DefaultPictureSizes
+	}
+	if err := settingsprofile.ValidatePictureSizes(cfg.ProfilePictureSizes); err != nil {
+		return nil, err
+	}
+	if cfg.ExportRetention <= 0 {
+		cfg.ExportRetention = defaultExportRetention
+	}
+	if cfg.ExportURLExpiry <= 0 {
+		cfg.ExportURLExpiry = defaultExportURLExpiry
+	}
 	if strings.TrimSpace(cfg.ProfileCDNBase) == "" {
 		cfg.ProfileCDNBase = "https://cdn.carbonscribe.local"
 	}
 	return &service{
 		repo:             repo,
 		vault:            vault,
-		invoiceGenerator: pkgbilling.NoopInvoiceGenerator{},
+		invoiceGenerator: pkgbilling.NewPDFInvoiceGenerator(),
 		cfg:              cfg,
 		usageTracker:     settingsapi.NewKeyUsageTracker(),
-		oauthStates:      map[string]oauthState{},
+		usageBuffer:      settingsapi.NewUsageBuffer(),
+		oauthProviders:   providers,
+		oauthClient:      settingsintegrations.NewOAuthClient(cfg.OAuthHTTPClient),
+		probes:           cfg.Probes,
+		webhookClient:    cfg.WebhookHTTPClient,
 	}, nil
 }
 
@@ -183,20 +310,6 @@ func (s *service) UpdateProfile(ctx context.Context, userID uuid.UUID, req Updat
 	return profile, nil
 }
 
-func (s *service) UploadProfilePicture(ctx context.Context, userID uuid.UUID, filename string) (*ProfilePictureUploadResponse, error) {
-	profile, err := s.repo.GetOrCreateProfile(ctx, userID)
-	if err != nil {
-		return nil, err
-	}
-	url := settingsprofile.BuildProfilePictureURL(s.cfg.ProfileCDNBase, userID, filename)
-	profile.ProfilePictureURL = url
-	if err := s.repo.SaveProfile(ctx, profile); err != nil {
-		return nil, err
-	}
-	s.audit("profile.picture.upload", userID, map[string]interface{}{"filename": filename})
-	return &ProfilePictureUploadResponse{ProfilePictureURL: url, Message: "profile picture updated"}, nil
-}
-
 func (s *service) ExportProfile(ctx context.Context, userID uuid.UUID, format string) ([]byte, string, error) {
 	profile, err := s.repo.GetOrCreateProfile(ctx, userID)
 	if err != nil {
@@ -211,8 +324,22 @@ func (s *service) ExportProfile(ctx context.Context, userID uuid.UUID, format st
 		"notifications": prefs,
 	}
 	if strings.EqualFold(format, "pdf") {
+		sections, summary, err := s.collectExportSections(ctx, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		categories := make([]settingsprofile.ExportManifestCategory, 0, len(sections))
+		for _, section := range sections {
+			categories = append(categories, settingsprofile.ExportManifestCategory{Category: section.Category, Records: settingsprofile.ExportRecords(section.Data)})
+		}
+		summary.ExportID = "summary"
+		summary.GeneratedAt = time.Now().UTC()
+		pdf, err := settingsprofile.RenderExportSummaryPDF(summary, categories)
+		if err != nil {
+			return nil, "", err
+		}
 		s.audit("profile.export.pdf", userID, nil)
-		return settingsprofile.ExportPDFPlaceholder(), "application/pdf", nil
+		return pdf, "application/pdf", nil
 	}
 	b, err := settingsprofile.ExportJSON(payload)
 	if err != nil {
@@ -228,6 +355,9 @@ func (s *service) DeleteProfile(ctx context.Context, userID uuid.UUID) (*DeleteP
 	if err := s.repo.DeleteProfileData(ctx, userID); err != nil {
 		return nil, err
 	}
+	if beforeProfile != nil {
+		s.deletePictureFiles(ctx, profilePictureKeys(beforeProfile))
+	}
 	s.audit("profile.delete", userID, map[string]interface{}{
 		"before": map[string]interface{}{
 			"profile":       beforeProfile,
@@ -298,6 +428,14 @@ func (s *service) CreateAPIKey(ctx context.Context, userID uuid.UUID, req Create
 	if err := settingsapi.ValidateScopes(req.Scopes); err != nil {
 		return nil, err
 	}
+	if err := validateWebhookSubscriptions(req.Webhooks); err != nil {
+		return nil, err
+	}
+	if len(req.Webhooks) > 0 {
+		if err := s.CheckFeature(ctx, userID, settingsbilling.FeatureWebhooks); err != nil {
+			return nil, err
+		}
+	}
 	if req.RateLimitPerMinute <= 0 {
 		req.RateLimitPerMinute = 60
 	}
@@ -333,11 +471,21 @@ func (s *service) CreateAPIKey(ctx context.Context, userID uuid.UUID, req Create
 	key.Metadata["usage_today"] = 0
 	key.Metadata["usage_day"] = time.Now().UTC().Format("2006-01-02")
 	key.Metadata["webhooks"] = []APIKeyWebhookSubscription{}
+	webhookSecret := ""
+	if len(req.Webhooks) > 0 {
+		key.Metadata["webhooks"] = req.Webhooks
+		if webhookSecret, err = s.ensureWebhookSecret(key); err != nil {
+			return nil, err
+		}
+	}
 	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
 		return nil, err
 	}
 	s.audit("api_key.create", userID, map[string]interface{}{"after": key})
-	return &CreateAPIKeyResponse{APIKey: toAPIKeyPublic(*key), Secret: secret, Message: "Store this key now. It will not be shown again."}, nil
+	s.emitAPIKeyEvent(ctx, key, settingsapi.EventKeyCreated, nil)
+	pub := toAPIKeyPublic(*key)
+	pub.WebhookSigningSecret = webhookSecret
+	return &CreateAPIKeyResponse{APIKey: pub, Secret: secret, Message: "Store this key now. It will not be shown again."}, nil
 }
 
 func (s *service) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
@@ -355,6 +503,7 @@ func (s *service) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) err
 		return err
 	}
 	s.audit("api_key.revoke", userID, map[string]interface{}{"before": before, "after": key})
+	s.emitAPIKeyEvent(ctx, key, settingsapi.EventKeyRevoked, map[string]interface{}{"revoked_at": key.Metadata["revoked_at"]})
 	return nil
 }
 
@@ -384,47 +533,22 @@ func (s *service) RotateAPIKey(ctx context.Context, userID, keyID uuid.UUID) (*C
 		return nil, err
 	}
 	s.audit("api_key.rotate", userID, map[string]interface{}{"before": before, "after": key})
+	s.emitAPIKeyEvent(ctx, key, settingsapi.EventKeyRotated, map[string]interface{}{
+		"grace_period_until": key.Metadata["rotation_grace_period_until"],
+	})
 	return &CreateAPIKeyResponse{APIKey: toAPIKeyPublic(*key), Secret: secret, Message: "API key rotated. Grace period metadata recorded for migration."}, nil
 }
 
-func (s *service) GetAPIKeyUsage(ctx context.Context, userID, keyID uuid.UUID) (*APIKeyUsageAnalytics, error) {
+func (s *service) ConfigureAPIKeyWebhooks(ctx context.Context, userID, keyID uuid.UUID, req ConfigureAPIKeyWebhooksRequest) (*APIKeyPublic, error) {
 	key, err := s.repo.GetAPIKey(ctx, userID, keyID)
 	if err != nil {
 		return nil, err
 	}
-	analytics := &APIKeyUsageAnalytics{
-		KeyID:              key.ID,
-		LastUsedAt:         key.LastUsedAt,
-		RateLimitPerMinute: key.RateLimitPerMinute,
-		RateLimitPerDay:    key.RateLimitPerDay,
-	}
-	if key.Metadata != nil {
-		analytics.RequestCountTotal = int64(jsonNumberToInt(key.Metadata["usage_total"]))
-		usageDay := stringValue(key.Metadata["usage_day"])
-		if usageDay == time.Now().UTC().Format("2006-01-02") {
-			analytics.RequestCountToday = int64(jsonNumberToInt(key.Metadata["usage_today"]))
-		}
-		if ts, ok := parseMetadataTime(key.Metadata["last_rate_limit_exceeded_at"]); ok {
-			analytics.LastRateLimitExceeded = &ts
-		}
-	}
-	if minuteCount, dayCount, ok := s.usageTracker.Snapshot(key.ID); ok {
-		analytics.RequestCountToday = int64(dayCount)
-		_ = minuteCount
-	}
-	return analytics, nil
-}
-
-func (s *service) ConfigureAPIKeyWebhooks(ctx context.Context, userID, keyID uuid.UUID, req ConfigureAPIKeyWebhooksRequest) (*APIKeyPublic, error) {
-	key, err := s.repo.GetAPIKey(ctx, userID, keyID)
-	if err != nil {
+	if err := validateWebhookSubscriptions(req.Webhooks); err != nil {
 		return nil, err
 	}
-	for _, wh := range req.Webhooks {
-		if strings.TrimSpace(wh.Event) == "" {
-			return nil, fmt.Errorf("webhook event is required")
-		}
-		if err := v.ValidateOptionalURL(wh.TargetURL); err != nil {
+	if len(req.Webhooks) > 0 {
+		if err := s.CheckFeature(ctx, userID, settingsbilling.FeatureWebhooks); err != nil {
 			return nil, err
 		}
 	}
@@ -433,14 +557,39 @@ func (s *service) ConfigureAPIKeyWebhooks(ctx context.Context, userID, keyID uui
 		key.Metadata = datatypes.JSONMap{}
 	}
 	key.Metadata["webhooks"] = req.Webhooks
+	webhookSecret := ""
+	if len(req.Webhooks) > 0 {
+		if webhookSecret, err = s.ensureWebhookSecret(key); err != nil {
+			return nil, err
+		}
+	}
 	if err := s.repo.SaveAPIKey(ctx, key); err != nil {
 		return nil, err
 	}
 	s.audit("api_key.webhooks.update", userID, map[string]interface{}{"key_id": keyID, "before": before, "after": key.Metadata})
 	pub := toAPIKeyPublic(*key)
+	pub.WebhookSigningSecret = webhookSecret
 	return &pub, nil
 }
 
+func validateWebhookSubscriptions(webhooks []APIKeyWebhookSubscription) error {
+	for _, wh := range webhooks {
+		if strings.TrimSpace(wh.Event) == "" {
+			return fmt.Errorf("webhook event is required")
+		}
+		if err := settingsapi.ValidateWebhookEvent(wh.Event); err != nil {
+			return err
+		}
+		if strings.TrimSpace(wh.TargetURL) == "" {
+			return fmt.Errorf("webhook target_url is required")
+		}
+		if err := v.ValidateOptionalURL(wh.TargetURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *service) ValidateAPIKeySecret(ctx context.Context, req ValidateAPIKeyRequest) (*ValidateAPIKeyResponse, error) {
 	secret := strings.TrimSpace(req.Secret)
 	if secret == "" {
@@ -472,13 +621,13 @@ func (s *service) ValidateAPIKeySecret(ctx context.Context, req ValidateAPIKeyRe
 				key.Metadata = datatypes.JSONMap{}
 			}
 			key.Metadata["last_rate_limit_exceeded_at"] = now.Format(time.RFC3339)
+			s.checkRateLimitThreshold(ctx, &key, decision, now)
 			_ = s.repo.SaveAPIKey(ctx, &key)
 			s.audit("api_key.rate_limit_exceeded", key.UserID, map[string]interface{}{"key_id": key.ID})
-			usage, _ := s.GetAPIKeyUsage(ctx, key.UserID, key.ID)
 			return &ValidateAPIKeyResponse{
 				Valid:         false,
 				Key:           ptrAPIKeyPublic(toAPIKeyPublic(key)),
-				Usage:         usage,
+				Usage:         s.apiKeyUsageSummary(&key),
 				Error:         "rate limit exceeded",
 				RateLimited:   true,
 				RetryAfterSec: decision.RetryAfterSec,
@@ -488,13 +637,13 @@ func (s *service) ValidateAPIKeySecret(ctx context.Context, req ValidateAPIKeyRe
 			key.Metadata = datatypes.JSONMap{}
 		}
 		s.bumpUsageMetadata(key.Metadata, now)
+		s.checkRateLimitThreshold(ctx, &key, decision, now)
 		key.LastUsedAt = &now
 		if err := s.repo.SaveAPIKey(ctx, &key); err != nil {
 			return nil, err
 		}
-		usage, _ := s.GetAPIKeyUsage(ctx, key.UserID, key.ID)
 		pub := toAPIKeyPublic(key)
-		return &ValidateAPIKeyResponse{Valid: true, Key: &pub, Usage: usage}, nil
+		return &ValidateAPIKeyResponse{Valid: true, Key: &pub, Usage: s.apiKeyUsageSummary(&key)}, nil
 	}
 	return &ValidateAPIKeyResponse{Valid: false, Error: "invalid api key"}, nil
 }
@@ -589,29 +738,53 @@ func (s *service) StartOAuthFlow(ctx context.Context, userID uuid.UUID, provider
 	if err := v.ValidateIntegrationType(provider); err != nil {
 		return nil, err
 	}
+	p, ok := s.oauthProviders.Get(provider)
+	if !ok {
+		return nil, fmt.Errorf("oauth is not configured for %s", provider)
+	}
 	stateSecret, _, _, err := settingsapi.GenerateSecret("oauth")
 	if err != nil {
 		return nil, err
 	}
-	expiresAt := time.Now().UTC().Add(10 * time.Minute)
-	s.oauthMu.Lock()
-	s.oauthStates[stateSecret] = oauthState{
-		UserID:    userID,
-		Provider:  provider,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now().UTC(),
+	verifier, challenge, err := settingsintegrations.NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+	encryptedVerifier, err := s.vault.EncryptString(verifier)
+	if err != nil {
+		return nil, err
+	}
+	redirect, err := settingsintegrations.AuthorizationURL(p, stateSecret, challenge)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(oauthStateTTL)
+	state := &OAuthState{
+		ID:           uuid.New(),
+		StateHash:    hashOAuthState(stateSecret),
+		UserID:       userID,
+		Provider:     provider,
+		CodeVerifier: encryptedVerifier,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       pq.StringArray(p.Scopes),
+		ExpiresAt:    expiresAt,
+	}
+	if err := s.repo.CreateOAuthState(ctx, state); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.DeleteExpiredOAuthStates(ctx, now); err != nil {
+		log.Printf("settings: failed to purge expired oauth states: %v", err)
 	}
-	s.oauthMu.Unlock()
-	redirect := fmt.Sprintf("https://auth.%s.example.com/oauth/authorize?state=%s", provider, stateSecret)
 	resp := &OAuthStartResponse{
 		Provider:     provider,
 		State:        stateSecret,
 		RedirectURL:  redirect,
 		ExpiresAt:    expiresAt,
 		CallbackPath: fmt.Sprintf("/api/v1/settings/integrations/oauth/%s/callback", provider),
+		Scopes:       p.Scopes,
 	}
 	s.audit("integration.oauth.start", userID, map[string]interface{}{"provider": provider, "state_expires_at": expiresAt})
-	_ = ctx
 	return resp, nil
 }
 
@@ -619,85 +792,232 @@ func (s *service) CompleteOAuthFlow(ctx context.Context, userID uuid.UUID, provi
 	if strings.TrimSpace(req.State) == "" || strings.TrimSpace(req.Code) == "" {
 		return nil, fmt.Errorf("state and code are required")
 	}
-	s.oauthMu.Lock()
-	state, ok := s.oauthStates[req.State]
-	if ok {
-		delete(s.oauthStates, req.State)
-	}
-	s.oauthMu.Unlock()
-	if !ok {
+	state, err := s.repo.ConsumeOAuthState(ctx, hashOAuthState(req.State))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("invalid oauth state")
 	}
+	if err != nil {
+		return nil, err
+	}
 	if state.ExpiresAt.Before(time.Now().UTC()) {
 		return nil, fmt.Errorf("oauth state expired")
 	}
 	if state.UserID != userID || state.Provider != provider {
 		return nil, fmt.Errorf("oauth state mismatch")
 	}
+	p, ok := s.oauthProviders.Get(provider)
+	if !ok {
+		return nil, fmt.Errorf("oauth is not configured for %s", provider)
+	}
+	// The token request must repeat the redirect URI the code was issued for
+	p.RedirectURL = state.RedirectURL
+	verifier, err := s.vault.DecryptString(state.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oauth state: %w", err)
+	}
+
+	issuedAt := time.Now().UTC()
+	token, err := s.oauthClient.ExchangeCode(ctx, p, req.Code, verifier)
+	if err != nil {
+		s.audit("integration.oauth.exchange_failed", userID, map[string]interface{}{"provider": provider, "error": err.Error()})
+		return nil, fmt.Errorf("oauth token exchange failed: %w", err)
+	}
 
 	name := strings.TrimSpace(req.IntegrationName)
 	if name == "" {
 		name = provider
 	}
-	integrationReq := ConfigureIntegrationRequest{
+	scope := token.Scope
+	if scope == "" {
+		scope = strings.Join(state.Scopes, " ")
+	}
+	metadata := map[string]interface{}{
+		"oauth_provider": provider,
+		"oauth_scopes":   strings.Fields(scope),
+	}
+	expiresAt := token.ExpiresAt(issuedAt)
+	if expiresAt != nil {
+		metadata["oauth_token_expires_at"] = expiresAt.Format(time.RFC3339)
+	}
+	// Tokens live in the encrypted token store; the configuration only keeps
+	// what is needed to describe the connection
+	pub, err := s.ConfigureIntegration(ctx, userID, ConfigureIntegrationRequest{
 		IntegrationType: provider,
 		IntegrationName: name,
 		Config: map[string]interface{}{
-			"oauth_access_token":       "stored_encrypted",
-			"oauth_authorization_code": req.Code,
-			"oauth_connected_at":       time.Now().UTC().Format(time.RFC3339),
-		},
-		Metadata: map[string]interface{}{
-			"oauth_provider":       provider,
-			"oauth_state_used":     true,
-			"oauth_token_exchange": "placeholder",
+			"oauth_token_type":   token.TokenType,
+			"oauth_scope":        scope,
+			"oauth_connected_at": issuedAt.Format(time.RFC3339),
 		},
-	}
-	pub, err := s.ConfigureIntegration(ctx, userID, integrationReq)
+		Metadata: metadata,
+	})
 	if err != nil {
 		return nil, err
 	}
+	stored := &integration.OAuthToken{
+		ID:           uuid.New().String(),
+		ConnectionID: pub.ID.String(),
+		Provider:     provider,
+		TokenType:    token.TokenType,
+		Scope:        scope,
+	}
+	if expiresAt != nil {
+		stored.ExpiresAt = *expiresAt
+	}
+	if err := s.setOAuthTokenSecrets(stored, token.AccessToken, token.RefreshToken); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveOAuthToken(ctx, stored); err != nil {
+		return nil, err
+	}
+	s.audit("integration.oauth.connected", userID, map[string]interface{}{"provider": provider, "integration_id": pub.ID, "scope": scope})
 	return &OAuthCallbackResponse{
 		Provider:    provider,
 		Connected:   true,
 		Integration: pub,
-		Message:     "oauth callback processed and integration configuration saved",
+		Message:     "oauth authorization completed and tokens stored",
 	}, nil
 }
 
-func (s *service) GetIntegrationHealth(ctx context.Context, userID, integrationID uuid.UUID) (*IntegrationHealthResponse, error) {
+func (s *service) RevokeOAuthIntegration(ctx context.Context, userID, integrationID uuid.UUID) (*IntegrationConfigurationPublic, error) {
 	item, err := s.repo.GetIntegration(ctx, userID, integrationID)
 	if err != nil {
 		return nil, err
 	}
+	token, err := s.repo.GetOAuthToken(ctx, item.ID.String())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("integration is not connected through oauth")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := s.oauthProviders.Get(item.IntegrationType); ok {
+		accessToken, refreshToken, err := s.oauthTokenSecrets(token)
+		if err != nil {
+			return nil, err
+		}
+		// Revoking the refresh token also ends its access tokens at most
+		// providers; the access token is revoked too for those that do not
+		if err := s.oauthClient.RevokeToken(ctx, p, refreshToken, "refresh_token"); err != nil {
+			return nil, fmt.Errorf("oauth revoke failed: %w", err)
+		}
+		if err := s.oauthClient.RevokeToken(ctx, p, accessToken, "access_token"); err != nil {
+			return nil, fmt.Errorf("oauth revoke failed: %w", err)
+		}
+	}
+	if err := s.repo.DeleteOAuthToken(ctx, item.ID.String()); err != nil {
+		return nil, err
+	}
+
 	now := time.Now().UTC()
-	health := settingsintegrations.ComputeHealth(item.IsActive, item.IsValid)
+	item.IsActive = false
+	item.IsValid = false
+	item.ConnectionError = "oauth access revoked"
 	item.Metadata = ensureJSONMap(item.Metadata)
-	item.Metadata["health"] = health
-	item.Metadata["health_checked_at"] = now.Format(time.RFC3339)
+	delete(item.Metadata, "oauth_token_expires_at")
+	item.Metadata["oauth_revoked_at"] = now.Format(time.RFC3339)
+	if err := s.repo.UpsertIntegration(ctx, item); err != nil {
+		return nil, err
+	}
+	s.audit("integration.oauth.revoked", userID, map[string]interface{}{"provider": item.IntegrationType, "integration_id": item.ID})
+	pub := toIntegrationPublic(*item)
+	return &pub, nil
+}
+
+func (s *service) setOAuthTokenSecrets(token *integration.OAuthToken, accessToken, refreshToken string) error {
+	encryptedAccess, err := s.vault.EncryptString(accessToken)
+	if err != nil {
+		return err
+	}
+	encryptedRefresh := ""
+	if refreshToken != "" {
+		if encryptedRefresh, err = s.vault.EncryptString(refreshToken); err != nil {
+			return err
+		}
+	}
+	token.AccessToken = encryptedAccess
+	token.RefreshToken = encryptedRefresh
+	return nil
+}
+
+func (s *service) oauthTokenSecrets(token *integration.OAuthToken) (string, string, error) {
+	accessToken, err := s.vault.DecryptString(token.AccessToken)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt oauth token: %w", err)
+	}
+	refreshToken := ""
+	if token.RefreshToken != "" {
+		if refreshToken, err = s.vault.DecryptString(token.RefreshToken); err != nil {
+			return "", "", fmt.Errorf("failed to decrypt oauth token: %w", err)
+		}
+	}
+	return accessToken, refreshToken, nil
+}
+
+func (s *service) GetIntegrationHealth(ctx context.Context, userID, integrationID uuid.UUID, window time.Duration) (*IntegrationHealthResponse, error) {
+	item, err := s.repo.GetIntegration(ctx, userID, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		window = healthWindows["24h"]
+	}
+	now := time.Now().UTC()
+	result, health, probed := s.probeIntegration(ctx, item, now)
+	if !probed {
+		// No live check for this type; report the configuration state
+		item.Metadata = ensureJSONMap(item.Metadata)
+		item.Metadata["health"] = health
+		item.Metadata["health_checked_at"] = now.Format(time.RFC3339)
+	}
 	rotationDue := false
 	if rotatedAt, ok := parseMetadataTime(item.Metadata["last_rotated_at"]); ok {
 		rm := encryption.NewRotationManager(encryption.RotationPolicy{Enabled: true, Interval: 90 * 24 * time.Hour})
 		rotationDue = rm.ShouldRotate(rotatedAt, now)
 		item.Metadata["credential_rotation_due"] = rotationDue
 	}
-	if item.IsActive && item.IsValid {
-		item.LastSuccessfulConnection = &now
-		item.ConnectionError = ""
-	}
 	if err := s.repo.UpsertIntegration(ctx, item); err != nil {
 		return nil, err
 	}
-	return &IntegrationHealthResponse{
-		IntegrationID:    item.ID,
-		Health:           health,
-		IsActive:         item.IsActive,
-		IsValid:          item.IsValid,
-		RotationDue:      rotationDue,
-		LastCheckedAt:    now,
-		LastSuccessfulAt: item.LastSuccessfulConnection,
-		ConnectionError:  item.ConnectionError,
-	}, nil
+	since := now.Add(-window)
+	history, err := s.repo.ListIntegrationHealth(ctx, item.ID.String(), since)
+	if err != nil {
+		return nil, err
+	}
+	reconsent, _ := item.Metadata["oauth_reconsent_required"].(bool)
+	var tokenExpiresAt *time.Time
+	if expiresAt, ok := parseMetadataTime(item.Metadata["oauth_token_expires_at"]); ok {
+		tokenExpiresAt = &expiresAt
+	}
+	resp := &IntegrationHealthResponse{
+		IntegrationID:     item.ID,
+		Health:            health,
+		IsActive:          item.IsActive,
+		IsValid:           item.IsValid,
+		RotationDue:       rotationDue,
+		LastCheckedAt:     now,
+		LastSuccessfulAt:  item.LastSuccessfulConnection,
+		ConnectionError:   item.ConnectionError,
+		ReconsentRequired: reconsent,
+		TokenExpiresAt:    tokenExpiresAt,
+		LatencyMs:         int(result.Latency / time.Millisecond),
+		StatusCode:        result.StatusCode,
+		Window:            formatHealthWindow(window),
+		Checks:            len(history),
+		Trend:             healthTrend(history, since, window),
+	}
+	failures, latencySum := 0, 0
+	for _, h := range history {
+		if h.ErrorRate > 0 {
+			failures++
+		}
+		latencySum += h.LatencyMs
+	}
+	if len(history) > 0 {
+		resp.UptimePct = uptimePct(len(history), failures)
+		resp.AvgLatencyMs = float64(latencySum) / float64(len(history))
+	}
+	return resp, nil
 }
 
 func (s *service) GetBilling(ctx context.Context, userID uuid.UUID) (*BillingSummary, error) {
@@ -716,28 +1036,35 @@ func (s *service) ListInvoices(ctx context.Context, userID uuid.UUID) ([]Invoice
 	return s.repo.ListInvoices(ctx, userID, 100)
 }
 
+// GetInvoicePDF returns a presigned link to the invoice PDF, rendering it
+// first if the invoicing job has not stored it yet
 func (s *service) GetInvoicePDF(ctx context.Context, userID, invoiceID uuid.UUID) (*InvoicePDFResponse, error) {
 	invoice, err := s.repo.GetInvoice(ctx, userID, invoiceID)
 	if err != nil {
 		return nil, err
 	}
-	now := time.Now().UTC()
-	if strings.TrimSpace(invoice.PDFURL) == "" {
-		pdfURL, genErr := s.invoiceGenerator.GeneratePDF(invoice.InvoiceNumber)
-		if genErr != nil {
-			return nil, genErr
-		}
-		invoice.PDFURL = pdfURL
-		invoice.PDFGeneratedAt = &now
-		if err := s.repo.SaveInvoice(ctx, invoice); err != nil {
+	if invoice.Status == "draft" {
+		return nil, fmt.Errorf("invoice has not been issued yet")
+	}
+	if s.cfg.InvoiceStore == nil {
+		return nil, ErrInvoiceStorageUnavailable
+	}
+	if strings.TrimSpace(invoice.PDFKey) == "" {
+		if err := s.storeInvoicePDF(ctx, invoice); err != nil {
 			return nil, err
 		}
 	}
+	pdfURL, err := s.cfg.InvoiceStore.GeneratePresignedURL(ctx, invoice.PDFKey, s.cfg.InvoiceURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().UTC().Add(s.cfg.InvoiceURLExpiry)
 	return &InvoicePDFResponse{
 		InvoiceID:     invoice.ID,
 		InvoiceNumber: invoice.InvoiceNumber,
-		PDFURL:        invoice.PDFURL,
+		PDFURL:        pdfURL,
 		GeneratedAt:   invoice.PDFGeneratedAt,
+		ExpiresAt:     &expiresAt,
 	}, nil
 }
 
@@ -752,24 +1079,37 @@ func (s *service) AddPaymentMethod(ctx context.Context, userID uuid.UUID, req Ad
 	if err != nil {
 		return nil, err
 	}
-	encryptedRef, err := s.vault.EncryptString(req.PaymentMethodID)
+	if s.cfg.PaymentProcessor == nil {
+		return nil, ErrPaymentsUnavailable
+	}
+	pm, err := s.cfg.PaymentProcessor.AttachPaymentMethod(ctx, sub.ProcessorCustomerID, req.PaymentMethodID)
+	if err != nil {
+		return nil, fmt.Errorf("attach payment method: %w", err)
+	}
+	encryptedRef, err := s.vault.EncryptString(pm.ID)
 	if err != nil {
 		return nil, err
 	}
 	sub.PaymentMethodID = encryptedRef
 	sub.PaymentMethodType = req.PaymentMethodType
+	if pm.Type != "" {
+		sub.PaymentMethodType = pm.Type
+	}
+	sub.PaymentMethodLast4 = pm.Last4
+	sub.ProcessorCustomerID = pm.CustomerID
 	if sub.UsageMetrics == nil {
 		sub.UsageMetrics = datatypes.JSONMap(settingsbilling.DefaultUsageMetrics())
 	}
 	if err := s.repo.SaveSubscription(ctx, sub); err != nil {
 		return nil, err
 	}
-	if strings.EqualFold(sub.Status, "past_due") || strings.EqualFold(sub.Status, "unpaid") {
-		sub.Status = settingsbilling.NextDunningStatus(sub.Status, true)
-		_ = s.repo.SaveSubscription(ctx, sub)
-	}
-	if pdfURL, genErr := s.invoiceGenerator.GeneratePDF(fmt.Sprintf("INV-%d-%s", time.Now().Year(), userID.String()[:8])); genErr == nil {
-		log.Printf("settings.billing.invoice_generator placeholder: %s", pdfURL)
+	if sub.Status == "past_due" || sub.Status == "unpaid" {
+		// A new payment method is the customer's answer to dunning; charge
+		// what is outstanding straight away rather than at the next retry
+		s.retryOutstandingInvoices(ctx, userID)
+		if sub, err = s.repo.GetSubscription(ctx, userID); err != nil {
+			return nil, err
+		}
 	}
 	s.audit("billing.payment_method.add", userID, map[string]interface{}{"after": sub, "payment_method_type": req.PaymentMethodType})
 	return sub, nil
@@ -785,6 +1125,7 @@ func (s *service) audit(event string, userID uuid.UUID, details map[string]inter
 func toAPIKeyPublic(k APIKey) APIKeyPublic {
 	return APIKeyPublic{
 		ID:                 k.ID,
+		UserID:             k.UserID,
 		Name:               k.Name,
 		KeyPrefix:          k.KeyPrefix,
 		KeyLastFour:        k.KeyLastFour,
@@ -1,14 +1,38 @@
 package settings
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+	"carbon-scribe/project-portal/project-portal-backend/internal/integration"
 	settingsapi "carbon-scribe/project-portal/project-portal-backend/internal/settings/api"
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+	settingsintegrations "carbon-scribe/project-portal/project-portal-backend/internal/settings/integrations"
+	settingsprofile "carbon-scribe/project-portal/project-portal-backend/internal/settings/profile"
 	pkgbilling "carbon-scribe/project-portal/project-portal-backend/pkg/billing"
 	"carbon-scribe/project-portal/project-portal-backend/pkg/encryption"
+	"carbon-scribe/project-portal/project-portal-backend/pkg/storage"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
@@ -23,6 +47,14 @@ type fakeRepo struct {
 	integrations  map[uuid.UUID]*IntegrationConfiguration
 	subscriptions map[uuid.UUID]*Subscription
 	invoices      map[uuid.UUID]*Invoice
+	oauthStates   map[string]*OAuthState
+	oauthTokens   map[string]*integration.OAuthToken
+	health        []integration.IntegrationHealth
+	keyUsage      map[string]*APIKeyUsageBucket
+	deliveries    map[uuid.UUID]*APIKeyWebhookDelivery
+	sequences     map[string]int
+	paymentEvents map[string]*PaymentWebhookEvent
+	exports       map[uuid.UUID]*AccountExport
 }
 
 func newFakeRepo() *fakeRepo {
@@ -33,6 +65,13 @@ func newFakeRepo() *fakeRepo {
 		integrations:  map[uuid.UUID]*IntegrationConfiguration{},
 		subscriptions: map[uuid.UUID]*Subscription{},
 		invoices:      map[uuid.UUID]*Invoice{},
+		oauthStates:   map[string]*OAuthState{},
+		oauthTokens:   map[string]*integration.OAuthToken{},
+		keyUsage:      map[string]*APIKeyUsageBucket{},
+		deliveries:    map[uuid.UUID]*APIKeyWebhookDelivery{},
+		sequences:     map[string]int{},
+		paymentEvents: map[string]*PaymentWebhookEvent{},
+		exports:       map[uuid.UUID]*AccountExport{},
 	}
 }
 
@@ -161,6 +200,260 @@ func (r *fakeRepo) UpsertIntegration(_ context.Context, integration *Integration
 	integration.ID = cp.ID
 	return nil
 }
+func (r *fakeRepo) CreateOAuthState(_ context.Context, state *OAuthState) error {
+	cp := *state
+	r.oauthStates[state.StateHash] = &cp
+	return nil
+}
+func (r *fakeRepo) ConsumeOAuthState(_ context.Context, stateHash string) (*OAuthState, error) {
+	st, ok := r.oauthStates[stateHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.oauthStates, stateHash)
+	return st, nil
+}
+func (r *fakeRepo) DeleteExpiredOAuthStates(_ context.Context, before time.Time) (int64, error) {
+	var n int64
+	for h, st := range r.oauthStates {
+		if st.ExpiresAt.Before(before) {
+			delete(r.oauthStates, h)
+			n++
+		}
+	}
+	return n, nil
+}
+func (r *fakeRepo) GetIntegrationByID(_ context.Context, integrationID uuid.UUID) (*IntegrationConfiguration, error) {
+	it, ok := r.integrations[integrationID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *it
+	return &cp, nil
+}
+func (r *fakeRepo) SaveOAuthToken(_ context.Context, token *integration.OAuthToken) error {
+	cp := *token
+	r.oauthTokens[token.ConnectionID] = &cp
+	return nil
+}
+func (r *fakeRepo) GetOAuthToken(_ context.Context, connectionID string) (*integration.OAuthToken, error) {
+	tok, ok := r.oauthTokens[connectionID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *tok
+	return &cp, nil
+}
+func (r *fakeRepo) DeleteOAuthToken(_ context.Context, connectionID string) error {
+	delete(r.oauthTokens, connectionID)
+	return nil
+}
+func (r *fakeRepo) ListRefreshableOAuthTokens(_ context.Context, expiringBefore, now time.Time, _ int) ([]integration.OAuthToken, error) {
+	out := []integration.OAuthToken{}
+	for _, tok := range r.oauthTokens {
+		if tok.RefreshToken == "" || tok.ExpiresAt.IsZero() || !tok.ExpiresAt.Before(expiringBefore) {
+			continue
+		}
+		if tok.NextRefreshAt != nil && tok.NextRefreshAt.After(now) {
+			continue
+		}
+		out = append(out, *tok)
+	}
+	return out, nil
+}
+func (r *fakeRepo) ClaimOAuthTokenRefresh(_ context.Context, tokenID string, now, leaseUntil time.Time) (bool, error) {
+	for _, tok := range r.oauthTokens {
+		if tok.ID == tokenID && (tok.NextRefreshAt == nil || !tok.NextRefreshAt.After(now)) {
+			tok.NextRefreshAt = &leaseUntil
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (r *fakeRepo) RecordIntegrationHealth(_ context.Context, health *integration.IntegrationHealth) error {
+	r.health = append(r.health, *health)
+	return nil
+}
+func (r *fakeRepo) IncrementAPIKeyUsage(_ context.Context, buckets []APIKeyUsageBucket) error {
+	for _, b := range buckets {
+		id := fmt.Sprintf("%s|%s|%s|%s|%d", b.KeyID, b.BucketStart.Format(time.RFC3339), b.Endpoint, b.Method, b.StatusCode)
+		existing := r.keyUsage[id]
+		if existing == nil {
+			cp := b
+			r.keyUsage[id] = &cp
+			continue
+		}
+		existing.RequestCount += b.RequestCount
+		existing.RateLimited += b.RateLimited
+		existing.TotalLatencyMs += b.TotalLatencyMs
+		if b.MaxLatencyMs > existing.MaxLatencyMs {
+			existing.MaxLatencyMs = b.MaxLatencyMs
+		}
+	}
+	return nil
+}
+func (r *fakeRepo) ListAPIKeyUsage(_ context.Context, keyID uuid.UUID, from, to time.Time) ([]APIKeyUsageBucket, error) {
+	out := []APIKeyUsageBucket{}
+	for _, b := range r.keyUsage {
+		if b.KeyID == keyID && !b.BucketStart.Before(from) && b.BucketStart.Before(to) {
+			out = append(out, *b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].BucketStart.Before(out[j].BucketStart) })
+	return out, nil
+}
+func (r *fakeRepo) ListAPIKeysExpiringBetween(_ context.Context, from, to time.Time) ([]APIKey, error) {
+	out := []APIKey{}
+	for _, k := range r.apiKeys {
+		if k.IsActive && k.ExpiresAt != nil && k.ExpiresAt.After(from) && !k.ExpiresAt.After(to) {
+			out = append(out, *k)
+		}
+	}
+	return out, nil
+}
+func (r *fakeRepo) ListAPIKeyHourlyUsage(_ context.Context, from, to time.Time) ([]APIKeyHourlyUsage, error) {
+	totals := map[string]*APIKeyHourlyUsage{}
+	for _, b := range r.keyUsage {
+		if b.BucketStart.Before(from) || !b.BucketStart.Before(to) {
+			continue
+		}
+		id := b.KeyID.String() + b.BucketStart.Format(time.RFC3339)
+		if totals[id] == nil {
+			totals[id] = &APIKeyHourlyUsage{KeyID: b.KeyID, UserID: b.UserID, BucketStart: b.BucketStart}
+		}
+		totals[id].Requests += b.RequestCount
+	}
+	out := []APIKeyHourlyUsage{}
+	for _, row := range totals {
+		out = append(out, *row)
+	}
+	return out, nil
+}
+func (r *fakeRepo) CreateAPIKeyWebhookDelivery(_ context.Context, delivery *APIKeyWebhookDelivery) error {
+	cp := *delivery
+	cp.CreatedAt = time.Now()
+	r.deliveries[delivery.ID] = &cp
+	return nil
+}
+func (r *fakeRepo) SaveAPIKeyWebhookDelivery(_ context.Context, delivery *APIKeyWebhookDelivery) error {
+	cp := *delivery
+	r.deliveries[delivery.ID] = &cp
+	return nil
+}
+func (r *fakeRepo) GetAPIKeyWebhookDelivery(_ context.Context, keyID, deliveryID uuid.UUID) (*APIKeyWebhookDelivery, error) {
+	d, ok := r.deliveries[deliveryID]
+	if !ok || d.KeyID != keyID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *d
+	return &cp, nil
+}
+func (r *fakeRepo) ListAPIKeyWebhookDeliveries(_ context.Context, keyID uuid.UUID, limit int) ([]APIKeyWebhookDelivery, error) {
+	out := []APIKeyWebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.KeyID == keyID {
+			out = append(out, *d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) ListDueAPIKeyWebhookDeliveries(_ context.Context, now time.Time, limit int) ([]APIKeyWebhookDelivery, error) {
+	out := []APIKeyWebhookDelivery{}
+	for _, d := range r.deliveries {
+		if d.Status == "pending" && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			out = append(out, *d)
+		}
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) ClaimAPIKeyWebhookDelivery(_ context.Context, deliveryID uuid.UUID, now, leaseUntil time.Time) (bool, error) {
+	d, ok := r.deliveries[deliveryID]
+	if !ok || d.Status != "pending" || d.NextAttemptAt == nil || d.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	d.NextAttemptAt = &leaseUntil
+	return true, nil
+}
+func (r *fakeRepo) ListActiveIntegrations(_ context.Context, afterID uuid.UUID, limit int) ([]IntegrationConfiguration, error) {
+	out := []IntegrationConfiguration{}
+	for _, item := range r.integrations {
+		if item.IsActive && strings.Compare(item.ID.String(), afterID.String()) > 0 {
+			out = append(out, *item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) ListIntegrationHealth(_ context.Context, connectionID string, since time.Time) ([]integration.IntegrationHealth, error) {
+	out := []integration.IntegrationHealth{}
+	for _, h := range r.health {
+		if h.ConnectionID == connectionID && !h.CheckedAt.Before(since) {
+			out = append(out, h)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CheckedAt.Before(out[j].CheckedAt) })
+	return out, nil
+}
+func (r *fakeRepo) DeleteIntegrationHealthBefore(_ context.Context, before time.Time) (int64, error) {
+	kept := r.health[:0]
+	for _, h := range r.health {
+		if h.CheckedAt.After(before) || h.CheckedAt.Equal(before) {
+			kept = append(kept, h)
+		}
+	}
+	deleted := int64(len(r.health) - len(kept))
+	r.health = kept
+	return deleted, nil
+}
+func (r *fakeRepo) vaultedFields(column VaultedColumn) map[string]*string {
+	out := map[string]*string{}
+	switch column.String() {
+	case "integration_configurations.config_data":
+		for id, it := range r.integrations {
+			out[id.String()] = &it.ConfigData
+		}
+	case "integration_configurations.webhook_secret":
+		for id, it := range r.integrations {
+			out[id.String()] = &it.WebhookSecret
+		}
+	case "subscriptions.payment_method_id":
+		for _, sub := range r.subscriptions {
+			out[sub.ID.String()] = &sub.PaymentMethodID
+		}
+	}
+	return out
+}
+func (r *fakeRepo) ListVaultedValues(_ context.Context, column VaultedColumn, afterID string, limit int) ([]VaultedValue, error) {
+	out := []VaultedValue{}
+	for id, value := range r.vaultedFields(column) {
+		if id > afterID && *value != "" {
+			out = append(out, VaultedValue{ID: id, Value: *value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) SwapVaultedValue(_ context.Context, column VaultedColumn, id, old, new string) (bool, error) {
+	value, ok := r.vaultedFields(column)[id]
+	if !ok || *value != old {
+		return false, nil
+	}
+	*value = new
+	return true, nil
+}
 func (r *fakeRepo) GetSubscription(_ context.Context, userID uuid.UUID) (*Subscription, error) {
 	if s, ok := r.subscriptions[userID]; ok {
 		cp := *s
@@ -172,172 +465,2263 @@ func (r *fakeRepo) GetSubscription(_ context.Context, userID uuid.UUID) (*Subscr
 	cp := *s
 	return &cp, nil
 }
-func (r *fakeRepo) SaveSubscription(_ context.Context, sub *Subscription) error {
-	cp := *sub
-	r.subscriptions[sub.UserID] = &cp
+func (r *fakeRepo) SaveSubscription(_ context.Context, sub *Subscription) error {
+	cp := *sub
+	r.subscriptions[sub.UserID] = &cp
+	return nil
+}
+func (r *fakeRepo) ListSubscriptionsDue(_ context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	out := []Subscription{}
+	for _, sub := range r.subscriptions {
+		if sub.CurrentPeriodEnd.After(now) || strings.Compare(sub.ID.String(), afterID.String()) <= 0 {
+			continue
+		}
+		if sub.Status == "active" || sub.Status == "trialing" || sub.Status == "canceled" {
+			out = append(out, *sub)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) ListSubscriptions(_ context.Context, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	out := []Subscription{}
+	for _, sub := range r.subscriptions {
+		if strings.Compare(sub.ID.String(), afterID.String()) > 0 {
+			out = append(out, *sub)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) UpdateSubscriptionUsage(_ context.Context, subID uuid.UUID, metrics map[string]interface{}, warnings datatypes.JSONMap, collectedAt time.Time) error {
+	for _, sub := range r.subscriptions {
+		if sub.ID != subID {
+			continue
+		}
+		merged := datatypes.JSONMap{}
+		for k, v := range sub.UsageMetrics {
+			merged[k] = v
+		}
+		for k, v := range metrics {
+			merged[k] = v
+		}
+		sub.UsageMetrics = merged
+		sub.QuotaWarnings = warnings
+		sub.UsageCollectedAt = &collectedAt
+	}
+	return nil
+}
+func (r *fakeRepo) IncrementSubscriptionUsage(_ context.Context, subID uuid.UUID, metric string, delta int64) error {
+	for _, sub := range r.subscriptions {
+		if sub.ID == subID {
+			merged := datatypes.JSONMap{}
+			for k, v := range sub.UsageMetrics {
+				merged[k] = v
+			}
+			merged[metric] = float64(usageMetric(sub.UsageMetrics, metric) + delta)
+			sub.UsageMetrics = merged
+		}
+	}
+	return nil
+}
+func (r *fakeRepo) SumAPIKeyRequests(_ context.Context, userID uuid.UUID, from, to time.Time) (int64, error) {
+	var total int64
+	for _, b := range r.keyUsage {
+		if b.UserID == userID && !b.BucketStart.Before(from) && b.BucketStart.Before(to) {
+			total += b.RequestCount - b.RateLimited
+		}
+	}
+	return total, nil
+}
+func (r *fakeRepo) ListInvoices(_ context.Context, userID uuid.UUID, _ int) ([]Invoice, error) {
+	out := []Invoice{}
+	for _, inv := range r.invoices {
+		if inv.UserID == userID {
+			out = append(out, *inv)
+		}
+	}
+	return out, nil
+}
+func (r *fakeRepo) GetInvoice(_ context.Context, userID, invoiceID uuid.UUID) (*Invoice, error) {
+	inv, ok := r.invoices[invoiceID]
+	if !ok || inv.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *inv
+	return &cp, nil
+}
+func (r *fakeRepo) SaveInvoice(_ context.Context, invoice *Invoice) error {
+	cp := *invoice
+	r.invoices[invoice.ID] = &cp
+	return nil
+}
+
+func (r *fakeRepo) GetInvoiceByID(_ context.Context, invoiceID uuid.UUID) (*Invoice, error) {
+	inv, ok := r.invoices[invoiceID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *inv
+	return &cp, nil
+}
+func (r *fakeRepo) ListInvoicesToIssue(_ context.Context, includeUnrendered bool, afterID uuid.UUID, limit int) ([]Invoice, error) {
+	out := []Invoice{}
+	for _, inv := range r.invoices {
+		unrendered := includeUnrendered && inv.FinalizedAt != nil && inv.PDFKey == ""
+		if inv.ID.String() > afterID.String() && (inv.Status == "draft" || unrendered) {
+			out = append(out, *inv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) FinalizeInvoice(_ context.Context, invoice *Invoice, series string) (bool, error) {
+	if cur, ok := r.invoices[invoice.ID]; !ok || cur.Status != "draft" {
+		return false, nil
+	}
+	r.sequences[series]++
+	invoice.InvoiceNumber = settingsbilling.InvoiceNumber(series, r.sequences[series])
+	cp := *invoice
+	r.invoices[invoice.ID] = &cp
+	return true, nil
+}
+func (r *fakeRepo) CreateCreditNote(_ context.Context, note *Invoice, series string) (bool, error) {
+	inv, ok := r.invoices[*note.CreditedInvoiceID]
+	credit := -note.TotalAmount
+	if !ok || inv.AmountCredited+credit > inv.TotalAmount+0.001 {
+		return false, nil
+	}
+	inv.AmountCredited = roundAmount(inv.AmountCredited + credit)
+	if inv.Status == "open" && inv.AmountCredited >= inv.TotalAmount {
+		inv.Status = "void"
+	}
+	r.sequences[series]++
+	note.InvoiceNumber = settingsbilling.InvoiceNumber(series, r.sequences[series])
+	cp := *note
+	r.invoices[note.ID] = &cp
+	return true, nil
+}
+func (r *fakeRepo) SetInvoicePDF(_ context.Context, invoiceID uuid.UUID, key string, generatedAt time.Time) error {
+	inv, ok := r.invoices[invoiceID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	inv.PDFKey = key
+	inv.PDFGeneratedAt = &generatedAt
+	return nil
+}
+func (r *fakeRepo) ListInvoicesDueForPayment(_ context.Context, now time.Time, afterID uuid.UUID, limit int) ([]Invoice, error) {
+	out := []Invoice{}
+	for _, inv := range r.invoices {
+		if inv.ID.String() <= afterID.String() || inv.Kind != settingsbilling.KindInvoice || inv.Status != "open" || inv.TotalAmount <= inv.AmountCredited {
+			continue
+		}
+		first := inv.PaymentAttempts == 0 && inv.NextPaymentAttempt == nil
+		if first || (inv.NextPaymentAttempt != nil && !inv.NextPaymentAttempt.After(now)) {
+			out = append(out, *inv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) GetInvoiceByTransaction(_ context.Context, transactionID string) (*Invoice, error) {
+	for _, inv := range r.invoices {
+		if inv.TransactionID == transactionID {
+			cp := *inv
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+func (r *fakeRepo) UpdateInvoicePayment(_ context.Context, invoice *Invoice) error {
+	inv, ok := r.invoices[invoice.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	inv.Status = invoice.Status
+	inv.PaidAt = invoice.PaidAt
+	inv.PaymentMethod = invoice.PaymentMethod
+	inv.TransactionID = invoice.TransactionID
+	inv.PaymentAttempts = invoice.PaymentAttempts
+	inv.NextPaymentAttempt = invoice.NextPaymentAttempt
+	inv.LastPaymentError = invoice.LastPaymentError
+	return nil
+}
+func (r *fakeRepo) ListSubscriptionsUnpaidSince(_ context.Context, before time.Time, afterID uuid.UUID, limit int) ([]Subscription, error) {
+	out := []Subscription{}
+	for _, sub := range r.subscriptions {
+		if sub.ID.String() > afterID.String() && sub.Status == "unpaid" && sub.UnpaidSince != nil && !sub.UnpaidSince.After(before) {
+			out = append(out, *sub)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.String() < out[j].ID.String() })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) RecordPaymentEvent(_ context.Context, event *PaymentWebhookEvent) (bool, error) {
+	if _, ok := r.paymentEvents[event.ID]; ok {
+		return false, nil
+	}
+	cp := *event
+	r.paymentEvents[event.ID] = &cp
+	return true, nil
+}
+func (r *fakeRepo) DeletePaymentEvent(_ context.Context, eventID string) error {
+	delete(r.paymentEvents, eventID)
+	return nil
+}
+func (r *fakeRepo) CreateAccountExport(_ context.Context, export *AccountExport) error {
+	cp := *export
+	r.exports[export.ID] = &cp
+	return nil
+}
+func (r *fakeRepo) SaveAccountExport(_ context.Context, export *AccountExport) error {
+	cp := *export
+	r.exports[export.ID] = &cp
+	return nil
+}
+func (r *fakeRepo) GetAccountExport(_ context.Context, userID, exportID uuid.UUID) (*AccountExport, error) {
+	export, ok := r.exports[exportID]
+	if !ok || export.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *export
+	return &cp, nil
+}
+func (r *fakeRepo) ListAccountExports(_ context.Context, userID uuid.UUID, limit int) ([]AccountExport, error) {
+	out := []AccountExport{}
+	for _, export := range r.exports {
+		if export.UserID == userID {
+			out = append(out, *export)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RequestedAt.After(out[j].RequestedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) FindActiveAccountExport(_ context.Context, userID uuid.UUID) (*AccountExport, error) {
+	for _, export := range r.exports {
+		if export.UserID == userID && (export.Status == "pending" || export.Status == "processing") {
+			cp := *export
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+func (r *fakeRepo) ListAccountExportsToProcess(_ context.Context, staleBefore time.Time, limit int) ([]AccountExport, error) {
+	out := []AccountExport{}
+	for _, export := range r.exports {
+		stale := export.Status == "processing" && export.StartedAt != nil && export.StartedAt.Before(staleBefore)
+		if export.Status == "pending" || stale {
+			out = append(out, *export)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RequestedAt.Before(out[j].RequestedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+func (r *fakeRepo) ClaimAccountExport(_ context.Context, exportID uuid.UUID, now, staleBefore time.Time) (bool, error) {
+	export, ok := r.exports[exportID]
+	if !ok {
+		return false, nil
+	}
+	stale := export.Status == "processing" && export.StartedAt != nil && export.StartedAt.Before(staleBefore)
+	if export.Status != "pending" && !stale {
+		return false, nil
+	}
+	export.Status = "processing"
+	export.StartedAt = &now
+	return true, nil
+}
+func (r *fakeRepo) ListExpiredAccountExports(_ context.Context, now time.Time, limit int) ([]AccountExport, error) {
+	out := []AccountExport{}
+	for _, export := range r.exports {
+		if export.Status == "completed" && export.ExpiresAt != nil && !export.ExpiresAt.After(now) {
+			out = append(out, *export)
+		}
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// memoryInvoiceStore keeps uploaded PDFs in memory and presigns them with a
+// fake signature
+type memoryInvoiceStore struct {
+	objects map[string][]byte
+}
+
+func (m *memoryInvoiceStore) UploadBytes(_ context.Context, key string, data []byte, _ string) (*storage.UploadResult, error) {
+	m.objects[key] = data
+	return &storage.UploadResult{Key: key, Bucket: "invoices"}, nil
+}
+
+func (m *memoryInvoiceStore) GeneratePresignedURL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	if _, ok := m.objects[key]; !ok {
+		return "", fmt.Errorf("no object %s", key)
+	}
+	return fmt.Sprintf("https://invoices.s3.example.test/%s?X-Amz-Expires=%d", key, int(expiry.Seconds())), nil
+}
+
+// memoryPictureStore keeps profile pictures in memory
+type memoryPictureStore struct {
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (m *memoryPictureStore) UploadBytes(_ context.Context, key string, data []byte, contentType string) (*storage.UploadResult, error) {
+	if m.types == nil {
+		m.types = map[string]string{}
+	}
+	m.objects[key] = data
+	m.types[key] = contentType
+	return &storage.UploadResult{Key: key, Bucket: "pictures"}, nil
+}
+
+func (m *memoryPictureStore) Delete(_ context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+// memoryExportStore keeps export archives in memory and presigns them with
+// a fake signature
+type memoryExportStore struct {
+	objects map[string][]byte
+}
+
+func (m *memoryExportStore) UploadBytes(_ context.Context, key string, data []byte, _ string) (*storage.UploadResult, error) {
+	m.objects[key] = data
+	return &storage.UploadResult{Key: key, Bucket: "exports"}, nil
+}
+
+func (m *memoryExportStore) GeneratePresignedURL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	if _, ok := m.objects[key]; !ok {
+		return "", fmt.Errorf("no object %s", key)
+	}
+	return fmt.Sprintf("https://exports.s3.example.test/%s?X-Amz-Expires=%d", key, int(expiry.Seconds())), nil
+}
+
+func (m *memoryExportStore) Delete(_ context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+func newTestService(t *testing.T, repo *fakeRepo) *service {
+	t.Helper()
+	v, err := encryption.NewVault([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("vault init error: %v", err)
+	}
+	providers, err := settingsintegrations.NewProviderRegistry()
+	if err != nil {
+		t.Fatalf("provider registry error: %v", err)
+	}
+	svc := &service{
+		repo:             repo,
+		vault:            v,
+		invoiceGenerator: pkgbilling.NewPDFInvoiceGenerator(),
+		cfg: Config{
+			APIKeyPrefix:           "ppk_test",
+			ProfileCDNBase:         "https://cdn.example.test",
+			Plans:                  settingsbilling.DefaultCatalog(),
+			InvoiceStore:           &memoryInvoiceStore{objects: map[string][]byte{}},
+			InvoiceURLExpiry:       defaultInvoiceURLExpiry,
+			TaxRates:               settingsbilling.DefaultTaxRates(),
+			PaymentTermsDays:       settingsbilling.DefaultPaymentTermsDays,
+			PaymentProcessor:       pkgbilling.NewFakeProcessor(testWebhookSecret),
+			Dunning:                settingsbilling.DefaultDunningPolicy(),
+			PictureStore:           &memoryPictureStore{objects: map[string][]byte{}},
+			ProfilePictureMaxBytes: defaultProfilePictureMaxBytes,
+			ProfilePictureSizes:    settingsprofile.DefaultPictureSizes,
+			ExportStore:            &memoryExportStore{objects: map[string][]byte{}},
+			ExportRetention:        defaultExportRetention,
+			ExportURLExpiry:        defaultExportURLExpiry,
+		},
+		usageTracker:   settingsapi.NewKeyUsageTracker(),
+		usageBuffer:    settingsapi.NewUsageBuffer(),
+		oauthProviders: providers,
+		oauthClient:    settingsintegrations.NewOAuthClient(nil),
+	}
+	svc.cfg.OAuthRefreshWindow = defaultOAuthRefreshWindow
+	return svc
+}
+
+// fakeOAuthServer is a local authorization server that checks client
+// credentials, redirect URI and the PKCE verifier on code exchange.
+type fakeOAuthServer struct {
+	*httptest.Server
+	provider settingsintegrations.OAuthProvider
+
+	mu         sync.Mutex
+	codes      map[string]string // code -> code_challenge
+	revoked    []string
+	exchangeOK int
+
+	refreshCalls  int
+	refreshStatus int // non-zero makes refresh grants fail with this status
+	refreshError  string
+}
+
+func newFakeOAuthServer(t *testing.T, svc *service, name string) *fakeOAuthServer {
+	t.Helper()
+	f := &fakeOAuthServer{codes: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/revoke", f.revoke)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	f.provider = settingsintegrations.OAuthProvider{
+		Name:         name,
+		AuthorizeURL: f.URL + "/authorize",
+		TokenURL:     f.URL + "/token",
+		RevokeURL:    f.URL + "/revoke",
+		ClientID:     "client-123",
+		ClientSecret: "secret-456",
+		RedirectURL:  "https://app.example.test/oauth/callback",
+		Scopes:       []string{"read_write"},
+	}
+	if err := svc.oauthProviders.Register(f.provider); err != nil {
+		t.Fatalf("register provider: %v", err)
+	}
+	return f
+}
+
+// approve plays the user granting consent at the authorize URL and returns
+// the issued code
+func (f *fakeOAuthServer) approve(t *testing.T, authorizeURL string) string {
+	t.Helper()
+	u, err := url.Parse(authorizeURL)
+	if err != nil {
+		t.Fatalf("parse authorize url: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != f.provider.ClientID || q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != f.provider.RedirectURL {
+		t.Fatalf("unexpected authorize url %s", authorizeURL)
+	}
+	code := "code-" + q.Get("state")
+	f.mu.Lock()
+	f.codes[code] = q.Get("code_challenge")
+	f.mu.Unlock()
+	return code
+}
+
+func (f *fakeOAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != f.provider.ClientID || secret != f.provider.ClientSecret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	_ = r.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.PostForm.Get("grant_type") == "refresh_token" {
+		f.refreshCalls++
+		if f.refreshStatus != 0 {
+			writeOAuthError(w, f.refreshStatus, f.refreshError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-token-refreshed",
+			"refresh_token": "refresh-token-rotated",
+			"token_type":    "bearer",
+			"expires_in":    3600,
+		})
+		return
+	}
+	challenge, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	if r.PostForm.Get("grant_type") != "authorization_code" || !ok ||
+		r.PostForm.Get("redirect_uri") != f.provider.RedirectURL ||
+		settingsintegrations.PKCEChallenge(r.PostForm.Get("code_verifier")) != challenge {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	f.exchangeOK++
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access-token-xyz",
+		"refresh_token": "refresh-token-xyz",
+		"token_type":    "bearer",
+		"expires_in":    3600,
+		"scope":         "read_write",
+	})
+}
+
+func (f *fakeOAuthServer) revoke(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	f.mu.Lock()
+	f.revoked = append(f.revoked, r.PostForm.Get("token"))
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func TestValidateAPIKeySecretTracksUsageAndRateLimits(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	secret := "ppk_test_abcdefghijklmnop"
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+	keyID := uuid.New()
+	repo.apiKeys[keyID] = &APIKey{
+		ID:                 keyID,
+		UserID:             userID,
+		Name:               "test",
+		KeyPrefix:          secret[:8],
+		KeyHash:            string(hash),
+		KeyLastFour:        secret[len(secret)-4:],
+		Scopes:             pq.StringArray{"settings:read"},
+		RateLimitPerMinute: 1,
+		RateLimitPerDay:    10,
+		IsActive:           true,
+		Metadata:           datatypes.JSONMap{},
+	}
+
+	resp, err := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: secret})
+	if err != nil {
+		t.Fatalf("ValidateAPIKeySecret error: %v", err)
+	}
+	if !resp.Valid || resp.Key == nil || resp.Usage == nil {
+		t.Fatalf("expected valid response with key and usage")
+	}
+
+	resp2, err := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: secret})
+	if err != nil {
+		t.Fatalf("ValidateAPIKeySecret second call error: %v", err)
+	}
+	if resp2.Valid || !resp2.RateLimited {
+		t.Fatalf("expected rate limited second response")
+	}
+	if resp2.RetryAfterSec <= 0 {
+		t.Fatalf("expected retry_after on rate-limited response")
+	}
+}
+
+func TestOAuthFlowRoundTripCreatesIntegration(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	userID := uuid.New()
+
+	start, err := svc.StartOAuthFlow(context.Background(), userID, "stripe")
+	if err != nil {
+		t.Fatalf("StartOAuthFlow error: %v", err)
+	}
+	if start.State == "" || !strings.HasPrefix(start.RedirectURL, oauth.URL+"/authorize?") {
+		t.Fatalf("expected state and provider redirect url, got %q", start.RedirectURL)
+	}
+	for hash, st := range repo.oauthStates {
+		if hash == start.State || strings.Contains(st.CodeVerifier, start.State) {
+			t.Fatalf("expected state stored hashed")
+		}
+	}
+
+	code := oauth.approve(t, start.RedirectURL)
+	callback, err := svc.CompleteOAuthFlow(context.Background(), userID, "stripe", OAuthCallbackRequest{
+		State:           start.State,
+		Code:            code,
+		IntegrationName: "payments",
+	})
+	if err != nil {
+		t.Fatalf("CompleteOAuthFlow error: %v", err)
+	}
+	if !callback.Connected || callback.Integration == nil {
+		t.Fatalf("expected connected integration")
+	}
+	if oauth.exchangeOK != 1 {
+		t.Fatalf("expected one successful code exchange, got %d", oauth.exchangeOK)
+	}
+
+	stored := repo.integrations[callback.Integration.ID]
+	if strings.Contains(stored.ConfigData, "access-token-xyz") {
+		t.Fatalf("expected tokens encrypted at rest")
+	}
+	token := repo.oauthTokens[stored.ID.String()]
+	if token == nil || token.AccessToken == "access-token-xyz" {
+		t.Fatalf("expected encrypted token stored for the integration")
+	}
+	access, refresh, err := svc.oauthTokenSecrets(token)
+	if err != nil {
+		t.Fatalf("decrypt token: %v", err)
+	}
+	if access != "access-token-xyz" || refresh != "refresh-token-xyz" {
+		t.Fatalf("expected exchanged tokens, got %q %q", access, refresh)
+	}
+	if _, ok := stored.Metadata["oauth_token_expires_at"]; !ok {
+		t.Fatalf("expected token expiry in metadata")
+	}
+
+	if _, err := svc.CompleteOAuthFlow(context.Background(), userID, "stripe", OAuthCallbackRequest{State: start.State, Code: code}); err == nil {
+		t.Fatalf("expected state to be single use")
+	}
+}
+
+func TestCompleteOAuthFlowRejectsWrongVerifier(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	userID := uuid.New()
+
+	start, err := svc.StartOAuthFlow(context.Background(), userID, "stripe")
+	if err != nil {
+		t.Fatalf("StartOAuthFlow error: %v", err)
+	}
+	code := oauth.approve(t, start.RedirectURL)
+	oauth.codes[code] = "challenge-for-another-verifier"
+
+	_, err = svc.CompleteOAuthFlow(context.Background(), userID, "stripe", OAuthCallbackRequest{State: start.State, Code: code})
+	var oauthErr *settingsintegrations.OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+	if len(repo.integrations) != 0 {
+		t.Fatalf("expected no integration saved")
+	}
+}
+
+func TestRevokeOAuthIntegrationRevokesTokens(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	userID := uuid.New()
+
+	start, err := svc.StartOAuthFlow(context.Background(), userID, "stripe")
+	if err != nil {
+		t.Fatalf("StartOAuthFlow error: %v", err)
+	}
+	callback, err := svc.CompleteOAuthFlow(context.Background(), userID, "stripe", OAuthCallbackRequest{
+		State: start.State,
+		Code:  oauth.approve(t, start.RedirectURL),
+	})
+	if err != nil {
+		t.Fatalf("CompleteOAuthFlow error: %v", err)
+	}
+
+	pub, err := svc.RevokeOAuthIntegration(context.Background(), userID, callback.Integration.ID)
+	if err != nil {
+		t.Fatalf("RevokeOAuthIntegration error: %v", err)
+	}
+	if pub.IsActive || pub.IsValid {
+		t.Fatalf("expected revoked integration to be inactive")
+	}
+	if len(oauth.revoked) != 2 || oauth.revoked[0] != "refresh-token-xyz" {
+		t.Fatalf("expected refresh and access tokens revoked, got %v", oauth.revoked)
+	}
+	if _, ok := repo.oauthTokens[pub.ID.String()]; ok {
+		t.Fatalf("expected stored tokens deleted")
+	}
+}
+
+func TestStartOAuthFlowRequiresConfiguredProvider(t *testing.T) {
+	svc := newTestService(t, newFakeRepo())
+	if _, err := svc.StartOAuthFlow(context.Background(), uuid.New(), "stripe"); err == nil {
+		t.Fatalf("expected error for unconfigured provider")
+	}
+}
+
+func TestDeleteProfileErasesSettingsData(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	repo.profiles[userID] = &UserProfile{ID: uuid.New(), UserID: userID}
+	repo.prefs[userID] = &NotificationPreference{ID: uuid.New(), UserID: userID}
+	repo.apiKeys[uuid.New()] = &APIKey{ID: uuid.New(), UserID: userID}
+
+	_, err := svc.DeleteProfile(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("DeleteProfile error: %v", err)
+	}
+	if _, ok := repo.profiles[userID]; ok {
+		t.Fatalf("expected profile deleted")
+	}
+	if _, ok := repo.prefs[userID]; ok {
+		t.Fatalf("expected prefs deleted")
+	}
+	if len(repo.apiKeys) != 0 {
+		t.Fatalf("expected api keys deleted")
+	}
+}
+
+func TestGetInvoicePDFGeneratesURLWhenMissing(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	invoiceID := uuid.New()
+	repo.invoices[invoiceID] = &Invoice{
+		ID:            invoiceID,
+		UserID:        userID,
+		InvoiceNumber: "INV-2026-0001",
+		Status:        "open",
+	}
+
+	resp, err := svc.GetInvoicePDF(context.Background(), userID, invoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoicePDF error: %v", err)
+	}
+	if resp.PDFURL == "" {
+		t.Fatalf("expected generated PDF URL")
+	}
+}
+
+func TestCompleteOAuthFlowRejectsUnknownState(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	_, err := svc.CompleteOAuthFlow(context.Background(), uuid.New(), "stripe", OAuthCallbackRequest{
+		State: "missing",
+		Code:  "code",
+	})
+	if err == nil {
+		t.Fatalf("expected error for unknown oauth state")
+	}
+}
+
+// connectOAuthIntegration runs the authorization flow against the fake server
+// and returns the stored integration
+func connectOAuthIntegration(t *testing.T, svc *service, oauth *fakeOAuthServer, userID uuid.UUID) *IntegrationConfigurationPublic {
+	t.Helper()
+	start, err := svc.StartOAuthFlow(context.Background(), userID, oauth.provider.Name)
+	if err != nil {
+		t.Fatalf("StartOAuthFlow error: %v", err)
+	}
+	callback, err := svc.CompleteOAuthFlow(context.Background(), userID, oauth.provider.Name, OAuthCallbackRequest{
+		State: start.State,
+		Code:  oauth.approve(t, start.RedirectURL),
+	})
+	if err != nil {
+		t.Fatalf("CompleteOAuthFlow error: %v", err)
+	}
+	return callback.Integration
+}
+
+func expireTokenSoon(repo *fakeRepo, integrationID uuid.UUID, in time.Duration) *integration.OAuthToken {
+	tok := repo.oauthTokens[integrationID.String()]
+	tok.ExpiresAt = time.Now().UTC().Add(in)
+	return tok
+}
+
+func TestRefreshExpiringOAuthTokensRenewsTokens(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	pub := connectOAuthIntegration(t, svc, oauth, uuid.New())
+
+	result, err := svc.RefreshExpiringOAuthTokens(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshExpiringOAuthTokens error: %v", err)
+	}
+	if result.Checked != 0 || oauth.refreshCalls != 0 {
+		t.Fatalf("expected fresh token left alone, got %+v", result)
+	}
+
+	expireTokenSoon(repo, pub.ID, time.Minute)
+	result, err = svc.RefreshExpiringOAuthTokens(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshExpiringOAuthTokens error: %v", err)
+	}
+	if result.Refreshed != 1 {
+		t.Fatalf("expected one refreshed token, got %+v", result)
+	}
+	tok := repo.oauthTokens[pub.ID.String()]
+	access, refresh, err := svc.oauthTokenSecrets(tok)
+	if err != nil {
+		t.Fatalf("decrypt token: %v", err)
+	}
+	if access != "access-token-refreshed" || refresh != "refresh-token-rotated" {
+		t.Fatalf("expected rotated tokens, got %q %q", access, refresh)
+	}
+	if time.Until(tok.ExpiresAt) < 50*time.Minute || tok.NextRefreshAt != nil {
+		t.Fatalf("expected new expiry and cleared lease, got %v %v", tok.ExpiresAt, tok.NextRefreshAt)
+	}
+	if n := len(repo.health); n == 0 || repo.health[n-1].Status != "healthy" {
+		t.Fatalf("expected healthy health record")
+	}
+}
+
+func TestRefreshExpiringOAuthTokensRequiresReconsentOnInvalidGrant(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	userID := uuid.New()
+	pub := connectOAuthIntegration(t, svc, oauth, userID)
+	expireTokenSoon(repo, pub.ID, time.Minute)
+	oauth.refreshStatus, oauth.refreshError = http.StatusBadRequest, "invalid_grant"
+
+	result, err := svc.RefreshExpiringOAuthTokens(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshExpiringOAuthTokens error: %v", err)
+	}
+	if result.ReconsentRequired != 1 {
+		t.Fatalf("expected re-consent, got %+v", result)
+	}
+	item := repo.integrations[pub.ID]
+	if item.IsValid || item.ConnectionError == "" {
+		t.Fatalf("expected integration marked invalid with an error")
+	}
+	if repo.oauthTokens[pub.ID.String()].RefreshToken != "" {
+		t.Fatalf("expected rejected refresh token dropped")
+	}
+
+	health, err := svc.GetIntegrationHealth(context.Background(), userID, pub.ID, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetIntegrationHealth error: %v", err)
+	}
+	if !health.ReconsentRequired || health.Health != "degraded" {
+		t.Fatalf("expected degraded health needing re-consent, got %+v", health)
+	}
+
+	// Nothing is left to refresh until the user reconnects
+	if result, _ := svc.RefreshExpiringOAuthTokens(context.Background()); result.Checked != 0 || oauth.refreshCalls != 1 {
+		t.Fatalf("expected no further attempts, got %+v after %d calls", result, oauth.refreshCalls)
+	}
+}
+
+func TestRefreshExpiringOAuthTokensBacksOffTransientFailures(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	oauth := newFakeOAuthServer(t, svc, "stripe")
+	pub := connectOAuthIntegration(t, svc, oauth, uuid.New())
+	expireTokenSoon(repo, pub.ID, time.Minute)
+	oauth.refreshStatus, oauth.refreshError = http.StatusServiceUnavailable, "temporarily_unavailable"
+
+	result, err := svc.RefreshExpiringOAuthTokens(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshExpiringOAuthTokens error: %v", err)
+	}
+	if result.Retrying != 1 {
+		t.Fatalf("expected retry, got %+v", result)
+	}
+	tok := repo.oauthTokens[pub.ID.String()]
+	if tok.RefreshFailures != 1 || tok.NextRefreshAt == nil || time.Until(*tok.NextRefreshAt) > oauthRefreshBackoffBase {
+		t.Fatalf("expected first backoff scheduled, got %d %v", tok.RefreshFailures, tok.NextRefreshAt)
+	}
+	if !repo.integrations[pub.ID].IsValid {
+		t.Fatalf("expected integration valid while the access token still works")
+	}
+
+	if result, _ := svc.RefreshExpiringOAuthTokens(context.Background()); result.Checked != 0 {
+		t.Fatalf("expected token skipped during backoff, got %+v", result)
+	}
+
+	// Once the access token has expired the connection is reported broken
+	past := time.Now().UTC().Add(-time.Second)
+	tok.NextRefreshAt = &past
+	expireTokenSoon(repo, pub.ID, -time.Minute)
+	if _, err := svc.RefreshExpiringOAuthTokens(context.Background()); err != nil {
+		t.Fatalf("RefreshExpiringOAuthTokens error: %v", err)
+	}
+	if repo.integrations[pub.ID].IsValid || repo.oauthTokens[pub.ID.String()].RefreshFailures != 2 {
+		t.Fatalf("expected expired token with failing refresh to invalidate the integration")
+	}
+}
+
+func TestRefreshBackoffIsCapped(t *testing.T) {
+	if got := refreshBackoff(1); got != oauthRefreshBackoffBase {
+		t.Fatalf("refreshBackoff(1) = %s", got)
+	}
+	if got := refreshBackoff(3); got != 4*oauthRefreshBackoffBase {
+		t.Fatalf("refreshBackoff(3) = %s", got)
+	}
+	if got := refreshBackoff(50); got != oauthRefreshBackoffMax {
+		t.Fatalf("refreshBackoff(50) = %s", got)
+	}
+}
+
+func TestRunKeyRotationMovesLegacyValuesToEnvelopes(t *testing.T) {
+	repo := newFakeRepo()
+	legacy := newTestService(t, repo)
+	userID := uuid.New()
+	pub, err := legacy.ConfigureIntegration(context.Background(), userID, ConfigureIntegrationRequest{
+		IntegrationType: "stripe",
+		IntegrationName: "payments",
+		Config:          map[string]interface{}{"api_key": "sk_test_123"},
+		WebhookSecret:   "whsec_123",
+	})
+	if err != nil {
+		t.Fatalf("ConfigureIntegration error: %v", err)
+	}
+	if _, err := legacy.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_123", PaymentMethodType: "card"}); err != nil {
+		t.Fatalf("AddPaymentMethod error: %v", err)
+	}
+
+	keyring, _ := encryption.NewKeyring()
+	if _, err := keyring.Rotate("settings", time.Now()); err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	kms := encryption.NewKeyringKMS(keyring)
+	vault, err := encryption.NewEnvelopeVault(kms, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewEnvelopeVault error: %v", err)
+	}
+	svc := newTestService(t, repo)
+	svc.vault = vault
+	svc.cfg.KMS = kms
+
+	result, err := svc.RunKeyRotation(context.Background())
+	if err != nil {
+		t.Fatalf("RunKeyRotation error: %v", err)
+	}
+	if result.Rotated || result.Reencrypted != 3 || result.Failed != 0 {
+		t.Fatalf("expected three legacy values re-encrypted without rotation, got %+v", result)
+	}
+	item := repo.integrations[pub.ID]
+	if ref, ok := encryption.KeyRefOf(item.ConfigData); !ok || ref.String() != "settings:1" {
+		t.Fatalf("expected config sealed under settings:1, got %q", item.ConfigData)
+	}
+	if secret, err := svc.vault.DecryptString(item.WebhookSecret); err != nil || secret != "whsec_123" {
+		t.Fatalf("expected webhook secret readable, got %q %v", secret, err)
+	}
+
+	// With rotation due every value moves to the new version
+	svc.cfg.KeyRotationInterval = time.Nanosecond
+	result, err = svc.RunKeyRotation(context.Background())
+	if err != nil {
+		t.Fatalf("RunKeyRotation error: %v", err)
+	}
+	if !result.Rotated || result.PrimaryKey != "settings:2" || result.Reencrypted != 3 {
+		t.Fatalf("expected rotation to settings:2 with three values moved, got %+v", result)
+	}
+	sub := repo.subscriptions[userID]
+	if ref, _ := encryption.KeyRefOf(sub.PaymentMethodID); ref.Version != 2 {
+		t.Fatalf("expected payment method under version 2, got %q", sub.PaymentMethodID)
+	}
+}
+
+// newProbeServer answers like a provider API that expects the bearer token
+// "probe-key"
+func newProbeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer probe-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func useTestProbes(svc *service) {
+	svc.probes = settingsintegrations.DefaultProbes(settingsintegrations.NewProbeHTTPClient(5*time.Second, true))
+}
+
+func TestGetIntegrationHealthProbesProviderAndReportsTrend(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	useTestProbes(svc)
+	server := newProbeServer(t)
+	userID := uuid.New()
+	pub, err := svc.ConfigureIntegration(context.Background(), userID, ConfigureIntegrationRequest{
+		IntegrationType: "satellite_api",
+		IntegrationName: "Imagery",
+		Config:          map[string]interface{}{"base_url": server.URL, "health_path": "/v1/status", "api_key": "probe-key"},
+	})
+	if err != nil {
+		t.Fatalf("ConfigureIntegration error: %v", err)
+	}
+	// An outage two hours ago
+	repo.health = append(repo.health, integration.IntegrationHealth{
+		ID:           uuid.NewString(),
+		ConnectionID: pub.ID.String(),
+		Status:       "down",
+		ErrorRate:    1,
+		LatencyMs:    40,
+		CheckedAt:    time.Now().UTC().Add(-2 * time.Hour),
+	})
+
+	health, err := svc.GetIntegrationHealth(context.Background(), userID, pub.ID, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetIntegrationHealth error: %v", err)
+	}
+	if health.Health != "healthy" || health.StatusCode != http.StatusOK || health.LastSuccessfulAt == nil {
+		t.Fatalf("expected a successful live probe, got %+v", health)
+	}
+	if health.Window != "24h" || health.Checks != 2 || health.UptimePct != 50 {
+		t.Fatalf("expected two checks at 50%% uptime, got %+v", health)
+	}
+	if len(health.Trend) != healthTrendPoints {
+		t.Fatalf("expected %d trend points, got %d", healthTrendPoints, len(health.Trend))
+	}
+	checks, failures := 0, 0
+	for _, point := range health.Trend {
+		checks += point.Checks
+		failures += point.Failures
+	}
+	if checks != 2 || failures != 1 {
+		t.Fatalf("expected both checks bucketed with one failure, got %d/%d", checks, failures)
+	}
+}
+
+func TestProbeIntegrationsMarksRejectedCredentialsInvalid(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	useTestProbes(svc)
+	server := newProbeServer(t)
+	userID := uuid.New()
+	rejected, err := svc.ConfigureIntegration(context.Background(), userID, ConfigureIntegrationRequest{
+		IntegrationType: "stripe",
+		IntegrationName: "Payments",
+		Config:          map[string]interface{}{"base_url": server.URL, "secret_key": "revoked-key"},
+	})
+	if err != nil {
+		t.Fatalf("ConfigureIntegration error: %v", err)
+	}
+	inactive := false
+	if _, err := svc.ConfigureIntegration(context.Background(), userID, ConfigureIntegrationRequest{
+		IntegrationType: "weather_service",
+		IntegrationName: "Paused",
+		Config:          map[string]interface{}{"base_url": server.URL},
+		IsActive:        &inactive,
+	}); err != nil {
+		t.Fatalf("ConfigureIntegration error: %v", err)
+	}
+	repo.health = append(repo.health, integration.IntegrationHealth{
+		ID:           uuid.NewString(),
+		ConnectionID: rejected.ID.String(),
+		Status:       "healthy",
+		CheckedAt:    time.Now().UTC().Add(-60 * 24 * time.Hour),
+	})
+
+	result, err := svc.ProbeIntegrations(context.Background())
+	if err != nil {
+		t.Fatalf("ProbeIntegrations error: %v", err)
+	}
+	if result.Probed != 1 || result.Down != 1 || result.Pruned != 1 {
+		t.Fatalf("expected one failed probe and pruned history, got %+v", result)
+	}
+	item := repo.integrations[rejected.ID]
+	if item.IsValid || !strings.Contains(item.ConnectionError, "401") || item.Metadata["health"] != "down" {
+		t.Fatalf("expected rejected credentials to invalidate the integration, got valid=%v error=%q", item.IsValid, item.ConnectionError)
+	}
+	if len(repo.health) != 1 || repo.health[0].ErrorRate != 1 {
+		t.Fatalf("expected the failure recorded in history, got %+v", repo.health)
+	}
+}
+
+func TestAPIKeyAuthRecordsPersistentUsageAnalytics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	created, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:               "reporting",
+		Scopes:             []string{"settings:read"},
+		RateLimitPerMinute: 3,
+		RateLimitPerDay:    100,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(APIKeyAuth(svc))
+	router.GET("/v1/projects/:id", func(c *gin.Context) {
+		if uid, _ := currentUserID(c); uid != userID {
+			t.Errorf("expected key owner in context, got %v", uid)
+		}
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	})
+	router.GET("/v1/reports", func(c *gin.Context) { c.JSON(http.StatusInternalServerError, gin.H{}) })
+	call := func(path, secret string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call("/v1/projects/a", "ppk_test_wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown key rejected, got %d", code)
+	}
+	for _, want := range []struct {
+		path string
+		code int
+	}{
+		{"/v1/projects/a", http.StatusOK},
+		{"/v1/projects/b", http.StatusOK},
+		{"/v1/reports", http.StatusInternalServerError},
+		{"/v1/projects/c", http.StatusTooManyRequests},
+	} {
+		if code := call(want.path, created.Secret); code != want.code {
+			t.Fatalf("GET %s = %d, want %d", want.path, code, want.code)
+		}
+	}
+	if _, err := svc.FlushAPIKeyUsage(context.Background()); err != nil {
+		t.Fatalf("FlushAPIKeyUsage error: %v", err)
+	}
+
+	// A fresh service, as after a restart, reads the same history
+	restarted := newTestService(t, repo)
+	usage, err := restarted.GetAPIKeyUsage(context.Background(), userID, created.APIKey.ID, APIKeyUsageRange{
+		From: time.Now().Add(-24 * time.Hour),
+		To:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("GetAPIKeyUsage error: %v", err)
+	}
+	if usage.Granularity != "hour" || usage.Requests != 4 || usage.Errors != 2 || usage.RateLimitRejections != 1 {
+		t.Fatalf("unexpected totals %+v", usage)
+	}
+	if usage.ErrorRate != 0.5 || usage.StatusClasses["2xx"] != 2 || usage.StatusClasses["4xx"] != 1 {
+		t.Fatalf("unexpected error breakdown %+v", usage)
+	}
+	var series int64
+	for _, point := range usage.TimeSeries {
+		series += point.Requests
+	}
+	if series != 4 || len(usage.TimeSeries) < 24 {
+		t.Fatalf("expected hourly series covering the range, got %d points totalling %d", len(usage.TimeSeries), series)
+	}
+	top := usage.TopEndpoints
+	if len(top) != 2 || top[0].Endpoint != "/v1/projects/:id" || top[0].Requests != 3 || top[0].Errors != 1 {
+		t.Fatalf("expected route templates ranked by volume, got %+v", top)
+	}
+}
+
+func TestSettingsRoutesAcceptMeteredAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	created, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:   "read only",
+		Scopes: []string{"settings:read"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+
+	router := gin.New()
+	NewHandler(svc).RegisterRoutes(router.Group("/api/v1"))
+	call := func(method string) int {
+		req := httptest.NewRequest(method, "/api/v1/settings/notifications", strings.NewReader("{}"))
+		req.Header.Set("X-API-Key", created.Secret)
+		// Gateway permissions do not widen what the key may do
+		req.Header.Set("X-Permissions", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call(http.MethodGet); code == http.StatusUnauthorized || code == http.StatusForbidden {
+		t.Fatalf("expected the key's scope to allow reads, got %d", code)
+	}
+	if code := call(http.MethodPut); code != http.StatusForbidden {
+		t.Fatalf("expected writes outside the key's scopes refused, got %d", code)
+	}
+	if _, err := svc.FlushAPIKeyUsage(context.Background()); err != nil {
+		t.Fatalf("FlushAPIKeyUsage error: %v", err)
+	}
+	usage, err := svc.GetAPIKeyUsage(context.Background(), userID, created.APIKey.ID, APIKeyUsageRange{
+		From: time.Now().Add(-time.Hour),
+		To:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("GetAPIKeyUsage error: %v", err)
+	}
+	if usage.Requests != 2 || usage.StatusClasses["4xx"] != 1 {
+		t.Fatalf("expected both requests metered, got %+v", usage)
+	}
+}
+
+func TestAPIKeysCannotManageAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	limited, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:   "key admin",
+		Scopes: []string{"settings:api_keys"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+	other, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:   "billing",
+		Scopes: []string{"settings:billing"},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+
+	router := gin.New()
+	NewHandler(svc).RegisterRoutes(router.Group("/api/v1"))
+	call := func(method, path, body string) int {
+		req := httptest.NewRequest(method, "/api/v1/settings/api-keys"+path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", limited.Secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call(http.MethodPost, "", `{"name":"broader","scopes":["settings:billing","settings:write"]}`); code != http.StatusForbidden {
+		t.Fatalf("expected a limited key refused a broader key, got %d", code)
+	}
+	if code := call(http.MethodPost, "/"+other.APIKey.ID.String()+"/rotate", ""); code != http.StatusForbidden {
+		t.Fatalf("expected a key refused rotating another key, got %d", code)
+	}
+	if code := call(http.MethodDelete, "/"+other.APIKey.ID.String(), ""); code != http.StatusForbidden {
+		t.Fatalf("expected a key refused revoking another key, got %d", code)
+	}
+	if code := call(http.MethodGet, "", ""); code != http.StatusOK {
+		t.Fatalf("expected the key to still list keys, got %d", code)
+	}
+	keys, _ := svc.ListAPIKeys(context.Background(), userID)
+	if len(keys) != 2 {
+		t.Fatalf("expected no key created, got %d keys", len(keys))
+	}
+}
+
+func TestNormalizeUsageRange(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	rng, err := normalizeUsageRange(APIKeyUsageRange{}, now)
+	if err != nil || rng.Granularity != "day" || !rng.To.Equal(now.Truncate(time.Hour).Add(time.Hour)) {
+		t.Fatalf("unexpected default range %+v %v", rng, err)
+	}
+	if _, err := normalizeUsageRange(APIKeyUsageRange{From: now.Add(-40 * 24 * time.Hour), To: now, Granularity: "hour"}, now); err == nil {
+		t.Fatalf("expected hourly points over 40 days to be refused")
+	}
+	if _, err := normalizeUsageRange(APIKeyUsageRange{From: now, To: now.Add(-time.Hour)}, now); err == nil {
+		t.Fatalf("expected reversed range to be refused")
+	}
+}
+
+// webhookReceiver records signed API key webhooks and answers with status
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	bodies   [][]byte
+	events   []string
+	sigError []error
+	secret   string
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	t.Helper()
+	rcv := &webhookReceiver{status: http.StatusOK}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		rcv.bodies = append(rcv.bodies, body)
+		rcv.events = append(rcv.events, r.Header.Get("X-CarbonScribe-Event"))
+		rcv.sigError = append(rcv.sigError, settingsapi.VerifyWebhookSignature(rcv.secret, r.Header.Get(settingsapi.SignatureHeader), body, time.Now(), 0))
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func deliveriesFor(repo *fakeRepo, event string) []*APIKeyWebhookDelivery {
+	var out []*APIKeyWebhookDelivery
+	for _, d := range repo.deliveries {
+		if d.EventType == event {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func TestAPIKeyWebhooksAreSignedRetriedAndReplayable(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	rcv := newWebhookReceiver(t)
+	svc.webhookClient = rcv.Client()
+	userID := uuid.New()
+	subscribeTo(repo, userID, "basic")
+
+	created, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:     "ci",
+		Webhooks: []APIKeyWebhookSubscription{{Event: "*", TargetURL: rcv.URL + "/hooks", IsActive: true}},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+	rcv.secret = created.APIKey.WebhookSigningSecret
+	if !strings.HasPrefix(rcv.secret, "whsec_") || repo.apiKeys[created.APIKey.ID].WebhookSecret == rcv.secret {
+		t.Fatalf("expected a signing secret returned once and stored encrypted")
+	}
+
+	rcv.status = http.StatusInternalServerError
+	result, err := svc.ProcessAPIKeyWebhooks(context.Background())
+	if err != nil || result.Retrying != 1 {
+		t.Fatalf("expected the failed delivery scheduled for retry, got %+v %v", result, err)
+	}
+	queued := deliveriesFor(repo, settingsapi.EventKeyCreated)
+	if len(queued) != 1 || queued[0].Attempts != 1 || queued[0].ResponseStatus != 500 || time.Until(*queued[0].NextAttemptAt) < 50*time.Second {
+		t.Fatalf("expected one attempt logged with a backoff, got %+v", queued)
+	}
+	if result, _ := svc.ProcessAPIKeyWebhooks(context.Background()); result.Delivered+result.Retrying != 0 {
+		t.Fatalf("expected nothing sent before the retry is due, got %+v", result)
+	}
+
+	past := time.Now().Add(-time.Second)
+	queued[0].NextAttemptAt = &past
+	rcv.status = http.StatusOK
+	if result, _ := svc.ProcessAPIKeyWebhooks(context.Background()); result.Delivered != 1 {
+		t.Fatalf("expected retry delivered, got %+v", result)
+	}
+	original := deliveriesFor(repo, settingsapi.EventKeyCreated)[0]
+	if original.Status != "succeeded" || original.Attempts != 2 {
+		t.Fatalf("expected delivery succeeded on attempt 2, got %+v", original)
+	}
+
+	replay, err := svc.ReplayAPIKeyWebhookDelivery(context.Background(), userID, created.APIKey.ID, original.ID)
+	if err != nil || replay.ReplayOf == nil || *replay.ReplayOf != original.ID {
+		t.Fatalf("ReplayAPIKeyWebhookDelivery = %+v %v", replay, err)
+	}
+	if result, _ := svc.ProcessAPIKeyWebhooks(context.Background()); result.Delivered != 1 {
+		t.Fatalf("expected replay delivered, got %+v", result)
+	}
+	if len(rcv.bodies) != 3 || string(rcv.bodies[2]) != string(rcv.bodies[0]) || rcv.events[2] != settingsapi.EventKeyCreated {
+		t.Fatalf("expected replay to resend the same payload, got %d calls", len(rcv.bodies))
+	}
+	for i, err := range rcv.sigError {
+		if err != nil {
+			t.Fatalf("call %d: signature did not verify: %v", i, err)
+		}
+	}
+
+	if err := svc.RevokeAPIKey(context.Background(), userID, created.APIKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey error: %v", err)
+	}
+	revoked := deliveriesFor(repo, settingsapi.EventKeyRevoked)
+	if len(revoked) != 1 {
+		t.Fatalf("expected revoke event queued")
+	}
+	// The last retry failing ends the delivery
+	revoked[0].Attempts = len(webhookRetrySchedule)
+	rcv.status = http.StatusBadGateway
+	if result, _ := svc.ProcessAPIKeyWebhooks(context.Background()); result.Failed != 1 {
+		t.Fatalf("expected exhausted delivery to fail, got %+v", result)
+	}
+	log, err := svc.ListAPIKeyWebhookDeliveries(context.Background(), userID, created.APIKey.ID)
+	if err != nil || len(log) != 3 {
+		t.Fatalf("expected three deliveries in the log, got %d %v", len(log), err)
+	}
+}
+
+func TestAPIKeyWebhookScheduledEvents(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	rcv := newWebhookReceiver(t)
+	svc.webhookClient = rcv.Client()
+	userID := uuid.New()
+	subscribeTo(repo, userID, "basic")
+	expiresAt := time.Now().Add(48 * time.Hour)
+	created, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:            "batch",
+		RateLimitPerDay: 5,
+		ExpiresAt:       &expiresAt,
+		Webhooks: []APIKeyWebhookSubscription{
+			{Event: settingsapi.EventKeyExpiring, TargetURL: rcv.URL, IsActive: true},
+			{Event: settingsapi.EventRateLimitThreshold, TargetURL: rcv.URL, IsActive: true},
+			{Event: settingsapi.EventUsageSpike, TargetURL: rcv.URL, IsActive: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+	if len(repo.deliveries) != 0 {
+		t.Fatalf("expected no created event without a subscription for it")
+	}
+
+	for i := 0; i < 5; i++ {
+		if resp, _ := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: created.Secret}); !resp.Valid {
+			t.Fatalf("request %d unexpectedly rejected: %+v", i+1, resp)
+		}
+	}
+	if n := len(deliveriesFor(repo, settingsapi.EventRateLimitThreshold)); n != 1 {
+		t.Fatalf("expected one warning at 80%% of the daily limit, got %d", n)
+	}
+	if resp, _ := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: created.Secret}); !resp.RateLimited {
+		t.Fatalf("expected sixth request rate limited")
+	}
+	if n := len(deliveriesFor(repo, settingsapi.EventRateLimitThreshold)); n != 2 {
+		t.Fatalf("expected a second event when the limit is exceeded, got %d", n)
+	}
+
+	lastHour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	var buckets []APIKeyUsageBucket
+	for h := 1; h <= usageSpikeBaselineHours; h++ {
+		buckets = append(buckets, APIKeyUsageBucket{KeyID: created.APIKey.ID, UserID: userID, BucketStart: lastHour.Add(-time.Duration(h) * time.Hour), Endpoint: "/v1/projects", Method: "GET", StatusCode: 200, RequestCount: 10})
+	}
+	buckets = append(buckets, APIKeyUsageBucket{KeyID: created.APIKey.ID, UserID: userID, BucketStart: lastHour, Endpoint: "/v1/projects", Method: "GET", StatusCode: 200, RequestCount: 400})
+	repo.IncrementAPIKeyUsage(context.Background(), buckets)
+
+	result, err := svc.ProcessAPIKeyWebhooks(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessAPIKeyWebhooks error: %v", err)
+	}
+	if result.ExpiringNotified != 1 || result.SpikesDetected != 1 {
+		t.Fatalf("expected expiry and spike events, got %+v", result)
+	}
+	if again, _ := svc.ProcessAPIKeyWebhooks(context.Background()); again.ExpiringNotified != 0 || again.SpikesDetected != 0 {
+		t.Fatalf("expected scheduled events raised once, got %+v", again)
+	}
+}
+
+// subscribeTo puts the user on a paid monthly plan half way through its period
+func subscribeTo(repo *fakeRepo, userID uuid.UUID, planID string) *Subscription {
+	plan, _ := settingsbilling.DefaultCatalog().Get(planID)
+	now := time.Now().UTC()
+	sub := &Subscription{
+		ID: uuid.New(), UserID: userID, PlanID: plan.ID, PlanName: plan.Name, BillingCycle: "monthly", Status: "active",
+		CurrentPeriodStart: now.Add(-15 * 24 * time.Hour), CurrentPeriodEnd: now.Add(15 * 24 * time.Hour),
+		UsageMetrics: datatypes.JSONMap(settingsbilling.DefaultUsageMetrics()),
+	}
+	repo.subscriptions[userID] = sub
+	return sub
+}
+
+func invoiceLineItems(t *testing.T, inv *Invoice) []InvoiceLineItem {
+	t.Helper()
+	var items []InvoiceLineItem
+	if err := json.Unmarshal(inv.LineItems, &items); err != nil {
+		t.Fatalf("invalid line items: %v", err)
+	}
+	return items
+}
+
+func TestChangePlanProratesUpgradesAndCreditsDowngrades(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+	subscribeTo(repo, userID, "basic")
+
+	up, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "pro"})
+	if err != nil {
+		t.Fatalf("ChangePlan error: %v", err)
+	}
+	// Half a month left: 14.50 credited on basic, 49.50 charged on pro
+	if up.Proration == nil || up.Proration.Credit < 1440 || up.Proration.Credit > 1460 ||
+		up.Proration.Charge < 4940 || up.Proration.Charge > 4960 {
+		t.Fatalf("unexpected proration %+v", up.Proration)
+	}
+	if up.Invoice == nil || up.Invoice.Status != "draft" || up.Invoice.Amount < 34.8 || up.Invoice.Amount > 35.2 {
+		t.Fatalf("expected a ~35.00 draft invoice, got %+v", up.Invoice)
+	}
+	if items := invoiceLineItems(t, up.Invoice); len(items) != 2 || items[0].Kind != "proration_credit" || items[1].Kind != "proration_charge" {
+		t.Fatalf("unexpected line items %+v", items)
+	}
+	if up.Subscription.PlanID != "pro" || !up.Subscription.CurrentPeriodEnd.Equal(repo.subscriptions[userID].CurrentPeriodEnd) {
+		t.Fatalf("expected pro plan with the period kept, got %+v", up.Subscription)
+	}
+
+	down, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "basic"})
+	if err != nil {
+		t.Fatalf("ChangePlan error: %v", err)
+	}
+	if down.Invoice != nil || down.Subscription.CreditBalance < 34.8 {
+		t.Fatalf("expected downgrade to leave a credit balance, got %+v %+v", down.Invoice, down.Subscription)
+	}
+
+	// The credit is drawn down by the next charge before anything is invoiced
+	yearly, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "basic", BillingCycle: "yearly"})
+	if err != nil {
+		t.Fatalf("ChangePlan error: %v", err)
+	}
+	if yearly.Invoice == nil || yearly.Subscription.CreditBalance != 0 {
+		t.Fatalf("expected credit applied to the yearly invoice, got %+v", yearly.Subscription)
+	}
+	if items := invoiceLineItems(t, yearly.Invoice); items[len(items)-1].Kind != "credit_balance" {
+		t.Fatalf("expected a credit balance line, got %+v", items)
+	}
+
+	repo.subscriptions[userID].UsageMetrics["projects"] = float64(12)
+	if _, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "free"}); err == nil {
+		t.Fatalf("expected downgrade below current usage to be rejected")
+	}
+}
+
+func TestTrialConvertsAndCancellationAppliesAtPeriodEnd(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+
+	trial, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "basic", StartTrial: true})
+	if err != nil {
+		t.Fatalf("ChangePlan trial error: %v", err)
+	}
+	if trial.Subscription.Status != "trialing" || trial.Subscription.TrialEndsAt == nil || trial.Invoice != nil {
+		t.Fatalf("expected an uninvoiced trial, got %+v", trial)
+	}
+	if err := svc.CheckFeature(context.Background(), userID, settingsbilling.FeatureWebhooks); err != nil {
+		t.Fatalf("expected trial to grant basic features: %v", err)
+	}
+
+	// End the trial without a payment method
+	repo.subscriptions[userID].CurrentPeriodEnd = time.Now().Add(-time.Minute)
+	result, err := svc.RenewSubscriptions(context.Background())
+	if err != nil || result.TrialsConverted != 1 || result.Invoiced != 1 {
+		t.Fatalf("expected trial converted and invoiced, got %+v %v", result, err)
+	}
+	sub := repo.subscriptions[userID]
+	if sub.Status != "past_due" || sub.PlanID != "basic" || !sub.CurrentPeriodEnd.After(time.Now()) {
+		t.Fatalf("expected past due basic subscription in a new period, got %+v", sub)
+	}
+	if _, err := svc.ChangePlan(context.Background(), userID, ChangePlanRequest{PlanID: "pro", StartTrial: true}); err == nil {
+		t.Fatalf("expected a second trial to be rejected")
+	}
+
+	sub.Status = "active"
+	if _, err := svc.CancelSubscription(context.Background(), userID); err != nil {
+		t.Fatalf("CancelSubscription error: %v", err)
+	}
+	if result, _ := svc.RenewSubscriptions(context.Background()); result.Canceled != 0 {
+		t.Fatalf("expected nothing canceled before the period ends")
+	}
+	if _, err := svc.ResumeSubscription(context.Background(), userID); err != nil {
+		t.Fatalf("ResumeSubscription error: %v", err)
+	}
+	svc.CancelSubscription(context.Background(), userID)
+	repo.subscriptions[userID].CurrentPeriodEnd = time.Now().Add(-time.Minute)
+	if result, _ := svc.RenewSubscriptions(context.Background()); result.Canceled != 1 || result.Invoiced != 0 {
+		t.Fatalf("expected cancellation at period end, got %+v", result)
+	}
+	if sub := repo.subscriptions[userID]; sub.PlanID != "free" || sub.Status != "canceled" {
+		t.Fatalf("expected canceled free subscription, got %+v", sub)
+	}
+}
+
+func TestBillingRoutesRecordAuditChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+
+	var changes []compliance.AuditChange
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		changes = append(changes, compliance.RecordedChanges(c)...)
+	})
+	NewHandler(svc).RegisterRoutes(router.Group("/api/v1"))
+	call := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/settings/billing/subscription/"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-User-ID", userID.String())
+		req.Header.Set("X-Permissions", "settings:billing")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, step := range []struct{ path, body string }{
+		{"change", `{"plan_id":"basic","start_trial":true}`},
+		{"cancel", ""},
+		{"resume", ""},
+	} {
+		if code := call(step.path, step.body); code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", step.path, code)
+		}
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected a change recorded per request, got %+v", changes)
+	}
+	for i, action := range []string{"change_plan", "cancel", "resume"} {
+		change := changes[i]
+		if change.TargetType != "subscription" || change.Action != action || change.TargetOwnerID != userID.String() || change.After == nil {
+			t.Fatalf("unexpected %s change %+v", action, change)
+		}
+	}
+	if before := changes[1].Before.(*Subscription); before == nil || before.PlanID != "basic" {
+		t.Fatalf("expected the cancellation to snapshot the subscription before it, got %+v", changes[1].Before)
+	}
+}
+
+func TestEntitlementsRejectActionsBeyondPlan(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID := uuid.New()
+
+	_, err := svc.CreateAPIKey(context.Background(), userID, CreateAPIKeyRequest{
+		Name:     "hooks",
+		Webhooks: []APIKeyWebhookSubscription{{Event: "*", TargetURL: "https://example.com/hooks", IsActive: true}},
+	})
+	var entErr *EntitlementError
+	if !errors.As(err, &entErr) || entErr.Code != "plan_feature_required" || entErr.PlanID != "free" {
+		t.Fatalf("expected plan_feature_required on the free plan, got %v", err)
+	}
+
+	sub, _ := repo.GetSubscription(context.Background(), userID)
+	sub.UsageMetrics = datatypes.JSONMap{"projects": float64(3)}
+	repo.SaveSubscription(context.Background(), sub)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("settings_user_id", userID) })
+	r.POST("/projects", RequireQuota(svc, settingsbilling.QuotaProjects), func(c *gin.Context) { c.Status(http.StatusCreated) })
+	r.POST("/integrations", RequireFeature(svc, settingsbilling.FeatureIntegrations), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	for _, path := range []string{"/projects", "/integrations"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != http.StatusPaymentRequired {
+			t.Fatalf("expected 402 for %s, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	ent, err := svc.GetEntitlements(context.Background(), userID)
+	if err != nil || ent.Quotas["projects"].Remaining != 0 || ent.Quotas["api_calls"].Limit != 10000 {
+		t.Fatalf("unexpected entitlements %+v %v", ent, err)
+	}
+
+	subscribeTo(repo, userID, "enterprise")
+	repo.subscriptions[userID].UsageMetrics["projects"] = float64(500)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/projects", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected unlimited plan to pass, got %d", w.Code)
+	}
+}
+
+type recordingNotifier struct {
+	warnings []QuotaWarning
+}
+
+func (n *recordingNotifier) NotifyQuotaWarning(_ context.Context, warning QuotaWarning) error {
+	n.warnings = append(n.warnings, warning)
 	return nil
 }
-func (r *fakeRepo) ListInvoices(_ context.Context, userID uuid.UUID, _ int) ([]Invoice, error) {
-	out := []Invoice{}
-	for _, inv := range r.invoices {
-		if inv.UserID == userID {
-			out = append(out, *inv)
+
+func TestUsageMetersFeedQuotaWarningsAndInvoices(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	notifier := &recordingNotifier{}
+	svc.cfg.UsageNotifier = notifier
+	userID := uuid.New()
+	sub := subscribeTo(repo, userID, "basic")
+
+	storageMB := int64(8500)
+	svc.cfg.UsageMeters = []UsageMeter{
+		{Metric: settingsbilling.QuotaStorageMB, Measure: CurrentUsage(func(context.Context, uuid.UUID) (int64, error) { return storageMB, nil })},
+		{Metric: settingsbilling.QuotaProjects, Measure: func(context.Context, uuid.UUID, time.Time, time.Time) (int64, error) {
+			return 0, errors.New("projects unavailable")
+		}},
+	}
+	// API calls come from the persisted key usage: 120k billable requests
+	repo.keyUsage["b"] = &APIKeyUsageBucket{UserID: userID, BucketStart: sub.CurrentPeriodStart.Add(time.Hour), RequestCount: 120500, RateLimited: 500}
+	if err := svc.RecordUsage(context.Background(), userID, settingsbilling.MetricCreditsMinted, 40); err != nil {
+		t.Fatalf("RecordUsage error: %v", err)
+	}
+
+	result, err := svc.CollectUsage(context.Background())
+	if err != nil || result.Subscriptions != 1 || result.Failed != 1 || result.Warnings != 2 {
+		t.Fatalf("unexpected collection result %+v %v", result, err)
+	}
+	if len(notifier.warnings) != 2 {
+		t.Fatalf("expected storage and api call warnings, got %+v", notifier.warnings)
+	}
+	usage, err := svc.GetUsage(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetUsage error: %v", err)
+	}
+	if usage.Metrics["api_calls"] != 120000 || usage.Metrics["credits_minted"] != 40 || usage.Quotas["storage_used_mb"].Warning != "approaching" {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if len(usage.EstimatedCharges) != 1 || usage.EstimatedCharges[0].Quantity != 2 || usage.EstimatedCharges[0].Amount != 2 {
+		t.Fatalf("expected 2 units of api call overage, got %+v", usage.EstimatedCharges)
+	}
+	// Metered quotas bill overage rather than refuse it
+	if err := svc.CheckQuota(context.Background(), userID, settingsbilling.QuotaAPICalls, 1); err != nil {
+		t.Fatalf("expected metered quota to allow overage: %v", err)
+	}
+
+	// Warnings are sent once per level per period
+	if result, _ := svc.CollectUsage(context.Background()); result.Warnings != 0 {
+		t.Fatalf("expected no repeated warnings, got %+v", result)
+	}
+
+	repo.subscriptions[userID].CurrentPeriodEnd = time.Now().Add(-time.Minute)
+	renewal, err := svc.RenewSubscriptions(context.Background())
+	if err != nil || renewal.Renewed != 1 || renewal.Invoiced != 1 {
+		t.Fatalf("expected renewal invoice, got %+v %v", renewal, err)
+	}
+	invoices, _ := repo.ListInvoices(context.Background(), userID, 0)
+	items := invoiceLineItems(t, &invoices[0])
+	if len(items) != 2 || items[0].Kind != "subscription" || items[1].Kind != "usage" || invoices[0].Amount != 31 {
+		t.Fatalf("expected plan and usage lines totalling 31.00, got %v %+v", invoices[0].Amount, items)
+	}
+	renewed := repo.subscriptions[userID]
+	if usageMetric(renewed.UsageMetrics, "api_calls") != 0 || usageMetric(renewed.UsageMetrics, "credits_minted") != 0 ||
+		usageMetric(renewed.UsageMetrics, "storage_used_mb") != storageMB || len(renewed.QuotaWarnings) != 0 {
+		t.Fatalf("expected period counters and warnings reset, holdings kept, got %+v %+v", renewed.UsageMetrics, renewed.QuotaWarnings)
+	}
+}
+
+func TestIssueInvoicesNumbersTaxesAndStoresPDFs(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	store := svc.cfg.InvoiceStore.(*memoryInvoiceStore)
+	german, ontario := uuid.New(), uuid.New()
+	repo.profiles[german] = &UserProfile{UserID: german, FullName: "Erika Muster", Address: datatypes.JSONMap{"city": "Berlin", "country": "de"}}
+	repo.profiles[ontario] = &UserProfile{UserID: ontario, FullName: "Sam Lee", Address: datatypes.JSONMap{"country": "CA", "state": "ON"}}
+	pro, _ := svc.cfg.Plans.Get("pro")
+	for _, userID := range []uuid.UUID{german, ontario} {
+		sub := subscribeTo(repo, userID, "pro")
+		inv := svc.draftInvoice(sub, pro, []InvoiceLineItem{{Kind: "subscription", Description: "Pro plan (monthly)", Quantity: 1, UnitAmount: 100, Amount: 100}}, time.Now().UTC())
+		repo.invoices[inv.ID] = inv
+	}
+
+	result, err := svc.IssueInvoices(context.Background())
+	if err != nil || result.Finalized != 2 || result.Rendered != 2 || result.Failed != 0 {
+		t.Fatalf("unexpected invoice run %+v %v", result, err)
+	}
+	numbers := map[string]bool{}
+	for _, inv := range repo.invoices {
+		numbers[inv.InvoiceNumber] = true
+		if inv.Status != "open" || inv.DueDate == nil || inv.PDFKey == "" || store.objects[inv.PDFKey] == nil {
+			t.Fatalf("expected issued invoice with stored PDF, got %+v", inv)
+		}
+		if !strings.HasPrefix(string(store.objects[inv.PDFKey]), "%PDF") {
+			t.Fatalf("expected a PDF document")
+		}
+		switch inv.UserID {
+		case german:
+			if inv.TaxJurisdiction != "DE" || inv.TaxAmount != 19 || inv.TotalAmount != 119 {
+				t.Fatalf("expected German VAT, got %+v", inv)
+			}
+		case ontario:
+			if inv.TaxJurisdiction != "CA-ON" || inv.TaxAmount != 13 || inv.TotalAmount != 113 {
+				t.Fatalf("expected Ontario HST, got %+v", inv)
+			}
 		}
 	}
-	return out, nil
+	year := time.Now().UTC().Year()
+	if !numbers[fmt.Sprintf("INV-%d-0001", year)] || !numbers[fmt.Sprintf("INV-%d-0002", year)] {
+		t.Fatalf("expected sequential invoice numbers, got %v", numbers)
+	}
+
+	// Nothing left to do on the next run
+	if result, _ := svc.IssueInvoices(context.Background()); result.Finalized+result.Rendered != 0 {
+		t.Fatalf("expected idle run, got %+v", result)
+	}
+
+	invoices, _ := repo.ListInvoices(context.Background(), german, 0)
+	resp, err := svc.GetInvoicePDF(context.Background(), german, invoices[0].ID)
+	if err != nil || !strings.Contains(resp.PDFURL, invoices[0].PDFKey) || resp.ExpiresAt == nil {
+		t.Fatalf("expected presigned link to stored PDF, got %+v %v", resp, err)
+	}
 }
-func (r *fakeRepo) GetInvoice(_ context.Context, userID, invoiceID uuid.UUID) (*Invoice, error) {
-	inv, ok := r.invoices[invoiceID]
-	if !ok || inv.UserID != userID {
-		return nil, gorm.ErrRecordNotFound
+
+func TestCreditNotesRefundInvoices(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	userID, adminID := uuid.New(), uuid.New()
+	repo.profiles[userID] = &UserProfile{UserID: userID, Address: datatypes.JSONMap{"country": "GB"}}
+	sub := subscribeTo(repo, userID, "pro")
+	pro, _ := svc.cfg.Plans.Get("pro")
+	open := svc.draftInvoice(sub, pro, []InvoiceLineItem{{Kind: "subscription", Description: "Pro plan", Quantity: 1, UnitAmount: 50, Amount: 50}}, time.Now().UTC())
+	paid := svc.draftInvoice(sub, pro, []InvoiceLineItem{{Kind: "subscription", Description: "Pro plan", Quantity: 1, UnitAmount: 100, Amount: 100}}, time.Now().UTC())
+	repo.invoices[open.ID] = open
+	repo.invoices[paid.ID] = paid
+	if _, err := svc.IssueCreditNote(context.Background(), adminID, open.ID, CreditNoteRequest{Reason: "duplicate"}); err == nil {
+		t.Fatalf("expected drafts to be refused")
+	}
+	if _, err := svc.IssueInvoices(context.Background()); err != nil {
+		t.Fatalf("IssueInvoices error: %v", err)
+	}
+	repo.invoices[paid.ID].Status = "paid"
+
+	// A partial refund of the paid invoice (120.00 incl. 20% VAT) goes to
+	// account credit
+	note, err := svc.IssueCreditNote(context.Background(), adminID, paid.ID, CreditNoteRequest{Amount: 30, Reason: "service outage"})
+	if err != nil {
+		t.Fatalf("IssueCreditNote error: %v", err)
+	}
+	if note.Kind != "credit_note" || !strings.HasPrefix(note.InvoiceNumber, "CN-") || note.TotalAmount != -30 || note.TaxAmount != -5 || note.PDFKey == "" {
+		t.Fatalf("unexpected credit note %+v", note)
+	}
+	if repo.invoices[paid.ID].AmountCredited != 30 || repo.invoices[paid.ID].Status != "paid" || repo.subscriptions[userID].CreditBalance != 30 {
+		t.Fatalf("expected refund held as account credit, got %+v credit %v", repo.invoices[paid.ID], repo.subscriptions[userID].CreditBalance)
+	}
+	if _, err := svc.IssueCreditNote(context.Background(), adminID, paid.ID, CreditNoteRequest{Amount: 90.01, Reason: "too much"}); err == nil {
+		t.Fatalf("expected credit beyond the invoice to be refused")
+	}
+
+	// Crediting the rest of an unpaid invoice voids it
+	note, err = svc.IssueCreditNote(context.Background(), adminID, open.ID, CreditNoteRequest{Reason: "billed in error"})
+	if err != nil || note.TotalAmount != -60 {
+		t.Fatalf("expected full credit of 60.00, got %+v %v", note, err)
+	}
+	if repo.invoices[open.ID].Status != "void" || repo.subscriptions[userID].CreditBalance != 30 {
+		t.Fatalf("expected unpaid invoice voided without account credit, got %+v", repo.invoices[open.ID])
+	}
+	if _, err := svc.IssueCreditNote(context.Background(), adminID, note.ID, CreditNoteRequest{Reason: "again"}); err == nil {
+		t.Fatalf("expected credit notes not to be credited")
 	}
-	cp := *inv
-	return &cp, nil
 }
-func (r *fakeRepo) SaveInvoice(_ context.Context, invoice *Invoice) error {
-	cp := *invoice
-	r.invoices[invoice.ID] = &cp
+
+const testWebhookSecret = "whsec_test"
+
+type recordingBillingNotifier struct {
+	notices []BillingNotice
+}
+
+func (n *recordingBillingNotifier) NotifyBilling(_ context.Context, notice BillingNotice) error {
+	n.notices = append(n.notices, notice)
 	return nil
 }
 
-func newTestService(t *testing.T, repo *fakeRepo) *service {
+// issueTestInvoice drafts and issues a 100.00 pro invoice for userID
+func issueTestInvoice(t *testing.T, svc *service, repo *fakeRepo, userID uuid.UUID) *Invoice {
 	t.Helper()
-	v, err := encryption.NewVault([]byte("0123456789abcdef0123456789abcdef"))
-	if err != nil {
-		t.Fatalf("vault init error: %v", err)
+	pro, _ := svc.cfg.Plans.Get("pro")
+	inv := svc.draftInvoice(repo.subscriptions[userID], pro, []InvoiceLineItem{{Kind: "subscription", Description: "Pro plan", Quantity: 1, UnitAmount: 100, Amount: 100}}, time.Now().UTC())
+	repo.invoices[inv.ID] = inv
+	if _, err := svc.IssueInvoices(context.Background()); err != nil {
+		t.Fatalf("IssueInvoices error: %v", err)
 	}
-	return &service{
-		repo:             repo,
-		vault:            v,
-		invoiceGenerator: pkgbilling.NoopInvoiceGenerator{},
-		cfg:              Config{APIKeyPrefix: "ppk_test", ProfileCDNBase: "https://cdn.example.test"},
-		usageTracker:     settingsapi.NewKeyUsageTracker(),
-		oauthStates:      map[string]oauthState{},
+	return repo.invoices[inv.ID]
+}
+
+func stripeEvent(id, eventType string, object map[string]interface{}) []byte {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"id": id, "type": eventType, "created": time.Now().Unix(), "data": map[string]interface{}{"object": object},
+	})
+	return payload
+}
+
+func TestDunningRetriesThenCancelsUnpaidSubscriptions(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	notifier := &recordingBillingNotifier{}
+	svc.cfg.BillingNotifier = notifier
+	userID := uuid.New()
+	subscribeTo(repo, userID, "pro")
+	if _, err := svc.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_card_decline", PaymentMethodType: "card"}); err != nil {
+		t.Fatalf("AddPaymentMethod error: %v", err)
+	}
+	if sub := repo.subscriptions[userID]; sub.ProcessorCustomerID == "" || sub.PaymentMethodLast4 != "0002" {
+		t.Fatalf("expected processor customer and card details, got %+v", sub)
+	}
+	inv := issueTestInvoice(t, svc, repo, userID)
+
+	// First charge and three retries, each failing
+	for attempt := 1; attempt <= 4; attempt++ {
+		result, err := svc.CollectPayments(context.Background())
+		if err != nil || result.Attempted != 1 || result.Failed != 1 {
+			t.Fatalf("attempt %d: unexpected run %+v %v", attempt, result, err)
+		}
+		inv = repo.invoices[inv.ID]
+		if inv.PaymentAttempts != attempt || inv.Status != "open" || inv.LastPaymentError == "" {
+			t.Fatalf("attempt %d: unexpected invoice %+v", attempt, inv)
+		}
+		if attempt < 4 {
+			if inv.NextPaymentAttempt == nil || repo.subscriptions[userID].Status != "past_due" {
+				t.Fatalf("attempt %d: expected a retry while past due, got %+v %s", attempt, inv.NextPaymentAttempt, repo.subscriptions[userID].Status)
+			}
+			// Not due again until the retry date
+			if result, _ := svc.CollectPayments(context.Background()); result.Attempted != 0 {
+				t.Fatalf("expected no charge before the retry date, got %+v", result)
+			}
+			past := time.Now().UTC().Add(-time.Minute)
+			inv.NextPaymentAttempt = &past
+		}
+	}
+	sub := repo.subscriptions[userID]
+	if inv.NextPaymentAttempt != nil || sub.Status != "unpaid" || sub.UnpaidSince == nil {
+		t.Fatalf("expected unpaid once retries are exhausted, got %+v %+v", inv, sub)
+	}
+	if len(notifier.notices) != 4 || notifier.notices[3].NextAttempt != nil || notifier.notices[0].Kind != "payment_failed" {
+		t.Fatalf("expected a failure notice per attempt, got %+v", notifier.notices)
+	}
+
+	// Still inside the grace period
+	if result, _ := svc.CollectPayments(context.Background()); result.Canceled != 0 {
+		t.Fatalf("expected no cancellation yet, got %+v", result)
+	}
+	longAgo := time.Now().UTC().Add(-15 * 24 * time.Hour)
+	sub.UnpaidSince = &longAgo
+	result, err := svc.CollectPayments(context.Background())
+	if err != nil || result.Canceled != 1 {
+		t.Fatalf("expected cancellation, got %+v %v", result, err)
+	}
+	if sub := repo.subscriptions[userID]; sub.Status != "canceled" || sub.PlanID != "free" || sub.UnpaidSince != nil {
+		t.Fatalf("expected canceled on the free plan, got %+v", sub)
+	}
+	if last := notifier.notices[len(notifier.notices)-1]; last.Kind != "subscription_canceled" {
+		t.Fatalf("expected cancellation notice, got %+v", last)
 	}
 }
 
-func TestValidateAPIKeySecretTracksUsageAndRateLimits(t *testing.T) {
+func TestPaymentsWithoutProcessorFailClosed(t *testing.T) {
 	repo := newFakeRepo()
 	svc := newTestService(t, repo)
+	svc.cfg.PaymentProcessor = nil
 	userID := uuid.New()
-	secret := "ppk_test_abcdefghijklmnop"
-	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
-	if err != nil {
-		t.Fatalf("hash error: %v", err)
+	subscribeTo(repo, userID, "pro")
+	inv := issueTestInvoice(t, svc, repo, userID)
+
+	if _, err := svc.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_card_visa", PaymentMethodType: "card"}); !errors.Is(err, ErrPaymentsUnavailable) {
+		t.Fatalf("expected ErrPaymentsUnavailable, got %v", err)
 	}
-	keyID := uuid.New()
-	repo.apiKeys[keyID] = &APIKey{
-		ID:                 keyID,
-		UserID:             userID,
-		Name:               "test",
-		KeyPrefix:          secret[:8],
-		KeyHash:            string(hash),
-		KeyLastFour:        secret[len(secret)-4:],
-		Scopes:             pq.StringArray{"settings:read"},
-		RateLimitPerMinute: 1,
-		RateLimitPerDay:    10,
-		IsActive:           true,
-		Metadata:           datatypes.JSONMap{},
+	result, err := svc.CollectPayments(context.Background())
+	if err != nil || result.Attempted != 0 {
+		t.Fatalf("expected no charge without a processor, got %+v %v", result, err)
+	}
+	if inv = repo.invoices[inv.ID]; inv.Status != "open" || inv.PaidAt != nil {
+		t.Fatalf("expected the invoice to stay open, got %+v", inv)
 	}
+	if err := svc.HandlePaymentWebhook(context.Background(), stripeEvent("evt_1", "charge.succeeded", nil), ""); !errors.Is(err, ErrPaymentsUnavailable) {
+		t.Fatalf("expected webhooks refused, got %v", err)
+	}
+}
 
-	resp, err := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: secret})
+func TestNewPaymentMethodRecoversPastDueSubscription(t *testing.T) {
+	repo := newFakeRepo()
+	svc := newTestService(t, repo)
+	processor := svc.cfg.PaymentProcessor.(*pkgbilling.FakeProcessor)
+	userID, adminID := uuid.New(), uuid.New()
+	subscribeTo(repo, userID, "pro")
+	if _, err := svc.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_card_decline", PaymentMethodType: "card"}); err != nil {
+		t.Fatalf("AddPaymentMethod error: %v", err)
+	}
+	inv := issueTestInvoice(t, svc, repo, userID)
+	if _, err := svc.CollectPayments(context.Background()); err != nil {
+		t.Fatalf("CollectPayments error: %v", err)
+	}
+	if repo.subscriptions[userID].Status != "past_due" {
+		t.Fatalf("expected past_due after a decline, got %s", repo.subscriptions[userID].Status)
+	}
+
+	// A working card is charged straight away
+	sub, err := svc.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_card_visa", PaymentMethodType: "card"})
 	if err != nil {
-		t.Fatalf("ValidateAPIKeySecret error: %v", err)
+		t.Fatalf("AddPaymentMethod error: %v", err)
 	}
-	if !resp.Valid || resp.Key == nil || resp.Usage == nil {
-		t.Fatalf("expected valid response with key and usage")
+	inv = repo.invoices[inv.ID]
+	if sub.Status != "active" || inv.Status != "paid" || inv.PaymentAttempts != 2 || inv.TransactionID == "" || inv.PaidAt == nil {
+		t.Fatalf("expected recovery and a paid invoice, got %+v %+v", sub, inv)
+	}
+	if len(processor.Charges()) != 2 {
+		t.Fatalf("expected two charges, got %d", len(processor.Charges()))
 	}
 
-	resp2, err := svc.ValidateAPIKeySecret(context.Background(), ValidateAPIKeyRequest{Secret: secret})
+	// Credit notes on processor-paid invoices go back to the card
+	note, err := svc.IssueCreditNote(context.Background(), adminID, inv.ID, CreditNoteRequest{Amount: 10, Reason: "goodwill"})
 	if err != nil {
-		t.Fatalf("ValidateAPIKeySecret second call error: %v", err)
+		t.Fatalf("IssueCreditNote error: %v", err)
 	}
-	if resp2.Valid || !resp2.RateLimited {
-		t.Fatalf("expected rate limited second response")
+	refunds := processor.Refunds()
+	if len(refunds) != 1 || refunds[0].ChargeID != inv.TransactionID || refunds[0].Amount != 1000 || repo.invoices[note.ID].TransactionID == "" {
+		t.Fatalf("expected a processor refund, got %+v", refunds)
 	}
-	if resp2.RetryAfterSec <= 0 {
-		t.Fatalf("expected retry_after on rate-limited response")
+	if repo.subscriptions[userID].CreditBalance != 0 {
+		t.Fatalf("expected no account credit, got %v", repo.subscriptions[userID].CreditBalance)
 	}
 }
 
-func TestOAuthFlowRoundTripCreatesIntegration(t *testing.T) {
+func TestPaymentWebhooksSettleAndDispute(t *testing.T) {
 	repo := newFakeRepo()
 	svc := newTestService(t, repo)
+	notifier := &recordingBillingNotifier{}
+	svc.cfg.BillingNotifier = notifier
 	userID := uuid.New()
+	subscribeTo(repo, userID, "pro")
+	if _, err := svc.AddPaymentMethod(context.Background(), userID, AddPaymentMethodRequest{PaymentMethodID: "pm_bank_pending", PaymentMethodType: "bank_account"}); err != nil {
+		t.Fatalf("AddPaymentMethod error: %v", err)
+	}
+	inv := issueTestInvoice(t, svc, repo, userID)
+	result, err := svc.CollectPayments(context.Background())
+	if err != nil || result.Pending != 1 || repo.invoices[inv.ID].Status != "processing" {
+		t.Fatalf("expected a processing charge, got %+v %v", result, err)
+	}
+	chargeID := repo.invoices[inv.ID].TransactionID
 
-	start, err := svc.StartOAuthFlow(context.Background(), userID, "stripe")
-	if err != nil {
-		t.Fatalf("StartOAuthFlow error: %v", err)
+	succeeded := stripeEvent("evt_1", "payment_intent.succeeded", map[string]interface{}{"id": chargeID, "status": "succeeded", "amount": 10000})
+	if err := svc.HandlePaymentWebhook(context.Background(), succeeded, "t=1,v1=bad"); !errors.Is(err, pkgbilling.ErrInvalidSignature) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+	stale := pkgbilling.SignWebhook(testWebhookSecret, succeeded, time.Now().Add(-time.Hour))
+	if err := svc.HandlePaymentWebhook(context.Background(), succeeded, stale); !errors.Is(err, pkgbilling.ErrInvalidSignature) {
+		t.Fatalf("expected stale signature to be refused, got %v", err)
 	}
-	if start.State == "" || start.RedirectURL == "" {
-		t.Fatalf("expected state and redirect url")
+	if repo.invoices[inv.ID].Status != "processing" {
+		t.Fatalf("unsigned events must not be applied")
 	}
 
-	callback, err := svc.CompleteOAuthFlow(context.Background(), userID, "stripe", OAuthCallbackRequest{
-		State:           start.State,
-		Code:            "auth-code-123",
-		IntegrationName: "payments",
-	})
-	if err != nil {
-		t.Fatalf("CompleteOAuthFlow error: %v", err)
+	signature := pkgbilling.SignWebhook(testWebhookSecret, succeeded, time.Now())
+	for i := 0; i < 2; i++ {
+		if err := svc.HandlePaymentWebhook(context.Background(), succeeded, signature); err != nil {
+			t.Fatalf("HandlePaymentWebhook error: %v", err)
+		}
 	}
-	if !callback.Connected || callback.Integration == nil {
-		t.Fatalf("expected connected integration")
+	if repo.invoices[inv.ID].Status != "paid" || len(repo.paymentEvents) != 1 {
+		t.Fatalf("expected paid invoice and one recorded event, got %+v %d", repo.invoices[inv.ID], len(repo.paymentEvents))
+	}
+	if len(notifier.notices) != 1 || notifier.notices[0].Kind != "payment_succeeded" {
+		t.Fatalf("expected a single receipt for a redelivered event, got %+v", notifier.notices)
+	}
+
+	disputed := stripeEvent("evt_2", "charge.dispute.created", map[string]interface{}{"payment_intent": chargeID, "amount": 10000, "reason": "fraudulent"})
+	if err := svc.HandlePaymentWebhook(context.Background(), disputed, pkgbilling.SignWebhook(testWebhookSecret, disputed, time.Now())); err != nil {
+		t.Fatalf("HandlePaymentWebhook error: %v", err)
+	}
+	if repo.invoices[inv.ID].Status != "disputed" {
+		t.Fatalf("expected disputed invoice, got %s", repo.invoices[inv.ID].Status)
+	}
+	if last := notifier.notices[len(notifier.notices)-1]; last.Kind != "payment_disputed" || last.Reason != "fraudulent" || last.Amount != 100 {
+		t.Fatalf("unexpected dispute notice %+v", last)
 	}
 }
 
-func TestDeleteProfileErasesSettingsData(t *testing.T) {
+func TestUploadProfilePictureStoresThumbnailsAndReplacesOld(t *testing.T) {
 	repo := newFakeRepo()
 	svc := newTestService(t, repo)
+	store := svc.cfg.PictureStore.(*memoryPictureStore)
 	userID := uuid.New()
-	repo.profiles[userID] = &UserProfile{ID: uuid.New(), UserID: userID}
-	repo.prefs[userID] = &NotificationPreference{ID: uuid.New(), UserID: userID}
-	repo.apiKeys[uuid.New()] = &APIKey{ID: uuid.New(), UserID: userID}
+	var upload bytes.Buffer
+	if err := png.Encode(&upload, image.NewNRGBA(image.Rect(0, 0, 600, 400))); err != nil {
+		t.Fatal(err)
+	}
 
-	_, err := svc.DeleteProfile(context.Background(), userID)
+	if _, err := svc.UploadProfilePicture(context.Background(), userID, []byte("#!/bin/sh\nrm -rf /")); !errors.Is(err, settingsprofile.ErrUnsupportedPicture) {
+		t.Fatalf("expected unsupported type, got %v", err)
+	}
+	svc.cfg.ProfilePictureMaxBytes = 100
+	if _, err := svc.UploadProfilePicture(context.Background(), userID, upload.Bytes()); !errors.Is(err, ErrPictureTooLarge) {
+		t.Fatalf("expected size limit, got %v", err)
+	}
+	svc.cfg.ProfilePictureMaxBytes = defaultProfilePictureMaxBytes
+	svc.cfg.ProfilePictureSizes = []int{-1}
+	if _, err := svc.UploadProfilePicture(context.Background(), userID, upload.Bytes()); err == nil || len(store.objects) != 0 {
+		t.Fatalf("expected an upload without thumbnails refused, got %v", err)
+	}
+	svc.cfg.ProfilePictureSizes = settingsprofile.DefaultPictureSizes
+	if _, err := NewService(repo, Config{ProfilePictureSizes: []int{64, 128}}); err == nil {
+		t.Fatalf("expected sizes listed smallest first refused at startup")
+	}
+
+	first, err := svc.UploadProfilePicture(context.Background(), userID, upload.Bytes())
+	if err != nil {
+		t.Fatalf("UploadProfilePicture error: %v", err)
+	}
+	if len(store.objects) != 4 || len(first.Sizes) != 4 || first.ProfilePictureURL != first.Sizes["400"] {
+		t.Fatalf("expected four thumbnails with the largest as the picture, got %+v", first)
+	}
+	if !strings.HasPrefix(first.ProfilePictureURL, "https://cdn.example.test/settings/profiles/"+userID.String()+"/") {
+		t.Fatalf("unexpected picture URL %s", first.ProfilePictureURL)
+	}
+	for key, contentType := range store.types {
+		if contentType != "image/png" || !strings.HasSuffix(key, ".png") {
+			t.Fatalf("expected PNG thumbnails, got %s %s", key, contentType)
+		}
+	}
+
+	second, err := svc.UploadProfilePicture(context.Background(), userID, upload.Bytes())
 	if err != nil {
+		t.Fatalf("UploadProfilePicture error: %v", err)
+	}
+	if second.ProfilePictureURL == first.ProfilePictureURL || len(store.objects) != 4 {
+		t.Fatalf("expected the old thumbnails deleted on replacement, got %d objects", len(store.objects))
+	}
+	if repo.profiles[userID].ProfilePictureURL != second.ProfilePictureURL {
+		t.Fatalf("expected profile to point at the new picture")
+	}
+
+	if _, err := svc.DeleteProfile(context.Background(), userID); err != nil {
 		t.Fatalf("DeleteProfile error: %v", err)
 	}
-	if _, ok := repo.profiles[userID]; ok {
-		t.Fatalf("expected profile deleted")
+	if len(store.objects) != 0 {
+		t.Fatalf("expected pictures deleted with the profile, got %d", len(store.objects))
 	}
-	if _, ok := repo.prefs[userID]; ok {
-		t.Fatalf("expected prefs deleted")
+
+	svc.cfg.PictureStore = nil
+	if _, err := svc.UploadProfilePicture(context.Background(), userID, upload.Bytes()); !errors.Is(err, ErrPictureStorageUnavailable) {
+		t.Fatalf("expected storage unavailable, got %v", err)
 	}
-	if len(repo.apiKeys) != 0 {
-		t.Fatalf("expected api keys deleted")
+}
+
+type recordingExportNotifier struct {
+	urls []string
+}
+
+func (n *recordingExportNotifier) NotifyAccountExport(_ context.Context, _ *AccountExport, downloadURL string) error {
+	n.urls = append(n.urls, downloadURL)
+	return nil
+}
+
+func readZip(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
 	}
+	return files
 }
 
-func TestGetInvoicePDFGeneratesURLWhenMissing(t *testing.T) {
+func TestAccountExportCollectsAllModulesIntoExpiringArchive(t *testing.T) {
 	repo := newFakeRepo()
 	svc := newTestService(t, repo)
+	store := svc.cfg.ExportStore.(*memoryExportStore)
+	notifier := &recordingExportNotifier{}
+	svc.cfg.ExportNotifier = notifier
 	userID := uuid.New()
-	invoiceID := uuid.New()
-	repo.invoices[invoiceID] = &Invoice{
-		ID:            invoiceID,
-		UserID:        userID,
-		InvoiceNumber: "INV-2026-0001",
-		Status:        "open",
+	repo.profiles[userID] = &UserProfile{ID: uuid.New(), UserID: userID, FullName: "Ada Okafor", Organization: "Mangrove Trust", Language: "en"}
+	keyID := uuid.New()
+	repo.apiKeys[keyID] = &APIKey{ID: keyID, UserID: userID, Name: "ci", KeyPrefix: "ppk_test", KeyHash: "hash-must-not-leak", WebhookSecret: "secret-must-not-leak"}
+	sub := subscribeTo(repo, userID, "pro")
+	sub.PaymentMethodID = "vault:payment-token-must-not-leak"
+	type comment struct {
+		ID      string   `json:"id"`
+		Content string   `json:"content"`
+		Tags    []string `json:"tags"`
 	}
+	svc.cfg.ExportSources = []ExportSource{{Category: "comments", Collect: func(_ context.Context, id uuid.UUID) (interface{}, error) {
+		if id != userID {
+			return nil, fmt.Errorf("unexpected user")
+		}
+		return []comment{{ID: "c1", Content: "Plot 4, \"north\" boundary", Tags: []string{"survey"}}, {ID: "c2", Content: "Done"}}, nil
+	}}}
 
-	resp, err := svc.GetInvoicePDF(context.Background(), userID, invoiceID)
-	if err != nil {
-		t.Fatalf("GetInvoicePDF error: %v", err)
+	export, err := svc.RequestAccountExport(context.Background(), userID)
+	if err != nil || export.Status != "pending" {
+		t.Fatalf("expected pending export, got %+v %v", export, err)
 	}
-	if resp.PDFURL == "" {
-		t.Fatalf("expected generated PDF URL")
+	if again, _ := svc.RequestAccountExport(context.Background(), userID); again.ID != export.ID {
+		t.Fatalf("expected the export in progress to be returned")
+	}
+	if pending, _ := svc.GetAccountExport(context.Background(), userID, export.ID); pending.DownloadURL != "" {
+		t.Fatalf("expected no link before the export is built")
+	}
+
+	result, err := svc.ProcessAccountExports(context.Background())
+	if err != nil || result.Completed != 1 || result.Failed != 0 {
+		t.Fatalf("unexpected export run %+v %v", result, err)
+	}
+	done, err := svc.GetAccountExport(context.Background(), userID, export.ID)
+	if err != nil || done.Status != "completed" || done.DownloadURL == "" || done.DownloadExpiresAt == nil || done.ExpiresAt == nil {
+		t.Fatalf("expected completed export with a download link, got %+v %v", done, err)
+	}
+	if !strings.Contains(done.DownloadURL, "X-Amz-Expires=900") || len(notifier.urls) != 1 {
+		t.Fatalf("expected a 15 minute link and an emailed link, got %s %v", done.DownloadURL, notifier.urls)
+	}
+	if _, err := svc.GetAccountExport(context.Background(), uuid.New(), export.ID); err == nil {
+		t.Fatalf("expected other users to be refused")
+	}
+
+	archive := store.objects[repo.exports[export.ID].ObjectKey]
+	files := readZip(t, archive)
+	for _, name := range []string{"manifest.json", "summary.pdf", "profile/profile.json", "notification_preferences/notification_preferences.csv",
+		"api_keys/api_keys.json", "integrations/integrations.csv", "subscription/subscription.json", "invoices/invoices.json", "comments/comments.csv"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected %s in the archive", name)
+		}
+	}
+	for name, data := range files {
+		for _, secret := range []string{"hash-must-not-leak", "secret-must-not-leak", "payment-token-must-not-leak"} {
+			if bytes.Contains(data, []byte(secret)) {
+				t.Fatalf("%s leaks %s", name, secret)
+			}
+		}
+	}
+	if !bytes.HasPrefix(files["summary.pdf"], []byte("%PDF")) {
+		t.Fatalf("expected a PDF summary")
+	}
+	rows, err := csv.NewReader(bytes.NewReader(files["comments/comments.csv"])).ReadAll()
+	if err != nil || len(rows) != 3 || strings.Join(rows[0], ",") != "content,id,tags" || rows[1][0] != "Plot 4, \"north\" boundary" || rows[1][2] != `["survey"]` {
+		t.Fatalf("unexpected comments CSV %v %v", rows, err)
+	}
+
+	var manifest settingsprofile.ExportManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	records := map[string]int{}
+	for _, c := range manifest.Categories {
+		records[c.Category] = c.Records
+	}
+	if manifest.ExportID != export.ID.String() || records["profile"] != 1 || records["api_keys"] != 1 || records["comments"] != 2 || records["invoices"] != 0 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	for _, f := range manifest.Files {
+		sum := sha256.Sum256(files[f.Path])
+		if hex.EncodeToString(sum[:]) != f.SHA256 {
+			t.Fatalf("checksum mismatch for %s", f.Path)
+		}
+	}
+
+	// Archives are deleted once they expire
+	past := time.Now().UTC().Add(-time.Minute)
+	repo.exports[export.ID].ExpiresAt = &past
+	if result, _ := svc.ProcessAccountExports(context.Background()); result.Expired != 1 {
+		t.Fatalf("expected the export to expire, got %+v", result)
+	}
+	if len(store.objects) != 0 || repo.exports[export.ID].Status != "expired" {
+		t.Fatalf("expected archive deleted, got %d objects, status %s", len(store.objects), repo.exports[export.ID].Status)
 	}
 }
 
-func TestCompleteOAuthFlowRejectsUnknownState(t *testing.T) {
+func TestAccountExportFailsWhenAModuleCannotBeCollected(t *testing.T) {
 	repo := newFakeRepo()
 	svc := newTestService(t, repo)
-	_, err := svc.CompleteOAuthFlow(context.Background(), uuid.New(), "stripe", OAuthCallbackRequest{
-		State: "missing",
-		Code:  "code",
-	})
-	if err == nil {
-		t.Fatalf("expected error for unknown oauth state")
+	userID := uuid.New()
+	svc.cfg.ExportSources = []ExportSource{{Category: "documents", Collect: func(context.Context, uuid.UUID) (interface{}, error) {
+		return nil, fmt.Errorf("documents database unavailable")
+	}}}
+	export, err := svc.RequestAccountExport(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("RequestAccountExport error: %v", err)
+	}
+	result, err := svc.ProcessAccountExports(context.Background())
+	if err != nil || result.Failed != 1 {
+		t.Fatalf("expected a failed export, got %+v %v", result, err)
+	}
+	failed := repo.exports[export.ID]
+	if failed.Status != "failed" || !strings.Contains(failed.Error, "documents") || failed.ObjectKey != "" {
+		t.Fatalf("unexpected export %+v", failed)
+	}
+	if failed.StartedAt == nil || failed.CompletedAt == nil || failed.CompletedAt.Before(*failed.StartedAt) {
+		t.Fatalf("expected the claim's start time kept on the saved export, got %+v", failed)
+	}
+	// A new export can be requested after a failure
+	if retry, _ := svc.RequestAccountExport(context.Background(), userID); retry.ID == export.ID {
+		t.Fatalf("expected a new export")
+	}
+
+	svc.cfg.ExportStore = nil
+	if _, err := svc.RequestAccountExport(context.Background(), uuid.New()); !errors.Is(err, ErrExportStorageUnavailable) {
+		t.Fatalf("expected storage unavailable, got %v", err)
 	}
 }
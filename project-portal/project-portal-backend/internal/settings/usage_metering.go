@@ -0,0 +1,284 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	settingsbilling "carbon-scribe/project-portal/project-portal-backend/internal/settings/billing"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const usageCollectionBatchSize = 200
+
+// planQuotas are the quotas reported to users, in display order
+var planQuotas = []string{
+	settingsbilling.QuotaProjects,
+	settingsbilling.QuotaStorageMB,
+	settingsbilling.QuotaAPICalls,
+	settingsbilling.QuotaReportSchedules,
+}
+
+// UsageMeter measures one billing metric for a user from the module that
+// owns the data. Period metrics count usage in [periodStart, periodEnd);
+// other meters ignore the period and report what the user holds now.
+type UsageMeter struct {
+	Metric  string
+	Measure func(ctx context.Context, userID uuid.UUID, periodStart, periodEnd time.Time) (int64, error)
+}
+
+// CurrentUsage adapts a measurement that does not depend on the period, such
+// as storage or active projects
+func CurrentUsage(measure func(ctx context.Context, userID uuid.UUID) (int64, error)) func(context.Context, uuid.UUID, time.Time, time.Time) (int64, error) {
+	return func(ctx context.Context, userID uuid.UUID, _, _ time.Time) (int64, error) {
+		return measure(ctx, userID)
+	}
+}
+
+// UsageNotifier delivers quota warnings to users
+type UsageNotifier interface {
+	NotifyQuotaWarning(ctx context.Context, warning QuotaWarning) error
+}
+
+// usageMeters returns the configured meters plus API calls, which settings
+// meters itself from the API key usage buckets
+func (s *service) usageMeters() []UsageMeter {
+	meters := append([]UsageMeter{}, s.cfg.UsageMeters...)
+	for _, m := range meters {
+		if m.Metric == settingsbilling.QuotaAPICalls {
+			return meters
+		}
+	}
+	return append(meters, UsageMeter{Metric: settingsbilling.QuotaAPICalls, Measure: s.repo.SumAPIKeyRequests})
+}
+
+// RecordUsage adds to a period metric that no module keeps a record of,
+// such as credits minted. The next collection leaves it untouched.
+func (s *service) RecordUsage(ctx context.Context, userID uuid.UUID, metric string, quantity int64) error {
+	if !settingsbilling.IsPeriodMetric(metric) {
+		return fmt.Errorf("%s is not a metered usage counter", metric)
+	}
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.repo.IncrementSubscriptionUsage(ctx, sub.ID, metric, quantity)
+}
+
+// CollectUsage runs every meter for every subscription over its current
+// period, stores the results in the subscription usage metrics and warns
+// users whose usage reaches a quota threshold for the first time in the
+// period
+func (s *service) CollectUsage(ctx context.Context) (*UsageCollectionResult, error) {
+	result := &UsageCollectionResult{}
+	after := uuid.Nil
+	for {
+		subs, err := s.repo.ListSubscriptions(ctx, after, usageCollectionBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for i := range subs {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			sub := &subs[i]
+			now := time.Now().UTC()
+			values, failed := s.measureUsage(ctx, sub, sub.CurrentPeriodStart, sub.CurrentPeriodEnd)
+			result.Failed += failed
+			if sub.UsageMetrics == nil {
+				sub.UsageMetrics = datatypes.JSONMap{}
+			}
+			for metric, v := range values {
+				sub.UsageMetrics[metric] = v
+			}
+			result.Warnings += s.raiseQuotaWarnings(ctx, sub)
+			if err := s.repo.UpdateSubscriptionUsage(ctx, sub.ID, values, sub.QuotaWarnings, now); err != nil {
+				return result, err
+			}
+			result.Subscriptions++
+		}
+		if len(subs) < usageCollectionBatchSize {
+			return result, nil
+		}
+		after = subs[len(subs)-1].ID
+	}
+}
+
+// measureUsage runs the meters for a period. A failing meter is logged and
+// its metric left out, so the last stored value stands.
+func (s *service) measureUsage(ctx context.Context, sub *Subscription, periodStart, periodEnd time.Time) (map[string]interface{}, int) {
+	values := map[string]interface{}{}
+	failed := 0
+	for _, meter := range s.usageMeters() {
+		v, err := meter.Measure(ctx, sub.UserID, periodStart, periodEnd)
+		if err != nil {
+			failed++
+			log.Printf("settings: meter %s for user %s: %v", meter.Metric, sub.UserID, err)
+			continue
+		}
+		values[meter.Metric] = v
+	}
+	return values, failed
+}
+
+// raiseQuotaWarnings notifies the user of each quota that reached a higher
+// warning level than already reported this period, and records it
+func (s *service) raiseQuotaWarnings(ctx context.Context, sub *Subscription) int {
+	plan := s.entitledPlan(sub)
+	if sub.QuotaWarnings == nil {
+		sub.QuotaWarnings = datatypes.JSONMap{}
+	}
+	raised := 0
+	for _, quota := range planQuotas {
+		limit := plan.Quota(quota)
+		used := usageMetric(sub.UsageMetrics, quota)
+		level := settingsbilling.QuotaLevel(used, limit)
+		previous, _ := sub.QuotaWarnings[quota].(string)
+		if warningRank(level) <= warningRank(previous) {
+			continue
+		}
+		sub.QuotaWarnings[quota] = level
+		warning := QuotaWarning{
+			UserID:    sub.UserID,
+			PlanID:    plan.ID,
+			Quota:     quota,
+			Level:     level,
+			Used:      used,
+			Limit:     limit,
+			PeriodEnd: sub.CurrentPeriodEnd,
+		}
+		if s.cfg.UsageNotifier != nil {
+			if err := s.cfg.UsageNotifier.NotifyQuotaWarning(ctx, warning); err != nil {
+				log.Printf("settings: quota warning for user %s: %v", sub.UserID, err)
+			}
+		}
+		s.audit("billing.quota.warning", sub.UserID, map[string]interface{}{"quota": quota, "level": level, "used": used, "limit": limit})
+		raised++
+	}
+	return raised
+}
+
+func warningRank(level string) int {
+	switch level {
+	case settingsbilling.WarningApproaching:
+		return 1
+	case settingsbilling.WarningExceeded:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// GetUsage reports the current period's usage as last collected and the
+// usage charges it would add to the next invoice
+func (s *service) GetUsage(ctx context.Context, userID uuid.UUID) (*UsageSummary, error) {
+	sub, err := s.repo.GetSubscription(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	plan := s.entitledPlan(sub)
+	summary := &UsageSummary{
+		PeriodStart:      sub.CurrentPeriodStart,
+		PeriodEnd:        sub.CurrentPeriodEnd,
+		CollectedAt:      sub.UsageCollectedAt,
+		Metrics:          map[string]int64{},
+		Quotas:           quotaStatuses(plan, sub),
+		EstimatedCharges: usageLineItems(plan, sub.UsageMetrics, sub.CurrentPeriodStart, sub.CurrentPeriodEnd),
+	}
+	for metric := range settingsbilling.DefaultUsageMetrics() {
+		summary.Metrics[metric] = usageMetric(sub.UsageMetrics, metric)
+	}
+	return summary, nil
+}
+
+// closeUsagePeriod measures the period that is ending one last time and
+// prices usage over quota for the renewal invoice
+func (s *service) closeUsagePeriod(ctx context.Context, sub *Subscription, plan settingsbilling.Plan) []InvoiceLineItem {
+	values, _ := s.measureUsage(ctx, sub, sub.CurrentPeriodStart, sub.CurrentPeriodEnd)
+	if sub.UsageMetrics == nil {
+		sub.UsageMetrics = datatypes.JSONMap{}
+	}
+	for metric, v := range values {
+		sub.UsageMetrics[metric] = v
+	}
+	return usageLineItems(plan, sub.UsageMetrics, sub.CurrentPeriodStart, sub.CurrentPeriodEnd)
+}
+
+// startUsagePeriod restarts period counters and quota warnings. Holdings
+// such as storage carry over.
+func startUsagePeriod(sub *Subscription) {
+	metrics := datatypes.JSONMap(settingsbilling.DefaultUsageMetrics())
+	for metric, v := range sub.UsageMetrics {
+		if !settingsbilling.IsPeriodMetric(metric) {
+			metrics[metric] = v
+		}
+	}
+	sub.UsageMetrics = metrics
+	sub.QuotaWarnings = datatypes.JSONMap{}
+}
+
+func usageLineItems(plan settingsbilling.Plan, metrics datatypes.JSONMap, periodStart, periodEnd time.Time) []InvoiceLineItem {
+	metered := make([]string, 0, len(plan.Metered))
+	for metric := range plan.Metered {
+		metered = append(metered, metric)
+	}
+	sort.Strings(metered)
+	items := []InvoiceLineItem{}
+	for _, metric := range metered {
+		price := plan.Metered[metric]
+		units, cents := plan.UsageCharge(metric, usageMetric(metrics, metric))
+		if units == 0 {
+			continue
+		}
+		items = append(items, InvoiceLineItem{
+			Kind:        "usage",
+			Description: fmt.Sprintf("%s over the %s plan quota (per %s)", usageLabel(metric), plan.Name, price.Unit),
+			Quantity:    float64(units),
+			UnitAmount:  centsToAmount(price.UnitPrice),
+			Amount:      centsToAmount(cents),
+			PeriodStart: periodStart,
+			PeriodEnd:   periodEnd,
+		})
+	}
+	return items
+}
+
+func quotaStatuses(plan settingsbilling.Plan, sub *Subscription) map[string]QuotaStatus {
+	out := map[string]QuotaStatus{}
+	for _, quota := range planQuotas {
+		status := QuotaStatus{
+			Limit:     plan.Quota(quota),
+			Used:      usageMetric(sub.UsageMetrics, quota),
+			Remaining: settingsbilling.Unlimited,
+			Metered:   plan.SoftLimit(quota),
+		}
+		if status.Limit != settingsbilling.Unlimited {
+			status.Remaining = status.Limit - status.Used
+			if status.Remaining < 0 {
+				status.Remaining = 0
+			}
+		}
+		status.Warning = settingsbilling.QuotaLevel(status.Used, status.Limit)
+		out[quota] = status
+	}
+	return out
+}
+
+func usageLabel(metric string) string {
+	switch metric {
+	case settingsbilling.QuotaAPICalls:
+		return "API calls"
+	case settingsbilling.QuotaStorageMB:
+		return "Storage"
+	default:
+		return strings.ReplaceAll(metric, "_", " ")
+	}
+}
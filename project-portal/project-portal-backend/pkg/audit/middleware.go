@@ -1,41 +1,179 @@
 package audit
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net"
-	"time"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Middleware returns a Gin middleware that creates audit log entries for requests.
-func Middleware(service *compliance.Service, serviceName string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
+// EventLogger stores audit entries; *compliance.Service implements it.
+type EventLogger interface {
+	LogAuditEvent(ctx context.Context, entry compliance.AuditEntry) error
+}
 
+// Middleware returns a Gin middleware that creates an audit log entry for
+// every mutating request. Handlers describe what they changed with
+// compliance.RecordChange; each recorded change is logged with its before and
+// after snapshots, and requests that record none are logged with their
+// outcome. The service is taken from the module segment of the route, falling
+// back to serviceName.
+func Middleware(logger EventLogger, serviceName string) gin.HandlerFunc {
+	classifier := NewSensitiveDataClassifier()
+	return func(c *gin.Context) {
 		c.Next()
 
-		entry := compliance.AuditEntry{
-			EventType:   "data_access",
-			EventAction: methodToAction(c.Request.Method),
-			ActorType:   compliance.ActorTypeUser,
-			ActorIP:     net.ParseIP(c.ClientIP()),
-			ServiceName: serviceName,
-			Endpoint:    c.FullPath(),
-			HTTPMethod:  c.Request.Method,
+		endpoint := c.FullPath()
+		if !isMutating(c.Request.Method) || endpoint == "" {
+			return
+		}
+
+		actorID, actorType := principal(c)
+		base := compliance.AuditEntry{
+			EventType:        "data_modification",
+			EventAction:      methodToAction(c.Request.Method),
+			ActorID:          actorID,
+			ActorType:        actorType,
+			ActorIP:          net.ParseIP(c.ClientIP()),
+			TargetID:         c.Param("id"),
+			SensitivityLevel: classifyEndpoint(endpoint),
+			ServiceName:      serviceFromPath(endpoint, serviceName),
+			Endpoint:         endpoint,
+			HTTPMethod:       c.Request.Method,
+		}
+
+		entries := changeEntries(base, compliance.RecordedChanges(c), classifier)
+		if len(entries) == 0 {
+			base.NewValues = map[string]any{"status_code": c.Writer.Status()}
+			entries = append(entries, base)
+		}
+
+		// The entry is kept even if the client has gone away
+		ctx := context.WithoutCancel(c.Request.Context())
+		for _, entry := range entries {
+			if err := logger.LogAuditEvent(ctx, entry); err != nil {
+				log.Printf("audit middleware: failed to log %s %s: %v", entry.HTTPMethod, entry.Endpoint, err)
+			}
+		}
+	}
+}
+
+// changeEntries builds one entry per recorded change from the request's base
+// entry
+func changeEntries(base compliance.AuditEntry, changes []compliance.AuditChange, classifier *SensitiveDataClassifier) []compliance.AuditEntry {
+	entries := make([]compliance.AuditEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := base
+		entry.TargetType = change.TargetType
+		if change.TargetID != "" {
+			entry.TargetID = change.TargetID
+		}
+		entry.TargetOwnerID = change.TargetOwnerID
+		entry.DataCategory = change.DataCategory
+		entry.OldValues = compliance.SnapshotValues(change.Before)
+		entry.NewValues = compliance.SnapshotValues(change.After)
+
+		switch {
+		case entry.OldValues == nil && entry.NewValues != nil:
+			entry.EventAction = "create"
+		case entry.OldValues != nil && entry.NewValues == nil:
+			entry.EventAction = "delete"
+		case entry.OldValues != nil:
+			entry.EventAction = "update"
+		}
+		if change.Action != "" {
+			entry.EventAction = change.Action
+		}
+		entry.SensitivityLevel = higherSensitivity(entry.SensitivityLevel,
+			highestFieldLevel(classifier, entry.OldValues),
+			highestFieldLevel(classifier, entry.NewValues))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// principal returns the authenticated actor: a JWT user, then a settings user
+// authenticated by session or API key. Headers such as X-User-ID are set by
+// the client and are never trusted, so any other request is anonymous.
+func principal(c *gin.Context) (string, string) {
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID, compliance.ActorTypeUser
+	}
+	if v, ok := c.Get("settings_user_id"); ok {
+		userID := fmt.Sprint(v)
+		if _, viaKey := c.Get("api_key_id"); viaKey {
+			return userID, compliance.ActorTypeAPIClient
 		}
+		return userID, compliance.ActorTypeUser
+	}
+	return "", compliance.ActorTypeAnonymous
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
 
-		if userID := c.GetHeader("X-User-ID"); userID != "" {
-			entry.ActorID = userID
+// serviceFromPath returns the module a route belongs to, such as "settings"
+// for /api/v1/settings/profile
+func serviceFromPath(path, fallback string) string {
+	rest := strings.TrimPrefix(path, "/api/")
+	if rest == path {
+		return fallback
+	}
+	if seg := strings.SplitN(rest, "/", 2); isVersion(seg[0]) {
+		if len(seg) < 2 {
+			return fallback
 		}
+		rest = seg[1]
+	}
+	module := strings.SplitN(rest, "/", 2)[0]
+	if module == "" || strings.HasPrefix(module, ":") {
+		return fallback
+	}
+	return module
+}
 
-		entry.SensitivityLevel = classifyEndpoint(c.FullPath())
+func isVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(segment[1:])
+	return err == nil
+}
 
-		_ = service.LogAuditEvent(c.Request.Context(), entry)
+func highestFieldLevel(classifier *SensitiveDataClassifier, values map[string]any) string {
+	level := compliance.SensitivityNormal
+	for field, value := range values {
+		level = higherSensitivity(level, classifier.ClassifyField(field))
+		if nested, ok := value.(map[string]any); ok {
+			level = higherSensitivity(level, highestFieldLevel(classifier, nested))
+		}
+	}
+	return level
+}
 
-		_ = start // can be used for latency tracking
+func higherSensitivity(levels ...string) string {
+	highest := compliance.SensitivityNormal
+	for _, level := range levels {
+		switch level {
+		case compliance.SensitivityHighly:
+			return level
+		case compliance.SensitivitySensitive:
+			highest = level
+		}
 	}
+	return highest
 }
 
 func methodToAction(method string) string {
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"carbon-scribe/project-portal/project-portal-backend/internal/compliance"
+
+	"github.com/gin-gonic/gin"
+)
+
+type recordingLogger struct {
+	entries []compliance.AuditEntry
+}
+
+func (l *recordingLogger) LogAuditEvent(_ context.Context, entry compliance.AuditEntry) error {
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func TestRedactMasksAndHashesSensitiveFields(t *testing.T) {
+	values := map[string]any{
+		"secondary_email":   "Jane@Example.com",
+		"phone_number":      "+44 20 7946 0000",
+		"phone_verified":    true,
+		"secret":            "sk_live_abc",
+		"payment_method_id": "pm_123",
+		"display_name":      "Jane",
+		"address":           map[string]any{"city": "London"},
+		"integrations": []any{
+			map[string]any{"name": "slack", "webhook_secret": "whsec_1"},
+		},
+	}
+	redacted := NewSensitiveDataClassifier().Redact(values)
+
+	email, _ := redacted["secondary_email"].(string)
+	if !strings.HasPrefix(email, "sha256:") || strings.Contains(email, "Example") {
+		t.Fatalf("expected the email to be hashed, got %v", redacted["secondary_email"])
+	}
+	if redacted["secondary_email"] != NewSensitiveDataClassifier().Redact(map[string]any{"email": "jane@example.com "})["email"] {
+		t.Fatalf("expected equal emails to hash alike so changes can be correlated")
+	}
+	if redacted["secret"] != RedactedValue || redacted["payment_method_id"] != RedactedValue {
+		t.Fatalf("expected secrets and payment references to be redacted, got %v", redacted)
+	}
+	if redacted["phone_verified"] != true || redacted["display_name"] != "Jane" {
+		t.Fatalf("expected flags and normal fields to be kept, got %v", redacted)
+	}
+	if address, _ := redacted["address"].(string); !strings.HasPrefix(address, "sha256:") {
+		t.Fatalf("expected the address to be hashed whole, got %v", redacted["address"])
+	}
+	nested := redacted["integrations"].([]any)[0].(map[string]any)
+	if nested["webhook_secret"] != RedactedValue || nested["name"] != "slack" {
+		t.Fatalf("expected nested secrets to be redacted, got %v", nested)
+	}
+	if values["secret"] != "sk_live_abc" {
+		t.Fatalf("expected the input to be left unchanged")
+	}
+}
+
+func TestMiddlewareAuditsMutatingRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := &recordingLogger{}
+	router := gin.New()
+	router.Use(Middleware(logger, "project-portal"))
+
+	api := router.Group("/api/v1/settings", func(c *gin.Context) {
+		c.Set("settings_user_id", "user-1")
+		c.Set("api_key_id", "key-1")
+	})
+	api.GET("/profile", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.PUT("/profile/:id", func(c *gin.Context) {
+		compliance.RecordChange(c, compliance.AuditChange{
+			TargetType: "user_profile",
+			Before:     map[string]any{"phone_number": "1", "bio": "old"},
+			After: struct {
+				Bio string `json:"bio"`
+			}{"new"},
+		})
+		c.Status(http.StatusOK)
+	})
+	api.DELETE("/keys/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/api/v1/projects", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	spoofed := httptest.NewRequest(http.MethodPost, "/api/v1/projects", nil)
+	spoofed.Header.Set("X-User-ID", "user-2")
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/v1/settings/profile", nil),
+		httptest.NewRequest(http.MethodPut, "/api/v1/settings/profile/p-1", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/v1/settings/keys/k-1", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/unrouted", nil),
+		spoofed,
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(logger.entries) != 3 {
+		t.Fatalf("expected the three routed mutating requests to be audited, got %d", len(logger.entries))
+	}
+	update, del, anon := logger.entries[0], logger.entries[1], logger.entries[2]
+	if update.ActorID != "user-1" || update.ActorType != compliance.ActorTypeAPIClient {
+		t.Fatalf("expected the API key principal as actor, got %q %q", update.ActorID, update.ActorType)
+	}
+	if update.ServiceName != "settings" || update.TargetID != "p-1" || update.EventAction != "update" {
+		t.Fatalf("unexpected update entry %+v", update)
+	}
+	if update.OldValues["bio"] != "old" || update.NewValues["bio"] != "new" {
+		t.Fatalf("expected the handler's snapshots, got %v -> %v", update.OldValues, update.NewValues)
+	}
+	if update.SensitivityLevel != compliance.SensitivitySensitive {
+		t.Fatalf("expected the phone number to raise sensitivity, got %q", update.SensitivityLevel)
+	}
+	if del.EventAction != "delete" || del.TargetID != "k-1" || del.NewValues["status_code"] != http.StatusNoContent {
+		t.Fatalf("expected a delete entry with its outcome, got %+v", del)
+	}
+	if anon.ActorID != "" || anon.ActorType != compliance.ActorTypeAnonymous {
+		t.Fatalf("expected an unauthenticated request to be anonymous despite X-User-ID, got %q %q", anon.ActorID, anon.ActorType)
+	}
+}
+
+func TestServiceFromPath(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/settings/profile":   "settings",
+		"/api/auth/login":            "auth",
+		"/api/collaboration/:id":     "collaboration",
+		"/api/v1/":                   "project-portal",
+		"/health":                    "project-portal",
+		"/api/v1/projects/:id/notes": "projects",
+	}
+	for path, want := range cases {
+		if got := serviceFromPath(path, "project-portal"); got != want {
+			t.Errorf("serviceFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -1,11 +1,29 @@
 package audit
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RedactedValue replaces highly sensitive values in redacted audit snapshots.
+const RedactedValue = "[REDACTED]"
+
 // SensitiveDataClassifier identifies sensitive data categories and fields.
 type SensitiveDataClassifier struct {
 	sensitiveFields    map[string]string
+	sensitivePatterns  []fieldPattern
 	sensitiveEndpoints map[string]string
 }
 
+// fieldPattern classifies every field whose name contains fragment.
+type fieldPattern struct {
+	fragment string
+	level    string
+}
+
 // NewSensitiveDataClassifier creates a classifier with default rules.
 func NewSensitiveDataClassifier() *SensitiveDataClassifier {
 	return &SensitiveDataClassifier{
@@ -20,6 +38,28 @@ func NewSensitiveDataClassifier() *SensitiveDataClassifier {
 			"date_of_birth": "sensitive",
 			"ip_address":    "sensitive",
 		},
+		// Checked in order against fields with no exact rule, so secrets and
+		// payment references are caught however a module names them
+		sensitivePatterns: []fieldPattern{
+			{"password", "highly_sensitive"},
+			{"secret", "highly_sensitive"},
+			{"token", "highly_sensitive"},
+			{"api_key", "highly_sensitive"},
+			{"private_key", "highly_sensitive"},
+			{"key_hash", "highly_sensitive"},
+			{"credential", "highly_sensitive"},
+			{"card_number", "highly_sensitive"},
+			{"cvv", "highly_sensitive"},
+			{"iban", "highly_sensitive"},
+			{"bank_account", "highly_sensitive"},
+			{"payment_method", "highly_sensitive"},
+			{"processor_customer", "highly_sensitive"},
+			{"transaction_id", "highly_sensitive"},
+			{"email", "sensitive"},
+			{"phone", "sensitive"},
+			{"address", "sensitive"},
+			{"date_of_birth", "sensitive"},
+		},
 		sensitiveEndpoints: map[string]string{
 			"/api/v1/compliance/": "sensitive",
 			"/api/auth/":          "sensitive",
@@ -30,9 +70,15 @@ func NewSensitiveDataClassifier() *SensitiveDataClassifier {
 
 // ClassifyField returns the sensitivity level for a given field name.
 func (sdc *SensitiveDataClassifier) ClassifyField(fieldName string) string {
-	if level, ok := sdc.sensitiveFields[fieldName]; ok {
+	name := strings.ToLower(fieldName)
+	if level, ok := sdc.sensitiveFields[name]; ok {
 		return level
 	}
+	for _, p := range sdc.sensitivePatterns {
+		if strings.Contains(name, p.fragment) {
+			return p.level
+		}
+	}
 	return "normal"
 }
 
@@ -51,3 +97,70 @@ func (sdc *SensitiveDataClassifier) IsSensitiveField(fieldName string) bool {
 	level := sdc.ClassifyField(fieldName)
 	return level == "sensitive" || level == "highly_sensitive"
 }
+
+// Redact returns a copy of values that is safe to store in the audit log.
+// Highly sensitive fields are replaced with RedactedValue and sensitive ones
+// with a SHA-256 hash, so changes to them can still be correlated without
+// keeping the value. Nested objects and lists are redacted field by field;
+// flags such as phone_verified are kept.
+func (sdc *SensitiveDataClassifier) Redact(values map[string]any) map[string]any {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]any, len(values))
+	for field, value := range values {
+		redacted[field] = sdc.redactField(field, value)
+	}
+	return redacted
+}
+
+func (sdc *SensitiveDataClassifier) redactField(field string, value any) any {
+	if value == nil {
+		return nil
+	}
+	if _, ok := value.(bool); ok {
+		return value
+	}
+	switch sdc.ClassifyField(field) {
+	case "highly_sensitive":
+		return RedactedValue
+	case "sensitive":
+		return hashValue(value)
+	}
+	return sdc.redactValue(value)
+}
+
+func (sdc *SensitiveDataClassifier) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return sdc.Redact(v)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = sdc.redactValue(item)
+		}
+		return items
+	}
+	return value
+}
+
+// hashValue hashes a value's string form, or its JSON form if it is not a
+// string; empty strings are left empty
+func hashValue(value any) any {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return v
+		}
+		data = []byte(strings.ToLower(strings.TrimSpace(v)))
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(v))
+		}
+		data = encoded
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
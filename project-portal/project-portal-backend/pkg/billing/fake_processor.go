@@ -0,0 +1,101 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeProcessor is an in-memory payment processor for development and
+// tests. Payment methods whose id contains "decline" are declined and those
+// containing "pending" settle asynchronously. Webhooks are signed like
+// Stripe's with WebhookSecret.
+type FakeProcessor struct {
+	WebhookSecret string
+
+	mu      sync.Mutex
+	charges map[string]ChargeRecord // by idempotency key
+	refunds []RefundRequest
+}
+
+// ChargeRecord is a charge taken by the fake processor
+type ChargeRecord struct {
+	Request ChargeRequest
+	Result  ChargeResult
+}
+
+func NewFakeProcessor(webhookSecret string) *FakeProcessor {
+	return &FakeProcessor{WebhookSecret: webhookSecret, charges: map[string]ChargeRecord{}}
+}
+
+func (p *FakeProcessor) AttachPaymentMethod(_ context.Context, customerID, paymentMethodID string) (*PaymentMethod, error) {
+	if strings.TrimSpace(paymentMethodID) == "" {
+		return nil, fmt.Errorf("payment method is required")
+	}
+	if customerID == "" {
+		customerID = "cus_fake_" + uuid.NewString()[:8]
+	}
+	last4 := "4242"
+	if strings.Contains(paymentMethodID, "decline") {
+		last4 = "0002"
+	}
+	return &PaymentMethod{ID: paymentMethodID, CustomerID: customerID, Type: "card", Brand: "visa", Last4: last4, ExpMonth: 12, ExpYear: time.Now().Year() + 3}, nil
+}
+
+func (p *FakeProcessor) Charge(_ context.Context, req ChargeRequest) (*ChargeResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.IdempotencyKey != "" {
+		if prev, ok := p.charges[req.IdempotencyKey]; ok {
+			result := prev.Result
+			return &result, nil
+		}
+	}
+	result := ChargeResult{ID: "pi_fake_" + uuid.NewString()[:12], Status: ChargeSucceeded}
+	switch {
+	case strings.Contains(req.PaymentMethodID, "decline"):
+		result.Status, result.FailureCode, result.FailureMessage = ChargeFailed, "card_declined", "Your card was declined."
+	case strings.Contains(req.PaymentMethodID, "pending"):
+		result.Status = ChargeProcessing
+	}
+	key := req.IdempotencyKey
+	if key == "" {
+		key = result.ID
+	}
+	p.charges[key] = ChargeRecord{Request: req, Result: result}
+	return &result, nil
+}
+
+func (p *FakeProcessor) Refund(_ context.Context, req RefundRequest) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refunds = append(p.refunds, req)
+	return &RefundResult{ID: "re_fake_" + uuid.NewString()[:12], Status: "succeeded"}, nil
+}
+
+func (p *FakeProcessor) ParseWebhook(payload []byte, signature string, now time.Time) (*PaymentEvent, error) {
+	// The fake emits Stripe-shaped events, so it shares the Stripe parser
+	return (&StripeProcessor{WebhookSecret: p.WebhookSecret}).ParseWebhook(payload, signature, now)
+}
+
+// Charges returns every charge taken, in no particular order
+func (p *FakeProcessor) Charges() []ChargeRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]ChargeRecord, 0, len(p.charges))
+	for _, c := range p.charges {
+		out = append(out, c)
+	}
+	return out
+}
+
+// Refunds returns every refund requested
+func (p *FakeProcessor) Refunds() []RefundRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]RefundRequest{}, p.refunds...)
+}
@@ -1,13 +1,187 @@
 package billing
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// InvoiceLine is one row of an invoice document
+type InvoiceLine struct {
+	Description string
+	Quantity    float64
+	UnitAmount  float64
+	Amount      float64
+}
+
+// InvoiceDocument is everything printed on an invoice or credit note
+type InvoiceDocument struct {
+	Title       string // "Invoice" or "Credit note"
+	Number      string
+	IssuedAt    time.Time
+	DueDate     *time.Time
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	Currency    string
+	BillTo      []string // customer name and address lines
+	Reference   string   // e.g. the invoice a credit note applies to
+	Lines       []InvoiceLine
+	Subtotal    float64
+	TaxLabel    string
+	TaxAmount   float64
+	Total       float64
+	Notes       string
+}
 
 type InvoiceGenerator interface {
-	GeneratePDF(invoiceNumber string) (string, error)
+	GeneratePDF(doc InvoiceDocument) ([]byte, error)
 }
 
-type NoopInvoiceGenerator struct{}
+// PDFInvoiceGenerator renders invoices as A4 PDFs in the CarbonScribe
+// document style
+type PDFInvoiceGenerator struct {
+	Issuer []string // company name and address printed under the banner
+}
+
+func NewPDFInvoiceGenerator() PDFInvoiceGenerator {
+	return PDFInvoiceGenerator{Issuer: []string{"CarbonScribe", "billing@carbonscribe.io"}}
+}
+
+func (g PDFInvoiceGenerator) GeneratePDF(doc InvoiceDocument) ([]byte, error) {
+	if doc.Number == "" {
+		return nil, fmt.Errorf("invoice number is required")
+	}
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(150, 150, 150)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%s %s  |  Page %d", doc.Title, doc.Number, pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Banner
+	pdf.SetFillColor(34, 85, 56)
+	pdf.Rect(0, 0, 210, 18, "F")
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetXY(20, 4)
+	pdf.CellFormat(170, 10, "CarbonScribe  |  "+doc.Title, "", 0, "L", false, 0, "")
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetXY(20, 26)
+
+	// Issuer and customer side by side, document details below
+	top := pdf.GetY()
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range g.Issuer {
+		pdf.CellFormat(85, 5, tr(line), "", 2, "L", false, 0, "")
+	}
+	pdf.SetXY(110, top)
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(80, 5, "Bill to", "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range doc.BillTo {
+		pdf.CellFormat(80, 5, tr(line), "", 2, "L", false, 0, "")
+	}
+	pdf.SetY(top + float64(5*(maxInt(len(g.Issuer), len(doc.BillTo)+1)+2)))
+
+	details := [][2]string{
+		{doc.Title + " number", doc.Number},
+		{"Issued", doc.IssuedAt.Format("2006-01-02")},
+	}
+	if doc.DueDate != nil {
+		details = append(details, [2]string{"Due", doc.DueDate.Format("2006-01-02")})
+	}
+	if !doc.PeriodStart.IsZero() {
+		details = append(details, [2]string{"Billing period", doc.PeriodStart.Format("2006-01-02") + " to " + doc.PeriodEnd.Format("2006-01-02")})
+	}
+	if doc.Reference != "" {
+		details = append(details, [2]string{"Reference", doc.Reference})
+	}
+	for _, d := range details {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(40, 6, d[0]+":", "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(130, 6, tr(d[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// Line items
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 245, 238)
+	pdf.SetTextColor(34, 85, 56)
+	pdf.CellFormat(95, 8, "  Description", "", 0, "L", true, 0, "")
+	pdf.CellFormat(20, 8, "Qty", "", 0, "R", true, 0, "")
+	pdf.CellFormat(27, 8, "Unit price", "", 0, "R", true, 0, "")
+	pdf.CellFormat(28, 8, "Amount  ", "", 1, "R", true, 0, "")
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range doc.Lines {
+		pdf.CellFormat(95, 7, "  "+tr(line.Description), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(20, 7, formatQuantity(line.Quantity), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(27, 7, formatMoney(line.UnitAmount, doc.Currency), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 7, formatMoney(line.Amount, doc.Currency)+"  ", "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	totals := [][2]string{{"Subtotal", formatMoney(doc.Subtotal, doc.Currency)}}
+	if doc.TaxLabel != "" || doc.TaxAmount != 0 {
+		label := doc.TaxLabel
+		if label == "" {
+			label = "Tax"
+		}
+		totals = append(totals, [2]string{label, formatMoney(doc.TaxAmount, doc.Currency)})
+	}
+	totals = append(totals, [2]string{"Total", formatMoney(doc.Total, doc.Currency)})
+	for i, t := range totals {
+		style := ""
+		if i == len(totals)-1 {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.CellFormat(142, 7, tr(t[0]), "", 0, "R", false, 0, "")
+		pdf.CellFormat(28, 7, t[1]+"  ", "", 1, "R", false, 0, "")
+	}
+
+	if doc.Notes != "" {
+		pdf.Ln(8)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.MultiCell(170, 5, tr(doc.Notes), "", "L", false)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("pdf rendering error: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("pdf output error: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func formatMoney(amount float64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%.2f %s", sign, amount, currency)
+}
+
+func formatQuantity(q float64) string {
+	if q == float64(int64(q)) {
+		return fmt.Sprintf("%d", int64(q))
+	}
+	return fmt.Sprintf("%.2f", q)
+}
 
-func (NoopInvoiceGenerator) GeneratePDF(invoiceNumber string) (string, error) {
-	return fmt.Sprintf("generated://invoices/%s.pdf", invoiceNumber), nil
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
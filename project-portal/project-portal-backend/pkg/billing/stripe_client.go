@@ -1,13 +1,259 @@
 package billing
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
-type StripeClient interface {
-	CreatePaymentMethod(ctx context.Context, token string) (string, error)
+// StripeProcessor talks to the Stripe API, or any service implementing the
+// same endpoints. Charges are PaymentIntents confirmed off-session, so the
+// charge id is the PaymentIntent id.
+type StripeProcessor struct {
+	SecretKey     string
+	WebhookSecret string
+	BaseURL       string // defaults to https://api.stripe.com
+	Client        *http.Client
 }
 
-type NoopStripeClient struct{}
+func NewStripeProcessor(secretKey, webhookSecret string) *StripeProcessor {
+	return &StripeProcessor{
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type stripeError struct {
+	Type          string               `json:"type"`
+	Code          string               `json:"code"`
+	DeclineCode   string               `json:"decline_code"`
+	Message       string               `json:"message"`
+	PaymentIntent *stripePaymentIntent `json:"payment_intent"`
+}
+
+type stripePaymentIntent struct {
+	ID               string            `json:"id"`
+	Status           string            `json:"status"`
+	Amount           int64             `json:"amount"`
+	Metadata         map[string]string `json:"metadata"`
+	LastPaymentError *stripeError      `json:"last_payment_error"`
+}
+
+func (p *StripeProcessor) AttachPaymentMethod(ctx context.Context, customerID, paymentMethodID string) (*PaymentMethod, error) {
+	if customerID == "" {
+		var customer struct {
+			ID string `json:"id"`
+		}
+		if err := p.call(ctx, http.MethodPost, "/v1/customers", url.Values{}, "", &customer); err != nil {
+			return nil, err
+		}
+		customerID = customer.ID
+	}
+	var pm struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Card *struct {
+			Brand    string `json:"brand"`
+			Last4    string `json:"last4"`
+			ExpMonth int    `json:"exp_month"`
+			ExpYear  int    `json:"exp_year"`
+		} `json:"card"`
+		USBankAccount *struct {
+			Last4 string `json:"last4"`
+		} `json:"us_bank_account"`
+		SEPADebit *struct {
+			Last4 string `json:"last4"`
+		} `json:"sepa_debit"`
+	}
+	path := "/v1/payment_methods/" + url.PathEscape(paymentMethodID) + "/attach"
+	if err := p.call(ctx, http.MethodPost, path, url.Values{"customer": {customerID}}, "", &pm); err != nil {
+		return nil, err
+	}
+	out := &PaymentMethod{ID: pm.ID, CustomerID: customerID, Type: pm.Type}
+	switch {
+	case pm.Card != nil:
+		out.Type, out.Brand, out.Last4, out.ExpMonth, out.ExpYear = "card", pm.Card.Brand, pm.Card.Last4, pm.Card.ExpMonth, pm.Card.ExpYear
+	case pm.USBankAccount != nil:
+		out.Type, out.Last4 = "bank_account", pm.USBankAccount.Last4
+	case pm.SEPADebit != nil:
+		out.Type, out.Last4 = "bank_account", pm.SEPADebit.Last4
+	}
+	return out, nil
+}
+
+func (p *StripeProcessor) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	form := url.Values{
+		"amount":         {strconv.FormatInt(req.Amount, 10)},
+		"currency":       {strings.ToLower(req.Currency)},
+		"customer":       {req.CustomerID},
+		"payment_method": {req.PaymentMethodID},
+		"confirm":        {"true"},
+		"off_session":    {"true"},
+		"description":    {req.Description},
+	}
+	for k, v := range req.Metadata {
+		form.Set("metadata["+k+"]", v)
+	}
+	var pi stripePaymentIntent
+	err := p.call(ctx, http.MethodPost, "/v1/payment_intents", form, req.IdempotencyKey, &pi)
+	var apiErr *stripeAPIError
+	if errors.As(err, &apiErr) && apiErr.Err.Type == "card_error" {
+		// Declines answer 402 with the failed PaymentIntent attached
+		result := &ChargeResult{Status: ChargeFailed, FailureCode: firstNonEmpty(apiErr.Err.DeclineCode, apiErr.Err.Code), FailureMessage: apiErr.Err.Message}
+		if apiErr.Err.PaymentIntent != nil {
+			result.ID = apiErr.Err.PaymentIntent.ID
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return paymentIntentResult(pi), nil
+}
+
+func (p *StripeProcessor) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	form := url.Values{
+		"payment_intent":   {req.ChargeID},
+		"amount":           {strconv.FormatInt(req.Amount, 10)},
+		"reason":           {"requested_by_customer"},
+		"metadata[reason]": {req.Reason},
+	}
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := p.call(ctx, http.MethodPost, "/v1/refunds", form, req.IdempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	return &RefundResult{ID: refund.ID, Status: refund.Status}, nil
+}
+
+func (p *StripeProcessor) ParseWebhook(payload []byte, signature string, now time.Time) (*PaymentEvent, error) {
+	if err := VerifyWebhookSignature(p.WebhookSecret, payload, signature, now); err != nil {
+		return nil, err
+	}
+	var event struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookPayload, err)
+	}
+	out := &PaymentEvent{ID: event.ID, Created: time.Unix(event.Created, 0).UTC()}
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed":
+		var pi stripePaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &pi); err != nil {
+			return nil, fmt.Errorf("%w: payment intent: %v", ErrInvalidWebhookPayload, err)
+		}
+		out.Type = EventPaymentSucceeded
+		if event.Type == "payment_intent.payment_failed" {
+			out.Type = EventPaymentFailed
+			if pi.LastPaymentError != nil {
+				out.FailureMessage = pi.LastPaymentError.Message
+			}
+		}
+		out.ChargeID, out.Amount, out.Metadata = pi.ID, pi.Amount, pi.Metadata
+	case "charge.dispute.created":
+		var dispute struct {
+			Amount        int64             `json:"amount"`
+			PaymentIntent string            `json:"payment_intent"`
+			Reason        string            `json:"reason"`
+			Metadata      map[string]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.Data.Object, &dispute); err != nil {
+			return nil, fmt.Errorf("%w: dispute: %v", ErrInvalidWebhookPayload, err)
+		}
+		out.Type = EventPaymentDisputed
+		out.ChargeID, out.Amount, out.Metadata, out.FailureMessage = dispute.PaymentIntent, dispute.Amount, dispute.Metadata, dispute.Reason
+	}
+	return out, nil
+}
+
+type stripeAPIError struct {
+	Status int
+	Err    stripeError
+}
+
+func (e *stripeAPIError) Error() string {
+	return fmt.Sprintf("stripe: %s (status %d, %s)", e.Err.Message, e.Status, e.Err.Type)
+}
+
+func (p *StripeProcessor) call(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	base := p.BaseURL
+	if base == "" {
+		base = "https://api.stripe.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(base, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.SecretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var envelope struct {
+			Error stripeError `json:"error"`
+		}
+		_ = json.Unmarshal(body, &envelope)
+		return &stripeAPIError{Status: resp.StatusCode, Err: envelope.Error}
+	}
+	return json.Unmarshal(body, out)
+}
+
+func paymentIntentResult(pi stripePaymentIntent) *ChargeResult {
+	result := &ChargeResult{ID: pi.ID}
+	switch pi.Status {
+	case "succeeded":
+		result.Status = ChargeSucceeded
+	case "processing":
+		result.Status = ChargeProcessing
+	default:
+		// requires_action and requires_payment_method cannot complete
+		// off-session
+		result.Status = ChargeFailed
+		result.FailureCode = pi.Status
+		result.FailureMessage = "payment requires customer action"
+		if pi.LastPaymentError != nil {
+			result.FailureCode = firstNonEmpty(pi.LastPaymentError.DeclineCode, pi.LastPaymentError.Code)
+			result.FailureMessage = pi.LastPaymentError.Message
+		}
+	}
+	return result
+}
 
-func (NoopStripeClient) CreatePaymentMethod(ctx context.Context, token string) (string, error) {
-	return token, nil
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
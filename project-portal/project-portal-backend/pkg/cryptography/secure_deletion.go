@@ -28,5 +28,9 @@ func (sd *SecureDeletion) CreateDeletionToken(entityID, entityType string) (stri
 	if _, err := rand.Read(token); err != nil {
 		return "", fmt.Errorf("generating deletion token: %w", err)
 	}
-	return fmt.Sprintf("del_%s_%s_%x", entityType, entityID[:8], token), nil
+	prefix := entityID
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+	return fmt.Sprintf("del_%s_%s_%x", entityType, prefix, token), nil
 }
@@ -157,6 +157,40 @@ func (c *Client) Search(ctx context.Context, indexName string, query interface{}
 	return r, nil
 }
 
+// UpdateByQuery runs the request's script on every document matching its
+// query and returns how many were updated
+func (c *Client) UpdateByQuery(ctx context.Context, indexName string, body interface{}) (int64, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return 0, fmt.Errorf("error encoding query: %w", err)
+	}
+
+	refresh := true
+	req := esapi.UpdateByQueryRequest{
+		Index:   []string{indexName},
+		Body:    &buf,
+		Refresh: &refresh,
+	}
+
+	res, err := req.Do(ctx, c.es)
+	if err != nil {
+		return 0, fmt.Errorf("error updating by query: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, fmt.Errorf("error update by query response: %s", res.String())
+	}
+
+	var r struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return 0, fmt.Errorf("error parsing the response body: %w", err)
+	}
+	return r.Updated, nil
+}
+
 // Health checks the cluster health
 func (c *Client) Health(ctx context.Context) error {
 	res, err := c.es.Cluster.Health()
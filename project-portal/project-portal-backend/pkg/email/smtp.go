@@ -0,0 +1,74 @@
+// Package email sends plain-text transactional email.
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers one message
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPConfig holds the relay used for outgoing mail
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPSender sends mail through an SMTP relay, authenticating with PLAIN
+// auth when a username is configured. net/smtp upgrades to TLS when the
+// server offers STARTTLS.
+type SMTPSender struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SMTPSender{cfg: cfg}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	addr := net.JoinHostPort(s.cfg.Host, fmt.Sprint(s.cfg.Port))
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	msg := strings.Join([]string{
+		"From: " + s.cfg.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(body, "\n", "\r\n"),
+	}, "\r\n")
+
+	// net/smtp has no context support, so the send runs in the background
+	// and is abandoned when ctx ends
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(addr, auth, s.cfg.From, []string{to}, []byte(msg)) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp send to %s: %w", to, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
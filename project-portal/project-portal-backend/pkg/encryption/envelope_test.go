@@ -0,0 +1,151 @@
+package encryption
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeVaultCarriesKeyIDAndRotates(t *testing.T) {
+	keyring, err := NewKeyring()
+	if err != nil {
+		t.Fatalf("NewKeyring error: %v", err)
+	}
+	if _, err := keyring.Rotate("settings", time.Now()); err != nil {
+		t.Fatalf("Rotate error: %v", err)
+	}
+	kms := NewKeyringKMS(keyring)
+	v, err := NewEnvelopeVault(kms, nil)
+	if err != nil {
+		t.Fatalf("NewEnvelopeVault error: %v", err)
+	}
+
+	ciphertext, err := v.EncryptString("secret-value")
+	if err != nil {
+		t.Fatalf("EncryptString error: %v", err)
+	}
+	ref, ok := KeyRefOf(ciphertext)
+	if !ok || ref != (KeyRef{ID: "settings", Version: 1}) {
+		t.Fatalf("expected ciphertext to carry settings:1, got %v %v", ref, ok)
+	}
+	if other, _ := v.EncryptString("secret-value"); other == ciphertext {
+		t.Fatalf("expected a fresh data key per record")
+	}
+
+	if _, err := kms.RotateKey(context.Background()); err != nil {
+		t.Fatalf("RotateKey error: %v", err)
+	}
+	if needed, _ := v.NeedsReencrypt(ciphertext); !needed {
+		t.Fatalf("expected old ciphertext to need re-encryption")
+	}
+	plain, err := v.DecryptString(ciphertext)
+	if err != nil || plain != "secret-value" {
+		t.Fatalf("expected old key to keep decrypting, got %q %v", plain, err)
+	}
+
+	moved, changed, err := v.Reencrypt(ciphertext)
+	if err != nil || !changed {
+		t.Fatalf("Reencrypt = %v %v", changed, err)
+	}
+	if ref, _ := KeyRefOf(moved); ref.Version != 2 {
+		t.Fatalf("expected re-encrypted value under version 2, got %v", ref)
+	}
+	if _, changed, _ := v.Reencrypt(moved); changed {
+		t.Fatalf("expected current ciphertext to be left alone")
+	}
+}
+
+func TestEnvelopeVaultRejectsTamperedKeyID(t *testing.T) {
+	keyring, _ := NewKeyring()
+	keyring.Rotate("settings", time.Now())
+	keyring.Rotate("settings", time.Now())
+	v, _ := NewEnvelopeVault(NewKeyringKMS(keyring), nil)
+
+	ciphertext, err := v.EncryptString("secret-value")
+	if err != nil {
+		t.Fatalf("EncryptString error: %v", err)
+	}
+	tampered := strings.Replace(ciphertext, "ev1:settings:2:", "ev1:settings:1:", 1)
+	if _, err := v.DecryptString(tampered); err == nil {
+		t.Fatalf("expected tampered key reference to fail")
+	}
+}
+
+func TestEnvelopeVaultReadsLegacyCiphertext(t *testing.T) {
+	legacyKey := []byte("0123456789abcdef0123456789abcdef")
+	legacy, _ := NewVault(legacyKey)
+	old, err := legacy.EncryptString("secret-value")
+	if err != nil {
+		t.Fatalf("EncryptString error: %v", err)
+	}
+
+	keyring, _ := NewKeyring()
+	keyring.Rotate("settings", time.Now())
+	v, err := NewEnvelopeVault(NewKeyringKMS(keyring), legacyKey)
+	if err != nil {
+		t.Fatalf("NewEnvelopeVault error: %v", err)
+	}
+	if plain, err := v.DecryptString(old); err != nil || plain != "secret-value" {
+		t.Fatalf("expected legacy ciphertext readable, got %q %v", plain, err)
+	}
+	moved, changed, err := v.Reencrypt(old)
+	if err != nil || !changed {
+		t.Fatalf("Reencrypt = %v %v", changed, err)
+	}
+	if _, ok := KeyRefOf(moved); !ok {
+		t.Fatalf("expected legacy value moved to an envelope")
+	}
+}
+
+func TestLocalFileKMSPersistsRotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "keyring.json")
+	first, err := OpenLocalFileKMS(path, "settings")
+	if err != nil {
+		t.Fatalf("OpenLocalFileKMS error: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected keyring file with 0600 permissions, got %v %v", info, err)
+	}
+	v1, _ := NewEnvelopeVault(first, nil)
+	old, _ := v1.EncryptString("secret-value")
+
+	// A second process sharing the file sees the rotation and both keys
+	second, err := OpenLocalFileKMS(path, "settings")
+	if err != nil {
+		t.Fatalf("OpenLocalFileKMS error: %v", err)
+	}
+	rotated, err := second.RotateKey(context.Background())
+	if err != nil {
+		t.Fatalf("RotateKey error: %v", err)
+	}
+	if rotated.KeyRef != (KeyRef{ID: "settings", Version: 2}) {
+		t.Fatalf("unexpected rotated key %v", rotated.KeyRef)
+	}
+
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	primary, err := first.PrimaryKey(context.Background())
+	if err != nil || primary.Version != 2 {
+		t.Fatalf("expected first instance to reload version 2, got %v %v", primary, err)
+	}
+	if plain, err := v1.DecryptString(old); err != nil || plain != "secret-value" {
+		t.Fatalf("expected version 1 ciphertext readable after rotation, got %q %v", plain, err)
+	}
+}
+
+func TestRotateIfDue(t *testing.T) {
+	keyring, _ := NewKeyring()
+	keyring.Rotate("settings", time.Now().Add(-100*24*time.Hour))
+	kms := NewKeyringKMS(keyring)
+	rm := NewRotationManager(RotationPolicy{Enabled: true, Interval: 90 * 24 * time.Hour})
+
+	info, rotated, err := rm.RotateIfDue(context.Background(), kms, time.Now())
+	if err != nil || !rotated || info.Version != 2 {
+		t.Fatalf("expected rotation to version 2, got %v %v %v", info, rotated, err)
+	}
+	if _, rotated, _ := rm.RotateIfDue(context.Background(), kms, time.Now()); rotated {
+		t.Fatalf("expected fresh key not to rotate again")
+	}
+}
@@ -1,6 +1,9 @@
 package encryption
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type RotationPolicy struct {
 	Enabled  bool
@@ -21,3 +24,22 @@ func (r *RotationManager) ShouldRotate(lastRotated time.Time, now time.Time) boo
 	}
 	return now.Sub(lastRotated) >= r.policy.Interval
 }
+
+// RotateIfDue creates a new primary key version once the current one is older
+// than the policy interval. KMS implementations that cannot rotate are left
+// alone.
+func (r *RotationManager) RotateIfDue(ctx context.Context, kms KMS, now time.Time) (KeyInfo, bool, error) {
+	primary, err := kms.PrimaryKey(ctx)
+	if err != nil {
+		return KeyInfo{}, false, err
+	}
+	rotator, ok := kms.(KeyRotator)
+	if !ok || !r.ShouldRotate(primary.CreatedAt, now) {
+		return primary, false, nil
+	}
+	rotated, err := rotator.RotateKey(ctx)
+	if err != nil {
+		return primary, false, err
+	}
+	return rotated, true, nil
+}
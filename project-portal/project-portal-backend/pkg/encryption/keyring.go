@@ -0,0 +1,129 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// KeyRef identifies one version of a master key
+type KeyRef struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+}
+
+func (r KeyRef) String() string {
+	return fmt.Sprintf("%s:%d", r.ID, r.Version)
+}
+
+// KeyInfo describes a master key without its material
+type KeyInfo struct {
+	KeyRef
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MasterKey is a key-encryption key held by a keyring
+type MasterKey struct {
+	KeyInfo
+	Key []byte `json:"-"`
+}
+
+// Keyring holds master keys by ID and version. The primary key, used for new
+// data keys, is the one with the highest version.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[KeyRef]MasterKey
+	primary KeyRef
+}
+
+func NewKeyring(keys ...MasterKey) (*Keyring, error) {
+	k := &Keyring{keys: map[KeyRef]MasterKey{}}
+	for _, key := range keys {
+		if err := k.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *Keyring) Add(key MasterKey) error {
+	if !keyIDPattern.MatchString(key.ID) {
+		return fmt.Errorf("invalid key id %q", key.ID)
+	}
+	if key.Version <= 0 {
+		return fmt.Errorf("key %s: version must be positive", key.ID)
+	}
+	if len(key.Key) != 32 {
+		return fmt.Errorf("key %s: master keys must be 32 bytes", key.KeyRef)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, exists := k.keys[key.KeyRef]; exists {
+		return fmt.Errorf("duplicate key %s", key.KeyRef)
+	}
+	k.keys[key.KeyRef] = key
+	if current, ok := k.keys[k.primary]; !ok || key.Version > current.Version ||
+		(key.Version == current.Version && key.CreatedAt.After(current.CreatedAt)) {
+		k.primary = key.KeyRef
+	}
+	return nil
+}
+
+func (k *Keyring) Primary() (MasterKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[k.primary]
+	return key, ok
+}
+
+func (k *Keyring) Get(ref KeyRef) (MasterKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[ref]
+	return key, ok
+}
+
+// Keys lists all keys ordered by ID and version
+func (k *Keyring) Keys() []MasterKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make([]MasterKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		out = append(out, key)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ID != out[j].ID {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
+
+// Rotate adds a random key one version above the primary and makes it primary
+func (k *Keyring) Rotate(id string, now time.Time) (MasterKey, error) {
+	version := 1
+	if current, ok := k.Primary(); ok {
+		version = current.Version + 1
+		if id == "" {
+			id = current.ID
+		}
+	}
+	material := make([]byte, 32)
+	if _, err := rand.Read(material); err != nil {
+		return MasterKey{}, err
+	}
+	key := MasterKey{
+		KeyInfo: KeyInfo{KeyRef: KeyRef{ID: id, Version: version}, CreatedAt: now.UTC()},
+		Key:     material,
+	}
+	if err := k.Add(key); err != nil {
+		return MasterKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,276 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KMS wraps and unwraps per-record data keys with master keys it never
+// exposes. Implementations may call out to a key management service.
+type KMS interface {
+	PrimaryKey(ctx context.Context) (KeyInfo, error)
+	WrapKey(ctx context.Context, ref KeyRef, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, ref KeyRef, wrapped []byte) ([]byte, error)
+}
+
+// KeyRotator is implemented by a KMS that can create new master key versions
+type KeyRotator interface {
+	RotateKey(ctx context.Context) (KeyInfo, error)
+}
+
+// ErrUnknownKey is returned for a key reference the KMS does not hold
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyringKMS is an in-process KMS over a keyring
+type KeyringKMS struct {
+	keyring *Keyring
+}
+
+func NewKeyringKMS(keyring *Keyring) *KeyringKMS {
+	return &KeyringKMS{keyring: keyring}
+}
+
+func (k *KeyringKMS) PrimaryKey(_ context.Context) (KeyInfo, error) {
+	key, ok := k.keyring.Primary()
+	if !ok {
+		return KeyInfo{}, fmt.Errorf("keyring has no keys")
+	}
+	return key.KeyInfo, nil
+}
+
+// WrapKey seals the data key under the master key, bound to its reference
+func (k *KeyringKMS) WrapKey(_ context.Context, ref KeyRef, dataKey []byte) ([]byte, error) {
+	gcm, err := k.masterAEAD(ref)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, dataKey, []byte(ref.String())), nil
+}
+
+func (k *KeyringKMS) UnwrapKey(_ context.Context, ref KeyRef, wrapped []byte) ([]byte, error) {
+	gcm, err := k.masterAEAD(ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	nonce, payload := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, payload, []byte(ref.String()))
+}
+
+func (k *KeyringKMS) RotateKey(_ context.Context) (KeyInfo, error) {
+	key, err := k.keyring.Rotate("", time.Now())
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return key.KeyInfo, nil
+}
+
+func (k *KeyringKMS) masterAEAD(ref KeyRef) (cipher.AEAD, error) {
+	key, ok := k.keyring.Get(ref)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, ref)
+	}
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LocalFileKMS keeps the keyring in a JSON file with hex-encoded keys. The
+// file is re-read when it changes, so replicas sharing it pick up rotations
+// made elsewhere. It suits development and single-host deployments.
+type LocalFileKMS struct {
+	path string
+
+	mu      sync.Mutex
+	kms     *KeyringKMS
+	modTime time.Time
+}
+
+type keyringFile struct {
+	Keys []keyringFileEntry `json:"keys"`
+}
+
+type keyringFileEntry struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenLocalFileKMS loads the keyring at path, creating it with a first key
+// named keyID if the file does not exist
+func OpenLocalFileKMS(path, keyID string) (*LocalFileKMS, error) {
+	l := &LocalFileKMS{path: path}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		keyring, _ := NewKeyring()
+		if _, err := keyring.Rotate(keyID, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := l.save(keyring); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.reload(true); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *LocalFileKMS) PrimaryKey(ctx context.Context) (KeyInfo, error) {
+	kms, err := l.current()
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return kms.PrimaryKey(ctx)
+}
+
+func (l *LocalFileKMS) WrapKey(ctx context.Context, ref KeyRef, dataKey []byte) ([]byte, error) {
+	kms, err := l.current()
+	if err != nil {
+		return nil, err
+	}
+	return kms.WrapKey(ctx, ref, dataKey)
+}
+
+func (l *LocalFileKMS) UnwrapKey(ctx context.Context, ref KeyRef, wrapped []byte) ([]byte, error) {
+	kms, err := l.current()
+	if err != nil {
+		return nil, err
+	}
+	return kms.UnwrapKey(ctx, ref, wrapped)
+}
+
+// RotateKey adds a new primary key version and writes the file
+func (l *LocalFileKMS) RotateKey(_ context.Context) (KeyInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.reloadLocked(false); err != nil {
+		return KeyInfo{}, err
+	}
+	key, err := l.kms.keyring.Rotate("", time.Now())
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if err := l.save(l.kms.keyring); err != nil {
+		return KeyInfo{}, err
+	}
+	if info, err := os.Stat(l.path); err == nil {
+		l.modTime = info.ModTime()
+	}
+	return key.KeyInfo, nil
+}
+
+func (l *LocalFileKMS) current() (*KeyringKMS, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.reloadLocked(false); err != nil {
+		return nil, err
+	}
+	return l.kms, nil
+}
+
+func (l *LocalFileKMS) reload(force bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reloadLocked(force)
+}
+
+// reloadLocked reads the file when it changed since the last load. A file
+// that can no longer be read keeps the keys already loaded.
+func (l *LocalFileKMS) reloadLocked(force bool) error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		if l.kms != nil && !force {
+			return nil
+		}
+		return fmt.Errorf("failed to read keyring: %w", err)
+	}
+	if !force && l.kms != nil && info.ModTime().Equal(l.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring: %w", err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid keyring file %s: %w", l.path, err)
+	}
+	keyring, _ := NewKeyring()
+	for _, entry := range file.Keys {
+		material, err := hex.DecodeString(entry.Key)
+		if err != nil {
+			return fmt.Errorf("invalid key %s:%d: %w", entry.ID, entry.Version, err)
+		}
+		key := MasterKey{
+			KeyInfo: KeyInfo{KeyRef: KeyRef{ID: entry.ID, Version: entry.Version}, CreatedAt: entry.CreatedAt},
+			Key:     material,
+		}
+		if err := keyring.Add(key); err != nil {
+			return err
+		}
+	}
+	if _, ok := keyring.Primary(); !ok {
+		return fmt.Errorf("keyring file %s has no keys", l.path)
+	}
+	l.kms = NewKeyringKMS(keyring)
+	l.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the keyring through a temporary file so readers never see a
+// partial file
+func (l *LocalFileKMS) save(keyring *Keyring) error {
+	file := keyringFile{}
+	for _, key := range keyring.Keys() {
+		file.Keys = append(file.Keys, keyringFileEntry{
+			ID:        key.ID,
+			Version:   key.Version,
+			Key:       hex.EncodeToString(key.Key),
+			CreatedAt: key.CreatedAt,
+		})
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".keyring-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
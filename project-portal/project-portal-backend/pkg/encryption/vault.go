@@ -1,19 +1,54 @@
 package encryption
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
+// envelopePrefix marks ciphertexts sealed with a per-record data key. They
+// read "ev1:<key id>:<key version>:<wrapped data key>:<nonce+ciphertext>".
+// Ciphertexts without it were sealed directly with the legacy vault key.
+const envelopePrefix = "ev1"
+
 type Vault struct {
-	gcm cipher.AEAD
+	gcm cipher.AEAD // legacy single key; nil if only envelopes are read
+	kms KMS
 }
 
 func NewVault(key []byte) (*Vault, error) {
+	gcm, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{gcm: gcm}, nil
+}
+
+// NewEnvelopeVault encrypts with data keys wrapped by the KMS primary key.
+// legacyKey, if set, still decrypts values written by a single-key vault
+// until they are re-encrypted.
+func NewEnvelopeVault(kms KMS, legacyKey []byte) (*Vault, error) {
+	if kms == nil {
+		return nil, fmt.Errorf("envelope vault requires a KMS")
+	}
+	v := &Vault{kms: kms}
+	if len(legacyKey) > 0 {
+		gcm, err := newAEAD(legacyKey)
+		if err != nil {
+			return nil, err
+		}
+		v.gcm = gcm
+	}
+	return v, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
 	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
 		return nil, fmt.Errorf("invalid AES key length: %d", len(key))
 	}
@@ -21,14 +56,13 @@ func NewVault(key []byte) (*Vault, error) {
 	if err != nil {
 		return nil, err
 	}
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-	return &Vault{gcm: gcm}, nil
+	return cipher.NewGCM(block)
 }
 
 func (v *Vault) EncryptString(plaintext string) (string, error) {
+	if v.kms != nil {
+		return v.sealEnvelope(context.Background(), plaintext)
+	}
 	nonce := make([]byte, v.gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
@@ -38,6 +72,12 @@ func (v *Vault) EncryptString(plaintext string) (string, error) {
 }
 
 func (v *Vault) DecryptString(ciphertext string) (string, error) {
+	if strings.HasPrefix(ciphertext, envelopePrefix+":") {
+		return v.openEnvelope(context.Background(), ciphertext)
+	}
+	if v.gcm == nil {
+		return "", fmt.Errorf("ciphertext has no key id and no legacy key is configured")
+	}
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
@@ -53,3 +93,120 @@ func (v *Vault) DecryptString(ciphertext string) (string, error) {
 	}
 	return string(plain), nil
 }
+
+// KeyRefOf returns the master key a ciphertext was sealed under. Legacy
+// ciphertexts carry no key reference.
+func KeyRefOf(ciphertext string) (KeyRef, bool) {
+	parts := strings.Split(ciphertext, ":")
+	if len(parts) != 5 || parts[0] != envelopePrefix {
+		return KeyRef{}, false
+	}
+	version, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return KeyRef{}, false
+	}
+	return KeyRef{ID: parts[1], Version: version}, true
+}
+
+// NeedsReencrypt reports whether a ciphertext is not sealed under the current
+// primary key. It is always false for a vault without a KMS.
+func (v *Vault) NeedsReencrypt(ciphertext string) (bool, error) {
+	if v.kms == nil || ciphertext == "" {
+		return false, nil
+	}
+	ref, ok := KeyRefOf(ciphertext)
+	if !ok {
+		return true, nil
+	}
+	primary, err := v.kms.PrimaryKey(context.Background())
+	if err != nil {
+		return false, err
+	}
+	return ref != primary.KeyRef, nil
+}
+
+// Reencrypt seals a ciphertext under the current primary key. It returns the
+// input unchanged, and false, when that is already the case.
+func (v *Vault) Reencrypt(ciphertext string) (string, bool, error) {
+	needed, err := v.NeedsReencrypt(ciphertext)
+	if err != nil || !needed {
+		return ciphertext, false, err
+	}
+	plain, err := v.DecryptString(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	out, err := v.EncryptString(plain)
+	if err != nil {
+		return "", false, err
+	}
+	return out, true, nil
+}
+
+func (v *Vault) sealEnvelope(ctx context.Context, plaintext string) (string, error) {
+	primary, err := v.kms.PrimaryKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := v.kms.WrapKey(ctx, primary.KeyRef, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	gcm, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	// The key reference is authenticated so it cannot be swapped
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(primary.KeyRef.String()))
+	return strings.Join([]string{
+		envelopePrefix,
+		primary.ID,
+		strconv.Itoa(primary.Version),
+		base64.RawStdEncoding.EncodeToString(wrapped),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+func (v *Vault) openEnvelope(ctx context.Context, ciphertext string) (string, error) {
+	if v.kms == nil {
+		return "", fmt.Errorf("envelope ciphertext requires a KMS")
+	}
+	ref, ok := KeyRefOf(ciphertext)
+	if !ok {
+		return "", fmt.Errorf("malformed envelope ciphertext")
+	}
+	parts := strings.Split(ciphertext, ":")
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("malformed envelope ciphertext: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return "", fmt.Errorf("malformed envelope ciphertext: %w", err)
+	}
+	dataKey, err := v.kms.UnwrapKey(ctx, ref, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	gcm, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, payload := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, payload, []byte(ref.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -152,6 +152,43 @@ func (s *S3Client) UploadBytes(ctx context.Context, key string, data []byte, con
 	return s.Upload(ctx, key, bytes.NewReader(data), contentType)
 }
 
+// ObjectInfo describes a stored object found by ListObjects.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects returns up to limit objects under prefix last modified before
+// olderThan. A limit of 0 or less lists every match.
+func (s *S3Client) ListObjects(ctx context.Context, prefix string, olderThan time.Time, limit int) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list failed for prefix %q: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			if obj.LastModified == nil || !obj.LastModified.Before(olderThan) {
+				continue
+			}
+			info := ObjectInfo{Key: aws.ToString(obj.Key), LastModified: *obj.LastModified}
+			if obj.Size != nil {
+				info.Size = *obj.Size
+			}
+			objects = append(objects, info)
+			if limit > 0 && len(objects) >= limit {
+				return objects, nil
+			}
+		}
+	}
+	return objects, nil
+}
+
 // BucketName returns the configured bucket name.
 func (s *S3Client) BucketName() string {
 	return s.bucket